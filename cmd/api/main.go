@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,12 +21,21 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/lfrfrfr/beon-ipquality/internal/alert"
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
 	"github.com/lfrfrfr/beon-ipquality/internal/api/handlers"
 	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/asn"
 	"github.com/lfrfrfr/beon-ipquality/internal/cache"
 	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/dnsbl"
+	"github.com/lfrfrfr/beon-ipquality/internal/migrate"
 	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/internal/tlsutil"
 	pkglogger "github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
 
 var (
@@ -30,20 +43,46 @@ var (
 	buildTime = "unknown"
 )
 
+var (
+	// liveConfig is the configuration the server runs with; a SIGHUP reload
+	// swaps in a copy carrying the reloaded reloadableKeys
+	liveConfig atomic.Pointer[config.Config]
+	// rateLimiter is rebuilt when the rate limit changes on reload, which
+	// resets the per-client counters
+	rateLimiter atomic.Pointer[fiber.Handler]
+	// certReloader serves the TLS certificate when server.tls is set
+	certReloader *tlsutil.CertReloader
+)
+
+// reloadableKeys are the config keys applied on SIGHUP without a restart
+var reloadableKeys = []string{"scoring", "api.rate_limit", "api.rate_limit_window", "api.ip_policy", "api.tier_scoring_profiles", "lookup.fail_policy"}
+
 func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "./configs/config.yaml", "Path to configuration file")
+	feedsPath := flag.String("feeds", "./configs/feeds.yaml", "Path to feeds configuration file")
+	runMigrations := flag.Bool("migrate", false, "Apply pending database migrations and exit")
 	flag.Parse()
 
 	// Load configuration
-	cfg, err := config.Load(*configPath)
+	cfg, err := config.LoadFromEnv(*configPath)
 	if err != nil {
 		fmt.Printf("Failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
+	liveConfig.Store(cfg)
 
 	// Initialize logger
-	if err := pkglogger.Init(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.Output, cfg.Logging.FilePath); err != nil {
+	if err := pkglogger.InitConfig(pkglogger.Config{
+		Level:      cfg.Logging.Level,
+		Format:     cfg.Logging.Format,
+		Output:     cfg.Logging.Output,
+		FilePath:   cfg.Logging.FilePath,
+		MaxSizeMB:  cfg.Logging.MaxSizeMB,
+		MaxAgeDays: cfg.Logging.MaxAgeDays,
+		MaxBackups: cfg.Logging.MaxBackups,
+		Compress:   cfg.Logging.Compress,
+	}); err != nil {
 		fmt.Printf("Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
@@ -52,6 +91,66 @@ func main() {
 	pkglogger.Info("Starting BEON-IPQuality API Server") // zap.String("version", version),
 	// zap.String("environment", cfg.Env),
 
+	if *runMigrations {
+		if err := migrate.Run(context.Background(), cfg, migrate.Postgres|migrate.ClickHouse); err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Migration failed: %v", err))
+		}
+		return
+	}
+
+	scoringConfig, err := scoring.FromConfig(cfg.Scoring)
+	if err != nil {
+		pkglogger.Fatal(err.Error())
+	}
+	handlers.SetScoringConfig(scoringConfig)
+	scoringProfiles, err := tierScoringProfiles(cfg)
+	if err != nil {
+		pkglogger.Fatal(err.Error())
+	}
+	handlers.SetScoringProfiles(scoringProfiles)
+	handlers.SetCheckOptions(cfg.API.IPPolicy.CheckOptions())
+	handlers.SetFailClosed(cfg.Lookup.FailClosed())
+
+	// High-risk lookup alerts (optional)
+	if hook := cfg.Lookup.Webhook; hook.URL != "" {
+		webhook := alert.NewWebhook(alert.Config{
+			URL:       hook.URL,
+			MinScore:  hook.MinScore,
+			RateLimit: hook.RateLimit,
+			Timeout:   hook.Timeout,
+			Headers:   hook.Headers,
+		})
+		defer webhook.Close()
+		handlers.SetAlertWebhook(webhook)
+		pkglogger.Info(fmt.Sprintf("Alerting on lookups scoring %d or more", hook.MinScore))
+	}
+
+	// Serve the DNSBL zone (if enabled); cached answers are dropped when the
+	// MMDB is reloaded
+	var onMMDBReload func()
+	if cfg.DNSBL.Enabled {
+		responder := dnsbl.NewResponder(dnsbl.Config{
+			Zone:      cfg.DNSBL.Zone,
+			Threshold: cfg.DNSBL.Threshold,
+			CleanTTL:  cfg.DNSBL.CleanTTL,
+			ListedTTL: cfg.DNSBL.ListedTTL,
+			MaxCached: cfg.DNSBL.MaxCached,
+		}, handlers.CheckAddr)
+		server, err := dnsbl.Listen(cfg.DNSBL.Listen, responder)
+		if err != nil {
+			pkglogger.Warn(fmt.Sprintf("Failed to start DNSBL: %v (DNSBL disabled)", err))
+		} else {
+			onMMDBReload = responder.Invalidate
+			go func() {
+				if err := server.Serve(); err != nil {
+					pkglogger.Error(fmt.Sprintf("DNSBL server error: %v", err))
+				}
+			}()
+			defer server.Close()
+			pkglogger.Info(fmt.Sprintf("DNSBL zone %s served on %s/udp", cfg.DNSBL.Zone, server.Addr()))
+		}
+	}
+
 	// Initialize MMDB reader
 	mmdbPath := cfg.MMDB.ReputationPath
 	if mmdbPath == "" {
@@ -63,12 +162,27 @@ func main() {
 		pkglogger.Warn(fmt.Sprintf("Failed to load MMDB: %v (API will return clean results)", err))
 	} else {
 		pkglogger.Info(fmt.Sprintf("Loaded MMDB from %s", mmdbPath))
-		handlers.SetMMDBReader(mmdbReader)
+		if cfg.MMDB.AnonymousIPPath != "" {
+			if err := mmdbReader.LoadAnonymousIP(cfg.MMDB.AnonymousIPPath); err != nil {
+				pkglogger.Warn(err.Error())
+			}
+		}
+		var filterFPRate float64
+		if cfg.MMDB.FlaggedFilter {
+			filterFPRate = cfg.MMDB.FlaggedFilterFPRate
+			if err := mmdbReader.EnableFlaggedFilter(filterFPRate); err != nil {
+				pkglogger.Warn(err.Error())
+			}
+		}
+		handlers.SetLookupProvider(mmdbReader)
 		// Set MMDB config for hot reload
 		handlers.SetMMDBConfig(handlers.MMDBConfig{
-			ReputationPath: mmdbPath,
-			GeoIPCityPath:  cfg.MMDB.GeoLite2CityPath,
-			GeoIPASNPath:   cfg.MMDB.GeoLite2ASNPath,
+			ReputationPath:      mmdbPath,
+			GeoIPCityPath:       cfg.MMDB.GeoLite2CityPath,
+			GeoIPASNPath:        cfg.MMDB.GeoLite2ASNPath,
+			AnonymousIPPath:     cfg.MMDB.AnonymousIPPath,
+			FlaggedFilterFPRate: filterFPRate,
+			OnReload:            onMMDBReload,
 		})
 		defer mmdbReader.Close()
 	}
@@ -76,18 +190,27 @@ func main() {
 	// Initialize Redis cache (if enabled)
 	if cfg.Redis.Enabled {
 		redisCache, err := cache.NewRedisCache(cache.Config{
-			Host:     cfg.Redis.Host,
-			Port:     cfg.Redis.Port,
-			Password: cfg.Redis.Password,
-			DB:       cfg.Redis.DB,
-			PoolSize: cfg.Redis.PoolSize,
-			TTL:      5 * time.Minute,
-			Prefix:   "ipq:",
+			Mode:             cfg.Redis.Mode,
+			Host:             cfg.Redis.Host,
+			Port:             cfg.Redis.Port,
+			Addrs:            cfg.Redis.Addrs,
+			MasterName:       cfg.Redis.MasterName,
+			SentinelPassword: cfg.Redis.SentinelPassword,
+			Password:         cfg.Redis.Password,
+			DB:               cfg.Redis.DB,
+			PoolSize:         cfg.Redis.PoolSize,
+			TTL:              cfg.Redis.TTL,
+			CleanTTL:         cfg.Redis.CleanTTL,
+			Prefix:           "ipq:",
+			BreakerThreshold: cfg.Redis.Breaker.FailureThreshold,
+			BreakerCooldown:  cfg.Redis.Breaker.Cooldown,
 		})
 		if err != nil {
 			pkglogger.Warn(fmt.Sprintf("Failed to connect to Redis: %v (caching disabled)", err))
 		} else {
-			pkglogger.Info(fmt.Sprintf("Connected to Redis at %s:%d", cfg.Redis.Host, cfg.Redis.Port))
+			if mmdbReader != nil {
+				redisCache.SetEpoch(mmdbReader.BuildEpoch())
+			}
 			handlers.SetCache(redisCache)
 			defer redisCache.Close()
 		}
@@ -95,12 +218,71 @@ func main() {
 		pkglogger.Info("Redis caching is disabled")
 	}
 
+	// Connect to PostgreSQL (optional, used by feed status and other DB-backed endpoints)
+	db, err := database.NewPostgresDB(cfg.Database.Postgres.DSN(), cfg.Database.Postgres.MaxConnections, cfg.Database.Postgres.MinConnections)
+	if err != nil {
+		pkglogger.Warn(fmt.Sprintf("Failed to connect to PostgreSQL: %v (DB-backed endpoints disabled)", err))
+	} else {
+		if replica := cfg.Database.Postgres.ReadReplica; replica.Enabled() {
+			if err := db.AttachReadReplica(replica.DSN, replica.MaxConnections, replica.MinConnections); err != nil {
+				pkglogger.Warn(fmt.Sprintf("Failed to connect to PostgreSQL read replica: %v (using primary for lookups)", err))
+			}
+		}
+		if upsert, err := database.ParseUpsertStrategy(cfg.Database.UpsertStrategy); err != nil {
+			pkglogger.Warn(fmt.Sprintf("%v (using max)", err))
+		} else {
+			db.SetUpsertStrategy(upsert)
+		}
+		checkIndexes(db)
+		handlers.SetDatabase(db)
+		middleware.SetKeyLookup(middleware.CachedKeyLookup(db.GetAPIKey, cfg.API.KeyCacheTTL))
+		defer db.Close()
+	}
+
+	// Classify ASN types from asn_info when the database is available, by org name otherwise
+	var asnLookup asn.LookupFunc
+	if db != nil {
+		asnLookup = db.GetASNInfo
+	}
+	handlers.SetASNClassifier(asn.NewClassifier(asnLookup, cfg.Scoring.HostingOrgKeywords, cfg.Scoring.ASNCacheTTL))
+
+	// Connect to ClickHouse (optional, preferred source for request statistics)
+	if cfg.ClickHouse.Enabled {
+		ch, err := analytics.NewClient(analytics.Config{
+			Host:            cfg.ClickHouse.Host,
+			Port:            cfg.ClickHouse.Port,
+			Database:        cfg.ClickHouse.Database,
+			Username:        cfg.ClickHouse.Username,
+			Password:        cfg.ClickHouse.Password,
+			ClientIPMode:    analytics.ClientIPMode(cfg.ClickHouse.ClientIPMode),
+			ClientIPHashKey: cfg.ClickHouse.ClientIPHashKey,
+
+			BreakerThreshold: cfg.ClickHouse.Breaker.FailureThreshold,
+			BreakerCooldown:  cfg.ClickHouse.Breaker.Cooldown,
+		})
+		if err != nil {
+			pkglogger.Warn(fmt.Sprintf("Failed to connect to ClickHouse: %v (stats fall back to PostgreSQL)", err))
+		} else {
+			handlers.SetAnalytics(ch)
+			defer ch.Close()
+		}
+	}
+
+	// Load feeds configuration for the feed status endpoint
+	feedsCfg, err := config.LoadFeeds(*feedsPath)
+	if err != nil {
+		pkglogger.Warn(fmt.Sprintf("Failed to load feeds configuration: %v (feed status disabled)", err))
+	} else {
+		handlers.SetFeedsConfig(feedsCfg)
+	}
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
 		AppName:      "BEON-IPQuality API v" + version,
+		ErrorHandler: middleware.ErrorHandler,
 		// Disable startup message in production
 		DisableStartupMessage: cfg.Env == "production",
 	})
@@ -112,18 +294,47 @@ func main() {
 	setupRoutes(app, cfg)
 
 	// Start server
-	go func() {
-		addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-		pkglogger.Info(fmt.Sprintf("API Server listening on %s", addr))
-		if err := app.Listen(addr); err != nil {
-			pkglogger.Fatal(fmt.Sprintf("Server failed to start: %v", err))
+	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+	if cfg.Server.TLS.Enabled() {
+		ln, err := listenTLS(addr, cfg.Server.TLS)
+		if err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Failed to set up TLS: %v", err))
+		}
+		if interval := cfg.Server.TLS.ReloadInterval; interval > 0 {
+			watchCtx, stopWatch := context.WithCancel(context.Background())
+			defer stopWatch()
+			go certReloader.Watch(watchCtx, interval)
 		}
-	}()
+		go func() {
+			pkglogger.Info(fmt.Sprintf("API Server listening on %s (TLS)", addr))
+			if err := app.Listener(ln); err != nil {
+				pkglogger.Fatal(fmt.Sprintf("Server failed to start: %v", err))
+			}
+		}()
+	} else {
+		go func() {
+			pkglogger.Info(fmt.Sprintf("API Server listening on %s", addr))
+			if err := app.Listen(addr); err != nil {
+				pkglogger.Fatal(fmt.Sprintf("Server failed to start: %v", err))
+			}
+		}()
+	}
 
-	// Graceful shutdown
+	// Graceful shutdown, reloading the configuration on SIGHUP
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+wait:
+	for {
+		select {
+		case <-hup:
+			reload(*configPath, *feedsPath, asnLookup)
+		case <-quit:
+			break wait
+		}
+	}
 
 	pkglogger.Info("Shutting down server...")
 
@@ -137,13 +348,47 @@ func main() {
 	pkglogger.Info("Server exited gracefully")
 }
 
+// listenTLS opens a TLS listener serving the configured certificate, which
+// certReloader picks up again when it is rotated
+func listenTLS(addr string, cfg config.TLSConfig) (net.Listener, error) {
+	reloader, err := tlsutil.NewCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := tlsutil.ServerConfig(reloader, cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	certReloader = reloader
+	if cfg.ClientCAFile != "" {
+		pkglogger.Info("Requiring client certificates (mutual TLS)")
+	}
+	return tls.NewListener(ln, tlsConfig), nil
+}
+
 func setupMiddleware(app *fiber.App, cfg *config.Config) {
 	// Recovery middleware
 	app.Use(recover.New())
 
+	// Request ID middleware (read or generate X-Request-ID)
+	app.Use(middleware.RequestID())
+
+	// Rate limits and request logs key on the client behind trusted proxies
+	if len(cfg.Server.TrustedProxies) > 0 {
+		resolver, err := middleware.NewClientIPResolver(cfg.Server.ProxyHeader, cfg.Server.TrustedProxies)
+		if err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Invalid trusted proxy config: %v", err))
+		}
+		middleware.SetClientIPResolver(resolver)
+	}
+
 	// Logger middleware
 	app.Use(logger.New(logger.Config{
-		Format:     "[${time}] ${status} - ${method} ${path} (${latency})\n",
+		Format:     "[${time}] ${status} - ${method} ${path} (${latency}) ${locals:request_id}\n",
 		TimeFormat: "2006-01-02 15:04:05",
 	}))
 
@@ -156,27 +401,123 @@ func setupMiddleware(app *fiber.App, cfg *config.Config) {
 		}))
 	}
 
-	// Rate limiter middleware
-	if cfg.API.RateLimit > 0 {
-		app.Use(limiter.New(limiter.Config{
-			Max:        cfg.API.RateLimit,
-			Expiration: cfg.API.RateLimitWindow,
-			KeyGenerator: func(c *fiber.Ctx) string {
-				// Use API key if available, otherwise use IP
-				apiKey := c.Get("X-API-Key")
-				if apiKey != "" {
-					return apiKey
-				}
-				return c.IP()
-			},
-			LimitReached: func(c *fiber.Ctx) error {
-				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-					"error":   "rate_limit_exceeded",
-					"message": "Too many requests. Please try again later.",
-				})
-			},
-		}))
+	// Rate limiter middleware (swappable on reload)
+	limit := newRateLimiter(cfg.API)
+	rateLimiter.Store(&limit)
+	app.Use(func(c *fiber.Ctx) error {
+		return (*rateLimiter.Load())(c)
+	})
+}
+
+// newRateLimiter builds the rate limiting middleware; a zero rate limit
+// disables it
+func newRateLimiter(cfg config.APIConfig) fiber.Handler {
+	if cfg.RateLimit <= 0 {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
 	}
+	return limiter.New(limiter.Config{
+		Max:        cfg.RateLimit,
+		Expiration: cfg.RateLimitWindow,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			// Use API key if available, otherwise use IP
+			apiKey := c.Get("X-API-Key")
+			if apiKey != "" {
+				return apiKey
+			}
+			return middleware.ClientIP(c)
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return middleware.WriteError(c, fiber.StatusTooManyRequests, models.ErrCodeRateLimited, "Too many requests. Please try again later.")
+		},
+	})
+}
+
+// reload re-reads both configuration files, applies the reloadable keys
+// (scoring, rate limits) and the feeds configuration, and logs the changes
+// that need a restart. On any error the running configuration is kept.
+func reload(configPath, feedsPath string, asnLookup asn.LookupFunc) {
+	pkglogger.Info("Received SIGHUP, reloading configuration")
+
+	cur := liveConfig.Load()
+	newCfg, err := config.LoadFromEnv(configPath)
+	if err != nil {
+		pkglogger.Error(fmt.Sprintf("Reload failed, keeping current configuration: %v", err))
+		return
+	}
+
+	applied, restart := config.SplitChanges(config.Changes(cur, newCfg), reloadableKeys...)
+	if len(applied) > 0 {
+		scoringConfig, err := scoring.FromConfig(newCfg.Scoring)
+		if err != nil {
+			pkglogger.Error(fmt.Sprintf("Reload failed, keeping current configuration: %v", err))
+			return
+		}
+		scoringProfiles, err := tierScoringProfiles(newCfg)
+		if err != nil {
+			pkglogger.Error(fmt.Sprintf("Reload failed, keeping current configuration: %v", err))
+			return
+		}
+
+		next := *cur
+		next.Scoring = newCfg.Scoring
+		next.API.RateLimit = newCfg.API.RateLimit
+		next.API.RateLimitWindow = newCfg.API.RateLimitWindow
+		next.API.IPPolicy = newCfg.API.IPPolicy
+		next.API.TierScoringProfiles = newCfg.API.TierScoringProfiles
+		next.Lookup.FailPolicy = newCfg.Lookup.FailPolicy
+
+		handlers.SetScoringConfig(scoringConfig)
+		handlers.SetScoringProfiles(scoringProfiles)
+		handlers.SetCheckOptions(next.API.IPPolicy.CheckOptions())
+		handlers.SetFailClosed(next.Lookup.FailClosed())
+		handlers.SetASNClassifier(asn.NewClassifier(asnLookup, next.Scoring.HostingOrgKeywords, next.Scoring.ASNCacheTTL))
+		if next.API.RateLimit != cur.API.RateLimit || next.API.RateLimitWindow != cur.API.RateLimitWindow {
+			limit := newRateLimiter(next.API)
+			rateLimiter.Store(&limit)
+		}
+		liveConfig.Store(&next)
+
+		pkglogger.Info(fmt.Sprintf("Applied config changes: %s", strings.Join(applied, ", ")))
+	}
+	if len(restart) > 0 {
+		pkglogger.Warn(fmt.Sprintf("Config changes require a restart: %s", strings.Join(restart, ", ")))
+	}
+
+	if certReloader != nil {
+		if reloaded, err := certReloader.Reload(); err != nil {
+			pkglogger.Error(fmt.Sprintf("TLS certificate reload failed, keeping the current one: %v", err))
+		} else if reloaded {
+			pkglogger.Info("Reloaded TLS certificate")
+		}
+	}
+
+	feedsCfg, err := config.LoadFeeds(feedsPath)
+	if err != nil {
+		pkglogger.Error(fmt.Sprintf("Failed to reload feeds configuration: %v (keeping current)", err))
+		return
+	}
+	handlers.SetFeedsConfig(feedsCfg)
+	pkglogger.Info("Reloaded feeds configuration")
+}
+
+// tierScoringProfiles builds the scoring config of each API key tier mapped
+// to a scoring profile
+func tierScoringProfiles(cfg *config.Config) (map[string]scoring.Config, error) {
+	profiles := make(map[string]scoring.Config, len(cfg.API.TierScoringProfiles))
+	for tier, name := range cfg.API.TierScoringProfiles {
+		profile, err := cfg.Scoring.Profile(name)
+		if err != nil {
+			return nil, fmt.Errorf("scoring profile %s: %w", name, err)
+		}
+		scoringConfig, err := scoring.FromConfig(profile)
+		if err != nil {
+			return nil, fmt.Errorf("scoring profile %s: %w", name, err)
+		}
+		profiles[tier] = scoringConfig
+	}
+	return profiles, nil
 }
 
 func setupRoutes(app *fiber.App, cfg *config.Config) {
@@ -188,6 +529,12 @@ func setupRoutes(app *fiber.App, cfg *config.Config) {
 	// Prometheus metrics endpoint (no auth required)
 	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
+	// API description (no auth required)
+	if cfg.API.DocsEnabled {
+		app.Get("/openapi.json", handlers.OpenAPISpec())
+		app.Get("/docs", handlers.SwaggerUI("/openapi.json"))
+	}
+
 	// API v1 routes
 	v1 := app.Group("/api/v1")
 
@@ -198,14 +545,18 @@ func setupRoutes(app *fiber.App, cfg *config.Config) {
 
 	// IP check endpoints
 	v1.Get("/check/:ip", handlers.CheckIP())
+	v1.Post("/check", handlers.CheckIPWithOptions())
 
 	if cfg.API.BatchEnabled {
-		v1.Post("/check/batch", handlers.BatchCheckIP(cfg.API.BatchMaxSize))
+		v1.Post("/check/batch", handlers.BatchCheckIP(cfg.API.BatchMaxSize, cfg.API.BatchConcurrency))
 	}
 
 	// Stats endpoint
 	v1.Get("/stats", handlers.GetStats())
 
+	// Feed status endpoint
+	v1.Get("/feeds", handlers.GetFeeds())
+
 	// Cache endpoints
 	v1.Get("/cache/stats", handlers.GetCacheStats())
 	v1.Delete("/cache", handlers.ClearCache())
@@ -213,12 +564,42 @@ func setupRoutes(app *fiber.App, cfg *config.Config) {
 	// Hot reload endpoint (for admin use)
 	v1.Post("/reload", handlers.ReloadMMDB())
 
+	// Whitelist management (admin API key tiers only)
+	whitelist := v1.Group("/whitelist", middleware.RequireTier(cfg.API.AdminTiers...))
+	whitelist.Get("/", handlers.ListWhitelist())
+	whitelist.Post("/", handlers.AddWhitelist(cfg.API.WhitelistMinPrefixLengthV4, cfg.API.WhitelistMinPrefixLengthV6))
+	whitelist.Delete("/:id", handlers.RemoveWhitelist())
+
+	// Admin endpoints (admin API key tiers only)
+	admin := v1.Group("/admin", middleware.RequireTier(cfg.API.AdminTiers...))
+	admin.Post("/scoring/preview", handlers.PreviewScoring())
+
+	// Manual analyst reports (trusted API key tiers only)
+	v1.Post("/report", middleware.RequireTier(cfg.API.ReportTiers...), handlers.ReportIP())
+
+	// Live lookups straight from Postgres, bypassing the compiled MMDB
+	// (trusted API key tiers only)
+	v1.Get("/lookup/db/:ip", middleware.RequireTier(cfg.API.LiveLookupTiers...), handlers.LiveLookup())
+
+	// Blocklist export for firewalls/ipsets (trusted API key tiers only)
+	v1.Get("/export", middleware.RequireTier(cfg.API.ExportTiers...), handlers.ExportBlocklist())
+
+	// ClickHouse analytics dashboards (trusted API key tiers only)
+	analyticsTier := middleware.RequireTier(cfg.API.AnalyticsTiers...)
+	v1.Get("/dashboard", analyticsTier, handlers.GetDashboard())
+	v1.Get("/threats/top", analyticsTier, handlers.GetTopThreats())
+
+	// TAXII 2.1 server for threat-intel platforms (trusted API key tiers only)
+	taxii := app.Group("/taxii2", middleware.RequireTier(cfg.API.ExportTiers...))
+	taxii.Get("/", handlers.TAXIIDiscovery("/taxii2/api/"))
+	taxii.Get("/api/", handlers.TAXIIAPIRoot())
+	taxii.Get("/api/collections/", handlers.TAXIICollections())
+	taxii.Get("/api/collections/:id/", handlers.TAXIICollection())
+	taxii.Get("/api/collections/:id/objects/", handlers.TAXIIObjects())
+
 	// 404 handler
 	app.Use(func(c *fiber.Ctx) error {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "not_found",
-			"message": "The requested endpoint does not exist",
-		})
+		return middleware.WriteError(c, fiber.StatusNotFound, models.ErrCodeNotFound, "The requested endpoint does not exist")
 	})
 }
 
@@ -232,3 +613,19 @@ func joinStrings(s []string) string {
 	}
 	return result
 }
+
+// checkIndexes warns about missing indexes the lookups and upserts rely on;
+// -migrate creates them
+func checkIndexes(db *database.PostgresDB) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	missing, err := db.CheckIndexes(ctx)
+	if err != nil {
+		pkglogger.Warn(fmt.Sprintf("Failed to check database indexes: %v", err))
+		return
+	}
+	if len(missing) > 0 {
+		pkglogger.Warn(fmt.Sprintf("Database is missing indexes %s; run with -migrate to create them", strings.Join(missing, ", ")))
+	}
+}
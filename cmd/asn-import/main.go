@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/asn"
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	pkglogger "github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// fetchTimeout bounds downloading a remote classification file
+const fetchTimeout = 2 * time.Minute
+
+func main() {
+	// Parse command line flags
+	configPath := flag.String("config", "./configs/config.yaml", "Path to configuration file")
+	source := flag.String("file", "", "CSV file path or http(s) URL with asn,name,org,country,type,modifier columns")
+	dryRun := flag.Bool("dry-run", false, "Validate the file without writing to the database")
+	flag.Parse()
+
+	if *source == "" {
+		fmt.Println("Usage: asn-import -file <path|url> [-config path] [-dry-run]")
+		os.Exit(2)
+	}
+
+	// Load configuration
+	cfg, err := config.LoadFromEnv(*configPath)
+	if err != nil {
+		fmt.Printf("Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger (always stdout, this is an interactive tool)
+	if err := pkglogger.InitConfig(pkglogger.Config{
+		Level:  cfg.Logging.Level,
+		Format: cfg.Logging.Format,
+		Output: "stdout",
+	}); err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer pkglogger.Sync()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	infos, err := load(ctx, *source)
+	if err != nil {
+		pkglogger.Fatal(fmt.Sprintf("Failed to read %s: %v", *source, err))
+	}
+	pkglogger.Info(fmt.Sprintf("Parsed %d ASN classifications from %s", len(infos), *source))
+
+	if *dryRun {
+		return
+	}
+
+	db, err := database.NewPostgresDB(cfg.Database.Postgres.DSN(), cfg.Database.Postgres.MaxConnections, cfg.Database.Postgres.MinConnections)
+	if err != nil {
+		pkglogger.Fatal(fmt.Sprintf("Failed to connect to PostgreSQL: %v", err))
+	}
+	defer db.Close()
+
+	inserted, updated, err := db.UpsertASNInfo(ctx, infos)
+	if err != nil {
+		pkglogger.Fatal(fmt.Sprintf("Import failed: %v", err))
+	}
+	pkglogger.Info(fmt.Sprintf("ASN import complete: %d inserted, %d updated", inserted, updated))
+}
+
+// load parses the classification file from a local path or URL
+func load(ctx context.Context, source string) ([]models.ASNInfo, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return asn.ParseCSV(f)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return asn.ParseCSV(resp.Body)
+}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/lfrfrfr/beon-ipquality/internal/compiler"
 	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+	"github.com/lfrfrfr/beon-ipquality/internal/migrate"
 	pkglogger "github.com/lfrfrfr/beon-ipquality/pkg/logger"
 )
 
@@ -18,17 +20,28 @@ func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "./configs/config.yaml", "Path to configuration file")
 	oneshot := flag.Bool("oneshot", false, "Run compilation once and exit")
+	decayOnly := flag.Bool("decay", false, "Recompute time-decayed risk scores once and exit")
+	runMigrations := flag.Bool("migrate", false, "Apply pending database migrations and exit")
 	flag.Parse()
 
 	// Load configuration
-	cfg, err := config.Load(*configPath)
+	cfg, err := config.LoadFromEnv(*configPath)
 	if err != nil {
 		fmt.Printf("Failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Initialize logger
-	if err := pkglogger.Init(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.Output, cfg.Logging.FilePath); err != nil {
+	if err := pkglogger.InitConfig(pkglogger.Config{
+		Level:      cfg.Logging.Level,
+		Format:     cfg.Logging.Format,
+		Output:     cfg.Logging.Output,
+		FilePath:   cfg.Logging.FilePath,
+		MaxSizeMB:  cfg.Logging.MaxSizeMB,
+		MaxAgeDays: cfg.Logging.MaxAgeDays,
+		MaxBackups: cfg.Logging.MaxBackups,
+		Compress:   cfg.Logging.Compress,
+	}); err != nil {
 		fmt.Printf("Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
@@ -36,6 +49,13 @@ func main() {
 
 	pkglogger.Info("Starting BEON-IPQuality MMDB Compiler")
 
+	if *runMigrations {
+		if err := migrate.Run(context.Background(), cfg, migrate.Postgres); err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Migration failed: %v", err))
+		}
+		return
+	}
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -47,6 +67,13 @@ func main() {
 	}
 	defer comp.Close()
 
+	if *decayOnly {
+		if _, err := comp.RecomputeDecay(ctx); err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Decay recompute failed: %v", err))
+		}
+		return
+	}
+
 	if *oneshot {
 		// One-shot mode: compile once and exit
 		pkglogger.Info("Running in one-shot mode")
@@ -66,6 +93,15 @@ func main() {
 		pkglogger.Info(fmt.Sprintf("Compile interval: %v", compileInterval))
 	}
 
+	if cfg.Metrics.Enabled {
+		go func() {
+			if err := metrics.Serve(ctx, cfg.Metrics.Port, cfg.Metrics.Path); err != nil {
+				pkglogger.Error(fmt.Sprintf("Metrics server error: %v", err))
+			}
+		}()
+		pkglogger.Info(fmt.Sprintf("Metrics exposed on :%d%s", cfg.Metrics.Port, cfg.Metrics.Path))
+	}
+
 	// Start periodic compilation
 	go func() {
 		ticker := time.NewTicker(compileInterval)
@@ -88,6 +124,26 @@ func main() {
 		}
 	}()
 
+	// Start periodic decay recompute
+	if cfg.Scoring.RecomputeInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.Scoring.RecomputeInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if _, err := comp.RecomputeDecay(ctx); err != nil {
+						pkglogger.Error(fmt.Sprintf("Decay recompute failed: %v", err))
+					}
+				}
+			}
+		}()
+		pkglogger.Info(fmt.Sprintf("Decay recompute interval: %v", cfg.Scoring.RecomputeInterval))
+	}
+
 	pkglogger.Info(fmt.Sprintf("MMDB Compiler started (interval: %v)", cfg.MMDB.CompileInterval))
 
 	// Wait for shutdown signal
@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/lfrfrfr/beon-ipquality/internal/config"
 	"github.com/lfrfrfr/beon-ipquality/internal/database"
 	"github.com/lfrfrfr/beon-ipquality/internal/ingestor"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+	"github.com/lfrfrfr/beon-ipquality/internal/migrate"
 	pkglogger "github.com/lfrfrfr/beon-ipquality/pkg/logger"
 )
 
@@ -27,6 +30,7 @@ func main() {
 	feedsPath := flag.String("feeds", "./configs/feeds.yaml", "Path to feeds configuration file")
 	runOnce := flag.Bool("once", false, "Run once and exit (don't start daemon)")
 	verbose := flag.Bool("verbose", false, "Enable verbose output to stdout")
+	runMigrations := flag.Bool("migrate", false, "Apply pending database migrations and exit")
 	showVersion := flag.Bool("version", false, "Show version information")
 	flag.Parse()
 
@@ -43,7 +47,7 @@ func main() {
 
 	// Load configuration
 	printProgress("Loading configuration...")
-	cfg, err := config.Load(*configPath)
+	cfg, err := config.LoadFromEnv(*configPath)
 	if err != nil {
 		printError("Failed to load configuration: %v", err)
 		os.Exit(1)
@@ -67,7 +71,16 @@ func main() {
 		logOutput = "stdout"
 	}
 
-	if err := pkglogger.Init(cfg.Logging.Level, cfg.Logging.Format, logOutput, cfg.Logging.FilePath); err != nil {
+	if err := pkglogger.InitConfig(pkglogger.Config{
+		Level:      cfg.Logging.Level,
+		Format:     cfg.Logging.Format,
+		Output:     logOutput,
+		FilePath:   cfg.Logging.FilePath,
+		MaxSizeMB:  cfg.Logging.MaxSizeMB,
+		MaxAgeDays: cfg.Logging.MaxAgeDays,
+		MaxBackups: cfg.Logging.MaxBackups,
+		Compress:   cfg.Logging.Compress,
+	}); err != nil {
 		printError("Failed to initialize logger: %v", err)
 		os.Exit(1)
 	}
@@ -77,25 +90,54 @@ func main() {
 		pkglogger.Info("Starting BEON-IPQuality Ingestor Service")
 	}
 
+	if *runMigrations {
+		printProgress("Applying database migrations...")
+		if err := migrate.Run(context.Background(), cfg, migrate.Postgres); err != nil {
+			printError("Migration failed: %v", err)
+			os.Exit(1)
+		}
+		printSuccess("Database schema is up to date")
+		return
+	}
+
 	// Connect to database
 	printProgress("Connecting to PostgreSQL database...")
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		cfg.Database.Postgres.Username,
-		cfg.Database.Postgres.Password,
-		cfg.Database.Postgres.Host,
-		cfg.Database.Postgres.Port,
-		cfg.Database.Postgres.Database,
-		cfg.Database.Postgres.SSLMode,
-	)
-
-	db, err := database.NewPostgresDB(dsn, cfg.Database.Postgres.MaxConnections, cfg.Database.Postgres.MinConnections)
+	var db *database.PostgresDB
+	pg := cfg.Database.Postgres
+	err = database.ConnectWithRetry(context.Background(), pg.ConnectAttempts, pg.ConnectRetryDelay, func() error {
+		var err error
+		db, err = database.NewPostgresDB(pg.URL(), pg.MaxConnections, pg.MinConnections)
+		return err
+	})
 	if err != nil {
 		printError("Failed to connect to database: %v", err)
 		os.Exit(1)
 	}
 	defer db.Close()
+
+	upsert, err := database.ParseUpsertStrategy(cfg.Database.UpsertStrategy)
+	if err != nil {
+		printError("Invalid database configuration: %v", err)
+		os.Exit(1)
+	}
+	db.SetUpsertStrategy(upsert)
+
+	insert, err := database.ParseInsertStrategy(cfg.Database.InsertStrategy)
+	if err != nil {
+		printError("Invalid database configuration: %v", err)
+		os.Exit(1)
+	}
+	db.SetInsertStrategy(insert, cfg.Database.BulkInsertThreshold)
 	printSuccess("Connected to PostgreSQL")
 
+	indexCtx, indexCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if missing, err := db.CheckIndexes(indexCtx); err != nil {
+		printWarning("Failed to check database indexes: %v", err)
+	} else if len(missing) > 0 {
+		printWarning("Database is missing indexes %s; run with -migrate to create them", strings.Join(missing, ", "))
+	}
+	indexCancel()
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -152,6 +194,15 @@ func main() {
 		}
 	}()
 
+	if cfg.Metrics.Enabled {
+		go func() {
+			if err := metrics.Serve(ctx, cfg.Metrics.Port, cfg.Metrics.Path); err != nil {
+				pkglogger.Error(fmt.Sprintf("Metrics server error: %v", err))
+			}
+		}()
+		pkglogger.Info(fmt.Sprintf("Metrics exposed on :%d%s", cfg.Metrics.Port, cfg.Metrics.Path))
+	}
+
 	if *verbose {
 		printSuccess("Ingestor daemon started")
 		fmt.Println("Press Ctrl+C to stop...")
@@ -159,10 +210,21 @@ func main() {
 		pkglogger.Info("Ingestor service started")
 	}
 
-	// Wait for shutdown signal
+	// Wait for shutdown signal, reloading the feeds on SIGHUP
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+wait:
+	for {
+		select {
+		case <-hup:
+			feedsCfg = reload(ing, cfg, feedsCfg, *configPath, *feedsPath)
+		case <-quit:
+			break wait
+		}
+	}
 
 	if *verbose {
 		fmt.Println()
@@ -183,6 +245,38 @@ func main() {
 	}
 }
 
+// reload re-reads both configuration files. Feed changes are applied by
+// rescheduling the feeds; other config changes are only logged because they
+// take effect after a restart. On any error the running configuration is kept.
+func reload(ing *ingestor.Ingestor, cfg *config.Config, feedsCfg *config.FeedsConfig, configPath, feedsPath string) *config.FeedsConfig {
+	pkglogger.Info("Received SIGHUP, reloading configuration")
+
+	newCfg, err := config.LoadFromEnv(configPath)
+	if err != nil {
+		pkglogger.Error(fmt.Sprintf("Reload failed, keeping current configuration: %v", err))
+		return feedsCfg
+	}
+	newFeedsCfg, err := config.LoadFeeds(feedsPath)
+	if err != nil {
+		pkglogger.Error(fmt.Sprintf("Reload failed, keeping current configuration: %v", err))
+		return feedsCfg
+	}
+
+	if restart := config.Changes(cfg, newCfg); len(restart) > 0 {
+		pkglogger.Warn(fmt.Sprintf("Config changes require a restart: %s", strings.Join(restart, ", ")))
+	}
+
+	changed := config.FeedsChanges(feedsCfg, newFeedsCfg)
+	ing.Reload(newFeedsCfg)
+	if len(changed) == 0 {
+		pkglogger.Info("Feeds configuration unchanged")
+	} else {
+		pkglogger.Info(fmt.Sprintf("Applied feeds changes: %s", strings.Join(changed, ", ")))
+	}
+
+	return newFeedsCfg
+}
+
 // Console output helpers
 func printBanner() {
 	fmt.Println()
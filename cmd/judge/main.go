@@ -9,25 +9,45 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/cache"
 	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/index"
 	"github.com/lfrfrfr/beon-ipquality/internal/judge"
+	"github.com/lfrfrfr/beon-ipquality/internal/migrate"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
 	pkglogger "github.com/lfrfrfr/beon-ipquality/pkg/logger"
 )
 
 func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "./configs/config.yaml", "Path to configuration file")
+	runMigrations := flag.Bool("migrate", false, "Apply pending database migrations and exit")
 	flag.Parse()
 
 	// Load configuration
-	cfg, err := config.Load(*configPath)
+	cfg, err := config.LoadFromEnv(*configPath)
 	if err != nil {
 		fmt.Printf("Failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Initialize logger
-	if err := pkglogger.Init(cfg.Logging.Level, cfg.Logging.Format, cfg.Logging.Output, cfg.Logging.FilePath); err != nil {
+	if err := pkglogger.InitConfig(pkglogger.Config{
+		Level:      cfg.Logging.Level,
+		Format:     cfg.Logging.Format,
+		Output:     cfg.Logging.Output,
+		FilePath:   cfg.Logging.FilePath,
+		MaxSizeMB:  cfg.Logging.MaxSizeMB,
+		MaxAgeDays: cfg.Logging.MaxAgeDays,
+		MaxBackups: cfg.Logging.MaxBackups,
+		Compress:   cfg.Logging.Compress,
+	}); err != nil {
 		fmt.Printf("Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
@@ -35,16 +55,110 @@ func main() {
 
 	pkglogger.Info("Starting BEON-IPQuality Judge Node")
 
+	if *runMigrations {
+		if err := migrate.Run(context.Background(), cfg, migrate.ClickHouse); err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Migration failed: %v", err))
+		}
+		return
+	}
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Scan rate limits key on the client behind trusted proxies
+	if len(cfg.Server.TrustedProxies) > 0 {
+		resolver, err := middleware.NewClientIPResolver(cfg.Server.ProxyHeader, cfg.Server.TrustedProxies)
+		if err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Invalid trusted proxy config: %v", err))
+		}
+		middleware.SetClientIPResolver(resolver)
+	}
+
 	// Create judge node
 	node, err := judge.New(cfg)
 	if err != nil {
 		pkglogger.Fatal(fmt.Sprintf("Failed to create judge node: %v", err))
 	}
-	defer node.Close()
+
+	// Serve reputation from an in-memory index of the database instead of the
+	// compiled MMDB. Until it loads, checks answer 503 as without an MMDB
+	if cfg.Judge.UsesIndex() {
+		pg := cfg.Database.Postgres
+		db, err := database.NewPostgresDB(pg.DSN(), pg.MaxConnections, pg.MinConnections)
+		if err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Failed to connect to PostgreSQL for the reputation index: %v", err))
+		}
+		defer db.Close()
+		if replica := pg.ReadReplica; replica.Enabled() {
+			if err := db.AttachReadReplica(replica.DSN, replica.MaxConnections, replica.MinConnections); err != nil {
+				pkglogger.Warn(fmt.Sprintf("Failed to connect to PostgreSQL read replica: %v (using primary for the index)", err))
+			}
+		}
+
+		scoringConfig, err := scoring.FromConfig(cfg.Scoring)
+		if err != nil {
+			pkglogger.Fatal(fmt.Sprintf("Invalid scoring config: %v", err))
+		}
+		idx := index.New(db, scoringConfig)
+		start := time.Now()
+		if prefixes, err := idx.Reload(ctx); err != nil {
+			pkglogger.Warn(fmt.Sprintf("Failed to load reputation index: %v (checks return 503 until it is reloaded)", err))
+		} else {
+			pkglogger.Info(fmt.Sprintf("Reputation index loaded: %d prefixes in %v", prefixes, time.Since(start)))
+		}
+		node.SetReputationIndex(idx)
+	}
+
+	// Log batch scan results to ClickHouse when analytics is enabled
+	if cfg.ClickHouse.Enabled {
+		ch, err := analytics.NewClient(analytics.Config{
+			Host:     cfg.ClickHouse.Host,
+			Port:     cfg.ClickHouse.Port,
+			Database: cfg.ClickHouse.Database,
+			Username: cfg.ClickHouse.Username,
+			Password: cfg.ClickHouse.Password,
+
+			BreakerThreshold: cfg.ClickHouse.Breaker.FailureThreshold,
+			BreakerCooldown:  cfg.ClickHouse.Breaker.Cooldown,
+		})
+		if err != nil {
+			pkglogger.Warn(fmt.Sprintf("Failed to connect to ClickHouse: %v (scan logging disabled)", err))
+		} else {
+			node.SetScanLogger(ch)
+			defer ch.Close()
+		}
+	}
+
+	// Prefork workers each count their own requests; share the counts through
+	// Redis so /stats reports the whole node
+	if cfg.Judge.Prefork {
+		if cfg.Redis.Enabled {
+			client, err := newRedisClient(cfg)
+			if err != nil {
+				pkglogger.Warn(fmt.Sprintf("Failed to connect to Redis: %v (stats will be per worker)", err))
+			} else {
+				counters := judge.NewRedisCounterStore(client)
+				node.SetCounterStore(counters)
+				defer counters.Close()
+			}
+		} else if !fiber.IsChild() {
+			pkglogger.Warn("Prefork is enabled without Redis: /stats counts only the worker that serves it")
+		}
+	}
+
+	// Share cached scan results across workers and nodes; without Redis each
+	// process keeps its own
+	if cfg.Redis.Enabled && cfg.Judge.ScanCacheTTL > 0 {
+		client, err := newRedisClient(cfg)
+		if err != nil {
+			pkglogger.Warn(fmt.Sprintf("Failed to connect to Redis: %v (scan cache is per process)", err))
+		} else {
+			scanCache := judge.NewRedisScanCache(client)
+			node.SetScanCache(scanCache)
+			defer scanCache.Close()
+		}
+	}
 
 	// Start judge node
 	go func() {
@@ -63,8 +177,27 @@ func main() {
 	pkglogger.Info("Shutting down judge node...")
 	cancel()
 
-	// Give time for graceful shutdown
-	time.Sleep(2 * time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Judge.ShutdownTimeout)
+	defer shutdownCancel()
+
+	if err := node.Shutdown(shutdownCtx); err != nil {
+		pkglogger.Error(fmt.Sprintf("Judge node forced to shutdown: %v", err))
+	}
 
 	pkglogger.Info("Judge node stopped gracefully")
 }
+
+// newRedisClient connects to the configured Redis in any redis.mode
+func newRedisClient(cfg *config.Config) (redis.UniversalClient, error) {
+	return cache.NewClient(cache.Config{
+		Mode:             cfg.Redis.Mode,
+		Host:             cfg.Redis.Host,
+		Port:             cfg.Redis.Port,
+		Addrs:            cfg.Redis.Addrs,
+		MasterName:       cfg.Redis.MasterName,
+		SentinelPassword: cfg.Redis.SentinelPassword,
+		Password:         cfg.Redis.Password,
+		DB:               cfg.Redis.DB,
+		PoolSize:         cfg.Redis.PoolSize,
+	})
+}
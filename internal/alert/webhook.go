@@ -0,0 +1,202 @@
+// Package alert posts lookups of high-risk IPs to an operator webhook
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// EventHighRisk is the event of a lookup scoring at or above the threshold
+const EventHighRisk = "high_risk_lookup"
+
+// defaultTimeout applies when Config.Timeout is unset
+const defaultTimeout = 5 * time.Second
+
+// queueSize bounds the alerts waiting for delivery; further ones are dropped
+const queueSize = 100
+
+// Results used as the result label of AlertWebhookEvents
+const (
+	resultSent        = "sent"
+	resultFailed      = "failed"
+	resultDropped     = "dropped"
+	resultRateLimited = "rate_limited"
+)
+
+// Config holds webhook settings
+type Config struct {
+	URL       string
+	MinScore  int               // Lookups scoring at least this are posted
+	RateLimit int               // Alerts per minute (0 = unlimited)
+	Timeout   time.Duration     // Per delivery
+	Headers   map[string]string // Extra request headers, e.g. an auth token
+}
+
+// Payload is the JSON body of an alert: the request log entry recorded by
+// analytics plus the full check result
+type Payload struct {
+	Event string `json:"event"`
+	analytics.APIRequestLog
+	Result *models.IPCheckResult `json:"result"`
+}
+
+// Webhook delivers alerts from a background worker so lookups never wait
+// on, or fail because of, the receiver
+type Webhook struct {
+	cfg    Config
+	client *http.Client
+	queue  chan Payload
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewWebhook starts the delivery worker of a webhook
+func NewWebhook(cfg Config) *Webhook {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Webhook{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan Payload, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		tokens: float64(cfg.RateLimit),
+		now:    time.Now,
+	}
+	w.last = w.now()
+	go w.run()
+	return w
+}
+
+// Notify queues an alert when result scores at least MinScore. It never
+// blocks: alerts over the rate limit or beyond a full queue are dropped. It
+// reports whether the alert was queued.
+func (w *Webhook) Notify(log analytics.APIRequestLog, result *models.IPCheckResult) bool {
+	if w == nil || result == nil || result.Score < w.cfg.MinScore {
+		return false
+	}
+	if !w.allow() {
+		metrics.AlertWebhookEvents.WithLabelValues(resultRateLimited).Inc()
+		return false
+	}
+
+	log.APIKey = redactKey(log.APIKey)
+	select {
+	case w.queue <- Payload{Event: EventHighRisk, APIRequestLog: log, Result: result}:
+		return true
+	default:
+		metrics.AlertWebhookEvents.WithLabelValues(resultDropped).Inc()
+		return false
+	}
+}
+
+// allow takes a token from the per-minute bucket
+func (w *Webhook) allow() bool {
+	if w.cfg.RateLimit <= 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	limit := float64(w.cfg.RateLimit)
+	w.tokens = min(limit, w.tokens+now.Sub(w.last).Minutes()*limit)
+	w.last = now
+	if w.tokens < 1 {
+		return false
+	}
+	w.tokens--
+	return true
+}
+
+// run delivers queued alerts until Close
+func (w *Webhook) run() {
+	defer close(w.done)
+	for {
+		select {
+		case p := <-w.queue:
+			if err := w.send(p); err != nil {
+				if w.ctx.Err() != nil {
+					return
+				}
+				metrics.AlertWebhookEvents.WithLabelValues(resultFailed).Inc()
+				logger.Warn(fmt.Sprintf("Alert webhook for %s failed: %v", p.IPChecked, err))
+				continue
+			}
+			metrics.AlertWebhookEvents.WithLabelValues(resultSent).Inc()
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// send posts one alert
+func (w *Webhook) send(p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(w.ctx, w.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BEON-IPQuality-Alert/1.0")
+	for name, value := range w.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close stops the worker, abandoning a delivery in progress; alerts still
+// queued are dropped
+func (w *Webhook) Close() {
+	if w == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
+
+// redactKey keeps enough of an API key to tell callers apart without
+// sending the key itself
+func redactKey(key string) string {
+	if len(key) <= 8 {
+		return ""
+	}
+	return key[:8] + "..."
+}
@@ -0,0 +1,103 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestWebhookPostsHighRiskLookups(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	bodies := make(chan Payload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		received <- r
+		bodies <- p
+	}))
+	defer srv.Close()
+
+	w := NewWebhook(Config{URL: srv.URL, MinScore: 85, Headers: map[string]string{"Authorization": "Bearer token"}})
+	defer w.Close()
+
+	log := analytics.APIRequestLog{IPChecked: "45.155.205.1", ClientIP: "203.0.113.7", APIKey: "beon_live_0123456789", Endpoint: "/api/v1/check/45.155.205.1"}
+	if w.Notify(log, &models.IPCheckResult{IP: "45.155.205.1", Score: 60}) {
+		t.Error("Notify queued a lookup below min_score")
+	}
+	if !w.Notify(log, &models.IPCheckResult{IP: "45.155.205.1", Score: 92, RiskLevel: "critical", IsBotnet: true}) {
+		t.Fatal("Notify did not queue a critical lookup")
+	}
+
+	select {
+	case p := <-bodies:
+		r := <-received
+		if p.Event != EventHighRisk || p.IPChecked != "45.155.205.1" || p.ClientIP != "203.0.113.7" {
+			t.Errorf("payload = %+v, want the high-risk event for 45.155.205.1 from 203.0.113.7", p)
+		}
+		if p.Result == nil || p.Result.Score != 92 || !p.Result.IsBotnet {
+			t.Errorf("payload result = %+v, want score 92 with the botnet flag", p.Result)
+		}
+		if p.APIKey != "beon_liv..." {
+			t.Errorf("api_key = %q, want it redacted", p.APIKey)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want the configured header", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("receiver got no alert")
+	}
+}
+
+func TestWebhookNeverBlocks(t *testing.T) {
+	// A receiver that never answers must not hold up lookups
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer srv.Close()
+	defer close(hang)
+
+	w := NewWebhook(Config{URL: srv.URL, MinScore: 85, Timeout: time.Minute})
+	defer w.Close()
+
+	start := time.Now()
+	queued := 0
+	for i := 0; i < queueSize*2; i++ {
+		if w.Notify(analytics.APIRequestLog{}, &models.IPCheckResult{Score: 90}) {
+			queued++
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Notify took %v against a hanging receiver", elapsed)
+	}
+	if queued > queueSize+1 {
+		t.Errorf("queued %d alerts, want at most %d with the rest dropped", queued, queueSize+1)
+	}
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	now := time.Now()
+	w := &Webhook{cfg: Config{RateLimit: 2}, tokens: 2, last: now, now: func() time.Time { return now }}
+
+	if !w.allow() || !w.allow() {
+		t.Fatal("first two alerts of the minute were rate limited")
+	}
+	if w.allow() {
+		t.Error("third alert of the minute was allowed")
+	}
+
+	now = now.Add(30 * time.Second)
+	if !w.allow() {
+		t.Error("alert after the bucket refilled by one was rate limited")
+	}
+	if w.allow() {
+		t.Error("bucket refilled faster than rate_limit per minute")
+	}
+}
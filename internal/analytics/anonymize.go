@@ -0,0 +1,52 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+)
+
+// ClientIPMode selects how the caller's IP is stored in the request log. The
+// checked IP is the subject of the query and is always stored as is.
+type ClientIPMode string
+
+const (
+	ClientIPRaw      ClientIPMode = "raw"      // Store the address unchanged
+	ClientIPTruncate ClientIPMode = "truncate" // Zero the host part: IPv4 to /24, IPv6 to /48
+	ClientIPHash     ClientIPMode = "hash"     // Keyed hash; stable per address, not reversible without the key
+)
+
+// Prefix lengths kept by ClientIPTruncate
+const (
+	truncateBitsV4 = 24
+	truncateBitsV6 = 48
+)
+
+// anonymizeClientIP applies mode to ip. Values that are not IP addresses are
+// dropped unless mode is raw, since they cannot be truncated safely.
+func anonymizeClientIP(ip string, mode ClientIPMode, hashKey []byte) string {
+	switch mode {
+	case ClientIPTruncate:
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return ""
+		}
+		addr = addr.Unmap()
+		bits := truncateBitsV4
+		if addr.Is6() {
+			bits = truncateBitsV6
+		}
+		prefix, _ := addr.WithZone("").Prefix(bits)
+		return prefix.Addr().String()
+	case ClientIPHash:
+		if ip == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, hashKey)
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	default:
+		return ip
+	}
+}
@@ -0,0 +1,40 @@
+package analytics
+
+import "testing"
+
+func TestAnonymizeClientIP(t *testing.T) {
+	key := []byte("secret")
+
+	tests := []struct {
+		name string
+		ip   string
+		mode ClientIPMode
+		want string
+	}{
+		{"raw keeps the address", "203.0.113.77", ClientIPRaw, "203.0.113.77"},
+		{"empty mode is raw", "203.0.113.77", "", "203.0.113.77"},
+		{"truncate IPv4 to /24", "203.0.113.77", ClientIPTruncate, "203.0.113.0"},
+		{"truncate mapped IPv4", "::ffff:203.0.113.77", ClientIPTruncate, "203.0.113.0"},
+		{"truncate IPv6 to /48", "2001:db8:abcd:12:1:2:3:4", ClientIPTruncate, "2001:db8:abcd::"},
+		{"truncate drops non-IPs", "unknown", ClientIPTruncate, ""},
+		{"hash of empty is empty", "", ClientIPHash, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := anonymizeClientIP(tt.ip, tt.mode, key); got != tt.want {
+				t.Errorf("anonymizeClientIP(%q, %q) = %q, want %q", tt.ip, tt.mode, got, tt.want)
+			}
+		})
+	}
+
+	a := anonymizeClientIP("203.0.113.77", ClientIPHash, key)
+	if len(a) != 32 || a == "203.0.113.77" {
+		t.Errorf("hash = %q, want 32 hex characters", a)
+	}
+	if b := anonymizeClientIP("203.0.113.77", ClientIPHash, key); b != a {
+		t.Errorf("hash is not stable: %q != %q", a, b)
+	}
+	if c := anonymizeClientIP("203.0.113.77", ClientIPHash, []byte("other")); c == a {
+		t.Error("hash does not depend on the key")
+	}
+}
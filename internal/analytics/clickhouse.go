@@ -8,6 +8,7 @@ import (
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 
+	"github.com/lfrfrfr/beon-ipquality/internal/breaker"
 	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
 	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
@@ -18,6 +19,12 @@ type Client struct {
 	database string
 	batch    []APIRequestLog
 	batchMu  chan struct{}
+
+	clientIPMode    ClientIPMode
+	clientIPHashKey []byte
+
+	// breaker skips log writes while ClickHouse is failing; nil when disabled
+	breaker *breaker.Breaker
 }
 
 // Config holds ClickHouse configuration
@@ -27,32 +34,44 @@ type Config struct {
 	Database string
 	Username string
 	Password string
+
+	// ClientIPMode and ClientIPHashKey control how request logs store the
+	// caller's IP; empty mode keeps it raw
+	ClientIPMode    ClientIPMode
+	ClientIPHashKey string
+
+	// After BreakerThreshold consecutive failed log writes, writes are
+	// skipped for BreakerCooldown before one probes ClickHouse again
+	// (0 disables the breaker). Queries are not affected.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 // APIRequestLog represents a single API request log entry
 type APIRequestLog struct {
-	Timestamp    time.Time
-	IPChecked    string
-	ClientIP     string
-	APIKey       string
-	Endpoint     string
-	Method       string
-	RiskScore    uint8
-	RiskLevel    string
-	IsProxy      bool
-	IsVPN        bool
-	IsTor        bool
-	IsDatacenter bool
-	IsBotnet     bool
-	CountryCode  string
-	Country      string
-	City         string
-	ASN          uint32
-	ASNOrg       string
-	QueryTimeMs  float32
-	Cached       bool
-	UserAgent    string
-	ResponseCode uint16
+	Timestamp    time.Time `json:"timestamp"`
+	RequestID    string    `json:"request_id"`
+	IPChecked    string    `json:"ip_checked"`
+	ClientIP     string    `json:"client_ip"`
+	APIKey       string    `json:"api_key,omitempty"`
+	Endpoint     string    `json:"endpoint"`
+	Method       string    `json:"method"`
+	RiskScore    uint8     `json:"risk_score"`
+	RiskLevel    string    `json:"risk_level"`
+	IsProxy      bool      `json:"is_proxy"`
+	IsVPN        bool      `json:"is_vpn"`
+	IsTor        bool      `json:"is_tor"`
+	IsDatacenter bool      `json:"is_datacenter"`
+	IsBotnet     bool      `json:"is_botnet"`
+	CountryCode  string    `json:"country_code,omitempty"`
+	Country      string    `json:"country,omitempty"`
+	City         string    `json:"city,omitempty"`
+	ASN          uint32    `json:"asn,omitempty"`
+	ASNOrg       string    `json:"asn_org,omitempty"`
+	QueryTimeMs  float32   `json:"query_time_ms"`
+	Cached       bool      `json:"cached"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	ResponseCode uint16    `json:"response_code"`
 }
 
 // ScanResultLog represents a scan result log entry
@@ -100,35 +119,57 @@ func NewClient(cfg Config) (*Client, error) {
 
 	logger.Info(fmt.Sprintf("Connected to ClickHouse at %s:%d", cfg.Host, cfg.Port))
 
-	return &Client{
+	c := &Client{
 		conn:     conn,
 		database: cfg.Database,
 		batch:    make([]APIRequestLog, 0, 1000),
 		batchMu:  make(chan struct{}, 1),
-	}, nil
+
+		clientIPMode:    cfg.ClientIPMode,
+		clientIPHashKey: []byte(cfg.ClientIPHashKey),
+	}
+	if cfg.BreakerThreshold > 0 {
+		c.breaker = breaker.New("clickhouse", cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	return c, nil
+}
+
+// guard runs a log write through the breaker, if there is one. While it is
+// open the write is skipped and breaker.ErrOpen returned.
+func (c *Client) guard(fn func() error) error {
+	if c.breaker == nil {
+		return fn()
+	}
+	return c.breaker.Do(fn)
 }
 
 // LogRequest logs an API request
 func (c *Client) LogRequest(ctx context.Context, log APIRequestLog) error {
+	log.ClientIP = anonymizeClientIP(log.ClientIP, c.clientIPMode, c.clientIPHashKey)
+
 	query := `
 		INSERT INTO api_requests (
-			timestamp, ip_checked, client_ip, api_key, endpoint, method,
+			timestamp, request_id, ip_checked, client_ip, api_key, endpoint, method,
 			risk_score, risk_level, is_proxy, is_vpn, is_tor, is_datacenter, is_botnet,
 			country_code, country, city, asn, asn_org,
 			query_time_ms, cached, user_agent, response_code
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	return c.conn.Exec(ctx, query,
-		log.Timestamp, log.IPChecked, log.ClientIP, log.APIKey, log.Endpoint, log.Method,
-		log.RiskScore, log.RiskLevel, log.IsProxy, log.IsVPN, log.IsTor, log.IsDatacenter, log.IsBotnet,
-		log.CountryCode, log.Country, log.City, log.ASN, log.ASNOrg,
-		log.QueryTimeMs, log.Cached, log.UserAgent, log.ResponseCode,
-	)
+	return c.guard(func() error {
+		return c.conn.Exec(ctx, query,
+			log.Timestamp, log.RequestID, log.IPChecked, log.ClientIP, log.APIKey, log.Endpoint, log.Method,
+			log.RiskScore, log.RiskLevel, log.IsProxy, log.IsVPN, log.IsTor, log.IsDatacenter, log.IsBotnet,
+			log.CountryCode, log.Country, log.City, log.ASN, log.ASNOrg,
+			log.QueryTimeMs, log.Cached, log.UserAgent, log.ResponseCode,
+		)
+	})
 }
 
 // LogRequestAsync logs an API request asynchronously (batched)
 func (c *Client) LogRequestAsync(log APIRequestLog) {
+	log.ClientIP = anonymizeClientIP(log.ClientIP, c.clientIPMode, c.clientIPHashKey)
+
 	select {
 	case c.batchMu <- struct{}{}:
 		c.batch = append(c.batch, log)
@@ -150,25 +191,35 @@ func (c *Client) flushBatch() {
 		return
 	}
 
+	// The batch is dropped whether or not it is sent, so a ClickHouse
+	// outage cannot grow it without bound
+	defer func() { c.batch = c.batch[:0] }()
+
+	if err := c.guard(c.sendBatch); err != nil {
+		logger.Error(fmt.Sprintf("Failed to send batch of %d request logs: %v", len(c.batch), err))
+	}
+}
+
+// sendBatch writes the batched logs; batchMu must be held
+func (c *Client) sendBatch() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	batch, err := c.conn.PrepareBatch(ctx, `
 		INSERT INTO api_requests (
-			timestamp, ip_checked, client_ip, api_key, endpoint, method,
+			timestamp, request_id, ip_checked, client_ip, api_key, endpoint, method,
 			risk_score, risk_level, is_proxy, is_vpn, is_tor, is_datacenter, is_botnet,
 			country_code, country, city, asn, asn_org,
 			query_time_ms, cached, user_agent, response_code
 		)
 	`)
 	if err != nil {
-		logger.Error(fmt.Sprintf("Failed to prepare batch: %v", err))
-		return
+		return fmt.Errorf("prepare batch: %w", err)
 	}
 
 	for _, log := range c.batch {
 		err := batch.Append(
-			log.Timestamp, log.IPChecked, log.ClientIP, log.APIKey, log.Endpoint, log.Method,
+			log.Timestamp, log.RequestID, log.IPChecked, log.ClientIP, log.APIKey, log.Endpoint, log.Method,
 			log.RiskScore, log.RiskLevel, log.IsProxy, log.IsVPN, log.IsTor, log.IsDatacenter, log.IsBotnet,
 			log.CountryCode, log.Country, log.City, log.ASN, log.ASNOrg,
 			log.QueryTimeMs, log.Cached, log.UserAgent, log.ResponseCode,
@@ -178,11 +229,7 @@ func (c *Client) flushBatch() {
 		}
 	}
 
-	if err := batch.Send(); err != nil {
-		logger.Error(fmt.Sprintf("Failed to send batch: %v", err))
-	}
-
-	c.batch = c.batch[:0]
+	return batch.Send()
 }
 
 // LogScanResult logs a scan result
@@ -194,10 +241,12 @@ func (c *Client) LogScanResult(ctx context.Context, log ScanResultLog) error {
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	return c.conn.Exec(ctx, query,
-		log.Timestamp, log.IP, log.IsProxy, log.IsSOCKS4, log.IsSOCKS5,
-		log.IsHTTPProxy, log.IsHTTPConnect, log.OpenPorts, log.ProxyPorts, log.ScanTimeMs,
-	)
+	return c.guard(func() error {
+		return c.conn.Exec(ctx, query,
+			log.Timestamp, log.IP, log.IsProxy, log.IsSOCKS4, log.IsSOCKS5,
+			log.IsHTTPProxy, log.IsHTTPConnect, log.OpenPorts, log.ProxyPorts, log.ScanTimeMs,
+		)
+	})
 }
 
 // GetHourlyStats retrieves hourly statistics
@@ -242,8 +291,35 @@ type HourlyStats struct {
 	CacheHitRate  float32   `json:"cache_hit_rate"`
 }
 
-// GetTopThreats retrieves top threats
-func (c *Client) GetTopThreats(ctx context.Context, limit int) ([]TopThreat, error) {
+// RequestStats summarizes API requests since the given time. Responses with a
+// status of 400 or above count as errors.
+func (c *Client) RequestStats(ctx context.Context, since time.Time) (*models.APIStats, error) {
+	row := c.conn.QueryRow(ctx, `
+		SELECT
+			count(),
+			uniq(ip_checked),
+			ifNotFinite(avg(query_time_ms), 0),
+			if(count() = 0, 0, countIf(response_code >= 400) / count())
+		FROM api_requests
+		WHERE timestamp >= ?
+	`, since)
+
+	var total, unique uint64
+	var avg, errorRate float64
+	if err := row.Scan(&total, &unique, &avg, &errorRate); err != nil {
+		return nil, fmt.Errorf("request stats query failed: %w", err)
+	}
+
+	return &models.APIStats{
+		TotalRequests:   int64(total),
+		TotalIPs:        int64(unique),
+		AvgResponseTime: avg,
+		ErrorRate:       errorRate,
+	}, nil
+}
+
+// GetTopThreats retrieves the most frequently checked risky IPs of the last hours
+func (c *Client) GetTopThreats(ctx context.Context, limit, hours int) ([]TopThreat, error) {
 	query := `
 		SELECT 
 			ip_checked,
@@ -254,20 +330,20 @@ func (c *Client) GetTopThreats(ctx context.Context, limit int) ([]TopThreat, err
 			any(asn_org) AS asn_org,
 			count() AS hit_count
 		FROM api_requests
-		WHERE timestamp >= now() - INTERVAL 24 HOUR
+		WHERE timestamp >= now() - INTERVAL ? HOUR
 		  AND risk_score > 50
 		GROUP BY ip_checked
 		ORDER BY hit_count DESC
 		LIMIT ?
 	`
 
-	rows, err := c.conn.Query(ctx, query, limit)
+	rows, err := c.conn.Query(ctx, query, hours, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var threats []TopThreat
+	threats := make([]TopThreat, 0, limit)
 	for rows.Next() {
 		var t TopThreat
 		if err := rows.Scan(&t.IP, &t.RiskScore, &t.RiskLevel, &t.Country, &t.ASN, &t.ASNOrg, &t.HitCount); err != nil {
@@ -337,10 +413,12 @@ type DashboardData struct {
 	ThreatDistribution map[string]uint64 `json:"threat_distribution"`
 }
 
-// FromIPCheckResult converts IPCheckResult to APIRequestLog
-func FromIPCheckResult(result *models.IPCheckResult, clientIP, apiKey, endpoint, method, userAgent string, responseCode uint16) APIRequestLog {
+// FromIPCheckResult converts IPCheckResult to APIRequestLog. The client IP is
+// anonymized when the log is written, per the client's ClientIPMode.
+func FromIPCheckResult(result *models.IPCheckResult, requestID, clientIP, apiKey, endpoint, method, userAgent string, responseCode uint16) APIRequestLog {
 	log := APIRequestLog{
 		Timestamp:    time.Now(),
+		RequestID:    requestID,
 		IPChecked:    result.IP,
 		ClientIP:     clientIP,
 		APIKey:       apiKey,
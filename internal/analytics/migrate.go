@@ -0,0 +1,160 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/lfrfrfr/beon-ipquality/migrations"
+)
+
+// schemaDatabase is the database name written in the migration files; it is
+// replaced by the configured database when they are applied
+const schemaDatabase = "ipquality"
+
+var (
+	schemaDatabaseRe = regexp.MustCompile(`\b` + schemaDatabase + `\b`)
+	identifierRe     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Retention holds how many days the TTL of each log table keeps rows;
+// 0 keeps them forever
+type Retention struct {
+	RequestDays int
+	ScanDays    int
+}
+
+// Migrate creates the configured database, applies the migrations not yet
+// recorded in its schema_migrations table and then brings the TTL of the log
+// tables in line with retention. It returns the versions applied.
+func Migrate(ctx context.Context, cfg Config, ms []migrations.Migration, retention Retention) ([]string, error) {
+	database := cfg.Database
+	if database == "" {
+		database = schemaDatabase
+	}
+	if !identifierRe.MatchString(database) {
+		return nil, fmt.Errorf("invalid ClickHouse database name %q", database)
+	}
+
+	// The database may not exist yet, so connect to the default one
+	conn, err := clickhouse.Open(&clickhouse.Options{
+		Addr: []string{fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)},
+		Auth: clickhouse.Auth{
+			Username: cfg.Username,
+			Password: cfg.Password,
+		},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ClickHouse: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Exec(ctx, "CREATE DATABASE IF NOT EXISTS "+database); err != nil {
+		return nil, fmt.Errorf("failed to create database %s: %w", database, err)
+	}
+	err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS `+database+`.schema_migrations (
+			version String,
+			applied_at DateTime DEFAULT now()
+		) ENGINE = MergeTree()
+		ORDER BY version
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	done := make(map[string]bool)
+	rows, err := conn.Query(ctx, "SELECT version FROM "+database+".schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		done[version] = true
+	}
+	rows.Close()
+
+	// ClickHouse has no transactions and runs one statement per query, so a
+	// failed migration is retried from its first statement; the schema files
+	// only create what does not exist yet
+	var applied []string
+	for _, m := range ms {
+		if done[m.Version] {
+			continue
+		}
+		sql := schemaDatabaseRe.ReplaceAllString(m.SQL, database)
+		for _, stmt := range splitStatements(sql) {
+			if err := conn.Exec(ctx, stmt); err != nil {
+				return applied, fmt.Errorf("migration %s failed: %w", m.Version, err)
+			}
+		}
+		if err := conn.Exec(ctx, "INSERT INTO "+database+".schema_migrations (version) VALUES (?)", m.Version); err != nil {
+			return applied, fmt.Errorf("failed to record migration %s: %w", m.Version, err)
+		}
+		applied = append(applied, m.Version)
+	}
+
+	for table, days := range map[string]int{"api_requests": retention.RequestDays, "scan_results": retention.ScanDays} {
+		if err := applyTTL(ctx, conn, database, table, days); err != nil {
+			return applied, err
+		}
+	}
+
+	return applied, nil
+}
+
+// applyTTL sets the TTL of a log table to days, or removes it for 0, when
+// the table's current TTL differs. Rows expire during background merges;
+// the tables are partitioned by month, so old partitions empty out gradually.
+func applyTTL(ctx context.Context, conn driver.Conn, database, table string, days int) error {
+	var engine string
+	err := conn.QueryRow(ctx, "SELECT engine_full FROM system.tables WHERE database = ? AND name = ?", database, table).Scan(&engine)
+	if err != nil {
+		return fmt.Errorf("failed to read TTL of %s: %w", table, err)
+	}
+
+	var stmt string
+	switch want := fmt.Sprintf("TTL timestamp + toIntervalDay(%d)", days); {
+	case days > 0 && !strings.Contains(engine, want):
+		stmt = fmt.Sprintf("ALTER TABLE %s.%s MODIFY TTL timestamp + INTERVAL %d DAY", database, table, days)
+	case days == 0 && strings.Contains(engine, " TTL "):
+		stmt = fmt.Sprintf("ALTER TABLE %s.%s REMOVE TTL", database, table)
+	default:
+		return nil
+	}
+
+	if err := conn.Exec(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to set TTL of %s: %w", table, err)
+	}
+	return nil
+}
+
+// splitStatements splits a migration file into its statements, dropping
+// comment lines. The schema files keep semicolons out of literals.
+func splitStatements(sql string) []string {
+	var lines []string
+	for _, line := range strings.Split(sql, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,48 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lfrfrfr/beon-ipquality/migrations"
+)
+
+func TestSplitStatements(t *testing.T) {
+	got := splitStatements(`-- header; with a semicolon
+CREATE DATABASE IF NOT EXISTS ipquality;
+
+-- table
+CREATE TABLE IF NOT EXISTS ipquality.t (
+    a String DEFAULT ''
+) ENGINE = MergeTree()
+ORDER BY a;
+`)
+	if len(got) != 2 {
+		t.Fatalf("splitStatements() = %q, want 2 statements", got)
+	}
+	if got[0] != "CREATE DATABASE IF NOT EXISTS ipquality" {
+		t.Errorf("statement 0 = %q", got[0])
+	}
+	if !strings.HasPrefix(got[1], "CREATE TABLE") || !strings.HasSuffix(got[1], "ORDER BY a") {
+		t.Errorf("statement 1 = %q", got[1])
+	}
+}
+
+func TestClickHouseMigrationsUseSchemaDatabase(t *testing.T) {
+	ms, err := migrations.ClickHouse()
+	if err != nil {
+		t.Fatalf("ClickHouse() error = %v", err)
+	}
+	if len(ms) == 0 || ms[0].Version != "001_analytics_schema" {
+		t.Fatalf("ClickHouse() = %d migrations, want 001_analytics_schema first", len(ms))
+	}
+
+	// Every table reference must be qualified so the configured database
+	// can be substituted
+	sql := schemaDatabaseRe.ReplaceAllString(ms[0].SQL, "beon_analytics")
+	for _, stmt := range splitStatements(sql) {
+		if strings.Contains(stmt, "TABLE") && !strings.Contains(stmt, "beon_analytics.") {
+			t.Errorf("statement does not name the database:\n%s", stmt)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/alert"
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+var (
+	alertWebhook *alert.Webhook
+	alertMu      sync.RWMutex
+)
+
+// SetAlertWebhook sets the webhook notified of high-risk lookups
+func SetAlertWebhook(w *alert.Webhook) {
+	alertMu.Lock()
+	defer alertMu.Unlock()
+	alertWebhook = w
+}
+
+// getAlertWebhook returns the alert webhook, nil when none is configured
+func getAlertWebhook() *alert.Webhook {
+	alertMu.RLock()
+	defer alertMu.RUnlock()
+	return alertWebhook
+}
+
+// notifyHighRisk hands a check result to the alert webhook with the context
+// of the request. The webhook filters by score and delivers in the
+// background, so this never delays or fails the response. Request strings
+// are copied since Fiber reuses their buffers once the handler returns.
+func notifyHighRisk(c *fiber.Ctx, result *models.IPCheckResult) {
+	w := getAlertWebhook()
+	if w == nil {
+		return
+	}
+
+	apiKey, _ := c.Locals("api_key").(string)
+	entry := *result
+	w.Notify(analytics.FromIPCheckResult(&entry, strings.Clone(middleware.GetRequestID(c)), middleware.ClientIP(c), strings.Clone(apiKey),
+		strings.Clone(c.Path()), strings.Clone(c.Method()), strings.Clone(c.Get(fiber.HeaderUserAgent)), fiber.StatusOK), &entry)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/alert"
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestCheckIPAlertWebhook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	err := mmdb.NewDefaultWriter().CompileToMMDB([]mmdb.ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("45.155.205.0/24"),
+		RiskScore:  95,
+		ThreatType: "botnet_c2",
+		Sources:    []string{"abuse_feodo"},
+		LastUpdate: time.Now(),
+	}}, path)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+	reader, err := mmdb.NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	SetLookupProvider(reader)
+	t.Cleanup(func() {
+		SetLookupProvider(nil)
+		reader.Close()
+	})
+
+	// The receiver fails every delivery; lookups must not notice
+	alerts := make(chan alert.Payload, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p alert.Payload
+		json.NewDecoder(r.Body).Decode(&p)
+		alerts <- p
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	webhook := alert.NewWebhook(alert.Config{URL: receiver.URL, MinScore: 85})
+	SetAlertWebhook(webhook)
+	t.Cleanup(func() {
+		SetAlertWebhook(nil)
+		webhook.Close()
+	})
+
+	app := fiber.New()
+	app.Get("/check/:ip", CheckIP())
+	get := func(ip string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/check/"+ip, nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("GET /check/%s status = %d, want 200", ip, resp.StatusCode)
+		}
+	}
+
+	get("8.8.8.8")
+	get("45.155.205.1")
+
+	select {
+	case p := <-alerts:
+		if p.IPChecked != "45.155.205.1" || p.Endpoint != "/check/45.155.205.1" || p.Method != "GET" {
+			t.Errorf("alert = %+v, want the lookup of 45.155.205.1", p.APIRequestLog)
+		}
+		if p.Result == nil || p.Result.Score != 95 {
+			t.Errorf("alert result = %+v, want score 95", p.Result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("receiver got no alert for a critical lookup")
+	}
+	select {
+	case p := <-alerts:
+		t.Errorf("unexpected alert for %s", p.IPChecked)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// The alert is queued before the caller's scoring profile rescores the
+// result, so it must keep the base explanation; run with -race to catch the
+// two sharing one
+func TestCheckIPAlertKeepsBaseExplanation(t *testing.T) {
+	useFakeProvider(t)
+	resetProfileRows(t)
+
+	middleware.SetKeyLookup(func(_ context.Context, hash string) (*models.APIKey, error) {
+		if hash == middleware.HashAPIKey("capped_key") {
+			return &models.APIKey{Tier: "premium"}, nil
+		}
+		return nil, nil
+	})
+	capped := scoring.DefaultConfig()
+	capped.MaxScore = 30
+	SetScoringProfiles(map[string]scoring.Config{"premium": capped})
+	origRows := reputationRows
+	reputationRows = func(_ context.Context, ips []string) (map[string][]database.IPReputationEntry, error) {
+		return map[string][]database.IPReputationEntry{
+			ips[0]: {{ThreatType: "proxy", Source: "firehol_level2", Confidence: 0.9, Weight: 75, LastSeen: time.Now()}},
+		}, nil
+	}
+	t.Cleanup(func() {
+		middleware.SetKeyLookup(nil)
+		SetScoringProfiles(nil)
+		reputationRows = origRows
+	})
+
+	alerts := make(chan alert.Payload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p alert.Payload
+		json.NewDecoder(r.Body).Decode(&p)
+		alerts <- p
+	}))
+	defer receiver.Close()
+
+	webhook := alert.NewWebhook(alert.Config{URL: receiver.URL, MinScore: 50})
+	SetAlertWebhook(webhook)
+	t.Cleanup(func() {
+		SetAlertWebhook(nil)
+		webhook.Close()
+	})
+
+	app := fiber.New()
+	app.Post("/check", CheckIPWithOptions())
+	req := httptest.NewRequest("POST", "/check", strings.NewReader(`{"ip":"45.155.205.9","explain":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "capped_key")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var got models.IPCheckResult
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Score != 30 || got.Explanation == nil || got.Explanation.BaseScore != 30 {
+		t.Errorf("response = score %d explanation %+v, want both capped at 30", got.Score, got.Explanation)
+	}
+
+	select {
+	case p := <-alerts:
+		if p.Result == nil {
+			t.Fatal("alert has no result")
+		}
+		if p.Result.Score != 80 || p.Result.Explanation == nil || p.Result.Explanation.BaseScore != 80 {
+			t.Errorf("alert = score %d explanation %+v, want both at the base 80", p.Result.Score, p.Result.Explanation)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("receiver got no alert for a high-risk lookup")
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+const (
+	topThreatsDefaultLimit = 50
+	topThreatsMaxLimit     = 500
+	topThreatsMaxHours     = 90 * 24 // api_requests retention
+	dashboardTopThreats    = 10
+)
+
+// analyticsDisabled responds to analytics endpoints when ClickHouse is off
+func analyticsDisabled(c *fiber.Ctx) error {
+	return middleware.WriteError(c, fiber.StatusNotImplemented, models.ErrCodeFeatureDisabled, "Analytics is not enabled; set clickhouse.enabled to use this endpoint")
+}
+
+// GetDashboard returns today's request totals, the risk level distribution
+// and the most checked risky IPs of the last 24 hours
+func GetDashboard() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ch := getAnalytics()
+		if ch == nil {
+			return analyticsDisabled(c)
+		}
+
+		data, err := ch.GetDashboardData(c.Context())
+		if err != nil {
+			logger.Error(fmt.Sprintf("Dashboard query failed: %v", err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to read dashboard data")
+		}
+
+		top, err := ch.GetTopThreats(c.Context(), dashboardTopThreats, 24)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Top threats query failed: %v", err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to read top threats")
+		}
+
+		return c.JSON(fiber.Map{
+			"today_requests":       data.TodayRequests,
+			"today_unique_ips":     data.TodayUniqueIPs,
+			"avg_response_time_ms": data.AvgResponseTime,
+			"threat_distribution":  data.ThreatDistribution,
+			"top_threats":          top,
+		})
+	}
+}
+
+// GetTopThreats returns the most frequently checked risky IPs over ?hours=
+// (default 24), at most ?limit= (default 50) entries
+func GetTopThreats() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", topThreatsDefaultLimit)
+		hours := c.QueryInt("hours", 24)
+		if limit <= 0 || limit > topThreatsMaxLimit {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", topThreatsMaxLimit))
+		}
+		if hours <= 0 || hours > topThreatsMaxHours {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, fmt.Sprintf("hours must be between 1 and %d", topThreatsMaxHours))
+		}
+
+		ch := getAnalytics()
+		if ch == nil {
+			return analyticsDisabled(c)
+		}
+
+		threats, err := ch.GetTopThreats(c.Context(), limit, hours)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Top threats query failed: %v", err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to read top threats")
+		}
+
+		return c.JSON(fiber.Map{
+			"threats": threats,
+			"hours":   hours,
+			"count":   len(threats),
+		})
+	}
+}
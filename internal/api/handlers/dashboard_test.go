@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAnalyticsEndpointsWithoutClickHouse(t *testing.T) {
+	SetAnalytics(nil)
+
+	app := fiber.New()
+	app.Get("/dashboard", GetDashboard())
+	app.Get("/threats/top", GetTopThreats())
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/dashboard", fiber.StatusNotImplemented},
+		{"/threats/top", fiber.StatusNotImplemented},
+		{"/threats/top?limit=10&hours=168", fiber.StatusNotImplemented},
+		{"/threats/top?limit=0", fiber.StatusBadRequest},
+		{"/threats/top?limit=501", fiber.StatusBadRequest},
+		{"/threats/top?hours=0", fiber.StatusBadRequest},
+		{"/threats/top?hours=5000", fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// exportTimeout bounds a single export stream
+const exportTimeout = 10 * time.Minute
+
+// exportOptions are the validated query parameters of ExportBlocklist
+type exportOptions struct {
+	Format     string // cidr, plain or csv
+	MinScore   int
+	RiskLevel  string
+	ThreatType string
+}
+
+// parseExportOptions validates the export query parameters
+func parseExportOptions(c *fiber.Ctx) (exportOptions, error) {
+	opts := exportOptions{
+		Format:     c.Query("format", "cidr"),
+		MinScore:   c.QueryInt("min_score", 0),
+		RiskLevel:  c.Query("risk_level"),
+		ThreatType: c.Query("threat_type"),
+	}
+
+	switch opts.Format {
+	case "cidr", "plain", "csv":
+	default:
+		return opts, fmt.Errorf("format must be one of cidr, plain, csv")
+	}
+
+	if opts.MinScore < 0 || opts.MinScore > 100 {
+		return opts, fmt.Errorf("min_score must be between 0 and 100")
+	}
+
+	switch opts.RiskLevel {
+	case "", "clean", "low", "medium", "high", "critical":
+	default:
+		return opts, fmt.Errorf("risk_level must be one of clean, low, medium, high, critical")
+	}
+
+	if opts.ThreatType != "" {
+		if _, ok := scoring.DefaultConfig().ThreatWeights[opts.ThreatType]; !ok {
+			return opts, fmt.Errorf("unknown threat_type %q", opts.ThreatType)
+		}
+	}
+
+	return opts, nil
+}
+
+// ExportBlocklist streams the active reputation data as a blocklist suitable
+// for ipset/nftables (format=cidr), "network:score" lines (format=plain) or CSV
+func ExportBlocklist() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pg := getDatabase()
+		if pg == nil {
+			return databaseUnavailable(c)
+		}
+
+		opts, err := parseExportOptions(c)
+		if err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		}
+
+		if opts.Format == "csv" {
+			c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		} else {
+			c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		}
+
+		// The body is written after the handler returns, so the query must not use the request context
+		reqID := requestID(c)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+			defer cancel()
+
+			exp := newBlocklistExporter(w, opts, scoring.New(getScoringConfig()), time.Now())
+			err := pg.StreamActiveReputations(ctx, opts.ThreatType, exp.add)
+			if err == nil {
+				err = exp.close()
+			}
+			if err != nil {
+				logger.Error(fmt.Sprintf("Blocklist export aborted after %d networks: %v", exp.written, err), reqID)
+				return
+			}
+			logger.Info(fmt.Sprintf("Blocklist export (%s): %d networks", opts.Format, exp.written), reqID)
+		})
+
+		return nil
+	}
+}
+
+// exportGroup accumulates the entries of one network across sources
+type exportGroup struct {
+	ipStart, ipEnd string
+	network        string
+	threats        []models.Threat
+}
+
+// blocklistExporter scores consecutive entries for the same network together
+// and writes one filtered line per network
+type blocklistExporter struct {
+	w       io.Writer
+	opts    exportOptions
+	scorer  *scoring.Scorer
+	now     time.Time
+	cur     *exportGroup
+	written int
+}
+
+func newBlocklistExporter(w io.Writer, opts exportOptions, scorer *scoring.Scorer, now time.Time) *blocklistExporter {
+	e := &blocklistExporter{w: w, opts: opts, scorer: scorer, now: now}
+	if opts.Format == "csv" {
+		io.WriteString(w, "network,score,risk_level,threat_type,sources\n")
+	}
+	return e
+}
+
+// add consumes the next entry; entries must arrive ordered by range
+func (e *blocklistExporter) add(entry *database.IPReputationEntry) error {
+	if e.cur != nil && (e.cur.ipStart != entry.IPStart || e.cur.ipEnd != entry.IPEnd) {
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+
+	if e.cur == nil {
+		network := entry.IPStart
+		if entry.CIDR != nil {
+			network = *entry.CIDR
+		}
+		e.cur = &exportGroup{ipStart: entry.IPStart, ipEnd: entry.IPEnd, network: network}
+	}
+
+	e.cur.threats = append(e.cur.threats, models.Threat{
+		ThreatType: entry.ThreatType,
+		Source:     entry.Source,
+		Confidence: entry.Confidence,
+		LastSeen:   entry.LastSeen,
+		Weight:     entry.Weight,
+	})
+	return nil
+}
+
+// close writes the last pending network
+func (e *blocklistExporter) close() error {
+	if e.cur == nil {
+		return nil
+	}
+	return e.flush()
+}
+
+// flush scores the current network and writes it if it passes the filters
+func (e *blocklistExporter) flush() error {
+	g := e.cur
+	e.cur = nil
+
+	score := e.scorer.CalculateScore(g.threats, nil, e.now)
+	level := e.scorer.ClassifyRisk(score)
+	if score < e.opts.MinScore || (e.opts.RiskLevel != "" && level != e.opts.RiskLevel) {
+		return nil
+	}
+
+	var line string
+	switch e.opts.Format {
+	case "cidr":
+		line = asPrefix(g.network)
+	case "plain":
+		line = fmt.Sprintf("%s:%d", g.network, score)
+	case "csv":
+		summary := e.scorer.ThreatSummary(g.threats)
+		line = fmt.Sprintf("%s,%d,%s,%s,%s",
+			g.network, score, level, primaryThreat(g.threats), strings.Join(summary.Sources, ";"))
+	}
+
+	if _, err := io.WriteString(e.w, line+"\n"); err != nil {
+		return err
+	}
+	e.written++
+	return nil
+}
+
+// primaryThreat returns the threat type contributing the most weight
+func primaryThreat(threats []models.Threat) string {
+	var best models.Threat
+	for _, t := range threats {
+		if float64(t.Weight)*t.Confidence > float64(best.Weight)*best.Confidence {
+			best = t
+		}
+	}
+	return best.ThreatType
+}
+
+// asPrefix gives single addresses an explicit /32 or /128 for ipset/nftables
+func asPrefix(network string) string {
+	if strings.Contains(network, "/") {
+		return network
+	}
+	addr, err := netip.ParseAddr(network)
+	if err != nil {
+		return network
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()).String()
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+)
+
+func TestParseExportOptions(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{"", false},
+		{"format=cidr&min_score=70&threat_type=botnet_c2", false},
+		{"format=csv&risk_level=critical", false},
+		{"format=xml", true},
+		{"min_score=101", true},
+		{"risk_level=severe", true},
+		{"threat_type=evil", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			app := fiber.New()
+			var err error
+			app.Get("/export", func(c *fiber.Ctx) error {
+				_, err = parseExportOptions(c)
+				return nil
+			})
+			if _, testErr := app.Test(httptest.NewRequest("GET", "/export?"+tt.query, nil)); testErr != nil {
+				t.Fatalf("app.Test: %v", testErr)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseExportOptions(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlocklistExporter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cidr := "45.155.205.0/24"
+
+	// Ordered by range, as StreamActiveReputations returns them
+	entries := []database.IPReputationEntry{
+		{IPStart: "45.155.205.0", IPEnd: "45.155.205.255", CIDR: &cidr, Source: "spamhaus_drop", ThreatType: "hijacked", Confidence: 1, Weight: 95, LastSeen: now},
+		{IPStart: "45.155.205.0", IPEnd: "45.155.205.255", CIDR: &cidr, Source: "firehol_level1", ThreatType: "attack", Confidence: 0.8, Weight: 75, LastSeen: now},
+		{IPStart: "185.220.101.7", IPEnd: "185.220.101.7", Source: "feodo", ThreatType: "botnet_c2", Confidence: 1, Weight: 95, LastSeen: now},
+		{IPStart: "2001:db8::1", IPEnd: "2001:db8::1", Source: "blocklist_de", ThreatType: "spam", Confidence: 0.5, Weight: 60, LastSeen: now},
+	}
+
+	tests := []struct {
+		opts exportOptions
+		want string
+	}{
+		{exportOptions{Format: "cidr"}, "45.155.205.0/24\n185.220.101.7/32\n2001:db8::1/128\n"},
+		{exportOptions{Format: "cidr", MinScore: 70}, "45.155.205.0/24\n185.220.101.7/32\n"},
+		{exportOptions{Format: "plain", RiskLevel: "low"}, "2001:db8::1:30\n"},
+		{exportOptions{Format: "csv", MinScore: 90}, "network,score,risk_level,threat_type,sources\n" +
+			"45.155.205.0/24,100,critical,hijacked,spamhaus_drop;firehol_level1\n" +
+			"185.220.101.7,100,critical,botnet_c2,feodo\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.opts.Format, func(t *testing.T) {
+			var out strings.Builder
+			exp := newBlocklistExporter(&out, tt.opts, scoring.NewDefault(), now)
+			for i := range entries {
+				if err := exp.add(&entries[i]); err != nil {
+					t.Fatalf("add: %v", err)
+				}
+			}
+			if err := exp.close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("export =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+var (
+	feedsConfig   *config.FeedsConfig
+	feedsConfigMu sync.RWMutex
+)
+
+// SetFeedsConfig sets the feeds configuration reported by the feeds endpoint
+func SetFeedsConfig(cfg *config.FeedsConfig) {
+	feedsConfigMu.Lock()
+	defer feedsConfigMu.Unlock()
+	feedsConfig = cfg
+}
+
+// getFeedsConfig returns the current feeds configuration
+func getFeedsConfig() *config.FeedsConfig {
+	feedsConfigMu.RLock()
+	defer feedsConfigMu.RUnlock()
+	return feedsConfig
+}
+
+// GetFeeds returns the status of every configured feed
+func GetFeeds() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		feedsCfg := getFeedsConfig()
+		if feedsCfg == nil {
+			return middleware.WriteError(c, fiber.StatusServiceUnavailable, models.ErrCodeServiceUnavailable, "Feeds configuration is not loaded")
+		}
+
+		pg := getDatabase()
+		if pg == nil {
+			return databaseUnavailable(c)
+		}
+
+		runs, err := pg.GetFeedStatuses(c.Context())
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get feed statuses: %v", err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to get feed statuses")
+		}
+
+		now := time.Now()
+		feeds := make([]models.FeedStatus, 0, len(feedsCfg.Feeds))
+
+		for name, feed := range feedsCfg.Feeds {
+			status := models.FeedStatus{
+				Name:        name,
+				DisplayName: feed.Name,
+				Enabled:     feed.Enabled,
+				ThreatType:  feed.ThreatType,
+				Schedule:    feed.Schedule,
+			}
+
+			if run, ok := runs[name]; ok {
+				status.LastRun = run.LastRun
+				status.LastStatus = run.LastStatus
+				status.LastSuccess = run.LastSuccess
+				status.LastEntries = run.LastEntries
+				status.LastError = run.LastError
+			}
+
+			if feed.Enabled {
+				if next, err := config.NextRun(feed.Schedule, now); err == nil {
+					status.NextRun = &next
+				}
+			}
+
+			feeds = append(feeds, status)
+		}
+
+		sort.Slice(feeds, func(i, j int) bool {
+			return feeds[i].Name < feeds[j].Name
+		})
+
+		return c.JSON(fiber.Map{
+			"feeds": feeds,
+			"count": len(feeds),
+		})
+	}
+}
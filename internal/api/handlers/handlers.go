@@ -2,37 +2,69 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/netip"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/asn"
 	"github.com/lfrfrfr/beon-ipquality/internal/cache"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
 	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
 	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
 	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
 
 var (
-	mmdbReader *mmdb.Reader
-	mmdbMu     sync.RWMutex
+	provider   mmdb.LookupProvider
+	providerMu sync.RWMutex
 	ipCache    cache.Cache
 	cacheMu    sync.RWMutex
 	cacheCtx   = context.Background()
+	db         *database.PostgresDB
+	dbMu       sync.RWMutex
+	classifier *asn.Classifier
+	asnMu      sync.RWMutex
+	checkOpts  iputil.CheckOptions
+	checkMu    sync.RWMutex
+	failClosed bool
+	failMu     sync.RWMutex
 )
 
-// SetMMDBReader sets the MMDB reader for IP lookups
-func SetMMDBReader(reader *mmdb.Reader) {
-	mmdbMu.Lock()
-	defer mmdbMu.Unlock()
-	mmdbReader = reader
+// errReputationUnavailable is returned by checks under the closed fail
+// policy when the reputation of the IP could not be read
+var errReputationUnavailable = errors.New("reputation data unavailable")
+
+// SetLookupProvider sets the backend IP checks read from, normally the
+// *mmdb.Reader; nil leaves checks to the fail policy
+func SetLookupProvider(p mmdb.LookupProvider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
 }
 
-// getMMDBReader returns the current MMDB reader
-func getMMDBReader() *mmdb.Reader {
-	mmdbMu.RLock()
-	defer mmdbMu.RUnlock()
-	return mmdbReader
+// getLookupProvider returns the current lookup provider
+func getLookupProvider() mmdb.LookupProvider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	return provider
+}
+
+// flaggedFilter is implemented by providers that can rule out unlisted IPs
+// cheaply, like an *mmdb.Reader with its flagged prefix filter
+type flaggedFilter interface {
+	MayBeFlagged(ip netip.Addr) bool
 }
 
 // SetCache sets the cache instance
@@ -49,6 +81,74 @@ func getCache() cache.Cache {
 	return ipCache
 }
 
+// SetDatabase sets the PostgreSQL database used by DB-backed endpoints
+func SetDatabase(d *database.PostgresDB) {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	db = d
+}
+
+// getDatabase returns the current database instance
+func getDatabase() *database.PostgresDB {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+	return db
+}
+
+// SetASNClassifier sets the classifier that fills in ASN types on lookups
+func SetASNClassifier(c *asn.Classifier) {
+	asnMu.Lock()
+	defer asnMu.Unlock()
+	classifier = c
+}
+
+// getASNClassifier returns the ASN classifier, nil if none is set
+func getASNClassifier() *asn.Classifier {
+	asnMu.RLock()
+	defer asnMu.RUnlock()
+	return classifier
+}
+
+// SetCheckOptions sets which non-public addresses may be checked
+func SetCheckOptions(opts iputil.CheckOptions) {
+	checkMu.Lock()
+	defer checkMu.Unlock()
+	checkOpts = opts
+}
+
+// isCheckable reports whether addr passes the configured IP validity policy
+func isCheckable(addr netip.Addr) bool {
+	checkMu.RLock()
+	defer checkMu.RUnlock()
+	return iputil.IsValidFor(addr, checkOpts)
+}
+
+// SetFailClosed sets whether checks fail with 503, rather than answer clean,
+// when the reputation cannot be read (lookup.fail_policy)
+func SetFailClosed(closed bool) {
+	failMu.Lock()
+	defer failMu.Unlock()
+	failClosed = closed
+}
+
+// isFailClosed reports whether the closed fail policy is in effect
+func isFailClosed() bool {
+	failMu.RLock()
+	defer failMu.RUnlock()
+	return failClosed
+}
+
+// reputationUnavailable writes the 503 of a check failed under the closed
+// fail policy
+func reputationUnavailable(c *fiber.Ctx, ip string) error {
+	return middleware.WriteErrorDetails(c, fiber.StatusServiceUnavailable, models.ErrCodeServiceUnavailable, "Reputation data unavailable", fiber.Map{"ip": ip})
+}
+
+// requestID tags a log entry with the request's X-Request-ID
+func requestID(c *fiber.Ctx) zap.Field {
+	return logger.RequestID(middleware.GetRequestID(c))
+}
+
 // CheckIP handles single IP reputation check
 func CheckIP() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -56,120 +156,259 @@ func CheckIP() fiber.Handler {
 
 		ipParam := c.Params("ip")
 		if ipParam == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "invalid_request",
-				"message": "IP address is required",
-			})
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "IP address is required")
 		}
 
-		// Parse IP address
-		addr, err := iputil.ParseIP(ipParam)
+		addr, msg := parseCheckIP(ipParam)
+		if msg != "" {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidIP, msg)
+		}
+
+		fields, err := responseFields(c)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "invalid_ip",
-				"message": "Invalid IP address format",
-			})
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		}
+
+		result, err := performIPCheck(addr, startTime)
+		if err != nil {
+			return reputationUnavailable(c, ipParam)
 		}
 
-		// Normalize IP (IPv4-mapped IPv6 to IPv4)
-		addr = iputil.NormalizeIP(addr)
+		notifyHighRisk(c, &result)
+		applyCallerProfile(c, &result)
+		result.QueryTime = float64(time.Since(startTime).Microseconds()) / 1000.0
+		return writeCheckResult(c, &result, fields)
+	}
+}
 
-		// Check if IP is valid for reputation checking
-		if !iputil.IsValid(addr) {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "invalid_ip",
-				"message": "IP address is not suitable for reputation check (private, loopback, etc.)",
-			})
+// rdnsTimeout bounds the PTR lookup of a check requested with rdns
+const rdnsTimeout = 2 * time.Second
+
+// lookupAddr resolves PTR records; replaced in tests
+var lookupAddr = net.DefaultResolver.LookupAddr
+
+// CheckIPWithOptions handles a single IP check whose JSON body carries the IP
+// and enrichment options, avoiding IPv6 path escaping. It returns the same
+// result as CheckIP.
+func CheckIPWithOptions() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		startTime := time.Now()
+
+		var req models.CheckRequest
+		if err := c.BodyParser(&req); err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body")
+		}
+		if req.IP == "" {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "IP address is required")
+		}
+		if req.Scan {
+			return middleware.WriteError(c, fiber.StatusNotImplemented, models.ErrCodeFeatureDisabled, "Active scans are served by judge nodes (GET /scan/:ip)")
 		}
 
-		// TODO: Implement actual reputation lookup from MMDB/database
-		// For now, return a placeholder response
-		result := performIPCheck(addr, startTime)
+		addr, msg := parseCheckIP(req.IP)
+		if msg != "" {
+			return middleware.WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeInvalidIP, msg, fiber.Map{"ip": req.IP})
+		}
 
+		fields, err := responseFields(c)
+		if err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		}
+
+		var result models.IPCheckResult
+		if req.Explain {
+			result, err = explainIPCheck(addr)
+		} else {
+			result, err = performIPCheck(addr, startTime)
+		}
+		if err != nil {
+			return reputationUnavailable(c, req.IP)
+		}
+
+		if req.IncludeGeo != nil && !*req.IncludeGeo {
+			result.Geo = nil
+		}
+		if req.RDNS {
+			result.Hostname = reverseDNS(c.Context(), addr)
+		}
+
+		notifyHighRisk(c, &result)
+		applyCallerProfile(c, &result)
+		result.QueryTime = float64(time.Since(startTime).Microseconds()) / 1000.0
+		return writeCheckResult(c, &result, fields)
+	}
+}
+
+// responseFields returns the fields a check response is trimmed to, from
+// ?fields= (comma-separated result field names) or ?compact=true. It returns
+// nil for the full result, the default.
+func responseFields(c *fiber.Ctx) ([]string, error) {
+	if fields := c.Query("fields"); fields != "" {
+		return models.ParseResultFields(fields)
+	}
+	if c.QueryBool("compact") {
+		return models.CompactFields, nil
+	}
+	return nil, nil
+}
+
+// writeCheckResult writes a check result, trimmed to fields when set
+func writeCheckResult(c *fiber.Ctx, result *models.IPCheckResult, fields []string) error {
+	if fields == nil {
 		return c.JSON(result)
 	}
+	data, err := result.MarshalFields(fields)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(data)
+}
+
+// parseCheckIP parses an IP to check, unmapping IPv4-mapped IPv6 addresses.
+// It returns the 400 error message when the IP is unparseable or excluded by
+// the IP validity policy.
+func parseCheckIP(ipStr string) (netip.Addr, string) {
+	addr, err := iputil.ParseIP(ipStr)
+	if err != nil {
+		return netip.Addr{}, "Invalid IP address format"
+	}
+	addr = iputil.NormalizeIP(addr)
+	if !isCheckable(addr) {
+		return netip.Addr{}, "IP address is not suitable for reputation check (private, loopback, etc.)"
+	}
+	return addr, ""
+}
+
+// reverseDNS returns the first PTR name of addr without its trailing dot, or
+// "" when there is none or the lookup fails
+func reverseDNS(ctx context.Context, addr netip.Addr) string {
+	ctx, cancel := context.WithTimeout(ctx, rdnsTimeout)
+	defer cancel()
+
+	names, err := lookupAddr(ctx, addr.String())
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
 }
 
-// BatchCheckIP handles batch IP reputation check
-func BatchCheckIP(maxSize int) fiber.Handler {
+// BatchCheckIP handles batch IP reputation check. Up to concurrency IPs are
+// checked at once; results keep the order of the request.
+func BatchCheckIP(maxSize, concurrency int) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		startTime := time.Now()
 
 		var req models.BatchCheckRequest
 		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "invalid_request",
-				"message": "Invalid request body",
-			})
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body")
 		}
 
 		if len(req.IPs) == 0 {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "invalid_request",
-				"message": "At least one IP address is required",
-			})
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "At least one IP address is required")
 		}
 
 		if len(req.IPs) > maxSize {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "too_many_ips",
-				"message": "Exceeded maximum batch size",
-				"max":     maxSize,
+			return middleware.WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeTooManyIPs, "Exceeded maximum batch size", fiber.Map{
+				"max": maxSize,
 			})
 		}
 
-		results := make([]models.IPCheckResult, 0, len(req.IPs))
+		fields, err := responseFields(c)
+		if err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		}
 
-		for _, ipStr := range req.IPs {
-			ipStartTime := time.Now()
+		results := checkBatch(c.Context(), req.IPs, concurrency, checkBatchIP)
+		rescore := make([]*models.IPCheckResult, len(results))
+		for i := range results {
+			notifyHighRisk(c, &results[i])
+			rescore[i] = &results[i]
+		}
+		applyCallerProfile(c, rescore...)
+		totalTime := float64(time.Since(startTime).Microseconds()) / 1000.0
+
+		if fields == nil {
+			return c.JSON(models.BatchCheckResponse{
+				Results:    results,
+				TotalTime:  totalTime,
+				TotalCount: len(results),
+			})
+		}
 
-			addr, err := iputil.ParseIP(ipStr)
-			if err != nil {
-				results = append(results, models.IPCheckResult{
-					IP:        ipStr,
-					Score:     -1,
-					RiskLevel: "error",
-				})
-				continue
+		// Same shape as BatchCheckResponse with each result projected
+		projected := make([]json.RawMessage, len(results))
+		for i := range results {
+			if projected[i], err = results[i].MarshalFields(fields); err != nil {
+				return err
 			}
+		}
+		return c.JSON(fiber.Map{
+			"results":       projected,
+			"total_time_ms": totalTime,
+			"total_count":   len(results),
+		})
+	}
+}
 
-			addr = iputil.NormalizeIP(addr)
+// checkBatchIP checks one IP of a batch; unparseable IPs and those whose
+// reputation cannot be read under the closed fail policy get risk level
+// "error", and non-public ones "invalid"
+func checkBatchIP(ipStr string) models.IPCheckResult {
+	ipStartTime := time.Now()
 
-			if !iputil.IsValid(addr) {
-				results = append(results, models.IPCheckResult{
-					IP:        ipStr,
-					Score:     -1,
-					RiskLevel: "invalid",
-				})
-				continue
-			}
+	addr, err := iputil.ParseIP(ipStr)
+	if err != nil {
+		return models.IPCheckResult{IP: ipStr, Score: -1, RiskLevel: "error"}
+	}
 
-			result := performIPCheck(addr, ipStartTime)
-			results = append(results, result)
-		}
+	addr = iputil.NormalizeIP(addr)
 
-		return c.JSON(models.BatchCheckResponse{
-			Results:    results,
-			TotalTime:  float64(time.Since(startTime).Microseconds()) / 1000.0,
-			TotalCount: len(results),
-		})
+	if !isCheckable(addr) {
+		return models.IPCheckResult{IP: ipStr, Score: -1, RiskLevel: "invalid"}
+	}
+
+	result, err := performIPCheck(addr, ipStartTime)
+	if err != nil {
+		return models.IPCheckResult{IP: ipStr, Score: -1, RiskLevel: "error"}
 	}
+	return result
 }
 
-// GetStats returns API usage statistics
-func GetStats() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		// TODO: Implement actual stats from ClickHouse or Redis
-		stats := models.APIStats{
-			TotalRequests:   0,
-			TotalIPs:        0,
-			AvgResponseTime: 0,
-			ErrorRate:       0,
-			Period:          "24h",
+// checkBatch runs check over ips with at most concurrency workers, keeping
+// the input order. IPs not yet checked when ctx is done get risk level "error".
+func checkBatch(ctx context.Context, ips []string, concurrency int, check func(string) models.IPCheckResult) []models.IPCheckResult {
+	results := make([]models.IPCheckResult, len(ips))
+	workers := min(max(concurrency, 1), len(ips))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				results[idx] = check(ips[idx])
+			}
+		}()
+	}
+
+	queued := 0
+feed:
+	for ; queued < len(ips); queued++ {
+		select {
+		case next <- queued:
+		case <-ctx.Done():
+			break feed
 		}
+	}
+	close(next)
+	wg.Wait()
 
-		return c.JSON(stats)
+	for idx := queued; idx < len(ips); idx++ {
+		results[idx] = models.IPCheckResult{IP: ips[idx], Score: -1, RiskLevel: "error"}
 	}
+	return results
 }
 
 // HealthCheck returns health status
@@ -193,38 +432,99 @@ func HealthCheck(version string) fiber.Handler {
 	}
 }
 
-// performIPCheck performs the actual IP reputation check using MMDB with caching
-func performIPCheck(addr netip.Addr, startTime time.Time) models.IPCheckResult {
+// CheckAddr checks addr like GET /check/:ip, for lookups that do not come
+// over HTTP such as DNSBL queries. It applies neither the IP policy nor
+// scoring profiles.
+func CheckAddr(addr netip.Addr) (*models.IPCheckResult, error) {
+	result, err := performIPCheck(addr, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// performIPCheck performs the actual IP reputation check using MMDB with
+// caching. It fails with errReputationUnavailable only under the closed fail
+// policy; a cache error just falls through to the MMDB.
+func performIPCheck(addr netip.Addr, startTime time.Time) (models.IPCheckResult, error) {
 	ipStr := addr.String()
+	p := getLookupProvider()
+
+	// IPs outside every flagged prefix are clean: answer them from the MMDB
+	// without a cache round trip, and keep them out of Redis
+	c := getCache()
+	if f, ok := p.(flaggedFilter); ok && !f.MayBeFlagged(addr) {
+		c = nil
+	}
 
 	// Try cache first
-	if c := getCache(); c != nil {
+	if c != nil {
 		if cached, err := c.Get(cacheCtx, ipStr); err == nil && cached != nil {
 			cached.QueryTime = float64(time.Since(startTime).Microseconds()) / 1000.0
 			cached.Cached = true
-			return *cached
+			return *cached, nil
 		}
 	}
 
-	reader := getMMDBReader()
+	result, _, err := lookupIP(p, addr)
+	if err != nil {
+		return models.IPCheckResult{}, err
+	}
+	result.QueryTime = float64(time.Since(startTime).Microseconds()) / 1000.0
 
-	// If MMDB is loaded, use it for lookup
-	if reader != nil {
-		result, err := reader.LookupAll(addr)
+	// Cache clean results too; the cache applies its shorter clean TTL
+	if c != nil {
+		_ = c.Set(cacheCtx, ipStr, &result)
+	}
+
+	return result, nil
+}
+
+// explainIPCheck checks addr like performIPCheck but bypasses the cache,
+// which only holds final scores, to record how the score was formed
+func explainIPCheck(addr netip.Addr) (models.IPCheckResult, error) {
+	result, baseScore, err := lookupIP(getLookupProvider(), addr)
+	if err != nil {
+		return models.IPCheckResult{}, err
+	}
+
+	result.Explanation = &models.ScoreExplanation{
+		BaseScore:     baseScore,
+		ASNAdjustment: result.Score - baseScore,
+		Sources:       result.ThreatTypes,
+	}
+	if result.ASN != nil {
+		result.Explanation.ASNType = result.ASN.ASNType
+	}
+	return result, nil
+}
+
+// lookupIP looks addr up in the provider and folds in its ASN type. It also
+// returns the compiled score from before the ASN modifiers. When there is no
+// provider or the lookup fails, it answers clean under the open fail policy
+// and fails with errReputationUnavailable under the closed one.
+func lookupIP(p mmdb.LookupProvider, addr netip.Addr) (models.IPCheckResult, int, error) {
+	err := errReputationUnavailable
+	if p != nil {
+		var result *models.IPCheckResult
+		result, err = p.LookupAll(addr)
 		if err == nil && result != nil {
-			result.QueryTime = float64(time.Since(startTime).Microseconds()) / 1000.0
-			result.Cached = false
+			baseScore := result.Score
 
-			// Store in cache
-			if c := getCache(); c != nil {
-				_ = c.Set(cacheCtx, ipStr, result)
-			}
+			// The compiled scores ignore ASN data; fold in the ASN type now
+			getASNClassifier().Enrich(cacheCtx, result.ASN)
+			scoring.New(getScoringConfig()).ApplyASN(result)
 
-			return *result
+			return *result, baseScore, nil
 		}
+		logger.Debug(fmt.Sprintf("Lookup error for %s: %v", addr, err))
+	}
+
+	if isFailClosed() {
+		return models.IPCheckResult{}, 0, errReputationUnavailable
 	}
 
-	// Fallback: return clean result if MMDB not available or IP not found
+	// Fail open: report the IP as clean
 	result := models.IPCheckResult{
 		IP:           addr.String(),
 		Score:        0,
@@ -239,16 +539,10 @@ func performIPCheck(addr netip.Addr, startTime time.Time) models.IPCheckResult {
 		Threats:      []models.Threat{},
 		Geo:          nil,
 		ASN:          nil,
-		QueryTime:    float64(time.Since(startTime).Microseconds()) / 1000.0,
 		Cached:       false,
 	}
 
-	// Cache clean results too (shorter TTL would be better for these)
-	if c := getCache(); c != nil {
-		_ = c.Set(cacheCtx, ipStr, &result)
-	}
-
-	return result
+	return result, 0, nil
 }
 
 // GetCacheStats returns cache statistics
@@ -264,9 +558,7 @@ func GetCacheStats() fiber.Handler {
 
 		stats, err := cache.Stats(cacheCtx)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to get cache stats",
-			})
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to get cache stats")
 		}
 
 		return c.JSON(fiber.Map{
@@ -288,9 +580,7 @@ func ClearCache() fiber.Handler {
 		}
 
 		if err := cache.Clear(cacheCtx); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to clear cache",
-			})
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to clear cache")
 		}
 
 		return c.JSON(fiber.Map{
@@ -302,9 +592,15 @@ func ClearCache() fiber.Handler {
 
 // MMDBConfig holds MMDB paths for reload
 type MMDBConfig struct {
-	ReputationPath string
-	GeoIPCityPath  string
-	GeoIPASNPath   string
+	ReputationPath  string
+	GeoIPCityPath   string
+	GeoIPASNPath    string
+	AnonymousIPPath string
+	// FlaggedFilterFPRate enables the flagged prefix filter (0 = disabled)
+	FlaggedFilterFPRate float64
+	// OnReload, if set, is called after a reload swaps in the new reader,
+	// for answers cached outside the IP cache
+	OnReload func()
 }
 
 var mmdbConfig MMDBConfig
@@ -317,17 +613,9 @@ func SetMMDBConfig(cfg MMDBConfig) {
 // ReloadMMDB reloads the MMDB database without restart
 func ReloadMMDB() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Clear cache first
-		if cache := getCache(); cache != nil {
-			_ = cache.Clear(cacheCtx)
-		}
-
 		// Try to reload MMDB
 		if mmdbConfig.ReputationPath == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"success": false,
-				"error":   "MMDB config not set",
-			})
+			return middleware.WriteError(c, fiber.StatusServiceUnavailable, models.ErrCodeServiceUnavailable, "MMDB config not set")
 		}
 
 		newReader, err := mmdb.NewReader(
@@ -336,26 +624,43 @@ func ReloadMMDB() fiber.Handler {
 			mmdbConfig.GeoIPASNPath,
 		)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"success": false,
-				"error":   "Failed to reload MMDB: " + err.Error(),
-			})
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to reload MMDB: "+err.Error())
+		}
+		if mmdbConfig.AnonymousIPPath != "" {
+			if err := newReader.LoadAnonymousIP(mmdbConfig.AnonymousIPPath); err != nil {
+				logger.Warn(err.Error(), requestID(c))
+			}
+		}
+		if mmdbConfig.FlaggedFilterFPRate > 0 {
+			if err := newReader.EnableFlaggedFilter(mmdbConfig.FlaggedFilterFPRate); err != nil {
+				logger.Warn(err.Error(), requestID(c))
+			}
 		}
 
 		// Swap readers
-		mmdbMu.Lock()
-		oldReader := mmdbReader
-		mmdbReader = newReader
-		mmdbMu.Unlock()
+		providerMu.Lock()
+		old := provider
+		provider = newReader
+		providerMu.Unlock()
 
 		// Close old reader
-		if oldReader != nil {
-			oldReader.Close()
+		if closer, ok := old.(io.Closer); ok {
+			closer.Close()
+		}
+
+		// Move the cache to the new build epoch instead of flushing it:
+		// verdicts from the old database (clean ones in particular) are no
+		// longer read and expire on their TTL, so there is no cold-cache spike
+		if cache := getCache(); cache != nil {
+			cache.SetEpoch(newReader.BuildEpoch())
+		}
+		if mmdbConfig.OnReload != nil {
+			mmdbConfig.OnReload()
 		}
 
 		return c.JSON(fiber.Map{
 			"success": true,
-			"message": "MMDB reloaded successfully, cache cleared",
+			"message": fmt.Sprintf("MMDB reloaded successfully, cache moved to build epoch %d", newReader.BuildEpoch()),
 		})
 	}
 }
@@ -0,0 +1,710 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/cache"
+	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
+	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestCheckBatch(t *testing.T) {
+	ips := make([]string, 50)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("198.51.100.%d", i+1)
+	}
+
+	var running, peak atomic.Int32
+	check := func(ip string) models.IPCheckResult {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return models.IPCheckResult{IP: ip}
+	}
+
+	for _, concurrency := range []int{0, 1, 4, 100} {
+		peak.Store(0)
+		results := checkBatch(context.Background(), ips, concurrency, check)
+		if len(results) != len(ips) {
+			t.Fatalf("concurrency %d: got %d results, want %d", concurrency, len(results), len(ips))
+		}
+		for i, r := range results {
+			if r.IP != ips[i] {
+				t.Fatalf("concurrency %d: result %d is %s, want %s", concurrency, i, r.IP, ips[i])
+			}
+		}
+		if limit := int32(max(concurrency, 1)); peak.Load() > limit {
+			t.Errorf("concurrency %d: %d checks ran at once", concurrency, peak.Load())
+		}
+	}
+}
+
+func TestCheckBatchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ips := []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"}
+	results := checkBatch(ctx, ips, 2, func(ip string) models.IPCheckResult {
+		return models.IPCheckResult{IP: ip, RiskLevel: "low"}
+	})
+
+	if len(results) != len(ips) {
+		t.Fatalf("got %d results, want %d", len(results), len(ips))
+	}
+	for i, r := range results {
+		if r.IP != ips[i] {
+			t.Errorf("result %d is %s, want %s", i, r.IP, ips[i])
+		}
+		if r.RiskLevel != "low" && (r.RiskLevel != "error" || r.Score != -1) {
+			t.Errorf("result %d = %+v, want checked or marked as error", i, r)
+		}
+	}
+}
+
+func BenchmarkCheckBatch(b *testing.B) {
+	ips := make([]string, 500)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("198.51.%d.%d", i/250, i%250+1)
+	}
+	// Stands in for a lookup that waits on the cache or a DNS query
+	check := func(ip string) models.IPCheckResult {
+		time.Sleep(50 * time.Microsecond)
+		return models.IPCheckResult{IP: ip}
+	}
+
+	for _, concurrency := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				checkBatch(context.Background(), ips, concurrency, check)
+			}
+		})
+	}
+}
+
+func TestCheckIPPolicy(t *testing.T) {
+	app := fiber.New()
+	app.Get("/check/:ip", CheckIP())
+
+	check := func(ip string) int {
+		resp, err := app.Test(httptest.NewRequest("GET", "/check/"+ip, nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := check("10.1.2.3"); status != fiber.StatusBadRequest {
+		t.Errorf("strict policy: GET 10.1.2.3 = %d, want 400", status)
+	}
+
+	SetCheckOptions(iputil.CheckOptions{AllowPrivate: true, AllowLoopback: true})
+	t.Cleanup(func() { SetCheckOptions(iputil.CheckOptions{}) })
+
+	for _, ip := range []string{"10.1.2.3", "fd00::1", "127.0.0.1"} {
+		if status := check(ip); status != fiber.StatusOK {
+			t.Errorf("permissive policy: GET %s = %d, want 200", ip, status)
+		}
+	}
+	if status := check("224.0.0.1"); status != fiber.StatusBadRequest {
+		t.Errorf("permissive policy: GET 224.0.0.1 = %d, want 400 without allow_reserved", status)
+	}
+	if got := checkBatchIP("192.168.0.10"); got.RiskLevel != "clean" {
+		t.Errorf("checkBatchIP(192.168.0.10) risk level = %q, want clean", got.RiskLevel)
+	}
+}
+
+func TestCheckIPWithOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	err := mmdb.NewDefaultWriter().CompileToMMDB([]mmdb.ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("2a03:2880:dead::/48"),
+		RiskScore:  60,
+		ThreatType: "attack",
+		Sources:    []string{"blocklist_de"},
+		LastUpdate: time.Now(),
+	}}, path)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+	reader, err := mmdb.NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	SetLookupProvider(reader)
+	t.Cleanup(func() {
+		SetLookupProvider(nil)
+		reader.Close()
+	})
+
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		return []string{"scanner.example.net."}, nil
+	}
+	t.Cleanup(func() { lookupAddr = net.DefaultResolver.LookupAddr })
+
+	app := fiber.New()
+	app.Post("/check", CheckIPWithOptions())
+	post := func(body string) *http.Response {
+		req := httptest.NewRequest("POST", "/check", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		return resp
+	}
+
+	resp := post(`{"ip": "2a03:2880:dead::1", "explain": true, "rdns": true, "include_geo": false}`)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var got models.IPCheckResult
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.IP != "2a03:2880:dead::1" || got.Score != 60 {
+		t.Errorf("result = %s score %d, want 2a03:2880:dead::1 score 60", got.IP, got.Score)
+	}
+	if got.Hostname != "scanner.example.net" {
+		t.Errorf("hostname = %q, want scanner.example.net", got.Hostname)
+	}
+	if got.Explanation == nil || got.Explanation.BaseScore != 60 || got.Explanation.ASNAdjustment != 0 {
+		t.Errorf("explanation = %+v, want base score 60 without ASN adjustment", got.Explanation)
+	}
+
+	resp = post(`{"ip": "8.8.8.8"}`)
+	got = models.IPCheckResult{}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.RiskLevel != "clean" || got.Hostname != "" || got.Explanation != nil {
+		t.Errorf("plain check = %+v, want a clean result without enrichment", got)
+	}
+
+	for body, want := range map[string]int{
+		`{"ip": "8.8.8.8", "scan": true}`: fiber.StatusNotImplemented,
+		`{"ip": "10.0.0.1"}`:              fiber.StatusBadRequest,
+		`{"explain": true}`:               fiber.StatusBadRequest,
+		`not json`:                        fiber.StatusBadRequest,
+	} {
+		if resp := post(body); resp.StatusCode != want {
+			t.Errorf("POST %s = %d, want %d", body, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestCheckIPFailPolicy(t *testing.T) {
+	// A reader without a reputation database fails every lookup
+	reader, err := mmdb.NewReader("", "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	SetLookupProvider(reader)
+	t.Cleanup(func() {
+		SetLookupProvider(nil)
+		SetFailClosed(false)
+	})
+
+	app := fiber.New()
+	app.Get("/check/:ip", CheckIP())
+	app.Post("/check", CheckIPWithOptions())
+	get := func() *http.Response {
+		resp, err := app.Test(httptest.NewRequest("GET", "/check/8.8.8.8", nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		return resp
+	}
+	post := func() *http.Response {
+		req := httptest.NewRequest("POST", "/check", strings.NewReader(`{"ip": "8.8.8.8", "explain": true}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		return resp
+	}
+
+	resp := get()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("fail open: status = %d, want 200", resp.StatusCode)
+	}
+	var got models.IPCheckResult
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.RiskLevel != "clean" {
+		t.Errorf("fail open: risk level = %q, want clean", got.RiskLevel)
+	}
+	if got := checkBatchIP("8.8.8.8"); got.RiskLevel != "clean" {
+		t.Errorf("fail open: batch risk level = %q, want clean", got.RiskLevel)
+	}
+
+	SetFailClosed(true)
+	if resp := get(); resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Errorf("fail closed: GET status = %d, want 503", resp.StatusCode)
+	}
+	if resp := post(); resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Errorf("fail closed: POST status = %d, want 503", resp.StatusCode)
+	}
+	if got := checkBatchIP("8.8.8.8"); got.RiskLevel != "error" || got.Score != -1 {
+		t.Errorf("fail closed: batch result = %s score %d, want error score -1", got.RiskLevel, got.Score)
+	}
+
+	// Without any MMDB the closed policy fails too
+	SetLookupProvider(nil)
+	if resp := get(); resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Errorf("fail closed without MMDB: GET status = %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestCheckResponseFields(t *testing.T) {
+	app := fiber.New()
+	app.Get("/check/:ip", CheckIP())
+	app.Post("/check/batch", BatchCheckIP(10, 2))
+
+	do := func(req *http.Request) (int, string) {
+		t.Helper()
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := do(httptest.NewRequest("GET", "/check/8.8.8.8?compact=true", nil))
+	want := `{"ip":"8.8.8.8","score":0,"risk_level":"clean","proxy":false,"vpn":false,"tor":false}`
+	if status != fiber.StatusOK || body != want {
+		t.Errorf("compact check = %d %s, want 200 %s", status, body, want)
+	}
+
+	status, body = do(httptest.NewRequest("GET", "/check/8.8.8.8?fields=risk_level,score&compact=true", nil))
+	if want := `{"risk_level":"clean","score":0}`; status != fiber.StatusOK || body != want {
+		t.Errorf("check with fields = %d %s, want 200 %s", status, body, want)
+	}
+
+	if status, _ = do(httptest.NewRequest("GET", "/check/8.8.8.8?fields=score,is_proxy", nil)); status != fiber.StatusBadRequest {
+		t.Errorf("check with an unknown field = %d, want 400", status)
+	}
+
+	status, body = do(httptest.NewRequest("GET", "/check/8.8.8.8", nil))
+	if status != fiber.StatusOK || !strings.Contains(body, `"query_time_ms"`) {
+		t.Errorf("plain check = %d %s, want the full result", status, body)
+	}
+
+	req := httptest.NewRequest("POST", "/check/batch?fields=ip,score", strings.NewReader(`{"ips": ["8.8.8.8", "not-an-ip"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	status, body = do(req)
+	var batch struct {
+		Results    []map[string]any `json:"results"`
+		TotalCount int              `json:"total_count"`
+	}
+	if err := json.Unmarshal([]byte(body), &batch); err != nil || status != fiber.StatusOK {
+		t.Fatalf("batch = %d %s (%v), want 200 JSON", status, body, err)
+	}
+	if batch.TotalCount != 2 || len(batch.Results) != 2 || len(batch.Results[1]) != 2 || batch.Results[1]["score"] != float64(-1) {
+		t.Errorf("batch results = %v, want two results of ip and score", batch.Results)
+	}
+}
+
+// fakeProvider answers LookupAll from a fixed set of results; IPs it does not
+// know are clean, and err fails every lookup
+type fakeProvider struct {
+	results map[string]models.IPCheckResult
+	err     error
+	lookups atomic.Int32
+}
+
+func (f *fakeProvider) LookupReputation(netip.Addr) (*mmdb.ReputationRecord, error) {
+	return nil, f.err
+}
+
+func (f *fakeProvider) LookupAll(ip netip.Addr) (*models.IPCheckResult, error) {
+	f.lookups.Add(1)
+	if f.err != nil {
+		return nil, f.err
+	}
+	result, ok := f.results[ip.String()]
+	if !ok {
+		result = models.IPCheckResult{IP: ip.String(), RiskLevel: "clean"}
+	}
+	return &result, nil
+}
+
+func (f *fakeProvider) LookupGeoIP(netip.Addr) (*models.GeoInfo, error) { return nil, nil }
+func (f *fakeProvider) LookupASN(netip.Addr) (*models.ASNInfo, error)   { return nil, nil }
+
+// filteredProvider is a fakeProvider whose flagged prefix filter rules out every IP
+type filteredProvider struct{ *fakeProvider }
+
+func (filteredProvider) MayBeFlagged(netip.Addr) bool { return false }
+
+// memoryCache is an in-process cache that counts its reads. The embedded
+// interface stands in for the methods the handlers under test never call.
+type memoryCache struct {
+	cache.Cache
+	mu      sync.Mutex
+	entries map[string]models.IPCheckResult
+	epoch   uint64
+	gets    atomic.Int32
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]models.IPCheckResult)}
+}
+
+func (c *memoryCache) Get(_ context.Context, ip string) (*models.IPCheckResult, error) {
+	c.gets.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if result, ok := c.entries[ip]; ok {
+		return &result, nil
+	}
+	return nil, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, ip string, result *models.IPCheckResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[ip] = *result
+	return nil
+}
+
+func (c *memoryCache) SetEpoch(epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch = epoch
+}
+
+func TestCheckIPLookupProvider(t *testing.T) {
+	fake := &fakeProvider{results: map[string]models.IPCheckResult{
+		"45.155.205.9": {IP: "45.155.205.9", Score: 80, RiskScore: 80, RiskLevel: "high", IsProxy: true},
+	}}
+	SetLookupProvider(fake)
+	t.Cleanup(func() {
+		SetLookupProvider(nil)
+		SetCache(nil)
+		SetFailClosed(false)
+	})
+
+	app := fiber.New()
+	app.Get("/check/:ip", CheckIP())
+	get := func(ip string) (int, models.IPCheckResult) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/check/"+ip, nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var got models.IPCheckResult
+		json.NewDecoder(resp.Body).Decode(&got)
+		return resp.StatusCode, got
+	}
+
+	if status, got := get("45.155.205.9"); status != fiber.StatusOK || got.Score != 80 || !got.IsProxy {
+		t.Errorf("listed IP = %d %+v, want 200 with score 80 and the proxy flag", status, got)
+	}
+	if status, got := get("8.8.8.8"); status != fiber.StatusOK || got.RiskLevel != "clean" {
+		t.Errorf("unlisted IP = %d %+v, want 200 clean", status, got)
+	}
+
+	// Providers with a flagged prefix filter keep ruled-out IPs away from the cache
+	c := newMemoryCache()
+	SetCache(c)
+	get("8.8.8.8")
+	if c.gets.Load() != 1 {
+		t.Errorf("cache reads = %d with a provider without a filter, want 1", c.gets.Load())
+	}
+	SetLookupProvider(filteredProvider{fake})
+	before := fake.lookups.Load()
+	get("8.8.8.8")
+	if c.gets.Load() != 1 || fake.lookups.Load() != before+1 {
+		t.Errorf("cache reads = %d, lookups = %d after a filtered check, want 1 and %d", c.gets.Load(), fake.lookups.Load(), before+1)
+	}
+
+	fake.err = errors.New("backend down")
+	SetFailClosed(true)
+	if status, _ := get("45.155.205.9"); status != fiber.StatusServiceUnavailable {
+		t.Errorf("failing provider under the closed policy = %d, want 503", status)
+	}
+}
+
+// useFakeProvider installs a fakeProvider listing 45.155.205.9 and a fresh
+// memory cache for the test
+func useFakeProvider(t *testing.T) (*fakeProvider, *memoryCache) {
+	t.Helper()
+	fake := &fakeProvider{results: map[string]models.IPCheckResult{
+		"45.155.205.9": {IP: "45.155.205.9", Score: 80, RiskScore: 80, RiskLevel: "high", IsProxy: true},
+	}}
+	c := newMemoryCache()
+	SetLookupProvider(fake)
+	SetCache(c)
+	t.Cleanup(func() {
+		SetLookupProvider(nil)
+		SetCache(nil)
+		SetFailClosed(false)
+	})
+	return fake, c
+}
+
+func TestCheckIPRequests(t *testing.T) {
+	useFakeProvider(t)
+
+	app := fiber.New()
+	app.Get("/check/:ip", CheckIP())
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantCode   models.ErrorCode
+		wantScore  int
+		wantLevel  string
+	}{
+		{name: "listed public IP", path: "/check/45.155.205.9", wantStatus: fiber.StatusOK, wantScore: 80, wantLevel: "high"},
+		{name: "IPv4-mapped form", path: "/check/::ffff:45.155.205.9", wantStatus: fiber.StatusOK, wantScore: 80, wantLevel: "high"},
+		{name: "unlisted public IP", path: "/check/8.8.8.8", wantStatus: fiber.StatusOK, wantLevel: "clean"},
+		{name: "public IPv6", path: "/check/2606:4700:4700::1111", wantStatus: fiber.StatusOK, wantLevel: "clean"},
+		{name: "private IP", path: "/check/192.168.1.10", wantStatus: fiber.StatusBadRequest, wantCode: models.ErrCodeInvalidIP},
+		{name: "loopback IP", path: "/check/127.0.0.1", wantStatus: fiber.StatusBadRequest, wantCode: models.ErrCodeInvalidIP},
+		{name: "octet out of range", path: "/check/256.1.1.1", wantStatus: fiber.StatusBadRequest, wantCode: models.ErrCodeInvalidIP},
+		{name: "not an IP", path: "/check/example.com", wantStatus: fiber.StatusBadRequest, wantCode: models.ErrCodeInvalidIP},
+		{name: "unknown response field", path: "/check/8.8.8.8?fields=nope", wantStatus: fiber.StatusBadRequest, wantCode: models.ErrCodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			if tt.wantStatus != fiber.StatusOK {
+				var errResp models.ErrorResponse
+				if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if errResp.Code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", errResp.Code, tt.wantCode)
+				}
+				return
+			}
+
+			var got models.IPCheckResult
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.Score != tt.wantScore || got.RiskLevel != tt.wantLevel {
+				t.Errorf("result = score %d %q, want %d %q", got.Score, got.RiskLevel, tt.wantScore, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestCheckIPCache(t *testing.T) {
+	fake, c := useFakeProvider(t)
+
+	app := fiber.New()
+	app.Get("/check/:ip", CheckIP())
+	check := func() models.IPCheckResult {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/check/45.155.205.9", nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var got models.IPCheckResult
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+
+	miss := check()
+	if miss.Cached || fake.lookups.Load() != 1 {
+		t.Errorf("first check: cached = %v after %d lookups, want a lookup and an uncached result", miss.Cached, fake.lookups.Load())
+	}
+	if _, ok := c.entries["45.155.205.9"]; !ok {
+		t.Error("first check did not store its result in the cache")
+	}
+
+	hit := check()
+	if !hit.Cached || hit.Score != 80 || fake.lookups.Load() != 1 {
+		t.Errorf("second check: cached = %v, score %d after %d lookups, want the cached score 80 without a lookup",
+			hit.Cached, hit.Score, fake.lookups.Load())
+	}
+}
+
+func TestBatchCheckIPRequests(t *testing.T) {
+	fake, _ := useFakeProvider(t)
+
+	app := fiber.New()
+	app.Post("/check/batch", BatchCheckIP(3, 2))
+	post := func(body string) (*http.Response, []byte) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/check/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+
+	rejected := []struct {
+		name     string
+		body     string
+		wantCode models.ErrorCode
+	}{
+		{"malformed body", `{"ips": `, models.ErrCodeInvalidRequest},
+		{"no IPs", `{"ips": []}`, models.ErrCodeInvalidRequest},
+		{"over the size limit", `{"ips": ["8.8.8.8", "8.8.4.4", "1.1.1.1", "9.9.9.9"]}`, models.ErrCodeTooManyIPs},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, data := post(tt.body)
+			var errResp models.ErrorResponse
+			if err := json.Unmarshal(data, &errResp); err != nil {
+				t.Fatalf("decode %s: %v", data, err)
+			}
+			if resp.StatusCode != fiber.StatusBadRequest || errResp.Code != tt.wantCode {
+				t.Errorf("response = %d %q, want 400 %q", resp.StatusCode, errResp.Code, tt.wantCode)
+			}
+		})
+	}
+
+	// Per-IP failures are reported in place with the Score -1 sentinel
+	resp, data := post(`{"ips": ["45.155.205.9", "not-an-ip", "10.0.0.1"]}`)
+	var got models.BatchCheckResponse
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	want := []struct {
+		ip    string
+		score int
+		level string
+	}{
+		{"45.155.205.9", 80, "high"},
+		{"not-an-ip", -1, "error"},
+		{"10.0.0.1", -1, "invalid"},
+	}
+	if resp.StatusCode != fiber.StatusOK || got.TotalCount != len(want) || len(got.Results) != len(want) {
+		t.Fatalf("response = %d with %d results, want 200 with %d", resp.StatusCode, len(got.Results), len(want))
+	}
+	for i, w := range want {
+		if r := got.Results[i]; r.IP != w.ip || r.Score != w.score || r.RiskLevel != w.level {
+			t.Errorf("result %d = %s score %d %q, want %s score %d %q", i, r.IP, r.Score, r.RiskLevel, w.ip, w.score, w.level)
+		}
+	}
+
+	// Under the closed fail policy an unreadable reputation is an error too
+	fake.err = errors.New("backend down")
+	SetFailClosed(true)
+	_, data = post(`{"ips": ["8.8.4.4"]}`)
+	got = models.BatchCheckResponse{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	if len(got.Results) != 1 || got.Results[0].Score != -1 || got.Results[0].RiskLevel != "error" {
+		t.Errorf("results = %+v, want one error result with score -1", got.Results)
+	}
+}
+
+// closingProvider is a fakeProvider that records being closed
+type closingProvider struct {
+	*fakeProvider
+	closed bool
+}
+
+func (p *closingProvider) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestReloadMMDB(t *testing.T) {
+	_, c := useFakeProvider(t)
+	old := &closingProvider{fakeProvider: &fakeProvider{}}
+	SetLookupProvider(old)
+	t.Cleanup(func() { SetMMDBConfig(MMDBConfig{}) })
+
+	app := fiber.New()
+	app.Post("/reload", ReloadMMDB())
+	reload := func() int {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("POST", "/reload", nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := reload(); status != fiber.StatusServiceUnavailable {
+		t.Errorf("reload without MMDB config = %d, want 503", status)
+	}
+
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	SetMMDBConfig(MMDBConfig{ReputationPath: path})
+	if status := reload(); status != fiber.StatusInternalServerError {
+		t.Errorf("reload of a missing file = %d, want 500", status)
+	}
+	if getLookupProvider() != old || old.closed {
+		t.Fatal("a failed reload replaced or closed the current provider")
+	}
+
+	err := mmdb.NewDefaultWriter().CompileToMMDB([]mmdb.ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("45.155.205.0/24"),
+		RiskScore:  70,
+		ThreatType: "proxy",
+		LastUpdate: time.Now(),
+	}}, path)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+	if status := reload(); status != fiber.StatusOK {
+		t.Fatalf("reload = %d, want 200", status)
+	}
+
+	reader, ok := getLookupProvider().(*mmdb.Reader)
+	if !ok {
+		t.Fatalf("provider after reload is %T, want *mmdb.Reader", getLookupProvider())
+	}
+	t.Cleanup(func() { reader.Close() })
+	if !old.closed {
+		t.Error("the replaced provider was not closed")
+	}
+	if c.epoch == 0 || c.epoch != reader.BuildEpoch() {
+		t.Errorf("cache epoch = %d, want the new build epoch %d", c.epoch, reader.BuildEpoch())
+	}
+	if result, _, err := lookupIP(reader, netip.MustParseAddr("45.155.205.9")); err != nil || result.Score != 70 {
+		t.Errorf("lookup after reload = score %d, %v; want 70", result.Score, err)
+	}
+}
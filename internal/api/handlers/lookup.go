@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// liveLookupTimeout bounds the database queries of one live lookup
+const liveLookupTimeout = 5 * time.Second
+
+// LiveLookupEntry is one reputation row matching a live lookup
+type LiveLookupEntry struct {
+	Range      string                 `json:"range"`
+	Source     string                 `json:"source"`
+	SourceName *string                `json:"source_name,omitempty"`
+	ThreatType string                 `json:"threat_type"`
+	Confidence float64                `json:"confidence"`
+	Weight     int                    `json:"weight"`
+	FirstSeen  time.Time              `json:"first_seen"`
+	LastSeen   time.Time              `json:"last_seen"`
+	ExpiresAt  *time.Time             `json:"expires_at,omitempty"`
+	Score      int                    `json:"score"`              // This row's score on its own
+	Metadata   map[string]interface{} `json:"metadata,omitempty"` // Only with ?include_metadata=true
+}
+
+// LiveLookupResponse is the result of a live lookup. Live is always true and
+// DataSource is "database": the data comes straight from Postgres, not from
+// the compiled MMDB, so it may differ from /check until the next compile.
+type LiveLookupResponse struct {
+	IP          string            `json:"ip"`
+	Live        bool              `json:"live"`
+	DataSource  string            `json:"data_source"`
+	Whitelisted bool              `json:"whitelisted"`
+	Score       int               `json:"score"`
+	RiskLevel   string            `json:"risk_level"`
+	Entries     []LiveLookupEntry `json:"entries"`
+	QueryTime   float64           `json:"query_time_ms"`
+}
+
+// LiveLookup returns every active reputation row for an IP from Postgres,
+// scored at request time. It is slower than /check but reflects reports made
+// since the last MMDB compile and keeps per-source detail.
+// ?include_metadata=true adds each row's metadata.
+func LiveLookup() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		startTime := time.Now()
+
+		pg := getDatabase()
+		if pg == nil {
+			return databaseUnavailable(c)
+		}
+
+		addr, err := iputil.ParseIP(c.Params("ip"))
+		if err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidIP, "Invalid IP address format")
+		}
+		addr = iputil.NormalizeIP(addr)
+		if !isCheckable(addr) {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidIP, "IP address is not suitable for reputation check (private, loopback, etc.)")
+		}
+
+		ctx, cancel := context.WithTimeout(c.Context(), liveLookupTimeout)
+		defer cancel()
+
+		ip := addr.String()
+		entries, err := pg.LookupIP(ctx, ip, c.QueryBool("include_metadata"))
+		if err != nil {
+			logger.Error(fmt.Sprintf("Live lookup failed for %s: %v", ip, err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to query reputation data")
+		}
+
+		whitelisted, err := pg.IsWhitelisted(ctx, ip)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Whitelist check failed for %s: %v", ip, err), requestID(c))
+		}
+
+		result := liveLookupResponse(ip, entries, whitelisted, getScoringConfig(), time.Now())
+		result.QueryTime = float64(time.Since(startTime).Microseconds()) / 1000.0
+		return c.JSON(result)
+	}
+}
+
+// liveLookupResponse scores the rows of a live lookup. Whitelisted IPs score
+// zero, as they are left out of the compiled MMDB.
+func liveLookupResponse(ip string, entries []database.IPReputationEntry, whitelisted bool, cfg scoring.Config, now time.Time) LiveLookupResponse {
+	scorer := scoring.New(cfg)
+	result := LiveLookupResponse{
+		IP:          ip,
+		Live:        true,
+		DataSource:  "database",
+		Whitelisted: whitelisted,
+		Entries:     make([]LiveLookupEntry, 0, len(entries)),
+	}
+
+	threats := make([]models.Threat, 0, len(entries))
+	for _, e := range entries {
+		threat := entryThreat(e)
+		threats = append(threats, threat)
+
+		rng := e.IPStart
+		if e.CIDR != nil {
+			rng = *e.CIDR
+		} else if e.IPEnd != e.IPStart {
+			rng = e.IPStart + "-" + e.IPEnd
+		}
+		result.Entries = append(result.Entries, LiveLookupEntry{
+			Range:      rng,
+			Source:     e.Source,
+			SourceName: e.SourceName,
+			ThreatType: e.ThreatType,
+			Confidence: e.Confidence,
+			Weight:     e.Weight,
+			FirstSeen:  e.FirstSeen,
+			LastSeen:   e.LastSeen,
+			ExpiresAt:  e.ExpiresAt,
+			Score:      scorer.CalculateScore([]models.Threat{threat}, nil, now),
+			Metadata:   e.Metadata,
+		})
+	}
+
+	if len(threats) > 0 && !whitelisted {
+		result.Score = scorer.CalculateScore(threats, nil, now)
+	}
+	result.RiskLevel = cfg.RiskThresholds.Classify(result.Score)
+	return result
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+)
+
+func TestLiveLookupResponse(t *testing.T) {
+	now := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	cidr := "45.155.205.0/24"
+	entries := []database.IPReputationEntry{
+		{IPStart: "45.155.205.0", IPEnd: "45.155.205.255", CIDR: &cidr, Source: "spamhaus_drop", ThreatType: "hijacked",
+			Confidence: 1, Weight: 95, FirstSeen: now.Add(-48 * time.Hour), LastSeen: now},
+		{IPStart: "45.155.205.9", IPEnd: "45.155.205.9", Source: "manual", ThreatType: "attack",
+			Confidence: 0.8, Weight: 75, FirstSeen: now, LastSeen: now, Metadata: map[string]interface{}{"tags": []interface{}{"ssh"}}},
+	}
+
+	got := liveLookupResponse("45.155.205.9", entries, false, scoring.DefaultConfig(), now)
+	if !got.Live || got.DataSource != "database" {
+		t.Errorf("Live = %v, DataSource = %q; want the response marked live from the database", got.Live, got.DataSource)
+	}
+	if len(got.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got.Entries))
+	}
+	if got.Entries[0].Range != cidr || got.Entries[1].Range != "45.155.205.9" {
+		t.Errorf("ranges = %s, %s; want %s, 45.155.205.9", got.Entries[0].Range, got.Entries[1].Range, cidr)
+	}
+	for _, e := range got.Entries {
+		if e.Score <= 0 || e.Score > got.Score {
+			t.Errorf("entry %s score = %d, want between 1 and the combined score %d", e.Source, e.Score, got.Score)
+		}
+	}
+	if got.RiskLevel != "critical" {
+		t.Errorf("RiskLevel = %q (score %d), want critical", got.RiskLevel, got.Score)
+	}
+
+	whitelisted := liveLookupResponse("45.155.205.9", entries, true, scoring.DefaultConfig(), now)
+	if whitelisted.Score != 0 || whitelisted.RiskLevel != "clean" || len(whitelisted.Entries) != 2 {
+		t.Errorf("whitelisted = score %d, %s, %d entries; want 0, clean, rows still listed",
+			whitelisted.Score, whitelisted.RiskLevel, len(whitelisted.Entries))
+	}
+
+	empty := liveLookupResponse("203.0.113.7", nil, false, scoring.DefaultConfig(), now)
+	if empty.Score != 0 || empty.RiskLevel != "clean" || empty.Entries == nil {
+		t.Errorf("no rows = score %d, %s, entries %v; want 0, clean, empty list", empty.Score, empty.RiskLevel, empty.Entries)
+	}
+}
+
+func TestLiveLookupResponseOverlappingSources(t *testing.T) {
+	now := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	wide, narrow := "45.155.0.0/16", "45.155.205.0/24"
+	entries := []database.IPReputationEntry{
+		{IPStart: "45.155.205.0", IPEnd: "45.155.205.255", CIDR: &narrow, Source: "spamhaus_drop", ThreatType: "hijacked",
+			Confidence: 1, Weight: 95, FirstSeen: now.Add(-72 * time.Hour), LastSeen: now},
+		{IPStart: "45.155.205.0", IPEnd: "45.155.205.255", CIDR: &narrow, Source: "firehol_level1", ThreatType: "attack",
+			Confidence: 0.9, Weight: 80, FirstSeen: now.Add(-48 * time.Hour), LastSeen: now.Add(-time.Hour)},
+		{IPStart: "45.155.0.0", IPEnd: "45.155.255.255", CIDR: &wide, Source: "asn_blocklist", ThreatType: "datacenter",
+			Confidence: 0.6, Weight: 40, FirstSeen: now.Add(-240 * time.Hour), LastSeen: now.Add(-24 * time.Hour)},
+		{IPStart: "45.155.205.9", IPEnd: "45.155.205.9", Source: "abuseipdb", ThreatType: "spam",
+			Confidence: 0.7, Weight: 50, FirstSeen: now, LastSeen: now.Add(-2 * time.Hour)},
+		{IPStart: "45.155.205.1", IPEnd: "45.155.205.20", Source: "manual", ThreatType: "proxy",
+			Confidence: 0.8, Weight: 60, FirstSeen: now, LastSeen: now, Metadata: map[string]interface{}{"ticket": "SEC-42"}},
+	}
+
+	got := liveLookupResponse("45.155.205.9", entries, false, scoring.DefaultConfig(), now)
+	if len(got.Entries) != len(entries) {
+		t.Fatalf("got %d entries, want one per source row (%d)", len(got.Entries), len(entries))
+	}
+	for i, e := range got.Entries {
+		want := entries[i]
+		if e.Source != want.Source || e.Confidence != want.Confidence || !e.LastSeen.Equal(want.LastSeen) {
+			t.Errorf("entry %d = %s %.2f %v, want %s %.2f %v", i, e.Source, e.Confidence, e.LastSeen, want.Source, want.Confidence, want.LastSeen)
+		}
+	}
+	if got.Entries[4].Range != "45.155.205.1-45.155.205.20" {
+		t.Errorf("manual range = %q, want 45.155.205.1-45.155.205.20", got.Entries[4].Range)
+	}
+
+	// Rows read without metadata leave it out of the response
+	body, err := json.Marshal(got.Entries[0])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(body), "metadata") {
+		t.Errorf("entry without metadata = %s, want no metadata field", body)
+	}
+	if got.Entries[4].Metadata["ticket"] != "SEC-42" {
+		t.Errorf("manual metadata = %v, want ticket SEC-42", got.Entries[4].Metadata)
+	}
+}
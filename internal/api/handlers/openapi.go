@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// openAPISpec is the hand-maintained OpenAPI 3 description of the public API.
+// Keep it in step with the handlers and pkg/models when shapes change.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPISpec serves the OpenAPI document
+func OpenAPISpec() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		return c.Send(openAPISpec)
+	}
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the spec
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>BEON-IPQuality API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({ url: %q, dom_id: "#swagger-ui" });</script>
+</body>
+</html>
+`
+
+// SwaggerUI serves an interactive API explorer for the spec at specPath
+func SwaggerUI(specPath string) fiber.Handler {
+	page := fmt.Sprintf(swaggerUIPage, specPath)
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(page)
+	}
+}
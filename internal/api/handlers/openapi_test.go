@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/cache"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// TestOpenAPISchemasMatchModels keeps the hand-written spec in step with the
+// JSON shapes the handlers actually return
+func TestOpenAPISchemasMatchModels(t *testing.T) {
+	var spec struct {
+		Paths      map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	for _, path := range []string{"/api/v1/check/{ip}", "/api/v1/check", "/api/v1/check/batch", "/api/v1/stats", "/api/v1/cache/stats", "/api/v1/cache", "/api/v1/reload"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec is missing path %s", path)
+		}
+	}
+
+	shapes := map[string]interface{}{
+		"IPCheckResult":      models.IPCheckResult{},
+		"Threat":             models.Threat{},
+		"GeoInfo":            models.GeoInfo{},
+		"ASNInfo":            models.ASNInfo{},
+		"CheckRequest":       models.CheckRequest{},
+		"ScoreExplanation":   models.ScoreExplanation{},
+		"BatchCheckRequest":  models.BatchCheckRequest{},
+		"BatchCheckResponse": models.BatchCheckResponse{},
+		"APIStats":           models.APIStats{},
+		"HealthStatus":       models.HealthStatus{},
+		"CacheStats":         cache.CacheStats{},
+		"Error":              models.ErrorResponse{},
+	}
+
+	for name, model := range shapes {
+		schema, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Errorf("spec is missing schema %s", name)
+			continue
+		}
+
+		want := jsonFields(reflect.TypeOf(model))
+		for field := range want {
+			if _, ok := schema.Properties[field]; !ok {
+				t.Errorf("schema %s is missing property %q", name, field)
+			}
+		}
+		for field := range schema.Properties {
+			if !want[field] {
+				t.Errorf("schema %s documents %q, which the model does not have", name, field)
+			}
+		}
+	}
+}
+
+// jsonFields returns the JSON names of a struct's exported fields
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// ManualReportSource is the reserved source name for analyst-submitted reports
+const ManualReportSource = "manual"
+
+// ReportRequest is the body accepted by ReportIP
+type ReportRequest struct {
+	IP         string   `json:"ip"`
+	ThreatType string   `json:"threat_type"`
+	Confidence *float64 `json:"confidence"`
+	Source     string   `json:"source"` // Free-form label stored as source_name
+	TTL        string   `json:"ttl"`    // Optional lifetime, e.g. "72h"
+}
+
+// ReportIP stores an analyst-submitted IP report
+func ReportIP() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pg := getDatabase()
+		if pg == nil {
+			return databaseUnavailable(c)
+		}
+
+		var req ReportRequest
+		if err := c.BodyParser(&req); err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body")
+		}
+
+		entry, err := reportEntryFromRequest(req, time.Now())
+		if err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		}
+
+		if key := middleware.KeyInfo(c); key != nil {
+			reporter := fmt.Sprintf("api-key:%d", key.ID)
+			entry.IngestedBy = &reporter
+		}
+
+		if err := pg.InsertReputation(c.Context(), entry); err != nil {
+			logger.Error(fmt.Sprintf("Failed to store report for %s: %v", req.IP, err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to store report")
+		}
+
+		// entry now holds the stored row, merged with earlier reports of the IP
+		logger.Info(fmt.Sprintf("Manual report stored: %s as %s (id=%d)", entry.IPStart, entry.ThreatType, entry.ID), requestID(c))
+		return c.Status(fiber.StatusCreated).JSON(entry)
+	}
+}
+
+// reportEntryFromRequest validates a report and builds the reputation entry
+func reportEntryFromRequest(req ReportRequest, now time.Time) (*database.IPReputationEntry, error) {
+	addr, err := iputil.ParseIP(req.IP)
+	if err != nil {
+		return nil, fmt.Errorf("ip must be a valid IP address")
+	}
+	addr = iputil.NormalizeIP(addr)
+	if !isCheckable(addr) {
+		return nil, fmt.Errorf("ip is not suitable for reputation (private, loopback, etc.)")
+	}
+
+	threatType, ok := getScoringConfig().NormalizeThreatType(req.ThreatType)
+	if !ok {
+		return nil, fmt.Errorf("unknown threat_type %q", req.ThreatType)
+	}
+	weight := getScoringConfig().ThreatWeights[threatType]
+
+	confidence := 1.0
+	if req.Confidence != nil {
+		confidence = *req.Confidence
+		if confidence < 0 || confidence > 1 {
+			return nil, fmt.Errorf("confidence must be between 0 and 1")
+		}
+	}
+
+	entry := &database.IPReputationEntry{
+		IPStart:    addr.String(),
+		IPEnd:      addr.String(),
+		Source:     ManualReportSource,
+		ThreatType: threatType,
+		Confidence: confidence,
+		Weight:     weight,
+		FirstSeen:  now,
+		LastSeen:   now,
+	}
+
+	if req.Source != "" {
+		sourceName := req.Source
+		entry.SourceName = &sourceName
+	}
+
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("ttl must be a positive duration such as \"72h\"")
+		}
+		expiresAt := now.Add(ttl)
+		entry.ExpiresAt = &expiresAt
+	}
+
+	return entry, nil
+}
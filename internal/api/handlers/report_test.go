@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+)
+
+func TestReportEntryFromRequest(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	half := 0.5
+	tooHigh := 1.5
+
+	tests := []struct {
+		name           string
+		req            ReportRequest
+		wantErr        bool
+		wantConfidence float64
+		wantExpires    *time.Time
+	}{
+		{"minimal", ReportRequest{IP: "203.0.113.7", ThreatType: "attack"}, false, 1.0, nil},
+		{"with confidence", ReportRequest{IP: "203.0.113.7", ThreatType: "spam", Confidence: &half}, false, 0.5, nil},
+		{"with ttl", ReportRequest{IP: "203.0.113.7", ThreatType: "proxy", TTL: "72h"}, false, 1.0, timePtr(now.Add(72 * time.Hour))},
+		{"threat type alias", ReportRequest{IP: "203.0.113.7", ThreatType: "C2"}, false, 1.0, nil},
+		{"private IP", ReportRequest{IP: "10.0.0.1", ThreatType: "attack"}, true, 0, nil},
+		{"invalid IP", ReportRequest{IP: "nope", ThreatType: "attack"}, true, 0, nil},
+		{"unknown threat type", ReportRequest{IP: "203.0.113.7", ThreatType: "evil"}, true, 0, nil},
+		{"confidence out of range", ReportRequest{IP: "203.0.113.7", ThreatType: "attack", Confidence: &tooHigh}, true, 0, nil},
+		{"bad ttl", ReportRequest{IP: "203.0.113.7", ThreatType: "attack", TTL: "soon"}, true, 0, nil},
+		{"negative ttl", ReportRequest{IP: "203.0.113.7", ThreatType: "attack", TTL: "-1h"}, true, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := reportEntryFromRequest(tt.req, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reportEntryFromRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if entry.Source != ManualReportSource {
+				t.Errorf("Source = %q, want %q", entry.Source, ManualReportSource)
+			}
+			if entry.Confidence != tt.wantConfidence {
+				t.Errorf("Confidence = %v, want %v", entry.Confidence, tt.wantConfidence)
+			}
+			if entry.Weight == 0 {
+				t.Error("Weight not derived from threat type")
+			}
+			if (entry.ExpiresAt == nil) != (tt.wantExpires == nil) ||
+				(entry.ExpiresAt != nil && !entry.ExpiresAt.Equal(*tt.wantExpires)) {
+				t.Errorf("ExpiresAt = %v, want %v", entry.ExpiresAt, tt.wantExpires)
+			}
+		})
+	}
+}
+
+func TestReportEntryUsesConfiguredWeights(t *testing.T) {
+	cfg := scoring.DefaultConfig()
+	cfg.ThreatWeights["attack"] = 33
+	SetScoringConfig(cfg)
+	t.Cleanup(func() { SetScoringConfig(scoring.DefaultConfig()) })
+
+	entry, err := reportEntryFromRequest(ReportRequest{IP: "203.0.113.7", ThreatType: "attack"}, time.Now())
+	if err != nil {
+		t.Fatalf("reportEntryFromRequest() error = %v", err)
+	}
+	if entry.Weight != 33 {
+		t.Errorf("Weight = %d, want the configured 33", entry.Weight)
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
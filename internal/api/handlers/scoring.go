@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/breaker"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+var (
+	scoringConfig   = scoring.DefaultConfig()
+	scoringProfiles map[string]scoring.Config // By API key tier
+	scoringConfigMu sync.RWMutex
+)
+
+// SetScoringConfig sets the scoring configuration used by the API
+func SetScoringConfig(cfg scoring.Config) {
+	scoringConfigMu.Lock()
+	defer scoringConfigMu.Unlock()
+	scoringConfig = cfg
+}
+
+// getScoringConfig returns the current scoring configuration
+func getScoringConfig() scoring.Config {
+	scoringConfigMu.RLock()
+	defer scoringConfigMu.RUnlock()
+	return scoringConfig
+}
+
+// SetScoringProfiles sets the scoring configs that replace the base one for
+// checks by API keys of each tier
+func SetScoringProfiles(byTier map[string]scoring.Config) {
+	scoringConfigMu.Lock()
+	defer scoringConfigMu.Unlock()
+	scoringProfiles = byTier
+}
+
+// scoringProfileFor returns the scoring profile of the tier of the request's
+// API key, if it has one
+func scoringProfileFor(c *fiber.Ctx) (scoring.Config, bool) {
+	scoringConfigMu.RLock()
+	profiles := scoringProfiles
+	scoringConfigMu.RUnlock()
+
+	if len(profiles) == 0 {
+		return scoring.Config{}, false
+	}
+	key := middleware.KeyInfo(c)
+	if key == nil {
+		return scoring.Config{}, false
+	}
+	cfg, ok := profiles[key.Tier]
+	return cfg, ok
+}
+
+var errNoDatabase = errors.New("database not configured")
+
+// reputationRows returns the live reputation rows of IPs for profile
+// scoring; replaced in tests
+var reputationRows = func(ctx context.Context, ips []string) (map[string][]database.IPReputationEntry, error) {
+	db := getDatabase()
+	if db == nil {
+		return nil, errNoDatabase
+	}
+	return db.LookupIPs(ctx, ips, false)
+}
+
+const (
+	// profileLookupTimeout bounds the row query of profile scoring; a slower
+	// database costs the caller its profile, not latency
+	profileLookupTimeout = 250 * time.Millisecond
+	// profileRowsTTL is how long rows read for profile scoring are reused
+	profileRowsTTL = time.Minute
+	// profileRowsCacheSize bounds the IPs whose rows are cached
+	profileRowsCacheSize = 50000
+)
+
+var (
+	profileRows    = newProfileRowCache()
+	profileBreaker = breaker.New("postgres_profiles", 5, 30*time.Second)
+)
+
+type profileRowEntry struct {
+	rows    []database.IPReputationEntry
+	expires time.Time
+}
+
+// profileRowCache holds the rows of recently rescored IPs, so repeated
+// checks of an IP under a profile do not query Postgres each time
+type profileRowCache struct {
+	mu      sync.Mutex
+	entries map[string]profileRowEntry
+	now     func() time.Time
+}
+
+func newProfileRowCache() *profileRowCache {
+	return &profileRowCache{entries: make(map[string]profileRowEntry), now: time.Now}
+}
+
+// get returns the unexpired rows cached for ip
+func (c *profileRowCache) get(ip string) ([]database.IPReputationEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[ip]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, ip)
+		return nil, false
+	}
+	return entry.rows, true
+}
+
+// set caches rows for profileRowsTTL. When the cache is full, expired
+// entries are dropped first and the rows are not cached if none were.
+func (c *profileRowCache) set(ip string, rows []database.IPReputationEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, ok := c.entries[ip]; !ok && len(c.entries) >= profileRowsCacheSize {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= profileRowsCacheSize {
+			return
+		}
+	}
+	c.entries[ip] = profileRowEntry{rows: rows, expires: now.Add(profileRowsTTL)}
+}
+
+// applyCallerProfile rescores check results under the scoring profile of the
+// caller's tier, if it has one. Results are cached and alerted on under the
+// base config, so this runs on the way out.
+func applyCallerProfile(c *fiber.Ctx, results ...*models.IPCheckResult) {
+	cfg, ok := scoringProfileFor(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Context(), profileLookupTimeout)
+	defer cancel()
+	if err := applyScoringProfile(ctx, cfg, results, time.Now()); err != nil && !errors.Is(err, breaker.ErrOpen) {
+		logger.Warn(fmt.Sprintf("Scoring profile fell back to base scores: %v", err), requestID(c))
+	}
+}
+
+// applyScoringProfile rescores listed results under cfg. Compiled scores
+// follow the base config, so the scores are recalculated from the IPs' live
+// rows; rows not cached are read in one query. When the rows cannot be
+// read, the results keep their base scores and the error is returned.
+// Clean results stay clean.
+func applyScoringProfile(ctx context.Context, cfg scoring.Config, results []*models.IPCheckResult, now time.Time) error {
+	var listed []*models.IPCheckResult
+	rows := make(map[string][]database.IPReputationEntry)
+	var missing []string
+	for _, r := range results {
+		if r.Score <= 0 {
+			continue
+		}
+		listed = append(listed, r)
+		if cached, ok := profileRows.get(r.IP); ok {
+			rows[r.IP] = cached
+		} else {
+			missing = append(missing, r.IP)
+		}
+	}
+	if len(listed) == 0 {
+		return nil
+	}
+
+	if len(missing) > 0 {
+		if !profileBreaker.Allow() {
+			return breaker.ErrOpen
+		}
+		fetched, err := reputationRows(ctx, missing)
+		profileBreaker.Record(err)
+		if err != nil {
+			return err
+		}
+		for _, ip := range missing {
+			rows[ip] = fetched[ip]
+			profileRows.set(ip, fetched[ip])
+		}
+	}
+
+	scorer := scoring.New(cfg)
+	for _, r := range listed {
+		threats := make([]models.Threat, 0, len(rows[r.IP]))
+		for _, e := range rows[r.IP] {
+			threats = append(threats, entryThreat(e))
+		}
+		score := scorer.CalculateScore(threats, r.ASN, now)
+		if r.Explanation != nil {
+			// A fresh explanation: the base one may be shared with a queued alert
+			explanation := *r.Explanation
+			explanation.BaseScore = scorer.CalculateScore(threats, nil, now)
+			explanation.ASNAdjustment = score - explanation.BaseScore
+			r.Explanation = &explanation
+		}
+		setProfileScore(r, scorer, score)
+	}
+	return nil
+}
+
+// setProfileScore sets a result's score and its risk level under a profile
+func setProfileScore(r *models.IPCheckResult, scorer *scoring.Scorer, score int) {
+	r.Score = score
+	r.RiskScore = score
+	r.RiskLevel = scorer.ClassifyRisk(score)
+}
+
+// entryThreat is the threat a reputation row contributes to a score
+func entryThreat(e database.IPReputationEntry) models.Threat {
+	return models.Threat{
+		Type:       e.ThreatType,
+		ThreatType: e.ThreatType,
+		Source:     e.Source,
+		Confidence: e.Confidence,
+		Weight:     e.Weight,
+		LastSeen:   e.LastSeen,
+	}
+}
+
+// ScoringPreviewRequest holds proposed scoring overrides; omitted fields keep their current value
+type ScoringPreviewRequest struct {
+	ThreatWeights           map[string]int     `json:"threat_weights"`
+	ASNTypeModifiers        map[string]int     `json:"asn_type_modifiers"`
+	DecayLambda             *float64           `json:"decay_lambda"`
+	ThreatDecayLambdas      map[string]float64 `json:"threat_decay_lambdas"`
+	MaxAgeDays              *int               `json:"max_age_days"`
+	MinScore                *int               `json:"min_score"`
+	MaxScore                *int               `json:"max_score"`
+	MultiThreatMultiplier   *float64           `json:"multi_threat_multiplier"`
+	DatacenterMultiplier    *float64           `json:"datacenter_multiplier"`
+	HighConfidenceThreshold *float64           `json:"high_confidence_threshold"`
+	HighConfidenceBonus     *int               `json:"high_confidence_bonus"`
+
+	RiskThresholds   *models.RiskThresholds `json:"risk_thresholds"`
+	Curve            *string                `json:"curve"`
+	SaturationFactor *float64               `json:"saturation_factor"`
+}
+
+// apply returns base with the request's overrides applied
+func (r ScoringPreviewRequest) apply(base scoring.Config) scoring.Config {
+	cfg := base
+
+	cfg.ThreatWeights = make(map[string]int, len(base.ThreatWeights))
+	for k, v := range base.ThreatWeights {
+		cfg.ThreatWeights[k] = v
+	}
+	for k, v := range r.ThreatWeights {
+		cfg.ThreatWeights[k] = v
+	}
+
+	cfg.ASNTypeModifiers = make(map[string]int, len(base.ASNTypeModifiers))
+	for k, v := range base.ASNTypeModifiers {
+		cfg.ASNTypeModifiers[k] = v
+	}
+	for k, v := range r.ASNTypeModifiers {
+		cfg.ASNTypeModifiers[k] = v
+	}
+
+	cfg.ThreatDecayLambdas = make(map[string]float64, len(base.ThreatDecayLambdas))
+	for k, v := range base.ThreatDecayLambdas {
+		cfg.ThreatDecayLambdas[k] = v
+	}
+	for k, v := range r.ThreatDecayLambdas {
+		cfg.ThreatDecayLambdas[k] = v
+	}
+
+	if r.DecayLambda != nil {
+		cfg.DecayLambda = *r.DecayLambda
+	}
+	if r.MaxAgeDays != nil {
+		cfg.MaxAge = time.Duration(*r.MaxAgeDays) * 24 * time.Hour
+	}
+	if r.MinScore != nil {
+		cfg.MinScore = *r.MinScore
+	}
+	if r.MaxScore != nil {
+		cfg.MaxScore = *r.MaxScore
+	}
+	if r.MultiThreatMultiplier != nil {
+		cfg.MultiThreatMultiplier = *r.MultiThreatMultiplier
+	}
+	if r.DatacenterMultiplier != nil {
+		cfg.DatacenterMultiplier = *r.DatacenterMultiplier
+	}
+	if r.HighConfidenceThreshold != nil {
+		cfg.HighConfidenceThreshold = *r.HighConfidenceThreshold
+	}
+	if r.HighConfidenceBonus != nil {
+		cfg.HighConfidenceBonus = *r.HighConfidenceBonus
+	}
+	if r.RiskThresholds != nil {
+		cfg.RiskThresholds = *r.RiskThresholds
+	}
+	if r.Curve != nil {
+		cfg.Curve = *r.Curve
+	}
+	if r.SaturationFactor != nil {
+		cfg.SaturationFactor = *r.SaturationFactor
+	}
+
+	return cfg
+}
+
+// PreviewScoring validates a proposed scoring config and shows its effect on a sample set
+func PreviewScoring() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req ScoringPreviewRequest
+		if err := c.BodyParser(&req); err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body")
+		}
+
+		current := getScoringConfig()
+		proposed := req.apply(current)
+
+		if errs := proposed.Validate(); len(errs) > 0 {
+			return middleware.WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeInvalidConfig, "Scoring configuration is invalid", errs)
+		}
+
+		return c.JSON(fiber.Map{
+			"valid":   true,
+			"samples": scoring.Preview(current, proposed, time.Now()),
+		})
+	}
+}
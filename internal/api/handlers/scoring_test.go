@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/breaker"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestPreviewScoringRejectsInvalidConfig(t *testing.T) {
+	app := fiber.New()
+	app.Post("/preview", PreviewScoring())
+
+	body := `{"threat_weights": {"tor": -10, "phishing": 40}, "max_score": 0}`
+	req := httptest.NewRequest("POST", "/preview", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+
+	var out struct {
+		Code    string   `json:"code"`
+		Details []string `json:"details"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if out.Code != "invalid_config" {
+		t.Errorf("code = %q, want invalid_config", out.Code)
+	}
+
+	want := []string{
+		"threat_weights.phishing: unknown threat type",
+		"threat_weights.tor: must be between 0 and 100",
+		"max_score: must be greater than min_score",
+	}
+	joined := strings.Join(out.Details, "\n")
+	for _, w := range want {
+		if !strings.Contains(joined, w) {
+			t.Errorf("details = %v, want one containing %q", out.Details, w)
+		}
+	}
+}
+
+func TestPreviewScoringValidConfig(t *testing.T) {
+	app := fiber.New()
+	app.Post("/preview", PreviewScoring())
+
+	req := httptest.NewRequest("POST", "/preview", strings.NewReader(`{"threat_weights": {"tor": 90}}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	var out struct {
+		Valid   bool `json:"valid"`
+		Samples []struct {
+			Name  string `json:"name"`
+			Delta int    `json:"delta"`
+		} `json:"samples"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !out.Valid || len(out.Samples) == 0 {
+		t.Errorf("response = %+v, want valid with samples", out)
+	}
+}
+
+func TestCheckIPScoringProfiles(t *testing.T) {
+	useFakeProvider(t)
+
+	tiers := map[string]string{"free_key": "free", "bank_key": "enterprise", "analytics_key": "premium"}
+	middleware.SetKeyLookup(func(_ context.Context, hash string) (*models.APIKey, error) {
+		for key, tier := range tiers {
+			if middleware.HashAPIKey(key) == hash {
+				return &models.APIKey{Tier: tier}, nil
+			}
+		}
+		return nil, nil
+	})
+
+	strict := scoring.DefaultConfig()
+	strict.RiskThresholds = models.RiskThresholds{Low: 10, Medium: 20, High: 30, Critical: 40}
+	capped := scoring.DefaultConfig()
+	capped.MaxScore = 30
+	SetScoringProfiles(map[string]scoring.Config{"enterprise": strict, "premium": capped})
+
+	seen := time.Now()
+	rows := []database.IPReputationEntry{
+		{ThreatType: "proxy", Source: "proxy_list", Confidence: 0.9, Weight: 40, LastSeen: seen},
+		{ThreatType: "proxy", Source: "firehol_level2", Confidence: 0.8, Weight: 75, LastSeen: seen},
+	}
+	var rowsErr error
+	origRows := reputationRows
+	reputationRows = func(_ context.Context, ips []string) (map[string][]database.IPReputationEntry, error) {
+		if rowsErr != nil {
+			return nil, rowsErr
+		}
+		out := make(map[string][]database.IPReputationEntry)
+		for _, ip := range ips {
+			if ip == "45.155.205.9" {
+				out[ip] = rows
+			}
+		}
+		return out, nil
+	}
+	t.Cleanup(func() {
+		middleware.SetKeyLookup(nil)
+		SetScoringProfiles(nil)
+		reputationRows = origRows
+	})
+
+	threats := make([]models.Threat, 0, len(rows))
+	for _, e := range rows {
+		threats = append(threats, entryThreat(e))
+	}
+	strictScore := scoring.New(strict).CalculateScore(threats, nil, seen)
+	cappedScore := scoring.New(capped).CalculateScore(threats, nil, seen)
+	if strictScore == cappedScore {
+		t.Fatalf("profiles score the rows alike (%d), the test needs them to differ", strictScore)
+	}
+
+	app := fiber.New()
+	app.Get("/check/:ip", CheckIP())
+
+	tests := []struct {
+		name      string
+		key       string
+		rowsErr   error
+		ip        string
+		wantScore int
+		wantLevel string
+	}{
+		{name: "no API key", ip: "45.155.205.9", wantScore: 80, wantLevel: "high"},
+		{name: "tier without profile", key: "free_key", ip: "45.155.205.9", wantScore: 80, wantLevel: "high"},
+		{name: "unknown API key", key: "other_key", ip: "45.155.205.9", wantScore: 80, wantLevel: "high"},
+		{name: "strict profile", key: "bank_key", ip: "45.155.205.9", wantScore: strictScore, wantLevel: scoring.New(strict).ClassifyRisk(strictScore)},
+		{name: "capped profile", key: "analytics_key", ip: "45.155.205.9", wantScore: cappedScore, wantLevel: scoring.New(capped).ClassifyRisk(cappedScore)},
+		{name: "clean IP stays clean", key: "bank_key", ip: "8.8.8.8", wantScore: 0, wantLevel: "clean"},
+		{name: "rows unavailable", key: "bank_key", rowsErr: errors.New("connection refused"), ip: "45.155.205.9", wantScore: 80, wantLevel: "high"},
+		{name: "rows unavailable with lower cap", key: "analytics_key", rowsErr: errors.New("connection refused"), ip: "45.155.205.9", wantScore: 80, wantLevel: "high"},
+		{name: "cached result keeps base score", ip: "45.155.205.9", wantScore: 80, wantLevel: "high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetProfileRows(t)
+			rowsErr = tt.rowsErr
+			req := httptest.NewRequest("GET", "/check/"+tt.ip, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var got models.IPCheckResult
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.Score != tt.wantScore || got.RiskLevel != tt.wantLevel {
+				t.Errorf("result = score %d %q, want %d %q", got.Score, got.RiskLevel, tt.wantScore, tt.wantLevel)
+			}
+		})
+	}
+}
+
+// resetProfileRows empties the profile row cache and closes its breaker for
+// the rest of the test
+func resetProfileRows(t *testing.T) {
+	t.Helper()
+	origRows, origBreaker := profileRows, profileBreaker
+	profileRows = newProfileRowCache()
+	profileBreaker = breaker.New("test", 2, time.Minute)
+	t.Cleanup(func() {
+		profileRows, profileBreaker = origRows, origBreaker
+	})
+}
+
+func TestApplyScoringProfileCachesRows(t *testing.T) {
+	resetProfileRows(t)
+
+	var queried [][]string
+	var rowsErr error
+	origRows := reputationRows
+	reputationRows = func(_ context.Context, ips []string) (map[string][]database.IPReputationEntry, error) {
+		queried = append(queried, ips)
+		if rowsErr != nil {
+			return nil, rowsErr
+		}
+		return map[string][]database.IPReputationEntry{
+			ips[0]: {{ThreatType: "proxy", Source: "proxy_list", Confidence: 0.9, Weight: 40, LastSeen: time.Now()}},
+		}, nil
+	}
+	t.Cleanup(func() { reputationRows = origRows })
+
+	cfg := scoring.DefaultConfig()
+	check := func(ips ...string) ([]*models.IPCheckResult, error) {
+		results := make([]*models.IPCheckResult, len(ips))
+		for i, ip := range ips {
+			results[i] = &models.IPCheckResult{IP: ip, Score: 80, RiskScore: 80, RiskLevel: "high"}
+		}
+		return results, applyScoringProfile(context.Background(), cfg, results, time.Now())
+	}
+
+	if _, err := check("192.0.2.1", "192.0.2.2"); err != nil {
+		t.Fatalf("first check: %v", err)
+	}
+	if _, err := check("192.0.2.1", "192.0.2.2", "192.0.2.3"); err != nil {
+		t.Fatalf("second check: %v", err)
+	}
+	if len(queried) != 2 || len(queried[0]) != 2 || len(queried[1]) != 1 || queried[1][0] != "192.0.2.3" {
+		t.Errorf("queried %v, want both IPs once and then only 192.0.2.3", queried)
+	}
+
+	// Failures keep the base score and open the breaker, after which the
+	// database is not queried at all
+	rowsErr = errors.New("connection refused")
+	for i := 0; i < 3; i++ {
+		results, err := check("198.51.100.1")
+		if err == nil {
+			t.Fatalf("check %d: no error", i)
+		}
+		if results[0].Score != 80 || results[0].RiskLevel != "high" {
+			t.Errorf("check %d: result = score %d %q, want the base 80 \"high\"", i, results[0].Score, results[0].RiskLevel)
+		}
+		if i == 2 && !errors.Is(err, breaker.ErrOpen) {
+			t.Errorf("check %d: error = %v, want %v", i, err, breaker.ErrOpen)
+		}
+	}
+	if len(queried) != 4 {
+		t.Errorf("%d queries, want 4: the open breaker should skip the database", len(queried))
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// maxStatsPeriod matches the ClickHouse api_requests retention
+const maxStatsPeriod = 90 * 24 * time.Hour
+
+// requestStatsSource reports request statistics since a point in time
+type requestStatsSource interface {
+	RequestStats(ctx context.Context, since time.Time) (*models.APIStats, error)
+}
+
+var (
+	analyticsClient *analytics.Client
+	analyticsMu     sync.RWMutex
+)
+
+// SetAnalytics sets the ClickHouse client used for request statistics
+func SetAnalytics(client *analytics.Client) {
+	analyticsMu.Lock()
+	defer analyticsMu.Unlock()
+	analyticsClient = client
+}
+
+// getAnalytics returns the ClickHouse client, nil when analytics is disabled
+func getAnalytics() *analytics.Client {
+	analyticsMu.RLock()
+	defer analyticsMu.RUnlock()
+	return analyticsClient
+}
+
+// statsSource picks ClickHouse when analytics is enabled, Postgres otherwise
+func statsSource() (requestStatsSource, string) {
+	if ch := getAnalytics(); ch != nil {
+		return ch, "clickhouse"
+	}
+	if pg := getDatabase(); pg != nil {
+		return pg, "postgres"
+	}
+	return nil, ""
+}
+
+// parseStatsPeriod parses a period such as 30m, 24h or 7d
+func parseStatsPeriod(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid period %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid period %q", s)
+		}
+	}
+
+	if d <= 0 || d > maxStatsPeriod {
+		return 0, fmt.Errorf("period must be positive and at most 90d")
+	}
+	return d, nil
+}
+
+// GetStats returns API usage statistics over ?period= (default 24h)
+func GetStats() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		period := c.Query("period", "24h")
+		d, err := parseStatsPeriod(period)
+		if err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidPeriod, err.Error())
+		}
+
+		src, name := statsSource()
+		if src == nil {
+			return middleware.WriteError(c, fiber.StatusServiceUnavailable, models.ErrCodeServiceUnavailable, "Neither analytics nor the database is configured")
+		}
+
+		stats, err := src.RequestStats(c.Context(), time.Now().Add(-d))
+		if err != nil {
+			logger.Error(fmt.Sprintf("Stats query failed (%s): %v", name, err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to read statistics")
+		}
+
+		stats.Period = period
+		stats.Source = name
+		return c.JSON(stats)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseStatsPeriod(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"24h", 24 * time.Hour, false},
+		{"30m", 30 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"90d", 90 * 24 * time.Hour, false},
+		{"91d", 0, true},
+		{"0h", 0, true},
+		{"-1h", 0, true},
+		{"xd", 0, true},
+		{"week", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseStatsPeriod(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStatsPeriod(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseStatsPeriod(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetStatsWithoutSources(t *testing.T) {
+	SetAnalytics(nil)
+	SetDatabase(nil)
+
+	app := fiber.New()
+	app.Get("/stats", GetStats())
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", fiber.StatusServiceUnavailable},
+		{"?period=7d", fiber.StatusServiceUnavailable},
+		{"?period=1y", fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", "/stats"+tt.query, nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET /stats%s = %d, want %d", tt.query, resp.StatusCode, tt.want)
+		}
+	}
+}
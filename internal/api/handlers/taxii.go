@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/export"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+)
+
+// TAXIICollectionID identifies the single read-only reputation collection
+const TAXIICollectionID = "3f0c8a3e-6a1f-4c52-9d7e-5b3a2e9c1d40"
+
+const (
+	taxiiDefaultLimit = 1000
+	taxiiMaxLimit     = 10000
+)
+
+// taxiiError writes a TAXII 2.1 error message
+func taxiiError(c *fiber.Ctx, status int, title, description string) error {
+	return taxiiJSON(c.Status(status), fiber.Map{
+		"title":       title,
+		"description": description,
+		"http_status": strconv.Itoa(status),
+	})
+}
+
+// taxiiJSON writes a TAXII 2.1 resource
+func taxiiJSON(c *fiber.Ctx, body interface{}) error {
+	if err := c.JSON(body); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, export.STIXMediaType)
+	return nil
+}
+
+// TAXIIDiscovery serves the TAXII server discovery resource
+func TAXIIDiscovery(apiRoot string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return taxiiJSON(c, fiber.Map{
+			"title":     "BEON-IPQuality TAXII Server",
+			"default":   apiRoot,
+			"api_roots": []string{apiRoot},
+		})
+	}
+}
+
+// TAXIIAPIRoot serves the API root information resource
+func TAXIIAPIRoot() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return taxiiJSON(c, fiber.Map{
+			"title":              "BEON-IPQuality IP Reputation",
+			"versions":           []string{export.STIXMediaType},
+			"max_content_length": 100 * 1024 * 1024,
+		})
+	}
+}
+
+// taxiiCollection describes the reputation collection
+var taxiiCollection = fiber.Map{
+	"id":          TAXIICollectionID,
+	"title":       "IP Reputation Indicators",
+	"description": "STIX 2.1 indicators for IPs and networks flagged by BEON-IPQuality feeds",
+	"can_read":    true,
+	"can_write":   false,
+	"media_types": []string{"application/stix+json;version=2.1"},
+}
+
+// TAXIICollections lists the available collections
+func TAXIICollections() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return taxiiJSON(c, fiber.Map{"collections": []fiber.Map{taxiiCollection}})
+	}
+}
+
+// TAXIICollection serves a single collection resource
+func TAXIICollection() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Params("id") != TAXIICollectionID {
+			return taxiiError(c, fiber.StatusNotFound, "Collection not found", "Unknown collection ID")
+		}
+		return taxiiJSON(c, taxiiCollection)
+	}
+}
+
+// TAXIIObjects serves reputation entries as STIX indicators, oldest change
+// first. An entry's date added is its last_seen, so entries updated by a feed
+// reappear for added_after polls. Pages are chained with the opaque next cursor.
+func TAXIIObjects() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Params("id") != TAXIICollectionID {
+			return taxiiError(c, fiber.StatusNotFound, "Collection not found", "Unknown collection ID")
+		}
+
+		pg := getDatabase()
+		if pg == nil {
+			return taxiiError(c, fiber.StatusServiceUnavailable, "Database unavailable", "The reputation database is not connected")
+		}
+
+		limit := c.QueryInt("limit", taxiiDefaultLimit)
+		if limit <= 0 || limit > taxiiMaxLimit {
+			limit = taxiiMaxLimit
+		}
+
+		since, afterID, err := taxiiCursor(c.Query("added_after"), c.Query("next"))
+		if err != nil {
+			return taxiiError(c, fiber.StatusBadRequest, "Invalid request", err.Error())
+		}
+
+		entries, err := pg.ListReputationsSince(c.Context(), since, afterID, limit+1)
+		if err != nil {
+			logger.Error(fmt.Sprintf("TAXII objects query failed: %v", err), requestID(c))
+			return taxiiError(c, fiber.StatusInternalServerError, "Internal error", "Failed to read indicators")
+		}
+
+		more := len(entries) > limit
+		if more {
+			entries = entries[:limit]
+		}
+
+		objects := make([]export.Indicator, 0, len(entries))
+		for i := range entries {
+			ind, err := export.IndicatorFromEntry(&entries[i])
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Skipping entry %d in TAXII export: %v", entries[i].ID, err), requestID(c))
+				continue
+			}
+			objects = append(objects, ind)
+		}
+
+		body := fiber.Map{"more": more, "objects": objects}
+		if len(entries) > 0 {
+			first, last := entries[0], entries[len(entries)-1]
+			c.Set("X-TAXII-Date-Added-First", first.LastSeen.UTC().Format(time.RFC3339Nano))
+			c.Set("X-TAXII-Date-Added-Last", last.LastSeen.UTC().Format(time.RFC3339Nano))
+			if more {
+				body["next"] = encodeTAXIICursor(last.LastSeen, last.ID)
+			}
+		}
+
+		return taxiiJSON(c, body)
+	}
+}
+
+// taxiiCursor resolves the (last_seen, id) position to continue from. A next
+// cursor takes precedence over added_after.
+func taxiiCursor(addedAfter, next string) (time.Time, int64, error) {
+	if next != "" {
+		return decodeTAXIICursor(next)
+	}
+	if addedAfter != "" {
+		t, err := time.Parse(time.RFC3339Nano, addedAfter)
+		if err != nil {
+			return time.Time{}, 0, fmt.Errorf("added_after must be an RFC 3339 timestamp")
+		}
+		// Strictly after: skip every id at exactly this timestamp
+		return t, math.MaxInt64, nil
+	}
+	return time.Unix(0, 0), 0, nil
+}
+
+// encodeTAXIICursor encodes a page position as an opaque token
+func encodeTAXIICursor(lastSeen time.Time, id int64) string {
+	raw := fmt.Sprintf("%d:%d", lastSeen.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeTAXIICursor reverses encodeTAXIICursor
+func decodeTAXIICursor(token string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid next cursor")
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid next cursor")
+	}
+	n, err1 := strconv.ParseInt(nanos, 10, 64)
+	i, err2 := strconv.ParseInt(id, 10, 64)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid next cursor")
+	}
+	return time.Unix(0, n), i, nil
+}
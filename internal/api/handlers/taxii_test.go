@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTAXIICursor(t *testing.T) {
+	seen := time.Date(2024, 3, 1, 10, 0, 0, 123456000, time.UTC)
+
+	token := encodeTAXIICursor(seen, 42)
+	gotTime, gotID, err := taxiiCursor("2020-01-01T00:00:00Z", token)
+	if err != nil {
+		t.Fatalf("taxiiCursor(next): %v", err)
+	}
+	if !gotTime.Equal(seen) || gotID != 42 {
+		t.Errorf("next cursor = (%v, %d), want (%v, 42)", gotTime, gotID, seen)
+	}
+
+	gotTime, gotID, err = taxiiCursor("2024-03-01T10:00:00Z", "")
+	if err != nil {
+		t.Fatalf("taxiiCursor(added_after): %v", err)
+	}
+	if !gotTime.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)) || gotID != math.MaxInt64 {
+		t.Errorf("added_after cursor = (%v, %d), want strictly after the timestamp", gotTime, gotID)
+	}
+
+	for _, bad := range [][2]string{{"yesterday", ""}, {"", "not-base64!"}, {"", encodeBad("12:abc")}} {
+		if _, _, err := taxiiCursor(bad[0], bad[1]); err == nil {
+			t.Errorf("taxiiCursor(%q, %q) error = nil, want error", bad[0], bad[1])
+		}
+	}
+}
+
+func encodeBad(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// WhitelistRequest is the body accepted by AddWhitelist
+type WhitelistRequest struct {
+	IP          string     `json:"ip"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Permanent   bool       `json:"permanent"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// whitelistSource marks entries created through the API
+const whitelistSource = "api"
+
+// ListWhitelist returns all whitelist entries
+func ListWhitelist() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pg := getDatabase()
+		if pg == nil {
+			return databaseUnavailable(c)
+		}
+
+		entries, err := pg.ListWhitelist(c.Context())
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to list whitelist: %v", err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to list whitelist")
+		}
+
+		return c.JSON(fiber.Map{
+			"entries": entries,
+			"count":   len(entries),
+		})
+	}
+}
+
+// AddWhitelist adds an IP or CIDR to the whitelist; prefixes broader than
+// minPrefixV4 or minPrefixV6 bits are rejected
+func AddWhitelist(minPrefixV4, minPrefixV6 int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pg := getDatabase()
+		if pg == nil {
+			return databaseUnavailable(c)
+		}
+
+		var req WhitelistRequest
+		if err := c.BodyParser(&req); err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body")
+		}
+
+		entry, err := whitelistEntryFromRequest(req, time.Now(), minPrefixV4, minPrefixV6)
+		if err != nil {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		}
+
+		if err := pg.AddWhitelist(c.Context(), entry); err != nil {
+			logger.Error(fmt.Sprintf("Failed to add whitelist entry %s: %v", req.IP, err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to add whitelist entry")
+		}
+
+		logger.Info(fmt.Sprintf("Whitelisted %s-%s (id=%d)", entry.IPStart, entry.IPEnd, entry.ID), requestID(c))
+		return c.Status(fiber.StatusCreated).JSON(entry)
+	}
+}
+
+// RemoveWhitelist deletes a whitelist entry by ID
+func RemoveWhitelist() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		pg := getDatabase()
+		if pg == nil {
+			return databaseUnavailable(c)
+		}
+
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil || id <= 0 {
+			return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "Whitelist entry ID must be a positive integer")
+		}
+
+		removed, err := pg.RemoveWhitelist(c.Context(), id)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to remove whitelist entry %d: %v", id, err), requestID(c))
+			return middleware.WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Failed to remove whitelist entry")
+		}
+		if !removed {
+			return middleware.WriteError(c, fiber.StatusNotFound, models.ErrCodeNotFound, "Whitelist entry not found")
+		}
+
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": "Whitelist entry removed",
+		})
+	}
+}
+
+// whitelistEntryFromRequest validates a request and computes its address range
+func whitelistEntryFromRequest(req WhitelistRequest, now time.Time, minPrefixV4, minPrefixV6 int) (*database.WhitelistEntry, error) {
+	addr, prefix, isPrefix, err := iputil.ParseIPOrPrefix(req.IP)
+	if err != nil {
+		return nil, fmt.Errorf("ip must be a valid IP address or CIDR")
+	}
+
+	// Whitelisted ranges are left out of the compiled MMDB
+	if isPrefix {
+		minBits := minPrefixV4
+		if !prefix.Addr().Is4() {
+			minBits = minPrefixV6
+		}
+		if prefix.Bits() < minBits {
+			return nil, fmt.Errorf("ip must not be broader than /%d", minBits)
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	entry := &database.WhitelistEntry{
+		Name:        req.Name,
+		Description: req.Description,
+		Source:      whitelistSource,
+		Permanent:   req.Permanent,
+		ExpiresAt:   req.ExpiresAt,
+	}
+
+	if req.Permanent {
+		entry.ExpiresAt = nil
+	}
+
+	if isPrefix {
+		prefix = prefix.Masked()
+		cidr := prefix.String()
+		entry.CIDR = &cidr
+		entry.IPStart = prefix.Addr().String()
+		entry.IPEnd = iputil.GetLastAddress(prefix).String()
+	} else {
+		addr = iputil.NormalizeIP(addr)
+		entry.IPStart = addr.String()
+		entry.IPEnd = addr.String()
+	}
+
+	return entry, nil
+}
+
+// databaseUnavailable responds when no database connection is configured
+func databaseUnavailable(c *fiber.Ctx) error {
+	return middleware.WriteError(c, fiber.StatusServiceUnavailable, models.ErrCodeServiceUnavailable, "Database is not connected")
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWhitelistEntryFromRequest(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	future := now.Add(24 * time.Hour)
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		req       WhitelistRequest
+		wantStart string
+		wantEnd   string
+		wantCIDR  string
+		wantErr   bool
+	}{
+		{"single IPv4", WhitelistRequest{IP: "203.0.113.7"}, "203.0.113.7", "203.0.113.7", "", false},
+		{"IPv4 CIDR", WhitelistRequest{IP: "203.0.113.0/24"}, "203.0.113.0", "203.0.113.255", "203.0.113.0/24", false},
+		{"unmasked CIDR", WhitelistRequest{IP: "203.0.113.9/28"}, "203.0.113.0", "203.0.113.15", "203.0.113.0/28", false},
+		{"IPv6 CIDR", WhitelistRequest{IP: "2001:db8::/120"}, "2001:db8::", "2001:db8::ff", "2001:db8::/120", false},
+		{"future expiry", WhitelistRequest{IP: "203.0.113.7", ExpiresAt: &future}, "203.0.113.7", "203.0.113.7", "", false},
+		{"past expiry", WhitelistRequest{IP: "203.0.113.7", ExpiresAt: &past}, "", "", "", true},
+		{"IPv4 prefix at the limit", WhitelistRequest{IP: "10.0.0.0/8"}, "10.0.0.0", "10.255.255.255", "10.0.0.0/8", false},
+		{"IPv4 prefix too broad", WhitelistRequest{IP: "10.0.0.0/7"}, "", "", "", true},
+		{"all IPv4", WhitelistRequest{IP: "0.0.0.0/0"}, "", "", "", true},
+		{"IPv6 prefix too broad", WhitelistRequest{IP: "2001:db8::/31"}, "", "", "", true},
+		{"all IPv6", WhitelistRequest{IP: "::/0"}, "", "", "", true},
+		{"invalid IP", WhitelistRequest{IP: "not-an-ip"}, "", "", "", true},
+		{"empty IP", WhitelistRequest{}, "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := whitelistEntryFromRequest(tt.req, now, 8, 32)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("whitelistEntryFromRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if entry.IPStart != tt.wantStart || entry.IPEnd != tt.wantEnd {
+				t.Errorf("range = %s-%s, want %s-%s", entry.IPStart, entry.IPEnd, tt.wantStart, tt.wantEnd)
+			}
+
+			gotCIDR := ""
+			if entry.CIDR != nil {
+				gotCIDR = *entry.CIDR
+			}
+			if gotCIDR != tt.wantCIDR {
+				t.Errorf("cidr = %q, want %q", gotCIDR, tt.wantCIDR)
+			}
+		})
+	}
+}
+
+func TestWhitelistEntryPermanentClearsExpiry(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(time.Hour)
+
+	entry, err := whitelistEntryFromRequest(WhitelistRequest{IP: "203.0.113.7", Permanent: true, ExpiresAt: &expires}, now, 8, 32)
+	if err != nil {
+		t.Fatalf("whitelistEntryFromRequest() error = %v", err)
+	}
+	if !entry.Permanent || entry.ExpiresAt != nil {
+		t.Errorf("permanent entry = %+v, want permanent with no expiry", entry)
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientIPResolver finds the address of the client behind trusted reverse
+// proxies. The proxy header is only read when the connection comes from a
+// trusted proxy, so clients connecting directly cannot choose their IP.
+//
+// Fiber's ProxyHeader is not used: it takes the leftmost X-Forwarded-For
+// entry, which is whatever the client sent before the first proxy appended
+// to it.
+type ClientIPResolver struct {
+	header  string
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver trusts header ("X-Forwarded-For" or "X-Real-IP") on
+// requests from the given proxy addresses and CIDRs
+func NewClientIPResolver(header string, trustedProxies []string) (*ClientIPResolver, error) {
+	switch {
+	case strings.EqualFold(header, fiber.HeaderXForwardedFor):
+		header = fiber.HeaderXForwardedFor
+	case strings.EqualFold(header, "X-Real-IP"):
+		header = "X-Real-IP"
+	default:
+		return nil, fmt.Errorf("unsupported proxy header %q", header)
+	}
+
+	r := &ClientIPResolver{header: header}
+	for _, s := range trustedProxies {
+		prefix, err := ParseTrustedProxy(s)
+		if err != nil {
+			return nil, err
+		}
+		r.trusted = append(r.trusted, prefix)
+	}
+	return r, nil
+}
+
+// ParseTrustedProxy parses a trusted proxy given as an address or a CIDR
+func ParseTrustedProxy(s string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: want an IP address or CIDR", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Resolve returns the client IP of the request. From an untrusted peer that
+// is the peer itself. From a trusted proxy it is the X-Real-IP value, or the
+// rightmost X-Forwarded-For entry that is not a trusted proxy; addresses to
+// the left of it were supplied by the client and are ignored.
+func (r *ClientIPResolver) Resolve(c *fiber.Ctx) string {
+	peer, ok := netip.AddrFromSlice(c.Context().RemoteIP())
+	if !ok {
+		return strings.Clone(c.IP())
+	}
+	peer = peer.Unmap()
+	if !r.isTrusted(peer) {
+		return peer.String()
+	}
+
+	client := peer
+	if r.header == "X-Real-IP" {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(c.Get(r.header))); err == nil {
+			client = addr.Unmap()
+		}
+		return client.String()
+	}
+
+	// Proxies may add their own header line instead of appending to the
+	// client's, so read every line, in order
+	var hops []string
+	for _, line := range c.Request().Header.PeekAll(r.header) {
+		hops = append(hops, strings.Split(string(line), ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // Keep the last hop a trusted proxy vouched for
+		}
+		client = addr.Unmap()
+		if !r.isTrusted(client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (r *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	clientIPResolver   *ClientIPResolver
+	clientIPResolverMu sync.RWMutex
+)
+
+// SetClientIPResolver sets the resolver ClientIP uses; nil (the default)
+// makes ClientIP return the connection's peer address
+func SetClientIPResolver(r *ClientIPResolver) {
+	clientIPResolverMu.Lock()
+	defer clientIPResolverMu.Unlock()
+	clientIPResolver = r
+}
+
+// ClientIP returns the client IP of the request as resolved by the
+// configured ClientIPResolver. Unlike c.IP() the result does not alias
+// request memory, so it may outlive the handler.
+func ClientIP(c *fiber.Ctx) string {
+	clientIPResolverMu.RLock()
+	r := clientIPResolver
+	clientIPResolverMu.RUnlock()
+
+	if r == nil {
+		return strings.Clone(c.IP())
+	}
+	return r.Resolve(c)
+}
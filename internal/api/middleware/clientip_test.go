@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// withPeer runs fn on a Fiber context for a request from peer with the given
+// header lines
+func withPeer(t *testing.T, peer string, header string, values []string, fn func(c *fiber.Ctx)) {
+	t.Helper()
+
+	var req fasthttp.Request
+	req.SetRequestURI("/check/8.8.8.8")
+	for _, v := range values {
+		req.Header.Add(header, v)
+	}
+	var fctx fasthttp.RequestCtx
+	fctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(peer), Port: 40000}, nil)
+
+	app := fiber.New()
+	c := app.AcquireCtx(&fctx)
+	defer app.ReleaseCtx(c)
+	fn(c)
+}
+
+func TestClientIPResolver(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "2001:db8:1b::/48", "192.0.2.1"}
+
+	tests := []struct {
+		name   string
+		header string
+		peer   string
+		values []string
+		want   string
+	}{
+		{"untrusted peer spoofing the header", "X-Forwarded-For", "198.51.100.20", []string{"203.0.113.7"}, "198.51.100.20"},
+		{"trusted proxy", "X-Forwarded-For", "10.1.2.3", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"trusted single address", "X-Forwarded-For", "192.0.2.1", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"client-supplied entries are ignored", "X-Forwarded-For", "10.1.2.3", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"chain of trusted proxies", "X-Forwarded-For", "10.1.2.3", []string{"1.2.3.4, 203.0.113.7, 10.9.9.9"}, "203.0.113.7"},
+		{"only trusted hops", "X-Forwarded-For", "10.1.2.3", []string{"10.0.0.9, 10.0.0.5"}, "10.0.0.9"},
+		{"garbage stops the walk", "X-Forwarded-For", "10.1.2.3", []string{"nonsense, 10.0.0.5"}, "10.0.0.5"},
+		{"separate header lines", "X-Forwarded-For", "10.1.2.3", []string{"1.2.3.4", "203.0.113.7"}, "203.0.113.7"},
+		{"no header", "X-Forwarded-For", "10.1.2.3", nil, "10.1.2.3"},
+		{"IPv6 proxy", "X-Forwarded-For", "2001:db8:1b::10", []string{"2001:db8:beef::1"}, "2001:db8:beef::1"},
+		{"IPv4-mapped entry", "X-Forwarded-For", "10.1.2.3", []string{"::ffff:203.0.113.7"}, "203.0.113.7"},
+		{"X-Real-IP from a trusted proxy", "X-Real-IP", "10.1.2.3", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"X-Real-IP from an untrusted peer", "X-Real-IP", "198.51.100.20", []string{"203.0.113.7"}, "198.51.100.20"},
+		{"invalid X-Real-IP", "X-Real-IP", "10.1.2.3", []string{"203.0.113"}, "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewClientIPResolver(tt.header, trusted)
+			if err != nil {
+				t.Fatalf("NewClientIPResolver() error = %v", err)
+			}
+			withPeer(t, tt.peer, tt.header, tt.values, func(c *fiber.Ctx) {
+				if got := r.Resolve(c); got != tt.want {
+					t.Errorf("Resolve() = %s, want %s", got, tt.want)
+				}
+			})
+		})
+	}
+}
+
+func TestClientIPResolverHeaderMismatch(t *testing.T) {
+	// A proxy that sets X-Real-IP does not make X-Forwarded-For trustworthy
+	r, err := NewClientIPResolver("x-real-ip", []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver() error = %v", err)
+	}
+	withPeer(t, "10.1.2.3", "X-Forwarded-For", []string{"203.0.113.7"}, func(c *fiber.Ctx) {
+		if got := r.Resolve(c); got != "10.1.2.3" {
+			t.Errorf("Resolve() = %s, want the peer 10.1.2.3", got)
+		}
+	})
+}
+
+func TestNewClientIPResolverErrors(t *testing.T) {
+	if _, err := NewClientIPResolver("Forwarded", nil); err == nil {
+		t.Error("NewClientIPResolver(Forwarded) succeeded, want an unsupported header error")
+	}
+	if _, err := NewClientIPResolver("X-Forwarded-For", []string{"10.0.0.0/33"}); err == nil {
+		t.Error("NewClientIPResolver with 10.0.0.0/33 succeeded, want an invalid proxy error")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	t.Cleanup(func() { SetClientIPResolver(nil) })
+
+	// Without a resolver the header is never consulted
+	withPeer(t, "10.1.2.3", "X-Forwarded-For", []string{"203.0.113.7"}, func(c *fiber.Ctx) {
+		if got := ClientIP(c); got != "10.1.2.3" {
+			t.Errorf("ClientIP() without a resolver = %s, want 10.1.2.3", got)
+		}
+	})
+
+	r, err := NewClientIPResolver("X-Forwarded-For", []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver() error = %v", err)
+	}
+	SetClientIPResolver(r)
+	withPeer(t, "10.1.2.3", "X-Forwarded-For", []string{"203.0.113.7"}, func(c *fiber.Ctx) {
+		if got := ClientIP(c); got != "203.0.113.7" {
+			t.Errorf("ClientIP() = %s, want 203.0.113.7", got)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// keyCacheSize bounds the key hashes a CachedKeyLookup holds
+const keyCacheSize = 10000
+
+type cachedKey struct {
+	key     *models.APIKey
+	expires time.Time
+}
+
+// keyCache holds looked up API keys until they expire
+type keyCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedKey
+	now     func() time.Time
+}
+
+// get returns the unexpired key cached for hash
+func (c *keyCache) get(hash string) (*models.APIKey, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, hash)
+		return nil, false
+	}
+	return entry.key, true
+}
+
+// set caches key for ttl. When the cache is full, expired entries are
+// dropped first and the key is not cached if none were.
+func (c *keyCache) set(hash string, key *models.APIKey, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, ok := c.entries[hash]; !ok && len(c.entries) >= keyCacheSize {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= keyCacheSize {
+			return
+		}
+	}
+	c.entries[hash] = cachedKey{key: key, expires: now.Add(ttl)}
+}
+
+// CachedKeyLookup wraps fn so each key hash is looked up at most once per
+// ttl. Unknown keys are cached too; failed lookups are not. A ttl of zero
+// returns fn unchanged.
+func CachedKeyLookup(fn KeyLookup, ttl time.Duration) KeyLookup {
+	if ttl <= 0 {
+		return fn
+	}
+	cache := &keyCache{entries: make(map[string]cachedKey), now: time.Now}
+	return cache.lookup(fn, ttl)
+}
+
+// lookup returns a KeyLookup that serves from the cache before calling fn
+func (c *keyCache) lookup(fn KeyLookup, ttl time.Duration) KeyLookup {
+	return func(ctx context.Context, keyHash string) (*models.APIKey, error) {
+		if key, ok := c.get(keyHash); ok {
+			return key, nil
+		}
+		key, err := fn(ctx, keyHash)
+		if err != nil {
+			return nil, err
+		}
+		c.set(keyHash, key, ttl)
+		return key, nil
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestCachedKeyLookup(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := &keyCache{entries: make(map[string]cachedKey), now: func() time.Time { return now }}
+
+	calls := 0
+	var failing bool
+	lookup := cache.lookup(func(_ context.Context, hash string) (*models.APIKey, error) {
+		calls++
+		if failing {
+			return nil, errors.New("db down")
+		}
+		if hash == "known" {
+			return &models.APIKey{ID: 1, Tier: "premium"}, nil
+		}
+		return nil, nil
+	}, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		key, err := lookup(context.Background(), "known")
+		if err != nil || key == nil || key.Tier != "premium" {
+			t.Fatalf("lookup(known) = %v, %v", key, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("known key looked up %d times, want 1", calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		if key, err := lookup(context.Background(), "unknown"); key != nil || err != nil {
+			t.Fatalf("lookup(unknown) = %v, %v", key, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("unknown key not cached: %d lookups, want 2", calls)
+	}
+
+	failing = true
+	for i := 0; i < 2; i++ {
+		if _, err := lookup(context.Background(), "other"); err == nil {
+			t.Fatal("lookup error not returned")
+		}
+	}
+	if calls != 4 {
+		t.Errorf("failed lookup cached: %d lookups, want 4", calls)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := lookup(context.Background(), "known"); err == nil {
+		t.Error("expired key served from cache")
+	}
+}
+
+func TestCachedKeyLookupDisabled(t *testing.T) {
+	calls := 0
+	lookup := CachedKeyLookup(func(context.Context, string) (*models.APIKey, error) {
+		calls++
+		return nil, nil
+	}, 0)
+
+	lookup(context.Background(), "a")
+	lookup(context.Background(), "a")
+	if calls != 2 {
+		t.Errorf("ttl 0: %d lookups, want 2", calls)
+	}
+}
@@ -1,9 +1,48 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// KeyLookup resolves an API key hash to its stored record (nil when not found)
+type KeyLookup func(ctx context.Context, keyHash string) (*models.APIKey, error)
+
+var (
+	keyLookup   KeyLookup
+	keyLookupMu sync.RWMutex
 )
 
+// SetKeyLookup sets the function used to resolve API keys for tier checks
+func SetKeyLookup(fn KeyLookup) {
+	keyLookupMu.Lock()
+	defer keyLookupMu.Unlock()
+	keyLookup = fn
+}
+
+// getKeyLookup returns the current key lookup function
+func getKeyLookup() KeyLookup {
+	keyLookupMu.RLock()
+	defer keyLookupMu.RUnlock()
+	return keyLookup
+}
+
+// HashAPIKey returns the SHA-256 hex digest stored in api_keys.key_hash
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
 // APIKeyAuth middleware validates API keys
 func APIKeyAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -15,20 +54,14 @@ func APIKeyAuth() fiber.Handler {
 		}
 
 		if apiKey == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "missing_api_key",
-				"message": "API key is required. Include X-API-Key header.",
-			})
+			return WriteError(c, fiber.StatusUnauthorized, models.ErrCodeMissingAPIKey, "API key is required. Include X-API-Key header.")
 		}
 
 		// TODO: Validate API key against database
 		// For now, accept any non-empty key
 		valid := validateAPIKey(apiKey)
 		if !valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "invalid_api_key",
-				"message": "The provided API key is invalid or expired.",
-			})
+			return WriteError(c, fiber.StatusUnauthorized, models.ErrCodeInvalidAPIKey, "The provided API key is invalid or expired.")
 		}
 
 		// Store API key info in context for later use
@@ -55,6 +88,110 @@ func validateAPIKey(key string) bool {
 	return true
 }
 
+// RequireTier allows the request only if its X-API-Key exists in the database
+// with one of the given tiers. The resolved key is stored in Locals("api_key_info").
+func RequireTier(tiers ...string) fiber.Handler {
+	allowed := make(map[string]bool, len(tiers))
+	for _, tier := range tiers {
+		allowed[tier] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		apiKey := c.Get("X-API-Key")
+		if apiKey == "" {
+			return WriteError(c, fiber.StatusUnauthorized, models.ErrCodeMissingAPIKey, "API key is required. Include X-API-Key header.")
+		}
+
+		lookup := getKeyLookup()
+		if lookup == nil {
+			return WriteError(c, fiber.StatusServiceUnavailable, models.ErrCodeServiceUnavailable, "API key verification is not available")
+		}
+
+		key, err := lookup(c.Context(), HashAPIKey(apiKey))
+		if err != nil {
+			logger.Error(fmt.Sprintf("API key lookup failed: %v", err), logger.RequestID(GetRequestID(c)))
+			return WriteError(c, fiber.StatusServiceUnavailable, models.ErrCodeServiceUnavailable, "API key verification is not available")
+		}
+		if key == nil {
+			return WriteError(c, fiber.StatusUnauthorized, models.ErrCodeInvalidAPIKey, "The provided API key is invalid or expired.")
+		}
+
+		if !allowed[key.Tier] {
+			return WriteError(c, fiber.StatusForbidden, models.ErrCodeInsufficientTier, "This endpoint is not available for your API key tier.")
+		}
+
+		c.Locals("api_key", apiKey)
+		c.Locals("api_key_info", key)
+
+		return c.Next()
+	}
+}
+
+// KeyInfo returns the database record of the request's X-API-Key, as
+// RequireTier stores it in Locals("api_key_info"). On routes without
+// RequireTier the key is looked up on first use and stored the same way.
+// It returns nil when there is no key or key lookup, or the key is unknown.
+func KeyInfo(c *fiber.Ctx) *models.APIKey {
+	if key, ok := c.Locals("api_key_info").(*models.APIKey); ok {
+		return key
+	}
+
+	apiKey := c.Get("X-API-Key")
+	lookup := getKeyLookup()
+	if apiKey == "" || lookup == nil {
+		return nil
+	}
+	key, err := lookup(c.Context(), HashAPIKey(apiKey))
+	if err != nil {
+		logger.Warn(fmt.Sprintf("API key lookup failed: %v", err), logger.RequestID(GetRequestID(c)))
+		return nil
+	}
+	// An unknown key is stored too, so it is not looked up again
+	c.Locals("api_key_info", key)
+	return key
+}
+
+// requestIDKey is the Locals key holding the request ID
+const requestIDKey = "request_id"
+
+// maxRequestIDLength caps caller-supplied request IDs
+const maxRequestIDLength = 128
+
+// RequestID reads X-Request-ID or generates a UUID when it is absent or
+// unusable, stores it for handlers and echoes it in the response
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Locals(requestIDKey, id)
+		c.Set(fiber.HeaderXRequestID, id)
+		return c.Next()
+	}
+}
+
+// GetRequestID returns the request ID set by RequestID ("" if none)
+func GetRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestIDKey).(string)
+	return id
+}
+
+// validRequestID accepts short printable ASCII IDs, so callers cannot inject
+// newlines or oversized values into logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
 // RateLimitByAPIKey applies rate limiting based on API key tier
 func RateLimitByAPIKey() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -75,3 +212,50 @@ func RequestLogger() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// WriteError responds with a models.ErrorResponse and the given status
+func WriteError(c *fiber.Ctx, status int, code models.ErrorCode, message string) error {
+	return WriteErrorDetails(c, status, code, message, nil)
+}
+
+// WriteErrorDetails responds with a models.ErrorResponse carrying details
+func WriteErrorDetails(c *fiber.Ctx, status int, code models.ErrorCode, message string, details interface{}) error {
+	return c.Status(status).JSON(models.ErrorResponse{
+		Code:    code,
+		Message: message,
+		Details: details,
+	})
+}
+
+// ErrorHandler is the Fiber error handler of the API and judge nodes. Errors
+// returned to Fiber (unknown methods, oversized bodies, recovered panics) are
+// rendered as a models.ErrorResponse like every handler error.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return WriteError(c, fe.Code, errorCodeForStatus(fe.Code), fe.Message)
+	}
+
+	logger.Error(fmt.Sprintf("Unhandled error on %s %s: %v", c.Method(), c.Path(), err), logger.RequestID(GetRequestID(c)))
+	return WriteError(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Internal server error")
+}
+
+// errorCodeForStatus maps the status of a Fiber error to an error code
+func errorCodeForStatus(status int) models.ErrorCode {
+	switch status {
+	case fiber.StatusNotFound:
+		return models.ErrCodeNotFound
+	case fiber.StatusMethodNotAllowed:
+		return models.ErrCodeMethodNotAllowed
+	case fiber.StatusRequestEntityTooLarge:
+		return models.ErrCodePayloadTooLarge
+	case fiber.StatusTooManyRequests:
+		return models.ErrCodeRateLimited
+	case fiber.StatusServiceUnavailable:
+		return models.ErrCodeServiceUnavailable
+	}
+	if status < fiber.StatusInternalServerError {
+		return models.ErrCodeInvalidRequest
+	}
+	return models.ErrCodeInternal
+}
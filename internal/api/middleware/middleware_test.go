@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestRequireTier(t *testing.T) {
+	keys := map[string]*models.APIKey{
+		HashAPIKey("beon_premium"): {ID: 1, Tier: "premium", Enabled: true},
+		HashAPIKey("beon_free"):    {ID: 2, Tier: "free", Enabled: true},
+	}
+
+	tests := []struct {
+		name   string
+		lookup KeyLookup
+		key    string
+		status int
+	}{
+		{"allowed tier", mapLookup(keys), "beon_premium", fiber.StatusOK},
+		{"disallowed tier", mapLookup(keys), "beon_free", fiber.StatusForbidden},
+		{"unknown key", mapLookup(keys), "beon_unknown", fiber.StatusUnauthorized},
+		{"missing key", mapLookup(keys), "", fiber.StatusUnauthorized},
+		{"no lookup configured", nil, "beon_premium", fiber.StatusServiceUnavailable},
+		{"lookup error", func(context.Context, string) (*models.APIKey, error) {
+			return nil, errors.New("db down")
+		}, "beon_premium", fiber.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetKeyLookup(tt.lookup)
+			defer SetKeyLookup(nil)
+
+			app := fiber.New()
+			app.Post("/report", RequireTier("premium", "enterprise"), func(c *fiber.Ctx) error {
+				if _, ok := c.Locals("api_key_info").(*models.APIKey); !ok {
+					t.Error("api_key_info not set in locals")
+				}
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest("POST", "/report", nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func mapLookup(keys map[string]*models.APIKey) KeyLookup {
+	return func(_ context.Context, hash string) (*models.APIKey, error) {
+		return keys[hash], nil
+	}
+}
+
+func TestKeyInfo(t *testing.T) {
+	var lookups int
+	keys := map[string]*models.APIKey{HashAPIKey("beon_bank"): {ID: 7, Tier: "enterprise", Enabled: true}}
+	SetKeyLookup(func(ctx context.Context, hash string) (*models.APIKey, error) {
+		lookups++
+		return mapLookup(keys)(ctx, hash)
+	})
+	defer SetKeyLookup(nil)
+
+	app := fiber.New()
+	app.Get("/check", func(c *fiber.Ctx) error {
+		tier := ""
+		if key := KeyInfo(c); key != nil {
+			tier = key.Tier
+		}
+		KeyInfo(c) // Served from Locals
+		return c.SendString(tier)
+	})
+
+	for _, tt := range []struct{ key, tier string }{{"beon_bank", "enterprise"}, {"beon_unknown", ""}, {"", ""}} {
+		lookups = 0
+		req := httptest.NewRequest("GET", "/check", nil)
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test() error = %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != tt.tier {
+			t.Errorf("key %q: tier = %q, want %q", tt.key, body, tt.tier)
+		}
+		if want := min(len(tt.key), 1); lookups != want {
+			t.Errorf("key %q: %d lookups, want %d", tt.key, lookups, want)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestID())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(GetRequestID(c))
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"propagated", "trace-7f3a9c", true},
+		{"generated when absent", "", false},
+		{"replaced when too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"replaced when not printable", "abc def", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(fiber.HeaderXRequestID, tt.incoming)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			header := resp.Header.Get(fiber.HeaderXRequestID)
+
+			if header == "" || header != string(body) {
+				t.Fatalf("header %q and locals %q must match and be set", header, body)
+			}
+			if (header == tt.incoming) != tt.wantSame {
+				t.Errorf("request ID = %q, incoming %q, want propagated=%v", header, tt.incoming, tt.wantSame)
+			}
+			if !tt.wantSame {
+				if _, err := uuid.Parse(header); err != nil {
+					t.Errorf("generated request ID %q is not a UUID", header)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler, BodyLimit: 16})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return errors.New("boom")
+	})
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	app.Get("/tier", func(c *fiber.Ctx) error {
+		return WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeTooManyIPs, "Exceeded maximum batch size", fiber.Map{"max": 2})
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int
+		code    models.ErrorCode
+		details bool
+	}{
+		{"handler error", "GET", "/fail", "", fiber.StatusInternalServerError, models.ErrCodeInternal, false},
+		{"unknown route", "GET", "/missing", "", fiber.StatusNotFound, models.ErrCodeNotFound, false},
+		{"wrong method", "GET", "/echo", "", fiber.StatusMethodNotAllowed, models.ErrCodeMethodNotAllowed, false},
+		{"written error", "GET", "/tier", "", fiber.StatusBadRequest, models.ErrCodeTooManyIPs, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+
+			var body models.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("response is not an ErrorResponse: %v", err)
+			}
+			if body.Code != tt.code || body.Message == "" {
+				t.Errorf("body = %+v, want code %s and a message", body, tt.code)
+			}
+			if (body.Details != nil) != tt.details {
+				t.Errorf("details = %v, want present = %v", body.Details, tt.details)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Package asn classifies autonomous systems (datacenter, hosting, isp, ...)
+// so scoring can apply ASN type modifiers to live lookups
+package asn
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// DefaultHostingKeywords are org name substrings that mark hosting providers
+// when the asn_info table has no entry for an ASN
+var DefaultHostingKeywords = []string{
+	"hosting", "datacenter", "data center", "cloud", "server", "colocation", "vps",
+	"amazon", "aws", "google", "microsoft", "azure", "digitalocean", "linode", "akamai",
+	"ovh", "hetzner", "vultr", "choopa", "contabo", "leaseweb", "scaleway", "oracle",
+	"alibaba", "tencent", "m247", "psychz", "quadranet",
+}
+
+// maxCacheEntries bounds the cache; it is cleared when full
+const maxCacheEntries = 100000
+
+// LookupFunc returns the asn_info row for an ASN, or nil if there is none
+type LookupFunc func(ctx context.Context, asn int) (*models.ASNInfo, error)
+
+// cacheEntry is a cached classification
+type cacheEntry struct {
+	asnType      string
+	riskModifier int
+	expires      time.Time
+}
+
+// Classifier fills in ASN types from the asn_info table, falling back to an
+// org name heuristic. Results, including misses, are cached for the TTL.
+type Classifier struct {
+	lookup   LookupFunc
+	keywords []string
+	ttl      time.Duration
+
+	mu    sync.RWMutex
+	cache map[int]cacheEntry
+	now   func() time.Time
+}
+
+// NewClassifier creates a Classifier. lookup may be nil to use only the
+// heuristic; empty keywords select DefaultHostingKeywords.
+func NewClassifier(lookup LookupFunc, keywords []string, ttl time.Duration) *Classifier {
+	if len(keywords) == 0 {
+		keywords = DefaultHostingKeywords
+	}
+	lowered := make([]string, len(keywords))
+	for i, k := range keywords {
+		lowered[i] = strings.ToLower(k)
+	}
+	return &Classifier{
+		lookup:   lookup,
+		keywords: lowered,
+		ttl:      ttl,
+		cache:    make(map[int]cacheEntry),
+		now:      time.Now,
+	}
+}
+
+// Enrich sets ASNType, Type and RiskModifier on info when they are not
+// already known. A failed table lookup falls back to the heuristic uncached.
+func (c *Classifier) Enrich(ctx context.Context, info *models.ASNInfo) {
+	if c == nil || info == nil || info.ASN == 0 || info.ASNType != "" {
+		return
+	}
+
+	entry, ok := c.cached(info.ASN)
+	if !ok {
+		var cacheable bool
+		entry, cacheable = c.classify(ctx, info)
+		if cacheable {
+			c.store(info.ASN, entry)
+		}
+	}
+
+	info.ASNType = entry.asnType
+	info.Type = entry.asnType
+	if info.RiskModifier == 0 {
+		info.RiskModifier = entry.riskModifier
+	}
+}
+
+// classify resolves an ASN, reporting whether the result may be cached
+func (c *Classifier) classify(ctx context.Context, info *models.ASNInfo) (cacheEntry, bool) {
+	if c.lookup != nil {
+		row, err := c.lookup(ctx, info.ASN)
+		if err != nil {
+			return cacheEntry{asnType: c.ClassifyOrg(info.Org)}, false
+		}
+		if row != nil && row.ASNType != "" {
+			return cacheEntry{asnType: row.ASNType, riskModifier: row.RiskModifier}, true
+		}
+	}
+	return cacheEntry{asnType: c.ClassifyOrg(info.Org)}, true
+}
+
+// ClassifyOrg returns "hosting" when the org name contains a hosting keyword,
+// otherwise ""
+func (c *Classifier) ClassifyOrg(org string) string {
+	org = strings.ToLower(org)
+	for _, k := range c.keywords {
+		if strings.Contains(org, k) {
+			return "hosting"
+		}
+	}
+	return ""
+}
+
+func (c *Classifier) cached(asn int) (cacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.cache[asn]
+	if !ok || c.now().After(entry.expires) {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *Classifier) store(asn int, entry cacheEntry) {
+	entry.expires = c.now().Add(c.ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxCacheEntries {
+		c.cache = make(map[int]cacheEntry)
+	}
+	c.cache[asn] = entry
+}
@@ -0,0 +1,95 @@
+package asn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestClassifierEnrich(t *testing.T) {
+	table := map[int]*models.ASNInfo{
+		14061: {ASN: 14061, ASNType: "datacenter", RiskModifier: 10},
+		7922:  {ASN: 7922, ASNType: "isp"},
+	}
+	calls := 0
+	lookup := func(ctx context.Context, asn int) (*models.ASNInfo, error) {
+		calls++
+		return table[asn], nil
+	}
+	c := NewClassifier(lookup, nil, time.Hour)
+
+	tests := []struct {
+		name     string
+		info     models.ASNInfo
+		wantType string
+		wantMod  int
+	}{
+		{"table hit", models.ASNInfo{ASN: 14061, Org: "DigitalOcean, LLC"}, "datacenter", 10},
+		{"table isp", models.ASNInfo{ASN: 7922, Org: "Comcast Cable"}, "isp", 0},
+		{"heuristic", models.ASNInfo{ASN: 24940, Org: "Hetzner Online GmbH"}, "hosting", 0},
+		{"unknown", models.ASNInfo{ASN: 3320, Org: "Deutsche Telekom AG"}, "", 0},
+		{"already typed", models.ASNInfo{ASN: 14061, ASNType: "business"}, "business", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := tt.info
+			c.Enrich(context.Background(), &info)
+			if info.ASNType != tt.wantType || info.RiskModifier != tt.wantMod {
+				t.Errorf("Enrich() = type %q modifier %d, want %q %d", info.ASNType, info.RiskModifier, tt.wantType, tt.wantMod)
+			}
+		})
+	}
+
+	// Every ASN, including misses, is served from the cache the second time
+	before := calls
+	for _, asn := range []int{14061, 24940, 3320} {
+		c.Enrich(context.Background(), &models.ASNInfo{ASN: asn})
+	}
+	if calls != before {
+		t.Errorf("lookup called %d more times, want cached results", calls-before)
+	}
+
+	// Entries expire after the TTL
+	c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	c.Enrich(context.Background(), &models.ASNInfo{ASN: 14061})
+	if calls != before+1 {
+		t.Errorf("expired entry not looked up again")
+	}
+}
+
+func TestClassifierLookupErrorNotCached(t *testing.T) {
+	fail := true
+	lookup := func(ctx context.Context, asn int) (*models.ASNInfo, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return &models.ASNInfo{ASN: asn, ASNType: "business"}, nil
+	}
+	c := NewClassifier(lookup, []string{"Cloud"}, time.Hour)
+
+	info := models.ASNInfo{ASN: 64500, Org: "Example Cloud Corp"}
+	c.Enrich(context.Background(), &info)
+	if info.ASNType != "hosting" {
+		t.Errorf("fallback type = %q, want hosting", info.ASNType)
+	}
+
+	fail = false
+	info = models.ASNInfo{ASN: 64500, Org: "Example Cloud Corp"}
+	c.Enrich(context.Background(), &info)
+	if info.ASNType != "business" {
+		t.Errorf("type after recovery = %q, want business from the table", info.ASNType)
+	}
+}
+
+func TestNilClassifier(t *testing.T) {
+	var c *Classifier
+	info := models.ASNInfo{ASN: 14061, Org: "DigitalOcean"}
+	c.Enrich(context.Background(), &info)
+	if info.ASNType != "" {
+		t.Errorf("nil classifier set type %q", info.ASNType)
+	}
+}
@@ -0,0 +1,103 @@
+package asn
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// csvColumns is the expected column order of an ASN classification file
+var csvColumns = []string{"asn", "name", "org", "country", "type", "modifier"}
+
+// ParseCSV reads ASN classifications with the columns
+// asn,name,org,country,type,modifier. A header row, "AS" prefixes, blank
+// lines and lines starting with # are accepted; modifier may be empty.
+func ParseCSV(r io.Reader) ([]models.ASNInfo, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = len(csvColumns)
+	reader.TrimLeadingSpace = true
+
+	var infos []models.ASNInfo
+	seen := make(map[int]int)
+	first := true
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if first {
+			first = false
+			if strings.EqualFold(strings.TrimSpace(record[0]), "asn") {
+				continue // Header
+			}
+		}
+
+		info, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		// Later rows win so a file can override itself
+		if i, ok := seen[info.ASN]; ok {
+			infos[i] = info
+			continue
+		}
+		seen[info.ASN] = len(infos)
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// parseRecord validates one CSV record
+func parseRecord(record []string) (models.ASNInfo, error) {
+	for i := range record {
+		record[i] = strings.TrimSpace(record[i])
+	}
+
+	raw := strings.TrimPrefix(strings.ToUpper(record[0]), "AS")
+	// asn_info.asn is a signed INTEGER
+	number, err := strconv.ParseUint(raw, 10, 31)
+	if err != nil || number == 0 {
+		return models.ASNInfo{}, fmt.Errorf("invalid asn %q", record[0])
+	}
+
+	country := strings.ToUpper(record[3])
+	if country != "" && len(country) != 2 {
+		return models.ASNInfo{}, fmt.Errorf("country must be a two-letter code, got %q", record[3])
+	}
+
+	asnType := strings.ToLower(record[4])
+	if asnType == "" {
+		return models.ASNInfo{}, fmt.Errorf("type is required")
+	}
+
+	var modifier int
+	if record[5] != "" {
+		modifier, err = strconv.Atoi(record[5])
+		if err != nil || modifier < -100 || modifier > 100 {
+			return models.ASNInfo{}, fmt.Errorf("modifier must be an integer between -100 and 100, got %q", record[5])
+		}
+	}
+
+	return models.ASNInfo{
+		ASN:          int(number),
+		Name:         record[1],
+		Org:          record[2],
+		CountryCode:  country,
+		ASNType:      asnType,
+		Type:         asnType,
+		RiskModifier: modifier,
+	}, nil
+}
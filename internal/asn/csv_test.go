@@ -0,0 +1,57 @@
+package asn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	input := `asn,name,org,country,type,modifier
+# Cloud providers
+AS14061,DIGITALOCEAN-ASN,"DigitalOcean, LLC",us,Hosting,15
+16509,AMAZON-02,Amazon.com Inc.,US,datacenter,
+7922,COMCAST,Comcast Cable,US,isp,0
+
+AS14061,DIGITALOCEAN-ASN,"DigitalOcean, LLC",US,hosting,20
+`
+	infos, err := ParseCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseCSV() error = %v", err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("ParseCSV() returned %d rows, want 3 (duplicate merged)", len(infos))
+	}
+
+	do := infos[0]
+	if do.ASN != 14061 || do.Org != "DigitalOcean, LLC" || do.CountryCode != "US" || do.ASNType != "hosting" || do.RiskModifier != 20 {
+		t.Errorf("row 0 = %+v, want AS14061 hosting US modifier 20 (last duplicate wins)", do)
+	}
+	if infos[1].ASN != 16509 || infos[1].RiskModifier != 0 {
+		t.Errorf("row 1 = %+v, want AS16509 with modifier 0", infos[1])
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"bad asn", "ASX,a,b,US,isp,0\n", "line 1: invalid asn"},
+		{"asn too large", "4200000000,a,b,US,isp,0\n", "invalid asn"},
+		{"bad country", "1,a,b,USA,isp,0\n", "two-letter"},
+		{"missing type", "1,a,b,US,,0\n", "type is required"},
+		{"bad modifier", "1,a,b,US,isp,150\n", "modifier"},
+		{"wrong column count", "1,a,b,US,isp\n", "wrong number of fields"},
+		{"error line number", "asn,name,org,country,type,modifier\n1,a,b,US,isp,0\n2,a,b,US,isp,x\n", "line 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCSV(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseCSV() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
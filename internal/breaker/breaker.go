@@ -0,0 +1,137 @@
+// Package breaker implements a circuit breaker for optional dependencies such
+// as Redis and ClickHouse. After repeated failures calls fail fast for a
+// cooldown instead of each waiting out the dependency's timeout; then a single
+// probe call is let through and its outcome closes or reopens the breaker.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+)
+
+// ErrOpen is returned instead of calling the dependency while the breaker is open
+var ErrOpen = errors.New("circuit breaker open")
+
+// State is the state of a Breaker
+type State int
+
+const (
+	Closed   State = iota // Calls go through
+	Open                  // Calls fail fast until the cooldown has passed
+	HalfOpen              // One probe call is in flight
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker opens after Threshold consecutive failures and stays open for
+// Cooldown. It is safe for concurrent use.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+}
+
+// New creates a closed breaker for the named dependency; the name labels its
+// metrics. threshold must be positive.
+func New(name string, threshold int, cooldown time.Duration) *Breaker {
+	b := &Breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+	metrics.CircuitBreakerState.WithLabelValues(name).Set(float64(Closed))
+	return b
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow reports whether a call may go to the dependency. Once the cooldown
+// has passed, the first caller becomes the probe; its result must be passed
+// to Record.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		return true
+	case Open:
+		if b.now().Sub(b.openedAt) >= b.cooldown {
+			b.setState(HalfOpen)
+			return true
+		}
+	}
+	metrics.CircuitBreakerRejections.WithLabelValues(b.name).Inc()
+	return false
+}
+
+// Record reports the result of an allowed call. A canceled context says
+// nothing about the dependency: it is not counted, and a canceled probe lets
+// the next call probe instead.
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		if b.state == HalfOpen {
+			b.setState(Open)
+			b.openedAt = b.now().Add(-b.cooldown)
+		}
+	case err == nil:
+		b.failures = 0
+		if b.state != Closed {
+			b.setState(Closed)
+		}
+	default:
+		b.failures++
+		if b.state == HalfOpen || (b.state == Closed && b.failures >= b.threshold) {
+			b.setState(Open)
+			b.openedAt = b.now()
+		}
+	}
+}
+
+// Do calls fn if the breaker allows it and records the result; otherwise it
+// returns ErrOpen without calling fn
+func (b *Breaker) Do(fn func() error) error {
+	if !b.Allow() {
+		return ErrOpen
+	}
+	err := fn()
+	b.Record(err)
+	return err
+}
+
+// setState changes the state and its gauge; b.mu must be held
+func (b *Breaker) setState(s State) {
+	b.state = s
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(s))
+}
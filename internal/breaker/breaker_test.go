@@ -0,0 +1,110 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("connection refused")
+
+// newTestBreaker returns a breaker on a clock the test advances by hand
+func newTestBreaker(threshold int, cooldown time.Duration) (*Breaker, *time.Time) {
+	clock := time.Unix(1700000000, 0)
+	b := New("test", threshold, cooldown)
+	b.now = func() time.Time { return clock }
+	return b, &clock
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+
+	calls := 0
+	fail := func() error { calls++; return errDown }
+
+	for i := 0; i < 3; i++ {
+		if err := b.Do(fail); err != errDown {
+			t.Fatalf("call %d: Do() = %v, want %v", i, err, errDown)
+		}
+	}
+	if b.State() != Open {
+		t.Fatalf("State() after 3 failures = %v, want open", b.State())
+	}
+	if err := b.Do(fail); err != ErrOpen {
+		t.Errorf("Do() while open = %v, want ErrOpen", err)
+	}
+	if calls != 3 {
+		t.Errorf("dependency called %d times, want 3", calls)
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b, _ := newTestBreaker(2, time.Minute)
+
+	b.Record(errDown)
+	b.Record(nil)
+	b.Record(errDown)
+	if b.State() != Closed {
+		t.Errorf("State() = %v, want closed: failures were not consecutive", b.State())
+	}
+}
+
+func TestBreakerProbesAfterCooldown(t *testing.T) {
+	b, clock := newTestBreaker(1, 30*time.Second)
+
+	b.Record(errDown)
+	*clock = clock.Add(29 * time.Second)
+	if b.Allow() {
+		t.Fatal("Allow() before the cooldown = true, want false")
+	}
+
+	*clock = clock.Add(time.Second)
+	if !b.Allow() {
+		t.Fatal("Allow() after the cooldown = false, want a probe")
+	}
+	if b.State() != HalfOpen {
+		t.Fatalf("State() = %v, want half-open", b.State())
+	}
+	if b.Allow() {
+		t.Error("Allow() while probing = true, want only one probe")
+	}
+
+	// A failed probe reopens for another full cooldown
+	b.Record(errDown)
+	*clock = clock.Add(29 * time.Second)
+	if b.Allow() {
+		t.Fatal("Allow() after a failed probe = true, want false")
+	}
+
+	*clock = clock.Add(time.Second)
+	if !b.Allow() {
+		t.Fatal("Allow() = false, want a second probe")
+	}
+	b.Record(nil)
+	if b.State() != Closed || !b.Allow() {
+		t.Errorf("State() after a successful probe = %v, want closed", b.State())
+	}
+}
+
+func TestBreakerIgnoresCanceledCalls(t *testing.T) {
+	b, clock := newTestBreaker(1, time.Minute)
+
+	b.Record(context.Canceled)
+	if b.State() != Closed {
+		t.Fatalf("State() after a canceled call = %v, want closed", b.State())
+	}
+
+	b.Record(context.DeadlineExceeded)
+	*clock = clock.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatal("Allow() = false, want a probe")
+	}
+
+	// The probe's caller gave up; the next call probes instead of waiting
+	// out another cooldown
+	b.Record(context.Canceled)
+	if !b.Allow() {
+		t.Error("Allow() after a canceled probe = false, want a new probe")
+	}
+}
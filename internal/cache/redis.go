@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
+	"github.com/lfrfrfr/beon-ipquality/internal/breaker"
 	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
 	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
@@ -18,6 +21,7 @@ type Cache interface {
 	Set(ctx context.Context, ip string, result *models.IPCheckResult) error
 	Delete(ctx context.Context, ip string) error
 	Clear(ctx context.Context) error
+	SetEpoch(epoch uint64)
 	Stats(ctx context.Context) (*CacheStats, error)
 	Close() error
 }
@@ -27,81 +31,250 @@ type CacheStats struct {
 	Hits       int64   `json:"hits"`
 	Misses     int64   `json:"misses"`
 	HitRate    float64 `json:"hit_rate"`
-	Keys       int64   `json:"keys"`
+	Keys       int64   `json:"keys"` // All epochs, including entries orphaned by a reload
 	MemoryUsed int64   `json:"memory_used_bytes"`
+	Epoch      uint64  `json:"epoch"` // MMDB build epoch new entries are keyed under
 }
 
-// RedisCache implements Cache interface using Redis
+// RedisCache implements Cache interface using Redis.
+// Keys are prefixed with the MMDB build epoch, so entries written against an
+// older database stop being read as soon as a new one is loaded.
 type RedisCache struct {
-	client *redis.Client
-	ttl    time.Duration
-	prefix string
-	hits   int64
-	misses int64
+	client   redis.UniversalClient
+	ttl      time.Duration
+	cleanTTL time.Duration
+	prefix   string
+	epoch    atomic.Uint64
+	hits     int64
+	misses   int64
+
+	// breaker makes Get and Set fail fast while Redis is failing; nil
+	// when disabled
+	breaker *breaker.Breaker
 }
 
+// Redis deployment modes
+const (
+	ModeSingle   = "single"
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+)
+
 // Config holds Redis cache configuration
 type Config struct {
-	Host     string
-	Port     int
-	Password string
-	DB       int
-	PoolSize int
-	TTL      time.Duration
-	Prefix   string
+	// Mode is single (Host/Port, the default), sentinel (Addrs are the
+	// sentinels monitoring MasterName) or cluster (Addrs are seed nodes)
+	Mode             string
+	Host             string
+	Port             int
+	Addrs            []string
+	MasterName       string
+	SentinelPassword string
+	Password         string
+	DB               int // Ignored in cluster mode
+	PoolSize         int
+	TTL              time.Duration
+	CleanTTL         time.Duration // TTL for clean results; shorter so new listings show up quickly
+	Prefix           string
+
+	// After BreakerThreshold consecutive Get/Set failures the cache is
+	// skipped for BreakerCooldown before one call probes Redis again
+	// (0 disables the breaker)
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 // NewRedisCache creates a new Redis cache instance
 func NewRedisCache(cfg Config) (*RedisCache, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-		PoolSize: cfg.PoolSize,
-	})
+	client, err := NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := cfg.TTL
+	if ttl == 0 {
+		ttl = 5 * time.Minute // Default TTL
+	}
+
+	cleanTTL := cfg.CleanTTL
+	if cleanTTL == 0 || cleanTTL > ttl {
+		cleanTTL = ttl
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "ipq:"
+	}
+
+	logger.Info(fmt.Sprintf("Connected to Redis (%s) at %s", modeOrDefault(cfg.Mode), endpoint(cfg)))
+
+	c := &RedisCache{
+		client:   client,
+		ttl:      ttl,
+		cleanTTL: cleanTTL,
+		prefix:   prefix,
+	}
+	if cfg.BreakerThreshold > 0 {
+		c.breaker = breaker.New("redis", cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	return c, nil
+}
+
+// NewClient connects to Redis in the configured deployment mode. Services
+// that keep their own keys in the cache's Redis use it so they follow
+// redis.mode as well; the cache-only fields of cfg are ignored.
+func NewClient(cfg Config) (redis.UniversalClient, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
+	return client, nil
+}
 
-	ttl := cfg.TTL
-	if ttl == 0 {
-		ttl = 5 * time.Minute // Default TTL
+// newClient builds the client for the configured deployment mode
+func newClient(cfg Config) (redis.UniversalClient, error) {
+	switch modeOrDefault(cfg.Mode) {
+	case ModeSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Password: cfg.Password,
+			DB:       cfg.DB,
+			PoolSize: cfg.PoolSize,
+		}), nil
+	case ModeSentinel:
+		if len(cfg.Addrs) == 0 || cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel mode requires addrs and master_name")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			PoolSize:         cfg.PoolSize,
+		}), nil
+	case ModeCluster:
+		if len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("redis cluster mode requires addrs")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    cfg.Addrs,
+			Password: cfg.Password,
+			PoolSize: cfg.PoolSize,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q (must be single, sentinel or cluster)", cfg.Mode)
 	}
+}
 
-	prefix := cfg.Prefix
-	if prefix == "" {
-		prefix = "ipq:"
+// modeOrDefault returns the mode, defaulting to single
+func modeOrDefault(mode string) string {
+	if mode == "" {
+		return ModeSingle
+	}
+	return mode
+}
+
+// endpoint describes where the cache connects to, for logging
+func endpoint(cfg Config) string {
+	switch modeOrDefault(cfg.Mode) {
+	case ModeSentinel:
+		return fmt.Sprintf("%s via %s", cfg.MasterName, strings.Join(cfg.Addrs, ","))
+	case ModeCluster:
+		return strings.Join(cfg.Addrs, ",")
+	default:
+		return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	}
+}
+
+// forEachNode runs fn against every node that holds keys: each master of a
+// cluster (SCAN only covers the node it is sent to), the server otherwise
+func (c *RedisCache) forEachNode(ctx context.Context, fn func(ctx context.Context, node redis.Cmdable) error) error {
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(ctx, node)
+		})
 	}
+	return fn(ctx, c.client)
+}
 
-	logger.Info(fmt.Sprintf("Connected to Redis at %s:%d", cfg.Host, cfg.Port))
+// scanKeys calls fn with each batch of keys under the cache prefix on a node
+func (c *RedisCache) scanKeys(ctx context.Context, node redis.Cmdable, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, nextCursor, err := node.Scan(ctx, cursor, c.prefix+"*", 1000).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		cursor = nextCursor
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
 
-	return &RedisCache{
-		client: client,
-		ttl:    ttl,
-		prefix: prefix,
-	}, nil
+// SetEpoch switches the cache to a new MMDB build epoch; entries cached under
+// the previous epoch are no longer read and expire on their own TTL
+func (c *RedisCache) SetEpoch(epoch uint64) {
+	c.epoch.Store(epoch)
 }
 
-// key generates the cache key for an IP
+// key generates the cache key for an IP in the current epoch
 func (c *RedisCache) key(ip string) string {
-	return c.prefix + ip
+	return fmt.Sprintf("%s%d:%s", c.prefix, c.epoch.Load(), ip)
+}
+
+// ttlFor returns the TTL for a result: clean results use the shorter clean TTL
+func (c *RedisCache) ttlFor(result *models.IPCheckResult) time.Duration {
+	if result.RiskLevel == "clean" {
+		return c.cleanTTL
+	}
+	return c.ttl
+}
+
+// guard runs a Redis call through the breaker, if there is one. While it is
+// open the call is skipped and breaker.ErrOpen returned.
+func (c *RedisCache) guard(fn func() error) error {
+	if c.breaker == nil {
+		return fn()
+	}
+	return c.breaker.Do(fn)
 }
 
 // Get retrieves a cached result for an IP
 func (c *RedisCache) Get(ctx context.Context, ip string) (*models.IPCheckResult, error) {
-	data, err := c.client.Get(ctx, c.key(ip)).Bytes()
-	if err != nil {
+	var data []byte
+	var miss bool
+	err := c.guard(func() error {
+		var err error
+		data, err = c.client.Get(ctx, c.key(ip)).Bytes()
 		if err == redis.Nil {
-			c.misses++
-			return nil, nil // Cache miss
+			miss = true
+			return nil // A miss is a healthy answer
 		}
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
+	if miss {
+		c.misses++
+		return nil, nil // Cache miss
+	}
 
 	var result models.IPCheckResult
 	if err := json.Unmarshal(data, &result); err != nil {
@@ -120,7 +293,9 @@ func (c *RedisCache) Set(ctx context.Context, ip string, result *models.IPCheckR
 		return fmt.Errorf("failed to marshal result: %w", err)
 	}
 
-	return c.client.Set(ctx, c.key(ip), data, c.ttl).Err()
+	return c.guard(func() error {
+		return c.client.Set(ctx, c.key(ip), data, c.ttlFor(result)).Err()
+	})
 }
 
 // Delete removes a cached result
@@ -130,24 +305,21 @@ func (c *RedisCache) Delete(ctx context.Context, ip string) error {
 
 // Clear removes all cached results
 func (c *RedisCache) Clear(ctx context.Context) error {
-	// Use SCAN to find all keys with our prefix and delete them
-	var cursor uint64
-	for {
-		keys, nextCursor, err := c.client.Scan(ctx, cursor, c.prefix+"*", 1000).Result()
-		if err != nil {
-			return err
-		}
-
-		if len(keys) > 0 {
-			if err := c.client.Del(ctx, keys...).Err(); err != nil {
-				return err
+	// Use SCAN to find all keys with our prefix and delete them. Keys are
+	// deleted one per command: a multi-key DEL fails in a cluster when the
+	// keys hash to different slots.
+	err := c.forEachNode(ctx, func(ctx context.Context, node redis.Cmdable) error {
+		return c.scanKeys(ctx, node, func(keys []string) error {
+			pipe := node.Pipeline()
+			for _, key := range keys {
+				pipe.Del(ctx, key)
 			}
-		}
-
-		cursor = nextCursor
-		if cursor == 0 {
-			break
-		}
+			_, err := pipe.Exec(ctx)
+			return err
+		})
+	})
+	if err != nil {
+		return err
 	}
 
 	c.hits = 0
@@ -163,24 +335,22 @@ func (c *RedisCache) Stats(ctx context.Context) (*CacheStats, error) {
 	}
 
 	// Count keys with our prefix
-	var keyCount int64
-	var cursor uint64
-	for {
-		keys, nextCursor, err := c.client.Scan(ctx, cursor, c.prefix+"*", 1000).Result()
-		if err != nil {
-			return nil, err
-		}
-		keyCount += int64(len(keys))
-		cursor = nextCursor
-		if cursor == 0 {
-			break
-		}
+	var keyCount atomic.Int64
+	err = c.forEachNode(ctx, func(ctx context.Context, node redis.Cmdable) error {
+		return c.scanKeys(ctx, node, func(keys []string) error {
+			keyCount.Add(int64(len(keys)))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	stats := &CacheStats{
 		Hits:   c.hits,
 		Misses: c.misses,
-		Keys:   keyCount,
+		Keys:   keyCount.Load(),
+		Epoch:  c.epoch.Load(),
 	}
 
 	total := c.hits + c.misses
@@ -223,6 +393,8 @@ func (c *NoOpCache) Clear(ctx context.Context) error {
 	return nil
 }
 
+func (c *NoOpCache) SetEpoch(epoch uint64) {}
+
 func (c *NoOpCache) Stats(ctx context.Context) (*CacheStats, error) {
 	return &CacheStats{}, nil
 }
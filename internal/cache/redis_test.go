@@ -0,0 +1,283 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/breaker"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// fakeRedis is a minimal RESP2 server supporting GET, SET (with PX/EX) and PING
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+	ttls map[string]time.Duration
+
+	failing bool // Answer GET and SET with an error
+	calls   int  // GET and SET commands received
+}
+
+func startFakeRedis(t *testing.T) (host string, port int, srv *fakeRedis) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	srv = &fakeRedis{data: make(map[string]string), ttls: make(map[string]time.Duration)}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, srv
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		f.mu.Lock()
+		cmd := strings.ToUpper(args[0])
+		if cmd == "GET" || cmd == "SET" {
+			f.calls++
+			if f.failing {
+				cmd = "FAIL"
+			}
+		}
+		switch cmd {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "GET":
+			if v, ok := f.data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			f.data[args[1]] = args[2]
+			if len(args) == 5 {
+				n, _ := strconv.Atoi(args[4])
+				unit := time.Second
+				if strings.ToUpper(args[3]) == "PX" {
+					unit = time.Millisecond
+				}
+				f.ttls[args[1]] = time.Duration(n) * unit
+			}
+			reply = "+OK\r\n"
+		case "FAIL":
+			reply = "-ERR injected failure\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil { // $len
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func newTestCache(t *testing.T) (*RedisCache, *fakeRedis) {
+	t.Helper()
+
+	host, port, srv := startFakeRedis(t)
+	c, err := NewRedisCache(Config{
+		Host:     host,
+		Port:     port,
+		TTL:      5 * time.Minute,
+		CleanTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, srv
+}
+
+func TestRedisCacheEpochInvalidatesCleanEntry(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+
+	c.SetEpoch(1700000000)
+	clean := &models.IPCheckResult{IP: "8.8.8.8", RiskLevel: "clean"}
+	if err := c.Set(ctx, "8.8.8.8", clean); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := c.Get(ctx, "8.8.8.8")
+	if err != nil || got == nil {
+		t.Fatalf("Get before reload = %v, %v; want cached clean result", got, err)
+	}
+
+	// A reload brings a new MMDB build; the clean verdict must not be served
+	c.SetEpoch(1700003600)
+	got, err = c.Get(ctx, "8.8.8.8")
+	if err != nil {
+		t.Fatalf("Get after reload: %v", err)
+	}
+	if got != nil {
+		t.Errorf("Get after reload = %+v, want miss", got)
+	}
+}
+
+func TestRedisCacheCleanTTL(t *testing.T) {
+	c, srv := newTestCache(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		ip        string
+		riskLevel string
+		wantTTL   time.Duration
+	}{
+		{"8.8.8.8", "clean", time.Minute},
+		{"185.220.101.7", "critical", 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if err := c.Set(ctx, tt.ip, &models.IPCheckResult{IP: tt.ip, RiskLevel: tt.riskLevel}); err != nil {
+			t.Fatalf("Set(%s): %v", tt.ip, err)
+		}
+
+		srv.mu.Lock()
+		got := srv.ttls[c.key(tt.ip)]
+		srv.mu.Unlock()
+
+		if got != tt.wantTTL {
+			t.Errorf("%s TTL = %v, want %v", tt.riskLevel, got, tt.wantTTL)
+		}
+	}
+}
+
+func TestNewClientModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    string
+		wantErr bool
+	}{
+		{"default single", Config{Host: "localhost", Port: 6379}, "*redis.Client", false},
+		{"sentinel", Config{Mode: ModeSentinel, Addrs: []string{"s1:26379"}, MasterName: "ipq"}, "*redis.Client", false},
+		{"cluster", Config{Mode: ModeCluster, Addrs: []string{"n1:6379", "n2:6379"}}, "*redis.ClusterClient", false},
+		{"sentinel without master", Config{Mode: ModeSentinel, Addrs: []string{"s1:26379"}}, "", true},
+		{"cluster without addrs", Config{Mode: ModeCluster}, "", true},
+		{"unknown mode", Config{Mode: "ring"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newClient(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					client.Close()
+					t.Fatal("newClient() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newClient() error = %v", err)
+			}
+			defer client.Close()
+
+			if got := fmt.Sprintf("%T", client); got != tt.want {
+				t.Errorf("newClient() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisCacheBreaker(t *testing.T) {
+	host, port, srv := startFakeRedis(t)
+	c, err := NewRedisCache(Config{
+		Host:             host,
+		Port:             port,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	ctx := context.Background()
+
+	// Misses are healthy answers and do not trip the breaker
+	for i := 0; i < 3; i++ {
+		if got, err := c.Get(ctx, "8.8.8.8"); got != nil || err != nil {
+			t.Fatalf("Get = %v, %v; want a miss", got, err)
+		}
+	}
+
+	srv.mu.Lock()
+	srv.failing = true
+	srv.calls = 0
+	srv.mu.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, "8.8.8.8"); err == nil || errors.Is(err, breaker.ErrOpen) {
+			t.Fatalf("Get %d error = %v, want the Redis error", i, err)
+		}
+	}
+	if _, err := c.Get(ctx, "8.8.8.8"); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("Get after 2 failures error = %v, want ErrOpen", err)
+	}
+	if err := c.Set(ctx, "8.8.8.8", &models.IPCheckResult{RiskLevel: "clean"}); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("Set after 2 failures error = %v, want ErrOpen", err)
+	}
+
+	srv.mu.Lock()
+	calls := srv.calls
+	srv.mu.Unlock()
+	if calls != 2 {
+		t.Errorf("Redis received %d commands, want 2: the open breaker must skip it", calls)
+	}
+}
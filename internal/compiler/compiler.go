@@ -9,6 +9,8 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
 	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
 	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
 	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
@@ -23,6 +25,9 @@ type Compiler struct {
 	scorer      *scoring.Scorer
 	mu          sync.Mutex
 	lastCompile time.Time
+
+	// threatTypeAliases map feed labels to canonical threat types
+	threatTypeAliases map[string]string
 }
 
 // New creates a new Compiler instance
@@ -36,35 +41,58 @@ func New(cfg *config.Config) (*Compiler, error) {
 	poolConfig.MaxConns = int32(cfg.Database.Postgres.MaxConnections)
 	poolConfig.MinConns = int32(cfg.Database.Postgres.MinConnections)
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	// The database may still be starting during a coordinated deploy
+	var pool *pgxpool.Pool
+	pg := cfg.Database.Postgres
+	err = database.ConnectWithRetry(context.Background(), pg.ConnectAttempts, pg.ConnectRetryDelay, func() error {
+		p, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+		if err != nil {
+			return fmt.Errorf("failed to connect to database: %w", err)
+		}
+		if err := p.Ping(context.Background()); err != nil {
+			p.Close()
+			return fmt.Errorf("failed to ping database: %w", err)
+		}
+		pool = p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scoringConfig, err := scoring.FromConfig(cfg.Scoring)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		pool.Close()
+		return nil, err
 	}
 
-	// Test connection
-	if err := pool.Ping(context.Background()); err != nil {
+	recordSize, err := mmdb.ParseRecordSize(cfg.MMDB.RecordSize)
+	if err != nil {
 		pool.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, err
 	}
 
 	// Create MMDB writer
 	writerConfig := mmdb.WriterConfig{
 		DatabaseType:        "BEON-IPReputation",
 		Description:         "BEON IP Reputation Database",
-		RecordSize:          cfg.MMDB.RecordSize,
+		RecordSize:          recordSize,
 		IPVersion:           0,
 		IncludeReservedNets: false,
+		RiskThresholds:      scoringConfig.RiskThresholds,
 	}
 	mmdbWriter := mmdb.NewWriter(writerConfig)
 
 	// Create scorer
-	scorer := scoring.NewDefault()
+	scorer := scoring.New(scoringConfig)
 
 	return &Compiler{
 		config:     cfg,
 		db:         pool,
 		mmdbWriter: mmdbWriter,
 		scorer:     scorer,
+
+		threatTypeAliases: scoringConfig.ThreatTypeAliases,
 	}, nil
 }
 
@@ -96,19 +124,14 @@ func (c *Compiler) Compile(ctx context.Context) error {
 		return nil
 	}
 
+	// Older rows and manual imports may carry feed-specific labels; map them
+	// to the canonical taxonomy so the MMDB flags are derived correctly
+	c.normalizeThreatTypes(reputations)
+
 	// Calculate risk scores for all entries
 	now := time.Now()
 	for i := range reputations {
-		threats := []models.Threat{{
-			ThreatType: reputations[i].ThreatType,
-			Source:     reputations[i].Source,
-			Confidence: reputations[i].Confidence,
-			LastSeen:   reputations[i].LastSeen,
-			Weight:     reputations[i].Weight,
-		}}
-
-		score := c.scorer.CalculateScore(threats, nil, now)
-		reputations[i].RiskScore = score
+		reputations[i].RiskScore = scoreEntry(c.scorer, &reputations[i], now)
 	}
 
 	// Compile to MMDB
@@ -118,6 +141,7 @@ func (c *Compiler) Compile(ctx context.Context) error {
 	}
 
 	c.lastCompile = time.Now()
+	metrics.RecordCompile(len(reputations), time.Since(startTime))
 	logger.Info(fmt.Sprintf("MMDB compilation complete in %v, output: %s", time.Since(startTime), outputPath))
 
 	// Notify judge nodes about new database (if configured)
@@ -139,10 +163,16 @@ func (c *Compiler) fetchReputationData(ctx context.Context) ([]models.IPReputati
 			confidence,
 			weight,
 			first_seen,
-			last_seen
-		FROM ip_reputation
-		WHERE (expires_at IS NULL OR expires_at > NOW())
-		ORDER BY last_seen DESC
+			last_seen,
+			CASE WHEN jsonb_typeof(metadata->'tags') = 'array' THEN metadata->'tags' ELSE '[]'::jsonb END as tags
+		FROM ip_reputation r
+		WHERE (r.expires_at IS NULL OR r.expires_at > NOW())
+		  AND NOT EXISTS (
+			SELECT 1 FROM whitelist w
+			WHERE r.ip_start >= w.ip_start AND r.ip_end <= w.ip_end
+			  AND (w.permanent = true OR w.expires_at IS NULL OR w.expires_at > NOW())
+		  )
+		ORDER BY r.last_seen DESC
 	`
 
 	rows, err := c.db.Query(ctx, query)
@@ -164,6 +194,7 @@ func (c *Compiler) fetchReputationData(ctx context.Context) ([]models.IPReputati
 			&rep.Weight,
 			&rep.FirstSeen,
 			&rep.LastSeen,
+			&rep.Metadata.Tags,
 		)
 		if err != nil {
 			logger.Error(fmt.Sprintf("Failed to scan row: %v", err))
@@ -179,6 +210,124 @@ func (c *Compiler) fetchReputationData(ctx context.Context) ([]models.IPReputati
 	return reputations, nil
 }
 
+// normalizeThreatTypes rewrites threat types to the canonical taxonomy and
+// logs the ones that have no alias
+func (c *Compiler) normalizeThreatTypes(reputations []models.IPReputation) {
+	unmapped := make(map[string]int)
+	for i := range reputations {
+		threatType, ok := scoring.NormalizeThreatType(c.threatTypeAliases, reputations[i].ThreatType)
+		if !ok {
+			unmapped[threatType]++
+		}
+		reputations[i].ThreatType = threatType
+	}
+	for threatType, count := range unmapped {
+		logger.Warn(fmt.Sprintf("%d entries have unmapped threat type %q; add it to scoring.threat_type_aliases", count, threatType))
+	}
+}
+
+// scoreEntry scores a single reputation row
+func scoreEntry(scorer *scoring.Scorer, rep *models.IPReputation, now time.Time) int {
+	threats := []models.Threat{{
+		ThreatType: rep.ThreatType,
+		Source:     rep.Source,
+		Confidence: rep.Confidence,
+		LastSeen:   rep.LastSeen,
+		Weight:     rep.Weight,
+	}}
+	return scorer.CalculateScore(threats, nil, now)
+}
+
+// DecayStats summarizes a decay recompute run
+type DecayStats struct {
+	Scanned     int
+	Updated     int
+	TierChanges int
+}
+
+// scoredRow is a reputation row with its stored score (nil if never scored)
+type scoredRow struct {
+	rep    models.IPReputation
+	stored *int
+}
+
+// decayUpdates returns the rows whose decayed score differs from the stored
+// one, and how many of those moved to a different risk tier
+func decayUpdates(scorer *scoring.Scorer, rows []scoredRow, now time.Time) (ids []int64, scores []int32, tierChanges int) {
+	for i := range rows {
+		score := scoreEntry(scorer, &rows[i].rep, now)
+		stored := rows[i].stored
+		if stored != nil && *stored == score {
+			continue
+		}
+
+		ids = append(ids, rows[i].rep.ID)
+		scores = append(scores, int32(score))
+		if stored != nil && scorer.ClassifyRisk(*stored) != scorer.ClassifyRisk(score) {
+			tierChanges++
+		}
+	}
+	return ids, scores, tierChanges
+}
+
+// RecomputeDecay re-scores stored entries purely from the age of last_seen, so
+// rarely updated feeds still age between compiles
+func (c *Compiler) RecomputeDecay(ctx context.Context) (DecayStats, error) {
+	startTime := time.Now()
+
+	rows, err := c.db.Query(ctx, `
+		SELECT id, source, threat_type, confidence, weight, last_seen, risk_score
+		FROM ip_reputation
+		WHERE expires_at IS NULL OR expires_at > NOW()
+	`)
+	if err != nil {
+		return DecayStats{}, fmt.Errorf("query failed: %w", err)
+	}
+
+	var scored []scoredRow
+	for rows.Next() {
+		var row scoredRow
+		if err := rows.Scan(
+			&row.rep.ID,
+			&row.rep.Source,
+			&row.rep.ThreatType,
+			&row.rep.Confidence,
+			&row.rep.Weight,
+			&row.rep.LastSeen,
+			&row.stored,
+		); err != nil {
+			rows.Close()
+			return DecayStats{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		scored = append(scored, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return DecayStats{}, fmt.Errorf("rows error: %w", err)
+	}
+
+	ids, scores, tierChanges := decayUpdates(c.scorer, scored, time.Now())
+	stats := DecayStats{Scanned: len(scored), TierChanges: tierChanges}
+
+	if len(ids) > 0 {
+		tag, err := c.db.Exec(ctx, `
+			UPDATE ip_reputation r
+			SET risk_score = u.score, scored_at = NOW()
+			FROM unnest($1::bigint[], $2::int[]) AS u(id, score)
+			WHERE r.id = u.id
+		`, ids, scores)
+		if err != nil {
+			return stats, fmt.Errorf("failed to update scores: %w", err)
+		}
+		stats.Updated = int(tag.RowsAffected())
+	}
+
+	logger.Info(fmt.Sprintf("Decay recompute: %d scanned, %d scores updated, %d tier changes in %v",
+		stats.Scanned, stats.Updated, stats.TierChanges, time.Since(startTime)))
+
+	return stats, nil
+}
+
 // notifyJudgeNodes sends notification to judge nodes about new MMDB
 func (c *Compiler) notifyJudgeNodes() {
 	// TODO: Implement notification mechanism
@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestDecayUpdates(t *testing.T) {
+	scorer := scoring.NewDefault()
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	rep := func(id int64, lastSeen time.Time) models.IPReputation {
+		return models.IPReputation{ID: id, ThreatType: "botnet_c2", Confidence: 1, Weight: 90, LastSeen: lastSeen}
+	}
+	scoreOf := func(r models.IPReputation) *int {
+		s := scoreEntry(scorer, &r, now)
+		return &s
+	}
+
+	fresh := rep(1, now.Add(-time.Hour))
+	aged := rep(2, now.AddDate(0, 0, -120))
+	unscored := rep(3, now.AddDate(0, 0, -10))
+	freshScore := scoreOf(fresh)
+
+	rows := []scoredRow{
+		{rep: fresh, stored: freshScore}, // unchanged: not updated
+		{rep: aged, stored: freshScore},  // decayed into a lower tier
+		{rep: unscored, stored: nil},     // first score: updated, not a tier change
+	}
+
+	ids, scores, tierChanges := decayUpdates(scorer, rows, now)
+
+	if len(ids) != 2 || ids[0] != 2 || ids[1] != 3 {
+		t.Fatalf("updated ids = %v, want [2 3]", ids)
+	}
+	if int(scores[0]) >= *freshScore {
+		t.Errorf("aged score = %d, want below fresh score %d", scores[0], *freshScore)
+	}
+	if tierChanges != 1 {
+		t.Errorf("tier changes = %d, want 1", tierChanges)
+	}
+}
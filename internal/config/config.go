@@ -1,10 +1,21 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
 )
 
 // Config holds all configuration for the application
@@ -22,6 +33,8 @@ type Config struct {
 	Judge      JudgeConfig      `mapstructure:"judge"`
 	Metrics    MetricsConfig    `mapstructure:"metrics"`
 	Health     HealthConfig     `mapstructure:"health"`
+	Lookup     LookupConfig     `mapstructure:"lookup"`
+	DNSBL      DNSBLConfig      `mapstructure:"dnsbl"`
 }
 
 // ServerConfig holds HTTP server configuration
@@ -31,6 +44,30 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	// TLS terminates HTTPS on the server itself; plaintext when unset
+	TLS TLSConfig `mapstructure:"tls"`
+	// TrustedProxies are the load balancers and reverse proxies (addresses
+	// or CIDRs) whose ProxyHeader (X-Forwarded-For or X-Real-IP) names the
+	// real client. Requests from any other peer are keyed by the peer itself.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	ProxyHeader    string   `mapstructure:"proxy_header"`
+}
+
+// TLSConfig holds the server certificate and optional client CA
+type TLSConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ClientCAFile requires clients to present a certificate signed by one
+	// of its CAs (mutual TLS)
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// ReloadInterval is how often the certificate files are checked for
+	// rotation (0 = only on SIGHUP)
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+// Enabled reports whether TLS is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
 }
 
 // LoggingConfig holds logging configuration
@@ -39,11 +76,48 @@ type LoggingConfig struct {
 	Format   string `mapstructure:"format"`
 	Output   string `mapstructure:"output"`
 	FilePath string `mapstructure:"file_path"`
+
+	// File rotation (output: file only)
+	MaxSizeMB  int  `mapstructure:"max_size_mb"`
+	MaxAgeDays int  `mapstructure:"max_age_days"`
+	MaxBackups int  `mapstructure:"max_backups"`
+	Compress   bool `mapstructure:"compress"`
 }
 
 // DatabaseConfig holds database configurations
 type DatabaseConfig struct {
-	Postgres PostgresConfig `mapstructure:"postgres"`
+	Postgres  PostgresConfig  `mapstructure:"postgres"`
+	Retention RetentionConfig `mapstructure:"retention"`
+
+	// UpsertStrategy selects how a repeated report of the same range by the same
+	// source updates the row: "max" keeps the highest confidence/weight, "latest"
+	// lets the newest report win
+	UpsertStrategy string `mapstructure:"upsert_strategy"`
+
+	// InsertStrategy selects how the ingestor writes a feed: "batch" upserts
+	// row by row, "bulk" COPYs into a temporary table first, and "auto" uses
+	// bulk once a feed has at least BulkInsertThreshold entries
+	InsertStrategy      string `mapstructure:"insert_strategy"`
+	BulkInsertThreshold int    `mapstructure:"bulk_insert_threshold"`
+}
+
+// RetentionConfig holds how long reputation entries are kept after they were last seen.
+// A zero duration keeps entries indefinitely.
+type RetentionConfig struct {
+	Default     time.Duration            `mapstructure:"default"`
+	ThreatTypes map[string]time.Duration `mapstructure:"threat_types"`
+
+	// CleanupInterval is how often the ingestor deletes expired entries and
+	// those past their retention (0 = never)
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
+
+// For returns the retention for a threat type, falling back to the default
+func (r RetentionConfig) For(threatType string) time.Duration {
+	if d, ok := r.ThreatTypes[strings.ToLower(threatType)]; ok {
+		return d
+	}
+	return r.Default
 }
 
 // PostgresConfig holds PostgreSQL configuration
@@ -54,18 +128,88 @@ type PostgresConfig struct {
 	Username        string        `mapstructure:"username"`
 	Password        string        `mapstructure:"password"`
 	SSLMode         string        `mapstructure:"ssl_mode"`
+	SSLRootCert     string        `mapstructure:"ssl_root_cert"` // CA bundle for verify-ca / verify-full
+	SSLCert         string        `mapstructure:"ssl_cert"`      // Client certificate for mTLS
+	SSLKey          string        `mapstructure:"ssl_key"`       // Client key for mTLS
 	MaxConnections  int           `mapstructure:"max_connections"`
 	MinConnections  int           `mapstructure:"min_connections"`
 	MaxConnLifetime time.Duration `mapstructure:"max_conn_lifetime"`
 	MaxConnIdleTime time.Duration `mapstructure:"max_conn_idle_time"`
+
+	// ConnectAttempts and ConnectRetryDelay control how long the ingestor and
+	// compiler wait for the database at startup; the delay doubles after each
+	// failed attempt, up to 30s
+	ConnectAttempts   int           `mapstructure:"connect_attempts"`
+	ConnectRetryDelay time.Duration `mapstructure:"connect_retry_delay"`
+
+	// ReadReplica optionally serves lookup queries from a separate pool
+	ReadReplica ReadReplicaConfig `mapstructure:"read_replica"`
+}
+
+// ReadReplicaConfig holds an optional PostgreSQL read replica; empty DSN disables it
+type ReadReplicaConfig struct {
+	DSN            string `mapstructure:"dsn"`
+	MaxConnections int    `mapstructure:"max_connections"`
+	MinConnections int    `mapstructure:"min_connections"`
+}
+
+// Enabled reports whether a read replica is configured
+func (r ReadReplicaConfig) Enabled() bool {
+	return r.DSN != ""
 }
 
 // DSN returns the PostgreSQL connection string
 func (p *PostgresConfig) DSN() string {
-	return fmt.Sprintf(
+	dsn := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		p.Host, p.Port, p.Username, p.Password, p.Database, p.SSLMode,
+		dsnValue(p.Host), p.Port, dsnValue(p.Username), dsnValue(p.Password), dsnValue(p.Database), dsnValue(p.SSLMode),
 	)
+
+	if p.SSLRootCert != "" {
+		dsn += " sslrootcert=" + dsnValue(p.SSLRootCert)
+	}
+	if p.SSLCert != "" {
+		dsn += " sslcert=" + dsnValue(p.SSLCert)
+	}
+	if p.SSLKey != "" {
+		dsn += " sslkey=" + dsnValue(p.SSLKey)
+	}
+
+	return dsn
+}
+
+// URL returns the PostgreSQL connection string in postgres:// URL form
+func (p *PostgresConfig) URL() string {
+	query := url.Values{}
+	query.Set("sslmode", p.SSLMode)
+	if p.SSLRootCert != "" {
+		query.Set("sslrootcert", p.SSLRootCert)
+	}
+	if p.SSLCert != "" {
+		query.Set("sslcert", p.SSLCert)
+	}
+	if p.SSLKey != "" {
+		query.Set("sslkey", p.SSLKey)
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(p.Username, p.Password),
+		Host:     net.JoinHostPort(p.Host, strconv.Itoa(p.Port)),
+		Path:     "/" + p.Database,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// dsnValue quotes a keyword/value DSN value when it is empty or contains spaces or quotes
+func dsnValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, " '\\") {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
 }
 
 // ClickHouseConfig holds ClickHouse configuration
@@ -76,6 +220,28 @@ type ClickHouseConfig struct {
 	Database string `mapstructure:"database"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+
+	// Days the api_requests and scan_results TTLs keep rows (0 = forever),
+	// applied by -migrate
+	RequestRetentionDays int `mapstructure:"request_retention_days"`
+	ScanRetentionDays    int `mapstructure:"scan_retention_days"`
+
+	// ClientIPMode stores the caller's IP in request logs as is (raw), with
+	// the host part zeroed (truncate) or as a keyed hash (hash, which needs
+	// ClientIPHashKey). The checked IP is always stored as is.
+	ClientIPMode    string `mapstructure:"client_ip_mode"`
+	ClientIPHashKey string `mapstructure:"client_ip_hash_key"`
+
+	// Breaker skips request and scan log writes while ClickHouse is failing
+	Breaker BreakerConfig `mapstructure:"breaker"`
+}
+
+// BreakerConfig configures the circuit breaker around an optional
+// dependency: after FailureThreshold consecutive failures its calls are
+// skipped for Cooldown, then one call probes it again (0 disables the breaker)
+type BreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	Cooldown         time.Duration `mapstructure:"cooldown"`
 }
 
 // RedisConfig holds Redis configuration
@@ -86,6 +252,22 @@ type RedisConfig struct {
 	Password string `mapstructure:"password"`
 	DB       int    `mapstructure:"db"`
 	PoolSize int    `mapstructure:"pool_size"`
+
+	// Mode is single (host/port), sentinel (addrs are the sentinels that
+	// monitor master_name) or cluster (addrs are seed nodes; db is ignored)
+	Mode             string   `mapstructure:"mode"`
+	Addrs            []string `mapstructure:"addrs"`
+	MasterName       string   `mapstructure:"master_name"`
+	SentinelPassword string   `mapstructure:"sentinel_password"`
+
+	// TTL is how long listed results are cached; CleanTTL applies to clean
+	// results and is kept shorter so newly listed IPs are picked up quickly
+	TTL      time.Duration `mapstructure:"ttl"`
+	CleanTTL time.Duration `mapstructure:"clean_ttl"`
+
+	// Breaker skips cache reads and writes while Redis is failing, so
+	// lookups go straight to the MMDB instead of waiting out timeouts
+	Breaker BreakerConfig `mapstructure:"breaker"`
 }
 
 // Addr returns the Redis address
@@ -98,20 +280,62 @@ type MMDBConfig struct {
 	ReputationPath   string        `mapstructure:"reputation_path"`
 	GeoLite2CityPath string        `mapstructure:"geolite2_city_path"`
 	GeoLite2ASNPath  string        `mapstructure:"geolite2_asn_path"`
+	AnonymousIPPath  string        `mapstructure:"anonymous_ip_path"` // Optional MaxMind GeoIP2-Anonymous-IP
 	OutputPath       string        `mapstructure:"output_path"`
 	ReloadInterval   time.Duration `mapstructure:"reload_interval"`
 	CompileInterval  time.Duration `mapstructure:"compile_interval"`
-	RecordSize       int           `mapstructure:"record_size"`
+	RecordSize       string        `mapstructure:"record_size"` // auto, 24, 28 or 32
 	MemoryMap        bool          `mapstructure:"memory_map"`
+
+	// FlaggedFilter keeps an in-memory bloom filter of the flagged prefixes
+	// so lookups of unlisted IPs skip Redis and the reputation lookup
+	FlaggedFilter       bool    `mapstructure:"flagged_filter"`
+	FlaggedFilterFPRate float64 `mapstructure:"flagged_filter_fp_rate"`
 }
 
 // ScoringConfig holds risk scoring configuration
 type ScoringConfig struct {
-	DecayLambda   float64        `mapstructure:"decay_lambda"`
-	MaxScore      int            `mapstructure:"max_score"`
-	RiskThreshold int            `mapstructure:"risk_threshold"`
-	Weights       map[string]int `mapstructure:"weights"`
-	ASNBonuses    map[string]int `mapstructure:"asn_bonuses"`
+	DecayLambda float64 `mapstructure:"decay_lambda"`
+	// DecayLambdas overrides decay_lambda per threat type
+	DecayLambdas map[string]float64 `mapstructure:"decay_lambdas"`
+	// ThreatTypeAliases map feed threat type labels to canonical types,
+	// extending the built-in aliases (c2 -> botnet_c2, bruteforce -> attack, ...)
+	ThreatTypeAliases map[string]string `mapstructure:"threat_type_aliases"`
+	MaxScore          int               `mapstructure:"max_score"`
+	RiskThreshold     int               `mapstructure:"risk_threshold"`
+	Weights           map[string]int    `mapstructure:"weights"`
+	ASNBonuses        map[string]int    `mapstructure:"asn_bonuses"`
+	// RiskThresholds are the minimum scores of the low, medium, high and
+	// critical risk levels; lower scores are clean
+	RiskThresholds RiskThresholdsConfig `mapstructure:"risk_thresholds"`
+	// Curve is linear (sum and clamp at max_score) or saturating (repeated
+	// threats of one type are damped by saturation_factor per extra report)
+	Curve            string  `mapstructure:"curve"`
+	SaturationFactor float64 `mapstructure:"saturation_factor"`
+	// ASNCacheTTL is how long ASN type classifications are cached
+	ASNCacheTTL time.Duration `mapstructure:"asn_cache_ttl"`
+	// HostingOrgKeywords classify ASNs missing from asn_info as hosting when
+	// their org name contains one of them (empty = built-in list)
+	HostingOrgKeywords []string `mapstructure:"hosting_org_keywords"`
+	// RecomputeInterval is how often the compiler re-applies time decay to
+	// stored risk scores (0 = disabled)
+	RecomputeInterval time.Duration `mapstructure:"recompute_interval"`
+	// TrustedASNs are CDN and cloud ASNs whose scores are capped at
+	// trusted_asn_max_score, complementing the IP whitelist
+	TrustedASNs        []int `mapstructure:"trusted_asns"`
+	TrustedASNMaxScore int   `mapstructure:"trusted_asn_max_score"`
+	// Profiles are named variants of this section for API key tiers that
+	// want a different sensitivity (see api.tier_scoring_profiles). Each
+	// holds scoring keys laid over the ones above; see Profile.
+	Profiles map[string]map[string]interface{} `mapstructure:"profiles"`
+}
+
+// RiskThresholdsConfig holds the risk level cutoffs
+type RiskThresholdsConfig struct {
+	Low      int `mapstructure:"low"`
+	Medium   int `mapstructure:"medium"`
+	High     int `mapstructure:"high"`
+	Critical int `mapstructure:"critical"`
 }
 
 // IngestorConfig holds ingestor service configuration
@@ -122,16 +346,80 @@ type IngestorConfig struct {
 	MaxRetries  int           `mapstructure:"max_retries"`
 	RetryDelay  time.Duration `mapstructure:"retry_delay"`
 	UserAgent   string        `mapstructure:"user_agent"`
+	InstanceID  string        `mapstructure:"instance_id"`
+	MaxFeedSize int64         `mapstructure:"max_feed_size"`
+
+	// MinPrefixLengthV4 and MinPrefixLengthV6 are the shortest prefixes a feed
+	// entry may have; broader ones (e.g. 0.0.0.0/0) are rejected (0 = no check)
+	MinPrefixLengthV4 int `mapstructure:"min_prefix_length_v4"`
+	MinPrefixLengthV6 int `mapstructure:"min_prefix_length_v6"`
+
+	// FeedTimeout bounds a whole feed run, all sources included; HTTPTimeout
+	// only bounds each request (0 = no deadline)
+	FeedTimeout time.Duration `mapstructure:"feed_timeout"`
+
+	// HTTP transport tuning
+	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+	ProxyURL            string        `mapstructure:"proxy_url"` // Empty uses HTTP(S)_PROXY from the environment
+
+	// S3 is the object store s3://bucket/key feed sources are read from
+	S3 S3Config `mapstructure:"s3"`
+}
+
+// S3Config holds an S3-compatible object store (AWS S3, MinIO, ...). Objects
+// are fetched path-style from Endpoint; requests are signed with Signature
+// Version 4 when AccessKey is set and sent anonymously otherwise.
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Region    string `mapstructure:"region"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
 }
 
 // APIConfig holds API configuration
 type APIConfig struct {
-	AuthEnabled     bool          `mapstructure:"auth_enabled"`
-	RateLimit       int           `mapstructure:"rate_limit"`
-	RateLimitWindow time.Duration `mapstructure:"rate_limit_window"`
-	BatchEnabled    bool          `mapstructure:"batch_enabled"`
-	BatchMaxSize    int           `mapstructure:"batch_max_size"`
-	CORS            CORSConfig    `mapstructure:"cors"`
+	AuthEnabled      bool           `mapstructure:"auth_enabled"`
+	RateLimit        int            `mapstructure:"rate_limit"`
+	RateLimitWindow  time.Duration  `mapstructure:"rate_limit_window"`
+	BatchEnabled     bool           `mapstructure:"batch_enabled"`
+	BatchMaxSize     int            `mapstructure:"batch_max_size"`
+	BatchConcurrency int            `mapstructure:"batch_concurrency"` // IPs of one batch request checked at once
+	ReportTiers      []string       `mapstructure:"report_tiers"`      // API key tiers allowed to submit reports
+	ExportTiers      []string       `mapstructure:"export_tiers"`      // API key tiers allowed to export blocklists
+	AnalyticsTiers   []string       `mapstructure:"analytics_tiers"`   // API key tiers allowed to read analytics dashboards
+	LiveLookupTiers  []string       `mapstructure:"live_lookup_tiers"` // API key tiers allowed to query Postgres directly
+	AdminTiers       []string       `mapstructure:"admin_tiers"`       // API key tiers allowed to manage the whitelist and use admin endpoints
+	KeyCacheTTL      time.Duration  `mapstructure:"key_cache_ttl"`     // How long looked up API keys are reused; 0 looks up every request
+	DocsEnabled      bool           `mapstructure:"docs_enabled"`      // Serve /openapi.json and Swagger UI at /docs
+	CORS             CORSConfig     `mapstructure:"cors"`
+	IPPolicy         IPPolicyConfig `mapstructure:"ip_policy"`
+	// WhitelistMinPrefixLengthV4 and WhitelistMinPrefixLengthV6 are the
+	// shortest prefixes that may be whitelisted; a broader one would hide
+	// large parts of the internet from the next compile
+	WhitelistMinPrefixLengthV4 int `mapstructure:"whitelist_min_prefix_length_v4"`
+	WhitelistMinPrefixLengthV6 int `mapstructure:"whitelist_min_prefix_length_v6"`
+	// TierScoringProfiles maps API key tiers to scoring.profiles entries;
+	// checks by keys of other tiers use the base scoring section
+	TierScoringProfiles map[string]string `mapstructure:"tier_scoring_profiles"`
+}
+
+// IPPolicyConfig selects the non-public address ranges that may be checked;
+// by default only public addresses are
+type IPPolicyConfig struct {
+	AllowPrivate  bool `mapstructure:"allow_private"`
+	AllowLoopback bool `mapstructure:"allow_loopback"`
+	AllowReserved bool `mapstructure:"allow_reserved"` // Multicast and unspecified
+}
+
+// CheckOptions returns the policy as IP validation options
+func (p IPPolicyConfig) CheckOptions() iputil.CheckOptions {
+	return iputil.CheckOptions{
+		AllowPrivate:  p.AllowPrivate,
+		AllowLoopback: p.AllowLoopback,
+		AllowReserved: p.AllowReserved,
+	}
 }
 
 // CORSConfig holds CORS configuration
@@ -153,6 +441,85 @@ type JudgeConfig struct {
 	ScanTimeout int           `mapstructure:"scan_timeout"`
 	ScanWorkers int           `mapstructure:"scan_workers"`
 	RateLimit   int           `mapstructure:"rate_limit"`
+	GRPCPort    int           `mapstructure:"grpc_port"`
+	// GRPCToken is the bearer token gRPC clients send in the authorization
+	// metadata; required when GRPCPort is set
+	GRPCToken string `mapstructure:"grpc_token"`
+	// PortScanMode "connect" gives every port the full scan_timeout; "fast"
+	// dials all ports at once (up to PortScanFastWorkers) with
+	// PortScanFastTimeout and re-dials those that did not answer in time
+	// with PortScanConfirmTimeout
+	PortScanMode           string        `mapstructure:"port_scan_mode"`
+	PortScanFastTimeout    time.Duration `mapstructure:"port_scan_fast_timeout"`
+	PortScanConfirmTimeout time.Duration `mapstructure:"port_scan_confirm_timeout"`
+	PortScanFastWorkers    int           `mapstructure:"port_scan_fast_workers"`
+	// BatchMaxSize caps the number of IPs per POST /check/batch request
+	// (0 or less = the default of 100)
+	BatchMaxSize int `mapstructure:"batch_max_size"`
+	// ScanBatchMaxSize and ScanBatchTimeout bound POST /scan/batch requests
+	// (a ScanBatchMaxSize of 0 or less = the default of 20)
+	ScanBatchMaxSize int           `mapstructure:"scan_batch_max_size"`
+	ScanBatchTimeout time.Duration `mapstructure:"scan_batch_timeout"`
+	// ScanCacheTTL is how long GET /scan/:ip and /scan/:ip/quick results are served
+	// from cache before the IP is probed again (0 = always scan)
+	ScanCacheTTL time.Duration `mapstructure:"scan_cache_ttl"`
+	// ExternalIP fixes the node's public IP for header inspection; when empty it
+	// is detected at startup and re-detected every ExternalIPRefresh (0 = never)
+	ExternalIP        string        `mapstructure:"external_ip"`
+	ExternalIPRefresh time.Duration `mapstructure:"external_ip_refresh"`
+	// UDP probing is opt-in per request (?udp=true); UDPRetries is the number of
+	// extra attempts per port after an unanswered probe
+	UDPPorts   []int         `mapstructure:"udp_ports"`
+	UDPTimeout time.Duration `mapstructure:"udp_timeout"`
+	UDPRetries int           `mapstructure:"udp_retries"`
+	// IPPolicy applies to lookups only; scans always target public addresses
+	IPPolicy IPPolicyConfig `mapstructure:"ip_policy"`
+	// PortHints maps a port to the proxy protocol (socks5, socks4, http or
+	// connect) probed on it first; the built-in hints cover the well-known
+	// SOCKS and HTTP proxy ports
+	PortHints map[int]string `mapstructure:"port_hints"`
+	// ProbeHosts are the destinations proxies are asked to reach; the first
+	// one that resolves at startup is used
+	ProbeHosts []string `mapstructure:"probe_hosts"`
+	// EchoURL is a plain HTTP endpoint that echoes request headers as
+	// {"headers": {...}}; HTTP proxies found by a scan fetch it to classify
+	// their anonymity
+	EchoURL string `mapstructure:"echo_url"`
+	// ShutdownTimeout bounds how long shutdown waits for in-flight scans
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// ReputationBackend "mmdb" serves checks from the compiled reputation
+	// MMDB; "index" loads an in-memory trie straight from PostgreSQL and
+	// rebuilds it every IndexRefreshInterval (0 = only on POST /reload)
+	ReputationBackend    string        `mapstructure:"reputation_backend"`
+	IndexRefreshInterval time.Duration `mapstructure:"index_refresh_interval"`
+}
+
+// UsesIndex reports whether the judge serves reputation from the in-memory index
+func (j JudgeConfig) UsesIndex() bool {
+	return j.ReputationBackend == "index"
+}
+
+// Batch sizes the judge uses when batch_max_size or scan_batch_max_size is
+// not positive
+const (
+	DefaultJudgeBatchMaxSize     = 100
+	DefaultJudgeScanBatchMaxSize = 20
+)
+
+// MaxBatchSize returns BatchMaxSize, or DefaultJudgeBatchMaxSize when it is not positive
+func (j JudgeConfig) MaxBatchSize() int {
+	if j.BatchMaxSize <= 0 {
+		return DefaultJudgeBatchMaxSize
+	}
+	return j.BatchMaxSize
+}
+
+// MaxScanBatchSize returns ScanBatchMaxSize, or DefaultJudgeScanBatchMaxSize when it is not positive
+func (j JudgeConfig) MaxScanBatchSize() int {
+	if j.ScanBatchMaxSize <= 0 {
+		return DefaultJudgeScanBatchMaxSize
+	}
+	return j.ScanBatchMaxSize
 }
 
 // MetricsConfig holds metrics configuration
@@ -168,6 +535,43 @@ type HealthConfig struct {
 	Path    string `mapstructure:"path"`
 }
 
+// LookupConfig holds how IP checks behave when reputation data is unavailable
+type LookupConfig struct {
+	// FailPolicy "open" answers a check whose reputation could not be read
+	// (no MMDB loaded, lookup error) as clean; "closed" fails it with 503
+	// instead, for callers that gate access on the result
+	FailPolicy string `mapstructure:"fail_policy"`
+	// Webhook posts lookups of high-risk IPs to an alerting endpoint
+	Webhook WebhookConfig `mapstructure:"webhook"`
+}
+
+// WebhookConfig holds the high-risk lookup webhook
+type WebhookConfig struct {
+	URL       string            `mapstructure:"url"`        // Empty disables the webhook
+	MinScore  int               `mapstructure:"min_score"`  // Lookups scoring at least this alert
+	RateLimit int               `mapstructure:"rate_limit"` // Alerts per minute (0 = unlimited)
+	Timeout   time.Duration     `mapstructure:"timeout"`
+	Headers   map[string]string `mapstructure:"headers"`
+}
+
+// DNSBLConfig holds the DNSBL responder the API serves over UDP, so mail
+// servers can query reputation as a DNS blocklist
+type DNSBLConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Listen    string        `mapstructure:"listen"`     // UDP address, e.g. ":5353"
+	Zone      string        `mapstructure:"zone"`       // e.g. "dnsbl.example.com"
+	Threshold int           `mapstructure:"threshold"`  // Minimum score for an IP to be listed
+	CleanTTL  time.Duration `mapstructure:"clean_ttl"`  // TTL of NXDOMAIN (clean) answers
+	ListedTTL time.Duration `mapstructure:"listed_ttl"` // TTL of listed answers
+	MaxCached int           `mapstructure:"max_cached"` // Answers cached at most (0 = unlimited)
+}
+
+// FailClosed reports whether checks fail rather than answer clean when
+// reputation data is unavailable
+func (c LookupConfig) FailClosed() bool {
+	return c.FailPolicy == "closed"
+}
+
 // Load loads configuration from file
 func Load(configPath string) (*Config, error) {
 	viper.SetConfigFile(configPath)
@@ -183,38 +587,280 @@ func Load(configPath string) (*Config, error) {
 
 	// Unmarshal config
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := viper.UnmarshalExact(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	return &cfg, nil
 }
 
-// LoadFromEnv loads configuration with environment variable overrides
-func LoadFromEnv(configPath string) (*Config, error) {
-	viper.SetConfigFile(configPath)
-	viper.SetConfigType("yaml")
+// EnvPrefix prefixes the environment variables that override config keys:
+// database.postgres.password is read from BEON_DATABASE_POSTGRES_PASSWORD
+const EnvPrefix = "BEON"
 
+// LoadFromEnv loads configuration with environment variable overrides. An
+// empty configPath skips the config file, leaving defaults and environment.
+func LoadFromEnv(configPath string) (*Config, error) {
 	// Enable environment variable overrides
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
+	bindEnv(reflect.TypeOf(Config{}), "")
 
 	// Set defaults
 	setDefaults()
 
 	// Read config file
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+	if configPath != "" {
+		viper.SetConfigFile(configPath)
+		viper.SetConfigType("yaml")
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
 	}
 
 	// Unmarshal config
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := viper.UnmarshalExact(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	return &cfg, nil
 }
 
+// bindEnv binds every leaf key of a config struct to its environment
+// variable; AutomaticEnv alone only covers keys viper already knows about
+// from the config file or defaults
+func bindEnv(t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if field.Type.Kind() == reflect.Struct {
+			bindEnv(field.Type, key)
+			continue
+		}
+		_ = viper.BindEnv(key)
+	}
+}
+
+// Validate checks that the fields every service depends on are set, naming
+// each offending key by its config path
+func (c *Config) Validate() error {
+	var errs []error
+	requirePort := func(path string, port int) {
+		if port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s: must be a port between 1 and 65535, got %d", path, port))
+		}
+	}
+	requireString := func(path, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s: is required", path))
+		}
+	}
+	requirePrefixLength := func(path string, bits, max int) {
+		if bits < 0 || bits > max {
+			errs = append(errs, fmt.Errorf("%s: must be between 0 and %d, got %d", path, max, bits))
+		}
+	}
+	validateBreaker := func(path string, b BreakerConfig) {
+		if b.FailureThreshold < 0 {
+			errs = append(errs, fmt.Errorf("%s.failure_threshold: must not be negative, got %d", path, b.FailureThreshold))
+		}
+		if b.FailureThreshold > 0 && b.Cooldown <= 0 {
+			errs = append(errs, fmt.Errorf("%s.cooldown: must be positive, got %v", path, b.Cooldown))
+		}
+	}
+
+	requirePort("server.port", c.Server.Port)
+	if tls := c.Server.TLS; (tls.CertFile == "") != (tls.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("server.tls: cert_file and key_file must be set together"))
+	} else if tls.ClientCAFile != "" && !tls.Enabled() {
+		errs = append(errs, fmt.Errorf("server.tls.client_ca_file: needs cert_file and key_file"))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: %q is not an IP address or CIDR", proxy))
+		}
+	}
+	if !strings.EqualFold(c.Server.ProxyHeader, "X-Forwarded-For") && !strings.EqualFold(c.Server.ProxyHeader, "X-Real-IP") {
+		errs = append(errs, fmt.Errorf("server.proxy_header: must be X-Forwarded-For or X-Real-IP, got %q", c.Server.ProxyHeader))
+	}
+	if c.Server.TLS.ReloadInterval < 0 {
+		errs = append(errs, fmt.Errorf("server.tls.reload_interval: must not be negative, got %v", c.Server.TLS.ReloadInterval))
+	}
+	requireString("database.postgres.host", c.Database.Postgres.Host)
+	requirePort("database.postgres.port", c.Database.Postgres.Port)
+	requireString("database.postgres.database", c.Database.Postgres.Database)
+	if c.ClickHouse.Enabled {
+		requireString("clickhouse.host", c.ClickHouse.Host)
+		requirePort("clickhouse.port", c.ClickHouse.Port)
+		if c.ClickHouse.RequestRetentionDays < 0 || c.ClickHouse.ScanRetentionDays < 0 {
+			errs = append(errs, fmt.Errorf("clickhouse: retention days must not be negative"))
+		}
+		switch c.ClickHouse.ClientIPMode {
+		case "", "raw", "truncate":
+		case "hash":
+			requireString("clickhouse.client_ip_hash_key", c.ClickHouse.ClientIPHashKey)
+		default:
+			errs = append(errs, fmt.Errorf("clickhouse.client_ip_mode: must be raw, truncate or hash, got %q", c.ClickHouse.ClientIPMode))
+		}
+		validateBreaker("clickhouse.breaker", c.ClickHouse.Breaker)
+	}
+	if c.Redis.Enabled {
+		switch c.Redis.Mode {
+		case "", "single":
+			requireString("redis.host", c.Redis.Host)
+			requirePort("redis.port", c.Redis.Port)
+		case "sentinel":
+			requireString("redis.master_name", c.Redis.MasterName)
+			if len(c.Redis.Addrs) == 0 {
+				errs = append(errs, fmt.Errorf("redis.addrs: is required in sentinel mode"))
+			}
+		case "cluster":
+			if len(c.Redis.Addrs) == 0 {
+				errs = append(errs, fmt.Errorf("redis.addrs: is required in cluster mode"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("redis.mode: must be single, sentinel or cluster, got %q", c.Redis.Mode))
+		}
+		validateBreaker("redis.breaker", c.Redis.Breaker)
+	}
+	if c.Ingestor.S3.AccessKey != "" {
+		requireString("ingestor.s3.endpoint", c.Ingestor.S3.Endpoint)
+		requireString("ingestor.s3.secret_key", c.Ingestor.S3.SecretKey)
+	}
+	requirePrefixLength("ingestor.min_prefix_length_v4", c.Ingestor.MinPrefixLengthV4, 32)
+	requirePrefixLength("ingestor.min_prefix_length_v6", c.Ingestor.MinPrefixLengthV6, 128)
+	requirePrefixLength("api.whitelist_min_prefix_length_v4", c.API.WhitelistMinPrefixLengthV4, 32)
+	requirePrefixLength("api.whitelist_min_prefix_length_v6", c.API.WhitelistMinPrefixLengthV6, 128)
+	if c.API.KeyCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("api.key_cache_ttl: must not be negative, got %v", c.API.KeyCacheTTL))
+	}
+	switch c.Database.InsertStrategy {
+	case "", "auto", "batch", "bulk":
+	default:
+		errs = append(errs, fmt.Errorf("database.insert_strategy: must be auto, batch or bulk, got %q", c.Database.InsertStrategy))
+	}
+	if c.Database.Retention.CleanupInterval < 0 {
+		errs = append(errs, fmt.Errorf("database.retention.cleanup_interval: must not be negative, got %v", c.Database.Retention.CleanupInterval))
+	}
+	if c.Database.BulkInsertThreshold < 0 {
+		errs = append(errs, fmt.Errorf("database.bulk_insert_threshold: must not be negative, got %d", c.Database.BulkInsertThreshold))
+	}
+	switch c.MMDB.RecordSize {
+	case "", "auto", "24", "28", "32":
+	default:
+		errs = append(errs, fmt.Errorf("mmdb.record_size: must be auto, 24, 28 or 32, got %q", c.MMDB.RecordSize))
+	}
+	if c.MMDB.FlaggedFilter && (c.MMDB.FlaggedFilterFPRate <= 0 || c.MMDB.FlaggedFilterFPRate >= 1) {
+		errs = append(errs, fmt.Errorf("mmdb.flagged_filter_fp_rate: must be between 0 and 1, got %v", c.MMDB.FlaggedFilterFPRate))
+	}
+	if c.Judge.Enabled {
+		requirePort("judge.port", c.Judge.Port)
+	}
+	if c.Judge.GRPCPort != 0 {
+		requirePort("judge.grpc_port", c.Judge.GRPCPort)
+		requireString("judge.grpc_token", c.Judge.GRPCToken)
+	}
+	for port, protocol := range c.Judge.PortHints {
+		switch protocol {
+		case "socks5", "socks4", "http", "connect":
+		default:
+			errs = append(errs, fmt.Errorf("judge.port_hints.%d: must be socks5, socks4, http or connect, got %q", port, protocol))
+		}
+	}
+	switch c.Judge.PortScanMode {
+	case "", "connect":
+	case "fast":
+		if c.Judge.PortScanFastTimeout <= 0 || c.Judge.PortScanConfirmTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("judge.port_scan_fast_timeout, judge.port_scan_confirm_timeout: must be positive in fast mode"))
+		}
+		if c.Judge.PortScanFastWorkers < 1 {
+			errs = append(errs, fmt.Errorf("judge.port_scan_fast_workers: must be at least 1, got %d", c.Judge.PortScanFastWorkers))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("judge.port_scan_mode: must be connect or fast, got %q", c.Judge.PortScanMode))
+	}
+	switch c.Judge.ReputationBackend {
+	case "mmdb", "index":
+	default:
+		errs = append(errs, fmt.Errorf("judge.reputation_backend: must be mmdb or index, got %q", c.Judge.ReputationBackend))
+	}
+	if c.Judge.IndexRefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("judge.index_refresh_interval: must not be negative, got %v", c.Judge.IndexRefreshInterval))
+	}
+	if c.Judge.ScanCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("judge.scan_cache_ttl: must not be negative, got %v", c.Judge.ScanCacheTTL))
+	}
+	if c.Metrics.Enabled {
+		requirePort("metrics.port", c.Metrics.Port)
+	}
+	switch c.Lookup.FailPolicy {
+	case "", "open", "closed":
+	default:
+		errs = append(errs, fmt.Errorf("lookup.fail_policy: must be open or closed, got %q", c.Lookup.FailPolicy))
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Scoring.Profiles)) {
+		if _, err := c.Scoring.Profile(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, tier := range slices.Sorted(maps.Keys(c.API.TierScoringProfiles)) {
+		if name := c.API.TierScoringProfiles[tier]; !hasKey(c.Scoring.Profiles, name) {
+			errs = append(errs, fmt.Errorf("api.tier_scoring_profiles.%s: no scoring profile %q", tier, name))
+		}
+	}
+	if c.DNSBL.Enabled {
+		requireString("dnsbl.listen", c.DNSBL.Listen)
+		requireString("dnsbl.zone", c.DNSBL.Zone)
+		if c.DNSBL.Threshold < 1 || c.DNSBL.Threshold > 100 {
+			errs = append(errs, fmt.Errorf("dnsbl.threshold: must be between 1 and 100, got %d", c.DNSBL.Threshold))
+		}
+		if c.DNSBL.CleanTTL <= 0 {
+			errs = append(errs, fmt.Errorf("dnsbl.clean_ttl: must be positive, got %v", c.DNSBL.CleanTTL))
+		}
+		if c.DNSBL.ListedTTL <= 0 {
+			errs = append(errs, fmt.Errorf("dnsbl.listed_ttl: must be positive, got %v", c.DNSBL.ListedTTL))
+		}
+		if c.DNSBL.MaxCached < 0 {
+			errs = append(errs, fmt.Errorf("dnsbl.max_cached: must not be negative, got %d", c.DNSBL.MaxCached))
+		}
+	}
+	if hook := c.Lookup.Webhook; hook.URL != "" {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("lookup.webhook.url: must be an http(s) URL, got %q", hook.URL))
+		}
+		if hook.MinScore < 0 || hook.MinScore > 100 {
+			errs = append(errs, fmt.Errorf("lookup.webhook.min_score: must be between 0 and 100, got %d", hook.MinScore))
+		}
+		if hook.RateLimit < 0 {
+			errs = append(errs, fmt.Errorf("lookup.webhook.rate_limit: must not be negative, got %d", hook.RateLimit))
+		}
+		if hook.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("lookup.webhook.timeout: must be positive, got %v", hook.Timeout))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func setDefaults() {
 	// Server defaults
 	viper.SetDefault("server.host", "0.0.0.0")
@@ -222,6 +868,11 @@ func setDefaults() {
 	viper.SetDefault("server.read_timeout", "5s")
 	viper.SetDefault("server.write_timeout", "10s")
 	viper.SetDefault("server.idle_timeout", "120s")
+	viper.SetDefault("server.tls.cert_file", "")
+	viper.SetDefault("server.tls.key_file", "")
+	viper.SetDefault("server.tls.client_ca_file", "")
+	viper.SetDefault("server.tls.reload_interval", "1m")
+	viper.SetDefault("server.proxy_header", "X-Forwarded-For")
 
 	// Environment
 	viper.SetDefault("environment", "development")
@@ -230,6 +881,10 @@ func setDefaults() {
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 	viper.SetDefault("logging.output", "stdout")
+	viper.SetDefault("logging.max_size_mb", 100)
+	viper.SetDefault("logging.max_age_days", 30)
+	viper.SetDefault("logging.max_backups", 10)
+	viper.SetDefault("logging.compress", true)
 
 	// PostgreSQL defaults
 	viper.SetDefault("database.postgres.host", "localhost")
@@ -238,16 +893,52 @@ func setDefaults() {
 	viper.SetDefault("database.postgres.ssl_mode", "disable")
 	viper.SetDefault("database.postgres.max_connections", 100)
 	viper.SetDefault("database.postgres.min_connections", 10)
+	viper.SetDefault("database.postgres.connect_attempts", 10)
+	viper.SetDefault("database.postgres.connect_retry_delay", "2s")
+	viper.SetDefault("database.upsert_strategy", "max")
+	viper.SetDefault("database.insert_strategy", "auto")
+	viper.SetDefault("database.bulk_insert_threshold", 20000)
+	viper.SetDefault("database.postgres.read_replica.max_connections", 50)
+	viper.SetDefault("database.postgres.read_replica.min_connections", 5)
+	viper.SetDefault("database.retention.default", "0s")
+	viper.SetDefault("database.retention.cleanup_interval", "1h")
+
+	// ClickHouse defaults
+	viper.SetDefault("clickhouse.request_retention_days", 90)
+	viper.SetDefault("clickhouse.scan_retention_days", 30)
+	viper.SetDefault("clickhouse.client_ip_mode", "raw")
+	viper.SetDefault("clickhouse.breaker.failure_threshold", 5)
+	viper.SetDefault("clickhouse.breaker.cooldown", "30s")
+
+	// Redis defaults
+	viper.SetDefault("redis.mode", "single")
+	viper.SetDefault("redis.ttl", "5m")
+	viper.SetDefault("redis.clean_ttl", "1m")
+	viper.SetDefault("redis.breaker.failure_threshold", 5)
+	viper.SetDefault("redis.breaker.cooldown", "30s")
 
 	// MMDB defaults
 	viper.SetDefault("mmdb.reputation_path", "./data/mmdb/reputation.mmdb")
 	viper.SetDefault("mmdb.reload_interval", "1h")
 	viper.SetDefault("mmdb.memory_map", true)
+	viper.SetDefault("mmdb.record_size", "auto")
+	viper.SetDefault("mmdb.flagged_filter", false)
+	viper.SetDefault("mmdb.flagged_filter_fp_rate", 0.01)
 
 	// Scoring defaults
 	viper.SetDefault("scoring.decay_lambda", 0.01)
 	viper.SetDefault("scoring.max_score", 100)
 	viper.SetDefault("scoring.risk_threshold", 50)
+	viper.SetDefault("scoring.risk_thresholds.low", 25)
+	viper.SetDefault("scoring.risk_thresholds.medium", 50)
+	viper.SetDefault("scoring.risk_thresholds.high", 70)
+	viper.SetDefault("scoring.risk_thresholds.critical", 85)
+	viper.SetDefault("scoring.curve", "linear")
+	viper.SetDefault("scoring.saturation_factor", 0.5)
+	viper.SetDefault("scoring.asn_cache_ttl", "1h")
+	viper.SetDefault("scoring.recompute_interval", "24h")
+	viper.SetDefault("scoring.trusted_asns", []int{})
+	viper.SetDefault("scoring.trusted_asn_max_score", 0)
 
 	// Ingestor defaults
 	viper.SetDefault("ingestor.enabled", true)
@@ -256,6 +947,18 @@ func setDefaults() {
 	viper.SetDefault("ingestor.max_retries", 3)
 	viper.SetDefault("ingestor.retry_delay", "5s")
 	viper.SetDefault("ingestor.user_agent", "BEON-IPQuality-Ingestor/1.0")
+	viper.SetDefault("ingestor.instance_id", "")
+	viper.SetDefault("ingestor.max_feed_size", 200*1024*1024)
+	viper.SetDefault("ingestor.min_prefix_length_v4", 8)
+	viper.SetDefault("ingestor.min_prefix_length_v6", 16)
+	viper.SetDefault("ingestor.feed_timeout", "10m")
+	viper.SetDefault("ingestor.max_idle_conns", 100)
+	viper.SetDefault("ingestor.max_idle_conns_per_host", 10)
+	viper.SetDefault("ingestor.idle_conn_timeout", "90s")
+	viper.SetDefault("ingestor.s3.endpoint", "")
+	viper.SetDefault("ingestor.s3.region", "us-east-1")
+	viper.SetDefault("ingestor.s3.access_key", "")
+	viper.SetDefault("ingestor.s3.secret_key", "")
 
 	// API defaults
 	viper.SetDefault("api.auth_enabled", true)
@@ -263,6 +966,35 @@ func setDefaults() {
 	viper.SetDefault("api.rate_limit_window", "1m")
 	viper.SetDefault("api.batch_enabled", true)
 	viper.SetDefault("api.batch_max_size", 100)
+	viper.SetDefault("api.batch_concurrency", 8)
+	viper.SetDefault("api.report_tiers", []string{"premium", "enterprise"})
+	viper.SetDefault("api.export_tiers", []string{"premium", "enterprise"})
+	viper.SetDefault("api.analytics_tiers", []string{"premium", "enterprise"})
+	viper.SetDefault("api.live_lookup_tiers", []string{"premium", "enterprise"})
+	viper.SetDefault("api.admin_tiers", []string{"admin"})
+	viper.SetDefault("api.key_cache_ttl", "1m")
+	viper.SetDefault("api.whitelist_min_prefix_length_v4", 8)
+	viper.SetDefault("api.whitelist_min_prefix_length_v6", 32)
+	viper.SetDefault("api.docs_enabled", true)
+
+	// Judge defaults
+	viper.SetDefault("judge.batch_max_size", DefaultJudgeBatchMaxSize)
+	viper.SetDefault("judge.scan_batch_max_size", DefaultJudgeScanBatchMaxSize)
+	viper.SetDefault("judge.scan_batch_timeout", "60s")
+	viper.SetDefault("judge.scan_cache_ttl", "5m")
+	viper.SetDefault("judge.port_scan_mode", "connect")
+	viper.SetDefault("judge.port_scan_fast_timeout", "300ms")
+	viper.SetDefault("judge.port_scan_confirm_timeout", "1s")
+	viper.SetDefault("judge.port_scan_fast_workers", 64)
+	viper.SetDefault("judge.external_ip_refresh", "10m")
+	viper.SetDefault("judge.udp_ports", []int{443, 1194, 1195, 1197})
+	viper.SetDefault("judge.udp_timeout", "1s")
+	viper.SetDefault("judge.udp_retries", 2)
+	viper.SetDefault("judge.shutdown_timeout", "30s")
+	viper.SetDefault("judge.reputation_backend", "mmdb")
+	viper.SetDefault("judge.index_refresh_interval", "5m")
+	viper.SetDefault("judge.probe_hosts", []string{"example.com", "www.cloudflare.com"})
+	viper.SetDefault("judge.echo_url", "http://httpbin.org/headers")
 
 	// Metrics defaults
 	viper.SetDefault("metrics.enabled", true)
@@ -272,4 +1004,19 @@ func setDefaults() {
 	// Health defaults
 	viper.SetDefault("health.enabled", true)
 	viper.SetDefault("health.path", "/health")
+
+	// Lookup defaults
+	viper.SetDefault("lookup.fail_policy", "open")
+	viper.SetDefault("lookup.webhook.url", "")
+	viper.SetDefault("lookup.webhook.min_score", 85)
+	viper.SetDefault("lookup.webhook.rate_limit", 60)
+	viper.SetDefault("lookup.webhook.timeout", "5s")
+
+	// DNSBL defaults
+	viper.SetDefault("dnsbl.enabled", false)
+	viper.SetDefault("dnsbl.listen", ":5353")
+	viper.SetDefault("dnsbl.threshold", 50)
+	viper.SetDefault("dnsbl.clean_ttl", "5m")
+	viper.SetDefault("dnsbl.listed_ttl", "1h")
+	viper.SetDefault("dnsbl.max_cached", 100000)
 }
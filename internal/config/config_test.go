@@ -0,0 +1,454 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestRetentionConfigFor(t *testing.T) {
+	r := RetentionConfig{
+		Default: 30 * 24 * time.Hour,
+		ThreatTypes: map[string]time.Duration{
+			"proxy":     72 * time.Hour,
+			"botnet_c2": 90 * 24 * time.Hour,
+			"tor":       0,
+		},
+	}
+
+	tests := []struct {
+		threatType string
+		expected   time.Duration
+	}{
+		{"proxy", 72 * time.Hour},
+		{"PROXY", 72 * time.Hour},
+		{"botnet_c2", 90 * 24 * time.Hour},
+		{"tor", 0},
+		{"spam", 30 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := r.For(tt.threatType); got != tt.expected {
+			t.Errorf("For(%q) = %v, want %v", tt.threatType, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadRetention(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `database:
+  retention:
+    default: 720h
+    threat_types:
+      proxy: 72h
+      Botnet_C2: 2160h
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	retention := cfg.Database.Retention
+	for threatType, want := range map[string]time.Duration{
+		"proxy":     72 * time.Hour,
+		"PROXY":     72 * time.Hour,
+		"botnet_c2": 2160 * time.Hour,
+		"unknown":   720 * time.Hour,
+	} {
+		if got := retention.For(threatType); got != want {
+			t.Errorf("For(%q) = %v, want %v", threatType, got, want)
+		}
+	}
+}
+
+func TestLoadRejectsMalformedConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "misspelled key",
+			content: `server:
+  prot: 8080
+`,
+			wantErr: "prot",
+		},
+		{
+			name: "unknown section",
+			content: `loging:
+  level: debug
+`,
+			wantErr: "loging",
+		},
+		{
+			name: "missing required field",
+			content: `database:
+  postgres:
+    host: ""
+`,
+			wantErr: "database.postgres.host",
+		},
+		{
+			name: "port out of range",
+			content: `redis:
+  enabled: true
+  host: localhost
+  port: 70000
+`,
+			wantErr: "redis.port",
+		},
+		{
+			name: "whitelist prefix length out of range",
+			content: `api:
+  whitelist_min_prefix_length_v6: 129
+`,
+			wantErr: "api.whitelist_min_prefix_length_v6",
+		},
+		{
+			name: "dnsbl without zone",
+			content: `dnsbl:
+  enabled: true
+`,
+			wantErr: "dnsbl.zone",
+		},
+		{
+			name: "negative key cache ttl",
+			content: `api:
+  key_cache_ttl: -1m
+`,
+			wantErr: "api.key_cache_ttl",
+		},
+		{
+			name: "grpc port without token",
+			content: `judge:
+  grpc_port: 9090
+`,
+			wantErr: "judge.grpc_token",
+		},
+		{
+			name: "sentinel without master",
+			content: `redis:
+  enabled: true
+  mode: sentinel
+  addrs: ["sentinel-1:26379"]
+`,
+			wantErr: "redis.master_name",
+		},
+		{
+			name: "flagged filter rate out of range",
+			content: `mmdb:
+  flagged_filter: true
+  flagged_filter_fp_rate: 1.5
+`,
+			wantErr: "mmdb.flagged_filter_fp_rate",
+		},
+		{
+			name: "unknown insert strategy",
+			content: `database:
+  insert_strategy: copy
+`,
+			wantErr: "database.insert_strategy",
+		},
+		{
+			name: "tls cert without key",
+			content: `server:
+  tls:
+    cert_file: /etc/beon/tls.crt
+`,
+			wantErr: "server.tls",
+		},
+		{
+			name: "client ca without server cert",
+			content: `server:
+  tls:
+    client_ca_file: /etc/beon/clients.pem
+`,
+			wantErr: "server.tls.client_ca_file",
+		},
+		{
+			name: "trusted proxy is not an address",
+			content: `server:
+  trusted_proxies: ["10.0.0.0/8", "lb.internal"]
+`,
+			wantErr: "server.trusted_proxies",
+		},
+		{
+			name: "unsupported proxy header",
+			content: `server:
+  proxy_header: Forwarded
+`,
+			wantErr: "server.proxy_header",
+		},
+		{
+			name: "breaker without cooldown",
+			content: `redis:
+  enabled: true
+  host: localhost
+  port: 6379
+  breaker:
+    failure_threshold: 3
+    cooldown: 0s
+`,
+			wantErr: "redis.breaker.cooldown",
+		},
+		{
+			name: "misspelled scoring profile key",
+			content: `scoring:
+  profiles:
+    bank:
+      decay_lamda: 0.001
+`,
+			wantErr: "scoring.profiles.bank",
+		},
+		{
+			name: "tier mapped to unknown scoring profile",
+			content: `api:
+  tier_scoring_profiles:
+    enterprise: bank
+`,
+			wantErr: "api.tier_scoring_profiles.enterprise",
+		},
+		{
+			name: "webhook without http url",
+			content: `lookup:
+  webhook:
+    url: alerts.example.com/hook
+`,
+			wantErr: "lookup.webhook.url",
+		},
+		{
+			name: "unsupported record size",
+			content: `mmdb:
+  record_size: 30
+`,
+			wantErr: "mmdb.record_size",
+		},
+		{
+			name: "unknown port scan mode",
+			content: `judge:
+  port_scan_mode: syn
+`,
+			wantErr: "judge.port_scan_mode",
+		},
+		{
+			name: "unknown port hint protocol",
+			content: `judge:
+  port_hints:
+    1080: socks6
+`,
+			wantErr: "judge.port_hints.1080",
+		},
+		{
+			name: "unknown reputation backend",
+			content: `judge:
+  reputation_backend: redis
+`,
+			wantErr: "judge.reputation_backend",
+		},
+		{
+			name: "unknown fail policy",
+			content: `lookup:
+  fail_policy: deny
+`,
+			wantErr: "lookup.fail_policy",
+		},
+		{
+			name: "client IP hash without key",
+			content: `clickhouse:
+  enabled: true
+  host: localhost
+  port: 9000
+  client_ip_mode: hash
+`,
+			wantErr: "clickhouse.client_ip_hash_key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadServerTLS(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `server:
+  tls:
+    cert_file: /etc/beon/tls.crt
+    key_file: /etc/beon/tls.key
+    client_ca_file: /etc/beon/clients.pem
+    reload_interval: 30s
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := TLSConfig{CertFile: "/etc/beon/tls.crt", KeyFile: "/etc/beon/tls.key", ClientCAFile: "/etc/beon/clients.pem", ReloadInterval: 30 * time.Second}
+	if cfg.Server.TLS != want || !cfg.Server.TLS.Enabled() {
+		t.Errorf("Server.TLS = %+v, want %+v", cfg.Server.TLS, want)
+	}
+
+	viper.Reset()
+	cfg, err = Load("../../configs/config.yaml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.TLS.Enabled() {
+		t.Error("the shipped config enables TLS, want plaintext by default")
+	}
+}
+
+func TestScoringProfile(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `scoring:
+  decay_lambda: 0.01
+  decay_lambdas:
+    tor: 0.05
+    proxy: 0.03
+  trusted_asns: [13335]
+  profiles:
+    bank:
+      decay_lambda: 0.002
+      decay_lambdas:
+        proxy: 0.01
+      risk_thresholds:
+        low: 10
+        medium: 25
+    analytics:
+      curve: saturating
+      trusted_asns: []
+api:
+  tier_scoring_profiles:
+    enterprise: bank
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.API.TierScoringProfiles["enterprise"]; got != "bank" {
+		t.Errorf("tier_scoring_profiles.enterprise = %q, want bank", got)
+	}
+
+	bank, err := cfg.Scoring.Profile("bank")
+	if err != nil {
+		t.Fatalf("Profile(bank) error = %v", err)
+	}
+	if bank.DecayLambda != 0.002 {
+		t.Errorf("bank decay_lambda = %v, want 0.002", bank.DecayLambda)
+	}
+	if bank.DecayLambdas["proxy"] != 0.01 || bank.DecayLambdas["tor"] != 0.05 {
+		t.Errorf("bank decay_lambdas = %v, want proxy overridden and tor kept", bank.DecayLambdas)
+	}
+	want := RiskThresholdsConfig{Low: 10, Medium: 25, High: 70, Critical: 85}
+	if bank.RiskThresholds != want {
+		t.Errorf("bank risk_thresholds = %+v, want %+v", bank.RiskThresholds, want)
+	}
+	if bank.ASNCacheTTL != cfg.Scoring.ASNCacheTTL || bank.Curve != "linear" || bank.Profiles != nil {
+		t.Errorf("bank = %+v, want the base section's other keys and no profiles", bank)
+	}
+
+	analytics, err := cfg.Scoring.Profile("analytics")
+	if err != nil {
+		t.Fatalf("Profile(analytics) error = %v", err)
+	}
+	if analytics.Curve != "saturating" || len(analytics.TrustedASNs) != 0 || analytics.DecayLambda != 0.01 {
+		t.Errorf("analytics = curve %s, trusted_asns %v, decay_lambda %v; want saturating, none, 0.01",
+			analytics.Curve, analytics.TrustedASNs, analytics.DecayLambda)
+	}
+	if cfg.Scoring.DecayLambdas["proxy"] != 0.03 || len(cfg.Scoring.TrustedASNs) != 1 {
+		t.Errorf("base scoring = %v, %v; profiles must not modify it", cfg.Scoring.DecayLambdas, cfg.Scoring.TrustedASNs)
+	}
+
+	if _, err := cfg.Scoring.Profile("retail"); err == nil {
+		t.Error("Profile(retail) succeeded, want an unknown profile error")
+	}
+}
+
+func TestLoadFromEnvOverrides(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	t.Setenv("BEON_DATABASE_POSTGRES_PASSWORD", "from-env")
+	t.Setenv("BEON_DATABASE_POSTGRES_SSL_ROOT_CERT", "/etc/ssl/ca.pem")
+	t.Setenv("BEON_REDIS_TTL", "10m")
+	t.Setenv("BEON_API_REPORT_TIERS", "enterprise")
+
+	cfg, err := LoadFromEnv("../../configs/config.yaml")
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+
+	if cfg.Database.Postgres.Password != "from-env" {
+		t.Errorf("postgres password = %q, want from-env", cfg.Database.Postgres.Password)
+	}
+	if cfg.Database.Postgres.SSLRootCert != "/etc/ssl/ca.pem" {
+		t.Errorf("postgres ssl_root_cert = %q, want /etc/ssl/ca.pem", cfg.Database.Postgres.SSLRootCert)
+	}
+	if cfg.Redis.TTL != 10*time.Minute {
+		t.Errorf("redis ttl = %v, want 10m", cfg.Redis.TTL)
+	}
+	if len(cfg.API.ReportTiers) != 1 || cfg.API.ReportTiers[0] != "enterprise" {
+		t.Errorf("api report_tiers = %v, want [enterprise]", cfg.API.ReportTiers)
+	}
+}
+
+func TestLoadFromEnvWithoutConfigFile(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	t.Setenv("BEON_DATABASE_POSTGRES_HOST", "db.internal")
+	t.Setenv("BEON_SERVER_PORT", "9000")
+
+	cfg, err := LoadFromEnv("")
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+
+	if cfg.Database.Postgres.Host != "db.internal" {
+		t.Errorf("postgres host = %q, want db.internal", cfg.Database.Postgres.Host)
+	}
+	if cfg.Server.Port != 9000 {
+		t.Errorf("server port = %d, want 9000", cfg.Server.Port)
+	}
+	if cfg.Metrics.Path != "/metrics" {
+		t.Errorf("metrics path = %q, want default /metrics", cfg.Metrics.Path)
+	}
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
 )
 
@@ -24,6 +28,16 @@ type FeedConfig struct {
 	Weight      int            `mapstructure:"weight"`
 	Schedule    string         `mapstructure:"schedule"`
 	Sources     []SourceConfig `mapstructure:"sources"`
+	// MinEntries is the fewest valid entries a run's sources may yield in total
+	// once the feed has had a run with at least that many; smaller runs are
+	// rejected and none of their sources stored (0 = no check)
+	MinEntries int `mapstructure:"min_entries"`
+	// MinPrefixLengthV4 and MinPrefixLengthV6 override the ingestor's limits
+	// on how broad an entry may be (0 = use the ingestor's)
+	MinPrefixLengthV4 int `mapstructure:"min_prefix_length_v4"`
+	MinPrefixLengthV6 int `mapstructure:"min_prefix_length_v6"`
+	// Timeout overrides ingestor.feed_timeout for this feed (0 = use it)
+	Timeout time.Duration `mapstructure:"timeout"`
 }
 
 // SourceConfig holds configuration for a feed source
@@ -31,6 +45,10 @@ type SourceConfig struct {
 	URL    string `mapstructure:"url"`
 	Format string `mapstructure:"format"`
 	Name   string `mapstructure:"name"`
+	// UserAgent overrides ingestor.user_agent for this source; Headers are
+	// extra request headers (names are case-insensitive)
+	UserAgent string            `mapstructure:"user_agent"`
+	Headers   map[string]string `mapstructure:"headers"`
 }
 
 // Format defines how to parse a feed
@@ -38,6 +56,40 @@ type Format struct {
 	Description   string `mapstructure:"description"`
 	CommentPrefix string `mapstructure:"comment_prefix"`
 	Separator     string `mapstructure:"separator"`
+
+	// Parser selects the parser of a custom format: csv, json, ip_range or
+	// firehol. The formats of the same names use it implicitly.
+	Parser string `mapstructure:"parser"`
+	// IPField, TagsField, DescriptionField and FirstSeenField locate values
+	// in a record: a 1-based column number for csv, an object key for json.
+	// TagSeparator splits a tags string into several tags (empty = one tag).
+	IPField          string `mapstructure:"ip_field"`
+	TagsField        string `mapstructure:"tags_field"`
+	DescriptionField string `mapstructure:"description_field"`
+	FirstSeenField   string `mapstructure:"first_seen_field"`
+	TagSeparator     string `mapstructure:"tag_separator"`
+}
+
+// validate checks the structured parser settings of a format
+func (f Format) validate(name string) error {
+	parser := f.Parser
+	if parser == "" {
+		parser = name
+	}
+	switch parser {
+	case "json", "ip_range", "firehol":
+	case "csv":
+		for _, field := range []string{f.IPField, f.TagsField, f.DescriptionField, f.FirstSeenField} {
+			if n, err := strconv.Atoi(field); field != "" && (err != nil || n < 1) {
+				return fmt.Errorf("format %s: csv fields must be 1-based column numbers, got %q", name, field)
+			}
+		}
+	default:
+		if f.Parser != "" {
+			return fmt.Errorf("format %s: unknown parser %q (must be csv, json, ip_range or firehol)", name, f.Parser)
+		}
+	}
+	return nil
 }
 
 // WhitelistConfig holds whitelist configuration
@@ -64,13 +116,74 @@ func LoadFeeds(configPath string) (*FeedsConfig, error) {
 	}
 
 	var cfg FeedsConfig
-	if err := v.Unmarshal(&cfg); err != nil {
+	if err := v.UnmarshalExact(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal feeds config: %w", err)
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid feeds config: %w", err)
+	}
+
 	return &cfg, nil
 }
 
+// Validate checks that every enabled feed has a parseable cron schedule, a
+// non-negative min_entries, valid prefix length limits and a URL for each
+// source
+func (fc *FeedsConfig) Validate() error {
+	names := make([]string, 0, len(fc.Feeds))
+	for name := range fc.Feeds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		feed := fc.Feeds[name]
+		if !feed.Enabled {
+			continue
+		}
+		if feed.MinEntries < 0 {
+			errs = append(errs, fmt.Errorf("feed %s: min_entries must not be negative, got %d", name, feed.MinEntries))
+		}
+		if feed.MinPrefixLengthV4 < 0 || feed.MinPrefixLengthV4 > 32 {
+			errs = append(errs, fmt.Errorf("feed %s: min_prefix_length_v4 must be between 0 and 32, got %d", name, feed.MinPrefixLengthV4))
+		}
+		if feed.MinPrefixLengthV6 < 0 || feed.MinPrefixLengthV6 > 128 {
+			errs = append(errs, fmt.Errorf("feed %s: min_prefix_length_v6 must be between 0 and 128, got %d", name, feed.MinPrefixLengthV6))
+		}
+		if feed.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("feed %s: timeout must not be negative, got %v", name, feed.Timeout))
+		}
+		for i, src := range feed.Sources {
+			if src.URL == "" {
+				errs = append(errs, fmt.Errorf("feed %s: sources[%d].url is required", name, i))
+			}
+		}
+		if feed.Schedule == "" {
+			errs = append(errs, fmt.Errorf("feed %s: schedule is required", name))
+			continue
+		}
+		if _, err := cron.ParseStandard(feed.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("feed %s: invalid schedule %q: %w", name, feed.Schedule, err))
+		}
+	}
+
+	formats := make([]string, 0, len(fc.Formats))
+	for name := range fc.Formats {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+
+	for _, name := range formats {
+		if err := fc.Formats[name].validate(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // GetEnabledFeeds returns only enabled feeds
 func (fc *FeedsConfig) GetEnabledFeeds() map[string]FeedConfig {
 	enabled := make(map[string]FeedConfig)
@@ -108,3 +221,12 @@ func ParseSchedule(schedule string) (time.Duration, error) {
 		return 0, nil
 	}
 }
+
+// NextRun returns the next time a feed schedule fires after the given time
+func NextRun(schedule string, from time.Time) (time.Time, error) {
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid schedule %q: %w", schedule, err)
+	}
+	return sched.Next(from), nil
+}
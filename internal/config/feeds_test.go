@@ -0,0 +1,190 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFeedsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		feeds   map[string]FeedConfig
+		wantErr []string
+	}{
+		{
+			name: "valid schedules",
+			feeds: map[string]FeedConfig{
+				"hourly":  {Enabled: true, Schedule: "@hourly"},
+				"cron":    {Enabled: true, Schedule: "*/15 * * * *"},
+				"weekly":  {Enabled: true, Schedule: "@weekly"},
+				"unknown": {Enabled: false, Schedule: "not a cron"},
+			},
+		},
+		{
+			name: "invalid cron expression",
+			feeds: map[string]FeedConfig{
+				"broken": {Enabled: true, Schedule: "*/15 * * *"},
+			},
+			wantErr: []string{"feed broken", `"*/15 * * *"`},
+		},
+		{
+			name: "missing schedule",
+			feeds: map[string]FeedConfig{
+				"empty": {Enabled: true},
+			},
+			wantErr: []string{"feed empty: schedule is required"},
+		},
+		{
+			name: "negative min_entries",
+			feeds: map[string]FeedConfig{
+				"guarded": {Enabled: true, Schedule: "@hourly", MinEntries: -1},
+			},
+			wantErr: []string{"feed guarded: min_entries must not be negative"},
+		},
+		{
+			name: "errors are aggregated",
+			feeds: map[string]FeedConfig{
+				"a_feed": {Enabled: true, Schedule: "@every-day"},
+				"b_feed": {Enabled: true, Schedule: "61 * * * *"},
+			},
+			wantErr: []string{"feed a_feed", "feed b_feed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := &FeedsConfig{Feeds: tt.feeds}
+			err := fc.Validate()
+
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want error containing %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFeedsConfigValidateFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		formats map[string]Format
+		wantErr string
+	}{
+		{"plain formats", map[string]Format{"plain": {CommentPrefix: "#"}, "netset": {}}, ""},
+		{"csv columns", map[string]Format{"tagged": {Parser: "csv", IPField: "2", TagsField: "4"}}, ""},
+		{"json keys", map[string]Format{"json": {IPField: "ip_address", TagsField: "malware"}}, ""},
+		{"csv field name", map[string]Format{"csv": {IPField: "ip"}}, "format csv: csv fields must be 1-based column numbers"},
+		{"csv column zero", map[string]Format{"tagged": {Parser: "csv", TagsField: "0"}}, "format tagged: csv fields"},
+		{"ip_range parser", map[string]Format{"ranges": {Parser: "ip_range"}}, ""},
+		{"unknown parser", map[string]Format{"xml_feed": {Parser: "xml"}}, `format xml_feed: unknown parser "xml"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&FeedsConfig{Formats: tt.formats}).Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFeedsRejectsInvalidSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feeds.yaml")
+	content := `feeds:
+  typo_feed:
+    enabled: true
+    name: "Typo Feed"
+    schedule: "0 */2 * *"
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write feeds config: %v", err)
+	}
+
+	_, err := LoadFeeds(path)
+	if err == nil {
+		t.Fatal("LoadFeeds() error = nil, want invalid schedule error")
+	}
+	if !strings.Contains(err.Error(), "typo_feed") {
+		t.Errorf("LoadFeeds() error = %q, want it to name the feed", err)
+	}
+}
+
+func TestLoadFeedsRejectsMalformedConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "misspelled feed key",
+			content: `feeds:
+  typo_feed:
+    enabled: true
+    schedul: "@hourly"
+`,
+			wantErr: "schedul",
+		},
+		{
+			name: "source without url",
+			content: `feeds:
+  typo_feed:
+    enabled: true
+    schedule: "@hourly"
+    sources:
+      - name: primary
+        format: plain
+`,
+			wantErr: "feed typo_feed: sources[0].url is required",
+		},
+		{
+			name: "prefix length out of range",
+			content: `feeds:
+  broad_feed:
+    enabled: true
+    schedule: "@hourly"
+    min_prefix_length_v4: 33
+`,
+			wantErr: "feed broad_feed: min_prefix_length_v4 must be between 0 and 32",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "feeds.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("failed to write feeds config: %v", err)
+			}
+
+			_, err := LoadFeeds(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFeeds() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFeedsShippedConfig(t *testing.T) {
+	if _, err := LoadFeeds("../../configs/feeds.yaml"); err != nil {
+		t.Fatalf("LoadFeeds() error = %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestPostgresTLSConfigParsing(t *testing.T) {
+	dir := t.TempDir()
+	caPath, certPath, keyPath := writeTestCerts(t, dir)
+
+	cfg := PostgresConfig{
+		Host:        "db.example.com",
+		Port:        5432,
+		Database:    "beon_ipquality",
+		Username:    "beon",
+		Password:    "p@ss word'",
+		SSLMode:     "verify-full",
+		SSLRootCert: caPath,
+		SSLCert:     certPath,
+		SSLKey:      keyPath,
+	}
+
+	for name, dsn := range map[string]string{"DSN": cfg.DSN(), "URL": cfg.URL()} {
+		t.Run(name, func(t *testing.T) {
+			poolConfig, err := pgxpool.ParseConfig(dsn)
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+
+			conn := poolConfig.ConnConfig
+			if conn.Host != "db.example.com" || conn.Port != 5432 || conn.Database != "beon_ipquality" {
+				t.Errorf("parsed %s:%d/%s, want db.example.com:5432/beon_ipquality", conn.Host, conn.Port, conn.Database)
+			}
+			if conn.Password != "p@ss word'" {
+				t.Errorf("password = %q, want it preserved", conn.Password)
+			}
+
+			tlsConfig := conn.TLSConfig
+			if tlsConfig == nil {
+				t.Fatal("TLSConfig is nil, want verify-full TLS")
+			}
+			if tlsConfig.ServerName != "db.example.com" {
+				t.Errorf("ServerName = %q, want db.example.com", tlsConfig.ServerName)
+			}
+			if tlsConfig.RootCAs == nil {
+				t.Error("RootCAs not loaded from ssl_root_cert")
+			}
+			if len(tlsConfig.Certificates) != 1 {
+				t.Errorf("client certificates = %d, want 1 from ssl_cert/ssl_key", len(tlsConfig.Certificates))
+			}
+		})
+	}
+}
+
+func TestPostgresDSNWithoutTLSFiles(t *testing.T) {
+	cfg := PostgresConfig{Host: "localhost", Port: 5432, Database: "beon", Username: "beon", Password: "secret", SSLMode: "disable"}
+
+	want := "host=localhost port=5432 user=beon password=secret dbname=beon sslmode=disable"
+	if got := cfg.DSN(); got != want {
+		t.Errorf("DSN() = %q, want %q", got, want)
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL())
+	if err != nil {
+		t.Fatalf("ParseConfig(URL()) error = %v", err)
+	}
+	if poolConfig.ConnConfig.TLSConfig != nil {
+		t.Error("TLSConfig set with sslmode=disable")
+	}
+}
+
+// writeTestCerts writes a self-signed CA and a client certificate/key signed by it
+func writeTestCerts(t *testing.T, dir string) (caPath, certPath, keyPath string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create CA cert: %v", err)
+	}
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate client key: %v", err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "beon"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caTemplate, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create client cert: %v", err)
+	}
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatalf("marshal client key: %v", err)
+	}
+
+	caPath = filepath.Join(dir, "root.crt")
+	certPath = filepath.Join(dir, "client.crt")
+	keyPath = filepath.Join(dir, "client.key")
+
+	writePEM(t, caPath, "CERTIFICATE", caDER)
+	writePEM(t, certPath, "CERTIFICATE", clientDER)
+	writePEM(t, keyPath, "EC PRIVATE KEY", clientKeyDER)
+
+	return caPath, certPath, keyPath
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
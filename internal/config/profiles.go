@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Profile returns the scoring section with the named profile's keys laid
+// over it. Nested maps such as decay_lambdas and risk_thresholds are merged
+// key by key; other values, lists included, replace the base value.
+func (s ScoringConfig) Profile(name string) (ScoringConfig, error) {
+	overrides, ok := s.Profiles[name]
+	if !ok {
+		return ScoringConfig{}, fmt.Errorf("scoring.profiles: no profile %q", name)
+	}
+
+	base := s
+	base.Profiles = nil
+	var settings map[string]interface{}
+	if err := mapstructure.Decode(base, &settings); err != nil {
+		return ScoringConfig{}, fmt.Errorf("scoring.profiles.%s: %w", name, err)
+	}
+
+	var profile ScoringConfig
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           &profile,
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return ScoringConfig{}, err
+	}
+	if err := dec.Decode(mergeSettings(settings, overrides)); err != nil {
+		return ScoringConfig{}, fmt.Errorf("scoring.profiles.%s: %w", name, err)
+	}
+	if profile.Profiles != nil {
+		return ScoringConfig{}, fmt.Errorf("scoring.profiles.%s: profiles cannot be nested", name)
+	}
+	return profile, nil
+}
+
+// mergeSettings returns base with overrides applied, merging maps present
+// in both
+func mergeSettings(base, overrides map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		k = strings.ToLower(k)
+		if o, ok := v.(map[string]interface{}); ok {
+			if b := stringMap(merged[k]); b != nil {
+				merged[k] = mergeSettings(b, o)
+				continue
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// stringMap copies a map with string keys of any value type, or returns nil
+// when v is not one
+func stringMap(v interface{}) map[string]interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	m := make(map[string]interface{}, rv.Len())
+	for iter := rv.MapRange(); iter.Next(); {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m
+}
+
+// hasKey reports whether m has key, even with a nil value
+func hasKey[V any](m map[string]V, key string) bool {
+	_, ok := m[key]
+	return ok
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Changes lists the keys whose values differ between two configs by their
+// config path (e.g. scoring.weights), in the order they are declared
+func Changes(old, cur *Config) []string {
+	var keys []string
+	diffStruct(reflect.ValueOf(*old), reflect.ValueOf(*cur), "", &keys)
+	return keys
+}
+
+// diffStruct appends the paths of the leaf fields that differ between a and b
+func diffStruct(a, b reflect.Value, prefix string, keys *[]string) {
+	for i := 0; i < a.NumField(); i++ {
+		key := a.Type().Field(i).Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		fa, fb := a.Field(i), b.Field(i)
+		if fa.Kind() == reflect.Struct {
+			diffStruct(fa, fb, key, keys)
+			continue
+		}
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			*keys = append(*keys, key)
+		}
+	}
+}
+
+// SplitChanges separates changed keys into those at or below one of the
+// reloadable keys and those that only take effect after a restart
+func SplitChanges(keys []string, reloadable ...string) (applied, restart []string) {
+	for _, key := range keys {
+		if matchesKey(key, reloadable) {
+			applied = append(applied, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	return applied, restart
+}
+
+// matchesKey reports whether key is one of prefixes or nested below one
+func matchesKey(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if key == p || strings.HasPrefix(key, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedsChanges lists the feeds and formats added, removed or modified in cur
+// relative to old (e.g. feeds.spamhaus_drop, formats.csv), plus whitelist
+// when the whitelist changed
+func FeedsChanges(old, cur *FeedsConfig) []string {
+	keys := append(diffMap("feeds", old.Feeds, cur.Feeds), diffMap("formats", old.Formats, cur.Formats)...)
+	if !reflect.DeepEqual(old.Whitelist, cur.Whitelist) {
+		keys = append(keys, "whitelist")
+	}
+	return keys
+}
+
+// diffMap returns the sorted paths of the entries that differ between a and b
+func diffMap[V any](prefix string, a, b map[string]V) []string {
+	var keys []string
+	for name, va := range a {
+		if vb, ok := b[name]; !ok || !reflect.DeepEqual(va, vb) {
+			keys = append(keys, prefix+"."+name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			keys = append(keys, prefix+"."+name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	old := &Config{}
+	old.Server.Port = 8080
+	old.API.RateLimit = 1000
+	old.Scoring.Weights = map[string]int{"spam": 20}
+
+	cur := &Config{}
+	cur.Server.Port = 8081
+	cur.API.RateLimit = 500
+	cur.Scoring.Weights = map[string]int{"spam": 30}
+	cur.Database.Postgres.Password = "rotated"
+
+	got := Changes(old, cur)
+	want := []string{"server.port", "database.postgres.password", "scoring.weights", "api.rate_limit"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Changes() = %v, want %v", got, want)
+	}
+
+	applied, restart := SplitChanges(got, "scoring", "api.rate_limit")
+	if want := []string{"scoring.weights", "api.rate_limit"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	if want := []string{"server.port", "database.postgres.password"}; !reflect.DeepEqual(restart, want) {
+		t.Errorf("restart = %v, want %v", restart, want)
+	}
+
+	if got := Changes(old, old); len(got) != 0 {
+		t.Errorf("Changes() of identical configs = %v, want none", got)
+	}
+}
+
+func TestSplitChangesMatchesWholeKeys(t *testing.T) {
+	applied, restart := SplitChanges([]string{"api.rate_limit_window"}, "api.rate_limit")
+	if len(applied) != 0 || len(restart) != 1 {
+		t.Errorf("SplitChanges() = %v, %v, want api.rate_limit_window to need a restart", applied, restart)
+	}
+}
+
+func TestFeedsChanges(t *testing.T) {
+	old := &FeedsConfig{
+		Feeds: map[string]FeedConfig{
+			"kept":    {Enabled: true, Schedule: "@hourly"},
+			"changed": {Enabled: true, Schedule: "@hourly"},
+			"removed": {Enabled: true, Schedule: "@daily"},
+		},
+		Formats: map[string]Format{"plain": {CommentPrefix: "#"}},
+	}
+	cur := &FeedsConfig{
+		Feeds: map[string]FeedConfig{
+			"kept":    {Enabled: true, Schedule: "@hourly"},
+			"changed": {Enabled: true, Schedule: "*/30 * * * *"},
+			"added":   {Enabled: true, Schedule: "@daily"},
+		},
+		Formats:   map[string]Format{"plain": {CommentPrefix: ";"}},
+		Whitelist: WhitelistConfig{Enabled: true},
+	}
+
+	got := FeedsChanges(old, cur)
+	want := []string{"feeds.added", "feeds.changed", "feeds.removed", "formats.plain", "whitelist"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FeedsChanges() = %v, want %v", got, want)
+	}
+}
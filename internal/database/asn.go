@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// UpsertASNInfo inserts or replaces asn_info rows in a single transaction and
+// reports how many were inserted and how many updated
+func (db *PostgresDB) UpsertASNInfo(ctx context.Context, infos []models.ASNInfo) (inserted, updated int, err error) {
+	if len(infos) == 0 {
+		return 0, 0, nil
+	}
+
+	defer observeQuery(queryInsert, time.Now())
+
+	query := `
+		INSERT INTO asn_info (asn, name, org, country_code, asn_type, risk_modifier)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+		ON CONFLICT (asn) DO UPDATE SET
+			name = EXCLUDED.name,
+			org = EXCLUDED.org,
+			country_code = EXCLUDED.country_code,
+			asn_type = EXCLUDED.asn_type,
+			risk_modifier = EXCLUDED.risk_modifier,
+			updated_at = NOW()
+		RETURNING (xmax = 0) AS inserted
+	`
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, info := range infos {
+		batch.Queue(query, info.ASN, info.Name, info.Org, info.CountryCode, info.ASNType, info.RiskModifier)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	for _, info := range infos {
+		var isNew bool
+		if err := results.QueryRow().Scan(&isNew); err != nil {
+			results.Close()
+			return 0, 0, fmt.Errorf("upsert AS%d failed: %w", info.ASN, err)
+		}
+		if isNew {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	if err := results.Close(); err != nil {
+		return 0, 0, fmt.Errorf("upsert ASN info failed: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("commit failed: %w", err)
+	}
+	return inserted, updated, nil
+}
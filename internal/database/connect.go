@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+)
+
+// maxConnectRetryDelay caps the doubling wait between connection attempts
+const maxConnectRetryDelay = 30 * time.Second
+
+// ConnectWithRetry calls connect until it succeeds or attempts run out,
+// waiting delay before the second attempt and doubling the wait after each
+// failure. It lets services start before the database accepts connections,
+// as happens during coordinated container deploys. Fewer than one attempt
+// counts as one.
+func ConnectWithRetry(ctx context.Context, attempts int, delay time.Duration, connect func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = connect(); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			break
+		}
+
+		logger.Warn(fmt.Sprintf("Database connection attempt %d/%d failed: %v (retrying in %v)", attempt, attempts, err, delay))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up: %v)", err, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxConnectRetryDelay {
+			delay = maxConnectRetryDelay
+		}
+	}
+
+	return fmt.Errorf("%w (after %d attempts)", err, attempts)
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConnectWithRetry(t *testing.T) {
+	errDown := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		attempts  int
+		failFirst int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"first attempt succeeds", 3, 0, 1, false},
+		{"succeeds after retries", 5, 2, 3, false},
+		{"gives up", 3, 10, 3, true},
+		{"zero attempts tries once", 0, 10, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := ConnectWithRetry(context.Background(), tt.attempts, time.Millisecond, func() error {
+				calls++
+				if calls <= tt.failFirst {
+					return errDown
+				}
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConnectWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errDown) {
+				t.Errorf("error = %v, want it to wrap the last connect error", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("connect called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestConnectWithRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := ConnectWithRetry(ctx, 5, time.Hour, func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("ConnectWithRetry() = %v after %d calls, want an error after 1 call", err, calls)
+	}
+}
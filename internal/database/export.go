@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StreamActiveReputations calls fn for every active, non-whitelisted entry,
+// ordered by range so entries for the same network from different sources are
+// adjacent. An empty threatType matches all types. Rows are not buffered.
+func (db *PostgresDB) StreamActiveReputations(ctx context.Context, threatType string, fn func(*IPReputationEntry) error) error {
+	defer observeQuery(queryLookup, time.Now())
+
+	query := `
+		SELECT id, ip_start::text, ip_end::text, cidr::text, source, threat_type, confidence, weight, last_seen
+		FROM ip_reputation r
+		WHERE (r.expires_at IS NULL OR r.expires_at > NOW())
+		  AND ($1 = '' OR r.threat_type = $1)
+		  AND NOT EXISTS (
+			SELECT 1 FROM whitelist w
+			WHERE r.ip_start >= w.ip_start AND r.ip_end <= w.ip_end
+			  AND (w.permanent = true OR w.expires_at IS NULL OR w.expires_at > NOW())
+		  )
+		ORDER BY r.ip_start, r.ip_end
+	`
+
+	rows, err := db.ReadPool().Query(ctx, query, threatType)
+	if err != nil {
+		return fmt.Errorf("stream reputations failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry IPReputationEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.IPStart,
+			&entry.IPEnd,
+			&entry.CIDR,
+			&entry.Source,
+			&entry.ThreatType,
+			&entry.Confidence,
+			&entry.Weight,
+			&entry.LastSeen,
+		); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ListReputationsSince returns up to limit non-whitelisted entries seen after
+// the (lastSeen, id) cursor, oldest first, for incremental polling. Expired
+// entries are included so consumers can see their expiry.
+func (db *PostgresDB) ListReputationsSince(ctx context.Context, lastSeen time.Time, afterID int64, limit int) ([]IPReputationEntry, error) {
+	defer observeQuery(queryLookup, time.Now())
+
+	query := `
+		SELECT id, ip_start::text, ip_end::text, cidr::text, source, threat_type, confidence, weight, first_seen, last_seen, expires_at
+		FROM ip_reputation r
+		WHERE (r.last_seen, r.id) > ($1, $2)
+		  AND NOT EXISTS (
+			SELECT 1 FROM whitelist w
+			WHERE r.ip_start >= w.ip_start AND r.ip_end <= w.ip_end
+			  AND (w.permanent = true OR w.expires_at IS NULL OR w.expires_at > NOW())
+		  )
+		ORDER BY r.last_seen, r.id
+		LIMIT $3
+	`
+
+	rows, err := db.ReadPool().Query(ctx, query, lastSeen, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list reputations failed: %w", err)
+	}
+	defer rows.Close()
+
+	var results []IPReputationEntry
+	for rows.Next() {
+		var entry IPReputationEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.IPStart,
+			&entry.IPEnd,
+			&entry.CIDR,
+			&entry.Source,
+			&entry.ThreatType,
+			&entry.Confidence,
+			&entry.Weight,
+			&entry.FirstSeen,
+			&entry.LastSeen,
+			&entry.ExpiresAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		results = append(results, entry)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Feed run statuses recorded in feed_fetch_history
+const (
+	FeedRunSuccess = "success" // Every source was fetched
+	FeedRunPartial = "partial" // Some sources failed
+	FeedRunError   = "error"   // Every source failed
+	FeedRunSkipped = "skipped" // The feed has no sources
+)
+
+// FeedRun represents the outcome of a single feed run
+type FeedRun struct {
+	FeedName     string
+	SourceURL    string
+	Status       string
+	EntriesCount int
+	StoredCount  int
+	Duration     time.Duration
+	ErrorMessage string
+}
+
+// FeedRunStatus holds the latest run information for a feed. LastSuccess,
+// LastEntries and SuccessCount count full successes only.
+type FeedRunStatus struct {
+	FeedName     string     `json:"feed_name"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastStatus   string     `json:"last_status,omitempty"`
+	LastSuccess  *time.Time `json:"last_success,omitempty"`
+	LastEntries  int        `json:"last_entries"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+	SuccessCount int        `json:"success_count"`
+	ErrorCount   int        `json:"error_count"`
+}
+
+// RecordFeedRun records the outcome of a feed run
+func (db *PostgresDB) RecordFeedRun(ctx context.Context, run FeedRun) error {
+	query := `
+		INSERT INTO feed_fetch_history (feed_name, source_url, status, entries_count, new_entries, duration_ms, error_message)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+	`
+
+	_, err := db.pool.Exec(ctx, query,
+		run.FeedName,
+		run.SourceURL,
+		run.Status,
+		run.EntriesCount,
+		run.StoredCount,
+		run.Duration.Milliseconds(),
+		run.ErrorMessage,
+	)
+	if err != nil {
+		return fmt.Errorf("record feed run failed: %w", err)
+	}
+	return nil
+}
+
+// GetFeedStatuses returns the latest run status of every feed that has been run
+func (db *PostgresDB) GetFeedStatuses(ctx context.Context) (map[string]*FeedRunStatus, error) {
+	query := `
+		SELECT
+			feed_name,
+			MAX(created_at) AS last_run,
+			(ARRAY_AGG(status ORDER BY created_at DESC))[1] AS last_status,
+			MAX(created_at) FILTER (WHERE status = 'success') AS last_success,
+			COALESCE((ARRAY_AGG(entries_count ORDER BY created_at DESC) FILTER (WHERE status = 'success'))[1], 0) AS last_entries,
+			COALESCE((ARRAY_AGG(error_message ORDER BY created_at DESC) FILTER (WHERE error_message IS NOT NULL))[1], '') AS last_error,
+			MAX(created_at) FILTER (WHERE error_message IS NOT NULL) AS last_error_at,
+			COUNT(*) FILTER (WHERE status = 'success') AS success_count,
+			COUNT(*) FILTER (WHERE status = 'error') AS error_count
+		FROM feed_fetch_history
+		GROUP BY feed_name
+	`
+
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("get feed statuses failed: %w", err)
+	}
+	defer rows.Close()
+
+	statuses := make(map[string]*FeedRunStatus)
+	for rows.Next() {
+		var s FeedRunStatus
+		err := rows.Scan(
+			&s.FeedName,
+			&s.LastRun,
+			&s.LastStatus,
+			&s.LastSuccess,
+			&s.LastEntries,
+			&s.LastError,
+			&s.LastErrorAt,
+			&s.SuccessCount,
+			&s.ErrorCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan feed status failed: %w", err)
+		}
+		statuses[s.FeedName] = &s
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return statuses, nil
+}
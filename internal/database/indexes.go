@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// requiredIndex is an index the queries rely on, recognized by its
+// definition so equivalent indexes created under other names also count
+type requiredIndex struct {
+	name  string // As created by the migrations
+	table string
+	parts []string // Substrings of pg_indexes.indexdef that identify it
+}
+
+var requiredIndexes = []requiredIndex{
+	// ON CONFLICT (ip_start, ip_end, source) fails without it
+	{"idx_ip_reputation_unique", "ip_reputation", []string{"UNIQUE INDEX", "(ip_start, ip_end, source)"}},
+	// Range lookups scan the table without these
+	{"idx_ip_reputation_range", "ip_reputation", []string{"USING gist (inetrange(ip_start, ip_end"}},
+	{"idx_whitelist_range", "whitelist", []string{"USING gist (inetrange(ip_start, ip_end"}},
+}
+
+// indexDef is one row of pg_indexes
+type indexDef struct {
+	table string
+	def   string
+}
+
+// CheckIndexes reports the required indexes that are missing, by their
+// migration name. Lookups switch to the range-containment form for each
+// table whose range index exists, and keep the plain comparison otherwise.
+func (db *PostgresDB) CheckIndexes(ctx context.Context) ([]string, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT tablename, indexdef FROM pg_indexes
+		WHERE schemaname = current_schema() AND tablename IN ('ip_reputation', 'whitelist')
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	defer rows.Close()
+
+	var defs []indexDef
+	for rows.Next() {
+		var d indexDef
+		if err := rows.Scan(&d.table, &d.def); err != nil {
+			return nil, fmt.Errorf("failed to list indexes: %w", err)
+		}
+		defs = append(defs, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	missing := missingIndexes(defs)
+	db.reputationRange.Store(!contains(missing, "idx_ip_reputation_range"))
+	db.whitelistRange.Store(!contains(missing, "idx_whitelist_range"))
+	return missing, nil
+}
+
+// missingIndexes returns the names of the required indexes not among defs
+func missingIndexes(defs []indexDef) []string {
+	var missing []string
+	for _, req := range requiredIndexes {
+		found := false
+		for _, d := range defs {
+			if d.table == req.table && containsAll(d.def, req.parts) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, req.name)
+		}
+	}
+	return missing
+}
+
+// rangeMatch returns the WHERE condition matching rows whose range contains
+// the inet parameter $1, using the GiST range index when it exists
+func rangeMatch(indexed bool) string {
+	return rangeMatchOn(indexed, "$1::inet")
+}
+
+// rangeMatchOn is rangeMatch for any inet expression, such as a joined column
+func rangeMatchOn(indexed bool, addr string) string {
+	if indexed {
+		return "inetrange(ip_start, ip_end, '[]') @> " + addr
+	}
+	return addr + " >= ip_start AND " + addr + " <= ip_end"
+}
+
+func containsAll(s string, parts []string) bool {
+	for _, p := range parts {
+		if !strings.Contains(s, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingIndexes(t *testing.T) {
+	// As pg_indexes reports the indexes created by the migrations
+	migrated := []indexDef{
+		{"ip_reputation", "CREATE UNIQUE INDEX idx_ip_reputation_unique ON public.ip_reputation USING btree (ip_start, ip_end, source)"},
+		{"ip_reputation", "CREATE INDEX idx_ip_reputation_range ON public.ip_reputation USING gist (inetrange(ip_start, ip_end, '[]'::text))"},
+		{"whitelist", "CREATE INDEX idx_whitelist_range ON public.whitelist USING gist (inetrange(ip_start, ip_end, '[]'::text))"},
+	}
+	if got := missingIndexes(migrated); len(got) != 0 {
+		t.Errorf("missingIndexes(migrated) = %v, want none", got)
+	}
+
+	// A unique constraint under another name counts; a plain index does not
+	handmade := []indexDef{
+		{"ip_reputation", "CREATE UNIQUE INDEX ip_reputation_ip_start_ip_end_source_key ON public.ip_reputation USING btree (ip_start, ip_end, source)"},
+		{"ip_reputation", "CREATE INDEX idx_ip_reputation_ip_start ON public.ip_reputation USING btree (ip_start)"},
+		{"ip_reputation", "CREATE INDEX idx_other_range ON public.ip_reputation USING btree (ip_start, ip_end)"},
+	}
+	want := []string{"idx_ip_reputation_range", "idx_whitelist_range"}
+	if got := missingIndexes(handmade); !reflect.DeepEqual(got, want) {
+		t.Errorf("missingIndexes(handmade) = %v, want %v", got, want)
+	}
+}
+
+func TestRangeMatch(t *testing.T) {
+	if got := rangeMatch(true); got != "inetrange(ip_start, ip_end, '[]') @> $1::inet" {
+		t.Errorf("rangeMatch(true) = %q", got)
+	}
+	if got := rangeMatch(false); got != "$1::inet >= ip_start AND $1::inet <= ip_end" {
+		t.Errorf("rangeMatch(false) = %q", got)
+	}
+	if got := rangeMatchOn(false, "q.addr"); got != "q.addr >= ip_start AND q.addr <= ip_end" {
+		t.Errorf("rangeMatchOn(false, q.addr) = %q", got)
+	}
+}
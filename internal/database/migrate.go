@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lfrfrfr/beon-ipquality/migrations"
+)
+
+// migrationLockID is the advisory lock key that serializes concurrent
+// Migrate calls, e.g. several replicas started with -migrate at once
+const migrationLockID = 0x6265_6f6e // "beon"
+
+// Migrate applies the migrations not yet recorded in schema_migrations, in
+// order, each in its own transaction, and returns the versions applied.
+// Databases set up by hand from the same files are safe to migrate: the
+// schema files only create what does not exist yet.
+func (db *PostgresDB) Migrate(ctx context.Context, ms []migrations.Migration) ([]string, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return nil, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	done := make(map[string]bool)
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		done[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	var applied []string
+	for _, m := range ms {
+		if done[m.Version] {
+			continue
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return applied, fmt.Errorf("begin transaction failed: %w", err)
+		}
+		// Without arguments Exec uses the simple protocol, which runs a
+		// whole file of statements
+		if _, err := tx.Exec(ctx, m.SQL); err != nil {
+			tx.Rollback(ctx)
+			return applied, fmt.Errorf("migration %s failed: %w", m.Version, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.Version); err != nil {
+			tx.Rollback(ctx)
+			return applied, fmt.Errorf("failed to record migration %s: %w", m.Version, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return applied, fmt.Errorf("commit of migration %s failed: %w", m.Version, err)
+		}
+		applied = append(applied, m.Version)
+	}
+
+	return applied, nil
+}
@@ -4,22 +4,198 @@ import (
 	"context"
 	"fmt"
 	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
 	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
 	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
 
 // PostgresDB handles PostgreSQL database operations
 type PostgresDB struct {
-	pool *pgxpool.Pool
+	pool          *pgxpool.Pool
+	upsert        UpsertStrategy
+	insert        InsertStrategy
+	bulkThreshold int // Store size from which the auto insert strategy uses COPY
+	// Optional read replica for lookups; nil uses pool. Atomic because the
+	// pool metrics loop reads it while AttachReadReplica may set it
+	readPool atomic.Pointer[pgxpool.Pool]
+	// Whether the GiST range indexes exist, as found by CheckIndexes
+	reputationRange atomic.Bool
+	whitelistRange  atomic.Bool
+	stop            chan struct{}
+	stopOnce        sync.Once
+}
+
+// UpsertStrategy selects how an existing reputation row is updated when the
+// same range is reported again by the same source
+type UpsertStrategy string
+
+const (
+	UpsertMax    UpsertStrategy = "max"    // Keep the highest confidence/weight seen
+	UpsertLatest UpsertStrategy = "latest" // The newest report's values win
+)
+
+// ParseUpsertStrategy validates an upsert strategy name; empty defaults to max
+func ParseUpsertStrategy(s string) (UpsertStrategy, error) {
+	switch UpsertStrategy(s) {
+	case "":
+		return UpsertMax, nil
+	case UpsertMax, UpsertLatest:
+		return UpsertStrategy(s), nil
+	default:
+		return "", fmt.Errorf("unknown upsert strategy %q (want max or latest)", s)
+	}
+}
+
+// conflictUpdate returns the ON CONFLICT ... DO UPDATE SET clause for the strategy.
+// first_seen keeps the earliest sighting and last_seen the latest under every strategy.
+// expires_at follows the latest report, so reporting an expired row again revives it;
+// feed rows never expire.
+func conflictUpdate(strategy UpsertStrategy) string {
+	values := `
+			confidence = GREATEST(ip_reputation.confidence, EXCLUDED.confidence),
+			weight = GREATEST(ip_reputation.weight, EXCLUDED.weight),`
+	if strategy == UpsertLatest {
+		values = `
+			threat_type = EXCLUDED.threat_type,
+			confidence = EXCLUDED.confidence,
+			weight = EXCLUDED.weight,`
+	}
+
+	return `ON CONFLICT (ip_start, ip_end, source)
+		DO UPDATE SET` + values + `
+			first_seen = LEAST(ip_reputation.first_seen, EXCLUDED.first_seen),
+			last_seen = GREATEST(ip_reputation.last_seen, EXCLUDED.last_seen),
+			expires_at = EXCLUDED.expires_at,
+			ingested_by = COALESCE(EXCLUDED.ingested_by, ip_reputation.ingested_by),
+			metadata = COALESCE(ip_reputation.metadata, '{}'::jsonb) || EXCLUDED.metadata`
+}
+
+// SetUpsertStrategy sets how repeated reports of the same range are merged
+func (db *PostgresDB) SetUpsertStrategy(strategy UpsertStrategy) {
+	db.upsert = strategy
+}
+
+// InsertStrategy selects how a store of reputation entries is written
+type InsertStrategy string
+
+const (
+	InsertAuto  InsertStrategy = "auto"  // Bulk once a store reaches the bulk threshold
+	InsertBatch InsertStrategy = "batch" // Always per-row upserts (InsertReputationBatch)
+	InsertBulk  InsertStrategy = "bulk"  // Always COPY then upsert (InsertReputationBulk)
+)
+
+// ParseInsertStrategy validates an insert strategy name; empty defaults to auto
+func ParseInsertStrategy(s string) (InsertStrategy, error) {
+	switch InsertStrategy(s) {
+	case "":
+		return InsertAuto, nil
+	case InsertAuto, InsertBatch, InsertBulk:
+		return InsertStrategy(s), nil
+	default:
+		return "", fmt.Errorf("unknown insert strategy %q (want auto, batch or bulk)", s)
+	}
+}
+
+// SetInsertStrategy sets how stores are written; under auto, stores of at
+// least bulkThreshold entries use InsertReputationBulk
+func (db *PostgresDB) SetInsertStrategy(strategy InsertStrategy, bulkThreshold int) {
+	db.insert = strategy
+	db.bulkThreshold = bulkThreshold
+}
+
+// UseBulkInsert reports whether a store of n entries should use
+// InsertReputationBulk rather than InsertReputationBatch
+func (db *PostgresDB) UseBulkInsert(n int) bool {
+	switch db.insert {
+	case InsertBulk:
+		return true
+	case InsertAuto:
+		return db.bulkThreshold > 0 && n >= db.bulkThreshold
+	default:
+		return false
+	}
+}
+
+// Query types used as the query_type label of PostgresQueryDuration
+const (
+	queryLookup  = "lookup"
+	queryInsert  = "insert"
+	queryCleanup = "cleanup"
+)
+
+// poolMetricsInterval is how often PostgresConnections is refreshed
+const poolMetricsInterval = 15 * time.Second
+
+// observeQuery records the duration of a query started at start; use with defer
+func observeQuery(queryType string, start time.Time) {
+	metrics.RecordPostgresQuery(queryType, float64(time.Since(start).Microseconds())/1000.0)
 }
 
 // NewPostgresDB creates a new PostgreSQL connection pool
 func NewPostgresDB(dsn string, maxConns, minConns int) (*PostgresDB, error) {
+	pool, err := newPool(dsn, maxConns, minConns)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Connected to PostgreSQL database")
+
+	db := &PostgresDB{pool: pool, stop: make(chan struct{})}
+	go db.reportPoolMetrics(poolMetricsInterval)
+	return db, nil
+}
+
+// reportPoolMetrics updates the PostgresConnections gauge until Close is called
+func (db *PostgresDB) reportPoolMetrics(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		db.updatePoolMetrics()
+
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updatePoolMetrics sets PostgresConnections from the acquired connections of both pools
+func (db *PostgresDB) updatePoolMetrics() {
+	acquired := db.pool.Stat().AcquiredConns()
+	if readPool := db.readPool.Load(); readPool != nil {
+		acquired += readPool.Stat().AcquiredConns()
+	}
+	metrics.PostgresConnections.Set(float64(acquired))
+}
+
+// AttachReadReplica routes lookup queries (LookupIP, IsWhitelisted,
+// GetAllActiveReputations) to a separate pool; writes stay on the primary
+func (db *PostgresDB) AttachReadReplica(dsn string, maxConns, minConns int) error {
+	pool, err := newPool(dsn, maxConns, minConns)
+	if err != nil {
+		return fmt.Errorf("read replica: %w", err)
+	}
+
+	if old := db.readPool.Swap(pool); old != nil {
+		old.Close()
+	}
+
+	logger.Info("Connected to PostgreSQL read replica")
+	return nil
+}
+
+// newPool creates and pings a connection pool
+func newPool(dsn string, maxConns, minConns int) (*pgxpool.Pool, error) {
 	poolConfig, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse DSN: %w", err)
@@ -30,6 +206,12 @@ func NewPostgresDB(dsn string, maxConns, minConns int) (*PostgresDB, error) {
 	poolConfig.MaxConnLifetime = time.Hour
 	poolConfig.MaxConnIdleTime = 30 * time.Minute
 
+	// pgx prepares and caches statements per connection by default
+	// (QueryExecModeCacheStatement), so repeated lookups skip re-parsing. A DSN
+	// may override this with default_query_exec_mode, e.g. behind pgbouncer.
+	logger.Debug(fmt.Sprintf("PostgreSQL query exec mode: %s, statement cache capacity: %d",
+		poolConfig.ConnConfig.DefaultQueryExecMode, poolConfig.ConnConfig.StatementCacheCapacity))
+
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pool: %w", err)
@@ -41,53 +223,66 @@ func NewPostgresDB(dsn string, maxConns, minConns int) (*PostgresDB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	logger.Info("Connected to PostgreSQL database")
-	return &PostgresDB{pool: pool}, nil
+	return pool, nil
 }
 
-// Close closes the database connection pool
+// Close closes the database connection pools
 func (db *PostgresDB) Close() {
+	if db.stop != nil {
+		db.stopOnce.Do(func() { close(db.stop) })
+	}
+	if readPool := db.readPool.Load(); readPool != nil {
+		readPool.Close()
+	}
 	if db.pool != nil {
 		db.pool.Close()
 	}
 }
 
-// Pool returns the underlying connection pool
+// Pool returns the underlying (primary) connection pool
 func (db *PostgresDB) Pool() *pgxpool.Pool {
 	return db.pool
 }
 
+// ReadPool returns the pool used for lookups: the read replica if attached, else the primary
+func (db *PostgresDB) ReadPool() *pgxpool.Pool {
+	if readPool := db.readPool.Load(); readPool != nil {
+		return readPool
+	}
+	return db.pool
+}
+
 // IPReputationEntry represents a database entry
 type IPReputationEntry struct {
-	ID         int64
-	IPStart    string
-	IPEnd      string
-	CIDR       *string
-	Source     string
-	SourceName *string
-	ThreatType string
-	Confidence float64
-	Weight     int
-	FirstSeen  time.Time
-	LastSeen   time.Time
-	ExpiresAt  *time.Time
-	Metadata   map[string]interface{}
-}
-
-// InsertReputation inserts or updates an IP reputation entry
+	ID         int64                  `json:"id"`
+	IPStart    string                 `json:"ip_start"`
+	IPEnd      string                 `json:"ip_end"`
+	CIDR       *string                `json:"cidr,omitempty"`
+	Source     string                 `json:"source"`
+	SourceName *string                `json:"source_name,omitempty"`
+	ThreatType string                 `json:"threat_type"`
+	Confidence float64                `json:"confidence"`
+	Weight     int                    `json:"weight"`
+	FirstSeen  time.Time              `json:"first_seen"`
+	LastSeen   time.Time              `json:"last_seen"`
+	ExpiresAt  *time.Time             `json:"expires_at,omitempty"`
+	IngestedBy *string                `json:"ingested_by,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// InsertReputation inserts or updates an IP reputation entry. entry is
+// updated with the stored row, which an update merges with earlier reports.
 func (db *PostgresDB) InsertReputation(ctx context.Context, entry *IPReputationEntry) error {
+	defer observeQuery(queryInsert, time.Now())
+
 	query := `
-		INSERT INTO ip_reputation (ip_start, ip_end, cidr, source, source_name, threat_type, confidence, weight, first_seen, last_seen, expires_at)
-		VALUES ($1::inet, $2::inet, $3::cidr, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT (ip_start, ip_end, source) 
-		DO UPDATE SET
-			confidence = GREATEST(ip_reputation.confidence, EXCLUDED.confidence),
-			weight = GREATEST(ip_reputation.weight, EXCLUDED.weight),
-			last_seen = EXCLUDED.last_seen
-		RETURNING id
+		INSERT INTO ip_reputation (ip_start, ip_end, cidr, source, source_name, threat_type, confidence, weight, first_seen, last_seen, expires_at, ingested_by, metadata)
+		VALUES ($1::inet, $2::inet, $3::cidr, $4, $5, $6, $7, $8, $9, $10, $11, $12, COALESCE($13::jsonb, '{}'::jsonb))
+		` + conflictUpdate(db.upsert) + `
+		RETURNING id, source_name, threat_type, confidence, weight, first_seen, last_seen, expires_at, ingested_by
 	`
 
-	var id int64
+	var stored IPReputationEntry
 	err := db.pool.QueryRow(ctx, query,
 		entry.IPStart,
 		entry.IPEnd,
@@ -100,13 +295,33 @@ func (db *PostgresDB) InsertReputation(ctx context.Context, entry *IPReputationE
 		entry.FirstSeen,
 		entry.LastSeen,
 		entry.ExpiresAt,
-	).Scan(&id)
+		entry.IngestedBy,
+		entry.Metadata,
+	).Scan(
+		&stored.ID,
+		&stored.SourceName,
+		&stored.ThreatType,
+		&stored.Confidence,
+		&stored.Weight,
+		&stored.FirstSeen,
+		&stored.LastSeen,
+		&stored.ExpiresAt,
+		&stored.IngestedBy,
+	)
 
 	if err != nil {
 		return fmt.Errorf("insert reputation failed: %w", err)
 	}
 
-	entry.ID = id
+	entry.ID = stored.ID
+	entry.SourceName = stored.SourceName
+	entry.ThreatType = stored.ThreatType
+	entry.Confidence = stored.Confidence
+	entry.Weight = stored.Weight
+	entry.FirstSeen = stored.FirstSeen
+	entry.LastSeen = stored.LastSeen
+	entry.ExpiresAt = stored.ExpiresAt
+	entry.IngestedBy = stored.IngestedBy
 	return nil
 }
 
@@ -116,18 +331,16 @@ func (db *PostgresDB) InsertReputationBatch(ctx context.Context, entries []IPRep
 		return 0, nil
 	}
 
+	defer observeQuery(queryInsert, time.Now())
+
 	batch := &pgx.Batch{}
 
+	query := `
+		INSERT INTO ip_reputation (ip_start, ip_end, cidr, source, source_name, threat_type, confidence, weight, first_seen, last_seen, ingested_by, metadata)
+		VALUES ($1::inet, $2::inet, $3::cidr, $4, $5, $6, $7, $8, $9, $10, $11, COALESCE($12::jsonb, '{}'::jsonb))
+		` + conflictUpdate(db.upsert)
+
 	for _, entry := range entries {
-		query := `
-			INSERT INTO ip_reputation (ip_start, ip_end, cidr, source, source_name, threat_type, confidence, weight, first_seen, last_seen)
-			VALUES ($1::inet, $2::inet, $3::cidr, $4, $5, $6, $7, $8, $9, $10)
-			ON CONFLICT (ip_start, ip_end, source) 
-			DO UPDATE SET
-				confidence = GREATEST(ip_reputation.confidence, EXCLUDED.confidence),
-				weight = GREATEST(ip_reputation.weight, EXCLUDED.weight),
-				last_seen = EXCLUDED.last_seen
-		`
 		batch.Queue(query,
 			entry.IPStart,
 			entry.IPEnd,
@@ -139,6 +352,8 @@ func (db *PostgresDB) InsertReputationBatch(ctx context.Context, entries []IPRep
 			entry.Weight,
 			entry.FirstSeen,
 			entry.LastSeen,
+			entry.IngestedBy,
+			entry.Metadata,
 		)
 	}
 
@@ -162,25 +377,40 @@ func (db *PostgresDB) InsertReputationBatch(ctx context.Context, entries []IPRep
 	return inserted, nil
 }
 
-// InsertReputationBulk uses COPY for high-performance bulk insert
+// InsertReputationBulk COPYs entries into a temporary table and upserts them
+// from there in one transaction. It is much faster than InsertReputationBatch
+// for large feeds and writes the same columns, so first_seen, last_seen and
+// expiry behave identically. A range repeated within entries keeps its latest
+// sighting, since one upsert cannot touch the same row twice.
 func (db *PostgresDB) InsertReputationBulk(ctx context.Context, entries []IPReputationEntry) (int, error) {
 	if len(entries) == 0 {
 		return 0, nil
 	}
 
-	// Create temp table
-	_, err := db.pool.Exec(ctx, `
+	defer observeQuery(queryInsert, time.Now())
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Addresses are staged as text and cast on upsert, like the $n::inet
+	// parameters of InsertReputationBatch
+	_, err = tx.Exec(ctx, `
 		CREATE TEMP TABLE temp_reputation (
-			ip_start INET NOT NULL,
-			ip_end INET NOT NULL,
-			cidr CIDR,
+			ip_start TEXT NOT NULL,
+			ip_end TEXT NOT NULL,
+			cidr TEXT,
 			source VARCHAR(100) NOT NULL,
 			source_name VARCHAR(255),
 			threat_type VARCHAR(50) NOT NULL,
 			confidence DECIMAL(4,3) NOT NULL,
 			weight INTEGER NOT NULL,
 			first_seen TIMESTAMP WITH TIME ZONE,
-			last_seen TIMESTAMP WITH TIME ZONE
+			last_seen TIMESTAMP WITH TIME ZONE,
+			ingested_by VARCHAR(255),
+			metadata JSONB
 		) ON COMMIT DROP
 	`)
 	if err != nil {
@@ -188,7 +418,7 @@ func (db *PostgresDB) InsertReputationBulk(ctx context.Context, entries []IPRepu
 	}
 
 	// Use COPY to insert into temp table
-	columns := []string{"ip_start", "ip_end", "cidr", "source", "source_name", "threat_type", "confidence", "weight", "first_seen", "last_seen"}
+	columns := []string{"ip_start", "ip_end", "cidr", "source", "source_name", "threat_type", "confidence", "weight", "first_seen", "last_seen", "ingested_by", "metadata"}
 	rows := make([][]interface{}, len(entries))
 
 	for i, entry := range entries {
@@ -203,10 +433,12 @@ func (db *PostgresDB) InsertReputationBulk(ctx context.Context, entries []IPRepu
 			entry.Weight,
 			entry.FirstSeen,
 			entry.LastSeen,
+			entry.IngestedBy,
+			entry.Metadata,
 		}
 	}
 
-	_, err = db.pool.CopyFrom(ctx,
+	_, err = tx.CopyFrom(ctx,
 		pgx.Identifier{"temp_reputation"},
 		columns,
 		pgx.CopyFromRows(rows),
@@ -216,34 +448,39 @@ func (db *PostgresDB) InsertReputationBulk(ctx context.Context, entries []IPRepu
 	}
 
 	// Upsert from temp table
-	result, err := db.pool.Exec(ctx, `
-		INSERT INTO ip_reputation (ip_start, ip_end, cidr, source, source_name, threat_type, confidence, weight, first_seen, last_seen)
-		SELECT ip_start, ip_end, cidr, source, source_name, threat_type, confidence, weight, first_seen, last_seen
+	result, err := tx.Exec(ctx, `
+		INSERT INTO ip_reputation (ip_start, ip_end, cidr, source, source_name, threat_type, confidence, weight, first_seen, last_seen, ingested_by, metadata)
+		SELECT DISTINCT ON (ip_start::inet, ip_end::inet, source)
+			ip_start::inet, ip_end::inet, cidr::cidr, source, source_name, threat_type, confidence, weight, first_seen, last_seen, ingested_by, COALESCE(metadata, '{}'::jsonb)
 		FROM temp_reputation
-		ON CONFLICT (ip_start, ip_end, source)
-		DO UPDATE SET
-			confidence = GREATEST(ip_reputation.confidence, EXCLUDED.confidence),
-			weight = GREATEST(ip_reputation.weight, EXCLUDED.weight),
-			last_seen = EXCLUDED.last_seen
-	`)
+		ORDER BY ip_start::inet, ip_end::inet, source, last_seen DESC
+		`+conflictUpdate(db.upsert))
 	if err != nil {
 		return 0, fmt.Errorf("upsert failed: %w", err)
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit failed: %w", err)
+	}
 	return int(result.RowsAffected()), nil
 }
 
-// LookupIP looks up reputation data for an IP
-func (db *PostgresDB) LookupIP(ctx context.Context, ip string) ([]IPReputationEntry, error) {
+// LookupIP returns every active reputation row covering an IP, one per
+// source and range, highest weight first. Metadata is only read when
+// includeMetadata is set; it can be large and most callers ignore it.
+func (db *PostgresDB) LookupIP(ctx context.Context, ip string, includeMetadata bool) ([]IPReputationEntry, error) {
+	defer observeQuery(queryLookup, time.Now())
+
 	query := `
-		SELECT id, ip_start::text, ip_end::text, cidr::text, source, source_name, threat_type, confidence, weight, first_seen, last_seen
+		SELECT id, ip_start::text, ip_end::text, cidr::text, source, source_name, threat_type, confidence, weight, first_seen, last_seen, expires_at, ingested_by,
+			` + metadataColumn(includeMetadata, "") + `
 		FROM ip_reputation
-		WHERE $1::inet >= ip_start AND $1::inet <= ip_end
+		WHERE ` + rangeMatch(db.reputationRange.Load()) + `
 		  AND (expires_at IS NULL OR expires_at > NOW())
 		ORDER BY weight DESC, confidence DESC
 	`
 
-	rows, err := db.pool.Query(ctx, query, ip)
+	rows, err := db.ReadPool().Query(ctx, query, ip)
 	if err != nil {
 		return nil, fmt.Errorf("lookup failed: %w", err)
 	}
@@ -264,6 +501,9 @@ func (db *PostgresDB) LookupIP(ctx context.Context, ip string) ([]IPReputationEn
 			&entry.Weight,
 			&entry.FirstSeen,
 			&entry.LastSeen,
+			&entry.ExpiresAt,
+			&entry.IngestedBy,
+			&entry.Metadata,
 		)
 		if err != nil {
 			logger.Error(fmt.Sprintf("Scan error: %v", err))
@@ -275,18 +515,96 @@ func (db *PostgresDB) LookupIP(ctx context.Context, ip string) ([]IPReputationEn
 	return results, nil
 }
 
+// LookupIPs is LookupIP for many IPs in one round trip. The result maps each
+// listed IP, as given, to its active entries in LookupIP's order; IPs without
+// entries are left out. Every IP must be a valid address.
+func (db *PostgresDB) LookupIPs(ctx context.Context, ips []string, includeMetadata bool) (map[string][]IPReputationEntry, error) {
+	defer observeQuery(queryLookup, time.Now())
+
+	results := make(map[string][]IPReputationEntry)
+	if len(ips) == 0 {
+		return results, nil
+	}
+	for _, ip := range ips {
+		if _, err := netip.ParseAddr(ip); err != nil {
+			return nil, fmt.Errorf("lookup failed: invalid IP %q", ip)
+		}
+	}
+
+	// Rows come back tagged with the position of their IP in ips, so the
+	// keys are the caller's strings rather than Postgres' rendering of them
+	query := `
+		SELECT q.n, r.id, r.ip_start::text, r.ip_end::text, r.cidr::text, r.source, r.source_name, r.threat_type, r.confidence, r.weight,
+			r.first_seen, r.last_seen, r.expires_at, r.ingested_by, ` + metadataColumn(includeMetadata, "r.") + `
+		FROM unnest($1::inet[]) WITH ORDINALITY AS q(addr, n)
+		JOIN ip_reputation r ON ` + rangeMatchOn(db.reputationRange.Load(), "q.addr") + `
+		WHERE r.expires_at IS NULL OR r.expires_at > NOW()
+		ORDER BY q.n, r.weight DESC, r.confidence DESC
+	`
+
+	rows, err := db.ReadPool().Query(ctx, query, ips)
+	if err != nil {
+		return nil, fmt.Errorf("lookup failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n int64
+		var entry IPReputationEntry
+		err := rows.Scan(
+			&n,
+			&entry.ID,
+			&entry.IPStart,
+			&entry.IPEnd,
+			&entry.CIDR,
+			&entry.Source,
+			&entry.SourceName,
+			&entry.ThreatType,
+			&entry.Confidence,
+			&entry.Weight,
+			&entry.FirstSeen,
+			&entry.LastSeen,
+			&entry.ExpiresAt,
+			&entry.IngestedBy,
+			&entry.Metadata,
+		)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Scan error: %v", err))
+			continue
+		}
+		ip := ips[n-1]
+		results[ip] = append(results[ip], entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("lookup failed: %w", err)
+	}
+
+	return results, nil
+}
+
+// metadataColumn selects the metadata column of the table qualified by
+// prefix, or a NULL placeholder that scans as no metadata
+func metadataColumn(include bool, prefix string) string {
+	if include {
+		return "COALESCE(" + prefix + "metadata, '{}'::jsonb)"
+	}
+	return "NULL::jsonb"
+}
+
 // IsWhitelisted checks if an IP is whitelisted
 func (db *PostgresDB) IsWhitelisted(ctx context.Context, ip string) (bool, error) {
+	defer observeQuery(queryLookup, time.Now())
+
 	query := `
 		SELECT EXISTS (
 			SELECT 1 FROM whitelist
-			WHERE $1::inet >= ip_start AND $1::inet <= ip_end
+			WHERE ` + rangeMatch(db.whitelistRange.Load()) + `
 			  AND (permanent = true OR expires_at IS NULL OR expires_at > NOW())
 		)
 	`
 
 	var exists bool
-	err := db.pool.QueryRow(ctx, query, ip).Scan(&exists)
+	err := db.ReadPool().QueryRow(ctx, query, ip).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("whitelist check failed: %w", err)
 	}
@@ -332,16 +650,20 @@ func (db *PostgresDB) GetAPIKey(ctx context.Context, keyHash string) (*models.AP
 	return &key, nil
 }
 
-// GetAllActiveReputations fetches all active reputation entries for MMDB compilation
+// GetAllActiveReputations fetches all active reputation entries for MMDB
+// compilation and the in-memory index
 func (db *PostgresDB) GetAllActiveReputations(ctx context.Context) ([]IPReputationEntry, error) {
+	defer observeQuery(queryLookup, time.Now())
+
 	query := `
-		SELECT id, ip_start::text, ip_end::text, cidr::text, source, source_name, threat_type, confidence, weight, first_seen, last_seen
+		SELECT id, ip_start::text, ip_end::text, cidr::text, source, source_name, threat_type, confidence, weight, first_seen, last_seen,
+			COALESCE(metadata, '{}'::jsonb)
 		FROM ip_reputation
 		WHERE (expires_at IS NULL OR expires_at > NOW())
 		ORDER BY last_seen DESC
 	`
 
-	rows, err := db.pool.Query(ctx, query)
+	rows, err := db.ReadPool().Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("fetch all reputations failed: %w", err)
 	}
@@ -362,6 +684,7 @@ func (db *PostgresDB) GetAllActiveReputations(ctx context.Context) ([]IPReputati
 			&entry.Weight,
 			&entry.FirstSeen,
 			&entry.LastSeen,
+			&entry.Metadata,
 		)
 		if err != nil {
 			continue
@@ -374,6 +697,8 @@ func (db *PostgresDB) GetAllActiveReputations(ctx context.Context) ([]IPReputati
 
 // CleanupExpired removes expired entries
 func (db *PostgresDB) CleanupExpired(ctx context.Context) (int, error) {
+	defer observeQuery(queryCleanup, time.Now())
+
 	result, err := db.pool.Exec(ctx, `
 		DELETE FROM ip_reputation
 		WHERE expires_at IS NOT NULL AND expires_at < NOW()
@@ -384,6 +709,47 @@ func (db *PostgresDB) CleanupExpired(ctx context.Context) (int, error) {
 	return int(result.RowsAffected()), nil
 }
 
+// CleanupByRetention removes entries whose last_seen is older than the retention of their
+// threat type. Types missing from byType use defaultRetention; a zero retention keeps entries.
+// Threat types match case-insensitively, as RetentionConfig.For does.
+func (db *PostgresDB) CleanupByRetention(ctx context.Context, byType map[string]time.Duration, defaultRetention time.Duration) (int, error) {
+	defer observeQuery(queryCleanup, time.Now())
+
+	now := time.Now()
+	removed := 0
+
+	types := make([]string, 0, len(byType))
+	for threatType, retention := range byType {
+		threatType = strings.ToLower(threatType)
+		types = append(types, threatType)
+		if retention <= 0 {
+			continue
+		}
+
+		result, err := db.pool.Exec(ctx, `
+			DELETE FROM ip_reputation
+			WHERE lower(threat_type) = $1 AND last_seen < $2
+		`, threatType, now.Add(-retention))
+		if err != nil {
+			return removed, fmt.Errorf("retention cleanup for %s failed: %w", threatType, err)
+		}
+		removed += int(result.RowsAffected())
+	}
+
+	if defaultRetention > 0 {
+		result, err := db.pool.Exec(ctx, `
+			DELETE FROM ip_reputation
+			WHERE lower(threat_type) <> ALL($1) AND last_seen < $2
+		`, types, now.Add(-defaultRetention))
+		if err != nil {
+			return removed, fmt.Errorf("default retention cleanup failed: %w", err)
+		}
+		removed += int(result.RowsAffected())
+	}
+
+	return removed, nil
+}
+
 // DBStats holds database statistics
 type DBStats struct {
 	TotalReputations int64     `json:"total_reputations"`
@@ -407,6 +773,21 @@ func (db *PostgresDB) GetStats(ctx context.Context) (*DBStats, error) {
 	return stats, nil
 }
 
+// RequestStats summarizes the api_request_log since the given time. The log
+// does not record response codes, so the error rate is always 0.
+func (db *PostgresDB) RequestStats(ctx context.Context, since time.Time) (*models.APIStats, error) {
+	stats := &models.APIStats{}
+	err := db.pool.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT ip_queried), COALESCE(AVG(response_time_ms), 0)::float8
+		FROM api_request_log
+		WHERE created_at >= $1
+	`, since).Scan(&stats.TotalRequests, &stats.TotalIPs, &stats.AvgResponseTime)
+	if err != nil {
+		return nil, fmt.Errorf("request stats query failed: %w", err)
+	}
+	return stats, nil
+}
+
 // Health checks database health
 func (db *PostgresDB) Health(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -417,7 +798,8 @@ func (db *PostgresDB) Health(ctx context.Context) error {
 // GetASNInfo retrieves ASN information
 func (db *PostgresDB) GetASNInfo(ctx context.Context, asn int) (*models.ASNInfo, error) {
 	query := `
-		SELECT asn, name, org, country_code, asn_type, risk_modifier
+		SELECT asn, COALESCE(name, ''), COALESCE(org, ''), COALESCE(country_code, ''),
+		       COALESCE(asn_type, ''), COALESCE(risk_modifier, 0)
 		FROM asn_info
 		WHERE asn = $1
 	`
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WhitelistEntry represents a whitelisted IP or range
+type WhitelistEntry struct {
+	ID          int        `json:"id"`
+	IPStart     string     `json:"ip_start"`
+	IPEnd       string     `json:"ip_end"`
+	CIDR        *string    `json:"cidr,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Source      string     `json:"source,omitempty"`
+	Permanent   bool       `json:"permanent"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// AddWhitelist adds a whitelist entry, replacing any entry for the same range
+func (db *PostgresDB) AddWhitelist(ctx context.Context, entry *WhitelistEntry) error {
+	query := `
+		INSERT INTO whitelist (ip_start, ip_end, cidr, name, description, source, permanent, expires_at)
+		VALUES ($1::inet, $2::inet, $3::cidr, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8)
+		ON CONFLICT (ip_start, ip_end)
+		DO UPDATE SET
+			cidr = EXCLUDED.cidr,
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			source = EXCLUDED.source,
+			permanent = EXCLUDED.permanent,
+			expires_at = EXCLUDED.expires_at
+		RETURNING id, created_at
+	`
+
+	err := db.pool.QueryRow(ctx, query,
+		entry.IPStart,
+		entry.IPEnd,
+		entry.CIDR,
+		entry.Name,
+		entry.Description,
+		entry.Source,
+		entry.Permanent,
+		entry.ExpiresAt,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("add whitelist failed: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveWhitelist deletes a whitelist entry by ID, reporting whether it existed
+func (db *PostgresDB) RemoveWhitelist(ctx context.Context, id int) (bool, error) {
+	result, err := db.pool.Exec(ctx, "DELETE FROM whitelist WHERE id = $1", id)
+	if err != nil {
+		return false, fmt.Errorf("remove whitelist failed: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ListWhitelist returns all whitelist entries, newest first
+func (db *PostgresDB) ListWhitelist(ctx context.Context) ([]WhitelistEntry, error) {
+	query := `
+		SELECT id, ip_start::text, ip_end::text, cidr::text,
+			COALESCE(name, ''), COALESCE(description, ''), COALESCE(source, ''),
+			COALESCE(permanent, false), expires_at, created_at
+		FROM whitelist
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list whitelist failed: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []WhitelistEntry{}
+	for rows.Next() {
+		var e WhitelistEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.IPStart,
+			&e.IPEnd,
+			&e.CIDR,
+			&e.Name,
+			&e.Description,
+			&e.Source,
+			&e.Permanent,
+			&e.ExpiresAt,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan whitelist entry failed: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,188 @@
+package dnsbl
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// ListedCode is the A record returned for listed IPs (127.0.0.2, the DNSBL convention)
+var ListedCode = netip.AddrFrom4([4]byte{127, 0, 0, 2})
+
+// ErrOutsideZone is returned for query names outside the configured zone
+var ErrOutsideZone = errors.New("query is outside the zone")
+
+// ErrLookup is returned when the reputation of a queried IP could not be read
+var ErrLookup = errors.New("lookup failed")
+
+// LookupFunc returns the reputation result for an IP
+type LookupFunc func(addr netip.Addr) (*models.IPCheckResult, error)
+
+// Config holds DNSBL responder configuration
+type Config struct {
+	Zone      string        // e.g. "dnsbl.example.com"
+	Threshold int           // Minimum score for an IP to be listed
+	CleanTTL  time.Duration // TTL for NXDOMAIN (clean) answers
+	ListedTTL time.Duration // TTL for listed answers
+	MaxCached int           // Maximum cached answers (0 = unlimited)
+}
+
+// Response is a DNSBL answer for a single query
+type Response struct {
+	IP     netip.Addr
+	Listed bool          // false means NXDOMAIN
+	Code   netip.Addr    // A record when listed
+	Text   string        // TXT record when listed
+	TTL    time.Duration // DNS TTL to return
+	Cached bool          // Served from cache
+}
+
+type cacheEntry struct {
+	response Response
+	expires  time.Time
+}
+
+// Responder answers DNSBL queries from reputation lookups, caching both
+// listed and clean (NXDOMAIN) answers for their DNS TTL
+type Responder struct {
+	config Config
+	lookup LookupFunc
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[netip.Addr]cacheEntry
+}
+
+// NewResponder creates a DNSBL responder
+func NewResponder(cfg Config, lookup LookupFunc) *Responder {
+	if cfg.Threshold == 0 {
+		cfg.Threshold = 50
+	}
+	if cfg.CleanTTL == 0 {
+		cfg.CleanTTL = 5 * time.Minute
+	}
+	if cfg.ListedTTL == 0 {
+		cfg.ListedTTL = time.Hour
+	}
+
+	return &Responder{
+		config: cfg,
+		lookup: lookup,
+		now:    time.Now,
+		cache:  make(map[netip.Addr]cacheEntry),
+	}
+}
+
+// Query answers a DNSBL query name such as "4.3.2.1.dnsbl.example.com"
+func (r *Responder) Query(name string) (Response, error) {
+	addr, err := ParseQueryName(name, r.config.Zone)
+	if err != nil {
+		return Response{}, err
+	}
+
+	now := r.now()
+
+	r.mu.Lock()
+	if entry, ok := r.cache[addr]; ok && now.Before(entry.expires) {
+		r.mu.Unlock()
+		resp := entry.response
+		resp.TTL = entry.expires.Sub(now).Round(time.Second)
+		resp.Cached = true
+		return resp, nil
+	}
+	r.mu.Unlock()
+
+	result, err := r.lookup(addr)
+	if err != nil {
+		return Response{}, fmt.Errorf("%w for %s: %w", ErrLookup, addr, err)
+	}
+
+	resp := Response{IP: addr, TTL: r.config.CleanTTL}
+	if result != nil && result.Score >= r.config.Threshold {
+		resp.Listed = true
+		resp.Code = ListedCode
+		resp.Text = fmt.Sprintf("Listed: score %d (%s)", result.Score, result.RiskLevel)
+		resp.TTL = r.config.ListedTTL
+	}
+
+	r.mu.Lock()
+	if r.config.MaxCached > 0 && len(r.cache) >= r.config.MaxCached {
+		r.evictExpired(now)
+		if len(r.cache) >= r.config.MaxCached {
+			r.cache = make(map[netip.Addr]cacheEntry)
+		}
+	}
+	r.cache[addr] = cacheEntry{response: resp, expires: now.Add(resp.TTL)}
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// Invalidate drops all cached answers; call after the reputation data is reloaded
+func (r *Responder) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[netip.Addr]cacheEntry)
+}
+
+// evictExpired removes expired cache entries; caller holds r.mu
+func (r *Responder) evictExpired(now time.Time) {
+	for addr, entry := range r.cache {
+		if !now.Before(entry.expires) {
+			delete(r.cache, addr)
+		}
+	}
+}
+
+// ParseQueryName extracts the IP from a reversed DNSBL query name.
+// IPv4 uses reversed octets, IPv6 uses 32 reversed nibbles.
+func ParseQueryName(name, zone string) (netip.Addr, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+
+	if zone != "" {
+		if !strings.HasSuffix(name, "."+zone) {
+			return netip.Addr{}, fmt.Errorf("%w: %q is not under %q", ErrOutsideZone, name, zone)
+		}
+		name = strings.TrimSuffix(name, "."+zone)
+	}
+
+	labels := strings.Split(name, ".")
+
+	switch len(labels) {
+	case 4:
+		var b [4]byte
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 10, 8)
+			if err != nil {
+				return netip.Addr{}, fmt.Errorf("invalid IPv4 label %q", label)
+			}
+			b[3-i] = byte(n)
+		}
+		return netip.AddrFrom4(b), nil
+
+	case 32:
+		var b [16]byte
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return netip.Addr{}, fmt.Errorf("invalid IPv6 nibble %q", label)
+			}
+			pos := 31 - i
+			if pos%2 == 0 {
+				b[pos/2] |= byte(n) << 4
+			} else {
+				b[pos/2] |= byte(n)
+			}
+		}
+		return netip.AddrFrom16(b), nil
+	}
+
+	return netip.Addr{}, fmt.Errorf("query %q is not a reversed IP", name)
+}
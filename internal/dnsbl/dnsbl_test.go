@@ -0,0 +1,105 @@
+package dnsbl
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestParseQueryName(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"IPv4", "4.3.2.1.dnsbl.example.com", "1.2.3.4", false},
+		{"trailing dot", "4.3.2.1.dnsbl.example.com.", "1.2.3.4", false},
+		{"IPv6", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.dnsbl.example.com", "2001:db8::1", false},
+		{"wrong zone", "4.3.2.1.other.example.com", "", true},
+		{"bad octet", "4.3.2.300.dnsbl.example.com", "", true},
+		{"too few labels", "3.2.1.dnsbl.example.com", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQueryName(tt.query, "dnsbl.example.com")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQueryName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseQueryName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponderCachesCleanAnswers(t *testing.T) {
+	lookups := 0
+	r := NewResponder(Config{Zone: "dnsbl.example.com", CleanTTL: time.Minute, ListedTTL: time.Hour},
+		func(addr netip.Addr) (*models.IPCheckResult, error) {
+			lookups++
+			return &models.IPCheckResult{IP: addr.String(), Score: 0, RiskLevel: "clean"}, nil
+		})
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	first, err := r.Query("4.3.2.1.dnsbl.example.com")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if first.Listed || first.Cached || first.TTL != time.Minute {
+		t.Errorf("first answer = %+v, want uncached NXDOMAIN with 1m TTL", first)
+	}
+
+	now = now.Add(20 * time.Second)
+	second, err := r.Query("4.3.2.1.dnsbl.example.com")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if !second.Cached || second.Listed {
+		t.Errorf("second answer = %+v, want cached NXDOMAIN", second)
+	}
+	if second.TTL != 40*time.Second {
+		t.Errorf("second answer TTL = %v, want remaining 40s", second.TTL)
+	}
+	if lookups != 1 {
+		t.Errorf("lookups = %d, want 1 (second query served from cache)", lookups)
+	}
+
+	// Clean answers expire on the short TTL
+	now = now.Add(time.Minute)
+	if _, err := r.Query("4.3.2.1.dnsbl.example.com"); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if lookups != 2 {
+		t.Errorf("lookups = %d after clean TTL expired, want 2", lookups)
+	}
+
+	// Reload invalidates the cache
+	r.Invalidate()
+	if _, err := r.Query("4.3.2.1.dnsbl.example.com"); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if lookups != 3 {
+		t.Errorf("lookups = %d after Invalidate, want 3", lookups)
+	}
+}
+
+func TestResponderListedAnswer(t *testing.T) {
+	r := NewResponder(Config{Zone: "dnsbl.example.com", Threshold: 50, ListedTTL: time.Hour},
+		func(addr netip.Addr) (*models.IPCheckResult, error) {
+			return &models.IPCheckResult{IP: addr.String(), Score: 85, RiskLevel: "high"}, nil
+		})
+
+	resp, err := r.Query("4.3.2.1.dnsbl.example.com")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if !resp.Listed || resp.Code != ListedCode || resp.TTL != time.Hour {
+		t.Errorf("answer = %+v, want listed 127.0.0.2 with 1h TTL", resp)
+	}
+}
@@ -0,0 +1,179 @@
+package dnsbl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxInflight bounds the queries a Server answers at once
+const maxInflight = 64
+
+// Server answers DNSBL queries over UDP from a Responder
+type Server struct {
+	responder  *Responder
+	zone       dnsmessage.Name
+	hostmaster dnsmessage.Name
+	conn       net.PacketConn
+}
+
+// Listen binds a UDP server for the responder's zone on addr
+func Listen(addr string, responder *Responder) (*Server, error) {
+	zone := strings.TrimSuffix(responder.config.Zone, ".") + "."
+	zoneName, err := dnsmessage.NewName(zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone %q: %w", responder.config.Zone, err)
+	}
+	hostmaster, err := dnsmessage.NewName("hostmaster." + zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone %q: %w", responder.config.Zone, err)
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return &Server{responder: responder, zone: zoneName, hostmaster: hostmaster, conn: conn}, nil
+}
+
+// Addr returns the address the server is bound to
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Serve answers queries until Close is called
+func (s *Server) Serve() error {
+	inflight := make(chan struct{}, maxInflight)
+	for {
+		buf := make([]byte, 512)
+		n, peer, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		inflight <- struct{}{}
+		go func() {
+			defer func() { <-inflight }()
+			if reply := s.answer(buf[:n]); reply != nil {
+				s.conn.WriteTo(reply, peer)
+			}
+		}()
+	}
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// answer builds the reply to one query packet, or nil for packets that are
+// not a well-formed query. Listed IPs get an A and/or TXT answer; clean IPs
+// get NXDOMAIN with an SOA whose minimum TTL lets resolvers cache it.
+func (s *Server) answer(packet []byte) []byte {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(packet)
+	if err != nil || hdr.Response {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+
+	reply := dnsmessage.Header{
+		ID:               hdr.ID,
+		Response:         true,
+		OpCode:           hdr.OpCode,
+		Authoritative:    true,
+		RecursionDesired: hdr.RecursionDesired,
+	}
+	var resp Response
+	if hdr.OpCode != 0 || q.Class != dnsmessage.ClassINET {
+		reply.RCode = dnsmessage.RCodeNotImplemented
+	} else {
+		resp, err = s.responder.Query(q.Name.String())
+		switch {
+		case errors.Is(err, ErrOutsideZone):
+			reply.Authoritative = false
+			reply.RCode = dnsmessage.RCodeRefused
+		case errors.Is(err, ErrLookup):
+			reply.RCode = dnsmessage.RCodeServerFailure
+		case err != nil || !resp.Listed:
+			reply.RCode = dnsmessage.RCodeNameError
+			if err != nil {
+				resp.TTL = s.responder.config.CleanTTL
+			}
+		}
+	}
+
+	out, err := s.build(reply, q, resp)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// build packs a reply to q. Successful replies carry the listed answer of
+// the question's type; those without one, and NXDOMAIN replies, carry the
+// zone's SOA.
+func (s *Server) build(reply dnsmessage.Header, q dnsmessage.Question, resp Response) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), reply)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess && reply.RCode != dnsmessage.RCodeNameError {
+		return b.Finish()
+	}
+
+	ttl := uint32(resp.TTL / time.Second)
+	answered := false
+	if reply.RCode == dnsmessage.RCodeSuccess {
+		if err := b.StartAnswers(); err != nil {
+			return nil, err
+		}
+		rr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+		if q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL {
+			if err := b.AResource(rr, dnsmessage.AResource{A: resp.Code.As4()}); err != nil {
+				return nil, err
+			}
+			answered = true
+		}
+		if q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+			if err := b.TXTResource(rr, dnsmessage.TXTResource{TXT: []string{resp.Text}}); err != nil {
+				return nil, err
+			}
+			answered = true
+		}
+	}
+
+	if !answered {
+		if err := b.StartAuthorities(); err != nil {
+			return nil, err
+		}
+		rr := dnsmessage.ResourceHeader{Name: s.zone, Class: dnsmessage.ClassINET, TTL: ttl}
+		soa := dnsmessage.SOAResource{
+			NS:      s.zone,
+			MBox:    s.hostmaster,
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			MinTTL:  ttl,
+		}
+		if err := b.SOAResource(rr, soa); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
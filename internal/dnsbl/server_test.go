@@ -0,0 +1,134 @@
+package dnsbl
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// startTestServer serves a responder listing 1.2.3.4, failing lookups of
+// 5.5.5.5 and answering every other IP clean
+func startTestServer(t *testing.T) *Server {
+	t.Helper()
+	r := NewResponder(Config{Zone: "dnsbl.example.com", CleanTTL: time.Minute, ListedTTL: time.Hour},
+		func(addr netip.Addr) (*models.IPCheckResult, error) {
+			switch addr.String() {
+			case "1.2.3.4":
+				return &models.IPCheckResult{IP: addr.String(), Score: 90, RiskLevel: "critical"}, nil
+			case "5.5.5.5":
+				return nil, errors.New("reputation data unavailable")
+			}
+			return &models.IPCheckResult{IP: addr.String(), RiskLevel: "clean"}, nil
+		})
+
+	s, err := Listen("127.0.0.1:0", r)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// exchange sends one query for name and type to s and parses the reply
+func exchange(t *testing.T, s *Server, name string, qtype dnsmessage.Type) (dnsmessage.Message, error) {
+	t.Helper()
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return dnsmessage.Message{}, err
+	}
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		return dnsmessage.Message{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(packet); err != nil {
+		return dnsmessage.Message{}, err
+	}
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return dnsmessage.Message{}, err
+	}
+
+	var reply dnsmessage.Message
+	err = reply.Unpack(buf[:n])
+	return reply, err
+}
+
+func TestServerAnswers(t *testing.T) {
+	s := startTestServer(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		qtype     dnsmessage.Type
+		wantRCode dnsmessage.RCode
+		wantTypes []dnsmessage.Type // of the answers
+		wantSOA   uint32            // SOA minimum TTL; 0 for no SOA
+	}{
+		{"listed A", "4.3.2.1.dnsbl.example.com.", dnsmessage.TypeA, dnsmessage.RCodeSuccess, []dnsmessage.Type{dnsmessage.TypeA}, 0},
+		{"listed TXT", "4.3.2.1.dnsbl.example.com.", dnsmessage.TypeTXT, dnsmessage.RCodeSuccess, []dnsmessage.Type{dnsmessage.TypeTXT}, 0},
+		{"listed AAAA has no data", "4.3.2.1.dnsbl.example.com.", dnsmessage.TypeAAAA, dnsmessage.RCodeSuccess, nil, 3600},
+		{"clean", "8.8.8.8.dnsbl.example.com.", dnsmessage.TypeA, dnsmessage.RCodeNameError, nil, 60},
+		{"not a reversed IP", "www.dnsbl.example.com.", dnsmessage.TypeA, dnsmessage.RCodeNameError, nil, 60},
+		{"outside zone", "4.3.2.1.other.example.com.", dnsmessage.TypeA, dnsmessage.RCodeRefused, nil, 0},
+		{"lookup error", "5.5.5.5.dnsbl.example.com.", dnsmessage.TypeA, dnsmessage.RCodeServerFailure, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := exchange(t, s, tt.query, tt.qtype)
+			if err != nil {
+				t.Fatalf("exchange: %v", err)
+			}
+			if reply.ID != 42 || !reply.Response {
+				t.Errorf("header = %+v, want a response to query 42", reply.Header)
+			}
+			if reply.RCode != tt.wantRCode {
+				t.Errorf("RCode = %v, want %v", reply.RCode, tt.wantRCode)
+			}
+
+			if len(reply.Answers) != len(tt.wantTypes) {
+				t.Fatalf("%d answers, want %d", len(reply.Answers), len(tt.wantTypes))
+			}
+			for i, answer := range reply.Answers {
+				if answer.Header.Type != tt.wantTypes[i] {
+					t.Errorf("answer %d type = %v, want %v", i, answer.Header.Type, tt.wantTypes[i])
+				}
+				if answer.Header.TTL != 3600 {
+					t.Errorf("answer %d TTL = %d, want 3600", i, answer.Header.TTL)
+				}
+				if a, ok := answer.Body.(*dnsmessage.AResource); ok && a.A != ListedCode.As4() {
+					t.Errorf("A = %v, want %v", a.A, ListedCode)
+				}
+			}
+
+			var soaTTL uint32
+			for _, auth := range reply.Authorities {
+				if soa, ok := auth.Body.(*dnsmessage.SOAResource); ok {
+					soaTTL = soa.MinTTL
+				}
+			}
+			if soaTTL != tt.wantSOA {
+				t.Errorf("SOA minimum TTL = %d, want %d", soaTTL, tt.wantSOA)
+			}
+		})
+	}
+}
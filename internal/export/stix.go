@@ -0,0 +1,131 @@
+// Package export converts reputation data to formats consumed by external tooling
+package export
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+)
+
+// STIXMediaType is the TAXII 2.1 media type for STIX content
+const STIXMediaType = "application/taxii+json;version=2.1"
+
+// stixNamespace seeds deterministic indicator IDs so the same entry keeps its
+// ID across polls and consumers can deduplicate updates
+var stixNamespace = uuid.MustParse("7d1c6a0e-5b8e-4b8f-9a43-2f0f6c1b9e4d")
+
+// IdentityID is the STIX identity that creates all exported indicators
+var IdentityID = "identity--" + uuid.NewSHA1(stixNamespace, []byte("beon-ipquality")).String()
+
+// KillChainPhase is a STIX kill chain phase reference
+type KillChainPhase struct {
+	KillChainName string `json:"kill_chain_name"`
+	PhaseName     string `json:"phase_name"`
+}
+
+// Indicator is a STIX 2.1 indicator object
+type Indicator struct {
+	Type            string           `json:"type"`
+	SpecVersion     string           `json:"spec_version"`
+	ID              string           `json:"id"`
+	CreatedByRef    string           `json:"created_by_ref"`
+	Created         string           `json:"created"`
+	Modified        string           `json:"modified"`
+	Name            string           `json:"name"`
+	IndicatorTypes  []string         `json:"indicator_types"`
+	Pattern         string           `json:"pattern"`
+	PatternType     string           `json:"pattern_type"`
+	ValidFrom       string           `json:"valid_from"`
+	ValidUntil      string           `json:"valid_until,omitempty"`
+	Confidence      int              `json:"confidence"`
+	Labels          []string         `json:"labels"`
+	KillChainPhases []KillChainPhase `json:"kill_chain_phases,omitempty"`
+}
+
+// threatMapping is the STIX vocabulary used for a threat type
+type threatMapping struct {
+	indicatorType string
+	phase         string // MITRE ATT&CK tactic, empty if none applies
+}
+
+// threatMappings maps our threat types to STIX indicator types and ATT&CK tactics
+var threatMappings = map[string]threatMapping{
+	"tor":        {"anonymization", "command-and-control"},
+	"vpn":        {"anonymization", ""},
+	"proxy":      {"anonymization", "command-and-control"},
+	"datacenter": {"anomalous-activity", ""},
+	"botnet_c2":  {"malicious-activity", "command-and-control"},
+	"malware":    {"malicious-activity", "execution"},
+	"spam":       {"malicious-activity", "initial-access"},
+	"hijacked":   {"compromised", "resource-development"},
+	"attack":     {"malicious-activity", "initial-access"},
+	"suspicious": {"anomalous-activity", ""},
+	"malicious":  {"malicious-activity", ""},
+}
+
+// IndicatorFromEntry maps a reputation entry to a STIX indicator
+func IndicatorFromEntry(entry *database.IPReputationEntry) (Indicator, error) {
+	network := entry.IPStart
+	if entry.CIDR != nil {
+		network = *entry.CIDR
+	}
+
+	objectType, err := addrObjectType(network)
+	if err != nil {
+		return Indicator{}, err
+	}
+
+	mapping, ok := threatMappings[entry.ThreatType]
+	if !ok {
+		mapping = threatMapping{indicatorType: "unknown"}
+	}
+
+	ind := Indicator{
+		Type:           "indicator",
+		SpecVersion:    "2.1",
+		ID:             "indicator--" + uuid.NewSHA1(stixNamespace, []byte(entry.IPStart+"|"+entry.IPEnd+"|"+entry.Source)).String(),
+		CreatedByRef:   IdentityID,
+		Created:        stixTime(entry.FirstSeen),
+		Modified:       stixTime(entry.LastSeen),
+		Name:           fmt.Sprintf("%s %s (%s)", entry.ThreatType, network, entry.Source),
+		IndicatorTypes: []string{mapping.indicatorType},
+		Pattern:        fmt.Sprintf("[%s:value = '%s']", objectType, network),
+		PatternType:    "stix",
+		ValidFrom:      stixTime(entry.FirstSeen),
+		Confidence:     int(math.Round(entry.Confidence * 100)),
+		Labels:         []string{entry.ThreatType, entry.Source},
+	}
+
+	if mapping.phase != "" {
+		ind.KillChainPhases = []KillChainPhase{{KillChainName: "mitre-attack", PhaseName: mapping.phase}}
+	}
+	if entry.ExpiresAt != nil {
+		ind.ValidUntil = stixTime(*entry.ExpiresAt)
+	}
+
+	return ind, nil
+}
+
+// addrObjectType returns the STIX cyber-observable type for an address or CIDR
+func addrObjectType(network string) (string, error) {
+	host, _, _ := strings.Cut(network, "/")
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid network %q: %w", network, err)
+	}
+	if addr.Is4() || addr.Is4In6() {
+		return "ipv4-addr", nil
+	}
+	return "ipv6-addr", nil
+}
+
+// stixTime formats a timestamp as STIX requires (UTC, millisecond precision)
+func stixTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
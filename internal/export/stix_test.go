@@ -0,0 +1,89 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+)
+
+func TestIndicatorFromEntry(t *testing.T) {
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(2024, 2, 1, 12, 30, 0, 0, time.UTC)
+	expires := last.Add(72 * time.Hour)
+	cidr := "45.155.205.0/24"
+
+	tests := []struct {
+		name        string
+		entry       database.IPReputationEntry
+		wantPattern string
+		wantType    string
+		wantPhase   string
+	}{
+		{
+			"botnet single IPv4",
+			database.IPReputationEntry{IPStart: "185.220.101.7", IPEnd: "185.220.101.7", Source: "feodo", ThreatType: "botnet_c2", Confidence: 0.95, FirstSeen: first, LastSeen: last, ExpiresAt: &expires},
+			"[ipv4-addr:value = '185.220.101.7']", "malicious-activity", "command-and-control",
+		},
+		{
+			"hijacked CIDR",
+			database.IPReputationEntry{IPStart: "45.155.205.0", IPEnd: "45.155.205.255", CIDR: &cidr, Source: "spamhaus_drop", ThreatType: "hijacked", Confidence: 1, FirstSeen: first, LastSeen: last},
+			"[ipv4-addr:value = '45.155.205.0/24']", "compromised", "resource-development",
+		},
+		{
+			"vpn IPv6",
+			database.IPReputationEntry{IPStart: "2001:db8::1", IPEnd: "2001:db8::1", Source: "vpn_list", ThreatType: "vpn", Confidence: 0.5, FirstSeen: first, LastSeen: last},
+			"[ipv6-addr:value = '2001:db8::1']", "anonymization", "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ind, err := IndicatorFromEntry(&tt.entry)
+			if err != nil {
+				t.Fatalf("IndicatorFromEntry: %v", err)
+			}
+			if ind.Pattern != tt.wantPattern {
+				t.Errorf("Pattern = %q, want %q", ind.Pattern, tt.wantPattern)
+			}
+			if len(ind.IndicatorTypes) != 1 || ind.IndicatorTypes[0] != tt.wantType {
+				t.Errorf("IndicatorTypes = %v, want [%s]", ind.IndicatorTypes, tt.wantType)
+			}
+			gotPhase := ""
+			if len(ind.KillChainPhases) > 0 {
+				gotPhase = ind.KillChainPhases[0].PhaseName
+			}
+			if gotPhase != tt.wantPhase {
+				t.Errorf("kill chain phase = %q, want %q", gotPhase, tt.wantPhase)
+			}
+			if ind.Confidence != int(tt.entry.Confidence*100) {
+				t.Errorf("Confidence = %d, want %d", ind.Confidence, int(tt.entry.Confidence*100))
+			}
+			if ind.Modified != "2024-02-01T12:30:00.000Z" || ind.ValidFrom != "2024-01-01T00:00:00.000Z" {
+				t.Errorf("Modified/ValidFrom = %s/%s", ind.Modified, ind.ValidFrom)
+			}
+			if !strings.HasPrefix(ind.ID, "indicator--") {
+				t.Errorf("ID = %q, want indicator-- prefix", ind.ID)
+			}
+		})
+	}
+}
+
+func TestIndicatorIDIsStable(t *testing.T) {
+	entry := database.IPReputationEntry{IPStart: "185.220.101.7", IPEnd: "185.220.101.7", Source: "feodo", ThreatType: "botnet_c2", Confidence: 1}
+
+	a, _ := IndicatorFromEntry(&entry)
+	entry.LastSeen = time.Now()
+	entry.Confidence = 0.5
+	b, _ := IndicatorFromEntry(&entry)
+	if a.ID != b.ID {
+		t.Errorf("ID changed across updates: %s != %s", a.ID, b.ID)
+	}
+
+	entry.Source = "other"
+	c, _ := IndicatorFromEntry(&entry)
+	if c.ID == a.ID {
+		t.Errorf("different sources share ID %s", a.ID)
+	}
+}
@@ -0,0 +1,215 @@
+// Package index keeps IP reputation in memory as a longest-prefix-match trie
+// loaded straight from PostgreSQL. It answers the same lookups as the compiled
+// reputation MMDB without the compile and distribute steps, at the cost of
+// holding every active range in each process that serves lookups.
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// ErrNotLoaded is returned by lookups before the first successful Reload
+var ErrNotLoaded = errors.New("reputation index not loaded")
+
+// Source provides the rows the index is built from; *database.PostgresDB
+// implements it
+type Source interface {
+	GetAllActiveReputations(ctx context.Context) ([]database.IPReputationEntry, error)
+	ListWhitelist(ctx context.Context) ([]database.WhitelistEntry, error)
+}
+
+// Index is a reputation trie rebuilt from its Source on Reload. Rows are
+// normalized and scored like the compiler does, whitelisted ranges are left
+// out, and rows for the same range are merged with
+// mmdb.Writer.MergeReputations, so records match what the compiled MMDB holds.
+type Index struct {
+	source  Source
+	scorer  *scoring.Scorer
+	aliases map[string]string
+	writer  *mmdb.Writer
+	trie    atomic.Pointer[Trie]
+}
+
+// New creates an empty index; call Reload to load it
+func New(source Source, cfg scoring.Config) *Index {
+	return &Index{
+		source:  source,
+		scorer:  scoring.New(cfg),
+		aliases: cfg.ThreatTypeAliases,
+		// Like the compiler's writer: no corroboration bonus
+		writer: mmdb.NewWriter(mmdb.WriterConfig{RiskThresholds: cfg.RiskThresholds}),
+	}
+}
+
+// Reload rebuilds the trie from the source and swaps it in, returning the
+// number of prefixes loaded. On error the current trie stays live.
+func (x *Index) Reload(ctx context.Context) (int, error) {
+	rows, err := x.source.GetAllActiveReputations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	whitelist, err := x.source.ListWhitelist(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	trie := x.build(rows, whitelist, time.Now())
+	x.trie.Store(trie)
+	return trie.Len(), nil
+}
+
+// LookupReputation returns the record of the longest listed prefix containing
+// ip, or nil when none does
+func (x *Index) LookupReputation(ip netip.Addr) (*mmdb.ReputationRecord, error) {
+	trie := x.trie.Load()
+	if trie == nil {
+		return nil, ErrNotLoaded
+	}
+	return trie.Lookup(ip), nil
+}
+
+// Loaded reports whether a Reload has succeeded
+func (x *Index) Loaded() bool {
+	return x.trie.Load() != nil
+}
+
+// Len returns the number of prefixes loaded
+func (x *Index) Len() int {
+	if trie := x.trie.Load(); trie != nil {
+		return trie.Len()
+	}
+	return 0
+}
+
+// build scores and merges rows into a new trie
+func (x *Index) build(rows []database.IPReputationEntry, whitelist []database.WhitelistEntry, now time.Time) *Trie {
+	allowed := activeRanges(whitelist, now)
+
+	bySource := make(map[string][]models.IPReputation)
+	for _, row := range rows {
+		if whitelisted(allowed, row.IPStart, row.IPEnd) {
+			continue
+		}
+
+		ipRange := row.IPStart
+		if row.CIDR != nil {
+			ipRange = *row.CIDR
+		}
+		threatType, _ := scoring.NormalizeThreatType(x.aliases, row.ThreatType)
+		rep := models.IPReputation{
+			ID:         row.ID,
+			IPRange:    ipRange,
+			Source:     row.Source,
+			ThreatType: threatType,
+			Confidence: row.Confidence,
+			Weight:     row.Weight,
+			FirstSeen:  row.FirstSeen,
+			LastSeen:   row.LastSeen,
+			Metadata:   models.Metadata{Tags: metadataTags(row.Metadata)},
+		}
+		rep.RiskScore = x.scorer.CalculateScore([]models.Threat{{
+			ThreatType: rep.ThreatType,
+			Source:     rep.Source,
+			Confidence: rep.Confidence,
+			LastSeen:   rep.LastSeen,
+			Weight:     rep.Weight,
+		}}, nil, now)
+		bySource[rep.Source] = append(bySource[rep.Source], rep)
+	}
+
+	trie := &Trie{}
+	for _, entry := range x.writer.MergeReputations(bySource) {
+		// The reader treats such records as unlisted
+		if entry.RiskScore == 0 && entry.ThreatType == "" {
+			continue
+		}
+		rec := entry.Record()
+		// Lookups hand out shallow copies; clipping makes appends to their
+		// slices reallocate instead of writing into the shared arrays
+		rec.Sources = slices.Clip(rec.Sources)
+		rec.Tags = slices.Clip(rec.Tags)
+		trie.Insert(entry.Prefix.Masked(), rec)
+	}
+	return trie
+}
+
+// addrRange is an inclusive address range
+type addrRange struct {
+	start, end netip.Addr
+}
+
+// activeRanges returns the whitelist ranges in effect at now, matching the
+// compiler's whitelist filter
+func activeRanges(whitelist []database.WhitelistEntry, now time.Time) []addrRange {
+	var ranges []addrRange
+	for _, w := range whitelist {
+		if !w.Permanent && w.ExpiresAt != nil && !w.ExpiresAt.After(now) {
+			continue
+		}
+		start, err1 := parseAddr(w.IPStart)
+		end, err2 := parseAddr(w.IPEnd)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		ranges = append(ranges, addrRange{start, end})
+	}
+	return ranges
+}
+
+// whitelisted reports whether the row range lies within one of ranges
+func whitelisted(ranges []addrRange, ipStart, ipEnd string) bool {
+	if len(ranges) == 0 {
+		return false
+	}
+	start, err1 := parseAddr(ipStart)
+	end, err2 := parseAddr(ipEnd)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	for _, r := range ranges {
+		if start.BitLen() == r.start.BitLen() && r.start.Compare(start) <= 0 && end.Compare(r.end) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr parses an inet's text form, which carries a mask unless it is a
+// single host
+func parseAddr(s string) (netip.Addr, error) {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+	return addr.Unmap(), nil
+}
+
+// metadataTags returns the string tags of a row's metadata
+func metadataTags(metadata map[string]interface{}) []string {
+	raw, ok := metadata["tags"].([]interface{})
+	if !ok {
+		return nil
+	}
+	tags := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if tag, ok := v.(string); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
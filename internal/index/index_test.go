@@ -0,0 +1,208 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+)
+
+type fakeSource struct {
+	rows      []database.IPReputationEntry
+	whitelist []database.WhitelistEntry
+	err       error
+}
+
+func (f *fakeSource) GetAllActiveReputations(context.Context) ([]database.IPReputationEntry, error) {
+	return f.rows, f.err
+}
+
+func (f *fakeSource) ListWhitelist(context.Context) ([]database.WhitelistEntry, error) {
+	return f.whitelist, nil
+}
+
+func TestTrieLongestPrefixMatch(t *testing.T) {
+	var trie Trie
+	trie.Insert(netip.MustParsePrefix("45.155.0.0/16"), &mmdb.ReputationRecord{RiskScore: 40})
+	trie.Insert(netip.MustParsePrefix("45.155.205.0/24"), &mmdb.ReputationRecord{RiskScore: 70})
+	trie.Insert(netip.MustParsePrefix("45.155.205.233/32"), &mmdb.ReputationRecord{RiskScore: 95})
+	trie.Insert(netip.MustParsePrefix("::ffff:185.220.101.0/120"), &mmdb.ReputationRecord{RiskScore: 80})
+	trie.Insert(netip.MustParsePrefix("2a0e:1c80::/32"), &mmdb.ReputationRecord{RiskScore: 60})
+
+	tests := []struct {
+		ip   string
+		want int // 0 = not listed
+	}{
+		{"45.155.1.1", 40},
+		{"45.155.205.7", 70},
+		{"45.155.205.233", 95},
+		{"::ffff:45.155.205.233", 95},
+		{"45.156.0.1", 0},
+		{"185.220.101.7", 80},
+		{"2a0e:1c80:1::1", 60},
+		{"2a0e:1c81::1", 0},
+	}
+	for _, tt := range tests {
+		got := trie.Lookup(netip.MustParseAddr(tt.ip))
+		if tt.want == 0 {
+			if got != nil {
+				t.Errorf("Lookup(%s) = score %d, want nil", tt.ip, got.RiskScore)
+			}
+			continue
+		}
+		if got == nil || got.RiskScore != tt.want {
+			t.Errorf("Lookup(%s) = %+v, want score %d", tt.ip, got, tt.want)
+		}
+	}
+	if trie.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", trie.Len())
+	}
+}
+
+func TestIndexReload(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+	src := &fakeSource{
+		rows: []database.IPReputationEntry{
+			{IPStart: "45.155.205.0", IPEnd: "45.155.205.255", CIDR: ptr("45.155.205.0/24"), Source: "feodo", ThreatType: "c2", Confidence: 0.9, Weight: 100, LastSeen: now,
+				Metadata: map[string]interface{}{"tags": []interface{}{"emotet"}}},
+			{IPStart: "45.155.205.0", IPEnd: "45.155.205.255", CIDR: ptr("45.155.205.0/24"), Source: "spamhaus", ThreatType: "spam", Confidence: 0.8, Weight: 100, LastSeen: now},
+			{IPStart: "185.220.101.7", IPEnd: "185.220.101.7", Source: "tor_exits", ThreatType: "tor", Confidence: 1, Weight: 100, LastSeen: now},
+			// Whitelisted, and listed again under an expired whitelist entry
+			{IPStart: "104.16.0.1", IPEnd: "104.16.0.1", Source: "proxies", ThreatType: "proxy", Confidence: 0.7, Weight: 100, LastSeen: now},
+			{IPStart: "104.17.0.1", IPEnd: "104.17.0.1", Source: "proxies", ThreatType: "proxy", Confidence: 0.7, Weight: 100, LastSeen: now},
+		},
+		whitelist: []database.WhitelistEntry{
+			{IPStart: "104.16.0.0/16", IPEnd: "104.16.255.255/16", Permanent: true},
+			{IPStart: "104.17.0.0", IPEnd: "104.17.255.255", ExpiresAt: &expired},
+		},
+	}
+
+	x := New(src, scoring.DefaultConfig())
+	if _, err := x.LookupReputation(netip.MustParseAddr("185.220.101.7")); !errors.Is(err, ErrNotLoaded) {
+		t.Fatalf("LookupReputation before Reload error = %v, want ErrNotLoaded", err)
+	}
+
+	n, err := x.Reload(context.Background())
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if n != 3 || x.Len() != 3 {
+		t.Errorf("Reload() = %d prefixes, Len() = %d, want 3", n, x.Len())
+	}
+
+	rec, _ := x.LookupReputation(netip.MustParseAddr("45.155.205.9"))
+	if rec == nil || rec.ThreatType == "" || rec.RiskScore == 0 {
+		t.Fatalf("45.155.205.9 = %+v, want a listed record", rec)
+	}
+	if !rec.IsBotnet || !rec.IsSpam || len(rec.Sources) != 2 || !slices.Contains(rec.Tags, "emotet") || rec.AggregateConfidence != 98 {
+		t.Errorf("merged record = %+v, want botnet and spam flags, 2 sources, the emotet tag and aggregate confidence 98", rec)
+	}
+
+	if rec, _ := x.LookupReputation(netip.MustParseAddr("185.220.101.7")); rec == nil || !rec.IsTor || rec.Confidence != 100 {
+		t.Errorf("185.220.101.7 = %+v, want a tor record with confidence 100", rec)
+	}
+	if rec, _ := x.LookupReputation(netip.MustParseAddr("104.16.0.1")); rec != nil {
+		t.Errorf("whitelisted 104.16.0.1 = %+v, want nil", rec)
+	}
+	if rec, _ := x.LookupReputation(netip.MustParseAddr("104.17.0.1")); rec == nil {
+		t.Error("104.17.0.1 under an expired whitelist entry is not listed")
+	}
+
+	// A failed reload keeps the loaded trie
+	src.err = errors.New("connection refused")
+	if _, err := x.Reload(context.Background()); err == nil {
+		t.Fatal("Reload() with a failing source succeeded")
+	}
+	if rec, _ := x.LookupReputation(netip.MustParseAddr("185.220.101.7")); rec == nil {
+		t.Error("a failed reload dropped the loaded trie")
+	}
+}
+
+func ptr(s string) *string { return &s }
+
+// benchmarkEntries returns n random public /24s and addresses inside them
+func benchmarkEntries(n int) ([]mmdb.ReputationEntry, []netip.Addr) {
+	rng := rand.New(rand.NewSource(1))
+	entries := make([]mmdb.ReputationEntry, 0, n)
+	ips := make([]netip.Addr, 0, n)
+	seen := make(map[netip.Prefix]bool, n)
+	for len(entries) < n {
+		a := [4]byte{byte(20 + rng.Intn(80)), byte(rng.Intn(256)), byte(rng.Intn(256)), 0}
+		prefix := netip.PrefixFrom(netip.AddrFrom4(a), 24)
+		if seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		entries = append(entries, mmdb.ReputationEntry{
+			Prefix:     prefix,
+			RiskScore:  50 + rng.Intn(50),
+			RiskLevel:  "high",
+			ThreatType: "proxy",
+			Confidence: 0.8,
+			Sources:    []string{"bench"},
+			Flags:      mmdb.EntryFlags{IsProxy: true},
+			LastUpdate: time.Now(),
+		})
+		a[3] = byte(1 + rng.Intn(254))
+		ips = append(ips, netip.AddrFrom4(a))
+	}
+	return entries, ips
+}
+
+// BenchmarkLookup compares the trie with the compiled MMDB on the same
+// prefixes, for listed and unlisted addresses
+func BenchmarkLookup(b *testing.B) {
+	entries, listed := benchmarkEntries(50000)
+	unlisted := make([]netip.Addr, len(listed))
+	for i, ip := range listed {
+		a := ip.As4()
+		a[0] += 110 // 130.0.0.0-209.255.255.255: outside the generated range
+		unlisted[i] = netip.AddrFrom4(a)
+	}
+
+	var trie Trie
+	for _, e := range entries {
+		trie.Insert(e.Prefix, e.Record())
+	}
+
+	path := filepath.Join(b.TempDir(), "reputation.mmdb")
+	if err := mmdb.NewDefaultWriter().CompileToMMDB(entries, path); err != nil {
+		b.Fatalf("CompileToMMDB: %v", err)
+	}
+	reader, err := mmdb.NewReader(path, "", "")
+	if err != nil {
+		b.Fatalf("NewReader: %v", err)
+	}
+	b.Cleanup(func() { reader.Close() })
+
+	sources := map[string]mmdb.ReputationSource{"trie": trieSource{&trie}, "mmdb": reader}
+	for _, name := range []string{"trie", "mmdb"} {
+		for kind, ips := range map[string][]netip.Addr{"listed": listed, "unlisted": unlisted} {
+			b.Run(fmt.Sprintf("%s/%s", name, kind), func(b *testing.B) {
+				src := sources[name]
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := src.LookupReputation(ips[i%len(ips)]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+type trieSource struct{ trie *Trie }
+
+func (s trieSource) LookupReputation(ip netip.Addr) (*mmdb.ReputationRecord, error) {
+	return s.trie.Lookup(ip), nil
+}
@@ -0,0 +1,96 @@
+package index
+
+import (
+	"net/netip"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
+)
+
+// Trie is a binary prefix trie of reputation records. IPv4 prefixes, including
+// IPv4-mapped IPv6 ones, live in their own tree so IPv4 lookups walk at most
+// 32 levels. A Trie must not be modified while it is being read; Index builds
+// a new one on every reload.
+type Trie struct {
+	v4, v6 node
+	size   int
+}
+
+type node struct {
+	children [2]*node
+	record   *mmdb.ReputationRecord
+}
+
+// Insert stores rec for prefix, replacing the record already stored for
+// exactly that prefix
+func (t *Trie) Insert(prefix netip.Prefix, rec *mmdb.ReputationRecord) {
+	addr, bits := prefix.Addr(), prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		addr, bits = addr.Unmap(), bits-96
+	}
+	key := addrKey(addr)
+
+	n := t.root(addr)
+	for i := 0; i < bits; i++ {
+		b := bitAt(&key, i)
+		if n.children[b] == nil {
+			n.children[b] = &node{}
+		}
+		n = n.children[b]
+	}
+	if n.record == nil {
+		t.size++
+	}
+	n.record = rec
+}
+
+// Lookup returns a copy of the record of the longest prefix containing ip,
+// or nil when no prefix does
+func (t *Trie) Lookup(ip netip.Addr) *mmdb.ReputationRecord {
+	ip = ip.Unmap()
+	key := addrKey(ip)
+
+	var best *mmdb.ReputationRecord
+	n := t.root(ip)
+	for i, bits := 0, ip.BitLen(); n != nil; i++ {
+		if n.record != nil {
+			best = n.record
+		}
+		if i == bits {
+			break
+		}
+		n = n.children[bitAt(&key, i)]
+	}
+
+	if best == nil {
+		return nil
+	}
+	rec := *best
+	return &rec
+}
+
+// Len returns the number of prefixes stored
+func (t *Trie) Len() int {
+	return t.size
+}
+
+func (t *Trie) root(addr netip.Addr) *node {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// addrKey returns the address bytes, IPv4 in the first four
+func addrKey(addr netip.Addr) [16]byte {
+	if addr.Is4() {
+		var key [16]byte
+		v4 := addr.As4()
+		copy(key[:], v4[:])
+		return key
+	}
+	return addr.As16()
+}
+
+func bitAt(key *[16]byte, i int) byte {
+	return key[i/8] >> (7 - i%8) & 1
+}
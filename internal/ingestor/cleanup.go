@@ -0,0 +1,52 @@
+package ingestor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+)
+
+// Reasons used as the reason label of ReputationRowsRemoved
+const (
+	removedExpired   = "expired"
+	removedRetention = "retention"
+)
+
+// scheduleCleanup adds the periodic cleanup to the cron scheduler when a
+// database is attached and database.retention.cleanup_interval is set
+func (i *Ingestor) scheduleCleanup() {
+	interval := i.config.Database.Retention.CleanupInterval
+	if i.db == nil || interval <= 0 {
+		return
+	}
+
+	i.log.Info(fmt.Sprintf("Scheduling reputation cleanup every %v", interval))
+	if _, err := i.cron.AddFunc(fmt.Sprintf("@every %v", interval), func() {
+		i.cleanup(i.runCtx)
+	}); err != nil {
+		i.log.Error(fmt.Sprintf("Failed to schedule cleanup: %v", err))
+	}
+}
+
+// cleanup deletes entries past expires_at, then those not seen within the
+// retention of their threat type
+func (i *Ingestor) cleanup(ctx context.Context) {
+	start := time.Now()
+	retention := i.config.Database.Retention
+
+	expired, err := i.db.CleanupExpired(ctx)
+	if err != nil {
+		i.log.Error(fmt.Sprintf("Cleanup of expired entries failed: %v", err))
+	}
+	metrics.ReputationRowsRemoved.WithLabelValues(removedExpired).Add(float64(expired))
+
+	stale, err := i.db.CleanupByRetention(ctx, retention.ThreatTypes, retention.Default)
+	if err != nil {
+		i.log.Error(fmt.Sprintf("Retention cleanup failed: %v", err))
+	}
+	metrics.ReputationRowsRemoved.WithLabelValues(removedRetention).Add(float64(stale))
+
+	i.log.Info(fmt.Sprintf("Cleanup removed %d expired and %d stale entries in %v", expired, stale, time.Since(start).Round(time.Millisecond)))
+}
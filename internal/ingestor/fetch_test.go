@@ -0,0 +1,398 @@
+package ingestor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+)
+
+func TestFetchSourceRejectsOversizedFeed(t *testing.T) {
+	const limit = 64 * 1024
+
+	// Streams lines well past the limit without a Content-Length
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for n := 0; n < 10000; n++ {
+			if _, err := fmt.Fprintf(w, "10.%d.%d.1\n", n/256%256, n%256); err != nil {
+				return
+			}
+			if n%500 == 0 {
+				flusher.Flush()
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	ing.config.Ingestor.MaxFeedSize = limit
+
+	_, err := ing.fetchSource(context.Background(), config.SourceConfig{URL: srv.URL}, config.FeedConfig{})
+	if !errors.Is(err, ErrFeedTooLarge) {
+		t.Fatalf("fetchSource() error = %v, want ErrFeedTooLarge", err)
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		limit   int64
+		wantErr bool
+	}{
+		{"under limit", 10, 16, false},
+		{"exactly at limit", 16, 16, false},
+		{"over limit", 17, 16, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := readLimited(strings.NewReader(strings.Repeat("x", tt.size)), tt.limit)
+			if tt.wantErr {
+				if !errors.Is(err, ErrFeedTooLarge) {
+					t.Errorf("readLimited() error = %v, want ErrFeedTooLarge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readLimited() error = %v", err)
+			}
+			if len(body) != tt.size {
+				t.Errorf("readLimited() read %d bytes, want %d", len(body), tt.size)
+			}
+		})
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	transport, err := newTransport(config.IngestorConfig{
+		MaxIdleConns:        50,
+		MaxIdleConnsPerHost: 5,
+		IdleConnTimeout:     30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("newTransport() error = %v", err)
+	}
+	if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 5 || transport.IdleConnTimeout != 30*time.Second {
+		t.Errorf("transport pool settings = %d/%d/%v, want 50/5/30s",
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	if _, err := newTransport(config.IngestorConfig{ProxyURL: "not a url"}); err == nil {
+		t.Error("newTransport() accepted an invalid proxy_url")
+	}
+}
+
+func TestFetchSourceThroughProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("192.0.2.1\n"))
+	}))
+	defer proxy.Close()
+
+	cfg := &config.Config{}
+	cfg.Ingestor.HTTPTimeout = 5 * time.Second
+	cfg.Ingestor.ProxyURL = proxy.URL
+
+	ing, err := New(cfg, &config.FeedsConfig{}, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	entries, err := ing.fetchSource(context.Background(), config.SourceConfig{URL: "http://feeds.example.invalid/list.txt"}, config.FeedConfig{})
+	if err != nil {
+		t.Fatalf("fetchSource() error = %v", err)
+	}
+	if proxied != "http://feeds.example.invalid/list.txt" {
+		t.Errorf("proxy received %q, want the feed URL", proxied)
+	}
+	if len(entries) != 1 {
+		t.Errorf("fetchSource() returned %d entries, want 1", len(entries))
+	}
+}
+
+func TestFetchSourceHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		fmt.Fprintln(w, "192.0.2.1")
+	}))
+	defer srv.Close()
+
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	ing.config.Ingestor.UserAgent = "BEON-IPQuality-Ingestor/1.0"
+
+	tests := []struct {
+		name       string
+		source     config.SourceConfig
+		wantUA     string
+		wantHeader map[string]string
+	}{
+		{"global user agent", config.SourceConfig{}, "BEON-IPQuality-Ingestor/1.0", nil},
+		{"source user agent", config.SourceConfig{UserAgent: "Picky-Feed/2.0"}, "Picky-Feed/2.0", nil},
+		{
+			"extra headers",
+			config.SourceConfig{Headers: map[string]string{"accept": "text/plain", "x-feed-token": "secret"}},
+			"BEON-IPQuality-Ingestor/1.0",
+			map[string]string{"Accept": "text/plain", "X-Feed-Token": "secret"},
+		},
+		{
+			"user_agent wins over a User-Agent header",
+			config.SourceConfig{UserAgent: "Picky-Feed/2.0", Headers: map[string]string{"user-agent": "ignored"}},
+			"Picky-Feed/2.0",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.source.URL = srv.URL
+			if _, err := ing.fetchSource(context.Background(), tt.source, config.FeedConfig{}); err != nil {
+				t.Fatalf("fetchSource() error = %v", err)
+			}
+			if ua := got.Get("User-Agent"); ua != tt.wantUA {
+				t.Errorf("User-Agent = %q, want %q", ua, tt.wantUA)
+			}
+			for name, want := range tt.wantHeader {
+				if v := got.Get(name); v != want {
+					t.Errorf("%s = %q, want %q", name, v, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchSourceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.txt")
+	if err := os.WriteFile(path, []byte("# mirrored feed\n192.0.2.1\n198.51.100.0/24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	source := config.SourceConfig{URL: "file://" + filepath.ToSlash(path), Format: "plain"}
+	entries, err := ing.fetchSource(context.Background(), source, config.FeedConfig{})
+	if err != nil {
+		t.Fatalf("fetchSource() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("fetchSource() = %d entries, want 2", len(entries))
+	}
+
+	source.URL = "file://" + filepath.ToSlash(filepath.Join(t.TempDir(), "missing.txt"))
+	if _, err := ing.fetchSource(context.Background(), source, config.FeedConfig{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("fetchSource(missing file) error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestFetchSourceS3(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization")
+		fmt.Fprintln(w, "192.0.2.1")
+	}))
+	defer srv.Close()
+
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	source := config.SourceConfig{URL: "s3://feeds/mirror/spam list.txt", Format: "plain"}
+
+	if _, err := ing.fetchSource(context.Background(), source, config.FeedConfig{}); err == nil {
+		t.Errorf("fetchSource() without ingestor.s3.endpoint succeeded, want an error")
+	}
+
+	ing.config.Ingestor.S3 = config.S3Config{Endpoint: srv.URL}
+	entries, err := ing.fetchSource(context.Background(), source, config.FeedConfig{})
+	if err != nil {
+		t.Fatalf("fetchSource() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("fetchSource() = %d entries, want 1", len(entries))
+	}
+	if gotPath != "/feeds/mirror/spam%20list.txt" {
+		t.Errorf("request path = %q, want /feeds/mirror/spam%%20list.txt", gotPath)
+	}
+	if gotAuth != "" {
+		t.Errorf("anonymous request sent Authorization %q", gotAuth)
+	}
+
+	ing.config.Ingestor.S3 = config.S3Config{Endpoint: srv.URL, Region: "eu-west-1", AccessKey: "AKIDEXAMPLE", SecretKey: "secret"}
+	if _, err := ing.fetchSource(context.Background(), source, config.FeedConfig{}); err != nil {
+		t.Fatalf("fetchSource() error = %v", err)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(gotAuth, "/eu-west-1/s3/aws4_request") {
+		t.Errorf("Authorization = %q, want a SigV4 signature for eu-west-1", gotAuth)
+	}
+}
+
+func TestMinEntriesRejectsErrorPage(t *testing.T) {
+	var degraded atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if degraded.Load() {
+			// Broken upstream that still answers 200
+			fmt.Fprint(w, "<html>\n<head><title>Service Unavailable</title></head>\n<body>Try again later</body>\n</html>\n")
+			return
+		}
+		for n := 1; n <= 5; n++ {
+			fmt.Fprintf(w, "192.0.2.%d\n", n)
+		}
+	}))
+	defer srv.Close()
+
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	feed := config.FeedConfig{Name: "test_feed", MinEntries: 3, Sources: []config.SourceConfig{{URL: srv.URL, Name: "list"}}}
+
+	fetch := func() (int, error) {
+		entries, err := ing.fetchSource(context.Background(), feed.Sources[0], feed)
+		if err != nil {
+			t.Fatalf("fetchSource() error = %v", err)
+		}
+		return len(entries), ing.checkMinEntries(context.Background(), "test_feed", feed, len(entries))
+	}
+
+	// A healthy first run is stored and becomes the baseline
+	n, err := fetch()
+	if n != 5 || err != nil {
+		t.Fatalf("healthy fetch = %d entries, %v; want 5, nil", n, err)
+	}
+	ing.recordFeedRun("test_feed", feed, n, n, nil, time.Second)
+
+	degraded.Store(true)
+	n, err = fetch()
+	if n != 0 || !errors.Is(err, ErrTooFewEntries) {
+		t.Fatalf("degraded fetch = %d entries, %v; want 0, ErrTooFewEntries", n, err)
+	}
+
+	run := feedRun("test_feed", feed, 0, 0, []error{fmt.Errorf("list: %w", err)}, time.Second)
+	if run.Status != database.FeedRunError {
+		t.Errorf("run status = %q, want %q", run.Status, database.FeedRunError)
+	}
+	ing.recordFeedRun("test_feed", feed, 0, 0, []error{err}, time.Second)
+
+	// The failed run does not lower the baseline
+	if _, err := fetch(); !errors.Is(err, ErrTooFewEntries) {
+		t.Errorf("second degraded fetch error = %v, want ErrTooFewEntries", err)
+	}
+
+	// Feeds that have always been small are not held to the threshold
+	ing.recordFeedRun("small_feed", feed, 2, 2, nil, time.Second)
+	if err := ing.checkMinEntries(context.Background(), "small_feed", feed, 0); err != nil {
+		t.Errorf("small feed error = %v, want nil", err)
+	}
+	if err := ing.checkMinEntries(context.Background(), "new_feed", feed, 0); err != nil {
+		t.Errorf("feed without history error = %v, want nil", err)
+	}
+}
+
+func TestMinEntriesChecksFeedTotal(t *testing.T) {
+	// Two sources of 60 entries each; b can turn into an error page
+	var degraded atomic.Bool
+	list := func(prefix string, broken *atomic.Bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if broken != nil && broken.Load() {
+				fmt.Fprint(w, "<html><body>Service Unavailable</body></html>\n")
+				return
+			}
+			for n := 1; n <= 60; n++ {
+				fmt.Fprintf(w, "%s.%d\n", prefix, n)
+			}
+		}))
+	}
+	a := list("192.0.2", nil)
+	defer a.Close()
+	b := list("198.51.100", &degraded)
+	defer b.Close()
+
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	feed := config.FeedConfig{
+		Name:       "split_feed",
+		ThreatType: "malware",
+		MinEntries: 100,
+		Sources: []config.SourceConfig{
+			{Name: "a", URL: a.URL, Format: "plain"},
+			{Name: "b", URL: b.URL, Format: "plain"},
+		},
+	}
+	ing.recordFeedRun("split_feed", feed, 120, 120, nil, time.Second)
+
+	// Neither source reaches min_entries alone, but the feed does
+	entries, stored, err := ing.processFeedWithStats(context.Background(), "split_feed", feed)
+	if entries != 120 || stored != 120 || err != nil {
+		t.Fatalf("healthy run = %d entries, %d stored, %v; want 120, 120, nil", entries, stored, err)
+	}
+
+	storedBefore := testutil.ToFloat64(metrics.FeedEntriesStored.WithLabelValues("split_feed"))
+
+	// With b broken the feed falls short and a is not stored either
+	degraded.Store(true)
+	entries, stored, _ = ing.processFeedWithStats(context.Background(), "split_feed", feed)
+	if entries != 60 || stored != 0 {
+		t.Errorf("degraded run = %d entries, %d stored; want 60 fetched and none stored", entries, stored)
+	}
+	ing.processFeed(context.Background(), "split_feed", feed)
+	if got := testutil.ToFloat64(metrics.FeedsProcessed.WithLabelValues("split_feed", "error")); got != 2 {
+		t.Errorf("ipquality_feeds_processed_total{status=error} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.FeedEntriesStored.WithLabelValues("split_feed")); got != storedBefore {
+		t.Errorf("ipquality_feed_entries_stored_total = %v, want %v: rejected runs store nothing", got, storedBefore)
+	}
+}
+
+func TestFeedTimeoutCutsOffSlowSource(t *testing.T) {
+	// Never answers until the client gives up
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+
+	var fastCalls atomic.Int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastCalls.Add(1)
+	}))
+	defer fast.Close()
+
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	ing.config.Ingestor.FeedTimeout = 100 * time.Millisecond
+
+	feed := config.FeedConfig{
+		Name: "stuck",
+		Sources: []config.SourceConfig{
+			{Name: "slow", URL: slow.URL, Format: "plain"},
+			{Name: "fast", URL: fast.URL, Format: "plain"},
+		},
+	}
+
+	start := time.Now()
+	_, _, err := ing.processFeedWithStats(context.Background(), "stuck", feed)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("processFeedWithStats() took %v, want it cut off at the feed timeout", elapsed)
+	}
+	if !errors.Is(err, ErrFeedTimeout) {
+		t.Errorf("processFeedWithStats() error = %v, want ErrFeedTimeout", err)
+	}
+	if fastCalls.Load() != 0 {
+		t.Errorf("fast source fetched %d times after the feed timed out, want 0", fastCalls.Load())
+	}
+
+	// A feed's own timeout overrides the ingestor's
+	ing.config.Ingestor.FeedTimeout = time.Hour
+	feed.Timeout = 50 * time.Millisecond
+	start = time.Now()
+	ing.processFeed(context.Background(), "stuck", feed)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("processFeed() took %v, want it cut off at the feed's timeout", elapsed)
+	}
+}
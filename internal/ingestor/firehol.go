@@ -0,0 +1,70 @@
+package ingestor
+
+import (
+	"strings"
+)
+
+// fireholCategoryTypes maps FireHOL ipset categories to threat type labels.
+// Categories without an entry (geolocation, organizations, ...) say nothing
+// about maliciousness, so those lists keep the feed's threat_type.
+var fireholCategoryTypes = map[string]string{
+	"abuse":       "suspicious",
+	"anonymizers": "proxy",
+	"attacks":     "attack",
+	"malware":     "malware",
+	"reputation":  "suspicious",
+	"spam":        "spam",
+	"unroutable":  "bogon",
+}
+
+// fireholHeader is the metadata of a FireHOL netset/ipset file, read from
+// its leading "# Key : Value" comment block
+type fireholHeader struct {
+	category   string
+	maintainer string
+}
+
+// parseFireHOLHeader reads the comment block at the top of a FireHOL list,
+// stopping at the first entry
+func parseFireHOLHeader(content string) fireholHeader {
+	var h fireholHeader
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "#"), ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "category":
+			h.category = strings.ToLower(strings.TrimSpace(value))
+		case "maintainer":
+			h.maintainer = strings.TrimSpace(value)
+		}
+	}
+	return h
+}
+
+// threatType returns the threat type label of the list's category, or ""
+// when the category does not imply one
+func (h fireholHeader) threatType() string {
+	return fireholCategoryTypes[h.category]
+}
+
+// description records where the list's entries came from
+func (h fireholHeader) description() string {
+	var parts []string
+	if h.maintainer != "" {
+		parts = append(parts, "maintainer: "+h.maintainer)
+	}
+	if h.category != "" {
+		parts = append(parts, "category: "+h.category)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -2,47 +2,171 @@ package ingestor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/robfig/cron/v3"
 
 	"github.com/lfrfrfr/beon-ipquality/internal/config"
 	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
 	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
 	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
 	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
 
+// defaultMaxFeedSize is used when ingestor.max_feed_size is not configured
+const defaultMaxFeedSize = 200 * 1024 * 1024
+
+// ErrFeedTooLarge is returned when a feed response exceeds ingestor.max_feed_size
+var ErrFeedTooLarge = errors.New("feed response too large")
+
+// ErrTooFewEntries is returned when a feed's sources together yield fewer
+// entries than its min_entries, e.g. because one started serving an HTML
+// error page
+var ErrTooFewEntries = errors.New("too few feed entries")
+
+// ErrFeedTimeout is returned when a feed run exceeds its timeout; sources not
+// fetched by then are skipped
+var ErrFeedTimeout = errors.New("feed timed out")
+
+// Tor exit list parsing
+const (
+	torExitTimeLayout = "2006-01-02 15:04:05"
+	torExitConfidence = 0.95 // Minimum confidence for entries from the Tor exit list
+)
+
 // Ingestor handles fetching and processing threat feeds
 type Ingestor struct {
 	config      *config.Config
-	feedsConfig *config.FeedsConfig
+	feedsConfig atomic.Pointer[config.FeedsConfig]
 	httpClient  *http.Client
 	db          *database.PostgresDB
+	instanceID  string
+	log         *logger.Logger
 	cron        *cron.Cron
 	mu          sync.RWMutex
 	running     bool
 	wg          sync.WaitGroup
+
+	// Context of the running service and the cron entry of each scheduled
+	// feed, kept so Reload can reschedule
+	runCtx    context.Context
+	scheduled map[string]cron.EntryID
+
+	// threatTypeAliases normalize feed threat types; each unmapped type is
+	// logged once
+	threatTypeAliases map[string]string
+	unmappedTypes     sync.Map
+
+	// Entry counts of each feed's last successful run, for min_entries
+	lastEntries       map[string]int
+	lastEntriesLoaded bool
+	lastEntriesMu     sync.Mutex
 }
 
 // New creates a new Ingestor instance
 func New(cfg *config.Config, feedsCfg *config.FeedsConfig, db *database.PostgresDB) (*Ingestor, error) {
+	transport, err := newTransport(cfg.Ingestor)
+	if err != nil {
+		return nil, err
+	}
+
 	httpClient := &http.Client{
-		Timeout: cfg.Ingestor.HTTPTimeout,
+		Timeout:   cfg.Ingestor.HTTPTimeout,
+		Transport: transport,
+	}
+
+	aliases, err := scoring.ThreatTypeAliases(cfg.Scoring.ThreatTypeAliases)
+	if err != nil {
+		return nil, err
+	}
+
+	ing := &Ingestor{
+		config:     cfg,
+		httpClient: httpClient,
+		db:         db,
+		instanceID: ResolveInstanceID(cfg.Ingestor.InstanceID),
+		cron:       cron.New(), // Standard 5-field cron format (minute, hour, day, month, weekday)
+
+		threatTypeAliases: aliases,
+	}
+	ing.feedsConfig.Store(feedsCfg)
+	return ing, nil
+}
+
+// feeds returns the current feeds configuration
+func (i *Ingestor) feeds() *config.FeedsConfig {
+	return i.feedsConfig.Load()
+}
+
+// SetLogger directs the ingestor's logs to l instead of the package-level
+// logger
+func (i *Ingestor) SetLogger(l *logger.Logger) {
+	i.log = l
+}
+
+// newTransport builds the pooled HTTP transport used for feed fetches
+func newTransport(cfg config.IngestorConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
 	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid ingestor proxy_url %q", cfg.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return transport, nil
+}
+
+// ResolveInstanceID returns the configured instance ID, falling back to the hostname
+func ResolveInstanceID(configured string) string {
+	if id := strings.TrimSpace(configured); id != "" {
+		return id
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
 
-	return &Ingestor{
-		config:      cfg,
-		feedsConfig: feedsCfg,
-		httpClient:  httpClient,
-		db:          db,
-		cron:        cron.New(), // Standard 5-field cron format (minute, hour, day, month, weekday)
-	}, nil
+// InstanceID returns the identifier recorded as ingested_by on stored entries
+func (i *Ingestor) InstanceID() string {
+	return i.instanceID
+}
+
+// ingestedBy returns the instance ID as a nullable column value
+func (i *Ingestor) ingestedBy() *string {
+	if i.instanceID == "" {
+		return nil
+	}
+	id := i.instanceID
+	return &id
 }
 
 // Start starts the ingestor service
@@ -53,29 +177,16 @@ func (i *Ingestor) Start(ctx context.Context) error {
 		return fmt.Errorf("ingestor already running")
 	}
 	i.running = true
+	i.runCtx = ctx
+	i.schedule()
+	i.scheduleCleanup()
 	i.mu.Unlock()
 
-	// Schedule feeds
-	enabledFeeds := i.feedsConfig.GetEnabledFeeds()
-	for name, feed := range enabledFeeds {
-		feedName := name
-		feedConfig := feed
-
-		logger.Info(fmt.Sprintf("Scheduling feed: %s with schedule: %s", feedName, feedConfig.Schedule))
-
-		_, err := i.cron.AddFunc(feedConfig.Schedule, func() {
-			i.processFeed(ctx, feedName, feedConfig)
-		})
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to schedule feed %s: %v", feedName, err))
-		}
-	}
-
 	// Start cron scheduler
 	i.cron.Start()
 
 	// Run initial fetch for all feeds
-	logger.Info("Running initial fetch for all feeds...")
+	i.log.Info("Running initial fetch for all feeds...")
 	i.runAllFeeds(ctx)
 
 	// Wait for context cancellation
@@ -84,6 +195,44 @@ func (i *Ingestor) Start(ctx context.Context) error {
 	return nil
 }
 
+// schedule replaces the cron entries with one per enabled feed of the
+// current feeds configuration; the caller must hold i.mu
+func (i *Ingestor) schedule() {
+	for _, id := range i.scheduled {
+		i.cron.Remove(id)
+	}
+	i.scheduled = make(map[string]cron.EntryID)
+
+	for name, feed := range i.feeds().GetEnabledFeeds() {
+		feedName := name
+		feedConfig := feed
+
+		i.log.Info(fmt.Sprintf("Scheduling feed: %s with schedule: %s", feedName, feedConfig.Schedule))
+
+		id, err := i.cron.AddFunc(feedConfig.Schedule, func() {
+			i.processFeed(i.runCtx, feedName, feedConfig)
+		})
+		if err != nil {
+			i.log.Error(fmt.Sprintf("Failed to schedule feed %s: %v", feedName, err))
+			continue
+		}
+		i.scheduled[feedName] = id
+	}
+}
+
+// Reload swaps in a new feeds configuration and, when the service is
+// running, reschedules every feed. Runs already in progress finish with the
+// configuration they started with.
+func (i *Ingestor) Reload(feedsCfg *config.FeedsConfig) {
+	i.feedsConfig.Store(feedsCfg)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.running {
+		i.schedule()
+	}
+}
+
 // Stop stops the ingestor service
 func (i *Ingestor) Stop() {
 	i.mu.Lock()
@@ -100,7 +249,7 @@ func (i *Ingestor) Stop() {
 
 // RunOnce runs all feeds once and returns statistics (for --once mode)
 func (i *Ingestor) RunOnce(ctx context.Context) (totalFeeds, totalEntries, totalStored int, err error) {
-	enabledFeeds := i.feedsConfig.GetEnabledFeeds()
+	enabledFeeds := i.feeds().GetEnabledFeeds()
 	totalFeeds = len(enabledFeeds)
 
 	// Results tracking with mutex for thread safety
@@ -142,7 +291,7 @@ func (i *Ingestor) RunOnce(ctx context.Context) (totalFeeds, totalEntries, total
 
 // runAllFeeds runs all enabled feeds
 func (i *Ingestor) runAllFeeds(ctx context.Context) {
-	enabledFeeds := i.feedsConfig.GetEnabledFeeds()
+	enabledFeeds := i.feeds().GetEnabledFeeds()
 
 	// Use semaphore for concurrency control
 	sem := make(chan struct{}, i.config.Ingestor.Concurrency)
@@ -165,10 +314,15 @@ func (i *Ingestor) runAllFeeds(ctx context.Context) {
 
 // processFeed processes a single feed
 func (i *Ingestor) processFeed(ctx context.Context, feedName string, feedConfig config.FeedConfig) {
-	logger.Info(fmt.Sprintf("Processing feed: %s", feedName))
+	i.log.Info(fmt.Sprintf("Processing feed: %s", feedName))
 	startTime := time.Now()
 
-	totalEntries := 0
+	totalEntries, totalStored := 0, 0
+	var errs []error
+	var fetched []sourceEntries
+
+	feedCtx, cancel, timeout := i.feedContext(ctx, feedConfig)
+	defer cancel()
 
 	for _, source := range feedConfig.Sources {
 		select {
@@ -176,24 +330,49 @@ func (i *Ingestor) processFeed(ctx context.Context, feedName string, feedConfig
 			return
 		default:
 		}
-
-		entries, err := i.fetchSource(ctx, source, feedConfig)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to fetch source %s/%s: %v", feedName, source.Name, err))
+		if feedCtx.Err() != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name, ErrFeedTimeout))
 			continue
 		}
 
-		// Store entries
-		if err := i.storeEntries(entries); err != nil {
-			logger.Error(fmt.Sprintf("Failed to store entries for %s/%s: %v", feedName, source.Name, err))
+		entries, err := i.fetchSource(feedCtx, source, feedConfig)
+		if err != nil {
+			i.log.Error(fmt.Sprintf("Failed to fetch source %s/%s: %v", feedName, source.Name, err))
+			metrics.FeedFetchErrors.WithLabelValues(feedName).Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name, err))
 			continue
 		}
 
+		fetched = append(fetched, sourceEntries{source: source.Name, entries: entries})
 		totalEntries += len(entries)
-		logger.Info(fmt.Sprintf("Fetched %d entries from %s/%s", len(entries), feedName, source.Name))
+		i.log.Info(fmt.Sprintf("Fetched %d entries from %s/%s", len(entries), feedName, source.Name))
+	}
+
+	// Nothing is stored unless the sources together yielded enough. When
+	// every source failed there is nothing left to reject.
+	if err := i.checkMinEntries(ctx, feedName, feedConfig, totalEntries); err != nil && len(fetched) > 0 {
+		i.log.Error(fmt.Sprintf("Rejected feed %s: %v", feedName, err))
+		metrics.FeedFetchErrors.WithLabelValues(feedName).Inc()
+		errs = append(errs, rejectSources(fetched, err)...)
+		fetched = nil
+	}
+
+	for _, f := range fetched {
+		stored, err := i.storeEntries(f.entries)
+		totalStored += stored
+		if err != nil {
+			i.log.Error(fmt.Sprintf("Failed to store entries for %s/%s: %v", feedName, f.source, err))
+			errs = append(errs, fmt.Errorf("%s: store: %w", f.source, err))
+		}
+	}
+
+	if feedTimedOut(ctx, feedCtx) {
+		i.log.Warn(fmt.Sprintf("Feed %s timed out after %v; moving on", feedName, timeout))
 	}
 
-	logger.Info(fmt.Sprintf("Completed feed %s: %d total entries in %v", feedName, totalEntries, time.Since(startTime)))
+	i.recordFeedRun(feedName, feedConfig, totalEntries, totalStored, errs, time.Since(startTime))
+
+	i.log.Info(fmt.Sprintf("Completed feed %s: %d total entries in %v", feedName, totalEntries, time.Since(startTime)))
 }
 
 // processFeedWithStats processes a single feed and returns statistics
@@ -201,6 +380,15 @@ func (i *Ingestor) processFeedWithStats(ctx context.Context, feedName string, fe
 	// Print progress to stdout for --once mode
 	fmt.Printf("\033[0;34m[*]\033[0m Processing feed: %s\n", feedName)
 	startTime := time.Now()
+	var errs []error
+	var fetched []sourceEntries
+
+	defer func() {
+		i.recordFeedRun(feedName, feedConfig, totalEntries, totalStored, errs, time.Since(startTime))
+	}()
+
+	feedCtx, cancel, timeout := i.feedContext(ctx, feedConfig)
+	defer cancel()
 
 	for _, source := range feedConfig.Sources {
 		select {
@@ -208,34 +396,230 @@ func (i *Ingestor) processFeedWithStats(ctx context.Context, feedName string, fe
 			return totalEntries, totalStored, ctx.Err()
 		default:
 		}
+		if feedCtx.Err() != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name, ErrFeedTimeout))
+			continue
+		}
 
-		entries, fetchErr := i.fetchSource(ctx, source, feedConfig)
+		entries, fetchErr := i.fetchSource(feedCtx, source, feedConfig)
 		if fetchErr != nil {
 			fmt.Printf("\033[0;31m[✗]\033[0m   Source %s: %v\n", source.Name, fetchErr)
+			metrics.FeedFetchErrors.WithLabelValues(feedName).Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name, fetchErr))
 			continue
 		}
 
+		fetched = append(fetched, sourceEntries{source: source.Name, entries: entries})
 		totalEntries += len(entries)
+	}
+
+	// Nothing is stored unless the sources together yielded enough. When
+	// every source failed there is nothing left to reject.
+	if minErr := i.checkMinEntries(ctx, feedName, feedConfig, totalEntries); minErr != nil && len(fetched) > 0 {
+		fmt.Printf("\033[0;31m[✗]\033[0m   Feed %s: %v\n", feedName, minErr)
+		metrics.FeedFetchErrors.WithLabelValues(feedName).Inc()
+		errs = append(errs, rejectSources(fetched, minErr)...)
+		fetched = nil
+	}
 
+	for _, f := range fetched {
 		// Store entries and get count
-		stored, storeErr := i.storeEntriesWithCount(entries)
+		stored, storeErr := i.storeEntriesWithCount(f.entries)
 		if storeErr != nil {
-			fmt.Printf("\033[0;31m[✗]\033[0m   Source %s: store error: %v\n", source.Name, storeErr)
+			fmt.Printf("\033[0;31m[✗]\033[0m   Source %s: store error: %v\n", f.source, storeErr)
+			errs = append(errs, fmt.Errorf("%s: store: %w", f.source, storeErr))
 			continue
 		}
 
 		totalStored += stored
-		fmt.Printf("\033[0;32m[✓]\033[0m   %s/%s: fetched %d, stored %d\n", feedName, source.Name, len(entries), stored)
+		fmt.Printf("\033[0;32m[✓]\033[0m   %s/%s: fetched %d, stored %d\n", feedName, f.source, len(f.entries), stored)
 	}
 
 	elapsed := time.Since(startTime)
+	if feedTimedOut(ctx, feedCtx) {
+		fmt.Printf("\033[0;31m[✗]\033[0m Feed %s timed out after %v\n", feedName, timeout)
+		return totalEntries, totalStored, fmt.Errorf("%s: %w after %v", feedName, ErrFeedTimeout, timeout)
+	}
 	fmt.Printf("\033[0;32m[✓]\033[0m Completed %s: %d entries in %v\n", feedName, totalEntries, elapsed.Round(time.Millisecond))
 
 	return totalEntries, totalStored, nil
 }
 
-// fetchSource fetches and parses a single source
+// sourceEntries holds the entries fetched from one source of a feed until
+// the feed's total has been checked
+type sourceEntries struct {
+	source  string
+	entries []models.FeedEntry
+}
+
+// rejectSources fails every fetched source with err, so a rejected feed run
+// is recorded as an error
+func rejectSources(fetched []sourceEntries, err error) []error {
+	errs := make([]error, 0, len(fetched))
+	for _, f := range fetched {
+		errs = append(errs, fmt.Errorf("%s: %w", f.source, err))
+	}
+	return errs
+}
+
+// feedContext bounds a feed run by the feed's timeout, or ingestor.feed_timeout
+// when it has none, so one stuck feed cannot hold a concurrency slot forever.
+// It also returns the timeout (0 = no deadline).
+func (i *Ingestor) feedContext(ctx context.Context, feedConfig config.FeedConfig) (context.Context, context.CancelFunc, time.Duration) {
+	timeout := i.config.Ingestor.FeedTimeout
+	if feedConfig.Timeout > 0 {
+		timeout = feedConfig.Timeout
+	}
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, timeout
+}
+
+// feedTimedOut reports whether a feed run hit its own deadline rather than
+// being cancelled by shutdown
+func feedTimedOut(ctx, feedCtx context.Context) bool {
+	return ctx.Err() == nil && errors.Is(feedCtx.Err(), context.DeadlineExceeded)
+}
+
+// checkMinEntries rejects a feed run whose sources together yielded fewer than
+// min_entries entries when the feed's last successful run reached that many.
+// Feeds that have always been small, or have no history yet, are not held to
+// the threshold.
+func (i *Ingestor) checkMinEntries(ctx context.Context, feedName string, feedConfig config.FeedConfig, entries int) error {
+	if feedConfig.MinEntries <= 0 || entries >= feedConfig.MinEntries {
+		return nil
+	}
+
+	previous, ok := i.previousEntries(ctx, feedName)
+	if !ok || previous < feedConfig.MinEntries {
+		return nil
+	}
+	return fmt.Errorf("%w: got %d, want at least %d (previous run had %d); keeping existing data",
+		ErrTooFewEntries, entries, feedConfig.MinEntries, previous)
+}
+
+// previousEntries returns the entry count of the feed's last successful run.
+// Counts are loaded from feed_fetch_history once, then kept up to date in memory.
+func (i *Ingestor) previousEntries(ctx context.Context, feedName string) (int, bool) {
+	i.lastEntriesMu.Lock()
+	defer i.lastEntriesMu.Unlock()
+
+	if !i.lastEntriesLoaded && i.db != nil {
+		if statuses, err := i.db.GetFeedStatuses(ctx); err != nil {
+			i.log.Warn(fmt.Sprintf("Failed to load feed history for min_entries: %v", err))
+		} else {
+			if i.lastEntries == nil {
+				i.lastEntries = make(map[string]int)
+			}
+			for name, status := range statuses {
+				// Runs recorded since startup are newer than the stored history
+				if _, seen := i.lastEntries[name]; !seen && status.LastSuccess != nil {
+					i.lastEntries[name] = status.LastEntries
+				}
+			}
+			i.lastEntriesLoaded = true
+		}
+	}
+
+	n, ok := i.lastEntries[feedName]
+	return n, ok
+}
+
+// recordFeedRun records the outcome of a feed run so its status can be reported
+func (i *Ingestor) recordFeedRun(feedName string, feedConfig config.FeedConfig, entries, stored int, errs []error, duration time.Duration) {
+	run := feedRun(feedName, feedConfig, entries, stored, errs, duration)
+	metrics.RecordFeedRun(feedName, run.Status, stored)
+
+	if run.Status == database.FeedRunSuccess {
+		metrics.RecordFeedSuccess(feedName, entries, time.Now())
+
+		i.lastEntriesMu.Lock()
+		if i.lastEntries == nil {
+			i.lastEntries = make(map[string]int)
+		}
+		i.lastEntries[feedName] = entries
+		i.lastEntriesMu.Unlock()
+	}
+
+	if i.db == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := i.db.RecordFeedRun(ctx, run); err != nil {
+		i.log.Error(fmt.Sprintf("Failed to record run for feed %s: %v", feedName, err))
+	}
+}
+
+// feedRun builds the history record of a feed run. The run failed when every
+// source did, and is skipped when the feed has no sources.
+func feedRun(feedName string, feedConfig config.FeedConfig, entries, stored int, errs []error, duration time.Duration) database.FeedRun {
+	run := database.FeedRun{
+		FeedName:     feedName,
+		Status:       database.FeedRunSuccess,
+		EntriesCount: entries,
+		StoredCount:  stored,
+		Duration:     duration,
+	}
+
+	if len(feedConfig.Sources) == 1 {
+		run.SourceURL = feedConfig.Sources[0].URL
+	}
+	if len(feedConfig.Sources) == 0 {
+		run.Status = database.FeedRunSkipped
+		run.ErrorMessage = "feed has no sources"
+		return run
+	}
+
+	if len(errs) > 0 {
+		run.Status = database.FeedRunPartial
+		if len(errs) >= len(feedConfig.Sources) {
+			run.Status = database.FeedRunError
+		}
+
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		run.ErrorMessage = strings.Join(msgs, "; ")
+	}
+
+	return run
+}
+
+// fetchSource fetches and parses a single source. The URL scheme picks where
+// it is read from: file:// from local disk, s3:// from the object store in
+// ingestor.s3, anything else over HTTP.
 func (i *Ingestor) fetchSource(ctx context.Context, source config.SourceConfig, feedConfig config.FeedConfig) ([]models.FeedEntry, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL: %w", err)
+	}
+
+	var body []byte
+	switch u.Scheme {
+	case "file":
+		body, err = i.readFileSource(u)
+	case "s3":
+		body, err = i.fetchS3(ctx, u)
+	default:
+		body, err = i.fetchHTTP(ctx, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse based on format
+	return i.parseContent(string(body), source.Format, feedConfig)
+}
+
+// fetchHTTP downloads an HTTP(S) source
+func (i *Ingestor) fetchHTTP(ctx context.Context, source config.SourceConfig) ([]byte, error) {
 	// Create request with context
 	req, err := http.NewRequestWithContext(ctx, "GET", source.URL, nil)
 	if err != nil {
@@ -243,54 +627,196 @@ func (i *Ingestor) fetchSource(ctx context.Context, source config.SourceConfig,
 	}
 
 	req.Header.Set("User-Agent", i.config.Ingestor.UserAgent)
+	for name, value := range source.Headers {
+		req.Header.Set(name, value)
+	}
+	if source.UserAgent != "" {
+		req.Header.Set("User-Agent", source.UserAgent)
+	}
 
-	// Retry logic
-	var resp *http.Response
-	for attempt := 0; attempt <= i.config.Ingestor.MaxRetries; attempt++ {
-		resp, err = i.httpClient.Do(req)
-		if err == nil && resp.StatusCode == http.StatusOK {
-			break
-		}
+	resp, err := i.doWithRetry(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		if resp != nil {
-			resp.Body.Close()
-		}
+	// Read body, refusing anything larger than the configured limit
+	return readLimited(resp.Body, i.maxFeedSize())
+}
 
-		if attempt < i.config.Ingestor.MaxRetries {
-			time.Sleep(i.config.Ingestor.RetryDelay)
-		}
+// readFileSource reads a file:// source, e.g. a feed mirrored to local disk
+// for air-gapped deployments. file:///var/feeds/x.txt is absolute; a host
+// part other than localhost is read as the start of a relative path.
+func (i *Ingestor) readFileSource(u *url.URL) ([]byte, error) {
+	path := u.Path
+	if u.Host != "" && u.Host != "localhost" {
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("file URL %q has no path", u)
 	}
 
+	f, err := os.Open(filepath.FromSlash(path))
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch after %d retries: %w", i.config.Ingestor.MaxRetries, err)
+		return nil, fmt.Errorf("failed to open feed file: %w", err)
 	}
-	defer resp.Body.Close()
+	defer f.Close()
+
+	return readLimited(f, i.maxFeedSize())
+}
+
+// doWithRetry performs the request, retrying connection errors, 429 and 5xx responses
+// with exponential backoff. A Retry-After header on 429/5xx overrides the backoff.
+func (i *Ingestor) doWithRetry(ctx context.Context, req *http.Request) (*http.Response, error) {
+	maxRetries := i.config.Ingestor.MaxRetries
+
+	for attempt := 0; ; attempt++ {
+		resp, err := i.httpClient.Do(req)
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if attempt >= maxRetries {
+				return nil, fmt.Errorf("failed to fetch after %d retries: %w", maxRetries, err)
+			}
+			wait = backoffDelay(i.config.Ingestor.RetryDelay, attempt)
+
+		case resp.StatusCode == http.StatusOK:
+			return resp, nil
+
+		case isRetryableStatus(resp.StatusCode):
+			resp.Body.Close()
+			if attempt >= maxRetries {
+				return nil, fmt.Errorf("unexpected status code: %d after %d retries", resp.StatusCode, maxRetries)
+			}
+			if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				wait = d
+			} else {
+				wait = backoffDelay(i.config.Ingestor.RetryDelay, attempt)
+			}
+
+		default:
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+
+		i.log.Debug(fmt.Sprintf("Retrying %s in %v (attempt %d/%d)", req.URL, wait, attempt+1, maxRetries))
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// maxFeedSize returns the configured response size limit, or the default when unset
+func (i *Ingestor) maxFeedSize() int64 {
+	if i.config.Ingestor.MaxFeedSize > 0 {
+		return i.config.Ingestor.MaxFeedSize
 	}
+	return defaultMaxFeedSize
+}
 
-	// Read body
-	body, err := io.ReadAll(resp.Body)
+// readLimited reads at most limit bytes from r and fails if more are available
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
-
-	// Parse based on format
-	return i.parseContent(string(body), source.Format, feedConfig)
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrFeedTooLarge, limit)
+	}
+	return body, nil
 }
 
 // parseContent parses the content based on format
 func (i *Ingestor) parseContent(content, format string, feedConfig config.FeedConfig) ([]models.FeedEntry, error) {
 	var entries []models.FeedEntry
-
-	lines := strings.Split(content, "\n")
 	now := time.Now()
 
 	// Get format configuration
-	formatConfig, _ := i.feedsConfig.GetFormat(format)
+	formatConfig, _ := i.feeds().GetFormat(format)
+
+	parser := format
+	if formatConfig.Parser != "" {
+		parser = formatConfig.Parser
+	}
+
+	// FireHOL lists describe themselves; their category stands in for a
+	// threat_type the feed does not set
+	var provenance string
+	if parser == "firehol" {
+		header := parseFireHOLHeader(content)
+		if feedConfig.ThreatType == "" {
+			feedConfig.ThreatType = header.threatType()
+		}
+		provenance = header.description()
+	}
+	threatType := i.normalizeThreatType(feedConfig)
+	minV4, minV6 := i.minPrefixLengths(feedConfig)
+
+	add := func(ipStr string, fetchedAt, firstSeen time.Time, tags []string, description string) {
+		// Try to parse as IP or prefix
+		addr, prefix, isPrefix, err := iputil.ParseIPOrPrefix(ipStr)
+		if err != nil {
+			return
+		}
+
+		// An over-broad entry would flag a large part of the internet once compiled
+		if isPrefix {
+			minBits := minV4
+			if !prefix.Addr().Is4() {
+				minBits = minV6
+			}
+			if prefix.Bits() < minBits {
+				i.log.Warn(fmt.Sprintf("Feed %s: rejected %s, broader than /%d", feedConfig.Name, prefix, minBits))
+				return
+			}
+		}
+
+		entry := models.FeedEntry{
+			Source:      feedConfig.Name,
+			ThreatType:  threatType,
+			Confidence:  feedConfig.Confidence,
+			Weight:      feedConfig.Weight,
+			FetchedAt:   fetchedAt,
+			FirstSeen:   firstSeen,
+			Tags:        tags,
+			Description: description,
+		}
+
+		// The Tor exit list is authoritative for Tor, whatever the feed says
+		if format == "tor_exit" {
+			entry.ThreatType = "tor"
+			entry.Confidence = math.Max(entry.Confidence, torExitConfidence)
+		}
+
+		if isPrefix {
+			entry.Prefix = prefix
+			entry.IPString = prefix.String()
+		} else {
+			entry.IP = addr
+			entry.IPString = addr.String()
+		}
+
+		entries = append(entries, entry)
+	}
 
-	for _, line := range lines {
+	// JSON documents are not line oriented
+	if parser == "json" {
+		records, err := parseJSONRecords(content, formatConfig)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			add(rec.ip, now, rec.firstSeen, rec.tags, rec.description)
+		}
+		return entries, nil
+	}
+
+	badRanges := 0
+	for _, line := range strings.Split(content, "\n") {
 		line = strings.TrimSpace(line)
 
 		// Skip empty lines
@@ -308,9 +834,12 @@ func (i *Ingestor) parseContent(content, format string, feedConfig config.FeedCo
 			continue
 		}
 
-		var ipStr string
+		var ipStr, description string
+		var tags []string
+		var firstSeen time.Time
+		fetchedAt := now
 
-		switch format {
+		switch parser {
 		case "ip_port":
 			// Format: IP:PORT
 			addr, _, err := iputil.ParseIPPort(line)
@@ -324,48 +853,157 @@ func (i *Ingestor) parseContent(content, format string, feedConfig config.FeedCo
 			parts := strings.SplitN(line, ";", 2)
 			ipStr = strings.TrimSpace(parts[0])
 
+		case "tor_exit":
+			// Format: Tor exit list records; only "ExitAddress <ip> <date> <time>" lines matter
+			ip, seen, ok := parseExitAddress(line)
+			if !ok {
+				continue
+			}
+			ipStr = ip
+			fetchedAt = seen
+
+		case "ip_range":
+			// Format: startIP-endIP, stored as the CIDR prefixes covering it;
+			// lines without a dash are plain IPs or CIDRs
+			if !strings.Contains(line, "-") {
+				ipStr = line
+				break
+			}
+			prefixes, err := parseRangeLine(line)
+			if err != nil {
+				badRanges++
+				continue
+			}
+			for _, prefix := range prefixes {
+				add(prefix.String(), fetchedAt, time.Time{}, nil, "")
+			}
+			continue
+
+		case "csv":
+			// Format: delimited records; fields are picked by column number
+			rec, ok := parseCSVRecord(line, formatConfig)
+			if !ok {
+				continue
+			}
+			ipStr, tags, description, firstSeen = rec.ip, rec.tags, rec.description, rec.firstSeen
+
+		case "firehol":
+			// Format: FireHOL netset/ipset, one IP or CIDR per line
+			ipStr, description = line, provenance
+
 		default:
 			// Plain format - just the IP or CIDR
 			ipStr = line
 		}
 
-		// Try to parse as IP or prefix
-		addr, prefix, isPrefix, err := iputil.ParseIPOrPrefix(ipStr)
-		if err != nil {
-			continue
-		}
+		add(ipStr, fetchedAt, firstSeen, tags, description)
+	}
 
-		entry := models.FeedEntry{
-			Source:     feedConfig.Name,
-			ThreatType: feedConfig.ThreatType,
-			Confidence: feedConfig.Confidence,
-			Weight:     feedConfig.Weight,
-			FetchedAt:  now,
+	if badRanges > 0 {
+		i.log.Warn(fmt.Sprintf("Feed %s: skipped %d invalid IP ranges", feedConfig.Name, badRanges))
+	}
+
+	return entries, nil
+}
+
+// minPrefixLengths returns the shortest IPv4 and IPv6 prefixes a feed's
+// entries may have, the feed's own limits taking precedence
+func (i *Ingestor) minPrefixLengths(feedConfig config.FeedConfig) (int, int) {
+	v4, v6 := i.config.Ingestor.MinPrefixLengthV4, i.config.Ingestor.MinPrefixLengthV6
+	if feedConfig.MinPrefixLengthV4 > 0 {
+		v4 = feedConfig.MinPrefixLengthV4
+	}
+	if feedConfig.MinPrefixLengthV6 > 0 {
+		v6 = feedConfig.MinPrefixLengthV6
+	}
+	return v4, v6
+}
+
+// parseRangeLine parses a startIP-endIP line into the CIDR prefixes covering it
+func parseRangeLine(line string) ([]netip.Prefix, error) {
+	start, end, err := iputil.ParseIPRange(line)
+	if err != nil {
+		return nil, err
+	}
+	return iputil.RangeToPrefixes(start, end)
+}
+
+// normalizeThreatType maps the feed's threat type to the canonical taxonomy,
+// warning once per type that has no alias so operators can extend
+// scoring.threat_type_aliases
+func (i *Ingestor) normalizeThreatType(feedConfig config.FeedConfig) string {
+	threatType, ok := scoring.NormalizeThreatType(i.threatTypeAliases, feedConfig.ThreatType)
+	if !ok {
+		if _, warned := i.unmappedTypes.LoadOrStore(threatType, true); !warned {
+			i.log.Warn(fmt.Sprintf("Feed %s has unmapped threat type %q; it scores with the default weight and sets no flags (add it to scoring.threat_type_aliases)", feedConfig.Name, threatType))
 		}
+	}
+	return threatType
+}
 
-		if isPrefix {
-			entry.Prefix = prefix
-			entry.IPString = prefix.String()
-		} else {
-			entry.IP = addr
-			entry.IPString = addr.String()
+// parseExitAddress parses a Tor exit list "ExitAddress <ip> <YYYY-MM-DD> <HH:MM:SS>"
+// line, returning the IP and the time it was last seen exiting (UTC)
+func parseExitAddress(line string) (string, time.Time, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "ExitAddress" {
+		return "", time.Time{}, false
+	}
+
+	seen := time.Now()
+	if len(fields) >= 4 {
+		if t, err := time.Parse(torExitTimeLayout, fields[2]+" "+fields[3]); err == nil {
+			seen = t
 		}
+	}
 
-		entries = append(entries, entry)
+	return fields[1], seen, true
+}
+
+// seenAt returns when the feed saw the entry, falling back to now
+func seenAt(entry models.FeedEntry, now time.Time) time.Time {
+	if entry.FetchedAt.IsZero() {
+		return now
 	}
+	return entry.FetchedAt
+}
 
-	return entries, nil
+// firstSeenAt returns when the feed says it first observed the entry, falling
+// back to seenAt; a first observation after the sighting itself is ignored
+func firstSeenAt(entry models.FeedEntry, now time.Time) time.Time {
+	seen := seenAt(entry, now)
+	if entry.FirstSeen.IsZero() || entry.FirstSeen.After(seen) {
+		return seen
+	}
+	return entry.FirstSeen
 }
 
-// storeEntries stores parsed entries to the database
-func (i *Ingestor) storeEntries(entries []models.FeedEntry) error {
-	if len(entries) == 0 {
+// entryMetadata returns the metadata column value for an entry, nil when the
+// feed carried no tags or description
+func entryMetadata(entry models.FeedEntry) map[string]interface{} {
+	if len(entry.Tags) == 0 && entry.Description == "" {
 		return nil
 	}
+	metadata := make(map[string]interface{}, 2)
+	if len(entry.Tags) > 0 {
+		metadata["tags"] = entry.Tags
+	}
+	if entry.Description != "" {
+		metadata["description"] = entry.Description
+	}
+	return metadata
+}
+
+// storeEntries stores parsed entries to the database and returns the count
+// stored. A failed batch stops the store.
+func (i *Ingestor) storeEntries(entries []models.FeedEntry) (int, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
 
 	// Convert FeedEntry to database entries
 	dbEntries := make([]database.IPReputationEntry, 0, len(entries))
 	now := time.Now()
+	ingestedBy := i.ingestedBy()
 
 	for _, entry := range entries {
 		var ipStart, ipEnd string
@@ -391,20 +1029,23 @@ func (i *Ingestor) storeEntries(entries []models.FeedEntry) error {
 			ThreatType: entry.ThreatType,
 			Confidence: entry.Confidence,
 			Weight:     entry.Weight,
-			FirstSeen:  now,
-			LastSeen:   now,
+			FirstSeen:  firstSeenAt(entry, now),
+			LastSeen:   seenAt(entry, now),
+			IngestedBy: ingestedBy,
+			Metadata:   entryMetadata(entry),
 		}
 
 		dbEntries = append(dbEntries, dbEntry)
 	}
 
 	if len(dbEntries) == 0 {
-		return nil
+		return 0, nil
 	}
 
 	// Store in batches to avoid memory issues
 	batchSize := 5000
 	totalInserted := 0
+	insert := i.insertFunc(len(dbEntries))
 
 	for start := 0; start < len(dbEntries); start += batchSize {
 		end := start + batchSize
@@ -414,11 +1055,10 @@ func (i *Ingestor) storeEntries(entries []models.FeedEntry) error {
 
 		batch := dbEntries[start:end]
 
-		if i.db != nil {
-			inserted, err := i.db.InsertReputationBatch(context.Background(), batch)
+		if insert != nil {
+			inserted, err := insert(context.Background(), batch)
 			if err != nil {
-				logger.Error(fmt.Sprintf("Failed to insert batch: %v", err))
-				continue
+				return totalInserted, fmt.Errorf("batch insert failed: %w", err)
 			}
 			totalInserted += inserted
 		} else {
@@ -427,8 +1067,21 @@ func (i *Ingestor) storeEntries(entries []models.FeedEntry) error {
 		}
 	}
 
-	logger.Info(fmt.Sprintf("Stored %d entries to database", totalInserted))
-	return nil
+	i.log.Info(fmt.Sprintf("Stored %d entries to database", totalInserted))
+	return totalInserted, nil
+}
+
+// insertFunc returns the insert path for a store of n entries, chosen once
+// per store so every batch of a large feed goes through COPY. It returns nil
+// when there is no database connection.
+func (i *Ingestor) insertFunc(n int) func(context.Context, []database.IPReputationEntry) (int, error) {
+	if i.db == nil {
+		return nil
+	}
+	if i.db.UseBulkInsert(n) {
+		return i.db.InsertReputationBulk
+	}
+	return i.db.InsertReputationBatch
 }
 
 // storeEntriesWithCount stores parsed entries and returns count stored
@@ -440,6 +1093,7 @@ func (i *Ingestor) storeEntriesWithCount(entries []models.FeedEntry) (int, error
 	// Convert FeedEntry to database entries
 	dbEntries := make([]database.IPReputationEntry, 0, len(entries))
 	now := time.Now()
+	ingestedBy := i.ingestedBy()
 
 	for _, entry := range entries {
 		var ipStart, ipEnd string
@@ -465,8 +1119,10 @@ func (i *Ingestor) storeEntriesWithCount(entries []models.FeedEntry) (int, error
 			ThreatType: entry.ThreatType,
 			Confidence: entry.Confidence,
 			Weight:     entry.Weight,
-			FirstSeen:  now,
-			LastSeen:   now,
+			FirstSeen:  firstSeenAt(entry, now),
+			LastSeen:   seenAt(entry, now),
+			IngestedBy: ingestedBy,
+			Metadata:   entryMetadata(entry),
 		}
 
 		dbEntries = append(dbEntries, dbEntry)
@@ -479,6 +1135,7 @@ func (i *Ingestor) storeEntriesWithCount(entries []models.FeedEntry) (int, error
 	// Store in batches
 	batchSize := 5000
 	totalInserted := 0
+	insert := i.insertFunc(len(dbEntries))
 
 	for start := 0; start < len(dbEntries); start += batchSize {
 		end := start + batchSize
@@ -488,8 +1145,8 @@ func (i *Ingestor) storeEntriesWithCount(entries []models.FeedEntry) (int, error
 
 		batch := dbEntries[start:end]
 
-		if i.db != nil {
-			inserted, err := i.db.InsertReputationBatch(context.Background(), batch)
+		if insert != nil {
+			inserted, err := insert(context.Background(), batch)
 			if err != nil {
 				return totalInserted, fmt.Errorf("batch insert failed: %w", err)
 			}
@@ -504,7 +1161,7 @@ func (i *Ingestor) storeEntriesWithCount(entries []models.FeedEntry) (int, error
 
 // FetchFeed manually fetches a single feed
 func (i *Ingestor) FetchFeed(ctx context.Context, feedName string) error {
-	feed, ok := i.feedsConfig.GetFeedByName(feedName)
+	feed, ok := i.feeds().GetFeedByName(feedName)
 	if !ok {
 		return fmt.Errorf("feed not found: %s", feedName)
 	}
@@ -0,0 +1,430 @@
+package ingestor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestResolveInstanceID(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name       string
+		configured string
+		expected   string
+	}{
+		{"configured", "ingestor-01", "ingestor-01"},
+		{"trimmed", "  ingestor-02 ", "ingestor-02"},
+		{"empty falls back to hostname", "", hostname},
+		{"blank falls back to hostname", "   ", hostname},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveInstanceID(tt.configured); got != tt.expected {
+				t.Errorf("ResolveInstanceID(%q) = %q, want %q", tt.configured, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIngestedBy(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Ingestor.InstanceID = "ingestor-01"
+
+	ing, err := New(cfg, &config.FeedsConfig{}, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got := ing.ingestedBy()
+	if got == nil || *got != "ingestor-01" {
+		t.Errorf("ingestedBy() = %v, want ingestor-01", got)
+	}
+
+	ing.instanceID = ""
+	if got := ing.ingestedBy(); got != nil {
+		t.Errorf("ingestedBy() = %q, want nil", *got)
+	}
+}
+
+func TestParseContentTorExit(t *testing.T) {
+	content, err := os.ReadFile("testdata/tor_exit_addresses.txt")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	ing := newTestIngestor(t, 0, 0)
+	feed := config.FeedConfig{Name: "tor_exit_nodes", ThreatType: "anonymizer", Confidence: 0.5, Weight: 70}
+
+	entries, err := ing.parseContent(string(content), "tor_exit", feed)
+	if err != nil {
+		t.Fatalf("parseContent() error = %v", err)
+	}
+
+	want := []struct {
+		ip   string
+		seen time.Time
+	}{
+		{"162.247.74.201", time.Date(2026, 10, 17, 0, 12, 43, 0, time.UTC)},
+		{"185.220.101.34", time.Date(2026, 10, 16, 23, 5, 11, 0, time.UTC)},
+		{"2a0b:f4c2::34", time.Date(2026, 10, 16, 23, 5, 11, 0, time.UTC)},
+	}
+
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+
+	for i, w := range want {
+		e := entries[i]
+		if e.IPString != w.ip {
+			t.Errorf("entry %d IP = %s, want %s", i, e.IPString, w.ip)
+		}
+		if !e.FetchedAt.Equal(w.seen) {
+			t.Errorf("entry %d FetchedAt = %v, want %v", i, e.FetchedAt, w.seen)
+		}
+		if e.ThreatType != "tor" {
+			t.Errorf("entry %d ThreatType = %q, want tor", i, e.ThreatType)
+		}
+		if e.Confidence != torExitConfidence {
+			t.Errorf("entry %d Confidence = %v, want %v", i, e.Confidence, torExitConfidence)
+		}
+	}
+}
+
+func TestSeenAt(t *testing.T) {
+	now := time.Now()
+	fetched := now.Add(-time.Hour)
+
+	if got := seenAt(models.FeedEntry{FetchedAt: fetched}, now); !got.Equal(fetched) {
+		t.Errorf("seenAt(fetched) = %v, want %v", got, fetched)
+	}
+	if got := seenAt(models.FeedEntry{}, now); !got.Equal(now) {
+		t.Errorf("seenAt(zero) = %v, want now", got)
+	}
+}
+
+func TestFirstSeenAt(t *testing.T) {
+	now := time.Now()
+	first := now.Add(-30 * 24 * time.Hour)
+
+	if got := firstSeenAt(models.FeedEntry{FirstSeen: first}, now); !got.Equal(first) {
+		t.Errorf("firstSeenAt(first) = %v, want %v", got, first)
+	}
+	if got := firstSeenAt(models.FeedEntry{}, now); !got.Equal(now) {
+		t.Errorf("firstSeenAt(zero) = %v, want now", got)
+	}
+	// A first observation after the sighting is not trusted
+	fetched := now.Add(-time.Hour)
+	if got := firstSeenAt(models.FeedEntry{FetchedAt: fetched, FirstSeen: now}, now); !got.Equal(fetched) {
+		t.Errorf("firstSeenAt(future first) = %v, want %v", got, fetched)
+	}
+}
+
+func TestParseContentNormalizesThreatType(t *testing.T) {
+	ing := newTestIngestor(t, 0, 0)
+
+	tests := []struct {
+		threatType string
+		want       string
+	}{
+		{"botnet_c2", "botnet_c2"},
+		{"command-and-control", "botnet_c2"},
+		{"bruteforce", "attack"},
+		{"Attack", "attack"},
+		{"unheard_of", "unheard_of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.threatType, func(t *testing.T) {
+			feed := config.FeedConfig{Name: "test", ThreatType: tt.threatType, Confidence: 0.8, Weight: 50}
+			entries, err := ing.parseContent("203.0.113.7\n", "plain", feed)
+			if err != nil {
+				t.Fatalf("parseContent() error = %v", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			if entries[0].ThreatType != tt.want {
+				t.Errorf("ThreatType = %q, want %q", entries[0].ThreatType, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContentIPRange(t *testing.T) {
+	ing := newTestIngestor(t, 0, 0)
+	feed := config.FeedConfig{Name: "ranges", ThreatType: "attack", Confidence: 0.8, Weight: 75}
+
+	content := strings.Join([]string{
+		"# start-end ranges",
+		"10.0.0.0-10.0.0.255",     // aligned: one /24
+		"1.2.3.4 - 1.2.3.20",      // unaligned: four prefixes
+		"1.2.3.20-1.2.3.4",        // inverted: skipped
+		"1.2.3.4-2001:db8::1",     // mixed families: skipped
+		"2001:db8::1-2001:db8::3", // IPv6
+		"198.51.100.7",            // plain IP
+		"203.0.113.0/28",          // plain CIDR
+	}, "\n")
+
+	entries, err := ing.parseContent(content, "ip_range", feed)
+	if err != nil {
+		t.Fatalf("parseContent() error = %v", err)
+	}
+
+	want := []string{
+		"10.0.0.0/24",
+		"1.2.3.4/30", "1.2.3.8/29", "1.2.3.16/30", "1.2.3.20/32",
+		"2001:db8::1/128", "2001:db8::2/127",
+		"198.51.100.7",
+		"203.0.113.0/28",
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		if entries[i].IPString != w {
+			t.Errorf("entry %d = %s, want %s", i, entries[i].IPString, w)
+		}
+	}
+}
+
+func TestReloadReschedulesFeeds(t *testing.T) {
+	ing, err := New(&config.Config{}, &config.FeedsConfig{
+		Feeds: map[string]config.FeedConfig{
+			"hourly":   {Enabled: true, Schedule: "@hourly"},
+			"disabled": {Enabled: false, Schedule: "@daily"},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ing.running = true
+	ing.runCtx = context.Background()
+	ing.schedule()
+	if len(ing.scheduled) != 1 || len(ing.cron.Entries()) != 1 {
+		t.Fatalf("scheduled %v with %d cron entries, want only hourly", ing.scheduled, len(ing.cron.Entries()))
+	}
+
+	reloaded := &config.FeedsConfig{
+		Feeds: map[string]config.FeedConfig{
+			"hourly":   {Enabled: false, Schedule: "@hourly"},
+			"disabled": {Enabled: true, Schedule: "*/30 * * * *"},
+			"added":    {Enabled: true, Schedule: "@daily"},
+		},
+	}
+	ing.Reload(reloaded)
+
+	if ing.feeds() != reloaded {
+		t.Error("feeds() does not return the reloaded config")
+	}
+	if _, ok := ing.scheduled["hourly"]; ok {
+		t.Error("disabled feed hourly is still scheduled")
+	}
+	if len(ing.scheduled) != 2 || len(ing.cron.Entries()) != 2 {
+		t.Errorf("scheduled %v with %d cron entries, want disabled and added", ing.scheduled, len(ing.cron.Entries()))
+	}
+}
+
+func TestParseContentFireHOL(t *testing.T) {
+	content, err := os.ReadFile("testdata/firehol_level1.netset")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	ing := newTestIngestor(t, 0, 0)
+
+	entries, err := ing.parseContent(string(content), "firehol", config.FeedConfig{Name: "firehol_level1", Confidence: 0.95, Weight: 85})
+	if err != nil {
+		t.Fatalf("parseContent() error = %v", err)
+	}
+
+	want := []string{"1.10.16.0/20", "5.134.128.0/19", "45.155.205.233", "185.220.101.0/24"}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, ip := range want {
+		e := entries[i]
+		if e.IPString != ip {
+			t.Errorf("entry %d IP = %s, want %s", i, e.IPString, ip)
+		}
+		if e.ThreatType != "attack" {
+			t.Errorf("entry %d ThreatType = %q, want attack from the Category header", i, e.ThreatType)
+		}
+		if e.Description != "maintainer: FireHOL, category: attacks" {
+			t.Errorf("entry %d Description = %q, want the header provenance", i, e.Description)
+		}
+	}
+
+	// A configured threat type wins over the header's category
+	entries, err = ing.parseContent(string(content), "firehol", config.FeedConfig{Name: "firehol_level1", ThreatType: "malicious"})
+	if err != nil {
+		t.Fatalf("parseContent() error = %v", err)
+	}
+	if len(entries) == 0 || entries[0].ThreatType != "malicious" {
+		t.Errorf("entries = %+v, want the configured threat type malicious", entries)
+	}
+}
+
+func TestParseContentRejectsBroadPrefixes(t *testing.T) {
+	ing := newTestIngestor(t, 0, 0)
+	ing.config.Ingestor.MinPrefixLengthV4 = 8
+	ing.config.Ingestor.MinPrefixLengthV6 = 16
+
+	content := "0.0.0.0/0\n128.0.0.0/1\n10.0.0.0/8\n45.155.205.0/24\n::/0\n2a03::/12\n2a03:2880::/32\n185.220.101.7\n"
+
+	entries, err := ing.parseContent(content, "plain", config.FeedConfig{Name: "broad", ThreatType: "attack"})
+	if err != nil {
+		t.Fatalf("parseContent() error = %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.IPString)
+	}
+	want := []string{"10.0.0.0/8", "45.155.205.0/24", "2a03:2880::/32", "185.220.101.7"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+
+	// A feed can tighten the limit
+	entries, err = ing.parseContent(content, "plain", config.FeedConfig{Name: "strict", ThreatType: "attack", MinPrefixLengthV4: 16})
+	if err != nil {
+		t.Fatalf("parseContent() error = %v", err)
+	}
+	for _, e := range entries {
+		if e.IPString == "10.0.0.0/8" {
+			t.Errorf("10.0.0.0/8 kept despite the feed's min_prefix_length_v4 of 16")
+		}
+	}
+}
+
+func TestRecordFeedRunMetrics(t *testing.T) {
+	ing, err := New(&config.Config{}, &config.FeedsConfig{}, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	feedConfig := config.FeedConfig{Sources: []config.SourceConfig{{Name: "a"}, {Name: "b"}}}
+
+	before := time.Now().Unix()
+	ing.recordFeedRun("metrics_feed", feedConfig, 42, 40, nil, time.Second)
+
+	if got := testutil.ToFloat64(metrics.FeedEntries.WithLabelValues("metrics_feed")); got != 42 {
+		t.Errorf("ipquality_feed_entries = %v, want 42", got)
+	}
+	last := testutil.ToFloat64(metrics.FeedLastSuccess.WithLabelValues("metrics_feed"))
+	if int64(last) < before {
+		t.Errorf("ipquality_feed_last_success_timestamp = %v, want >= %d", last, before)
+	}
+
+	// Partial and failed runs leave the success gauges alone
+	ing.recordFeedRun("metrics_feed", feedConfig, 10, 10, []error{errors.New("b: timeout")}, time.Second)
+	ing.recordFeedRun("metrics_feed", feedConfig, 0, 0, []error{errors.New("a"), errors.New("b")}, time.Second)
+	if got := testutil.ToFloat64(metrics.FeedEntries.WithLabelValues("metrics_feed")); got != 42 {
+		t.Errorf("ipquality_feed_entries after partial and failed runs = %v, want 42", got)
+	}
+	if got := testutil.ToFloat64(metrics.FeedsProcessed.WithLabelValues("metrics_feed", "partial")); got != 1 {
+		t.Errorf("ipquality_feeds_processed_total{status=partial} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.FeedsProcessed.WithLabelValues("metrics_feed", "error")); got != 1 {
+		t.Errorf("ipquality_feeds_processed_total{status=error} = %v, want 1", got)
+	}
+}
+
+func TestProcessFeedRecordsStoredCount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# listed\n192.0.2.1\n192.0.2.2\nnot-an-ip\n")
+	}))
+	defer srv.Close()
+
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	feed := config.FeedConfig{
+		Name:       "stored_feed",
+		ThreatType: "malware",
+		Sources:    []config.SourceConfig{{Name: "list", URL: srv.URL, Format: "plain"}},
+	}
+	ing.processFeed(context.Background(), "stored_feed", feed)
+
+	if got := testutil.ToFloat64(metrics.FeedEntriesStored.WithLabelValues("stored_feed")); got != 2 {
+		t.Errorf("ipquality_feed_entries_stored_total = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.FeedsProcessed.WithLabelValues("stored_feed", "success")); got != 1 {
+		t.Errorf("ipquality_feeds_processed_total{status=success} = %v, want 1", got)
+	}
+}
+
+func TestStoreEntriesWithoutDatabase(t *testing.T) {
+	ing := newTestIngestor(t, 0, time.Millisecond)
+	if insert := ing.insertFunc(10); insert != nil {
+		t.Fatal("insertFunc() without a database returned an insert path")
+	}
+
+	entries := []models.FeedEntry{{IP: netip.MustParseAddr("192.0.2.1")}, {IP: netip.MustParseAddr("192.0.2.2")}}
+	if stored, err := ing.storeEntries(entries); stored != 2 || err != nil {
+		t.Errorf("storeEntries() = %d, %v; want 2, nil", stored, err)
+	}
+}
+
+func TestFeedRunStatus(t *testing.T) {
+	two := config.FeedConfig{Sources: []config.SourceConfig{{Name: "a"}, {Name: "b"}}}
+	tests := []struct {
+		name string
+		feed config.FeedConfig
+		errs []error
+		want string
+	}{
+		{"every source fetched", two, nil, database.FeedRunSuccess},
+		{"one source failed", two, []error{errors.New("b: timeout")}, database.FeedRunPartial},
+		{"every source failed", two, []error{errors.New("a"), errors.New("b")}, database.FeedRunError},
+		{"no sources", config.FeedConfig{}, nil, database.FeedRunSkipped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feedRun("feed", tt.feed, 0, 0, tt.errs, time.Second).Status; got != tt.want {
+				t.Errorf("status = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleCleanup(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Retention.CleanupInterval = time.Hour
+
+	ing, err := New(cfg, &config.FeedsConfig{}, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ing.scheduleCleanup()
+	if n := len(ing.cron.Entries()); n != 0 {
+		t.Errorf("scheduled %d cron entries without a database, want 0", n)
+	}
+
+	ing.db = &database.PostgresDB{}
+	ing.scheduleCleanup()
+	if n := len(ing.cron.Entries()); n != 1 {
+		t.Errorf("scheduled %d cron entries, want the cleanup", n)
+	}
+
+	// Rescheduling the feeds on reload keeps the cleanup
+	ing.schedule()
+	if n := len(ing.cron.Entries()); n != 1 {
+		t.Errorf("%d cron entries after schedule(), want the cleanup to remain", n)
+	}
+}
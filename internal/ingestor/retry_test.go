@@ -0,0 +1,152 @@
+package ingestor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+)
+
+func newTestIngestor(t *testing.T, maxRetries int, retryDelay time.Duration) *Ingestor {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Ingestor.HTTPTimeout = 5 * time.Second
+	cfg.Ingestor.MaxRetries = maxRetries
+	cfg.Ingestor.RetryDelay = retryDelay
+
+	ing, err := New(cfg, &config.FeedsConfig{}, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return ing
+}
+
+// flakyServer fails the first n requests with status, then serves body
+func flakyServer(n int32, status int, header http.Header, body string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= n {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	return srv, &calls
+}
+
+func TestFetchSourceRetries(t *testing.T) {
+	feed := config.FeedConfig{ThreatType: "attack", Confidence: 1, Weight: 50}
+
+	tests := []struct {
+		name      string
+		failures  int32
+		status    int
+		header    http.Header
+		retries   int
+		wantCalls int32
+		wantErr   string
+	}{
+		{"recovers from 503", 2, http.StatusServiceUnavailable, nil, 3, 3, ""},
+		{"recovers from 429 with Retry-After", 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}}, 3, 2, ""},
+		{"gives up after max retries", 10, http.StatusBadGateway, nil, 2, 3, "status code: 502"},
+		{"does not retry 404", 10, http.StatusNotFound, nil, 3, 1, "status code: 404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := flakyServer(tt.failures, tt.status, tt.header, "192.0.2.1\n198.51.100.0/24\n")
+			defer srv.Close()
+
+			ing := newTestIngestor(t, tt.retries, time.Millisecond)
+			entries, err := ing.fetchSource(context.Background(), config.SourceConfig{URL: srv.URL, Name: "test"}, feed)
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server calls = %d, want %d", got, tt.wantCalls)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetchSource() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchSource() error = %v", err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("fetchSource() returned %d entries, want 2", len(entries))
+			}
+		})
+	}
+}
+
+func TestFetchSourceCancelDuringBackoff(t *testing.T) {
+	srv, _ := flakyServer(100, http.StatusServiceUnavailable, nil, "")
+	defer srv.Close()
+
+	ing := newTestIngestor(t, 5, 10*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := ing.fetchSource(ctx, config.SourceConfig{URL: srv.URL}, config.FeedConfig{})
+	if err == nil {
+		t.Fatal("fetchSource() error = nil, want context error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetchSource() took %v after cancel, want prompt return", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"30", 30 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"86400", maxRetryBackoff, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.header, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+
+	for attempt := 0; attempt < 5; attempt++ {
+		full := base << attempt
+		for n := 0; n < 20; n++ {
+			d := backoffDelay(base, attempt)
+			if d < full/2 || d > full {
+				t.Fatalf("backoffDelay(%v, %d) = %v, want within [%v, %v]", base, attempt, d, full/2, full)
+			}
+		}
+	}
+
+	if d := backoffDelay(time.Minute, 20); d > maxRetryBackoff {
+		t.Errorf("backoffDelay() = %v, want capped at %v", d, maxRetryBackoff)
+	}
+}
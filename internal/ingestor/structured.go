@@ -0,0 +1,179 @@
+package ingestor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+)
+
+// Default fields of the structured parsers
+const (
+	defaultCSVIPField  = "1"
+	defaultJSONIPField = "ip"
+)
+
+// Layouts accepted for a record's first-seen date, tried in order
+var firstSeenLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02",
+}
+
+// feedRecord is one entry read from a structured (csv or json) feed
+type feedRecord struct {
+	ip          string
+	tags        []string
+	description string
+	firstSeen   time.Time
+}
+
+// parseCSVRecord reads one delimited line. Fields are 1-based column numbers;
+// lines without a usable IP column (headers, short rows) are skipped.
+func parseCSVRecord(line string, format config.Format) (feedRecord, bool) {
+	r := csv.NewReader(strings.NewReader(line))
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	if format.Separator != "" {
+		r.Comma = []rune(format.Separator)[0]
+	}
+
+	fields, err := r.Read()
+	if err != nil {
+		return feedRecord{}, false
+	}
+
+	column := func(field string) string {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[n-1])
+	}
+
+	ipField := format.IPField
+	if ipField == "" {
+		ipField = defaultCSVIPField
+	}
+	rec := feedRecord{ip: column(ipField)}
+	if rec.ip == "" {
+		return feedRecord{}, false
+	}
+	if format.TagsField != "" {
+		rec.tags = splitTags(column(format.TagsField), format.TagSeparator)
+	}
+	if format.DescriptionField != "" {
+		rec.description = column(format.DescriptionField)
+	}
+	if format.FirstSeenField != "" {
+		rec.firstSeen = parseFirstSeen(column(format.FirstSeenField))
+	}
+	return rec, true
+}
+
+// parseJSONRecords reads a JSON array of objects or newline-delimited objects.
+// Objects without a string IP field are skipped.
+func parseJSONRecords(content string, format config.Format) ([]feedRecord, error) {
+	var objects []map[string]any
+
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "[") {
+		if err := json.Unmarshal([]byte(content), &objects); err != nil {
+			return nil, fmt.Errorf("invalid JSON feed: %w", err)
+		}
+	} else {
+		dec := json.NewDecoder(strings.NewReader(content))
+		for {
+			var obj map[string]any
+			if err := dec.Decode(&obj); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("invalid JSON feed: %w", err)
+			}
+			objects = append(objects, obj)
+		}
+	}
+
+	ipField := format.IPField
+	if ipField == "" {
+		ipField = defaultJSONIPField
+	}
+
+	records := make([]feedRecord, 0, len(objects))
+	for _, obj := range objects {
+		ip, _ := obj[ipField].(string)
+		if ip == "" {
+			continue
+		}
+		rec := feedRecord{ip: strings.TrimSpace(ip)}
+		if format.TagsField != "" {
+			rec.tags = jsonTags(obj[format.TagsField], format.TagSeparator)
+		}
+		if format.DescriptionField != "" {
+			desc, _ := obj[format.DescriptionField].(string)
+			rec.description = strings.TrimSpace(desc)
+		}
+		if format.FirstSeenField != "" {
+			seen, _ := obj[format.FirstSeenField].(string)
+			rec.firstSeen = parseFirstSeen(seen)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// parseFirstSeen reads a first-seen date in UTC unless it names a zone; an
+// unparseable date is treated as missing
+func parseFirstSeen(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range firstSeenLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// jsonTags reads a tags value that is either a string or an array of strings
+func jsonTags(v any, separator string) []string {
+	switch v := v.(type) {
+	case string:
+		return splitTags(v, separator)
+	case []any:
+		var tags []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				tags = append(tags, splitTags(s, "")...)
+			}
+		}
+		return tags
+	}
+	return nil
+}
+
+// splitTags splits a tags string on separator, dropping empty tags
+func splitTags(value, separator string) []string {
+	parts := []string{value}
+	if separator != "" {
+		parts = strings.Split(value, separator)
+	}
+
+	var tags []string
+	for _, part := range parts {
+		if tag := strings.TrimSpace(part); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,155 @@
+package ingestor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestParseContentStructured(t *testing.T) {
+	ing := newTestIngestor(t, 0, 0)
+	ing.feeds().Formats = map[string]config.Format{
+		"tagged_csv": {Parser: "csv", IPField: "2", TagsField: "3", TagSeparator: "|", DescriptionField: "4"},
+		"feodo_json": {Parser: "json", IPField: "ip_address", TagsField: "malware"},
+		"json":       {TagsField: "tags", DescriptionField: "comment"},
+	}
+	feed := config.FeedConfig{Name: "test", ThreatType: "malware", Confidence: 0.9, Weight: 80}
+
+	type want struct {
+		ip          string
+		tags        []string
+		description string
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    []want
+	}{
+		{
+			name:   "csv columns",
+			format: "tagged_csv",
+			content: "# first_seen,ip,tags,note\n" +
+				"first_seen,ip,tags,note\n" +
+				"2026-10-01,203.0.113.7,ssh|bruteforce,\"seen on port 22, repeatedly\"\n" +
+				"2026-10-02,198.51.100.0/24,,\n" +
+				"2026-10-03\n",
+			want: []want{
+				{"203.0.113.7", []string{"ssh", "bruteforce"}, "seen on port 22, repeatedly"},
+				{"198.51.100.0/24", nil, ""},
+			},
+		},
+		{
+			name:    "json array",
+			format:  "feodo_json",
+			content: `[{"ip_address":"203.0.113.7","port":443,"malware":"Emotet"},{"ip_address":"","malware":"Dridex"},{"malware":"QakBot"}]`,
+			want: []want{
+				{"203.0.113.7", []string{"Emotet"}, ""},
+			},
+		},
+		{
+			name:    "newline-delimited json",
+			format:  "json",
+			content: "{\"ip\":\"203.0.113.7\",\"tags\":[\"c2\",\"cobalt_strike\"],\"comment\":\"beacon\"}\n{\"ip\":\"2001:db8::1\"}\n",
+			want: []want{
+				{"203.0.113.7", []string{"c2", "cobalt_strike"}, "beacon"},
+				{"2001:db8::1", nil, ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ing.parseContent(tt.content, tt.format, feed)
+			if err != nil {
+				t.Fatalf("parseContent() error = %v", err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d: %+v", len(entries), len(tt.want), entries)
+			}
+			for i, w := range tt.want {
+				e := entries[i]
+				if e.IPString != w.ip || !reflect.DeepEqual(e.Tags, w.tags) || e.Description != w.description {
+					t.Errorf("entry %d = %s %v %q, want %s %v %q", i, e.IPString, e.Tags, e.Description, w.ip, w.tags, w.description)
+				}
+			}
+		})
+	}
+}
+
+func TestParseContentFirstSeen(t *testing.T) {
+	ing := newTestIngestor(t, 0, 0)
+	ing.feeds().Formats = map[string]config.Format{
+		"dated_csv":  {Parser: "csv", IPField: "2", FirstSeenField: "1"},
+		"feodo_json": {Parser: "json", IPField: "ip_address", FirstSeenField: "first_seen"},
+	}
+	feed := config.FeedConfig{Name: "test", ThreatType: "malware"}
+
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    []time.Time
+	}{
+		{
+			name:    "csv date",
+			format:  "dated_csv",
+			content: "2026-10-01,203.0.113.7\n2026-10-02T08:30:00Z,203.0.113.8\nyesterday,203.0.113.9\n",
+			want: []time.Time{
+				time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, 10, 2, 8, 30, 0, 0, time.UTC),
+				{},
+			},
+		},
+		{
+			name:    "json timestamp",
+			format:  "feodo_json",
+			content: `[{"ip_address":"203.0.113.7","first_seen":"2021-05-13 03:28:00"},{"ip_address":"203.0.113.8"}]`,
+			want: []time.Time{
+				time.Date(2021, 5, 13, 3, 28, 0, 0, time.UTC),
+				{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ing.parseContent(tt.content, tt.format, feed)
+			if err != nil {
+				t.Fatalf("parseContent() error = %v", err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d: %+v", len(entries), len(tt.want), entries)
+			}
+			for i, want := range tt.want {
+				if !entries[i].FirstSeen.Equal(want) {
+					t.Errorf("entry %d FirstSeen = %v, want %v", i, entries[i].FirstSeen, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseContentInvalidJSON(t *testing.T) {
+	ing := newTestIngestor(t, 0, 0)
+	feed := config.FeedConfig{Name: "test", ThreatType: "malware"}
+
+	if _, err := ing.parseContent("<html>Service Unavailable</html>", "json", feed); err == nil {
+		t.Error("parseContent() accepted an HTML error page as JSON")
+	}
+}
+
+func TestEntryMetadata(t *testing.T) {
+	got := entryMetadata(models.FeedEntry{Tags: []string{"Emotet"}, Description: "C2"})
+	want := map[string]interface{}{"tags": []string{"Emotet"}, "description": "C2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entryMetadata() = %v, want %v", got, want)
+	}
+	if got := entryMetadata(models.FeedEntry{}); got != nil {
+		t.Errorf("entryMetadata() of an untagged entry = %v, want nil", got)
+	}
+}
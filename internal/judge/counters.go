@@ -0,0 +1,147 @@
+package judge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// counterFlushInterval is how often a worker pushes its counts to the shared store
+const counterFlushInterval = time.Second
+
+// CounterStore aggregates lookup and scan counts across the worker processes
+// of one node. With prefork every worker has its own in-process counters, so
+// /stats needs a shared store to report node-wide totals.
+type CounterStore interface {
+	Add(ctx context.Context, lookups, scans uint64) error
+	Totals(ctx context.Context) (lookups, scans uint64, err error)
+}
+
+// SetCounterStore makes /stats report totals from s; local counts are pushed
+// to it every counterFlushInterval while the node runs
+func (n *Node) SetCounterStore(s CounterStore) {
+	n.counterStore = s
+}
+
+// flushCounters pushes the counts recorded since the last flush to the store
+func (n *Node) flushCounters(ctx context.Context) error {
+	n.flushMu.Lock()
+	defer n.flushMu.Unlock()
+
+	lookups, scans := n.lookupCount.Load(), n.scanCount.Load()
+	if lookups == n.flushedLookups && scans == n.flushedScans {
+		return nil
+	}
+	if err := n.counterStore.Add(ctx, lookups-n.flushedLookups, scans-n.flushedScans); err != nil {
+		return err
+	}
+	n.flushedLookups, n.flushedScans = lookups, scans
+	return nil
+}
+
+// counterFlushLoop flushes counts until ctx is cancelled
+func (n *Node) counterFlushLoop(ctx context.Context) {
+	ticker := time.NewTicker(counterFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flushCtx, cancel := context.WithTimeout(ctx, counterFlushInterval)
+			if err := n.flushCounters(flushCtx); err != nil {
+				n.log.Warn(fmt.Sprintf("Failed to flush judge counters: %v", err))
+			}
+			cancel()
+		}
+	}
+}
+
+// counts returns the lookup and scan totals reported by /stats, and whether
+// they cover the whole node or only this process. Counts not yet flushed are
+// added to the store's totals.
+func (n *Node) counts(ctx context.Context) (lookups, scans uint64, nodeWide bool) {
+	if n.counterStore == nil {
+		return n.lookupCount.Load(), n.scanCount.Load(), !n.config.Judge.Prefork
+	}
+
+	n.flushMu.Lock()
+	defer n.flushMu.Unlock()
+
+	lookups, scans, err := n.counterStore.Totals(ctx)
+	if err != nil {
+		n.log.Warn(fmt.Sprintf("Failed to read judge counters: %v (reporting this worker only)", err))
+		return n.lookupCount.Load(), n.scanCount.Load(), false
+	}
+	lookups += n.lookupCount.Load() - n.flushedLookups
+	scans += n.scanCount.Load() - n.flushedScans
+	return lookups, scans, true
+}
+
+// RedisCounterStore keeps node-wide counts in a Redis hash. The key is scoped
+// to the host and the prefork master's PID, so a restarted node starts from
+// zero and stale keys expire on their own.
+type RedisCounterStore struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// redisCounterTTL is how long an idle node's counters are kept
+const redisCounterTTL = 24 * time.Hour
+
+// NewRedisCounterStore keeps shared judge counters in Redis through client,
+// which it takes ownership of (see cache.NewClient)
+func NewRedisCounterStore(client redis.UniversalClient) *RedisCounterStore {
+	return &RedisCounterStore{client: client, key: "judge:counters:" + counterGroup()}
+}
+
+// counterGroup identifies the processes of one judge node: prefork children
+// share their master's PID
+func counterGroup() string {
+	host, _ := os.Hostname()
+	pid := os.Getpid()
+	if fiber.IsChild() {
+		pid = os.Getppid()
+	}
+	return host + ":" + strconv.Itoa(pid)
+}
+
+// Add increments the node's counters
+func (s *RedisCounterStore) Add(ctx context.Context, lookups, scans uint64) error {
+	pipe := s.client.TxPipeline()
+	pipe.HIncrBy(ctx, s.key, "lookups", int64(lookups))
+	pipe.HIncrBy(ctx, s.key, "scans", int64(scans))
+	pipe.Expire(ctx, s.key, redisCounterTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Totals returns the node's counters
+func (s *RedisCounterStore) Totals(ctx context.Context) (lookups, scans uint64, err error) {
+	values, err := s.client.HMGet(ctx, s.key, "lookups", "scans").Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	counts := make([]uint64, len(values))
+	for i, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			continue // Nothing flushed yet
+		}
+		if counts[i], err = strconv.ParseUint(str, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid counter in %s: %w", s.key, err)
+		}
+	}
+	return counts[0], counts[1], nil
+}
+
+// Close closes the Redis connection
+func (s *RedisCounterStore) Close() error {
+	return s.client.Close()
+}
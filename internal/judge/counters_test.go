@@ -0,0 +1,99 @@
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// memoryCounterStore is a CounterStore shared by nodes standing in for prefork workers
+type memoryCounterStore struct {
+	mu             sync.Mutex
+	lookups, scans uint64
+}
+
+func (s *memoryCounterStore) Add(ctx context.Context, lookups, scans uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups += lookups
+	s.scans += scans
+	return nil
+}
+
+func (s *memoryCounterStore) Totals(ctx context.Context) (uint64, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookups, s.scans, nil
+}
+
+type statsResponse struct {
+	LookupCount  uint64 `json:"lookup_count"`
+	CounterScope string `json:"counter_scope"`
+}
+
+func getStats(t *testing.T, node *Node) statsResponse {
+	t.Helper()
+
+	resp, err := node.app.Test(httptest.NewRequest("GET", "/stats", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	var stats statsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return stats
+}
+
+func TestSharedCounters(t *testing.T) {
+	store := &memoryCounterStore{}
+	workers := []*Node{newTestNode(t, 10), newTestNode(t, 10)}
+	for _, w := range workers {
+		w.config.Judge.Prefork = true
+		w.SetCounterStore(store)
+	}
+
+	check := func(node *Node, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := node.app.Test(httptest.NewRequest("GET", "/check/185.220.101.7", nil)); err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+		}
+	}
+	check(workers[0], 3)
+	check(workers[1], 2)
+
+	if err := workers[0].flushCounters(context.Background()); err != nil {
+		t.Fatalf("flushCounters: %v", err)
+	}
+
+	// Worker 1 sees worker 0's flushed counts plus its own unflushed ones
+	if got := getStats(t, workers[1]); got.LookupCount != 5 || got.CounterScope != "node" {
+		t.Errorf("worker 1 stats = %+v, want 5 lookups node-wide", got)
+	}
+
+	// Flushing twice does not count anything again
+	for _, w := range workers {
+		for i := 0; i < 2; i++ {
+			if err := w.flushCounters(context.Background()); err != nil {
+				t.Fatalf("flushCounters: %v", err)
+			}
+		}
+	}
+	if store.lookups != 5 {
+		t.Errorf("store lookups = %d, want 5", store.lookups)
+	}
+	if got := getStats(t, workers[0]); got.LookupCount != 5 {
+		t.Errorf("worker 0 lookup_count = %d, want 5", got.LookupCount)
+	}
+
+	// Without a store, prefork stats only cover the serving worker
+	alone := newTestNode(t, 10)
+	alone.config.Judge.Prefork = true
+	check(alone, 1)
+	if got := getStats(t, alone); got.LookupCount != 1 || got.CounterScope != "worker" {
+		t.Errorf("stats without store = %+v, want 1 lookup per worker", got)
+	}
+}
@@ -0,0 +1,223 @@
+package judge
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ScanServiceName is the fully qualified gRPC service name of the judge scan service
+const ScanServiceName = "beon.judge.v1.ScanService"
+
+// jsonCodecName is the gRPC content subtype used by the scan service.
+// Clients must call with grpc.CallContentSubtype(jsonCodecName).
+const jsonCodecName = "json"
+
+// ScanRequest is a single IP streamed by the client
+type ScanRequest struct {
+	IP    string `json:"ip"`
+	Quick bool   `json:"quick,omitempty"`
+}
+
+// jsonCodec marshals gRPC messages as JSON so the service needs no generated code
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return jsonCodecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// scanServiceServer is the handler type registered for the scan service
+type scanServiceServer interface {
+	StreamScan(stream grpc.ServerStream) error
+}
+
+// scanServiceDesc describes the bidirectional StreamScan RPC
+var scanServiceDesc = grpc.ServiceDesc{
+	ServiceName: ScanServiceName,
+	HandlerType: (*scanServiceServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "StreamScan",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(scanServiceServer).StreamScan(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+// StreamScanMethod is the full method name clients invoke
+var StreamScanMethod = "/" + ScanServiceName + "/StreamScan"
+
+// ScanStreamDesc is the stream descriptor clients pass to grpc.ClientConn.NewStream
+var ScanStreamDesc = &scanServiceDesc.Streams[0]
+
+// scanService streams scan results back as each scan completes
+type scanService struct {
+	node *Node
+}
+
+// StreamScan receives IPs from the client and sends a ScanResult for each one.
+// At most scan_workers scans run at once; further requests are not read until a
+// slot frees up, so gRPC flow control pushes back on fast clients.
+func (s *scanService) StreamScan(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	scanner := s.node.scanner
+	client := streamClient(ctx)
+
+	results := make(chan *ScanResult)
+	sendErr := make(chan error, 1)
+
+	// Single sender: grpc streams do not allow concurrent SendMsg calls
+	go func() {
+		for result := range results {
+			if err := stream.SendMsg(result); err != nil {
+				sendErr <- err
+				for range results {
+				}
+				return
+			}
+		}
+		sendErr <- nil
+	}()
+
+	semaphore := make(chan struct{}, scanner.maxWorkers)
+	var wg sync.WaitGroup
+	var recvErr error
+
+	for {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			recvErr = ctx.Err()
+		}
+		if recvErr != nil {
+			break
+		}
+
+		var req ScanRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			<-semaphore
+			if err != io.EOF {
+				recvErr = err
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func(req ScanRequest) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results <- s.node.scanOne(ctx, req, client)
+		}(req)
+	}
+
+	wg.Wait()
+	close(results)
+
+	if err := <-sendErr; err != nil {
+		return err
+	}
+	return recvErr
+}
+
+// streamClient identifies the client of a stream for the scan rate limit
+func streamClient(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// scanOne validates and scans a single streamed IP, charging the scan to
+// client's rate limit
+func (n *Node) scanOne(ctx context.Context, req ScanRequest, client string) *ScanResult {
+	addr, msg := parseScanTarget(req.IP)
+	if msg == "" && n.quota != nil && !n.quota.take(client, 1) {
+		msg = "Scan rate limit exceeded"
+	}
+	if msg != "" {
+		return &ScanResult{
+			IP:         req.IP,
+			OpenPorts:  []int{},
+			ProxyPorts: []int{},
+			Error:      msg,
+		}
+	}
+	target := addr.String()
+
+	n.scans.Add(1)
+	defer n.scans.Done()
+
+	var result *ScanResult
+	if req.Quick {
+		result = n.scanner.QuickScan(ctx, target)
+	} else {
+		result = n.scanner.Scan(ctx, target)
+	}
+	n.scanCount.Add(1)
+	return result
+}
+
+// newGRPCServer returns a gRPC server serving the scan service to clients
+// that present judge.grpc_token
+func (n *Node) newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(grpc.StreamInterceptor(n.authorizeStream))
+	server.RegisterService(&scanServiceDesc, &scanService{node: n})
+	return server
+}
+
+// authorizeStream rejects streams whose authorization metadata is not
+// "Bearer <judge.grpc_token>"
+func (n *Node) authorizeStream(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if token := n.config.Judge.GRPCToken; token != "" {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		want := []byte("Bearer " + token)
+		for _, got := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(got), want) == 1 {
+				return handler(srv, stream)
+			}
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+// startGRPC listens on judge.grpc_port and serves the scan service in the background
+func (n *Node) startGRPC() error {
+	addr := fmt.Sprintf("%s:%d", n.config.Server.Host, n.config.Judge.GRPCPort)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	n.grpcServer = n.newGRPCServer()
+
+	go func() {
+		if err := n.grpcServer.Serve(lis); err != nil {
+			n.log.Error(fmt.Sprintf("gRPC server error: %v", err))
+		}
+	}()
+
+	n.log.Info(fmt.Sprintf("gRPC scan service listening on %s", addr))
+	return nil
+}
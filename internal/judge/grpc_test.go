@@ -0,0 +1,162 @@
+package judge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+)
+
+// testToken is the judge.grpc_token of nodes served by startTestGRPC
+const testToken = "test-token"
+
+// startTestGRPC serves node's scan service over an in-memory listener and
+// returns a client connection to it
+func startTestGRPC(t *testing.T, node *Node) *grpc.ClientConn {
+	t.Helper()
+	node.config = &config.Config{}
+	node.config.Judge.GRPCToken = testToken
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := node.newGRPCServer()
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(jsonCodecName)),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// refusingScanner returns a scanner whose dials are all refused
+func refusingScanner() *Scanner {
+	scanner := NewScanner(ScannerConfig{Timeout: time.Second, MaxWorkers: 2})
+	scanner.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	return scanner
+}
+
+// streamScan sends ips on one stream authorized with token and collects the
+// results by IP
+func streamScan(ctx context.Context, t *testing.T, conn *grpc.ClientConn, token string, ips []string) (map[string]*ScanResult, error) {
+	t.Helper()
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	stream, err := conn.NewStream(ctx, ScanStreamDesc, StreamScanMethod)
+	if err != nil {
+		return nil, err
+	}
+	for i, ip := range ips {
+		if err := stream.SendMsg(&ScanRequest{IP: ip, Quick: i%2 == 0}); err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	got := make(map[string]*ScanResult)
+	for {
+		var result ScanResult
+		err := stream.RecvMsg(&result)
+		if err == io.EOF {
+			return got, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := got[result.IP]; dup {
+			t.Errorf("duplicate result for %s", result.IP)
+		}
+		got[result.IP] = &result
+	}
+}
+
+func TestStreamScanRoundTrip(t *testing.T) {
+	conn := startTestGRPC(t, &Node{scanner: refusingScanner(), startTime: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ips := []string{"192.0.2.1", "192.0.2.2", "198.51.100.3", "203.0.113.4", "not-an-ip"}
+	got, err := streamScan(ctx, t, conn, testToken, ips)
+	if err != nil {
+		t.Fatalf("streamScan: %v", err)
+	}
+
+	if len(got) != len(ips) {
+		t.Fatalf("received %d results, want %d", len(got), len(ips))
+	}
+	for _, ip := range ips {
+		if _, ok := got[ip]; !ok {
+			t.Errorf("missing result for %s", ip)
+		}
+	}
+	if got["not-an-ip"].Error == "" {
+		t.Error("expected error for invalid IP")
+	}
+	if got["192.0.2.1"].Error != "" {
+		t.Errorf("unexpected error for valid IP: %s", got["192.0.2.1"].Error)
+	}
+}
+
+func TestStreamScanRequiresToken(t *testing.T) {
+	conn := startTestGRPC(t, &Node{scanner: refusingScanner(), startTime: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, token := range []string{"", "wrong-token"} {
+		if _, err := streamScan(ctx, t, conn, token, []string{"192.0.2.1"}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("token %q: error = %v, want Unauthenticated", token, err)
+		}
+	}
+}
+
+func TestStreamScanRateLimit(t *testing.T) {
+	node := &Node{scanner: refusingScanner(), startTime: time.Now(), quota: newScanQuota(2)}
+	node.quota.now = func() time.Time { return time.Unix(1700000000, 0) }
+	conn := startTestGRPC(t, node)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	got, err := streamScan(ctx, t, conn, testToken, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "not-an-ip"})
+	if err != nil {
+		t.Fatalf("streamScan: %v", err)
+	}
+
+	limited := 0
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		if got[ip].Error == "Scan rate limit exceeded" {
+			limited++
+		}
+	}
+	if limited != 1 {
+		t.Errorf("%d of 3 scans rate limited, want 1", limited)
+	}
+	if got["not-an-ip"].Error == "Scan rate limit exceeded" {
+		t.Error("invalid IP was charged to the rate limit")
+	}
+}
@@ -2,19 +2,27 @@ package judge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/netip"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/asn"
 	"github.com/lfrfrfr/beon-ipquality/internal/config"
 	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
 	"github.com/lfrfrfr/beon-ipquality/internal/scoring"
+	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
 	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
 	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
@@ -24,35 +32,95 @@ type Node struct {
 	config      *config.Config
 	app         *fiber.App
 	mmdbReader  *mmdb.Reader
+	repIndex    ReputationIndex // With judge.reputation_backend index; see SetReputationIndex
 	scorer      *scoring.Scorer
+	asnTypes    *asn.Classifier // No database here: org name heuristic only
 	scanner     *Scanner
+	checkOpts   iputil.CheckOptions // Which non-public addresses may be checked; scans stay public-only
+	grpcServer  *grpc.Server
+	quota       *scanQuota // Scans per second per client over HTTP and gRPC (nil = unlimited)
+	scanLogger  ScanLogger
+	scanCache   ScanCache // Recent single-IP scans; see judge.scan_cache_ttl
+	log         *logger.Logger
 	mu          sync.RWMutex
+	scans       sync.WaitGroup // In-flight scans and scan log writes, drained on shutdown
 	startTime   time.Time
-	lookupCount uint64
-	scanCount   uint64
+	lookupCount atomic.Uint64
+	scanCount   atomic.Uint64
+
+	// Shared counters for prefork; flushed* are the counts already pushed
+	counterStore   CounterStore
+	flushMu        sync.Mutex
+	flushedLookups uint64
+	flushedScans   uint64
+}
+
+// ReputationIndex is an in-memory alternative to the compiled reputation MMDB
+// that is rebuilt from the database on reload; internal/index implements it
+type ReputationIndex interface {
+	mmdb.ReputationSource
+	Reload(ctx context.Context) (int, error)
+	Loaded() bool
+	Len() int
 }
 
 // New creates a new Judge Node
 func New(cfg *config.Config) (*Node, error) {
-	// Create MMDB reader
-	reader, err := mmdb.NewReader(
-		cfg.MMDB.ReputationPath,
-		cfg.MMDB.GeoLite2CityPath,
-		cfg.MMDB.GeoLite2ASNPath,
-	)
+	// Without a compiled reputation MMDB the node still serves scans; the
+	// database is picked up by the next reload
+	reader, err := openReader(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create MMDB reader: %w", err)
+		logger.Warn(fmt.Sprintf("Reputation MMDB unavailable: %v (checks return 503 until it is reloaded)", err))
+		reader = nil
 	}
 
 	// Create scorer
-	scorer := scoring.NewDefault()
+	scoringConfig, err := scoring.FromConfig(cfg.Scoring)
+	if err != nil {
+		return nil, err
+	}
+	scorer := scoring.New(scoringConfig)
 
 	// Create scanner for active probing
 	scanner := NewScanner(ScannerConfig{
 		Timeout:    time.Duration(cfg.Judge.ScanTimeout) * time.Second,
 		MaxWorkers: cfg.Judge.ScanWorkers,
+		ExternalIP: cfg.Judge.ExternalIP,
+		UDPPorts:   cfg.Judge.UDPPorts,
+		UDPTimeout: cfg.Judge.UDPTimeout,
+		UDPRetries: cfg.Judge.UDPRetries,
+		ProbeHosts: cfg.Judge.ProbeHosts,
+		EchoURL:    cfg.Judge.EchoURL,
+		PortHints:  portHints(cfg.Judge.PortHints),
+
+		PortScanMode:   cfg.Judge.PortScanMode,
+		FastTimeout:    cfg.Judge.PortScanFastTimeout,
+		ConfirmTimeout: cfg.Judge.PortScanConfirmTimeout,
+		FastWorkers:    cfg.Judge.PortScanFastWorkers,
 	})
 
+	// Resolve the probe destination now rather than trusting a hardcoded IP
+	probeCtx, probeCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	target, err := scanner.ResolveProbeTarget(probeCtx)
+	probeCancel()
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to resolve probe target: %v (SOCKS4 probes will use SOCKS4a with %s)", err, target.Host))
+	} else {
+		logger.Info(fmt.Sprintf("Probe target: %s (%s)", target.Host, target.IP))
+	}
+
+	// Detect our external IP so header inspection can spot it in proxy headers
+	if cfg.Judge.ExternalIP == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		externalIP, err := scanner.RefreshExternalIP(ctx)
+		cancel()
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Failed to detect external IP: %v (header inspection will only match client IPs)", err))
+		} else {
+			logger.Info(fmt.Sprintf("External IP detected: %s", externalIP))
+		}
+	}
+
 	// Create Fiber app with optimized settings
 	app := fiber.New(fiber.Config{
 		AppName:               "BEON-Judge-Node",
@@ -62,20 +130,30 @@ func New(cfg *config.Config) (*Node, error) {
 		ReadTimeout:           cfg.Server.ReadTimeout,
 		WriteTimeout:          cfg.Server.WriteTimeout,
 		IdleTimeout:           cfg.Server.IdleTimeout,
-		BodyLimit:             1024, // 1KB limit for judge node
+		BodyLimit:             bodyLimit(max(cfg.Judge.MaxBatchSize(), cfg.Judge.MaxScanBatchSize())),
+		ErrorHandler:          middleware.ErrorHandler,
 	})
 
 	// Add recovery middleware
 	app.Use(recover.New())
 
+	// Echo or assign X-Request-ID so API and judge logs can be correlated
+	app.Use(middleware.RequestID())
+
 	node := &Node{
 		config:     cfg,
 		app:        app,
 		mmdbReader: reader,
+		checkOpts:  cfg.Judge.IPPolicy.CheckOptions(),
 		scorer:     scorer,
+		asnTypes:   asn.NewClassifier(nil, cfg.Scoring.HostingOrgKeywords, cfg.Scoring.ASNCacheTTL),
 		scanner:    scanner,
+		scanCache:  NewMemoryScanCache(),
 		startTime:  time.Now(),
 	}
+	if cfg.Judge.RateLimit > 0 {
+		node.quota = newScanQuota(cfg.Judge.RateLimit)
+	}
 
 	// Setup routes
 	node.setupRoutes()
@@ -83,14 +161,62 @@ func New(cfg *config.Config) (*Node, error) {
 	return node, nil
 }
 
+// portHints converts the validated judge.port_hints
+func portHints(hints map[int]string) map[int]ProxyProtocol {
+	converted := make(map[int]ProxyProtocol, len(hints))
+	for port, protocol := range hints {
+		converted[port] = ProxyProtocol(protocol)
+	}
+	return converted
+}
+
+// bodyLimit keeps the judge's small request limit while leaving room for a
+// full batch (an IPv6 address plus JSON quoting fits in 64 bytes)
+func bodyLimit(batchMaxSize int) int {
+	return 1024 + batchMaxSize*64
+}
+
+// ScanLogger records completed scans, e.g. to ClickHouse
+type ScanLogger interface {
+	LogScanResult(ctx context.Context, log analytics.ScanResultLog) error
+}
+
+// SetScanLogger enables logging of batch scan results
+func (n *Node) SetScanLogger(l ScanLogger) {
+	n.scanLogger = l
+}
+
+// SetReputationIndex makes checks read reputation from idx instead of the
+// reputation MMDB; GeoIP and ASN data still come from the MMDB files. Used
+// with judge.reputation_backend index, which also keeps the reader from
+// opening mmdb.reputation_path.
+func (n *Node) SetReputationIndex(idx ReputationIndex) {
+	n.repIndex = idx
+}
+
+// SetLogger directs the node's logs to l instead of the package-level logger
+func (n *Node) SetLogger(l *logger.Logger) {
+	n.log = l
+}
+
 // setupRoutes configures the API routes for the judge node
 func (n *Node) setupRoutes() {
 	// Single IP lookup - optimized for minimum latency
 	n.app.Get("/check/:ip", n.handleCheck)
+	n.app.Post("/check/batch", n.handleBatchCheck)
+
+	// Active scanning endpoints, rate limited since every scan probes a third
+	// party; batch scans are charged per IP in the handler
+	scan := n.app.Group("/scan")
+	scan.Get("/:ip", n.limitScan, n.handleScan)
+	scan.Get("/:ip/quick", n.limitScan, n.handleQuickScan)
+	scan.Post("/batch", n.handleBatchScan)
 
-	// Active scanning endpoints
-	n.app.Get("/scan/:ip", n.handleScan)
-	n.app.Get("/scan/:ip/quick", n.handleQuickScan)
+	// Proxy self-test: shows what the caller's proxy reveals in its headers
+	n.app.All("/inspect", n.handleInspect)
+
+	// Header echo, usable as judge.echo_url for other judge nodes
+	n.app.Get("/headers", n.handleHeaders)
 
 	// Internal endpoints
 	n.app.Get("/health", n.handleHealth)
@@ -101,23 +227,111 @@ func (n *Node) setupRoutes() {
 	n.app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 }
 
+// limitScan charges a single-IP scan request to the client's judge.rate_limit
+func (n *Node) limitScan(c *fiber.Ctx) error {
+	if !n.takeScans(c, 1) {
+		return scanRateLimited(c)
+	}
+	return c.Next()
+}
+
+// takeScans charges scans to the requesting client. Clients are told apart
+// by IP: the judge does not validate API keys, so a key would let callers
+// pick a fresh bucket per request.
+func (n *Node) takeScans(c *fiber.Ctx, scans int) bool {
+	return n.quota == nil || n.quota.take(middleware.ClientIP(c), scans)
+}
+
+// scanRateLimited responds to a scan request over the client's rate limit
+func scanRateLimited(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderRetryAfter, "1")
+	return middleware.WriteError(c, fiber.StatusTooManyRequests, models.ErrCodeRateLimited, "Scan rate limit exceeded")
+}
+
 // Start starts the judge node server
 func (n *Node) Start(ctx context.Context) error {
 	// Start MMDB reload goroutine
 	if n.config.MMDB.ReloadInterval > 0 {
 		go n.reloadLoop(ctx)
 	}
+	if n.repIndex != nil && n.config.Judge.IndexRefreshInterval > 0 {
+		go n.indexRefreshLoop(ctx)
+	}
+
+	// Keep the detected external IP current
+	if n.config.Judge.ExternalIP == "" && n.config.Judge.ExternalIPRefresh > 0 {
+		go n.externalIPLoop(ctx)
+	}
+
+	// Push this worker's counts to the shared store
+	if n.counterStore != nil {
+		go n.counterFlushLoop(ctx)
+	}
+
+	// Start gRPC streaming scan service; with prefork only the parent
+	// process binds the port
+	if n.config.Judge.GRPCPort > 0 && !fiber.IsChild() {
+		if err := n.startGRPC(); err != nil {
+			return err
+		}
+	}
 
 	addr := fmt.Sprintf("%s:%d", n.config.Server.Host, n.config.Judge.Port)
 	return n.app.Listen(addr)
 }
 
-// Close closes the judge node
-func (n *Node) Close() error {
+// Shutdown stops accepting requests and waits for in-flight scans to finish.
+// When ctx expires first, remaining gRPC streams are cut off and ctx's error is
+// returned; the MMDB reader is closed either way.
+func (n *Node) Shutdown(ctx context.Context) error {
+	err := n.app.ShutdownWithContext(ctx)
+
+	if n.grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			n.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			n.grpcServer.Stop()
+		}
+	}
+
+	// Both servers are down, so only batch scan logging can still be running
+	drained := make(chan struct{})
+	go func() {
+		n.scans.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	if n.counterStore != nil {
+		if flushErr := n.flushCounters(ctx); flushErr != nil {
+			n.log.Warn(fmt.Sprintf("Failed to flush judge counters: %v", flushErr))
+		}
+	}
+
+	n.mu.Lock()
 	if n.mmdbReader != nil {
 		n.mmdbReader.Close()
 	}
-	return n.app.Shutdown()
+	n.mu.Unlock()
+	return err
+}
+
+// Close shuts the judge node down, waiting up to judge.shutdown_timeout
+func (n *Node) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.Judge.ShutdownTimeout)
+	defer cancel()
+	return n.Shutdown(ctx)
 }
 
 // handleCheck handles IP check requests
@@ -125,45 +339,127 @@ func (n *Node) handleCheck(c *fiber.Ctx) error {
 	start := time.Now()
 	ipStr := c.Params("ip")
 
-	// Parse IP
-	addr, err := netip.ParseAddr(ipStr)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid IP address",
-			"ip":    ipStr,
-		})
+	addr, msg := parseTargetIP(ipStr, n.checkOpts)
+	if msg != "" {
+		return middleware.WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeInvalidIP, msg, fiber.Map{"ip": ipStr})
 	}
 
 	// Perform lookup
+	result, err := n.lookup(addr)
+	if errors.Is(err, ErrReputationUnavailable) {
+		return reputationUnavailable(c)
+	}
+	if err != nil {
+		n.log.Error(fmt.Sprintf("Lookup error for %s: %v", ipStr, err))
+		return middleware.WriteErrorDetails(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Lookup failed", fiber.Map{"ip": ipStr})
+	}
+
+	// Add query time
+	result.QueryTime = float64(time.Since(start).Microseconds()) / 1000.0 // Convert to ms
+
+	n.lookupCount.Add(1)
+
+	return c.JSON(result)
+}
+
+// handleBatchCheck handles batch IP check requests. Like the API's batch endpoint
+// it is MMDB-only; unparseable IPs get risk level "error" and non-public IPs "invalid".
+func (n *Node) handleBatchCheck(c *fiber.Ctx) error {
+	start := time.Now()
+
+	var req models.BatchCheckRequest
+	if err := c.BodyParser(&req); err != nil {
+		return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body")
+	}
+
+	if len(req.IPs) == 0 {
+		return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "At least one IP address is required")
+	}
+
+	maxSize := n.config.Judge.MaxBatchSize()
+	if len(req.IPs) > maxSize {
+		return middleware.WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeTooManyIPs, "Exceeded maximum batch size", fiber.Map{"max": maxSize})
+	}
+
+	if !n.reputationLoaded() {
+		return reputationUnavailable(c)
+	}
+
+	results := make([]models.IPCheckResult, 0, len(req.IPs))
+
+	for _, ipStr := range req.IPs {
+		ipStart := time.Now()
+
+		addr, err := iputil.ParseIP(ipStr)
+		if err != nil {
+			results = append(results, models.IPCheckResult{IP: ipStr, Score: -1, RiskLevel: "error"})
+			continue
+		}
+
+		addr = iputil.NormalizeIP(addr)
+		if !iputil.IsValidFor(addr, n.checkOpts) {
+			results = append(results, models.IPCheckResult{IP: ipStr, Score: -1, RiskLevel: "invalid"})
+			continue
+		}
+
+		result, err := n.lookup(addr)
+		if err != nil {
+			n.log.Error(fmt.Sprintf("Lookup error for %s: %v", ipStr, err))
+			results = append(results, models.IPCheckResult{IP: ipStr, Score: -1, RiskLevel: "error"})
+			continue
+		}
+
+		result.QueryTime = float64(time.Since(ipStart).Microseconds()) / 1000.0
+		results = append(results, *result)
+		n.lookupCount.Add(1)
+	}
+
+	return c.JSON(models.BatchCheckResponse{
+		Results:    results,
+		TotalTime:  float64(time.Since(start).Microseconds()) / 1000.0,
+		TotalCount: len(results),
+	})
+}
+
+// lookup performs an MMDB lookup, returning a clean result for unknown IPs.
+// A failed lookup also answers clean under the open fail policy and returns
+// ErrReputationUnavailable under the closed one.
+func (n *Node) lookup(addr netip.Addr) (*models.IPCheckResult, error) {
 	n.mu.RLock()
-	result, err := n.mmdbReader.LookupAll(addr)
+	if n.mmdbReader == nil || (n.repIndex != nil && !n.repIndex.Loaded()) {
+		n.mu.RUnlock()
+		return nil, ErrReputationUnavailable
+	}
+	var provider mmdb.LookupProvider = n.mmdbReader
+	if n.repIndex != nil {
+		provider = n.mmdbReader.WithReputation(n.repIndex)
+	}
+	result, err := provider.LookupAll(addr)
 	n.mu.RUnlock()
 
 	if err != nil {
-		logger.Error(fmt.Sprintf("Lookup error for %s: %v", ipStr, err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Lookup failed",
-			"ip":    ipStr,
-		})
+		if n.config.Lookup.FailClosed() {
+			return nil, fmt.Errorf("%w: %v", ErrReputationUnavailable, err)
+		}
+		n.log.Debug(fmt.Sprintf("Lookup error for %s: %v", addr, err))
+		result = nil
 	}
 
 	// Ensure we have a result
 	if result == nil {
 		result = &models.IPCheckResult{
-			IP:        ipStr,
+			IP:        addr.String(),
 			Score:     0,
 			RiskScore: 0,
 			RiskLevel: "clean",
 		}
 	}
 
-	// Add query time
-	result.QueryTime = float64(time.Since(start).Microseconds()) / 1000.0 // Convert to ms
-
-	// Increment counter (atomic would be better but this is simple)
-	n.lookupCount++
+	// The compiled scores ignore ASN data; fold in the ASN type now
+	n.asnTypes.Enrich(context.Background(), result.ASN)
+	n.scorer.ApplyASN(result)
 
-	return c.JSON(result)
+	return result, nil
 }
 
 // handleHealth handles health check requests
@@ -178,36 +474,48 @@ func (n *Node) handleHealth(c *fiber.Ctx) error {
 
 // handleStats handles statistics requests
 func (n *Node) handleStats(c *fiber.Ctx) error {
+	var mmdbStats map[string]interface{}
 	n.mu.RLock()
-	mmdbStats := n.mmdbReader.Stats()
+	if n.mmdbReader != nil {
+		mmdbStats = n.mmdbReader.Stats()
+	}
 	n.mu.RUnlock()
 
+	var indexStats fiber.Map
+	if n.repIndex != nil {
+		indexStats = fiber.Map{"loaded": n.repIndex.Loaded(), "prefixes": n.repIndex.Len()}
+	}
+
+	lookups, scans, nodeWide := n.counts(c.UserContext())
+	scope := "node"
+	if !nodeWide {
+		scope = "worker" // Prefork without a shared store: this process only
+	}
+
 	return c.JSON(fiber.Map{
-		"uptime":       time.Since(n.startTime).String(),
-		"lookup_count": n.lookupCount,
-		"scan_count":   n.scanCount,
-		"mmdb":         mmdbStats,
+		"uptime":        time.Since(n.startTime).String(),
+		"lookup_count":  lookups,
+		"scan_count":    scans,
+		"counter_scope": scope,
+		"reputation":    n.reputationLoaded(),
+		"mmdb":          mmdbStats,
+		"index":         indexStats,
 	})
 }
 
 // handleReload handles MMDB reload requests
 func (n *Node) handleReload(c *fiber.Ctx) error {
-	logger.Info("Reload request received")
+	n.log.Info("Reload request received")
 
-	n.mu.Lock()
-	err := n.mmdbReader.Reload(
-		n.config.MMDB.ReputationPath,
-		n.config.MMDB.GeoLite2CityPath,
-		n.config.MMDB.GeoLite2ASNPath,
-	)
-	n.mu.Unlock()
-
-	if err != nil {
-		logger.Error(fmt.Sprintf("Reload failed: %v", err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":  "Reload failed",
-			"detail": err.Error(),
-		})
+	if err := n.reloadMMDB(); err != nil {
+		n.log.Error(fmt.Sprintf("Reload failed: %v", err))
+		return middleware.WriteErrorDetails(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Reload failed", err.Error())
+	}
+	if n.repIndex != nil {
+		if err := n.reloadIndex(c.UserContext()); err != nil {
+			n.log.Error(fmt.Sprintf("Reputation index reload failed: %v", err))
+			return middleware.WriteErrorDetails(c, fiber.StatusInternalServerError, models.ErrCodeInternal, "Reload failed", err.Error())
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -216,48 +524,218 @@ func (n *Node) handleReload(c *fiber.Ctx) error {
 	})
 }
 
-// handleScan performs active proxy scan on an IP
+// handleScan performs active proxy scan on an IP. ?udp=true adds the UDP probes
+// and ?verify=true checks that detected proxies actually relay traffic. A
+// result from the last judge.scan_cache_ttl is reused unless ?force=true.
 func (n *Node) handleScan(c *fiber.Ctx) error {
+	return n.serveScan(c, "scan", 30*time.Second, n.scanner.Scan)
+}
+
+// handleQuickScan performs quick proxy scan on an IP; it takes the same query
+// options as handleScan
+func (n *Node) handleQuickScan(c *fiber.Ctx) error {
+	return n.serveScan(c, "quickscan", 10*time.Second, n.scanner.QuickScan)
+}
+
+// serveScan answers a single-IP scan request of the given kind, from the
+// scan cache when possible
+func (n *Node) serveScan(c *fiber.Ctx, kind string, timeout time.Duration, scan func(context.Context, string) *ScanResult) error {
 	ipStr := c.Params("ip")
 
-	// Validate IP
-	if !parseIP(ipStr).IsValid() {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid IP address",
-			"ip":    ipStr,
-		})
+	addr, msg := parseScanTarget(ipStr)
+	if msg != "" {
+		return middleware.WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeInvalidIP, msg, fiber.Map{"ip": ipStr})
+	}
+	target := addr.String()
+	udp, verify := c.QueryBool("udp"), c.QueryBool("verify")
+
+	key := scanCacheKey(kind, target, udp, verify)
+	if !c.QueryBool("force") {
+		if cached := n.cachedScan(c.Context(), key); cached != nil {
+			return c.JSON(cached)
+		}
 	}
 
-	// Perform scan
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	n.scans.Add(1)
+	defer n.scans.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	result := n.scanner.Scan(ctx, ipStr)
-	n.scanCount++
+	result := scan(ctx, target)
+	if udp {
+		result.OpenUDPPorts = n.scanner.ScanUDP(ctx, target)
+	}
+	if verify {
+		result.Verified = n.scanner.VerifyProxies(ctx, result)
+	}
+	n.scanCount.Add(1)
+	n.storeScan(c.Context(), key, result)
 
 	return c.JSON(result)
 }
 
-// handleQuickScan performs quick proxy scan on an IP
-func (n *Node) handleQuickScan(c *fiber.Ctx) error {
-	ipStr := c.Params("ip")
+// handleInspect inspects the request's own headers for proxy leaks. The client
+// IP defaults to the one resolved through server.trusted_proxies; callers
+// behind a proxy can pass their real IP as ?ip= to detect transparent proxies
+// that forward it.
+func (n *Node) handleInspect(c *fiber.Ctx) error {
+	clientIP := c.Query("ip")
+	if clientIP == "" {
+		clientIP = middleware.ClientIP(c)
+	}
+	if !parseIP(clientIP).IsValid() {
+		return middleware.WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeInvalidIP, "Invalid IP address", fiber.Map{"ip": clientIP})
+	}
+
+	return c.JSON(n.scanner.InspectHeaders(c.GetReqHeaders(), clientIP))
+}
+
+// handleHeaders echoes the request headers as {"headers": {...}}, the format
+// the scanner expects from judge.echo_url
+func (n *Node) handleHeaders(c *fiber.Ctx) error {
+	headers := make(map[string]string)
+	for name, values := range c.GetReqHeaders() {
+		headers[name] = strings.Join(values, ", ")
+	}
+	return c.JSON(fiber.Map{"headers": headers})
+}
+
+// BatchScanRequest is the body of POST /scan/batch
+type BatchScanRequest struct {
+	IPs []string `json:"ips"`
+}
+
+// handleBatchScan actively scans a list of IPs using the scanner's worker pool.
+// The whole batch shares one timeout (judge.scan_batch_timeout).
+func (n *Node) handleBatchScan(c *fiber.Ctx) error {
+	start := time.Now()
+
+	var req BatchScanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body")
+	}
+
+	if len(req.IPs) == 0 {
+		return middleware.WriteError(c, fiber.StatusBadRequest, models.ErrCodeInvalidRequest, "At least one IP address is required")
+	}
+
+	maxSize := n.config.Judge.MaxScanBatchSize()
+	if len(req.IPs) > maxSize {
+		return middleware.WriteErrorDetails(c, fiber.StatusBadRequest, models.ErrCodeTooManyIPs, "Exceeded maximum batch size", fiber.Map{"max": maxSize})
+	}
+
+	// Only valid IPs are handed to the scanner; invalid ones get an error result
+	results := make([]*ScanResult, len(req.IPs))
+	var valid []string
+	var validIdx []int
+	for i, ip := range req.IPs {
+		addr, msg := parseScanTarget(ip)
+		if msg != "" {
+			results[i] = &ScanResult{
+				IP:         ip,
+				OpenPorts:  []int{},
+				ProxyPorts: []int{},
+				Error:      msg,
+			}
+			continue
+		}
+		valid = append(valid, addr.String())
+		validIdx = append(validIdx, i)
+	}
+
+	if len(valid) > 0 && !n.takeScans(c, len(valid)) {
+		return scanRateLimited(c)
+	}
+
+	if len(valid) > 0 {
+		n.scans.Add(1)
+		defer n.scans.Done()
 
-	// Validate IP
-	if !parseIP(ipStr).IsValid() {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid IP address",
-			"ip":    ipStr,
-		})
+		ctx, cancel := context.WithTimeout(context.Background(), n.config.Judge.ScanBatchTimeout)
+		scanned := n.scanner.BatchScan(ctx, valid)
+		cancel()
+
+		for i, result := range scanned {
+			results[validIdx[i]] = result
+		}
+		n.scanCount.Add(uint64(len(scanned)))
+
+		if n.scanLogger != nil {
+			n.scans.Add(1)
+			go n.logScans(scanned)
+		}
 	}
 
-	// Perform quick scan
+	return c.JSON(fiber.Map{
+		"results":       results,
+		"total_count":   len(results),
+		"total_time_ms": float64(time.Since(start).Microseconds()) / 1000.0,
+	})
+}
+
+// logScans sends scan results to the scan logger
+func (n *Node) logScans(results []*ScanResult) {
+	defer n.scans.Done()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result := n.scanner.QuickScan(ctx, ipStr)
-	n.scanCount++
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		if err := n.scanLogger.LogScanResult(ctx, scanResultLog(result)); err != nil {
+			n.log.Warn(fmt.Sprintf("Failed to log scan result for %s: %v", result.IP, err))
+		}
+	}
+}
 
-	return c.JSON(result)
+// scanResultLog converts a scan result to its analytics log entry
+func scanResultLog(r *ScanResult) analytics.ScanResultLog {
+	return analytics.ScanResultLog{
+		Timestamp:     time.Now(),
+		IP:            r.IP,
+		IsProxy:       r.IsProxy,
+		IsSOCKS4:      r.IsSOCKS4,
+		IsSOCKS5:      r.IsSOCKS5,
+		IsHTTPProxy:   r.IsHTTPProxy,
+		IsHTTPConnect: r.IsHTTPConnect,
+		OpenPorts:     toUint16(r.OpenPorts),
+		ProxyPorts:    toUint16(r.ProxyPorts),
+		ScanTimeMs:    float32(r.ScanTime),
+	}
+}
+
+// toUint16 converts port numbers for ClickHouse Array(UInt16) columns
+func toUint16(ports []int) []uint16 {
+	out := make([]uint16, len(ports))
+	for i, p := range ports {
+		out[i] = uint16(p)
+	}
+	return out
+}
+
+// parseTargetIP parses an IP to look up or scan, unmapping IPv4-mapped IPv6
+// addresses so both forms behave the same. It returns the 400 error message
+// when the IP is unparseable or excluded by opts (private, loopback, etc.).
+func parseTargetIP(ipStr string, opts iputil.CheckOptions) (netip.Addr, string) {
+	addr, err := iputil.ParseIP(ipStr)
+	if err != nil {
+		return netip.Addr{}, "Invalid IP address"
+	}
+	addr = iputil.NormalizeIP(addr)
+	if !iputil.IsValidFor(addr, opts) {
+		return netip.Addr{}, "IP address is not suitable for checking (private, loopback, etc.)"
+	}
+	return addr, ""
+}
+
+// parseScanTarget parses an IP to be port scanned. Scans always use the
+// strict policy, whatever judge.ip_policy allows for checks, so the node
+// cannot be used to probe internal hosts.
+func parseScanTarget(ipStr string) (netip.Addr, string) {
+	return parseTargetIP(ipStr, iputil.CheckOptions{})
 }
 
 // parseIP helper to validate IP address
@@ -269,6 +747,88 @@ func parseIP(ip string) netip.Addr {
 	return addr
 }
 
+// ErrReputationUnavailable is returned by lookups while no reputation MMDB is loaded
+var ErrReputationUnavailable = errors.New("reputation database unavailable")
+
+// openReader opens the MMDB databases named in the config
+func openReader(cfg *config.Config) (*mmdb.Reader, error) {
+	reader, err := mmdb.NewReader(
+		reputationPath(cfg),
+		cfg.MMDB.GeoLite2CityPath,
+		cfg.MMDB.GeoLite2ASNPath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MMDB reader: %w", err)
+	}
+	if cfg.MMDB.AnonymousIPPath != "" {
+		if err := reader.LoadAnonymousIP(cfg.MMDB.AnonymousIPPath); err != nil {
+			logger.Warn(err.Error())
+		}
+	}
+	if cfg.MMDB.FlaggedFilter && !cfg.Judge.UsesIndex() {
+		if err := reader.EnableFlaggedFilter(cfg.MMDB.FlaggedFilterFPRate); err != nil {
+			logger.Warn(err.Error())
+		}
+	}
+	return reader, nil
+}
+
+// reloadMMDB reloads the MMDB databases, opening them if the node started
+// without a reputation database
+func (n *Node) reloadMMDB() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.mmdbReader == nil {
+		reader, err := openReader(n.config)
+		if err != nil {
+			return err
+		}
+		n.mmdbReader = reader
+		n.log.Info("Reputation MMDB loaded; checks are available")
+		return nil
+	}
+
+	return n.mmdbReader.Reload(
+		reputationPath(n.config),
+		n.config.MMDB.GeoLite2CityPath,
+		n.config.MMDB.GeoLite2ASNPath,
+	)
+}
+
+// reputationPath is the reputation MMDB the reader opens; none when the
+// in-memory index serves reputation
+func reputationPath(cfg *config.Config) string {
+	if cfg.Judge.UsesIndex() {
+		return ""
+	}
+	return cfg.MMDB.ReputationPath
+}
+
+// reloadIndex rebuilds the reputation index. Lookups keep using the current
+// one meanwhile, so n.mu is not held.
+func (n *Node) reloadIndex(ctx context.Context) error {
+	start := time.Now()
+	prefixes, err := n.repIndex.Reload(ctx)
+	if err != nil {
+		return err
+	}
+	n.log.Info(fmt.Sprintf("Reputation index loaded: %d prefixes in %v", prefixes, time.Since(start)))
+	return nil
+}
+
+// reputationLoaded reports whether reputation data is available for checks
+func (n *Node) reputationLoaded() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.mmdbReader != nil && (n.repIndex == nil || n.repIndex.Loaded())
+}
+
+// reputationUnavailable answers a check made while no reputation MMDB is loaded
+func reputationUnavailable(c *fiber.Ctx) error {
+	return middleware.WriteError(c, fiber.StatusServiceUnavailable, models.ErrCodeServiceUnavailable, "Reputation database unavailable; active scans still work")
+}
+
 // reloadLoop periodically reloads MMDB databases
 func (n *Node) reloadLoop(ctx context.Context) {
 	ticker := time.NewTicker(n.config.MMDB.ReloadInterval)
@@ -279,18 +839,51 @@ func (n *Node) reloadLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			n.mu.Lock()
-			err := n.mmdbReader.Reload(
-				n.config.MMDB.ReputationPath,
-				n.config.MMDB.GeoLite2CityPath,
-				n.config.MMDB.GeoLite2ASNPath,
-			)
-			n.mu.Unlock()
+			if err := n.reloadMMDB(); err != nil {
+				n.log.Error(fmt.Sprintf("Periodic reload failed: %v", err))
+			} else {
+				n.log.Debug("MMDB databases reloaded successfully")
+			}
+		}
+	}
+}
+
+// indexRefreshLoop periodically rebuilds the reputation index
+func (n *Node) indexRefreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(n.config.Judge.IndexRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := n.reloadIndex(ctx); err != nil {
+				n.log.Error(fmt.Sprintf("Periodic reputation index reload failed: %v", err))
+			}
+		}
+	}
+}
+
+// externalIPLoop periodically re-detects the node's external IP
+func (n *Node) externalIPLoop(ctx context.Context) {
+	ticker := time.NewTicker(n.config.Judge.ExternalIPRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			previous := n.scanner.ExternalIP()
+			refreshCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+			ip, err := n.scanner.RefreshExternalIP(refreshCtx)
+			cancel()
 
 			if err != nil {
-				logger.Error(fmt.Sprintf("Periodic reload failed: %v", err))
-			} else {
-				logger.Debug("MMDB databases reloaded successfully")
+				n.log.Warn(fmt.Sprintf("External IP refresh failed: %v (keeping %q)", err, previous))
+			} else if ip != previous {
+				n.log.Info(fmt.Sprintf("External IP changed: %s -> %s", previous, ip))
 			}
 		}
 	}
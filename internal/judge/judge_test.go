@@ -0,0 +1,764 @@
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/mmdb"
+	"github.com/lfrfrfr/beon-ipquality/pkg/iputil"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// newTestNode builds a node backed by a reputation MMDB listing 185.220.101.0/24
+func newTestNode(t *testing.T, batchMaxSize int) *Node {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	err := mmdb.NewDefaultWriter().CompileToMMDB([]mmdb.ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("185.220.101.0/24"),
+		RiskScore:  90,
+		RiskLevel:  "critical",
+		ThreatType: "botnet",
+		Sources:    []string{"feodo"},
+		Flags:      mmdb.EntryFlags{IsBotnet: true},
+		LastUpdate: time.Now(),
+	}}, path)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+
+	reader, err := mmdb.NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+
+	cfg := &config.Config{Judge: config.JudgeConfig{BatchMaxSize: batchMaxSize}}
+	node := &Node{
+		config:     cfg,
+		app:        fiber.New(fiber.Config{BodyLimit: bodyLimit(cfg.Judge.MaxBatchSize())}),
+		mmdbReader: reader,
+		startTime:  time.Now(),
+	}
+	node.setupRoutes()
+	return node
+}
+
+func postBatch(t *testing.T, node *Node, ips []string) *http.Response {
+	t.Helper()
+
+	body, _ := json.Marshal(models.BatchCheckRequest{IPs: ips})
+	req := httptest.NewRequest("POST", "/check/batch", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := node.app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	return resp
+}
+
+func TestHandleBatchCheck(t *testing.T) {
+	node := newTestNode(t, 10)
+
+	ips := []string{"185.220.101.7", "8.8.8.8", "10.0.0.1", "not-an-ip"}
+	resp := postBatch(t, node, ips)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	var got models.BatchCheckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if got.TotalCount != len(ips) || len(got.Results) != len(ips) {
+		t.Fatalf("count = %d (%d results), want %d", got.TotalCount, len(got.Results), len(ips))
+	}
+
+	tests := []struct {
+		ip        string
+		score     int
+		riskLevel string
+	}{
+		{"185.220.101.7", 90, "critical"},
+		{"8.8.8.8", 0, "clean"},
+		{"10.0.0.1", -1, "invalid"},
+		{"not-an-ip", -1, "error"},
+	}
+
+	for i, tt := range tests {
+		r := got.Results[i]
+		if r.IP != tt.ip || r.Score != tt.score || r.RiskLevel != tt.riskLevel {
+			t.Errorf("result[%d] = {%s %d %s}, want {%s %d %s}",
+				i, r.IP, r.Score, r.RiskLevel, tt.ip, tt.score, tt.riskLevel)
+		}
+	}
+	if !got.Results[0].IsBotnet {
+		t.Errorf("result[0].IsBotnet = false, want true")
+	}
+}
+
+func TestHandleBatchCheckLimits(t *testing.T) {
+	node := newTestNode(t, 2)
+
+	tests := []struct {
+		name string
+		ips  []string
+		want int
+	}{
+		{"empty", []string{}, fiber.StatusBadRequest},
+		{"at limit", []string{"8.8.8.8", "1.1.1.1"}, fiber.StatusOK},
+		{"over limit", []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"}, fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := postBatch(t, node, tt.ips); resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleBatchCheckDefaultLimit(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		node := newTestNode(t, size)
+
+		ips := make([]string, config.DefaultJudgeBatchMaxSize+1)
+		for i := range ips {
+			ips[i] = fmt.Sprintf("8.8.%d.%d", i/256, i%256)
+		}
+		if resp := postBatch(t, node, ips[:config.DefaultJudgeBatchMaxSize]); resp.StatusCode != fiber.StatusOK {
+			t.Errorf("batch_max_size %d: full default batch status = %d, want 200", size, resp.StatusCode)
+		}
+		if resp := postBatch(t, node, ips); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("batch_max_size %d: oversized batch status = %d, want 400", size, resp.StatusCode)
+		}
+	}
+}
+
+// recordingScanLogger collects logged scan results
+type recordingScanLogger struct {
+	logged chan analytics.ScanResultLog
+}
+
+func (r *recordingScanLogger) LogScanResult(ctx context.Context, log analytics.ScanResultLog) error {
+	r.logged <- log
+	return nil
+}
+
+func TestHandleBatchScan(t *testing.T) {
+	scanner := NewScanner(ScannerConfig{Timeout: time.Second, MaxWorkers: 2})
+	scanner.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	cfg := &config.Config{Judge: config.JudgeConfig{ScanBatchMaxSize: 3, ScanBatchTimeout: 5 * time.Second}}
+	node := &Node{config: cfg, app: fiber.New(), scanner: scanner, startTime: time.Now()}
+	node.setupRoutes()
+
+	scanLog := &recordingScanLogger{logged: make(chan analytics.ScanResultLog, 3)}
+	node.SetScanLogger(scanLog)
+
+	post := func(ips []string) *http.Response {
+		body, _ := json.Marshal(BatchScanRequest{IPs: ips})
+		req := httptest.NewRequest("POST", "/scan/batch", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := node.app.Test(req, 10000)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		return resp
+	}
+
+	resp := post([]string{"192.0.2.10", "not-an-ip", "198.51.100.20"})
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	var got struct {
+		Results    []ScanResult `json:"results"`
+		TotalCount int          `json:"total_count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if got.TotalCount != 3 || len(got.Results) != 3 {
+		t.Fatalf("count = %d (%d results), want 3", got.TotalCount, len(got.Results))
+	}
+	for i, want := range []struct {
+		ip      string
+		invalid bool
+	}{{"192.0.2.10", false}, {"not-an-ip", true}, {"198.51.100.20", false}} {
+		r := got.Results[i]
+		if r.IP != want.ip || (r.Error == "Invalid IP address") != want.invalid || r.IsProxy {
+			t.Errorf("result[%d] = %+v, want ip %s invalid=%v", i, r, want.ip, want.invalid)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-scanLog.logged:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 2 logged scans, got %d", i)
+		}
+	}
+
+	if resp := post([]string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("over limit status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestHandleInspect(t *testing.T) {
+	node := &Node{
+		config:    &config.Config{},
+		app:       fiber.New(),
+		scanner:   NewScanner(ScannerConfig{ExternalIP: "203.0.113.50"}),
+		startTime: time.Now(),
+	}
+	node.setupRoutes()
+
+	tests := []struct {
+		name            string
+		method          string
+		target          string
+		headers         map[string]string
+		wantStatus      int
+		wantTransparent bool
+		wantAnonymous   bool
+		wantElite       bool
+	}{
+		{"no proxy headers", "GET", "/inspect", nil, 200, false, false, true},
+		{"anonymous proxy", "POST", "/inspect", map[string]string{"Via": "1.1 squid"}, 200, false, true, false},
+		{"leaks real IP", "GET", "/inspect?ip=198.51.100.9", map[string]string{"X-Forwarded-For": "198.51.100.9"}, 200, true, false, false},
+		{"leaks judge IP", "GET", "/inspect", map[string]string{"X-Real-IP": "203.0.113.50"}, 200, true, false, false},
+		{"invalid ip", "GET", "/inspect?ip=nope", nil, 400, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := node.app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != fiber.StatusOK {
+				return
+			}
+
+			var got HeaderResult
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.IsTransparent != tt.wantTransparent || got.IsAnonymous != tt.wantAnonymous || got.IsElite != tt.wantElite {
+				t.Errorf("transparent/anonymous/elite = %v/%v/%v, want %v/%v/%v",
+					got.IsTransparent, got.IsAnonymous, got.IsElite, tt.wantTransparent, tt.wantAnonymous, tt.wantElite)
+			}
+		})
+	}
+}
+
+func TestHandleInspectBehindTrustedProxy(t *testing.T) {
+	// app.Test connects from 0.0.0.0, which stands in for the load balancer
+	resolver, err := middleware.NewClientIPResolver("X-Forwarded-For", []string{"0.0.0.0/32"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver: %v", err)
+	}
+	middleware.SetClientIPResolver(resolver)
+	t.Cleanup(func() { middleware.SetClientIPResolver(nil) })
+
+	node := &Node{
+		config:    &config.Config{},
+		app:       fiber.New(),
+		scanner:   NewScanner(ScannerConfig{ExternalIP: "203.0.113.50"}),
+		startTime: time.Now(),
+	}
+	node.setupRoutes()
+
+	req := httptest.NewRequest("GET", "/inspect", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.9")
+	resp, err := node.app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+
+	var got HeaderResult
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !got.IsTransparent {
+		t.Errorf("forwarded client IP not detected: %+v", got)
+	}
+}
+
+func TestScanRateLimit(t *testing.T) {
+	scanner := NewScanner(ScannerConfig{Timeout: time.Second})
+	scanner.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	node := newTestNode(t, 10)
+	node.config.Judge.ScanBatchMaxSize = 5
+	node.config.Judge.ScanBatchTimeout = 5 * time.Second
+	node.quota = newScanQuota(3)
+	node.quota.now = func() time.Time { return time.Unix(1700000000, 0) }
+	node.app = fiber.New()
+	node.scanner = scanner
+	node.setupRoutes()
+
+	send := func(method, target, body, apiKey string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := node.app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		apiKey string
+		want   int
+	}{
+		{"GET", "/scan/192.0.2.10", "", "", fiber.StatusOK},
+		{"POST", "/scan/batch", `{"ips": ["192.0.2.11", "192.0.2.12", "192.0.2.13"]}`, "", fiber.StatusTooManyRequests}, // charged per IP
+		{"GET", "/scan/192.0.2.10/quick", "", "", fiber.StatusOK},
+		{"POST", "/scan/batch", `{"ips": ["192.0.2.11", "not-an-ip"]}`, "", fiber.StatusOK}, // invalid IPs are not scanned
+		{"GET", "/scan/192.0.2.10", "", "key-a", fiber.StatusTooManyRequests},               // API keys do not get their own bucket
+		{"GET", "/check/185.220.101.7", "", "", fiber.StatusOK},                             // lookups are not scan limited
+		{"GET", "/check/185.220.101.7", "", "", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if got := send(tt.method, tt.target, tt.body, tt.apiKey); got != tt.want {
+			t.Errorf("%s %s %s (key %q) = %d, want %d", tt.method, tt.target, tt.body, tt.apiKey, got, tt.want)
+		}
+	}
+}
+
+func TestShutdownDrainsScans(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	scanner := NewScanner(ScannerConfig{Timeout: 5 * time.Second, MaxWorkers: 1})
+	scanner.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil, errors.New("connection refused")
+	}
+
+	node := &Node{config: &config.Config{}, app: fiber.New(), scanner: scanner, startTime: time.Now()}
+	node.setupRoutes()
+
+	scanDone := make(chan int, 1)
+	go func() {
+		resp, err := node.app.Test(httptest.NewRequest("GET", "/scan/192.0.2.10/quick", nil), -1)
+		if err != nil {
+			scanDone <- 0
+			return
+		}
+		scanDone <- resp.StatusCode
+	}()
+	<-started
+
+	// A short deadline gives up on the scan
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := node.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with short deadline = %v, want deadline exceeded", err)
+	}
+
+	// Otherwise shutdown waits until the scan completes
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- node.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("Shutdown returned %v before the scan finished", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if status := <-scanDone; status != fiber.StatusOK {
+		t.Errorf("scan status = %d, want 200", status)
+	}
+	select {
+	case err := <-shutdownDone:
+		if err != nil {
+			t.Errorf("Shutdown = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the scan finished")
+	}
+}
+
+func TestConcurrentCheckCounts(t *testing.T) {
+	node := newTestNode(t, 10)
+
+	const requests = 50
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := node.app.Test(httptest.NewRequest("GET", "/check/185.220.101.7", nil))
+			if err != nil {
+				t.Errorf("app.Test: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	resp, err := node.app.Test(httptest.NewRequest("GET", "/stats", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	var stats struct {
+		LookupCount uint64 `json:"lookup_count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if stats.LookupCount != requests {
+		t.Errorf("lookup_count = %d, want %d", stats.LookupCount, requests)
+	}
+}
+
+func TestTargetIPNormalization(t *testing.T) {
+	scanner := NewScanner(ScannerConfig{Timeout: time.Second})
+	scanner.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	node := newTestNode(t, 10)
+	node.scanner = scanner
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantIP     string
+	}{
+		{"/check/185.220.101.7", fiber.StatusOK, "185.220.101.7"},
+		{"/check/::ffff:185.220.101.7", fiber.StatusOK, "185.220.101.7"},
+		{"/check/10.0.0.1", fiber.StatusBadRequest, ""},
+		{"/check/::1", fiber.StatusBadRequest, ""},
+		{"/check/::ffff:192.168.1.1", fiber.StatusBadRequest, ""},
+		{"/scan/::ffff:192.0.2.10", fiber.StatusOK, "192.0.2.10"},
+		{"/scan/127.0.0.1", fiber.StatusBadRequest, ""},
+		{"/scan/::ffff:192.0.2.10/quick", fiber.StatusOK, "192.0.2.10"},
+		{"/scan/192.168.0.1/quick", fiber.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			resp, err := node.app.Test(httptest.NewRequest("GET", tt.target, nil), 5000)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantIP == "" {
+				return
+			}
+
+			var got struct {
+				IP    string `json:"ip"`
+				Score int    `json:"score"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.IP != tt.wantIP {
+				t.Errorf("ip = %q, want %q", got.IP, tt.wantIP)
+			}
+			if strings.HasPrefix(tt.target, "/check/") && got.Score != 90 {
+				t.Errorf("score = %d, want 90 for both address forms", got.Score)
+			}
+		})
+	}
+}
+
+func TestHandleHeaders(t *testing.T) {
+	node := &Node{config: &config.Config{}, app: fiber.New(), startTime: time.Now()}
+	node.setupRoutes()
+
+	req := httptest.NewRequest("GET", "/headers", nil)
+	req.Header.Set("Via", "1.1 squid")
+	resp, err := node.app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+
+	var got struct {
+		Headers map[string]string `json:"headers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Headers["Via"] != "1.1 squid" {
+		t.Errorf("headers = %v, want Via echoed", got.Headers)
+	}
+}
+
+func TestChecksWaitForReputationMMDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	cfg := &config.Config{Judge: config.JudgeConfig{BatchMaxSize: 10}}
+	cfg.MMDB.ReputationPath = path
+
+	// No MMDB compiled yet: the node starts without a reader
+	node := &Node{
+		config:    cfg,
+		app:       fiber.New(),
+		scanner:   NewScanner(ScannerConfig{Timeout: time.Second}),
+		startTime: time.Now(),
+	}
+	node.setupRoutes()
+	t.Cleanup(func() { node.Shutdown(context.Background()) })
+
+	status := func(req *http.Request) int {
+		t.Helper()
+		resp, err := node.app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status(httptest.NewRequest("GET", "/check/185.220.101.7", nil)); got != fiber.StatusServiceUnavailable {
+		t.Errorf("GET /check without MMDB = %d, want 503", got)
+	}
+	batch := httptest.NewRequest("POST", "/check/batch", strings.NewReader(`{"ips":["185.220.101.7"]}`))
+	batch.Header.Set("Content-Type", "application/json")
+	if got := status(batch); got != fiber.StatusServiceUnavailable {
+		t.Errorf("POST /check/batch without MMDB = %d, want 503", got)
+	}
+	if got := status(httptest.NewRequest("GET", "/stats", nil)); got != fiber.StatusOK {
+		t.Errorf("GET /stats without MMDB = %d, want 200", got)
+	}
+	if got := status(httptest.NewRequest("POST", "/reload", nil)); got != fiber.StatusInternalServerError {
+		t.Errorf("POST /reload with nothing compiled = %d, want 500", got)
+	}
+
+	// The compiler delivers a database and notifies the node
+	err := mmdb.NewDefaultWriter().CompileToMMDB([]mmdb.ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("185.220.101.0/24"),
+		RiskScore:  90,
+		ThreatType: "botnet_c2",
+		LastUpdate: time.Now(),
+	}}, path)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+	if got := status(httptest.NewRequest("POST", "/reload", nil)); got != fiber.StatusOK {
+		t.Fatalf("POST /reload after compile = %d, want 200", got)
+	}
+
+	resp, err := node.app.Test(httptest.NewRequest("GET", "/check/185.220.101.7", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+	var result models.IPCheckResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK || result.RiskScore != 90 {
+		t.Errorf("GET /check after reload = %d with score %d, want 200 with score 90", resp.StatusCode, result.RiskScore)
+	}
+}
+
+func TestPermissiveIPPolicy(t *testing.T) {
+	node := newTestNode(t, 10)
+	node.checkOpts = iputil.CheckOptions{AllowPrivate: true}
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{"/check/10.0.0.1", fiber.StatusOK},
+		{"/check/::ffff:192.168.1.1", fiber.StatusOK},
+		{"/check/127.0.0.1", fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := node.app.Test(httptest.NewRequest("GET", tt.target, nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("GET %s = %d, want %d", tt.target, resp.StatusCode, tt.wantStatus)
+		}
+	}
+
+	resp := postBatch(t, node, []string{"10.0.0.1", "127.0.0.1"})
+	var got models.BatchCheckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Results) != 2 || got.Results[0].RiskLevel == "invalid" || got.Results[1].RiskLevel != "invalid" {
+		t.Errorf("batch results = %+v, want only 127.0.0.1 rejected", got.Results)
+	}
+
+	// Scans stay on public addresses
+	for _, target := range []string{"/scan/10.0.0.1", "/scan/10.0.0.1/quick"} {
+		resp, err := node.app.Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, resp.StatusCode)
+		}
+	}
+	if result := node.scanOne(context.Background(), ScanRequest{IP: "10.0.0.1"}, ""); result.Error == "" {
+		t.Error("gRPC scan of 10.0.0.1 was not rejected")
+	}
+}
+
+func TestHandleCheckFailPolicy(t *testing.T) {
+	// A reader without a reputation database fails every lookup
+	reader, err := mmdb.NewReader("", "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+
+	for policy, want := range map[string]int{"open": fiber.StatusOK, "closed": fiber.StatusServiceUnavailable} {
+		t.Run(policy, func(t *testing.T) {
+			node := &Node{
+				config:     &config.Config{Lookup: config.LookupConfig{FailPolicy: policy}},
+				app:        fiber.New(),
+				mmdbReader: reader,
+				startTime:  time.Now(),
+			}
+			node.setupRoutes()
+
+			resp, err := node.app.Test(httptest.NewRequest("GET", "/check/8.8.8.8", nil))
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			if resp.StatusCode != want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, want)
+			}
+			if want != fiber.StatusOK {
+				return
+			}
+			var got models.IPCheckResult
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.RiskLevel != "clean" {
+				t.Errorf("risk level = %q, want clean", got.RiskLevel)
+			}
+		})
+	}
+}
+
+// fakeIndex lists 45.155.205.0/24 once reloaded
+type fakeIndex struct {
+	loaded bool
+}
+
+func (f *fakeIndex) LookupReputation(ip netip.Addr) (*mmdb.ReputationRecord, error) {
+	if !f.loaded {
+		return nil, errors.New("not loaded")
+	}
+	if netip.MustParsePrefix("45.155.205.0/24").Contains(ip) {
+		return &mmdb.ReputationRecord{RiskScore: 75, RiskLevel: "high", ThreatType: "proxy", IsProxy: true}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeIndex) Reload(context.Context) (int, error) {
+	f.loaded = true
+	return 1, nil
+}
+
+func (f *fakeIndex) Loaded() bool { return f.loaded }
+func (f *fakeIndex) Len() int     { return 1 }
+
+func TestChecksFromReputationIndex(t *testing.T) {
+	// The reader carries no reputation database, as with reputation_backend index
+	reader, err := mmdb.NewReader("", "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	cfg := &config.Config{Judge: config.JudgeConfig{BatchMaxSize: 10, ReputationBackend: "index"}}
+	node := &Node{
+		config:     cfg,
+		app:        fiber.New(),
+		mmdbReader: reader,
+		startTime:  time.Now(),
+	}
+	node.SetReputationIndex(&fakeIndex{})
+	node.setupRoutes()
+	t.Cleanup(func() { node.Shutdown(context.Background()) })
+
+	check := func(ip string) (int, models.IPCheckResult) {
+		t.Helper()
+		resp, err := node.app.Test(httptest.NewRequest("GET", "/check/"+ip, nil))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		defer resp.Body.Close()
+		var result models.IPCheckResult
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	if status, _ := check("45.155.205.9"); status != fiber.StatusServiceUnavailable {
+		t.Errorf("GET /check before the index loads = %d, want 503", status)
+	}
+
+	resp, err := node.app.Test(httptest.NewRequest("POST", "/reload", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("POST /reload = %d, want 200", resp.StatusCode)
+	}
+
+	if status, result := check("45.155.205.9"); status != fiber.StatusOK || result.RiskScore != 75 || !result.IsProxy {
+		t.Errorf("GET /check listed = %d %+v, want 200 with score 75 and the proxy flag", status, result)
+	}
+	if status, result := check("8.8.8.8"); status != fiber.StatusOK || result.RiskLevel != "clean" {
+		t.Errorf("GET /check unlisted = %d %+v, want 200 clean", status, result)
+	}
+}
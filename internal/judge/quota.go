@@ -0,0 +1,43 @@
+package judge
+
+import (
+	"sync"
+	"time"
+)
+
+// scanQuota allows each client a number of scans per second. Counts are kept
+// for the current one-second window only, so idle clients cost nothing.
+type scanQuota struct {
+	limit int
+	now   func() time.Time // Replaced in tests
+
+	mu     sync.Mutex
+	window int64 // Unix second the counts belong to
+	counts map[string]int
+}
+
+// newScanQuota allows limit scans per second per client
+func newScanQuota(limit int) *scanQuota {
+	return &scanQuota{
+		limit:  limit,
+		now:    time.Now,
+		counts: make(map[string]int),
+	}
+}
+
+// take charges n scans to client and reports whether they fit in what is
+// left of the current window; rejected scans are not charged
+func (q *scanQuota) take(client string, n int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if window := q.now().Unix(); window != q.window {
+		q.window = window
+		clear(q.counts)
+	}
+	if q.counts[client]+n > q.limit {
+		return false
+	}
+	q.counts[client] += n
+	return true
+}
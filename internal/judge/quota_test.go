@@ -0,0 +1,30 @@
+package judge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanQuota(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	q := newScanQuota(3)
+	q.now = func() time.Time { return now }
+
+	if !q.take("a", 2) {
+		t.Fatal("take(a, 2) rejected within the limit")
+	}
+	if q.take("a", 2) {
+		t.Error("take(a, 2) allowed past the limit")
+	}
+	if !q.take("a", 1) {
+		t.Error("rejected scans were charged")
+	}
+	if !q.take("b", 3) {
+		t.Error("clients share a count")
+	}
+
+	now = now.Add(time.Second)
+	if !q.take("a", 3) {
+		t.Error("count not reset in the next window")
+	}
+}
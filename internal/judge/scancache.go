@@ -0,0 +1,173 @@
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ScanCache keeps recent single-IP scan results so repeated requests for the
+// same target are answered without probing it again. Get returns nil for a
+// miss.
+type ScanCache interface {
+	Get(ctx context.Context, key string) (*ScanResult, error)
+	Set(ctx context.Context, key string, result *ScanResult, ttl time.Duration) error
+}
+
+// SetScanCache replaces the node's scan cache, e.g. with a RedisScanCache so
+// prefork workers and other nodes share results
+func (n *Node) SetScanCache(c ScanCache) {
+	n.scanCache = c
+}
+
+// scanCacheKey identifies a scan of target by kind ("scan" or "quickscan")
+// and the options that change its result
+func scanCacheKey(kind, target string, udp, verify bool) string {
+	key := kind + ":" + target
+	if udp {
+		key += ":udp"
+	}
+	if verify {
+		key += ":verify"
+	}
+	return key
+}
+
+// cachedScan returns the cached result for key, marked as cached with its age,
+// or nil when caching is off or there is none
+func (n *Node) cachedScan(ctx context.Context, key string) *ScanResult {
+	if n.scanCache == nil || n.config.Judge.ScanCacheTTL <= 0 {
+		return nil
+	}
+	result, err := n.scanCache.Get(ctx, key)
+	if err != nil {
+		n.log.Warn(fmt.Sprintf("Failed to read scan cache: %v", err))
+		return nil
+	}
+	if result == nil {
+		return nil
+	}
+	result.Cached = true
+	result.Age = time.Since(result.ScannedAt).Round(time.Millisecond).Seconds()
+	return result
+}
+
+// storeScan caches a completed scan under key. Scans cut short by their
+// timeout are not cached, so the next request probes again.
+func (n *Node) storeScan(ctx context.Context, key string, result *ScanResult) {
+	if n.scanCache == nil || n.config.Judge.ScanCacheTTL <= 0 || result.Error != "" {
+		return
+	}
+	if err := n.scanCache.Set(ctx, key, result, n.config.Judge.ScanCacheTTL); err != nil {
+		n.log.Warn(fmt.Sprintf("Failed to write scan cache: %v", err))
+	}
+}
+
+// memoryScanCacheSize bounds the entries a MemoryScanCache holds
+const memoryScanCacheSize = 10000
+
+// MemoryScanCache is the per-process ScanCache used when Redis is not
+// configured
+type MemoryScanCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryScanEntry
+	now     func() time.Time
+}
+
+type memoryScanEntry struct {
+	result  ScanResult
+	expires time.Time
+}
+
+// NewMemoryScanCache creates an empty in-memory scan cache
+func NewMemoryScanCache() *MemoryScanCache {
+	return &MemoryScanCache{entries: make(map[string]memoryScanEntry), now: time.Now}
+}
+
+// Get returns a copy of the unexpired result for key
+func (c *MemoryScanCache) Get(ctx context.Context, key string) (*ScanResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, nil
+	}
+	result := entry.result
+	return &result, nil
+}
+
+// Set stores a copy of result for ttl. When the cache is full, expired
+// entries are dropped first and the result is not cached if none were.
+func (c *MemoryScanCache) Set(ctx context.Context, key string, result *ScanResult, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= memoryScanCacheSize {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= memoryScanCacheSize {
+			return nil
+		}
+	}
+	c.entries[key] = memoryScanEntry{result: *result, expires: now.Add(ttl)}
+	return nil
+}
+
+// RedisScanCache shares scan results through Redis
+type RedisScanCache struct {
+	client redis.UniversalClient
+}
+
+// redisScanCachePrefix namespaces the scan cache keys
+const redisScanCachePrefix = "judge:scan:"
+
+// NewRedisScanCache keeps the shared scan cache in Redis through client,
+// which it takes ownership of (see cache.NewClient)
+func NewRedisScanCache(client redis.UniversalClient) *RedisScanCache {
+	return &RedisScanCache{client: client}
+}
+
+// Get returns the cached result for key
+func (c *RedisScanCache) Get(ctx context.Context, key string) (*ScanResult, error) {
+	data, err := c.client.Get(ctx, redisScanCachePrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result ScanResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid cached scan %s: %w", key, err)
+	}
+	return &result, nil
+}
+
+// Set stores result for ttl
+func (c *RedisScanCache) Set(ctx context.Context, key string, result *ScanResult, ttl time.Duration) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, redisScanCachePrefix+key, data, ttl).Err()
+}
+
+// Close closes the Redis connection
+func (c *RedisScanCache) Close() error {
+	return c.client.Close()
+}
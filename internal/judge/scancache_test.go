@@ -0,0 +1,109 @@
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+)
+
+func TestHandleScanCache(t *testing.T) {
+	var dials atomic.Int64
+	scanner := NewScanner(ScannerConfig{Timeout: time.Second, MaxWorkers: 2})
+	scanner.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return nil, errors.New("connection refused")
+	}
+
+	cfg := &config.Config{Judge: config.JudgeConfig{ScanCacheTTL: time.Minute}}
+	node := &Node{config: cfg, app: fiber.New(), scanner: scanner, scanCache: NewMemoryScanCache(), startTime: time.Now()}
+	node.setupRoutes()
+
+	get := func(path string) ScanResult {
+		t.Helper()
+		resp, err := node.app.Test(httptest.NewRequest("GET", path, nil), 10000)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("GET %s status = %d, want 200", path, resp.StatusCode)
+		}
+		var got ScanResult
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+
+	first := get("/scan/192.0.2.10/quick")
+	if first.Cached || first.ScannedAt.IsZero() {
+		t.Fatalf("first scan cached=%v scanned_at=%v, want a fresh scan", first.Cached, first.ScannedAt)
+	}
+	probed := dials.Load()
+
+	second := get("/scan/192.0.2.10/quick")
+	if !second.Cached || !second.ScannedAt.Equal(first.ScannedAt) {
+		t.Errorf("repeat scan cached=%v scanned_at=%v, want the cached result from %v", second.Cached, second.ScannedAt, first.ScannedAt)
+	}
+	if dials.Load() != probed {
+		t.Errorf("repeat scan probed the target again")
+	}
+
+	// Other scan kinds and options are cached separately
+	if got := get("/scan/192.0.2.10/quick?udp=true"); got.Cached {
+		t.Errorf("scan with ?udp=true served the result of the plain scan")
+	}
+	probed = dials.Load()
+
+	if got := get("/scan/192.0.2.10/quick?force=true"); got.Cached {
+		t.Errorf("?force=true returned a cached result")
+	}
+	if dials.Load() == probed {
+		t.Errorf("?force=true did not probe the target")
+	}
+
+	cfg.Judge.ScanCacheTTL = 0
+	if got := get("/scan/192.0.2.10/quick"); got.Cached {
+		t.Errorf("scan_cache_ttl 0 returned a cached result")
+	}
+}
+
+func TestMemoryScanCache(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryScanCache()
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := cache.Set(ctx, "scan:192.0.2.10", &ScanResult{IP: "192.0.2.10", IsProxy: true}, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := cache.Get(ctx, "scan:192.0.2.10")
+	if err != nil || got == nil || !got.IsProxy {
+		t.Fatalf("Get = %+v, %v, want the stored result", got, err)
+	}
+	got.Cached = true
+	if again, _ := cache.Get(ctx, "scan:192.0.2.10"); again.Cached {
+		t.Errorf("changing a returned result changed the cached one")
+	}
+
+	if got, _ := cache.Get(ctx, "scan:192.0.2.11"); got != nil {
+		t.Errorf("Get(unknown) = %+v, want nil", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got, _ := cache.Get(ctx, "scan:192.0.2.10"); got != nil {
+		t.Errorf("Get after TTL = %+v, want nil", got)
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("%d entries after expiry, want 0", len(cache.entries))
+	}
+}
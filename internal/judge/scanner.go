@@ -1,16 +1,22 @@
 package judge
 
 import (
+	"bufio"
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
 )
 
 // ScanResult contains the results of active scanning
@@ -23,8 +29,15 @@ type ScanResult struct {
 	IsHTTPConnect bool          `json:"is_http_connect"`
 	OpenPorts     []int         `json:"open_ports"`
 	ProxyPorts    []int         `json:"proxy_ports"`
+	OpenUDPPorts  []int         `json:"open_udp_ports,omitempty"`
+	Verified      bool          `json:"verified"`            // A proxy port relayed traffic; only checked with ?verify=true
+	Anonymity     string        `json:"anonymity,omitempty"` // Of the HTTP proxy: transparent, anonymous or elite
 	Headers       *HeaderResult `json:"headers,omitempty"`
 	ScanTime      float64       `json:"scan_time_ms"`
+	PortScanTime  float64       `json:"port_scan_time_ms"` // Part of ScanTime spent finding open ports
+	ScannedAt     time.Time     `json:"scanned_at,omitzero"`
+	Cached        bool          `json:"cached"`                // Served from the scan cache; see judge.scan_cache_ttl
+	Age           float64       `json:"age_seconds,omitempty"` // Seconds since ScannedAt, set on cached results
 	Error         string        `json:"error,omitempty"`
 }
 
@@ -40,20 +53,105 @@ type HeaderResult struct {
 type Scanner struct {
 	timeout    time.Duration
 	proxyPorts []int
-	httpPorts  []int
-	socksPort  []int
+	portHints  map[int]ProxyProtocol // Protocol probed first on a port, see probeOrder
 	maxWorkers int
+
+	// Port scan stages; see ScannerConfig.PortScanMode
+	portScanMode   string
+	fastTimeout    time.Duration
+	confirmTimeout time.Duration
+	fastWorkers    int
+
+	udpPorts   []int
+	udpTimeout time.Duration
+	udpRetries int
 	httpClient *http.Client
-	externalIP string
+	dial       func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// probe is where proxies are asked to connect; see ResolveProbeTarget
+	probeMu    sync.RWMutex
+	probe      ProbeTarget
+	probeHosts []string
+	lookupIP   func(ctx context.Context, network, host string) ([]net.IP, error)
+	echoURL    string
+
+	// externalIP is either fixed by config or detected and periodically refreshed
+	ipMu             sync.RWMutex
+	externalIP       string
+	staticExternalIP bool
+	detectExternalIP func(ctx context.Context) (string, error)
 }
 
 // ScannerConfig holds scanner configuration
 type ScannerConfig struct {
 	Timeout    time.Duration
 	MaxWorkers int
-	ExternalIP string // Our external IP for header detection
+	ExternalIP string        // Our external IP for header detection; detected when empty
+	UDPPorts   []int         // UDP ports probed when UDP scanning is requested
+	UDPTimeout time.Duration // Per-attempt UDP probe timeout
+	UDPRetries int           // Extra UDP probe attempts after the first
+	ProbeHosts []string      // Destinations proxies are asked to reach, in order of preference
+	EchoURL    string        // Plain HTTP header echo used to classify HTTP proxy anonymity
+	// PortHints adds to or overrides DefaultPortHints
+	PortHints map[int]ProxyProtocol
+
+	// PortScanMode PortScanConnect gives each port the full Timeout.
+	// PortScanFast dials all ports at once (up to FastWorkers) with
+	// FastTimeout, then gives ports that did not answer in time a second
+	// dial with ConfirmTimeout; refused ports are not retried.
+	PortScanMode   string
+	FastTimeout    time.Duration
+	ConfirmTimeout time.Duration
+	FastWorkers    int
 }
 
+// Port scan modes
+const (
+	PortScanConnect = "connect"
+	PortScanFast    = "fast"
+)
+
+// Defaults of the fast port scan stages
+const (
+	defaultFastTimeout    = 300 * time.Millisecond
+	defaultConfirmTimeout = time.Second
+	defaultFastWorkers    = 64
+)
+
+// ProxyProtocol names one of the proxy probes run on an open port
+type ProxyProtocol string
+
+const (
+	ProtocolSOCKS5  ProxyProtocol = "socks5"
+	ProtocolSOCKS4  ProxyProtocol = "socks4"
+	ProtocolHTTP    ProxyProtocol = "http"
+	ProtocolConnect ProxyProtocol = "connect"
+)
+
+// defaultProbeOrder is the order the probes run in on ports without a hint
+var defaultProbeOrder = []ProxyProtocol{ProtocolSOCKS5, ProtocolSOCKS4, ProtocolHTTP, ProtocolConnect}
+
+// ProbeTarget is the destination proxies are asked to reach during a scan
+type ProbeTarget struct {
+	Host string     // Used by the HTTP and CONNECT probes
+	IP   netip.Addr // IPv4 used by the SOCKS4 probe; SOCKS4a with Host when unset
+}
+
+// DefaultEchoURL answers with the request headers it received as
+// {"headers": {...}}; a judge node's own /headers endpoint works too
+const DefaultEchoURL = "http://httpbin.org/headers"
+
+// Proxy anonymity levels, from most to least revealing
+const (
+	AnonymityTransparent = "transparent"
+	AnonymityAnonymous   = "anonymous"
+	AnonymityElite       = "elite"
+)
+
+// DefaultProbeHosts are reachable from most networks and not tied to one
+// provider's regional availability
+var DefaultProbeHosts = []string{"example.com", "www.cloudflare.com"}
+
 // DefaultProxyPorts common proxy ports to scan
 var DefaultProxyPorts = []int{
 	80, 81, 83, 88, // HTTP
@@ -70,6 +168,23 @@ var DefaultSOCKSPorts = []int{1080, 1081, 1082, 9050, 9051}
 // DefaultHTTPPorts common HTTP proxy ports
 var DefaultHTTPPorts = []int{80, 81, 3128, 8080, 8081, 8888, 8118}
 
+// DefaultPortHints returns the protocol each well-known proxy port usually
+// speaks: SOCKS5 on DefaultSOCKSPorts and HTTP on DefaultHTTPPorts
+func DefaultPortHints() map[int]ProxyProtocol {
+	hints := make(map[int]ProxyProtocol, len(DefaultSOCKSPorts)+len(DefaultHTTPPorts))
+	for _, port := range DefaultSOCKSPorts {
+		hints[port] = ProtocolSOCKS5
+	}
+	for _, port := range DefaultHTTPPorts {
+		hints[port] = ProtocolHTTP
+	}
+	return hints
+}
+
+// DefaultUDPPorts common OpenVPN UDP ports. WireGuard is not listed: it stays
+// silent unless the probe is signed with the server's public key.
+var DefaultUDPPorts = []int{443, 1194, 1195, 1197}
+
 // RevealingHeaders headers that reveal proxy usage
 var RevealingHeaders = []string{
 	"X-Forwarded-For",
@@ -98,20 +213,136 @@ func NewScanner(cfg ScannerConfig) *Scanner {
 		maxWorkers = 10
 	}
 
+	udpPorts := cfg.UDPPorts
+	if len(udpPorts) == 0 {
+		udpPorts = DefaultUDPPorts
+	}
+
+	udpTimeout := cfg.UDPTimeout
+	if udpTimeout == 0 {
+		udpTimeout = time.Second
+	}
+
+	udpRetries := cfg.UDPRetries
+	if udpRetries == 0 {
+		udpRetries = 2
+	}
+
+	probeHosts := cfg.ProbeHosts
+	if len(probeHosts) == 0 {
+		probeHosts = DefaultProbeHosts
+	}
+
+	echoURL := cfg.EchoURL
+	if echoURL == "" {
+		echoURL = DefaultEchoURL
+	}
+
+	portHints := DefaultPortHints()
+	maps.Copy(portHints, cfg.PortHints)
+
+	portScanMode := cfg.PortScanMode
+	if portScanMode == "" {
+		portScanMode = PortScanConnect
+	}
+
+	fastTimeout := cfg.FastTimeout
+	if fastTimeout == 0 {
+		fastTimeout = defaultFastTimeout
+	}
+
+	confirmTimeout := cfg.ConfirmTimeout
+	if confirmTimeout == 0 {
+		confirmTimeout = defaultConfirmTimeout
+	}
+
+	fastWorkers := cfg.FastWorkers
+	if fastWorkers == 0 {
+		fastWorkers = defaultFastWorkers
+	}
+
 	return &Scanner{
 		timeout:    timeout,
 		proxyPorts: DefaultProxyPorts,
-		httpPorts:  DefaultHTTPPorts,
-		socksPort:  DefaultSOCKSPorts,
+		portHints:  portHints,
 		maxWorkers: maxWorkers,
+
+		portScanMode:   portScanMode,
+		fastTimeout:    fastTimeout,
+		confirmTimeout: confirmTimeout,
+		fastWorkers:    fastWorkers,
+
+		udpPorts:   udpPorts,
+		udpTimeout: udpTimeout,
+		udpRetries: udpRetries,
 		httpClient: &http.Client{
 			Timeout: timeout,
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse // Don't follow redirects
 			},
 		},
-		externalIP: cfg.ExternalIP,
+		dial:             (&net.Dialer{Timeout: timeout}).DialContext,
+		probe:            ProbeTarget{Host: probeHosts[0]},
+		probeHosts:       probeHosts,
+		lookupIP:         net.DefaultResolver.LookupIP,
+		echoURL:          echoURL,
+		externalIP:       cfg.ExternalIP,
+		staticExternalIP: cfg.ExternalIP != "",
+		detectExternalIP: GetExternalIP,
+	}
+}
+
+// ProbeTarget returns the destination used by proxy probes
+func (s *Scanner) ProbeTarget() ProbeTarget {
+	s.probeMu.RLock()
+	defer s.probeMu.RUnlock()
+	return s.probe
+}
+
+// ResolveProbeTarget picks the first probe host that resolves to an IPv4
+// address. When none does, probes keep using the first host by name.
+func (s *Scanner) ResolveProbeTarget(ctx context.Context) (ProbeTarget, error) {
+	var errs []string
+	for _, host := range s.probeHosts {
+		ips, err := s.lookupIP(ctx, "ip4", host)
+		if err != nil || len(ips) == 0 {
+			errs = append(errs, fmt.Sprintf("%s: %v", host, err))
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ips[0])
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: invalid address %v", host, ips[0]))
+			continue
+		}
+
+		target := ProbeTarget{Host: host, IP: addr.Unmap()}
+		s.probeMu.Lock()
+		s.probe = target
+		s.probeMu.Unlock()
+		return target, nil
+	}
+
+	return s.ProbeTarget(), fmt.Errorf("no probe host resolved: %s", strings.Join(errs, "; "))
+}
+
+// dialProbe opens a probe connection that is closed as soon as ctx is cancelled,
+// so reads and writes blocked on the remote end abort instead of waiting out the deadline
+func (s *Scanner) dialProbe(ctx context.Context, network, ip string, port int) (net.Conn, func(), error) {
+	addr := net.JoinHostPort(ip, fmt.Sprintf("%d", port))
+
+	conn, err := s.dial(ctx, network, addr)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+
+	return conn, func() {
+		stop()
+		conn.Close()
+	}, nil
 }
 
 // Scan performs a comprehensive scan on an IP
@@ -121,18 +352,27 @@ func (s *Scanner) Scan(ctx context.Context, ip string) *ScanResult {
 		IP:         ip,
 		OpenPorts:  []int{},
 		ProxyPorts: []int{},
+		ScannedAt:  start,
 	}
 
 	// Port scan first
 	openPorts := s.scanPorts(ctx, ip, s.proxyPorts)
 	result.OpenPorts = openPorts
+	result.PortScanTime = float64(time.Since(start).Milliseconds())
+
+	if err := ctx.Err(); err != nil {
+		result.Error = err.Error()
+		result.ScanTime = float64(time.Since(start).Milliseconds())
+		return result
+	}
 
 	if len(openPorts) == 0 {
 		result.ScanTime = float64(time.Since(start).Milliseconds())
 		return result
 	}
 
-	// Check each open port for proxy
+	// Check each open port for proxy, running the probe its port hints at
+	// first; the first probe that answers decides the port's protocol
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
@@ -141,36 +381,28 @@ func (s *Scanner) Scan(ctx context.Context, ip string) *ScanResult {
 		go func(p int) {
 			defer wg.Done()
 
-			if s.isSOCKS5(ctx, ip, p) {
-				mu.Lock()
-				result.IsSOCKS5 = true
-				result.IsProxy = true
-				result.ProxyPorts = append(result.ProxyPorts, p)
-				mu.Unlock()
-				return
-			}
-
-			if s.isSOCKS4(ctx, ip, p) {
-				mu.Lock()
-				result.IsSOCKS4 = true
-				result.IsProxy = true
-				result.ProxyPorts = append(result.ProxyPorts, p)
-				mu.Unlock()
-				return
-			}
+			for _, protocol := range s.probeOrder(p) {
+				if !s.probeProtocol(ctx, protocol, ip, p) {
+					continue
+				}
 
-			if s.isHTTPProxy(ctx, ip, p) {
-				mu.Lock()
-				result.IsHTTPProxy = true
-				result.IsProxy = true
-				result.ProxyPorts = append(result.ProxyPorts, p)
-				mu.Unlock()
-				return
-			}
+				var anonymity string
+				if protocol == ProtocolHTTP {
+					anonymity = s.proxyAnonymity(ctx, ip, p)
+				}
 
-			if s.isHTTPConnect(ctx, ip, p) {
 				mu.Lock()
-				result.IsHTTPConnect = true
+				switch protocol {
+				case ProtocolSOCKS5:
+					result.IsSOCKS5 = true
+				case ProtocolSOCKS4:
+					result.IsSOCKS4 = true
+				case ProtocolHTTP:
+					result.IsHTTPProxy = true
+					result.Anonymity = leastAnonymous(result.Anonymity, anonymity)
+				case ProtocolConnect:
+					result.IsHTTPConnect = true
+				}
 				result.IsProxy = true
 				result.ProxyPorts = append(result.ProxyPorts, p)
 				mu.Unlock()
@@ -180,6 +412,9 @@ func (s *Scanner) Scan(ctx context.Context, ip string) *ScanResult {
 	}
 
 	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		result.Error = err.Error()
+	}
 	result.ScanTime = float64(time.Since(start).Milliseconds())
 	return result
 }
@@ -191,14 +426,19 @@ func (s *Scanner) QuickScan(ctx context.Context, ip string) *ScanResult {
 		IP:         ip,
 		OpenPorts:  []int{},
 		ProxyPorts: []int{},
+		ScannedAt:  start,
 	}
 
 	// Only check most common proxy ports
 	quickPorts := []int{1080, 3128, 8080, 8888}
 	openPorts := s.scanPorts(ctx, ip, quickPorts)
 	result.OpenPorts = openPorts
+	result.PortScanTime = float64(time.Since(start).Milliseconds())
 
 	for _, port := range openPorts {
+		if ctx.Err() != nil {
+			break
+		}
 		if s.isSOCKS5(ctx, ip, port) {
 			result.IsSOCKS5 = true
 			result.IsProxy = true
@@ -207,63 +447,122 @@ func (s *Scanner) QuickScan(ctx context.Context, ip string) *ScanResult {
 			result.IsHTTPProxy = true
 			result.IsProxy = true
 			result.ProxyPorts = append(result.ProxyPorts, port)
+			result.Anonymity = leastAnonymous(result.Anonymity, s.proxyAnonymity(ctx, ip, port))
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		result.Error = err.Error()
+	}
 	result.ScanTime = float64(time.Since(start).Milliseconds())
 	return result
 }
 
-// scanPorts scans multiple ports concurrently
+// probeOrder returns the protocols to probe on port: its hinted protocol
+// first, then the others in the default order as a fallback
+func (s *Scanner) probeOrder(port int) []ProxyProtocol {
+	hint, ok := s.portHints[port]
+	if !ok || hint == defaultProbeOrder[0] {
+		return defaultProbeOrder
+	}
+
+	order := make([]ProxyProtocol, 0, len(defaultProbeOrder))
+	order = append(order, hint)
+	for _, protocol := range defaultProbeOrder {
+		if protocol != hint {
+			order = append(order, protocol)
+		}
+	}
+	return order
+}
+
+// probeProtocol runs the probe for protocol on port
+func (s *Scanner) probeProtocol(ctx context.Context, protocol ProxyProtocol, ip string, port int) bool {
+	switch protocol {
+	case ProtocolSOCKS5:
+		return s.isSOCKS5(ctx, ip, port)
+	case ProtocolSOCKS4:
+		return s.isSOCKS4(ctx, ip, port)
+	case ProtocolHTTP:
+		return s.isHTTPProxy(ctx, ip, port)
+	case ProtocolConnect:
+		return s.isHTTPConnect(ctx, ip, port)
+	}
+	return false
+}
+
+// scanPorts returns the open ports among ports using the configured port
+// scan mode, and records how long it took
 func (s *Scanner) scanPorts(ctx context.Context, ip string, ports []int) []int {
-	var openPorts []int
+	start := time.Now()
+	defer func() {
+		metrics.ScanDuration.WithLabelValues("ports_" + s.portScanMode).Observe(float64(time.Since(start).Milliseconds()))
+	}()
+
+	if s.portScanMode != PortScanFast {
+		open, _ := s.dialPorts(ctx, ip, ports, s.maxWorkers, 0)
+		return open
+	}
+
+	open, slow := s.dialPorts(ctx, ip, ports, s.fastWorkers, s.fastTimeout)
+	if len(slow) > 0 && ctx.Err() == nil {
+		confirmed, _ := s.dialPorts(ctx, ip, slow, s.fastWorkers, s.confirmTimeout)
+		open = append(open, confirmed...)
+	}
+	return open
+}
+
+// dialPorts connects to ports with at most workers dials at once, each
+// bounded by timeout when it is set. It returns the open ports and those
+// whose dial ran into timeout rather than being refused.
+func (s *Scanner) dialPorts(ctx context.Context, ip string, ports []int, workers int, timeout time.Duration) (open, timedOut []int) {
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 
-	semaphore := make(chan struct{}, s.maxWorkers)
+	semaphore := make(chan struct{}, workers)
 
 	for _, port := range ports {
 		wg.Add(1)
 		go func(p int) {
 			defer wg.Done()
-			semaphore <- struct{}{}
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 			defer func() { <-semaphore }()
 
-			if s.isPortOpen(ctx, ip, p) {
-				mu.Lock()
-				openPorts = append(openPorts, p)
-				mu.Unlock()
+			dialCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				dialCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			conn, err := s.dial(dialCtx, "tcp", net.JoinHostPort(ip, fmt.Sprintf("%d", p)))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				conn.Close()
+				open = append(open, p)
+			case timeout > 0 && ctx.Err() == nil && dialCtx.Err() != nil:
+				timedOut = append(timedOut, p)
 			}
 		}(port)
 	}
 
 	wg.Wait()
-	return openPorts
-}
-
-// isPortOpen checks if a port is open
-func (s *Scanner) isPortOpen(ctx context.Context, ip string, port int) bool {
-	addr := fmt.Sprintf("%s:%d", ip, port)
-
-	dialer := &net.Dialer{Timeout: s.timeout}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
-	if err != nil {
-		return false
-	}
-	conn.Close()
-	return true
+	return open, timedOut
 }
 
 // isSOCKS5 checks if port is running SOCKS5
 func (s *Scanner) isSOCKS5(ctx context.Context, ip string, port int) bool {
-	addr := fmt.Sprintf("%s:%d", ip, port)
-
-	dialer := &net.Dialer{Timeout: s.timeout}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
 	if err != nil {
 		return false
 	}
-	defer conn.Close()
+	defer closeConn()
 
 	// Set deadline
 	conn.SetDeadline(time.Now().Add(s.timeout))
@@ -286,29 +585,104 @@ func (s *Scanner) isSOCKS5(ctx context.Context, ip string, port int) bool {
 	return buf[0] == 0x05 && buf[1] == 0x00
 }
 
+// ScanUDP probes the configured UDP ports. UDP gives no connection feedback, so a
+// port only counts as open when it answers the probe; silence is ambiguous.
+func (s *Scanner) ScanUDP(ctx context.Context, ip string) []int {
+	return s.scanUDPPorts(ctx, ip, s.udpPorts)
+}
+
+// scanUDPPorts probes multiple UDP ports concurrently
+func (s *Scanner) scanUDPPorts(ctx context.Context, ip string, ports []int) []int {
+	openPorts := []int{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	semaphore := make(chan struct{}, s.maxWorkers)
+
+	for _, port := range ports {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-semaphore }()
+
+			if s.isOpenVPN(ctx, ip, p) {
+				mu.Lock()
+				openPorts = append(openPorts, p)
+				mu.Unlock()
+			}
+		}(port)
+	}
+
+	wg.Wait()
+	return openPorts
+}
+
+// isOpenVPN sends an OpenVPN P_CONTROL_HARD_RESET_CLIENT_V2 packet and checks
+// for a P_CONTROL_HARD_RESET_SERVER_V2 reply, retrying since UDP may drop either
+func (s *Scanner) isOpenVPN(ctx context.Context, ip string, port int) bool {
+	probe := []byte{
+		0x38,                                           // opcode 7 (hard reset client v2), key id 0
+		0x42, 0x45, 0x4f, 0x4e, 0x53, 0x43, 0x41, 0x4e, // session id
+		0x00,                   // ack array length
+		0x00, 0x00, 0x00, 0x00, // packet id
+	}
+
+	for attempt := 0; attempt <= s.udpRetries; attempt++ {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, s.udpTimeout)
+		reply, err := s.udpExchange(attemptCtx, ip, port, probe)
+		cancel()
+
+		if err == nil && len(reply) > 0 && reply[0]>>3 == 8 { // opcode 8: hard reset server v2
+			return true
+		}
+	}
+	return false
+}
+
+// udpExchange sends one datagram and waits for one reply until ctx expires
+func (s *Scanner) udpExchange(ctx context.Context, ip string, port int, payload []byte) ([]byte, error) {
+	conn, closeConn, err := s.dialProbe(ctx, "udp", ip, port)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(payload); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
 // isSOCKS4 checks if port is running SOCKS4
 func (s *Scanner) isSOCKS4(ctx context.Context, ip string, port int) bool {
-	addr := fmt.Sprintf("%s:%d", ip, port)
-
-	dialer := &net.Dialer{Timeout: s.timeout}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
 	if err != nil {
 		return false
 	}
-	defer conn.Close()
+	defer closeConn()
 
 	conn.SetDeadline(time.Now().Add(s.timeout))
 
-	// SOCKS4 connect request to google.com:80
-	// VN=4, CD=1 (connect), DSTPORT=80, DSTIP=142.250.185.206 (google), USERID=null
-	request := []byte{
-		0x04, 0x01, // Version 4, Connect command
-		0x00, 0x50, // Port 80
-		0x8e, 0xfa, 0xb9, 0xce, // 142.250.185.206
-		0x00, // Null terminated userid
-	}
-
-	_, err = conn.Write(request)
+	_, err = conn.Write(socks4Request(s.ProbeTarget()))
 	if err != nil {
 		return false
 	}
@@ -323,21 +697,38 @@ func (s *Scanner) isSOCKS4(ctx context.Context, ip string, port int) bool {
 	return buf[0] == 0x00 && buf[1] == 0x5a
 }
 
+// socks4Request builds a SOCKS4 connect request to port 80 of the probe target.
+// Without a resolved IPv4 it falls back to SOCKS4a and lets the proxy resolve Host.
+func socks4Request(target ProbeTarget) []byte {
+	request := []byte{
+		0x04, 0x01, // Version 4, Connect command
+		0x00, 0x50, // Port 80
+	}
+	if target.IP.Is4() {
+		ip := target.IP.As4()
+		request = append(request, ip[:]...)
+		return append(request, 0x00) // Null terminated userid
+	}
+
+	// SOCKS4a: DSTIP 0.0.0.1, empty userid, then the null terminated hostname
+	request = append(request, 0x00, 0x00, 0x00, 0x01, 0x00)
+	request = append(request, target.Host...)
+	return append(request, 0x00)
+}
+
 // isHTTPProxy checks if port is running HTTP proxy
 func (s *Scanner) isHTTPProxy(ctx context.Context, ip string, port int) bool {
-	addr := fmt.Sprintf("%s:%d", ip, port)
-
-	dialer := &net.Dialer{Timeout: s.timeout}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
 	if err != nil {
 		return false
 	}
-	defer conn.Close()
+	defer closeConn()
 
 	conn.SetDeadline(time.Now().Add(s.timeout))
 
 	// Send HTTP proxy request
-	request := "GET http://www.google.com/ HTTP/1.1\r\nHost: www.google.com\r\nConnection: close\r\n\r\n"
+	host := s.ProbeTarget().Host
+	request := fmt.Sprintf("GET http://%s/ HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", host, host)
 	_, err = conn.Write([]byte(request))
 	if err != nil {
 		return false
@@ -360,19 +751,17 @@ func (s *Scanner) isHTTPProxy(ctx context.Context, ip string, port int) bool {
 
 // isHTTPConnect checks if port supports HTTP CONNECT
 func (s *Scanner) isHTTPConnect(ctx context.Context, ip string, port int) bool {
-	addr := fmt.Sprintf("%s:%d", ip, port)
-
-	dialer := &net.Dialer{Timeout: s.timeout}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
 	if err != nil {
 		return false
 	}
-	defer conn.Close()
+	defer closeConn()
 
 	conn.SetDeadline(time.Now().Add(s.timeout))
 
 	// Send CONNECT request
-	request := "CONNECT www.google.com:443 HTTP/1.1\r\nHost: www.google.com:443\r\n\r\n"
+	host := s.ProbeTarget().Host
+	request := fmt.Sprintf("CONNECT %s:443 HTTP/1.1\r\nHost: %s:443\r\n\r\n", host, host)
 	_, err = conn.Write([]byte(request))
 	if err != nil {
 		return false
@@ -389,6 +778,239 @@ func (s *Scanner) isHTTPConnect(ctx context.Context, ip string, port int) bool {
 	return strings.HasPrefix(response, "HTTP/") && strings.Contains(response, "200")
 }
 
+// maxEchoSize caps the header echo response read through a proxy
+const maxEchoSize = 64 * 1024
+
+// proxyAnonymity fetches the echo URL through an HTTP proxy and classifies what
+// the proxy revealed: transparent when our external IP reached the echo server,
+// anonymous when only proxy headers did, elite when nothing did. It returns ""
+// when the echo request does not go through.
+func (s *Scanner) proxyAnonymity(ctx context.Context, ip string, port int) string {
+	echo, err := url.Parse(s.echoURL)
+	if err != nil || echo.Scheme != "http" {
+		return ""
+	}
+
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
+	if err != nil {
+		return ""
+	}
+	defer closeConn()
+
+	conn.SetDeadline(time.Now().Add(2 * s.timeout))
+
+	if _, err := fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nAccept: application/json\r\nConnection: close\r\n\r\n", echo, echo.Host); err != nil {
+		return ""
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodGet})
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	var body struct {
+		Headers map[string]string `json:"headers"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxEchoSize)).Decode(&body); err != nil || body.Headers == nil {
+		return ""
+	}
+
+	headers := make(map[string][]string, len(body.Headers))
+	for name, value := range body.Headers {
+		headers[name] = []string{value}
+	}
+	return anonymityLevel(s.InspectHeaders(headers, ""))
+}
+
+// anonymityLevel names the level of a header inspection result
+func anonymityLevel(r *HeaderResult) string {
+	switch {
+	case r.IsTransparent:
+		return AnonymityTransparent
+	case r.IsAnonymous:
+		return AnonymityAnonymous
+	default:
+		return AnonymityElite
+	}
+}
+
+// leastAnonymous returns the more revealing of two levels; "" means unknown
+func leastAnonymous(a, b string) string {
+	rank := map[string]int{"": 0, AnonymityElite: 1, AnonymityAnonymous: 2, AnonymityTransparent: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// VerifyProxies reports whether any of the result's proxy ports actually relays
+// traffic to the probe target. The handshake checks in Scan also accept servers
+// that speak a proxy protocol but cannot reach anything.
+func (s *Scanner) VerifyProxies(ctx context.Context, result *ScanResult) bool {
+	for _, port := range result.ProxyPorts {
+		if ctx.Err() != nil {
+			return false
+		}
+		if result.IsSOCKS5 && s.relaysSOCKS5(ctx, result.IP, port) {
+			return true
+		}
+		if result.IsSOCKS4 && s.relaysSOCKS4(ctx, result.IP, port) {
+			return true
+		}
+		if result.IsHTTPConnect && s.relaysHTTPConnect(ctx, result.IP, port) {
+			return true
+		}
+		if result.IsHTTPProxy && s.relaysHTTPProxy(ctx, result.IP, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// relaysSOCKS5 connects through a SOCKS5 proxy to port 80 of the probe target
+// and checks that an HTTP request gets an answer
+func (s *Scanner) relaysSOCKS5(ctx context.Context, ip string, port int) bool {
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
+	if err != nil {
+		return false
+	}
+	defer closeConn()
+
+	conn.SetDeadline(time.Now().Add(2 * s.timeout))
+
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return false
+	}
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil || greeting[0] != 0x05 || greeting[1] != 0x00 {
+		return false
+	}
+
+	target := s.ProbeTarget()
+	request := []byte{0x05, 0x01, 0x00} // Version 5, Connect command, reserved
+	if target.IP.Is4() {
+		ip := target.IP.As4()
+		request = append(request, 0x01)
+		request = append(request, ip[:]...)
+	} else {
+		request = append(request, 0x03, byte(len(target.Host)))
+		request = append(request, target.Host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, 80)
+	if _, err := conn.Write(request); err != nil {
+		return false
+	}
+
+	// Reply: VER REP RSV ATYP BND.ADDR BND.PORT; REP 0 means the proxy connected
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[0] != 0x05 || reply[1] != 0x00 {
+		return false
+	}
+	var addrLen int
+	switch reply[3] {
+	case 0x01:
+		addrLen = 4
+	case 0x04:
+		addrLen = 16
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return false
+		}
+		addrLen = int(n[0])
+	default:
+		return false
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return false
+	}
+
+	return relaysHTTP(conn, bufio.NewReader(conn), target.Host)
+}
+
+// relaysSOCKS4 connects through a SOCKS4 proxy to port 80 of the probe target
+// and checks that an HTTP request gets an answer
+func (s *Scanner) relaysSOCKS4(ctx context.Context, ip string, port int) bool {
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
+	if err != nil {
+		return false
+	}
+	defer closeConn()
+
+	conn.SetDeadline(time.Now().Add(2 * s.timeout))
+
+	target := s.ProbeTarget()
+	if _, err := conn.Write(socks4Request(target)); err != nil {
+		return false
+	}
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[0] != 0x00 || reply[1] != 0x5a {
+		return false
+	}
+
+	return relaysHTTP(conn, bufio.NewReader(conn), target.Host)
+}
+
+// relaysHTTPConnect opens a CONNECT tunnel to port 80 of the probe target and
+// checks that an HTTP request through it gets an answer
+func (s *Scanner) relaysHTTPConnect(ctx context.Context, ip string, port int) bool {
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
+	if err != nil {
+		return false
+	}
+	defer closeConn()
+
+	conn.SetDeadline(time.Now().Add(2 * s.timeout))
+
+	host := s.ProbeTarget().Host
+	if _, err := fmt.Fprintf(conn, "CONNECT %s:80 HTTP/1.1\r\nHost: %s:80\r\n\r\n", host, host); err != nil {
+		return false
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	return relaysHTTP(conn, br, host)
+}
+
+// relaysHTTPProxy requests the probe target through an HTTP proxy. Unlike
+// isHTTPProxy, a 4xx or 5xx answer does not count: proxies that refuse to
+// forward typically reply 403 themselves.
+func (s *Scanner) relaysHTTPProxy(ctx context.Context, ip string, port int) bool {
+	conn, closeConn, err := s.dialProbe(ctx, "tcp", ip, port)
+	if err != nil {
+		return false
+	}
+	defer closeConn()
+
+	conn.SetDeadline(time.Now().Add(2 * s.timeout))
+
+	host := s.ProbeTarget().Host
+	if _, err := fmt.Fprintf(conn, "HEAD http://%s/ HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", host, host); err != nil {
+		return false
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodHead})
+	return err == nil && resp.StatusCode < 400
+}
+
+// relaysHTTP sends a HEAD request for host over an established tunnel and
+// reports whether a well-formed HTTP response comes back
+func relaysHTTP(conn net.Conn, br *bufio.Reader, host string) bool {
+	if _, err := fmt.Fprintf(conn, "HEAD / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", host); err != nil {
+		return false
+	}
+	_, err := http.ReadResponse(br, &http.Request{Method: http.MethodHead})
+	return err == nil
+}
+
 // InspectHeaders inspects HTTP headers from a request to detect proxy
 func (s *Scanner) InspectHeaders(headers map[string][]string, clientIP string) *HeaderResult {
 	result := &HeaderResult{
@@ -396,14 +1018,23 @@ func (s *Scanner) InspectHeaders(headers map[string][]string, clientIP string) *
 		IsElite:          true, // Assume elite until proven otherwise
 	}
 
+	externalIP := s.ExternalIP()
+
+	// Header maps from different sources disagree on casing (X-Real-IP vs X-Real-Ip)
+	canonical := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		key := http.CanonicalHeaderKey(name)
+		canonical[key] = append(canonical[key], values...)
+	}
+
 	for _, header := range RevealingHeaders {
-		if values, ok := headers[header]; ok && len(values) > 0 {
+		if values, ok := canonical[http.CanonicalHeaderKey(header)]; ok && len(values) > 0 {
 			result.RevealingHeaders[header] = values[0]
 			result.IsElite = false
 
 			// Check if header reveals real IP
 			for _, val := range values {
-				if strings.Contains(val, clientIP) || strings.Contains(val, s.externalIP) {
+				if revealsIP(val, clientIP) || revealsIP(val, externalIP) {
 					result.IsTransparent = true
 				}
 			}
@@ -420,6 +1051,36 @@ func (s *Scanner) InspectHeaders(headers map[string][]string, clientIP string) *
 	return result
 }
 
+// revealsIP reports whether a header value contains ip (an empty ip never matches)
+func revealsIP(value, ip string) bool {
+	return ip != "" && strings.Contains(value, ip)
+}
+
+// ExternalIP returns the external IP used for header detection
+func (s *Scanner) ExternalIP() string {
+	s.ipMu.RLock()
+	defer s.ipMu.RUnlock()
+	return s.externalIP
+}
+
+// RefreshExternalIP re-detects our external IP. A configured IP is never
+// replaced, and a failed lookup keeps the previous value.
+func (s *Scanner) RefreshExternalIP(ctx context.Context) (string, error) {
+	if s.staticExternalIP {
+		return s.ExternalIP(), nil
+	}
+
+	ip, err := s.detectExternalIP(ctx)
+	if err != nil {
+		return s.ExternalIP(), err
+	}
+
+	s.ipMu.Lock()
+	s.externalIP = ip
+	s.ipMu.Unlock()
+	return ip, nil
+}
+
 // ScanAsync performs scan asynchronously and returns channel
 func (s *Scanner) ScanAsync(ctx context.Context, ip string) <-chan *ScanResult {
 	ch := make(chan *ScanResult, 1)
@@ -445,7 +1106,17 @@ func (s *Scanner) BatchScan(ctx context.Context, ips []string) []*ScanResult {
 		wg.Add(1)
 		go func(idx int, ipAddr string) {
 			defer wg.Done()
-			semaphore <- struct{}{}
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				results[idx] = &ScanResult{
+					IP:         ipAddr,
+					OpenPorts:  []int{},
+					ProxyPorts: []int{},
+					Error:      ctx.Err().Error(),
+				}
+				return
+			}
 			defer func() { <-semaphore }()
 
 			results[idx] = s.Scan(ctx, ipAddr)
@@ -457,7 +1128,7 @@ func (s *Scanner) BatchScan(ctx context.Context, ips []string) []*ScanResult {
 }
 
 // GetExternalIP gets our external IP address
-func GetExternalIP() (string, error) {
+func GetExternalIP(ctx context.Context) (string, error) {
 	services := []string{
 		"https://api.ipify.org",
 		"https://ifconfig.me/ip",
@@ -467,13 +1138,17 @@ func GetExternalIP() (string, error) {
 	client := &http.Client{Timeout: 5 * time.Second}
 
 	for _, service := range services {
-		resp, err := client.Get(service)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, service, nil)
+		if err != nil {
+			continue
+		}
+		resp, err := client.Do(req)
 		if err != nil {
 			continue
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+		resp.Body.Close()
 		if err != nil {
 			continue
 		}
@@ -486,10 +1161,3 @@ func GetExternalIP() (string, error) {
 
 	return "", fmt.Errorf("failed to get external IP")
 }
-
-func init() {
-	// Get our external IP on startup
-	if ip, err := GetExternalIP(); err == nil {
-		logger.Info(fmt.Sprintf("External IP detected: %s", ip))
-	}
-}
@@ -0,0 +1,619 @@
+package judge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchScanCancelAbandonsDials(t *testing.T) {
+	s := NewScanner(ScannerConfig{Timeout: 10 * time.Second, MaxWorkers: 4})
+
+	var started, abandoned atomic.Int32
+	s.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		started.Add(1)
+		<-ctx.Done()
+		abandoned.Add(1)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for started.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5", "192.0.2.6"}
+
+	start := time.Now()
+	results := s.BatchScan(ctx, ips)
+	elapsed := time.Since(start)
+
+	if elapsed > 2*time.Second {
+		t.Fatalf("BatchScan took %v after cancel, want prompt return", elapsed)
+	}
+	if got, want := abandoned.Load(), started.Load(); got != want {
+		t.Errorf("abandoned dials = %d, want %d", got, want)
+	}
+	for i, r := range results {
+		if r == nil {
+			t.Fatalf("result %d is nil", i)
+		}
+		if r.Error == "" {
+			t.Errorf("result %d (%s) has no cancellation error", i, r.IP)
+		}
+	}
+}
+
+func TestScanCancelAbortsInFlightProbe(t *testing.T) {
+	// The listener accepts connections but never replies, so probes block on read
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				_, _ = io.Copy(io.Discard, c)
+			}(conn)
+		}
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	s := NewScanner(ScannerConfig{Timeout: 10 * time.Second})
+	s.proxyPorts = []int{port}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result := s.Scan(ctx, "127.0.0.1")
+	elapsed := time.Since(start)
+
+	if elapsed > 2*time.Second {
+		t.Fatalf("Scan took %v after cancel, want prompt return", elapsed)
+	}
+	if result.Error == "" {
+		t.Error("expected cancellation error on scan result")
+	}
+	if len(result.OpenPorts) != 1 || result.OpenPorts[0] != port {
+		t.Errorf("OpenPorts = %v, want [%d]", result.OpenPorts, port)
+	}
+}
+
+func TestRefreshExternalIP(t *testing.T) {
+	detected := "198.51.100.1"
+	fail := false
+	detect := func(ctx context.Context) (string, error) {
+		if fail {
+			return "", errors.New("lookup failed")
+		}
+		return detected, nil
+	}
+
+	s := NewScanner(ScannerConfig{})
+	s.detectExternalIP = detect
+
+	if ip, err := s.RefreshExternalIP(context.Background()); err != nil || ip != "198.51.100.1" {
+		t.Fatalf("RefreshExternalIP = %q, %v; want 198.51.100.1", ip, err)
+	}
+
+	// The node's public IP changed; transparency detection must follow it
+	detected = "198.51.100.2"
+	s.RefreshExternalIP(context.Background())
+	headers := map[string][]string{"X-Forwarded-For": {"198.51.100.2"}}
+	if !s.InspectHeaders(headers, "").IsTransparent {
+		t.Errorf("InspectHeaders after refresh did not match the new external IP")
+	}
+
+	// A failed lookup keeps the last known value
+	fail = true
+	if _, err := s.RefreshExternalIP(context.Background()); err == nil {
+		t.Errorf("RefreshExternalIP error = nil, want lookup failure")
+	}
+	if got := s.ExternalIP(); got != "198.51.100.2" {
+		t.Errorf("ExternalIP after failed refresh = %q, want 198.51.100.2", got)
+	}
+
+	// A configured IP is never overridden by detection
+	static := NewScanner(ScannerConfig{ExternalIP: "192.0.2.1"})
+	static.detectExternalIP = detect
+	fail = false
+	static.RefreshExternalIP(context.Background())
+	if got := static.ExternalIP(); got != "192.0.2.1" {
+		t.Errorf("configured ExternalIP = %q after refresh, want 192.0.2.1", got)
+	}
+}
+
+// startUDPResponder answers every OpenVPN client reset after dropping the first dropFirst packets
+func startUDPResponder(t *testing.T, dropFirst int) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for seen := 0; ; seen++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if seen < dropFirst || n == 0 || buf[0]>>3 != 7 {
+				continue
+			}
+			conn.WriteTo([]byte{0x40, 1, 2, 3, 4, 5, 6, 7, 8}, addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestScanUDPPorts(t *testing.T) {
+	s := NewScanner(ScannerConfig{UDPTimeout: 200 * time.Millisecond, UDPRetries: 2})
+
+	openVPN := startUDPResponder(t, 0)
+	lossy := startUDPResponder(t, 1) // first probe lost, retry answered
+
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer silent.Close()
+	silentPort := silent.LocalAddr().(*net.UDPAddr).Port
+
+	got := s.scanUDPPorts(context.Background(), "127.0.0.1", []int{openVPN, lossy, silentPort})
+
+	open := map[int]bool{}
+	for _, p := range got {
+		open[p] = true
+	}
+	if !open[openVPN] || !open[lossy] || open[silentPort] || len(got) != 2 {
+		t.Errorf("open UDP ports = %v, want [%d %d] without %d", got, openVPN, lossy, silentPort)
+	}
+}
+
+func TestResolveProbeTarget(t *testing.T) {
+	s := NewScanner(ScannerConfig{ProbeHosts: []string{"blocked.example", "probe.example"}})
+	s.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		if host == "probe.example" {
+			return []net.IP{net.ParseIP("203.0.113.80")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	// Until resolved, probes use the first host by name
+	if got := s.ProbeTarget(); got.Host != "blocked.example" || got.IP.IsValid() {
+		t.Errorf("initial ProbeTarget = %+v, want blocked.example without IP", got)
+	}
+
+	target, err := s.ResolveProbeTarget(context.Background())
+	if err != nil {
+		t.Fatalf("ResolveProbeTarget: %v", err)
+	}
+	want := ProbeTarget{Host: "probe.example", IP: netip.MustParseAddr("203.0.113.80")}
+	if target != want || s.ProbeTarget() != want {
+		t.Errorf("ProbeTarget = %+v, want %+v", s.ProbeTarget(), want)
+	}
+
+	// Nothing resolves: keep the current target and report the failure
+	s.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		return nil, errors.New("no such host")
+	}
+	if _, err := s.ResolveProbeTarget(context.Background()); err == nil {
+		t.Error("ResolveProbeTarget error = nil, want failure")
+	}
+	if s.ProbeTarget() != want {
+		t.Errorf("ProbeTarget after failed resolve = %+v, want %+v", s.ProbeTarget(), want)
+	}
+}
+
+func TestSOCKS4Request(t *testing.T) {
+	tests := []struct {
+		name   string
+		target ProbeTarget
+		want   []byte
+	}{
+		{
+			"resolved IPv4",
+			ProbeTarget{Host: "probe.example", IP: netip.MustParseAddr("203.0.113.80")},
+			[]byte{0x04, 0x01, 0x00, 0x50, 203, 0, 113, 80, 0x00},
+		},
+		{
+			"SOCKS4a by name",
+			ProbeTarget{Host: "a.io"},
+			[]byte{0x04, 0x01, 0x00, 0x50, 0, 0, 0, 1, 0x00, 'a', '.', 'i', 'o', 0x00},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := socks4Request(tt.target); !bytes.Equal(got, tt.want) {
+				t.Errorf("socks4Request() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPConnectUsesProbeHost(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	requestLine := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		requestLine <- strings.TrimSpace(line)
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	}()
+
+	s := NewScanner(ScannerConfig{Timeout: 2 * time.Second, ProbeHosts: []string{"probe.example"}})
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	if !s.isHTTPConnect(context.Background(), "127.0.0.1", port) {
+		t.Error("isHTTPConnect = false, want true")
+	}
+	if got := <-requestLine; got != "CONNECT probe.example:443 HTTP/1.1" {
+		t.Errorf("request line = %q, want CONNECT to probe.example:443", got)
+	}
+}
+
+// startFakeProxy serves each connection with handle on a local listener
+func startFakeProxy(t testing.TB, handle func(c net.Conn, br *bufio.Reader)) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				c.SetDeadline(time.Now().Add(5 * time.Second))
+				handle(c, bufio.NewReader(c))
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// fakeSOCKS5 completes the greeting, then answers CONNECT with rep and, when it
+// succeeded, answers the tunnelled HTTP request itself
+func fakeSOCKS5(rep byte) func(c net.Conn, br *bufio.Reader) {
+	return func(c net.Conn, br *bufio.Reader) {
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(br, greeting); err != nil {
+			return
+		}
+		c.Write([]byte{0x05, 0x00})
+
+		header := make([]byte, 5) // VER CMD RSV ATYP LEN (domain)
+		if _, err := io.ReadFull(br, header); err != nil || header[3] != 0x03 {
+			return
+		}
+		if _, err := io.ReadFull(br, make([]byte, int(header[4])+2)); err != nil {
+			return
+		}
+		c.Write([]byte{0x05, rep, 0x00, 0x01, 127, 0, 0, 1, 0x1f, 0x90})
+		if rep != 0x00 {
+			return
+		}
+
+		if _, err := http.ReadRequest(br); err == nil {
+			c.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+		}
+	}
+}
+
+func TestVerifyProxies(t *testing.T) {
+	relaying := startFakeProxy(t, fakeSOCKS5(0x00))
+	refusing := startFakeProxy(t, fakeSOCKS5(0x05)) // Connection refused by the proxy
+	connect := startFakeProxy(t, func(c net.Conn, br *bufio.Reader) {
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect || req.Host != "probe.example:80" {
+			c.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+			return
+		}
+		c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		if _, err := http.ReadRequest(br); err == nil {
+			c.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+		}
+	})
+
+	s := NewScanner(ScannerConfig{Timeout: 2 * time.Second, ProbeHosts: []string{"probe.example"}})
+
+	tests := []struct {
+		name   string
+		result ScanResult
+		want   bool
+	}{
+		{"SOCKS5 relay", ScanResult{IP: "127.0.0.1", IsSOCKS5: true, ProxyPorts: []int{relaying}}, true},
+		{"SOCKS5 handshake only", ScanResult{IP: "127.0.0.1", IsSOCKS5: true, ProxyPorts: []int{refusing}}, false},
+		{"any relaying port", ScanResult{IP: "127.0.0.1", IsSOCKS5: true, ProxyPorts: []int{refusing, relaying}}, true},
+		{"HTTP CONNECT relay", ScanResult{IP: "127.0.0.1", IsHTTPConnect: true, ProxyPorts: []int{connect}}, true},
+		{"no proxy ports", ScanResult{IP: "127.0.0.1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.VerifyProxies(context.Background(), &tt.result); got != tt.want {
+				t.Errorf("VerifyProxies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// isSOCKSGreeting reports whether a connection opens with a SOCKS4/5 version
+// byte, so HTTP-only fakes can hang up instead of waiting for a request line
+func isSOCKSGreeting(br *bufio.Reader) bool {
+	b, err := br.Peek(1)
+	return err != nil || b[0] == 0x04 || b[0] == 0x05
+}
+
+// fakeHTTPProxy answers forwarded requests itself: the probe target gets a
+// plain 200 and the echo URL gets the headers the proxy would have added
+func fakeHTTPProxy(added map[string]string) func(c net.Conn, br *bufio.Reader) {
+	return func(c net.Conn, br *bufio.Reader) {
+		if isSOCKSGreeting(br) {
+			return
+		}
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		if req.URL.String() != "http://echo.example/headers" {
+			c.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+			return
+		}
+
+		headers := map[string]string{"Host": "echo.example"}
+		for k, v := range added {
+			headers[k] = v
+		}
+		body, _ := json.Marshal(map[string]any{"headers": headers})
+		fmt.Fprintf(c, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	}
+}
+
+func TestScanProxyAnonymity(t *testing.T) {
+	transparent := startFakeProxy(t, fakeHTTPProxy(map[string]string{"X-Forwarded-For": "198.51.100.7"}))
+	anonymous := startFakeProxy(t, fakeHTTPProxy(map[string]string{"Via": "1.1 squid"}))
+	elite := startFakeProxy(t, fakeHTTPProxy(nil))
+	noEcho := startFakeProxy(t, func(c net.Conn, br *bufio.Reader) {
+		if isSOCKSGreeting(br) {
+			return
+		}
+		if _, err := http.ReadRequest(br); err == nil {
+			c.Write([]byte("HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n"))
+		}
+	})
+
+	tests := []struct {
+		name  string
+		ports []int
+		want  string
+	}{
+		{"transparent", []int{transparent}, AnonymityTransparent},
+		{"anonymous", []int{anonymous}, AnonymityAnonymous},
+		{"elite", []int{elite}, AnonymityElite},
+		{"echo refused", []int{noEcho}, ""},
+		{"least anonymous port wins", []int{elite, transparent}, AnonymityTransparent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScanner(ScannerConfig{
+				Timeout:    2 * time.Second,
+				ExternalIP: "198.51.100.7",
+				ProbeHosts: []string{"probe.example"},
+				EchoURL:    "http://echo.example/headers",
+			})
+			s.proxyPorts = tt.ports
+
+			result := s.Scan(context.Background(), "127.0.0.1")
+			if !result.IsHTTPProxy {
+				t.Fatalf("IsHTTPProxy = false, want true (result %+v)", result)
+			}
+			if result.Anonymity != tt.want {
+				t.Errorf("Anonymity = %q, want %q", result.Anonymity, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeOrder(t *testing.T) {
+	s := NewScanner(ScannerConfig{PortHints: map[int]ProxyProtocol{8080: ProtocolConnect, 4145: ProtocolSOCKS4}})
+
+	tests := []struct {
+		port int
+		want []ProxyProtocol
+	}{
+		{1080, []ProxyProtocol{ProtocolSOCKS5, ProtocolSOCKS4, ProtocolHTTP, ProtocolConnect}},
+		{3128, []ProxyProtocol{ProtocolHTTP, ProtocolSOCKS5, ProtocolSOCKS4, ProtocolConnect}},
+		{8080, []ProxyProtocol{ProtocolConnect, ProtocolSOCKS5, ProtocolSOCKS4, ProtocolHTTP}}, // Configured over the default
+		{4145, []ProxyProtocol{ProtocolSOCKS4, ProtocolSOCKS5, ProtocolHTTP, ProtocolConnect}},
+		{443, defaultProbeOrder}, // No hint
+	}
+
+	for _, tt := range tests {
+		if got := s.probeOrder(tt.port); !slices.Equal(got, tt.want) {
+			t.Errorf("probeOrder(%d) = %v, want %v", tt.port, got, tt.want)
+		}
+	}
+}
+
+// stallingHTTPProxy is an HTTP proxy that, like most, waits for a full request
+// line when sent a SOCKS greeting, so the SOCKS probes run into the timeout
+func stallingHTTPProxy(c net.Conn, br *bufio.Reader) {
+	if isSOCKSGreeting(br) {
+		io.Copy(io.Discard, br)
+		return
+	}
+	if _, err := http.ReadRequest(br); err == nil {
+		c.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	}
+}
+
+func TestScanFallsBackFromHint(t *testing.T) {
+	port := startFakeProxy(t, fakeSOCKS5(0x00))
+
+	// A wrong hint only costs its probe; the remaining probes still run
+	s := NewScanner(ScannerConfig{Timeout: 200 * time.Millisecond, ProbeHosts: []string{"probe.example"},
+		PortHints: map[int]ProxyProtocol{port: ProtocolHTTP}})
+	s.proxyPorts = []int{port}
+
+	result := s.Scan(context.Background(), "127.0.0.1")
+	if !result.IsSOCKS5 || result.IsHTTPProxy {
+		t.Errorf("result = %+v, want SOCKS5 only", result)
+	}
+}
+
+func BenchmarkScanProbeOrder(b *testing.B) {
+	port := startFakeProxy(b, stallingHTTPProxy)
+
+	for _, bench := range []struct {
+		name  string
+		hints map[int]ProxyProtocol
+	}{
+		{"unhinted", nil},
+		{"hinted", map[int]ProxyProtocol{port: ProtocolHTTP}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			s := NewScanner(ScannerConfig{
+				Timeout:    50 * time.Millisecond,
+				ProbeHosts: []string{"probe.example"},
+				EchoURL:    "http://echo.example/headers",
+				PortHints:  bench.hints,
+			})
+			s.proxyPorts = []int{port}
+
+			for b.Loop() {
+				if result := s.Scan(context.Background(), "127.0.0.1"); !result.IsHTTPProxy {
+					b.Fatalf("IsHTTPProxy = false (result %+v)", result)
+				}
+			}
+		})
+	}
+}
+
+// portBehaviourDial fakes a host whose ports answer after the given delay;
+// ports not listed refuse at once and a negative delay never answers. Like
+// net.Dialer, each dial gives up after timeout.
+func portBehaviourDial(timeout time.Duration, delays map[string]time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		_, port, _ := net.SplitHostPort(addr)
+		delay, ok := delays[port]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		if delay < 0 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		select {
+		case <-time.After(delay):
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestScanPortsFast(t *testing.T) {
+	s := NewScanner(ScannerConfig{
+		Timeout:        5 * time.Second,
+		PortScanMode:   PortScanFast,
+		FastTimeout:    50 * time.Millisecond,
+		ConfirmTimeout: 300 * time.Millisecond,
+	})
+	s.dial = portBehaviourDial(s.timeout, map[string]time.Duration{
+		"1080": 0,                      // Open
+		"3128": 150 * time.Millisecond, // Slow: found by the confirm pass
+		"8080": time.Second,            // Slower than the confirm pass
+		"9050": -1,                     // Filtered
+	})
+
+	start := time.Now()
+	open := s.scanPorts(context.Background(), "192.0.2.1", []int{80, 1080, 3128, 8080, 9050})
+	elapsed := time.Since(start)
+
+	slices.Sort(open)
+	if !slices.Equal(open, []int{1080, 3128}) {
+		t.Errorf("open ports = %v, want [1080 3128]", open)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("fast scan took %v, want it bounded by the staged timeouts", elapsed)
+	}
+}
+
+func BenchmarkScanPorts(b *testing.B) {
+	// One open port among filtered and closed ones, as on most scanned hosts
+	delays := map[string]time.Duration{"8080": time.Millisecond}
+	for _, port := range []string{"80", "81", "83", "88", "443", "9050", "9051"} {
+		delays[port] = -1
+	}
+
+	for _, mode := range []string{PortScanConnect, PortScanFast} {
+		b.Run(mode, func(b *testing.B) {
+			s := NewScanner(ScannerConfig{
+				Timeout:        100 * time.Millisecond,
+				MaxWorkers:     4,
+				PortScanMode:   mode,
+				FastTimeout:    10 * time.Millisecond,
+				ConfirmTimeout: 30 * time.Millisecond,
+			})
+			s.dial = portBehaviourDial(s.timeout, delays)
+
+			for b.Loop() {
+				if open := s.scanPorts(context.Background(), "192.0.2.1", DefaultProxyPorts); len(open) != 1 {
+					b.Fatalf("open ports = %v, want [8080]", open)
+				}
+			}
+		})
+	}
+}
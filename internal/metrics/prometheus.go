@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -186,6 +188,105 @@ var (
 		},
 	)
 
+	// FeedsProcessed counts feed runs by outcome
+	FeedsProcessed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ipquality_feeds_processed_total",
+			Help: "Total feed runs by status",
+		},
+		[]string{"feed", "status"},
+	)
+
+	// FeedEntriesStored counts entries stored per feed
+	FeedEntriesStored = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ipquality_feed_entries_stored_total",
+			Help: "Total feed entries stored in the database",
+		},
+		[]string{"feed"},
+	)
+
+	// FeedFetchErrors counts failed source fetches per feed
+	FeedFetchErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ipquality_feed_fetch_errors_total",
+			Help: "Total failed feed source fetches",
+		},
+		[]string{"feed"},
+	)
+
+	// FeedLastSuccess tracks when each feed last fetched every source
+	FeedLastSuccess = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ipquality_feed_last_success_timestamp",
+			Help: "Unix time of the last feed run that fetched every source",
+		},
+		[]string{"feed"},
+	)
+
+	// FeedEntries tracks the entries fetched by each feed's last successful run
+	FeedEntries = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ipquality_feed_entries",
+			Help: "Entries fetched by the last successful feed run",
+		},
+		[]string{"feed"},
+	)
+
+	// ReputationRowsRemoved counts reputation rows deleted by cleanup
+	ReputationRowsRemoved = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ipquality_reputation_rows_removed_total",
+			Help: "Total reputation rows deleted by cleanup, by reason",
+		},
+		[]string{"reason"},
+	)
+
+	// AlertWebhookEvents counts high-risk lookup alerts by result: sent,
+	// failed, dropped (queue full) or rate_limited
+	AlertWebhookEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ipquality_alert_webhook_events_total",
+			Help: "Total high-risk lookup alerts, by delivery result",
+		},
+		[]string{"result"},
+	)
+
+	// CircuitBreakerState tracks each dependency's circuit breaker: 0 closed,
+	// 1 open (calls are skipped), 2 half-open (probing recovery)
+	CircuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ipquality_circuit_breaker_state",
+			Help: "Circuit breaker state by dependency: 0 closed, 1 open, 2 half-open",
+		},
+		[]string{"dependency"},
+	)
+
+	// CircuitBreakerRejections counts calls skipped while a breaker was open
+	CircuitBreakerRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ipquality_circuit_breaker_rejections_total",
+			Help: "Total calls skipped by an open circuit breaker, by dependency",
+		},
+		[]string{"dependency"},
+	)
+
+	// CompileDuration tracks the duration of the last MMDB compilation
+	CompileDuration = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ipquality_compile_duration_seconds",
+			Help: "Duration of the last MMDB compilation in seconds",
+		},
+	)
+
+	// CompileEntries tracks the entries written by the last MMDB compilation
+	CompileEntries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ipquality_compile_entries",
+			Help: "Reputation entries written by the last MMDB compilation",
+		},
+	)
+
 	// SystemInfo provides system information
 	SystemInfo = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -238,3 +339,26 @@ func RecordGeoIPLookup(lookupType string, success bool) {
 	}
 	GeoIPLookups.WithLabelValues(lookupType, result).Inc()
 }
+
+// RecordPostgresQuery records a PostgreSQL query duration
+func RecordPostgresQuery(queryType string, durationMs float64) {
+	PostgresQueryDuration.WithLabelValues(queryType).Observe(durationMs)
+}
+
+// RecordFeedRun records the outcome of a feed run
+func RecordFeedRun(feed, status string, stored int) {
+	FeedsProcessed.WithLabelValues(feed, status).Inc()
+	FeedEntriesStored.WithLabelValues(feed).Add(float64(stored))
+}
+
+// RecordFeedSuccess records a feed run that fetched every source
+func RecordFeedSuccess(feed string, entries int, at time.Time) {
+	FeedLastSuccess.WithLabelValues(feed).Set(float64(at.Unix()))
+	FeedEntries.WithLabelValues(feed).Set(float64(entries))
+}
+
+// RecordCompile records a completed MMDB compilation
+func RecordCompile(entries int, duration time.Duration) {
+	CompileEntries.Set(float64(entries))
+	CompileDuration.Set(duration.Seconds())
+}
@@ -0,0 +1,98 @@
+// Package migrate applies the embedded schema migrations for the -migrate
+// flag of the service binaries
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/analytics"
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/migrations"
+	"github.com/lfrfrfr/beon-ipquality/pkg/logger"
+)
+
+// Store selects a database to migrate
+type Store int
+
+const (
+	Postgres Store = 1 << iota
+	ClickHouse
+)
+
+// Run applies the pending migrations of the selected stores. ClickHouse is
+// skipped unless clickhouse.enabled is set.
+func Run(ctx context.Context, cfg *config.Config, stores Store) error {
+	if stores&Postgres != 0 {
+		if err := runPostgres(ctx, cfg); err != nil {
+			return err
+		}
+	}
+	if stores&ClickHouse != 0 && cfg.ClickHouse.Enabled {
+		if err := runClickHouse(ctx, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPostgres migrates the primary PostgreSQL database
+func runPostgres(ctx context.Context, cfg *config.Config) error {
+	ms, err := migrations.Postgres()
+	if err != nil {
+		return err
+	}
+
+	var db *database.PostgresDB
+	pg := cfg.Database.Postgres
+	err = database.ConnectWithRetry(ctx, pg.ConnectAttempts, pg.ConnectRetryDelay, func() error {
+		var err error
+		db, err = database.NewPostgresDB(pg.URL(), 2, 1)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer db.Close()
+
+	applied, err := db.Migrate(ctx, ms)
+	logApplied("PostgreSQL", applied)
+	if err != nil {
+		return fmt.Errorf("PostgreSQL: %w", err)
+	}
+	return nil
+}
+
+// runClickHouse migrates the analytics database and its table TTLs
+func runClickHouse(ctx context.Context, cfg *config.Config) error {
+	ms, err := migrations.ClickHouse()
+	if err != nil {
+		return err
+	}
+
+	applied, err := analytics.Migrate(ctx, analytics.Config{
+		Host:     cfg.ClickHouse.Host,
+		Port:     cfg.ClickHouse.Port,
+		Database: cfg.ClickHouse.Database,
+		Username: cfg.ClickHouse.Username,
+		Password: cfg.ClickHouse.Password,
+	}, ms, analytics.Retention{
+		RequestDays: cfg.ClickHouse.RequestRetentionDays,
+		ScanDays:    cfg.ClickHouse.ScanRetentionDays,
+	})
+	logApplied("ClickHouse", applied)
+	if err != nil {
+		return fmt.Errorf("ClickHouse: %w", err)
+	}
+	return nil
+}
+
+func logApplied(store string, applied []string) {
+	if len(applied) == 0 {
+		logger.Info(fmt.Sprintf("%s schema is up to date", store))
+		return
+	}
+	logger.Info(fmt.Sprintf("Applied %s migrations: %s", store, strings.Join(applied, ", ")))
+}
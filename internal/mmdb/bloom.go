@@ -0,0 +1,159 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// FlaggedFilter is a bloom filter of the flagged prefixes in a reputation
+// MMDB. A miss proves an IP is not listed, so clean lookups can skip the
+// cache and the reputation lookup; a hit only means it may be listed.
+type FlaggedFilter struct {
+	bits     []uint64
+	m        uint64 // number of bits
+	k        uint64 // number of hash functions
+	prefixes int
+	// Prefix lengths present in the database, per address family
+	v4Lengths []int
+	v6Lengths []int
+}
+
+// BuildFlaggedFilter indexes every network of db holding a listed record,
+// sized for the given false positive rate
+func BuildFlaggedFilter(db *maxminddb.Reader, fpRate float64) (*FlaggedFilter, error) {
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, fmt.Errorf("false positive rate must be between 0 and 1, got %v", fpRate)
+	}
+
+	var prefixes []netip.Prefix
+	networks := db.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		var record ReputationRecord
+		network, err := networks.Network(&record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read network: %w", err)
+		}
+		// Same notion of "listed" as LookupReputation
+		if record.RiskScore == 0 && record.ThreatType == "" {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(network.IP)
+		if !ok {
+			continue
+		}
+		bits, _ := network.Mask.Size()
+		if addr.Is4In6() {
+			addr, bits = addr.Unmap(), bits-96
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, bits))
+	}
+	if err := networks.Err(); err != nil {
+		return nil, fmt.Errorf("failed to walk reputation MMDB: %w", err)
+	}
+
+	f := newFlaggedFilter(len(prefixes), fpRate)
+	for _, p := range prefixes {
+		f.add(p)
+	}
+	return f, nil
+}
+
+// newFlaggedFilter sizes an empty filter for n prefixes at the given false
+// positive rate
+func newFlaggedFilter(n int, fpRate float64) *FlaggedFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &FlaggedFilter{bits: make([]uint64, m/64), m: m, k: k}
+}
+
+// add inserts a prefix and records its length for MayContain
+func (f *FlaggedFilter) add(p netip.Prefix) {
+	p = p.Masked()
+	if p.Addr().Is4() {
+		f.v4Lengths = addLength(f.v4Lengths, p.Bits())
+	} else {
+		f.v6Lengths = addLength(f.v6Lengths, p.Bits())
+	}
+	h1, h2 := hashPrefix(p)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.prefixes++
+}
+
+// MayContain reports whether ip may fall inside a flagged prefix. False
+// means it definitely does not.
+func (f *FlaggedFilter) MayContain(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	lengths := f.v6Lengths
+	if ip.Is4() {
+		lengths = f.v4Lengths
+	}
+	for _, bits := range lengths {
+		p, err := ip.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if f.test(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// test reports whether all k bits of a masked prefix are set
+func (f *FlaggedFilter) test(p netip.Prefix) bool {
+	h1, h2 := hashPrefix(p)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Stats describes the filter's size
+func (f *FlaggedFilter) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"prefixes": f.prefixes,
+		"bits":     f.m,
+		"hashes":   f.k,
+	}
+}
+
+// hashPrefix derives the two base hashes for double hashing from the
+// prefix's address and length
+func hashPrefix(p netip.Prefix) (uint64, uint64) {
+	a := p.Addr().As16()
+	h := fnv.New128a()
+	h.Write(a[:])
+	h.Write([]byte{byte(p.Bits())})
+	sum := h.Sum(nil)
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	h2 := binary.BigEndian.Uint64(sum[8:]) | 1 // odd, so probes do not repeat early
+	return h1, h2
+}
+
+// addLength adds bits to a set of prefix lengths
+func addLength(lengths []int, bits int) []int {
+	for _, l := range lengths {
+		if l == bits {
+			return lengths
+		}
+	}
+	return append(lengths, bits)
+}
@@ -0,0 +1,109 @@
+package mmdb
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func compileFilterTestDB(t *testing.T, path string, prefixes ...string) {
+	t.Helper()
+
+	var entries []ReputationEntry
+	for _, p := range prefixes {
+		entries = append(entries, ReputationEntry{
+			Prefix:     netip.MustParsePrefix(p),
+			RiskScore:  70,
+			ThreatType: "attack",
+			LastUpdate: time.Now(),
+		})
+	}
+	if err := NewDefaultWriter().CompileToMMDB(entries, path); err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+}
+
+func TestFlaggedFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	compileFilterTestDB(t, path, "45.155.205.0/24", "185.220.0.0/16", "2a03:2880:dead::/48")
+
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+
+	if err := reader.EnableFlaggedFilter(0.0001); err != nil {
+		t.Fatalf("EnableFlaggedFilter: %v", err)
+	}
+
+	for _, ip := range []string{"45.155.205.233", "185.220.101.7", "::ffff:45.155.205.1", "2a03:2880:dead:1::1"} {
+		if !reader.MayBeFlagged(netip.MustParseAddr(ip)) {
+			t.Errorf("MayBeFlagged(%s) = false, want true", ip)
+		}
+	}
+	for _, ip := range []string{"8.8.8.8", "45.155.206.1", "185.221.0.1", "2a03:2880:beef::1"} {
+		addr := netip.MustParseAddr(ip)
+		if reader.MayBeFlagged(addr) {
+			t.Errorf("MayBeFlagged(%s) = true, want false", ip)
+		}
+		if rep, err := reader.LookupReputation(addr); err != nil || rep != nil {
+			t.Errorf("LookupReputation(%s) = %v, %v; want not listed", ip, rep, err)
+		}
+	}
+	if rep, _ := reader.LookupReputation(netip.MustParseAddr("45.155.205.233")); rep == nil || rep.RiskScore != 70 {
+		t.Errorf("LookupReputation of a listed IP = %+v, want score 70", rep)
+	}
+}
+
+func TestFlaggedFilterRebuiltOnReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reputation.mmdb")
+	compileFilterTestDB(t, path, "45.155.205.0/24")
+
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+	if err := reader.EnableFlaggedFilter(0.0001); err != nil {
+		t.Fatalf("EnableFlaggedFilter: %v", err)
+	}
+
+	listed := netip.MustParseAddr("91.92.109.9")
+	if reader.MayBeFlagged(listed) {
+		t.Fatalf("MayBeFlagged(%s) = true before it was listed", listed)
+	}
+
+	newPath := filepath.Join(dir, "reputation-new.mmdb")
+	compileFilterTestDB(t, newPath, "45.155.205.0/24", "91.92.109.0/24")
+	if err := reader.Reload(newPath, "", ""); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if !reader.MayBeFlagged(listed) {
+		t.Errorf("MayBeFlagged(%s) = false after reload, want true", listed)
+	}
+	if rep, _ := reader.LookupReputation(listed); rep == nil {
+		t.Errorf("LookupReputation(%s) = nil after reload, want listed", listed)
+	}
+}
+
+func TestMayBeFlaggedWithoutFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	compileFilterTestDB(t, path, "45.155.205.0/24")
+
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+
+	if !reader.MayBeFlagged(netip.MustParseAddr("8.8.8.8")) {
+		t.Error("MayBeFlagged() = false without a filter, want true")
+	}
+	if err := reader.EnableFlaggedFilter(1); err == nil {
+		t.Error("EnableFlaggedFilter(1) succeeded, want an error")
+	}
+}
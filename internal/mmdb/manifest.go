@@ -0,0 +1,143 @@
+package mmdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ManifestVersion is the current manifest format version
+const ManifestVersion = 1
+
+// Manifest describes a compiled MMDB file. It is written next to the database
+// as <path>.json and checked before the database is loaded.
+type Manifest struct {
+	Version    int    `json:"version"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	BuildEpoch uint   `json:"build_epoch"`
+	EntryCount int    `json:"entry_count"`
+	// Entries left out of the file: of the wrong IP version for the
+	// database, or rejected by the writer
+	SkippedCount int `json:"skipped_count,omitempty"`
+	ErrorCount   int `json:"error_count,omitempty"`
+}
+
+// ErrManifestMismatch is returned when an MMDB file does not match its manifest
+var ErrManifestMismatch = errors.New("MMDB does not match manifest")
+
+// ManifestPath returns the sidecar manifest path for an MMDB file
+func ManifestPath(mmdbPath string) string {
+	return mmdbPath + ".json"
+}
+
+// BuildManifest computes the manifest of an MMDB file
+func BuildManifest(path string, entryCount int) (*Manifest, error) {
+	size, sum, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MMDB: %w", err)
+	}
+	defer db.Close()
+
+	return &Manifest{
+		Version:    ManifestVersion,
+		Size:       size,
+		SHA256:     sum,
+		BuildEpoch: db.Metadata.BuildEpoch,
+		EntryCount: entryCount,
+	}, nil
+}
+
+// WriteManifest atomically writes a manifest for the MMDB at mmdbPath
+func WriteManifest(mmdbPath string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	path := ManifestPath(mmdbPath)
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest for an MMDB file. It returns nil, nil when
+// there is no manifest (e.g. third-party databases or older compiles).
+func ReadManifest(mmdbPath string) (*Manifest, error) {
+	data, err := os.ReadFile(ManifestPath(mmdbPath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// VerifyManifest checks an MMDB file against its manifest, if one exists
+func VerifyManifest(mmdbPath string) (*Manifest, error) {
+	m, err := ReadManifest(mmdbPath)
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	size, sum, err := hashFile(mmdbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if size != m.Size {
+		return nil, fmt.Errorf("%w: %s is %d bytes, manifest says %d", ErrManifestMismatch, mmdbPath, size, m.Size)
+	}
+	if sum != m.SHA256 {
+		return nil, fmt.Errorf("%w: %s has sha256 %s, manifest says %s", ErrManifestMismatch, mmdbPath, sum, m.SHA256)
+	}
+	return m, nil
+}
+
+// checkBuildEpoch guards against the file being replaced between hashing and opening
+func checkBuildEpoch(m *Manifest, db *maxminddb.Reader, path string) error {
+	if m != nil && db.Metadata.BuildEpoch != m.BuildEpoch {
+		return fmt.Errorf("%w: %s has build epoch %d, manifest says %d",
+			ErrManifestMismatch, path, db.Metadata.BuildEpoch, m.BuildEpoch)
+	}
+	return nil
+}
+
+// hashFile returns the size and hex SHA-256 of a file
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
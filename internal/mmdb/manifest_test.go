@@ -0,0 +1,180 @@
+package mmdb
+
+import (
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// compileTestDB compiles a one-entry reputation MMDB listing 45.155.205.0/24
+func compileTestDB(t *testing.T, path string, score int) {
+	t.Helper()
+
+	err := NewDefaultWriter().CompileToMMDB([]ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("45.155.205.0/24"),
+		RiskScore:  score,
+		ThreatType: "attack",
+		LastUpdate: time.Now(),
+	}}, path)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+}
+
+func TestCompileWritesManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	compileTestDB(t, path, 80)
+
+	m, err := ReadManifest(path)
+	if err != nil || m == nil {
+		t.Fatalf("ReadManifest = %v, %v; want manifest", m, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != ManifestVersion || m.Size != info.Size() || m.EntryCount != 1 || len(m.SHA256) != 64 || m.BuildEpoch == 0 {
+		t.Errorf("manifest = %+v, want version %d, size %d, 1 entry, sha256 and build epoch set",
+			m, ManifestVersion, info.Size())
+	}
+
+	if _, err := VerifyManifest(path); err != nil {
+		t.Errorf("VerifyManifest: %v", err)
+	}
+}
+
+func TestNewReaderRejectsCorruptMMDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	compileTestDB(t, path, 80)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("truncated-or-corrupt"))
+	f.Close()
+
+	if _, err := NewReader(path, "", ""); !errors.Is(err, ErrManifestMismatch) {
+		t.Errorf("NewReader(corrupt) error = %v, want ErrManifestMismatch", err)
+	}
+}
+
+func TestNewReaderWithoutManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	compileTestDB(t, path, 80)
+	os.Remove(ManifestPath(path))
+
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader without manifest: %v", err)
+	}
+	reader.Close()
+}
+
+func TestReloadKeepsOldDBOnMismatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reputation.mmdb")
+	compileTestDB(t, path, 80)
+
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+
+	// A new compile whose manifest no longer matches the file on disk
+	next := filepath.Join(dir, "next.mmdb")
+	compileTestDB(t, next, 40)
+	if err := os.Rename(next, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reader.Reload(path, "", ""); !errors.Is(err, ErrManifestMismatch) {
+		t.Fatalf("Reload error = %v, want ErrManifestMismatch", err)
+	}
+
+	rec, err := reader.LookupReputation(netip.MustParseAddr("45.155.205.1"))
+	if err != nil || rec == nil || rec.RiskScore != 80 {
+		t.Errorf("LookupReputation after refused reload = %+v, %v; want old DB score 80", rec, err)
+	}
+}
+
+func TestStatsExposesEpoch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	compileTestDB(t, path, 80)
+
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+
+	epoch, ok := reader.Stats()["epoch"].(uint64)
+	if !ok || epoch == 0 || epoch != reader.BuildEpoch() {
+		t.Errorf("Stats()[epoch] = %v, want BuildEpoch() = %d", reader.Stats()["epoch"], reader.BuildEpoch())
+	}
+}
+
+func TestCompileIPv4OnlySkipsIPv6(t *testing.T) {
+	cfg := DefaultWriterConfig()
+	cfg.IPVersion = 4
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+
+	entry := func(cidr string) ReputationEntry {
+		return ReputationEntry{Prefix: netip.MustParsePrefix(cidr), RiskScore: 80, ThreatType: "attack", LastUpdate: time.Now()}
+	}
+	err := NewWriter(cfg).CompileToMMDB([]ReputationEntry{
+		entry("45.155.205.0/24"),
+		entry("2a03:2880::/32"),
+		entry("::ffff:91.92.0.0/112"), // IPv4-mapped, stored as 91.92.0.0/16
+	}, path)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+
+	m, err := ReadManifest(path)
+	if err != nil || m == nil {
+		t.Fatalf("ReadManifest = %v, %v; want manifest", m, err)
+	}
+	if m.EntryCount != 2 || m.SkippedCount != 1 || m.ErrorCount != 0 {
+		t.Errorf("manifest entries/skipped/errors = %d/%d/%d, want 2/1/0", m.EntryCount, m.SkippedCount, m.ErrorCount)
+	}
+
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+	if rec, err := reader.LookupReputation(netip.MustParseAddr("91.92.1.1")); err != nil || rec == nil {
+		t.Errorf("LookupReputation(mapped range) = %v, %v; want a record", rec, err)
+	}
+
+	if err := NewWriter(cfg).CompileToMMDB([]ReputationEntry{entry("2a03:2880::/32")}, path); err != nil {
+		t.Errorf("CompileToMMDB(only IPv6) error = %v, want an empty database", err)
+	}
+
+	cfg.IPVersion = 5
+	if err := NewWriter(cfg).CompileToMMDB([]ReputationEntry{entry("45.155.205.0/24")}, path); err == nil {
+		t.Error("CompileToMMDB accepted IP version 5")
+	}
+}
+
+func TestCompileFailsWhenNothingInserts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	// Reserved networks are rejected unless IncludeReservedNets is set
+	err := NewDefaultWriter().CompileToMMDB([]ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("192.0.2.0/24"),
+		RiskScore:  80,
+		LastUpdate: time.Now(),
+	}}, path)
+	if err == nil {
+		t.Fatal("CompileToMMDB succeeded without inserting anything")
+	}
+	if _, statErr := os.Stat(path); !errors.Is(statErr, os.ErrNotExist) {
+		t.Errorf("Stat(output) error = %v, want no file written", statErr)
+	}
+}
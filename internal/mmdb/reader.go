@@ -33,29 +33,39 @@ type ReputationRecord struct {
 
 	// Confidence (0-100 stored as int)
 	Confidence int `maxminddb:"confidence"`
+	// AggregateConfidence (0-100) combines every source listing the range;
+	// 0 when only one did
+	AggregateConfidence int `maxminddb:"aggregate_confidence"`
 
 	// Source information
 	Sources    []string `maxminddb:"sources"`
 	LastUpdate int64    `maxminddb:"last_update"` // Unix timestamp
 
+	// Feed-provided tags (malware family, category, ...)
+	Tags []string `maxminddb:"tags"`
+
 	// Geo information (optional, may be in separate DB)
-	Country     string `maxminddb:"country,omitempty"`
-	CountryCode string `maxminddb:"country_code,omitempty"`
-	City        string `maxminddb:"city,omitempty"`
-	Region      string `maxminddb:"region,omitempty"`
+	Country     string `maxminddb:"country"`
+	CountryCode string `maxminddb:"country_code"`
+	City        string `maxminddb:"city"`
+	Region      string `maxminddb:"region"`
 
 	// ASN information (optional)
-	ASN     int    `maxminddb:"asn,omitempty"`
-	ASNOrg  string `maxminddb:"asn_org,omitempty"`
-	ASNType string `maxminddb:"asn_type,omitempty"`
+	ASN     int    `maxminddb:"asn"`
+	ASNOrg  string `maxminddb:"asn_org"`
+	ASNType string `maxminddb:"asn_type"`
 }
 
 // Reader handles reading from the custom MMDB
 type Reader struct {
-	reputationDB *maxminddb.Reader
-	geoipDB      *maxminddb.Reader
-	asnDB        *maxminddb.Reader
-	mu           sync.RWMutex
+	reputationDB  *maxminddb.Reader
+	geoipDB       *maxminddb.Reader
+	asnDB         *maxminddb.Reader
+	anonymousDB   *maxminddb.Reader // Optional MaxMind GeoIP2-Anonymous-IP
+	anonymousPath string
+	filter        *FlaggedFilter // Optional, see EnableFlaggedFilter
+	filterFPRate  float64
+	mu            sync.RWMutex
 }
 
 // NewReader creates a new MMDB reader
@@ -64,9 +74,9 @@ func NewReader(reputationPath, geoipPath, asnPath string) (*Reader, error) {
 
 	// Load reputation database
 	if reputationPath != "" {
-		db, err := maxminddb.Open(reputationPath)
+		db, err := openVerified(reputationPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open reputation MMDB: %w", err)
+			return nil, err
 		}
 		reader.reputationDB = db
 		logger.Info(fmt.Sprintf("Loaded reputation MMDB: %s", reputationPath))
@@ -97,6 +107,82 @@ func NewReader(reputationPath, geoipPath, asnPath string) (*Reader, error) {
 	return reader, nil
 }
 
+// openVerified opens the reputation MMDB after checking it against its manifest
+func openVerified(path string) (*maxminddb.Reader, error) {
+	manifest, err := VerifyManifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reputation MMDB: %w", err)
+	}
+
+	if err := checkBuildEpoch(manifest, db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// LoadAnonymousIP opens a MaxMind GeoIP2-Anonymous-IP database whose signals are
+// merged into LookupAll. It is reopened from the same path on Reload.
+func (r *Reader) LoadAnonymousIP(path string) error {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open Anonymous IP MMDB: %w", err)
+	}
+
+	r.mu.Lock()
+	old := r.anonymousDB
+	r.anonymousDB = db
+	r.anonymousPath = path
+	r.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	logger.Info(fmt.Sprintf("Loaded Anonymous IP MMDB: %s", path))
+	return nil
+}
+
+// EnableFlaggedFilter builds a bloom filter of the reputation database's
+// flagged prefixes so that lookups of unlisted IPs short-circuit. It is
+// rebuilt from the new database on Reload.
+func (r *Reader) EnableFlaggedFilter(fpRate float64) error {
+	r.mu.RLock()
+	db := r.reputationDB
+	r.mu.RUnlock()
+
+	if db == nil {
+		return fmt.Errorf("reputation database not loaded")
+	}
+	filter, err := BuildFlaggedFilter(db, fpRate)
+	if err != nil {
+		return fmt.Errorf("failed to build flagged prefix filter: %w", err)
+	}
+
+	r.mu.Lock()
+	r.filter = filter
+	r.filterFPRate = fpRate
+	r.mu.Unlock()
+
+	logger.Info(fmt.Sprintf("Built flagged prefix filter: %d prefixes", filter.prefixes))
+	return nil
+}
+
+// MayBeFlagged reports whether ip may be listed in the reputation database.
+// It is always true without a flagged prefix filter; false means the IP is
+// definitely clean as far as the reputation database is concerned.
+func (r *Reader) MayBeFlagged(ip netip.Addr) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.filter == nil || r.filter.MayContain(ip)
+}
+
 // Close closes all open databases
 func (r *Reader) Close() error {
 	r.mu.Lock()
@@ -119,6 +205,11 @@ func (r *Reader) Close() error {
 			errs = append(errs, err)
 		}
 	}
+	if r.anonymousDB != nil {
+		if err := r.anonymousDB.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
 	if len(errs) > 0 {
 		return fmt.Errorf("errors closing databases: %v", errs)
@@ -126,12 +217,19 @@ func (r *Reader) Close() error {
 	return nil
 }
 
-// Reload reloads all databases (hot reload)
+// Reload reloads all databases (hot reload). As with NewReader, an empty
+// reputationPath leaves the reader without a reputation database.
 func (r *Reader) Reload(reputationPath, geoipPath, asnPath string) error {
 	// Load new databases first
-	newRepDB, err := maxminddb.Open(reputationPath)
-	if err != nil {
-		return fmt.Errorf("failed to reload reputation MMDB: %w", err)
+	// A file that fails its manifest check is refused and the current one stays live
+	var newRepDB *maxminddb.Reader
+	var err error
+	if reputationPath != "" {
+		newRepDB, err = openVerified(reputationPath)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Refusing to reload reputation MMDB: %v", err))
+			return fmt.Errorf("failed to reload reputation MMDB: %w", err)
+		}
 	}
 
 	var newGeoipDB, newAsnDB *maxminddb.Reader
@@ -143,15 +241,42 @@ func (r *Reader) Reload(reputationPath, geoipPath, asnPath string) error {
 		newAsnDB, _ = maxminddb.Open(asnPath)
 	}
 
+	r.mu.RLock()
+	anonymousPath := r.anonymousPath
+	filterFPRate := r.filterFPRate
+	r.mu.RUnlock()
+
+	// Rebuild the flagged prefix filter against the new database; without it
+	// the old filter would hide newly listed prefixes
+	var newFilter *FlaggedFilter
+	if filterFPRate > 0 && newRepDB != nil {
+		newFilter, err = BuildFlaggedFilter(newRepDB, filterFPRate)
+		if err != nil {
+			newRepDB.Close()
+			logger.Error(fmt.Sprintf("Refusing to reload reputation MMDB: %v", err))
+			return fmt.Errorf("failed to rebuild flagged prefix filter: %w", err)
+		}
+	}
+
+	var newAnonymousDB *maxminddb.Reader
+	if anonymousPath != "" {
+		newAnonymousDB, _ = maxminddb.Open(anonymousPath)
+	}
+
 	// Swap databases
 	r.mu.Lock()
 	oldRepDB := r.reputationDB
 	oldGeoipDB := r.geoipDB
 	oldAsnDB := r.asnDB
+	oldAnonymousDB := r.anonymousDB
 
 	r.reputationDB = newRepDB
 	r.geoipDB = newGeoipDB
 	r.asnDB = newAsnDB
+	r.anonymousDB = newAnonymousDB
+	if newFilter != nil {
+		r.filter = newFilter
+	}
 	r.mu.Unlock()
 
 	// Close old databases
@@ -164,6 +289,9 @@ func (r *Reader) Reload(reputationPath, geoipPath, asnPath string) error {
 	if oldAsnDB != nil {
 		oldAsnDB.Close()
 	}
+	if oldAnonymousDB != nil {
+		oldAnonymousDB.Close()
+	}
 
 	logger.Info("Successfully reloaded MMDB databases")
 	return nil
@@ -177,6 +305,9 @@ func (r *Reader) LookupReputation(ip netip.Addr) (*ReputationRecord, error) {
 	if r.reputationDB == nil {
 		return nil, fmt.Errorf("reputation database not loaded")
 	}
+	if r.filter != nil && !r.filter.MayContain(ip) {
+		return nil, nil // Definitely not listed
+	}
 
 	netIP := net.IP(ip.AsSlice())
 	var record ReputationRecord
@@ -282,16 +413,99 @@ func (r *Reader) LookupASN(ip netip.Addr) (*models.ASNInfo, error) {
 	}, nil
 }
 
-// LookupAll performs a complete lookup for an IP
+// AnonymousIPRecord represents a MaxMind GeoIP2-Anonymous-IP lookup result
+type AnonymousIPRecord struct {
+	IsAnonymous       bool `maxminddb:"is_anonymous"`
+	IsAnonymousVPN    bool `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider bool `maxminddb:"is_hosting_provider"`
+	IsPublicProxy     bool `maxminddb:"is_public_proxy"`
+	IsTorExitNode     bool `maxminddb:"is_tor_exit_node"`
+}
+
+// LookupAnonymousIP looks up anonymizer signals for an IP
+func (r *Reader) LookupAnonymousIP(ip netip.Addr) (*AnonymousIPRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.anonymousDB == nil {
+		return nil, nil // Anonymous IP DB not available
+	}
+
+	netIP := net.IP(ip.AsSlice())
+	var record AnonymousIPRecord
+
+	err := r.anonymousDB.Lookup(netIP, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// ReputationSource answers reputation lookups. The Reader and the in-memory
+// index in internal/index both implement it.
+type ReputationSource interface {
+	LookupReputation(ip netip.Addr) (*ReputationRecord, error)
+}
+
+// LookupProvider is what IP checks need from a reputation backend: the full
+// result of LookupAll and the individual lookups it combines. The Reader
+// implements it; WithReputation pairs a Reader's GeoIP and ASN data with
+// another ReputationSource.
+type LookupProvider interface {
+	ReputationSource
+	LookupAll(ip netip.Addr) (*models.IPCheckResult, error)
+	LookupGeoIP(ip netip.Addr) (*models.GeoInfo, error)
+	LookupASN(ip netip.Addr) (*models.ASNInfo, error)
+}
+
+// WithReputation returns a LookupProvider that reads reputation from src and
+// GeoIP, ASN and Anonymous IP data from r
+func (r *Reader) WithReputation(src ReputationSource) LookupProvider {
+	return reputationOverlay{reader: r, src: src}
+}
+
+// reputationOverlay is a Reader with its reputation lookups replaced
+type reputationOverlay struct {
+	reader *Reader
+	src    ReputationSource
+}
+
+func (o reputationOverlay) LookupReputation(ip netip.Addr) (*ReputationRecord, error) {
+	return o.src.LookupReputation(ip)
+}
+
+func (o reputationOverlay) LookupAll(ip netip.Addr) (*models.IPCheckResult, error) {
+	return o.reader.LookupAllFrom(o.src, ip)
+}
+
+func (o reputationOverlay) LookupGeoIP(ip netip.Addr) (*models.GeoInfo, error) {
+	return o.reader.LookupGeoIP(ip)
+}
+
+func (o reputationOverlay) LookupASN(ip netip.Addr) (*models.ASNInfo, error) {
+	return o.reader.LookupASN(ip)
+}
+
+// LookupAll performs a complete lookup for an IP. Geo and ASN come from the
+// reputation record when it embeds them, otherwise from the GeoIP and ASN
+// databases when those are loaded; either is left nil when no source knows it.
+// It fails only when the reputation itself cannot be read.
 func (r *Reader) LookupAll(ip netip.Addr) (*models.IPCheckResult, error) {
+	return r.LookupAllFrom(r, ip)
+}
+
+// LookupAllFrom is LookupAll with the reputation read from src instead of
+// the reader's own reputation database
+func (r *Reader) LookupAllFrom(src ReputationSource, ip netip.Addr) (*models.IPCheckResult, error) {
 	result := &models.IPCheckResult{
 		IP: ip.String(),
 	}
 
 	// Lookup reputation
-	rep, err := r.LookupReputation(ip)
+	rep, err := src.LookupReputation(ip)
 	if err != nil {
-		logger.Debug(fmt.Sprintf("Reputation lookup error for %s: %v", ip, err))
+		return nil, fmt.Errorf("reputation lookup failed: %w", err)
 	}
 	if rep != nil {
 		result.Score = rep.RiskScore
@@ -306,6 +520,7 @@ func (r *Reader) LookupAll(ip netip.Addr) (*models.IPCheckResult, error) {
 		result.IsSpam = rep.IsSpam
 		result.IsAttacker = rep.IsAttacker
 		result.ThreatTypes = rep.Sources
+		result.Tags = rep.Tags
 		if rep.ThreatType != "" {
 			result.ThreatTypes = append([]string{rep.ThreatType}, result.ThreatTypes...)
 		}
@@ -315,32 +530,96 @@ func (r *Reader) LookupAll(ip netip.Addr) (*models.IPCheckResult, error) {
 		result.RiskLevel = "clean"
 	}
 
-	// Lookup GeoIP
-	geo, err := r.LookupGeoIP(ip)
-	if err != nil {
-		logger.Debug(fmt.Sprintf("GeoIP lookup error for %s: %v", ip, err))
+	// Geo and ASN embedded in the reputation record save the separate lookups
+	result.Geo = rep.embeddedGeo()
+	if result.Geo == nil {
+		geo, err := r.LookupGeoIP(ip)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("GeoIP lookup error for %s: %v", ip, err))
+		}
+		if geo != nil && geo.CountryCode != "" {
+			result.Geo = geo
+		}
+	}
+
+	result.ASN = rep.embeddedASN()
+	if result.ASN == nil {
+		asn, err := r.LookupASN(ip)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("ASN lookup error for %s: %v", ip, err))
+		}
+		if asn != nil && asn.ASN != 0 {
+			result.ASN = asn
+		}
 	}
-	result.Geo = geo
 
-	// Lookup ASN
-	asn, err := r.LookupASN(ip)
+	// OR in MaxMind Anonymous IP signals
+	anon, err := r.LookupAnonymousIP(ip)
 	if err != nil {
-		logger.Debug(fmt.Sprintf("ASN lookup error for %s: %v", ip, err))
+		logger.Debug(fmt.Sprintf("Anonymous IP lookup error for %s: %v", ip, err))
+	}
+	if anon != nil {
+		result.IsVPN = result.IsVPN || anon.IsAnonymousVPN
+		result.IsProxy = result.IsProxy || anon.IsPublicProxy
+		result.IsTor = result.IsTor || anon.IsTorExitNode
+		result.IsDatacenter = result.IsDatacenter || anon.IsHostingProvider
 	}
-	result.ASN = asn
 
 	return result, nil
 }
 
-// Stats returns statistics about the loaded databases
+// embeddedGeo returns the location stored in the record, or nil when the
+// record is nil or carries none
+func (rec *ReputationRecord) embeddedGeo() *models.GeoInfo {
+	if rec == nil || rec.CountryCode == "" {
+		return nil
+	}
+	return &models.GeoInfo{
+		Country:     rec.Country,
+		CountryCode: rec.CountryCode,
+		City:        rec.City,
+		Region:      rec.Region,
+	}
+}
+
+// embeddedASN returns the ASN stored in the record, or nil when the record
+// is nil or carries none
+func (rec *ReputationRecord) embeddedASN() *models.ASNInfo {
+	if rec == nil || rec.ASN == 0 {
+		return nil
+	}
+	return &models.ASNInfo{
+		ASN:         rec.ASN,
+		Org:         rec.ASNOrg,
+		Type:        rec.ASNType,
+		ASNType:     rec.ASNType,
+		CountryCode: rec.CountryCode,
+	}
+}
+
+// BuildEpoch returns the build time (Unix seconds) of the loaded reputation
+// database, or 0 if none is loaded
+func (r *Reader) BuildEpoch() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.reputationDB == nil {
+		return 0
+	}
+	return uint64(r.reputationDB.Metadata.BuildEpoch)
+}
+
+// Stats returns statistics about the loaded databases. "epoch" is the
+// reputation build epoch that namespaces cached results (0 when none is loaded).
 func (r *Reader) Stats() map[string]interface{} {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	stats := make(map[string]interface{})
+	stats := map[string]interface{}{"epoch": uint64(0)}
 
 	if r.reputationDB != nil {
 		meta := r.reputationDB.Metadata
+		stats["epoch"] = uint64(meta.BuildEpoch)
 		stats["reputation"] = map[string]interface{}{
 			"build_epoch":   meta.BuildEpoch,
 			"database_type": meta.DatabaseType,
@@ -351,6 +630,10 @@ func (r *Reader) Stats() map[string]interface{} {
 		}
 	}
 
+	if r.filter != nil {
+		stats["flagged_filter"] = r.filter.Stats()
+	}
+
 	if r.geoipDB != nil {
 		meta := r.geoipDB.Metadata
 		stats["geoip"] = map[string]interface{}{
@@ -367,5 +650,13 @@ func (r *Reader) Stats() map[string]interface{} {
 		}
 	}
 
+	if r.anonymousDB != nil {
+		meta := r.anonymousDB.Metadata
+		stats["anonymous_ip"] = map[string]interface{}{
+			"database_type": meta.DatabaseType,
+			"build_epoch":   meta.BuildEpoch,
+		}
+	}
+
 	return stats
 }
@@ -0,0 +1,219 @@
+package mmdb
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// writeAnonymousIPDB writes a GeoIP2-Anonymous-IP style database with the given records
+func writeAnonymousIPDB(t *testing.T, records map[string]mmdbtype.Map) string {
+	t.Helper()
+	return writeTestDB(t, "GeoIP2-Anonymous-IP", records)
+}
+
+// writeTestDB writes a database of the given type with the given records
+func writeTestDB(t *testing.T, databaseType string, records map[string]mmdbtype.Map) string {
+	t.Helper()
+
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: databaseType, RecordSize: 24})
+	if err != nil {
+		t.Fatalf("mmdbwriter.New: %v", err)
+	}
+	for cidr, record := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%s): %v", cidr, err)
+		}
+		if err := tree.Insert(network, record); err != nil {
+			t.Fatalf("Insert(%s): %v", cidr, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), databaseType+".mmdb")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+	if _, err := tree.WriteTo(f); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	return path
+}
+
+func TestLookupAllAnonymousIP(t *testing.T) {
+	repPath := filepath.Join(t.TempDir(), "reputation.mmdb")
+	err := NewDefaultWriter().CompileToMMDB([]ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("45.155.205.0/24"),
+		RiskScore:  60,
+		ThreatType: "attack",
+		Flags:      EntryFlags{IsAttacker: true},
+		LastUpdate: time.Now(),
+	}}, repPath)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+
+	anonPath := writeAnonymousIPDB(t, map[string]mmdbtype.Map{
+		"45.155.205.0/24": {"is_anonymous": mmdbtype.Bool(true), "is_public_proxy": mmdbtype.Bool(true)},
+		"162.247.74.0/24": {"is_anonymous": mmdbtype.Bool(true), "is_tor_exit_node": mmdbtype.Bool(true)},
+		"89.187.160.0/24": {"is_anonymous": mmdbtype.Bool(true), "is_anonymous_vpn": mmdbtype.Bool(true)},
+		"34.64.0.0/16":    {"is_hosting_provider": mmdbtype.Bool(true)},
+	})
+
+	reader, err := NewReader(repPath, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+	if err := reader.LoadAnonymousIP(anonPath); err != nil {
+		t.Fatalf("LoadAnonymousIP: %v", err)
+	}
+
+	tests := []struct {
+		ip                                       string
+		wantVPN, wantProxy, wantTor, wantHosting bool
+		wantAttacker                             bool
+	}{
+		{"45.155.205.9", false, true, false, false, true}, // reputation and anonymous signals combined
+		{"162.247.74.7", false, false, true, false, false},
+		{"89.187.160.3", true, false, false, false, false},
+		{"34.64.1.1", false, false, false, true, false},
+		{"8.8.8.8", false, false, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got, err := reader.LookupAll(netip.MustParseAddr(tt.ip))
+			if err != nil {
+				t.Fatalf("LookupAll: %v", err)
+			}
+			if got.IsVPN != tt.wantVPN || got.IsProxy != tt.wantProxy || got.IsTor != tt.wantTor ||
+				got.IsDatacenter != tt.wantHosting || got.IsAttacker != tt.wantAttacker {
+				t.Errorf("flags vpn=%v proxy=%v tor=%v datacenter=%v attacker=%v, want %v %v %v %v %v",
+					got.IsVPN, got.IsProxy, got.IsTor, got.IsDatacenter, got.IsAttacker,
+					tt.wantVPN, tt.wantProxy, tt.wantTor, tt.wantHosting, tt.wantAttacker)
+			}
+		})
+	}
+}
+
+func TestLookupReputationTags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	err := NewDefaultWriter().CompileFromIPReputations([]models.IPReputation{
+		{IPRange: "45.155.205.0/24", Source: "abuse_feodo", ThreatType: "botnet_c2", RiskScore: 90,
+			LastSeen: time.Now(), Metadata: models.Metadata{Tags: []string{"Emotet", "QakBot"}}},
+		{IPRange: "162.247.74.7", Source: "tor_exit_nodes", ThreatType: "tor", RiskScore: 70, LastSeen: time.Now()},
+	}, path)
+	if err != nil {
+		t.Fatalf("CompileFromIPReputations: %v", err)
+	}
+
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+
+	rep, err := reader.LookupReputation(netip.MustParseAddr("45.155.205.9"))
+	if err != nil || rep == nil {
+		t.Fatalf("LookupReputation = %v, %v", rep, err)
+	}
+	if !slices.Equal(rep.Tags, []string{"Emotet", "QakBot"}) {
+		t.Errorf("Tags = %v, want [Emotet QakBot]", rep.Tags)
+	}
+
+	rep, err = reader.LookupReputation(netip.MustParseAddr("162.247.74.7"))
+	if err != nil || rep == nil {
+		t.Fatalf("LookupReputation = %v, %v", rep, err)
+	}
+	if len(rep.Tags) != 0 {
+		t.Errorf("untagged entry Tags = %v, want none", rep.Tags)
+	}
+}
+
+func TestLookupAllEmbeddedASN(t *testing.T) {
+	repPath := writeTestDB(t, "BEON-IPQuality", map[string]mmdbtype.Map{
+		// Record carrying the embedded geo and ASN fields
+		"45.155.205.0/24": {
+			"risk_score":   mmdbtype.Uint16(60),
+			"threat_type":  mmdbtype.String("attack"),
+			"is_attacker":  mmdbtype.Bool(true),
+			"country":      mmdbtype.String("Netherlands"),
+			"country_code": mmdbtype.String("NL"),
+			"asn":          mmdbtype.Uint32(206728),
+			"asn_org":      mmdbtype.String("Media Land LLC"),
+			"asn_type":     mmdbtype.String("hosting"),
+		},
+		// Record without them
+		"162.247.74.0/24": {
+			"risk_score":  mmdbtype.Uint16(70),
+			"threat_type": mmdbtype.String("tor"),
+			"is_tor":      mmdbtype.Bool(true),
+		},
+	})
+	asnPath := writeTestDB(t, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"45.155.205.0/24": {"autonomous_system_number": mmdbtype.Uint32(1), "autonomous_system_organization": mmdbtype.String("Separate DB")},
+		"162.247.74.0/24": {"autonomous_system_number": mmdbtype.Uint32(4224), "autonomous_system_organization": mmdbtype.String("CALYX-AS")},
+	})
+
+	tests := []struct {
+		name        string
+		asnPath     string
+		ip          string
+		wantASN     int
+		wantOrg     string
+		wantType    string
+		wantCountry string
+	}{
+		{"embedded preferred", asnPath, "45.155.205.9", 206728, "Media Land LLC", "hosting", "NL"},
+		{"embedded without ASN DB", "", "45.155.205.9", 206728, "Media Land LLC", "hosting", "NL"},
+		{"separate DB fallback", asnPath, "162.247.74.7", 4224, "CALYX-AS", "", ""},
+		{"no source", "", "162.247.74.7", 0, "", "", ""},
+		{"unlisted IP from separate DB", asnPath, "8.8.8.8", 0, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewReader(repPath, "", tt.asnPath)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			defer reader.Close()
+
+			got, err := reader.LookupAll(netip.MustParseAddr(tt.ip))
+			if err != nil {
+				t.Fatalf("LookupAll: %v", err)
+			}
+
+			if tt.wantASN == 0 {
+				if got.ASN != nil {
+					t.Errorf("ASN = %+v, want nil", got.ASN)
+				}
+			} else if got.ASN == nil {
+				t.Errorf("ASN = nil, want AS%d", tt.wantASN)
+			} else if got.ASN.ASN != tt.wantASN || got.ASN.Org != tt.wantOrg || got.ASN.ASNType != tt.wantType {
+				t.Errorf("ASN = AS%d %q type %q, want AS%d %q type %q",
+					got.ASN.ASN, got.ASN.Org, got.ASN.ASNType, tt.wantASN, tt.wantOrg, tt.wantType)
+			}
+
+			if tt.wantCountry == "" {
+				if got.Geo != nil {
+					t.Errorf("Geo = %+v, want nil", got.Geo)
+				}
+			} else if got.Geo == nil || got.Geo.CountryCode != tt.wantCountry {
+				t.Errorf("Geo = %+v, want country %s", got.Geo, tt.wantCountry)
+			}
+		})
+	}
+}
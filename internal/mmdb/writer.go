@@ -2,10 +2,14 @@ package mmdb
 
 import (
 	"fmt"
+	"math"
 	"net"
 	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/maxmind/mmdbwriter"
@@ -20,21 +24,30 @@ import (
 type WriterConfig struct {
 	DatabaseType        string
 	Description         string
-	RecordSize          int // 24, 28, or 32
+	RecordSize          int // 24, 28, 32, or RecordSizeAuto
 	IPVersion           int // 4, 6, or 0 for both
 	IncludeReservedNets bool
 	DisableIPv4Aliasing bool
+	RiskThresholds      models.RiskThresholds // Zero value uses the defaults
+
+	// MergeAndCompile raises the score of a range by CorroborationBonus when
+	// at least CorroborationSources distinct sources list it (0 = disabled)
+	CorroborationSources int
+	CorroborationBonus   int
 }
 
 // DefaultWriterConfig returns the default writer configuration
 func DefaultWriterConfig() WriterConfig {
 	return WriterConfig{
-		DatabaseType:        "BEON-IPReputation",
-		Description:         "BEON IP Reputation Database",
-		RecordSize:          28,
-		IPVersion:           0, // Both IPv4 and IPv6
-		IncludeReservedNets: false,
-		DisableIPv4Aliasing: false,
+		DatabaseType:         "BEON-IPReputation",
+		Description:          "BEON IP Reputation Database",
+		RecordSize:           28,
+		IPVersion:            0, // Both IPv4 and IPv6
+		IncludeReservedNets:  false,
+		DisableIPv4Aliasing:  false,
+		RiskThresholds:       models.DefaultRiskThresholds,
+		CorroborationSources: 3,
+		CorroborationBonus:   10,
 	}
 }
 
@@ -61,8 +74,12 @@ type ReputationEntry struct {
 	ThreatType string
 	Confidence float64
 	Sources    []string
+	Tags       []string
 	Flags      EntryFlags
 	LastUpdate time.Time
+	// AggregateConfidence combines the confidence of every source listing
+	// the range; zero for single-source entries
+	AggregateConfidence float64
 }
 
 // EntryFlags represents boolean threat flags
@@ -82,29 +99,100 @@ func (w *Writer) CompileToMMDB(entries []ReputationEntry, outputPath string) err
 	logger.Info(fmt.Sprintf("Starting MMDB compilation with %d entries", len(entries)))
 	startTime := time.Now()
 
+	entries, skippedCount, err := w.filterIPVersion(entries)
+	if err != nil {
+		return err
+	}
+	if skippedCount > 0 {
+		logger.Warn(fmt.Sprintf("Skipped %d IPv6 entries that do not fit the IPv4-only MMDB", skippedCount))
+	}
+
 	// Create output directory if it doesn't exist
 	dir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Create MMDB writer
-	tree, err := mmdbwriter.New(mmdbwriter.Options{
+	recordSize := w.config.RecordSize
+	if recordSize == RecordSizeAuto {
+		recordSize = estimateRecordSize(len(entries))
+		logger.Info(fmt.Sprintf("Selected record size %d for %d entries", recordSize, len(entries)))
+	}
+
+	tempPath := outputPath + ".tmp"
+	var insertedCount, errorCount int
+	for {
+		tree, err := w.newTree(recordSize)
+		if err != nil {
+			return fmt.Errorf("failed to create MMDB writer: %w", err)
+		}
+
+		var firstErr error
+		insertedCount, errorCount, firstErr = w.insertEntries(tree, entries)
+		if errorCount > 0 {
+			if insertedCount == 0 {
+				return fmt.Errorf("failed to insert any of %d entries, first error: %w", errorCount, firstErr)
+			}
+			logger.Warn(fmt.Sprintf("Failed to insert %d of %d entries, first error: %v", errorCount, len(entries), firstErr))
+		}
+
+		err = writeTree(tree, tempPath)
+		if err == nil {
+			break
+		}
+		// The estimate was too small; the tree has to be rebuilt to change it
+		if w.config.RecordSize == RecordSizeAuto && recordSize < 32 && isRecordCapacityError(err) {
+			recordSize = nextRecordSize(recordSize)
+			logger.Warn(fmt.Sprintf("Database outgrew its record size, retrying with %d", recordSize))
+			continue
+		}
+		return err
+	}
+
+	// Build the manifest from the finished file; this also checks it opens
+	manifest, err := BuildManifest(tempPath, insertedCount)
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to verify compiled MMDB: %w", err)
+	}
+	manifest.SkippedCount = skippedCount
+	manifest.ErrorCount = errorCount
+
+	// Atomic rename
+	if err := os.Rename(tempPath, outputPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename output file: %w", err)
+	}
+
+	if err := WriteManifest(outputPath, manifest); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("MMDB compilation complete: %d entries inserted, %d skipped, %d errors, took %v",
+		insertedCount, skippedCount, errorCount, time.Since(startTime)))
+
+	return nil
+}
+
+// newTree creates an empty search tree with the writer's options
+func (w *Writer) newTree(recordSize int) (*mmdbwriter.Tree, error) {
+	return mmdbwriter.New(mmdbwriter.Options{
 		DatabaseType:            w.config.DatabaseType,
 		Description:             map[string]string{"en": w.config.Description},
-		RecordSize:              w.config.RecordSize,
+		RecordSize:              recordSize,
 		IPVersion:               w.config.IPVersion,
 		IncludeReservedNetworks: w.config.IncludeReservedNets,
 		DisableIPv4Aliasing:     w.config.DisableIPv4Aliasing,
 		Inserter:                inserter.ReplaceWith,
 	})
-	if err != nil {
-		return fmt.Errorf("failed to create MMDB writer: %w", err)
-	}
+}
 
-	// Insert entries
+// insertEntries inserts entries into tree, returning how many were inserted
+// and failed along with the first failure
+func (w *Writer) insertEntries(tree *mmdbwriter.Tree, entries []ReputationEntry) (int, int, error) {
 	var insertedCount int
 	var errorCount int
+	var firstErr error
 
 	for _, entry := range entries {
 		record := w.entryToMMDBRecord(entry)
@@ -115,15 +203,20 @@ func (w *Writer) CompileToMMDB(entries []ReputationEntry, outputPath string) err
 		err := tree.Insert(ipNet, record)
 		if err != nil {
 			logger.Debug(fmt.Sprintf("Failed to insert %s: %v", entry.Prefix, err))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", entry.Prefix, err)
+			}
 			errorCount++
 			continue
 		}
 		insertedCount++
 	}
+	return insertedCount, errorCount, firstErr
+}
 
-	// Write to file
-	tempPath := outputPath + ".tmp"
-	file, err := os.Create(tempPath)
+// writeTree writes tree to path, removing the file if writing fails
+func writeTree(tree *mmdbwriter.Tree, path string) error {
+	file, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
@@ -131,20 +224,87 @@ func (w *Writer) CompileToMMDB(entries []ReputationEntry, outputPath string) err
 	_, err = tree.WriteTo(file)
 	file.Close()
 	if err != nil {
-		os.Remove(tempPath)
+		os.Remove(path)
 		return fmt.Errorf("failed to write MMDB: %w", err)
 	}
+	return nil
+}
 
-	// Atomic rename
-	if err := os.Rename(tempPath, outputPath); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to rename output file: %w", err)
+// RecordSizeAuto makes CompileToMMDB pick the record size from the number of
+// entries
+const RecordSizeAuto = 0
+
+// ParseRecordSize validates a record size setting; empty and "auto" select
+// RecordSizeAuto
+func ParseRecordSize(s string) (int, error) {
+	switch s {
+	case "", "auto":
+		return RecordSizeAuto, nil
+	case "24", "28", "32":
+		return strconv.Atoi(s)
+	default:
+		return 0, fmt.Errorf("invalid record size %q (want auto, 24, 28 or 32)", s)
+	}
+}
+
+// Rough search tree nodes and data section bytes each entry adds. A record
+// points at a node or into the data section, so their sum bounds the largest
+// value a record holds.
+const (
+	estimatedNodesPerEntry = 16
+	estimatedDataPerEntry  = 160
+)
+
+// estimateRecordSize returns the smallest record size expected to address a
+// database of n entries
+func estimateRecordSize(n int) int {
+	need := n * (estimatedNodesPerEntry + estimatedDataPerEntry)
+	for _, size := range []int{24, 28} {
+		if need < 1<<size {
+			return size
+		}
 	}
+	return 32
+}
 
-	logger.Info(fmt.Sprintf("MMDB compilation complete: %d entries inserted, %d errors, took %v",
-		insertedCount, errorCount, time.Since(startTime)))
+// nextRecordSize returns the record size after size
+func nextRecordSize(size int) int {
+	if size < 28 {
+		return 28
+	}
+	return 32
+}
 
-	return nil
+// isRecordCapacityError reports whether a write failed because the database
+// has more nodes and data than the record size can address
+func isRecordCapacityError(err error) bool {
+	return strings.Contains(err.Error(), "exceeded record capacity")
+}
+
+// filterIPVersion drops entries that cannot be inserted into a tree of the
+// configured IP version. IPv4-only trees take IPv4-mapped IPv6 prefixes as
+// IPv4 and skip the other IPv6 entries; IPv6 trees hold both families.
+func (w *Writer) filterIPVersion(entries []ReputationEntry) ([]ReputationEntry, int, error) {
+	switch w.config.IPVersion {
+	case 0, 6:
+		return entries, 0, nil
+	case 4:
+	default:
+		return nil, 0, fmt.Errorf("invalid IP version %d: must be 4, 6 or 0 for both", w.config.IPVersion)
+	}
+
+	kept := make([]ReputationEntry, 0, len(entries))
+	for _, entry := range entries {
+		addr := entry.Prefix.Addr()
+		if addr.Is4In6() && entry.Prefix.Bits() >= 96 {
+			entry.Prefix = netip.PrefixFrom(addr.Unmap(), entry.Prefix.Bits()-96)
+		}
+		if !entry.Prefix.Addr().Is4() {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept, len(entries) - len(kept), nil
 }
 
 // entryToMMDBRecord converts a ReputationEntry to MMDB record format
@@ -172,6 +332,46 @@ func (w *Writer) entryToMMDBRecord(entry ReputationEntry) mmdbtype.DataType {
 		"is_attacker":   mmdbtype.Bool(entry.Flags.IsAttacker),
 	}
 
+	if entry.AggregateConfidence > 0 {
+		record["aggregate_confidence"] = mmdbtype.Uint16(int(math.Round(entry.AggregateConfidence * 100)))
+	}
+
+	if len(entry.Tags) > 0 {
+		tags := mmdbtype.Slice{}
+		for _, t := range entry.Tags {
+			tags = append(tags, mmdbtype.String(t))
+		}
+		record["tags"] = tags
+	}
+
+	return record
+}
+
+// Record returns the entry as LookupReputation would read it back from a
+// compiled database
+func (e ReputationEntry) Record() *ReputationRecord {
+	record := &ReputationRecord{
+		RiskScore:    e.RiskScore,
+		RiskLevel:    e.RiskLevel,
+		IsTor:        e.Flags.IsTor,
+		IsVPN:        e.Flags.IsVPN,
+		IsProxy:      e.Flags.IsProxy,
+		IsDatacenter: e.Flags.IsDatacenter,
+		IsBotnet:     e.Flags.IsBotnet,
+		IsMalware:    e.Flags.IsMalware,
+		IsSpam:       e.Flags.IsSpam,
+		IsAttacker:   e.Flags.IsAttacker,
+		ThreatType:   e.ThreatType,
+		Confidence:   int(e.Confidence * 100),
+		Sources:      e.Sources,
+		LastUpdate:   e.LastUpdate.Unix(),
+	}
+	if e.AggregateConfidence > 0 {
+		record.AggregateConfidence = int(math.Round(e.AggregateConfidence * 100))
+	}
+	if len(e.Tags) > 0 {
+		record.Tags = e.Tags
+	}
 	return record
 }
 
@@ -219,10 +419,11 @@ func (w *Writer) CompileFromIPReputations(reputations []models.IPReputation, out
 		entry := ReputationEntry{
 			Prefix:     prefix,
 			RiskScore:  rep.RiskScore,
-			RiskLevel:  classifyRisk(rep.RiskScore),
+			RiskLevel:  w.config.RiskThresholds.Classify(rep.RiskScore),
 			ThreatType: rep.ThreatType,
 			Confidence: rep.Confidence,
 			Sources:    []string{rep.Source},
+			Tags:       rep.Metadata.Tags,
 			Flags:      threatTypeToFlags(rep.ThreatType),
 			LastUpdate: rep.LastSeen,
 		}
@@ -233,22 +434,6 @@ func (w *Writer) CompileFromIPReputations(reputations []models.IPReputation, out
 	return w.CompileToMMDB(entries, outputPath)
 }
 
-// classifyRisk returns risk level based on score
-func classifyRisk(score int) string {
-	switch {
-	case score >= 85:
-		return "critical"
-	case score >= 70:
-		return "high"
-	case score >= 50:
-		return "medium"
-	case score >= 25:
-		return "low"
-	default:
-		return "clean"
-	}
-}
-
 // threatTypeToFlags converts threat type to flags
 func threatTypeToFlags(threatType string) EntryFlags {
 	flags := EntryFlags{}
@@ -277,8 +462,21 @@ func threatTypeToFlags(threatType string) EntryFlags {
 
 // MergeAndCompile merges multiple reputation sources and compiles to MMDB
 func (w *Writer) MergeAndCompile(sources map[string][]models.IPReputation, outputPath string) error {
-	// Merge entries by IP, keeping highest risk scores
+	entries := w.MergeReputations(sources)
+
+	logger.Info(fmt.Sprintf("Merged %d unique IP ranges from %d sources", len(entries), len(sources)))
+
+	return w.CompileToMMDB(entries, outputPath)
+}
+
+// MergeReputations merges entries by IP range, keeping the highest risk
+// score and the union of sources, tags and flags. Ranges listed by several
+// sources get an aggregate confidence and, with enough of them, the
+// corroboration bonus.
+func (w *Writer) MergeReputations(sources map[string][]models.IPReputation) []ReputationEntry {
 	merged := make(map[string]ReputationEntry)
+	// Highest confidence each source gives a range
+	confidences := make(map[string]map[string]float64)
 
 	for sourceName, reputations := range sources {
 		for _, rep := range reputations {
@@ -294,33 +492,32 @@ func (w *Writer) MergeAndCompile(sources map[string][]models.IPReputation, outpu
 				merged[key] = ReputationEntry{
 					Prefix:     prefix,
 					RiskScore:  rep.RiskScore,
-					RiskLevel:  classifyRisk(rep.RiskScore),
+					RiskLevel:  w.config.RiskThresholds.Classify(rep.RiskScore),
 					ThreatType: rep.ThreatType,
 					Confidence: rep.Confidence,
 					Sources:    []string{sourceName},
+					Tags:       rep.Metadata.Tags,
 					Flags:      threatTypeToFlags(rep.ThreatType),
 					LastUpdate: rep.LastSeen,
 				}
+				confidences[key] = map[string]float64{sourceName: rep.Confidence}
 			} else {
 				// Merge: keep higher score, combine sources
 				if rep.RiskScore > existing.RiskScore {
 					existing.RiskScore = rep.RiskScore
-					existing.RiskLevel = classifyRisk(rep.RiskScore)
+					existing.RiskLevel = w.config.RiskThresholds.Classify(rep.RiskScore)
 				}
 				if rep.Confidence > existing.Confidence {
 					existing.Confidence = rep.Confidence
 				}
 				// Add source if not already present
-				sourceExists := false
-				for _, s := range existing.Sources {
-					if s == sourceName {
-						sourceExists = true
-						break
-					}
-				}
-				if !sourceExists {
+				if !slices.Contains(existing.Sources, sourceName) {
 					existing.Sources = append(existing.Sources, sourceName)
 				}
+				if rep.Confidence > confidences[key][sourceName] {
+					confidences[key][sourceName] = rep.Confidence
+				}
+				existing.Tags = mergeTags(existing.Tags, rep.Metadata.Tags)
 				// Merge flags
 				newFlags := threatTypeToFlags(rep.ThreatType)
 				existing.Flags.IsTor = existing.Flags.IsTor || newFlags.IsTor
@@ -343,13 +540,42 @@ func (w *Writer) MergeAndCompile(sources map[string][]models.IPReputation, outpu
 
 	// Convert map to slice
 	entries := make([]ReputationEntry, 0, len(merged))
-	for _, entry := range merged {
+	for key, entry := range merged {
+		if len(entry.Sources) > 1 {
+			entry.AggregateConfidence = aggregateConfidence(confidences[key])
+			if n := w.config.CorroborationSources; n > 0 && len(entry.Sources) >= n {
+				entry.RiskScore = min(entry.RiskScore+w.config.CorroborationBonus, 100)
+				entry.RiskLevel = w.config.RiskThresholds.Classify(entry.RiskScore)
+			}
+		}
 		entries = append(entries, entry)
 	}
+	return entries
+}
 
-	logger.Info(fmt.Sprintf("Merged %d unique IP ranges from %d sources", len(entries), len(sources)))
+// aggregateConfidence is the chance that at least one source is right when
+// each is right independently with its own confidence: 1 - Π(1 - c). Every
+// further source raises it by less than the one before. Sources without a
+// confidence count as 0.5.
+func aggregateConfidence(bySource map[string]float64) float64 {
+	doubt := 1.0
+	for _, c := range bySource {
+		if c <= 0 {
+			c = 0.5
+		}
+		doubt *= 1 - min(c, 1)
+	}
+	return 1 - doubt
+}
 
-	return w.CompileToMMDB(entries, outputPath)
+// mergeTags returns the union of two tag lists, keeping first-seen order
+func mergeTags(a, b []string) []string {
+	for _, tag := range b {
+		if !slices.Contains(a, tag) {
+			a = append(a, tag)
+		}
+	}
+	return a
 }
 
 // parseToPrefix parses a string to netip.Prefix
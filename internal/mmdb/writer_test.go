@@ -0,0 +1,142 @@
+package mmdb
+
+import (
+	"math"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestEstimateRecordSize(t *testing.T) {
+	tests := []struct {
+		entries int
+		want    int
+	}{
+		{0, 24},
+		{50_000, 24},
+		{500_000, 28},
+		{5_000_000, 32},
+	}
+	for _, tt := range tests {
+		if got := estimateRecordSize(tt.entries); got != tt.want {
+			t.Errorf("estimateRecordSize(%d) = %d, want %d", tt.entries, got, tt.want)
+		}
+	}
+}
+
+func TestParseRecordSize(t *testing.T) {
+	for in, want := range map[string]int{"": RecordSizeAuto, "auto": RecordSizeAuto, "24": 24, "28": 28, "32": 32} {
+		if got, err := ParseRecordSize(in); err != nil || got != want {
+			t.Errorf("ParseRecordSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"16", "30", "large"} {
+		if _, err := ParseRecordSize(in); err == nil {
+			t.Errorf("ParseRecordSize(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestCompileAutoRecordSize(t *testing.T) {
+	cfg := DefaultWriterConfig()
+	cfg.RecordSize = RecordSizeAuto
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+
+	err := NewWriter(cfg).CompileToMMDB([]ReputationEntry{{
+		Prefix:     netip.MustParsePrefix("45.155.205.0/24"),
+		RiskScore:  80,
+		ThreatType: "attack",
+		LastUpdate: time.Now(),
+	}}, path)
+	if err != nil {
+		t.Fatalf("CompileToMMDB: %v", err)
+	}
+
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		t.Fatalf("maxminddb.Open: %v", err)
+	}
+	defer db.Close()
+	if db.Metadata.RecordSize != 24 {
+		t.Errorf("record size = %d, want 24 for a small database", db.Metadata.RecordSize)
+	}
+}
+
+func TestMergeAndCompileCorroboration(t *testing.T) {
+	proxy := func(ipRange string, confidence float64) models.IPReputation {
+		return models.IPReputation{IPRange: ipRange, RiskScore: 50, ThreatType: "proxy", Confidence: confidence}
+	}
+	// 45.155.205.1 is listed by one feed, 45.155.205.2 by six
+	sources := map[string][]models.IPReputation{
+		"feed_a": {proxy("45.155.205.1", 0.6), proxy("45.155.205.2", 0.6)},
+	}
+	for _, name := range []string{"feed_b", "feed_c", "feed_d", "feed_e", "feed_f"} {
+		sources[name] = []models.IPReputation{proxy("45.155.205.2", 0.6)}
+	}
+
+	w := NewDefaultWriter()
+	entries := make(map[netip.Prefix]ReputationEntry)
+	for _, e := range w.MergeReputations(sources) {
+		entries[e.Prefix] = e
+	}
+
+	single := entries[netip.MustParsePrefix("45.155.205.1/32")]
+	if single.AggregateConfidence != 0 || single.RiskScore != 50 {
+		t.Errorf("single source: aggregate %v score %d, want 0 and 50", single.AggregateConfidence, single.RiskScore)
+	}
+	multi := entries[netip.MustParsePrefix("45.155.205.2/32")]
+	if want := 1 - math.Pow(0.4, 6); math.Abs(multi.AggregateConfidence-want) > 1e-9 {
+		t.Errorf("six sources: aggregate %v, want %v", multi.AggregateConfidence, want)
+	}
+	if multi.RiskScore != 60 {
+		t.Errorf("six sources: score %d, want 60 with the corroboration bonus", multi.RiskScore)
+	}
+
+	path := filepath.Join(t.TempDir(), "reputation.mmdb")
+	if err := w.MergeAndCompile(sources, path); err != nil {
+		t.Fatalf("MergeAndCompile: %v", err)
+	}
+	reader, err := NewReader(path, "", "")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer reader.Close()
+
+	rec, err := reader.LookupReputation(netip.MustParseAddr("45.155.205.2"))
+	if err != nil || rec == nil {
+		t.Fatalf("LookupReputation = %+v, %v", rec, err)
+	}
+	if rec.AggregateConfidence != 100 || rec.Confidence != 60 {
+		t.Errorf("record confidence %d aggregate %d, want 60 and 100", rec.Confidence, rec.AggregateConfidence)
+	}
+	rec, _ = reader.LookupReputation(netip.MustParseAddr("45.155.205.1"))
+	if rec == nil || rec.AggregateConfidence != 0 {
+		t.Errorf("single-source record = %+v, want no aggregate confidence", rec)
+	}
+}
+
+func TestAggregateConfidence(t *testing.T) {
+	tests := []struct {
+		name     string
+		bySource map[string]float64
+		want     float64
+	}{
+		{"one source", map[string]float64{"a": 0.7}, 0.7},
+		{"two sources", map[string]float64{"a": 0.5, "b": 0.5}, 0.75},
+		{"three sources", map[string]float64{"a": 0.5, "b": 0.5, "c": 0.5}, 0.875},
+		{"missing confidence counts as 0.5", map[string]float64{"a": 0, "b": 0.5}, 0.75},
+		{"certain source", map[string]float64{"a": 1, "b": 0.2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aggregateConfidence(tt.bySource); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("aggregateConfidence = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
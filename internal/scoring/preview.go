@@ -0,0 +1,172 @@
+package scoring
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// Validate checks a scoring configuration and returns one message per problem
+func (c Config) Validate() []string {
+	var errs []string
+	known := DefaultConfig()
+
+	for _, threatType := range sortedKeys(c.ThreatWeights) {
+		weight := c.ThreatWeights[threatType]
+		if _, ok := known.ThreatWeights[threatType]; !ok {
+			errs = append(errs, fmt.Sprintf("threat_weights.%s: unknown threat type", threatType))
+		}
+		if weight < 0 || weight > 100 {
+			errs = append(errs, fmt.Sprintf("threat_weights.%s: must be between 0 and 100, got %d", threatType, weight))
+		}
+	}
+
+	for _, asnType := range sortedKeys(c.ASNTypeModifiers) {
+		modifier := c.ASNTypeModifiers[asnType]
+		if _, ok := known.ASNTypeModifiers[asnType]; !ok {
+			errs = append(errs, fmt.Sprintf("asn_type_modifiers.%s: unknown ASN type", asnType))
+		}
+		if modifier < -100 || modifier > 100 {
+			errs = append(errs, fmt.Sprintf("asn_type_modifiers.%s: must be between -100 and 100, got %d", asnType, modifier))
+		}
+	}
+
+	if c.DecayLambda < 0 {
+		errs = append(errs, fmt.Sprintf("decay_lambda: must not be negative, got %g", c.DecayLambda))
+	}
+	for _, threatType := range sortedKeys(c.ThreatDecayLambdas) {
+		lambda := c.ThreatDecayLambdas[threatType]
+		if _, ok := known.ThreatWeights[threatType]; !ok {
+			errs = append(errs, fmt.Sprintf("threat_decay_lambdas.%s: unknown threat type", threatType))
+		}
+		if lambda < 0 {
+			errs = append(errs, fmt.Sprintf("threat_decay_lambdas.%s: must not be negative, got %g", threatType, lambda))
+		}
+	}
+	for _, alias := range sortedKeys(c.ThreatTypeAliases) {
+		if _, ok := known.ThreatWeights[c.ThreatTypeAliases[alias]]; !ok {
+			errs = append(errs, fmt.Sprintf("threat_type_aliases.%s: unknown threat type %q", alias, c.ThreatTypeAliases[alias]))
+		}
+	}
+	if c.MaxAge <= 0 {
+		errs = append(errs, "max_age: must be positive")
+	}
+	if c.MinScore < 0 {
+		errs = append(errs, fmt.Sprintf("min_score: must not be negative, got %d", c.MinScore))
+	}
+	if c.MaxScore <= c.MinScore {
+		errs = append(errs, fmt.Sprintf("max_score: must be greater than min_score (%d), got %d", c.MinScore, c.MaxScore))
+	}
+	if c.MultiThreatMultiplier <= 0 {
+		errs = append(errs, fmt.Sprintf("multi_threat_multiplier: must be positive, got %g", c.MultiThreatMultiplier))
+	}
+	if c.DatacenterMultiplier <= 0 {
+		errs = append(errs, fmt.Sprintf("datacenter_multiplier: must be positive, got %g", c.DatacenterMultiplier))
+	}
+	if c.HighConfidenceThreshold < 0 || c.HighConfidenceThreshold > 1 {
+		errs = append(errs, fmt.Sprintf("high_confidence_threshold: must be between 0 and 1, got %g", c.HighConfidenceThreshold))
+	}
+	if c.HighConfidenceBonus < 0 {
+		errs = append(errs, fmt.Sprintf("high_confidence_bonus: must not be negative, got %d", c.HighConfidenceBonus))
+	}
+	switch c.Curve {
+	case CurveLinear, CurveSaturating:
+	default:
+		errs = append(errs, fmt.Sprintf("curve: must be %s or %s, got %q", CurveLinear, CurveSaturating, c.Curve))
+	}
+	if c.SaturationFactor <= 0 || c.SaturationFactor > 1 {
+		errs = append(errs, fmt.Sprintf("saturation_factor: must be greater than 0 and at most 1, got %g", c.SaturationFactor))
+	}
+	if err := c.RiskThresholds.Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("risk_thresholds: %v", err))
+	}
+
+	return errs
+}
+
+// SampleCase is a representative IP profile used to preview scoring changes
+type SampleCase struct {
+	Name    string
+	Threats []models.Threat
+	ASN     *models.ASNInfo
+}
+
+// SampleCases returns the built-in sample set relative to now
+func SampleCases(now time.Time) []SampleCase {
+	day := 24 * time.Hour
+	datacenter := &models.ASNInfo{ASN: 14061, Org: "Sample Hosting", ASNType: "datacenter"}
+	isp := &models.ASNInfo{ASN: 7922, Org: "Sample ISP", ASNType: "isp"}
+	business := &models.ASNInfo{ASN: 64500, Org: "Sample Corp", ASNType: "business"}
+
+	return []SampleCase{
+		{Name: "clean_residential", ASN: isp},
+		{Name: "fresh_botnet_c2", Threats: []models.Threat{
+			{ThreatType: "botnet_c2", Source: "abuse_feodo", Confidence: 0.95, LastSeen: now},
+		}, ASN: datacenter},
+		{Name: "tor_exit", Threats: []models.Threat{
+			{ThreatType: "tor", Source: "tor_exit", Confidence: 1.0, LastSeen: now},
+		}, ASN: datacenter},
+		{Name: "stale_spam", Threats: []models.Threat{
+			{ThreatType: "spam", Source: "spamhaus_drop", Confidence: 0.8, LastSeen: now.Add(-60 * day)},
+		}, ASN: isp},
+		{Name: "datacenter_proxy", Threats: []models.Threat{
+			{ThreatType: "proxy", Source: "proxy_list", Confidence: 0.6, LastSeen: now.Add(-2 * day)},
+			{ThreatType: "datacenter", Source: "datacenter_asn", Confidence: 0.9, LastSeen: now},
+		}, ASN: datacenter},
+		{Name: "corporate_vpn", Threats: []models.Threat{
+			{ThreatType: "vpn", Source: "vpn_provider", Confidence: 0.7, LastSeen: now.Add(-7 * day)},
+		}, ASN: business},
+		{Name: "multi_threat_attacker", Threats: []models.Threat{
+			{ThreatType: "attack", Source: "firehol_level1", Confidence: 0.9, LastSeen: now},
+			{ThreatType: "malware", Source: "abuse_feodo", Confidence: 0.85, LastSeen: now.Add(-3 * day)},
+			{ThreatType: "suspicious", Source: "firehol_level2", Confidence: 0.5, LastSeen: now.Add(-30 * day)},
+		}, ASN: isp},
+	}
+}
+
+// PreviewResult compares a sample's score under the current and proposed configs
+type PreviewResult struct {
+	Name              string `json:"name"`
+	CurrentScore      int    `json:"current_score"`
+	ProposedScore     int    `json:"proposed_score"`
+	Delta             int    `json:"delta"`
+	CurrentRiskLevel  string `json:"current_risk_level"`
+	ProposedRiskLevel string `json:"proposed_risk_level"`
+}
+
+// Preview scores the built-in sample set under both configurations
+func Preview(current, proposed Config, now time.Time) []PreviewResult {
+	currentScorer := New(current)
+	proposedScorer := New(proposed)
+
+	samples := SampleCases(now)
+	results := make([]PreviewResult, 0, len(samples))
+
+	for _, sample := range samples {
+		before := currentScorer.CalculateScore(sample.Threats, sample.ASN, now)
+		after := proposedScorer.CalculateScore(sample.Threats, sample.ASN, now)
+
+		results = append(results, PreviewResult{
+			Name:              sample.Name,
+			CurrentScore:      before,
+			ProposedScore:     after,
+			Delta:             after - before,
+			CurrentRiskLevel:  currentScorer.ClassifyRisk(before),
+			ProposedRiskLevel: proposedScorer.ClassifyRisk(after),
+		})
+	}
+
+	return results
+}
+
+// sortedKeys returns map keys in a stable order for deterministic messages
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
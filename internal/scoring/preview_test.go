@@ -0,0 +1,80 @@
+package scoring
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	if errs := DefaultConfig().Validate(); len(errs) != 0 {
+		t.Fatalf("DefaultConfig().Validate() = %v, want no errors", errs)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{"negative weight", func(c *Config) { c.ThreatWeights["tor"] = -5 }, []string{"threat_weights.tor: must be between 0 and 100"}},
+		{"weight over 100", func(c *Config) { c.ThreatWeights["spam"] = 150 }, []string{"threat_weights.spam: must be between 0 and 100"}},
+		{"unknown threat type", func(c *Config) { c.ThreatWeights["phishing"] = 50 }, []string{"threat_weights.phishing: unknown threat type"}},
+		{"unknown ASN type", func(c *Config) { c.ASNTypeModifiers["satellite"] = 5 }, []string{"asn_type_modifiers.satellite: unknown ASN type"}},
+		{"negative decay", func(c *Config) { c.DecayLambda = -0.1 }, []string{"decay_lambda: must not be negative"}},
+		{"inverted bounds", func(c *Config) { c.MinScore, c.MaxScore = 50, 40 }, []string{"max_score: must be greater than min_score"}},
+		{"threshold out of range", func(c *Config) { c.HighConfidenceThreshold = 2 }, []string{"high_confidence_threshold: must be between 0 and 1"}},
+		{"multiple problems", func(c *Config) {
+			c.ThreatWeights["tor"] = -1
+			c.MultiThreatMultiplier = 0
+		}, []string{"threat_weights.tor", "multi_threat_multiplier: must be positive"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+
+			errs := cfg.Validate()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Validate() = %v, want %d errors", errs, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(errs[i], want) {
+					t.Errorf("Validate()[%d] = %q, want prefix %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	now := time.Now()
+	current := DefaultConfig()
+
+	// Identical configs produce no deltas
+	for _, r := range Preview(current, current, now) {
+		if r.Delta != 0 {
+			t.Errorf("%s: delta = %d for identical configs, want 0", r.Name, r.Delta)
+		}
+	}
+
+	proposed := DefaultConfig()
+	proposed.ThreatWeights["tor"] = 20
+
+	var torDelta int
+	found := false
+	for _, r := range Preview(current, proposed, now) {
+		if r.Name == "tor_exit" {
+			torDelta = r.Delta
+			found = true
+		} else if r.Name == "clean_residential" && r.Delta != 0 {
+			t.Errorf("clean_residential delta = %d, want 0", r.Delta)
+		}
+	}
+	if !found {
+		t.Fatal("tor_exit sample missing from preview")
+	}
+	if torDelta >= 0 {
+		t.Errorf("tor_exit delta = %d, want negative after lowering tor weight", torDelta)
+	}
+}
@@ -1,12 +1,21 @@
 package scoring
 
 import (
+	"fmt"
 	"math"
+	"sort"
 	"time"
 
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
 	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
 
+// Score curves
+const (
+	CurveLinear     = "linear"     // Contributions add up and are clamped at MaxScore
+	CurveSaturating = "saturating" // Repeated threats of the same type give diminishing returns
+)
+
 // Config holds scoring configuration
 type Config struct {
 	// Base weights for each threat type
@@ -16,13 +25,33 @@ type Config struct {
 	ASNTypeModifiers map[string]int
 
 	// Time decay parameters
-	DecayLambda float64 // Decay rate (higher = faster decay)
-	MaxAge      time.Duration
+	DecayLambda        float64            // Decay rate (higher = faster decay)
+	ThreatDecayLambdas map[string]float64 // Per threat type overrides of DecayLambda
+	MaxAge             time.Duration
+
+	// ThreatTypeAliases map feed labels (c2, bruteforce, ...) to canonical
+	// threat types, the keys of ThreatWeights
+	ThreatTypeAliases map[string]string
 
 	// Score bounds
 	MinScore int
 	MaxScore int
 
+	// Minimum score of each risk level
+	RiskThresholds models.RiskThresholds
+
+	// Curve selects how contributions combine. With CurveSaturating the n-th
+	// strongest threat of a type (from 0) contributes SaturationFactor^n of
+	// its value, so many reports of one weak signal rise slowly.
+	Curve            string
+	SaturationFactor float64
+
+	// TrustedASNs are networks of CDNs and cloud providers whose shared
+	// addresses often land in proxy and datacenter feeds. Scores of IPs in
+	// them are capped at TrustedASNMaxScore.
+	TrustedASNs        map[int]bool
+	TrustedASNMaxScore int
+
 	// Multipliers
 	MultiThreatMultiplier   float64
 	DatacenterMultiplier    float64
@@ -54,10 +83,20 @@ func DefaultConfig() Config {
 			"education":  -20,
 			"government": -25,
 		},
-		DecayLambda:             0.01,                 // ~70 day half-life
+		DecayLambda: 0.01, // ~70 day half-life
+		ThreatDecayLambdas: map[string]float64{
+			"tor":       0.05,  // Exit relays churn daily, ~14 day half-life
+			"proxy":     0.03,  // ~23 day half-life
+			"botnet_c2": 0.005, // C2 infrastructure persists, ~139 day half-life
+			"hijacked":  0.005,
+		},
 		MaxAge:                  180 * 24 * time.Hour, // 180 days
+		ThreatTypeAliases:       copyAliases(DefaultThreatTypeAliases),
 		MinScore:                0,
 		MaxScore:                100,
+		RiskThresholds:          models.DefaultRiskThresholds,
+		Curve:                   CurveLinear,
+		SaturationFactor:        0.5,
 		MultiThreatMultiplier:   1.1,
 		DatacenterMultiplier:    1.15,
 		HighConfidenceThreshold: 0.9,
@@ -65,6 +104,72 @@ func DefaultConfig() Config {
 	}
 }
 
+// FromConfig returns the default scoring configuration with the settings
+// from the application config applied
+func FromConfig(sc config.ScoringConfig) (Config, error) {
+	cfg := DefaultConfig()
+	if sc.DecayLambda > 0 {
+		cfg.DecayLambda = sc.DecayLambda
+	}
+	for threatType, lambda := range sc.DecayLambdas {
+		if _, ok := cfg.ThreatWeights[threatType]; !ok {
+			return cfg, fmt.Errorf("invalid scoring.decay_lambdas: unknown threat type %q", threatType)
+		}
+		if lambda < 0 {
+			return cfg, fmt.Errorf("invalid scoring.decay_lambdas.%s: must not be negative", threatType)
+		}
+		cfg.ThreatDecayLambdas[threatType] = lambda
+	}
+	aliases, err := ThreatTypeAliases(sc.ThreatTypeAliases)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ThreatTypeAliases = aliases
+	if sc.MaxScore > 0 {
+		cfg.MaxScore = sc.MaxScore
+	}
+	if sc.Curve != "" {
+		cfg.Curve = sc.Curve
+	}
+	if sc.SaturationFactor > 0 {
+		cfg.SaturationFactor = sc.SaturationFactor
+	}
+	switch cfg.Curve {
+	case CurveLinear, CurveSaturating:
+	default:
+		return cfg, fmt.Errorf("invalid scoring.curve %q: must be %s or %s", cfg.Curve, CurveLinear, CurveSaturating)
+	}
+	if cfg.SaturationFactor > 1 {
+		return cfg, fmt.Errorf("invalid scoring.saturation_factor %g: must be between 0 and 1", cfg.SaturationFactor)
+	}
+	if cfg.MaxScore > 100 {
+		return cfg, fmt.Errorf("invalid scoring.max_score %d: must not exceed 100", cfg.MaxScore)
+	}
+	cfg.RiskThresholds = models.RiskThresholds{
+		Low:      sc.RiskThresholds.Low,
+		Medium:   sc.RiskThresholds.Medium,
+		High:     sc.RiskThresholds.High,
+		Critical: sc.RiskThresholds.Critical,
+	}
+	if err := cfg.RiskThresholds.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid scoring.risk_thresholds: %w", err)
+	}
+	if len(sc.TrustedASNs) > 0 {
+		cfg.TrustedASNs = make(map[int]bool, len(sc.TrustedASNs))
+		for _, asn := range sc.TrustedASNs {
+			if asn <= 0 {
+				return cfg, fmt.Errorf("invalid scoring.trusted_asns: %d is not an ASN", asn)
+			}
+			cfg.TrustedASNs[asn] = true
+		}
+	}
+	if sc.TrustedASNMaxScore < 0 || sc.TrustedASNMaxScore > cfg.MaxScore {
+		return cfg, fmt.Errorf("invalid scoring.trusted_asn_max_score %d: must be between 0 and max_score", sc.TrustedASNMaxScore)
+	}
+	cfg.TrustedASNMaxScore = sc.TrustedASNMaxScore
+	return cfg, nil
+}
+
 // Scorer calculates risk scores for IPs
 type Scorer struct {
 	config Config
@@ -81,24 +186,30 @@ func NewDefault() *Scorer {
 }
 
 // CalculateScore calculates the risk score for an IP based on threat data
-// Formula: S = min(100, Σ(W×K×C) × D(t) × M)
+// Formula: S = min(MaxScore, Σ(W×K×C) × D(t) × M)
 // Where:
 //   - W = Weight of threat type
 //   - K = Confidence factor from source
 //   - C = Source credibility (0.0-1.0)
 //   - D(t) = Time decay function: e^(-λt) where t is days since last seen
 //   - M = Multipliers (multi-threat, datacenter, etc.)
+//
+// With CurveSaturating the sum is taken per threat type with diminishing
+// weight for each further report of that type.
 func (s *Scorer) CalculateScore(threats []models.Threat, asnInfo *models.ASNInfo, now time.Time) int {
 	if len(threats) == 0 {
 		return s.config.MinScore
 	}
 
-	var totalScore float64
 	threatTypes := make(map[string]bool)
+	contributions := make(map[string][]float64)
+	var typeOrder []string
 
 	for _, threat := range threats {
+		threatType, _ := s.config.NormalizeThreatType(threat.ThreatType)
+
 		// Get base weight for threat type
-		weight := s.getThreatWeight(threat.ThreatType)
+		weight := s.getThreatWeight(threatType)
 
 		// Apply confidence factor
 		confidence := threat.Confidence
@@ -107,13 +218,21 @@ func (s *Scorer) CalculateScore(threats []models.Threat, asnInfo *models.ASNInfo
 		}
 
 		// Calculate time decay
-		decay := s.calculateDecay(threat.LastSeen, now)
+		decay := s.calculateDecay(threatType, threat.LastSeen, now)
 
 		// Calculate contribution from this threat
 		contribution := float64(weight) * confidence * decay
 
-		totalScore += contribution
-		threatTypes[threat.ThreatType] = true
+		if !threatTypes[threatType] {
+			typeOrder = append(typeOrder, threatType)
+		}
+		contributions[threatType] = append(contributions[threatType], contribution)
+		threatTypes[threatType] = true
+	}
+
+	var totalScore float64
+	for _, threatType := range typeOrder {
+		totalScore += s.combine(contributions[threatType])
 	}
 
 	// Apply multi-threat multiplier if multiple different threat types found
@@ -122,15 +241,7 @@ func (s *Scorer) CalculateScore(threats []models.Threat, asnInfo *models.ASNInfo
 	}
 
 	// Apply ASN type modifier
-	if asnInfo != nil {
-		modifier := s.getASNModifier(asnInfo.ASNType)
-		totalScore += float64(modifier)
-
-		// Additional datacenter multiplier
-		if asnInfo.ASNType == "datacenter" || asnInfo.ASNType == "hosting" {
-			totalScore *= s.config.DatacenterMultiplier
-		}
-	}
+	totalScore = s.applyASN(totalScore, asnInfo)
 
 	// Apply high confidence bonus
 	for _, threat := range threats {
@@ -140,21 +251,113 @@ func (s *Scorer) CalculateScore(threats []models.Threat, asnInfo *models.ASNInfo
 		}
 	}
 
-	// Clamp score to bounds
-	score := int(math.Round(totalScore))
+	return s.capTrusted(s.clamp(totalScore), asnInfo)
+}
+
+// applyASN adds the ASN type and per-ASN modifiers and applies the
+// datacenter multiplier
+func (s *Scorer) applyASN(total float64, asnInfo *models.ASNInfo) float64 {
+	if asnInfo == nil {
+		return total
+	}
+
+	total += float64(s.getASNModifier(asnInfo.ASNType) + asnInfo.RiskModifier)
+
+	// Additional datacenter multiplier
+	if isHostingType(asnInfo.ASNType) {
+		total *= s.config.DatacenterMultiplier
+	}
+	return total
+}
+
+// clamp rounds a raw score into [MinScore, MaxScore]
+func (s *Scorer) clamp(total float64) int {
+	score := int(math.Round(total))
 	if score < s.config.MinScore {
 		score = s.config.MinScore
 	}
 	if score > s.config.MaxScore {
 		score = s.config.MaxScore
 	}
+	return score
+}
 
+// capTrusted limits the score of an IP in a trusted ASN
+func (s *Scorer) capTrusted(score int, asnInfo *models.ASNInfo) int {
+	if s.IsTrustedASN(asnInfo) && score > s.config.TrustedASNMaxScore {
+		return s.config.TrustedASNMaxScore
+	}
 	return score
 }
 
+// IsTrustedASN reports whether asnInfo is one of the trusted ASNs
+func (s *Scorer) IsTrustedASN(asnInfo *models.ASNInfo) bool {
+	return asnInfo != nil && s.config.TrustedASNs[asnInfo.ASN]
+}
+
+// ApplyASN folds the ASN modifiers into a lookup result. Compiled MMDB scores
+// are calculated without ASN data, so lookups call this once the ASN type is
+// known. Hosting ASNs set the datacenter flag; IPs without a reputation score
+// stay clean, and IPs in trusted ASNs are capped.
+func (s *Scorer) ApplyASN(result *models.IPCheckResult) {
+	if result == nil || result.ASN == nil {
+		return
+	}
+	if s.IsTrustedASN(result.ASN) {
+		s.setScore(result, s.capTrusted(result.Score, result.ASN))
+	}
+	if result.ASN.ASNType == "" {
+		return
+	}
+	if isHostingType(result.ASN.ASNType) {
+		result.IsDatacenter = true
+	}
+	if result.Score <= s.config.MinScore {
+		return
+	}
+
+	s.setScore(result, s.capTrusted(s.clamp(s.applyASN(float64(result.Score), result.ASN)), result.ASN))
+}
+
+// setScore updates the score and risk level of a lookup result
+func (s *Scorer) setScore(result *models.IPCheckResult, score int) {
+	result.Score = score
+	result.RiskScore = score
+	result.RiskLevel = s.ClassifyRisk(score)
+}
+
+// isHostingType reports whether an ASN type is a datacenter or hosting provider
+func isHostingType(asnType string) bool {
+	return asnType == "datacenter" || asnType == "hosting"
+}
+
+// combine sums the contributions of one threat type according to the curve
+func (s *Scorer) combine(contributions []float64) float64 {
+	if s.config.Curve != CurveSaturating {
+		var sum float64
+		for _, c := range contributions {
+			sum += c
+		}
+		return sum
+	}
+
+	// Strongest first, each further report damped geometrically
+	sorted := append([]float64(nil), contributions...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+
+	var sum float64
+	factor := 1.0
+	for _, c := range sorted {
+		sum += c * factor
+		factor *= s.config.SaturationFactor
+	}
+	return sum
+}
+
 // calculateDecay calculates the time decay factor
-// D(t) = e^(-λt) where t is time since last seen in days
-func (s *Scorer) calculateDecay(lastSeen, now time.Time) float64 {
+// D(t) = e^(-λt) where t is time since last seen in days and λ is the
+// threat type's decay rate
+func (s *Scorer) calculateDecay(threatType string, lastSeen, now time.Time) float64 {
 	if lastSeen.IsZero() {
 		return 0.5 // Default for unknown last seen
 	}
@@ -173,7 +376,7 @@ func (s *Scorer) calculateDecay(lastSeen, now time.Time) float64 {
 
 	// Calculate exponential decay
 	days := age.Hours() / 24
-	decay := math.Exp(-s.config.DecayLambda * days)
+	decay := math.Exp(-s.getDecayLambda(threatType) * days)
 
 	// Ensure minimum decay factor
 	if decay < 0.1 {
@@ -183,6 +386,14 @@ func (s *Scorer) calculateDecay(lastSeen, now time.Time) float64 {
 	return decay
 }
 
+// getDecayLambda returns the decay rate for a threat type
+func (s *Scorer) getDecayLambda(threatType string) float64 {
+	if lambda, ok := s.config.ThreatDecayLambdas[threatType]; ok {
+		return lambda
+	}
+	return s.config.DecayLambda
+}
+
 // getThreatWeight returns the weight for a threat type
 func (s *Scorer) getThreatWeight(threatType string) int {
 	if weight, ok := s.config.ThreatWeights[threatType]; ok {
@@ -201,30 +412,19 @@ func (s *Scorer) getASNModifier(asnType string) int {
 
 // ClassifyRisk classifies the risk level based on score
 func (s *Scorer) ClassifyRisk(score int) string {
-	switch {
-	case score >= 85:
-		return "critical"
-	case score >= 70:
-		return "high"
-	case score >= 50:
-		return "medium"
-	case score >= 25:
-		return "low"
-	default:
-		return "clean"
-	}
+	return s.config.RiskThresholds.Classify(score)
 }
 
 // GetScoreColor returns a color for visualization (hex color)
 func (s *Scorer) GetScoreColor(score int) string {
-	switch {
-	case score >= 85:
+	switch s.ClassifyRisk(score) {
+	case "critical":
 		return "#dc3545" // Red
-	case score >= 70:
+	case "high":
 		return "#fd7e14" // Orange
-	case score >= 50:
+	case "medium":
 		return "#ffc107" // Yellow
-	case score >= 25:
+	case "low":
 		return "#17a2b8" // Cyan
 	default:
 		return "#28a745" // Green
@@ -293,9 +493,13 @@ func (s *Scorer) CalculateDetailedScore(threats []models.Threat, asnInfo *models
 		result.Multipliers = append(result.Multipliers, "multi_threat")
 	}
 
-	if asnInfo != nil && (asnInfo.ASNType == "datacenter" || asnInfo.ASNType == "hosting") {
+	if asnInfo != nil && isHostingType(asnInfo.ASNType) {
 		result.Multipliers = append(result.Multipliers, "datacenter")
 	}
 
+	if s.IsTrustedASN(asnInfo) {
+		result.Multipliers = append(result.Multipliers, "trusted_asn")
+	}
+
 	return result
 }
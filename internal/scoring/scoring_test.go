@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
 	"github.com/lfrfrfr/beon-ipquality/pkg/models"
 )
 
@@ -171,6 +172,214 @@ func BenchmarkCalculateScore(b *testing.B) {
 	}
 }
 
+func TestSaturatingCurve(t *testing.T) {
+	now := time.Now()
+	strong := []models.Threat{
+		{ThreatType: "botnet_c2", Source: "abuse_feodo", Confidence: 0.95, LastSeen: now},
+	}
+	weak := []models.Threat{
+		{ThreatType: "suspicious", Source: "firehol_level2", Confidence: 0.6, LastSeen: now},
+		{ThreatType: "suspicious", Source: "blocklist_de", Confidence: 0.6, LastSeen: now},
+		{ThreatType: "suspicious", Source: "stopforumspam", Confidence: 0.6, LastSeen: now},
+	}
+
+	linear := NewDefault()
+	cfg := DefaultConfig()
+	cfg.Curve = CurveSaturating
+	saturating := New(cfg)
+
+	// Linear: three weak reports outscore one strong signal
+	if l, s := linear.CalculateScore(weak, nil, now), linear.CalculateScore(strong, nil, now); l < s {
+		t.Fatalf("linear weak = %d, strong = %d; expected weak >= strong", l, s)
+	}
+
+	// Saturating: the strong signal stays ahead and a single threat is unchanged
+	weakScore := saturating.CalculateScore(weak, nil, now)
+	strongScore := saturating.CalculateScore(strong, nil, now)
+	if weakScore >= strongScore {
+		t.Errorf("saturating weak = %d, strong = %d; expected weak < strong", weakScore, strongScore)
+	}
+	if got, want := strongScore, linear.CalculateScore(strong, nil, now); got != want {
+		t.Errorf("saturating single threat = %d, linear = %d; expected equal", got, want)
+	}
+
+	// Each further report still adds something, but less than the one before
+	var scores []int
+	for n := 1; n <= 3; n++ {
+		scores = append(scores, saturating.CalculateScore(weak[:n], nil, now))
+	}
+	if !(scores[0] < scores[1] && scores[1] < scores[2]) || scores[2]-scores[1] >= scores[1]-scores[0] {
+		t.Errorf("saturating scores for 1..3 reports = %v, want increasing with diminishing steps", scores)
+	}
+}
+
+func TestSaturatingCurveOrderIndependent(t *testing.T) {
+	now := time.Now()
+	cfg := DefaultConfig()
+	cfg.Curve = CurveSaturating
+	scorer := New(cfg)
+
+	a := []models.Threat{
+		{ThreatType: "spam", Source: "a", Confidence: 0.3, LastSeen: now},
+		{ThreatType: "spam", Source: "b", Confidence: 0.8, LastSeen: now},
+	}
+	b := []models.Threat{a[1], a[0]}
+
+	if x, y := scorer.CalculateScore(a, nil, now), scorer.CalculateScore(b, nil, now); x != y {
+		t.Errorf("scores depend on threat order: %d vs %d", x, y)
+	}
+}
+
+func TestThreatDecayLambdas(t *testing.T) {
+	now := time.Now()
+	lastSeen := now.Add(-30 * 24 * time.Hour)
+
+	// Equal weights isolate the effect of the per-type decay rates
+	cfg := DefaultConfig()
+	cfg.ThreatWeights["tor"] = 80
+	cfg.ThreatWeights["botnet_c2"] = 80
+	cfg.HighConfidenceBonus = 0
+	scorer := New(cfg)
+
+	tor := scorer.CalculateScore([]models.Threat{
+		{ThreatType: "tor", Source: "tor_exit", Confidence: 0.9, LastSeen: lastSeen},
+	}, nil, now)
+	botnet := scorer.CalculateScore([]models.Threat{
+		{ThreatType: "botnet_c2", Source: "abuse_feodo", Confidence: 0.9, LastSeen: lastSeen},
+	}, nil, now)
+	if tor >= botnet {
+		t.Errorf("30-day-old tor = %d, botnet_c2 = %d; expected tor to decay faster", tor, botnet)
+	}
+
+	// Types without an override use the global rate
+	if got, want := scorer.calculateDecay("spam", lastSeen, now), scorer.calculateDecay("", lastSeen, now); got != want {
+		t.Errorf("spam decay = %g, want global %g", got, want)
+	}
+	if got := scorer.calculateDecay("tor", now, now); got != 1.0 {
+		t.Errorf("fresh tor decay = %g, want 1", got)
+	}
+}
+
+func TestApplyASN(t *testing.T) {
+	scorer := NewDefault()
+
+	tests := []struct {
+		name           string
+		result         models.IPCheckResult
+		wantScore      int
+		wantDatacenter bool
+	}{
+		{"hosting raises score", models.IPCheckResult{Score: 50, RiskScore: 50, ASN: &models.ASNInfo{ASNType: "hosting"}}, 75, true}, // (50+15)*1.15
+		{"education lowers score", models.IPCheckResult{Score: 50, RiskScore: 50, ASN: &models.ASNInfo{ASNType: "education"}}, 30, false},
+		{"per-ASN modifier", models.IPCheckResult{Score: 50, RiskScore: 50, ASN: &models.ASNInfo{ASNType: "isp", RiskModifier: 5}}, 55, false},
+		{"clean stays clean", models.IPCheckResult{Score: 0, RiskScore: 0, ASN: &models.ASNInfo{ASNType: "datacenter"}}, 0, true},
+		{"unknown type untouched", models.IPCheckResult{Score: 50, RiskScore: 50, ASN: &models.ASNInfo{}}, 50, false},
+		{"no ASN", models.IPCheckResult{Score: 50, RiskScore: 50}, 50, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.result
+			scorer.ApplyASN(&result)
+			if result.Score != tt.wantScore || result.RiskScore != tt.wantScore {
+				t.Errorf("score = %d/%d, want %d", result.Score, result.RiskScore, tt.wantScore)
+			}
+			if result.IsDatacenter != tt.wantDatacenter {
+				t.Errorf("IsDatacenter = %v, want %v", result.IsDatacenter, tt.wantDatacenter)
+			}
+			if result.RiskLevel != "" && result.RiskLevel != scorer.ClassifyRisk(result.Score) {
+				t.Errorf("RiskLevel = %q, want %q", result.RiskLevel, scorer.ClassifyRisk(result.Score))
+			}
+		})
+	}
+}
+
+func TestTrustedASN(t *testing.T) {
+	cfg, err := FromConfig(config.ScoringConfig{
+		RiskThresholds: config.RiskThresholdsConfig{Low: 25, Medium: 50, High: 70, Critical: 85},
+		TrustedASNs:    []int{13335},
+	})
+	if err != nil {
+		t.Fatalf("FromConfig() error = %v", err)
+	}
+	scorer := New(cfg)
+	now := time.Now()
+	threats := []models.Threat{
+		{ThreatType: "proxy", Confidence: 0.95, LastSeen: now},
+		{ThreatType: "datacenter", Confidence: 0.9, LastSeen: now},
+	}
+
+	cloudflare := &models.ASNInfo{ASN: 13335, Org: "Cloudflare, Inc.", ASNType: "hosting"}
+	if got := scorer.CalculateScore(threats, cloudflare, now); got != 0 {
+		t.Errorf("CalculateScore(Cloudflare) = %d, want 0", got)
+	}
+	other := &models.ASNInfo{ASN: 64500, ASNType: "hosting"}
+	if got := scorer.CalculateScore(threats, other, now); got == 0 {
+		t.Errorf("CalculateScore(untrusted hosting ASN) = 0, want a risky score")
+	}
+
+	// Lookups cap compiled scores even when the ASN type is unknown
+	result := models.IPCheckResult{Score: 80, RiskScore: 80, RiskLevel: "high", ASN: &models.ASNInfo{ASN: 13335}}
+	scorer.ApplyASN(&result)
+	if result.Score != 0 || result.RiskScore != 0 || result.RiskLevel != "clean" {
+		t.Errorf("ApplyASN(Cloudflare) = %d/%d %q, want 0/0 clean", result.Score, result.RiskScore, result.RiskLevel)
+	}
+
+	cfg.TrustedASNMaxScore = 20
+	if got := New(cfg).CalculateScore(threats, cloudflare, now); got != 20 {
+		t.Errorf("CalculateScore(Cloudflare) with trusted_asn_max_score 20 = %d, want 20", got)
+	}
+
+	if _, err := FromConfig(config.ScoringConfig{
+		RiskThresholds: config.RiskThresholdsConfig{Low: 25, Medium: 50, High: 70, Critical: 85},
+		TrustedASNs:    []int{-1},
+	}); err == nil {
+		t.Error("FromConfig() accepted a negative ASN")
+	}
+}
+
+// TestRiskLevelsAgree guards against the scorer and models.GetRiskLevel
+// drifting apart again (GetRiskLevel used to label the bottom tier "safe")
+func TestRiskLevelsAgree(t *testing.T) {
+	scorer := NewDefault()
+	for score := 0; score <= 100; score++ {
+		if got, want := models.GetRiskLevel(score), scorer.ClassifyRisk(score); got != want {
+			t.Errorf("score %d: models.GetRiskLevel = %q, Scorer.ClassifyRisk = %q", score, got, want)
+		}
+	}
+}
+
+func TestFromConfigRiskThresholds(t *testing.T) {
+	cfg, err := FromConfig(config.ScoringConfig{
+		RiskThresholds: config.RiskThresholdsConfig{Low: 10, Medium: 30, High: 50, Critical: 70},
+	})
+	if err != nil {
+		t.Fatalf("FromConfig() error = %v", err)
+	}
+	scorer := New(cfg)
+	if got := scorer.ClassifyRisk(60); got != "high" {
+		t.Errorf("ClassifyRisk(60) = %q, want high", got)
+	}
+	if got := scorer.ClassifyRisk(9); got != "clean" {
+		t.Errorf("ClassifyRisk(9) = %q, want clean", got)
+	}
+
+	_, err = FromConfig(config.ScoringConfig{
+		RiskThresholds: config.RiskThresholdsConfig{Low: 50, Medium: 30, High: 70, Critical: 85},
+	})
+	if err == nil {
+		t.Error("FromConfig() accepted descending thresholds")
+	}
+
+	_, err = FromConfig(config.ScoringConfig{
+		RiskThresholds: config.RiskThresholdsConfig{Low: 25, Medium: 50, High: 70, Critical: 85},
+		Curve:          "exponential",
+	})
+	if err == nil {
+		t.Error("FromConfig() accepted an unknown curve")
+	}
+}
+
 func BenchmarkClassifyRisk(b *testing.B) {
 	scorer := NewDefault()
 	b.ResetTimer()
@@ -0,0 +1,78 @@
+package scoring
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultThreatTypeAliases maps labels used by common feeds to the canonical
+// threat types, the keys of DefaultConfig().ThreatWeights
+var DefaultThreatTypeAliases = map[string]string{
+	"c2":                  "botnet_c2",
+	"cnc":                 "botnet_c2",
+	"command-and-control": "botnet_c2",
+	"command_and_control": "botnet_c2",
+	"botnet":              "botnet_c2",
+	"bruteforce":          "attack",
+	"brute-force":         "attack",
+	"brute_force":         "attack",
+	"scanner":             "attack",
+	"ddos":                "attack",
+	"anonymous":           "proxy",
+	"open_proxy":          "proxy",
+	"tor_exit":            "tor",
+	"hosting":             "datacenter",
+	"ransomware":          "malware",
+	"trojan":              "malware",
+	"phishing":            "malicious",
+	"spammer":             "spam",
+	"bogon":               "hijacked",
+}
+
+// canonicalThreatTypes is the threat type taxonomy
+var canonicalThreatTypes = DefaultConfig().ThreatWeights
+
+// ThreatTypeAliases returns the built-in aliases with the configured ones
+// applied. Aliases are matched case-insensitively and must point at a
+// canonical threat type.
+func ThreatTypeAliases(configured map[string]string) (map[string]string, error) {
+	aliases := copyAliases(DefaultThreatTypeAliases)
+	for _, alias := range sortedKeys(configured) {
+		canonical := strings.ToLower(strings.TrimSpace(configured[alias]))
+		if _, ok := canonicalThreatTypes[canonical]; !ok {
+			return nil, fmt.Errorf("invalid scoring.threat_type_aliases.%s: unknown threat type %q", alias, configured[alias])
+		}
+		aliases[strings.ToLower(strings.TrimSpace(alias))] = canonical
+	}
+	return aliases, nil
+}
+
+// NormalizeThreatType maps a feed's threat type label to the canonical
+// taxonomy using aliases. ok is false when the label is neither canonical nor
+// a known alias; it is then returned lowercased and scores with the default
+// weight and no flags.
+func NormalizeThreatType(aliases map[string]string, threatType string) (canonical string, ok bool) {
+	t := strings.ToLower(strings.TrimSpace(threatType))
+	if _, known := canonicalThreatTypes[t]; known {
+		return t, true
+	}
+	if canonical, known := aliases[t]; known {
+		return canonical, true
+	}
+	return t, false
+}
+
+// NormalizeThreatType maps a threat type label to the canonical taxonomy
+// using the configured aliases
+func (c Config) NormalizeThreatType(threatType string) (string, bool) {
+	return NormalizeThreatType(c.ThreatTypeAliases, threatType)
+}
+
+// copyAliases returns a copy of an alias map
+func copyAliases(aliases map[string]string) map[string]string {
+	out := make(map[string]string, len(aliases))
+	for alias, canonical := range aliases {
+		out[alias] = canonical
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package scoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+func TestNormalizeThreatType(t *testing.T) {
+	cfg := DefaultConfig()
+
+	tests := []struct {
+		threatType string
+		want       string
+		wantOK     bool
+	}{
+		{"botnet_c2", "botnet_c2", true},
+		{"c2", "botnet_c2", true},
+		{"Command-and-Control", "botnet_c2", true},
+		{"bruteforce", "attack", true},
+		{" Tor ", "tor", true},
+		{"anonymous", "proxy", true},
+		{"something_new", "something_new", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.threatType, func(t *testing.T) {
+			got, ok := cfg.NormalizeThreatType(tt.threatType)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("NormalizeThreatType(%q) = %q, %v; want %q, %v", tt.threatType, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFromConfigThreatTypeAliases(t *testing.T) {
+	sc := config.ScoringConfig{
+		RiskThresholds:    config.RiskThresholdsConfig{Low: 25, Medium: 50, High: 70, Critical: 85},
+		ThreatTypeAliases: map[string]string{"Miner": "malware", "c2": "malicious"},
+	}
+
+	cfg, err := FromConfig(sc)
+	if err != nil {
+		t.Fatalf("FromConfig() error = %v", err)
+	}
+	if got, _ := cfg.NormalizeThreatType("miner"); got != "malware" {
+		t.Errorf("miner = %q, want malware", got)
+	}
+	if got, _ := cfg.NormalizeThreatType("c2"); got != "malicious" {
+		t.Errorf("configured alias did not override built-in: c2 = %q, want malicious", got)
+	}
+	if got, _ := cfg.NormalizeThreatType("bruteforce"); got != "attack" {
+		t.Errorf("built-in alias lost: bruteforce = %q, want attack", got)
+	}
+
+	sc.ThreatTypeAliases = map[string]string{"miner": "cryptojacking"}
+	if _, err := FromConfig(sc); err == nil {
+		t.Error("FromConfig() accepted an alias to an unknown threat type")
+	}
+}
+
+func TestCalculateScoreUsesAliases(t *testing.T) {
+	scorer := NewDefault()
+	now := time.Now()
+
+	canonical := scorer.CalculateScore([]models.Threat{{ThreatType: "botnet_c2", Confidence: 1, LastSeen: now}}, nil, now)
+	alias := scorer.CalculateScore([]models.Threat{{ThreatType: "c2", Confidence: 1, LastSeen: now}}, nil, now)
+	if alias != canonical {
+		t.Errorf("c2 scored %d, want %d like botnet_c2", alias, canonical)
+	}
+}
@@ -0,0 +1,6 @@
+-- BEON-IPQuality Schema Update
+-- Record which ingestor instance last wrote each reputation entry
+
+ALTER TABLE ip_reputation ADD COLUMN IF NOT EXISTS ingested_by VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_ip_reputation_ingested_by ON ip_reputation(ingested_by) WHERE ingested_by IS NOT NULL;
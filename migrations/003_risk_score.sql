@@ -0,0 +1,5 @@
+-- BEON-IPQuality Schema Update
+-- Persist each entry's time-decayed risk score so aging is visible between compiles
+
+ALTER TABLE ip_reputation ADD COLUMN IF NOT EXISTS risk_score INTEGER;
+ALTER TABLE ip_reputation ADD COLUMN IF NOT EXISTS scored_at TIMESTAMP WITH TIME ZONE;
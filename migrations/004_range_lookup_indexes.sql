@@ -0,0 +1,23 @@
+-- BEON-IPQuality Schema Update
+-- Indexes the upserts and range lookups depend on
+
+-- ON CONFLICT (ip_start, ip_end, source) needs this unique index; databases
+-- created before it was part of the initial schema may lack it
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ip_reputation_unique
+    ON ip_reputation(ip_start, ip_end, source);
+
+-- An inet range type lets GiST answer "which ranges contain this IP"
+-- directly; separate btrees on ip_start and ip_end each match about half
+-- the table for such a query
+DO $$
+BEGIN
+    CREATE TYPE inetrange AS RANGE (subtype = inet);
+EXCEPTION
+    WHEN duplicate_object THEN NULL;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS idx_ip_reputation_range
+    ON ip_reputation USING gist (inetrange(ip_start, ip_end, '[]'));
+CREATE INDEX IF NOT EXISTS idx_whitelist_range
+    ON whitelist USING gist (inetrange(ip_start, ip_end, '[]'));
@@ -0,0 +1,5 @@
+-- BEON-IPQuality ClickHouse Schema Update
+-- Store the caller's X-Request-ID verbatim so lookups can be traced across services.
+-- Request IDs are generated as UUIDs but may come from upstream systems in other formats.
+
+ALTER TABLE ipquality.api_requests MODIFY COLUMN request_id String DEFAULT toString(generateUUIDv4());
@@ -0,0 +1,57 @@
+// Package migrations embeds the SQL schema so each binary can apply it with
+// -migrate. Files are applied in name order and recorded once applied, so
+// new changes go in a new, higher-numbered file rather than an edit.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed *.sql clickhouse/*.sql
+var files embed.FS
+
+// Migration is one schema file
+type Migration struct {
+	Version string // File name without extension, e.g. 001_initial_schema
+	SQL     string
+}
+
+// Postgres returns the PostgreSQL migrations in apply order
+func Postgres() ([]Migration, error) {
+	return load(files, ".")
+}
+
+// ClickHouse returns the ClickHouse migrations in apply order
+func ClickHouse() ([]Migration, error) {
+	return load(files, "clickhouse")
+}
+
+// load reads the .sql files of dir in fsys, sorted by name
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		migrations = append(migrations, Migration{
+			Version: strings.TrimSuffix(entry.Name(), ".sql"),
+			SQL:     string(data),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
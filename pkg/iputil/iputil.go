@@ -12,6 +12,11 @@ import (
 func ParseIP(s string) (netip.Addr, error) {
 	s = strings.TrimSpace(s)
 
+	// Plain addresses, including IPv4-mapped IPv6 like ::ffff:8.8.8.8
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr, nil
+	}
+
 	// Handle IPv6 with brackets [::1]:8080
 	if strings.HasPrefix(s, "[") {
 		if idx := strings.Index(s, "]"); idx != -1 {
@@ -133,21 +138,34 @@ func IsGlobalUnicast(addr netip.Addr) bool {
 	return addr.IsGlobalUnicast()
 }
 
+// CheckOptions relaxes which addresses may be checked. The zero value is
+// the strict policy of IsValid: public addresses only.
+type CheckOptions struct {
+	AllowPrivate  bool // RFC 1918 and IPv6 unique local addresses
+	AllowLoopback bool
+	AllowReserved bool // Multicast and unspecified addresses
+}
+
 // IsValid checks if an IP address is valid for reputation checking
 func IsValid(addr netip.Addr) bool {
+	return IsValidFor(addr, CheckOptions{})
+}
+
+// IsValidFor checks if an IP address may be checked under opts
+func IsValidFor(addr netip.Addr, opts CheckOptions) bool {
 	if !addr.IsValid() {
 		return false
 	}
-	if addr.IsLoopback() {
+	if addr.IsLoopback() && !opts.AllowLoopback {
 		return false
 	}
-	if addr.IsPrivate() {
+	if addr.IsPrivate() && !opts.AllowPrivate {
 		return false
 	}
-	if addr.IsMulticast() {
+	if addr.IsMulticast() && !opts.AllowReserved {
 		return false
 	}
-	if addr.IsUnspecified() {
+	if addr.IsUnspecified() && !opts.AllowReserved {
 		return false
 	}
 	return true
@@ -184,6 +202,87 @@ func GetNetworkAddress(prefix netip.Prefix) netip.Addr {
 	return prefix.Masked().Addr()
 }
 
+// GetLastAddress returns the last address of a prefix (IPv4 and IPv6)
+func GetLastAddress(prefix netip.Prefix) netip.Addr {
+	masked := prefix.Masked()
+	b := masked.Addr().AsSlice()
+	hostBits := len(b)*8 - masked.Bits()
+
+	for i := len(b) - 1; i >= 0 && hostBits > 0; i-- {
+		if hostBits >= 8 {
+			b[i] = 0xff
+			hostBits -= 8
+		} else {
+			b[i] |= byte(1<<hostBits) - 1
+			hostBits = 0
+		}
+	}
+
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// ParseIPRange parses a dash-delimited range like 1.2.3.4-1.2.3.20. Both ends
+// must be of the same family and start must not come after end.
+func ParseIPRange(s string) (start, end netip.Addr, err error) {
+	first, last, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid IP range: %s", s)
+	}
+
+	start, err = netip.ParseAddr(strings.TrimSpace(first))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid IP range start: %s", first)
+	}
+	end, err = netip.ParseAddr(strings.TrimSpace(last))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid IP range end: %s", last)
+	}
+	start, end = NormalizeIP(start), NormalizeIP(end)
+
+	if start.Is4() != end.Is4() {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("IP range mixes address families: %s", s)
+	}
+	if start.Compare(end) > 0 {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("IP range start is after end: %s", s)
+	}
+
+	return start, end, nil
+}
+
+// RangeToPrefixes returns the fewest CIDR prefixes exactly covering start
+// through end, in order. A range aligned to a CIDR boundary yields one prefix.
+func RangeToPrefixes(start, end netip.Addr) ([]netip.Prefix, error) {
+	if start.Is4() != end.Is4() {
+		return nil, fmt.Errorf("IP range mixes address families: %s-%s", start, end)
+	}
+	if start.Compare(end) > 0 {
+		return nil, fmt.Errorf("IP range start is after end: %s-%s", start, end)
+	}
+
+	var prefixes []netip.Prefix
+	for {
+		// Widen the prefix while it stays aligned on start and within end
+		bits := start.BitLen()
+		for bits > 0 {
+			wider := netip.PrefixFrom(start, bits-1).Masked()
+			if wider.Addr() != start || GetLastAddress(wider).Compare(end) > 0 {
+				break
+			}
+			bits--
+		}
+
+		prefix := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, prefix)
+
+		last := GetLastAddress(prefix)
+		if last == end {
+			return prefixes, nil
+		}
+		start = last.Next()
+	}
+}
+
 // LegacyIPToNetIP converts a net.IP to netip.Addr
 func LegacyIPToNetIP(ip net.IP) (netip.Addr, bool) {
 	addr, ok := netip.AddrFromSlice(ip)
@@ -14,6 +14,9 @@ func TestParseIP(t *testing.T) {
 	}{
 		{"Valid IPv4", "192.168.1.1", "192.168.1.1", false},
 		{"Valid IPv6", "2001:db8::1", "2001:db8::1", false},
+		{"IPv4-mapped IPv6", "::ffff:8.8.8.8", "::ffff:8.8.8.8", false},
+		{"IPv4 with port", "8.8.8.8:53", "8.8.8.8", false},
+		{"Bracketed IPv6 with port", "[2001:db8::1]:443", "2001:db8::1", false},
 		{"Invalid IP", "not-an-ip", "", true},
 		{"Empty string", "", "", true},
 	}
@@ -196,6 +199,36 @@ func TestIsValid(t *testing.T) {
 	}
 }
 
+func TestIsValidFor(t *testing.T) {
+	permissive := CheckOptions{AllowPrivate: true, AllowLoopback: true, AllowReserved: true}
+
+	tests := []struct {
+		name string
+		ip   string
+		opts CheckOptions
+		want bool
+	}{
+		{"Private IP allowed", "192.168.1.1", CheckOptions{AllowPrivate: true}, true},
+		{"ULA allowed", "fd00::1", CheckOptions{AllowPrivate: true}, true},
+		{"Loopback still rejected", "127.0.0.1", CheckOptions{AllowPrivate: true}, false},
+		{"Loopback allowed", "::1", CheckOptions{AllowLoopback: true}, true},
+		{"Multicast allowed", "224.0.0.1", CheckOptions{AllowReserved: true}, true},
+		{"Unspecified allowed", "0.0.0.0", CheckOptions{AllowReserved: true}, true},
+		{"Multicast rejected", "224.0.0.1", CheckOptions{AllowPrivate: true, AllowLoopback: true}, false},
+		{"Public IP", "8.8.8.8", permissive, true},
+		{"Invalid address", "", permissive, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := netip.ParseAddr(tt.ip)
+			if got := IsValidFor(addr, tt.opts); got != tt.want {
+				t.Errorf("IsValidFor(%s, %+v) = %v, want %v", tt.ip, tt.opts, got, tt.want)
+			}
+		})
+	}
+}
+
 // Benchmark tests
 func BenchmarkParseIP(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -216,3 +249,100 @@ func BenchmarkIsPrivate(b *testing.B) {
 		IsPrivate(addr)
 	}
 }
+
+func TestGetLastAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{"IPv4 /24", "192.168.1.0/24", "192.168.1.255"},
+		{"IPv4 /32", "10.0.0.1/32", "10.0.0.1"},
+		{"IPv4 unmasked", "10.1.2.3/12", "10.15.255.255"},
+		{"IPv4 /0", "0.0.0.0/0", "255.255.255.255"},
+		{"IPv6 /64", "2001:db8::/64", "2001:db8::ffff:ffff:ffff:ffff"},
+		{"IPv6 /126", "2001:db8::/126", "2001:db8::3"},
+		{"IPv6 /128", "2001:db8::1/128", "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetLastAddress(netip.MustParsePrefix(tt.prefix))
+			if got.String() != tt.want {
+				t.Errorf("GetLastAddress(%s) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIPRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantStart string
+		wantEnd   string
+		wantErr   bool
+	}{
+		{"IPv4 range", "1.2.3.4-1.2.3.20", "1.2.3.4", "1.2.3.20", false},
+		{"Spaces around dash", "1.2.3.4 - 1.2.3.20", "1.2.3.4", "1.2.3.20", false},
+		{"Single address", "1.2.3.4-1.2.3.4", "1.2.3.4", "1.2.3.4", false},
+		{"IPv6 range", "2001:db8::1-2001:db8::ff", "2001:db8::1", "2001:db8::ff", false},
+		{"IPv4-mapped end", "1.2.3.4-::ffff:1.2.3.20", "1.2.3.4", "1.2.3.20", false},
+		{"Inverted", "1.2.3.20-1.2.3.4", "", "", true},
+		{"Mixed families", "1.2.3.4-2001:db8::1", "", "", true},
+		{"No dash", "1.2.3.4", "", "", true},
+		{"Bad end", "1.2.3.4-1.2.3", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := ParseIPRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIPRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if start.String() != tt.wantStart || end.String() != tt.wantEnd {
+				t.Errorf("ParseIPRange(%q) = %v-%v, want %s-%s", tt.input, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestRangeToPrefixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   string
+		end     string
+		want    []string
+		wantErr bool
+	}{
+		{"Aligned /24", "10.0.0.0", "10.0.0.255", []string{"10.0.0.0/24"}, false},
+		{"Single address", "10.0.0.7", "10.0.0.7", []string{"10.0.0.7/32"}, false},
+		{"Unaligned", "1.2.3.4", "1.2.3.20", []string{"1.2.3.4/30", "1.2.3.8/29", "1.2.3.16/30", "1.2.3.20/32"}, false},
+		{"Crosses octet", "10.0.0.255", "10.0.1.0", []string{"10.0.0.255/32", "10.0.1.0/32"}, false},
+		{"Whole IPv4 space", "0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}, false},
+		{"Up to broadcast", "255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}, false},
+		{"IPv6", "2001:db8::1", "2001:db8::4", []string{"2001:db8::1/128", "2001:db8::2/127", "2001:db8::4/128"}, false},
+		{"Inverted", "10.0.0.9", "10.0.0.1", nil, true},
+		{"Mixed families", "10.0.0.1", "2001:db8::1", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RangeToPrefixes(netip.MustParseAddr(tt.start), netip.MustParseAddr(tt.end))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RangeToPrefixes(%s, %s) error = %v, wantErr %v", tt.start, tt.end, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("RangeToPrefixes(%s, %s) = %v, want %v", tt.start, tt.end, got, tt.want)
+			}
+			for i := range got {
+				if got[i].String() != tt.want[i] {
+					t.Errorf("RangeToPrefixes(%s, %s)[%d] = %v, want %s", tt.start, tt.end, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
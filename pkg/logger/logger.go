@@ -2,56 +2,196 @@ package logger
 
 import (
 	"os"
+	"sync"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var log *zap.Logger
+var (
+	mu  sync.RWMutex
+	log *Logger
+)
 
-// Init initializes the logger
-func Init(level, format, output, filePath string) error {
-	var zapLevel zapcore.Level
-	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
-		zapLevel = zapcore.InfoLevel
-	}
+// Config configures the logger. The rotation settings apply only to file
+// output; zero values fall back to lumberjack's defaults (100 MB files, kept
+// forever, uncompressed).
+type Config struct {
+	Level    string
+	Format   string // json or text
+	Output   string // stdout or file
+	FilePath string
+
+	MaxSizeMB  int  // Rotate once the file reaches this size
+	MaxAgeDays int  // Delete rotated files older than this
+	MaxBackups int  // Keep at most this many rotated files
+	Compress   bool // Gzip rotated files
+}
+
+// Logger is a logger instance with its own level. A nil *Logger logs through
+// the package-level logger, so components can hold one without requiring it.
+type Logger struct {
+	zl    *zap.Logger
+	level zap.AtomicLevel
+}
+
+// New builds a Logger from a Config
+func New(cfg Config) (*Logger, error) {
+	level := zap.NewAtomicLevelAt(parseLevel(cfg.Level))
 
 	var encoder zapcore.Encoder
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.TimeKey = "timestamp"
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
-	if format == "json" {
+	if cfg.Format == "json" {
 		encoder = zapcore.NewJSONEncoder(encoderConfig)
 	} else {
 		encoder = zapcore.NewConsoleEncoder(encoderConfig)
 	}
 
 	var writeSyncer zapcore.WriteSyncer
-	if output == "file" && filePath != "" {
-		file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		writeSyncer = zapcore.AddSync(file)
+	if cfg.Output == "file" && cfg.FilePath != "" {
+		writeSyncer = zapcore.AddSync(&lumberjack.Logger{
+			Filename:   cfg.FilePath,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxAge:     cfg.MaxAgeDays,
+			MaxBackups: cfg.MaxBackups,
+			Compress:   cfg.Compress,
+			LocalTime:  true,
+		})
 	} else {
 		writeSyncer = zapcore.AddSync(os.Stdout)
 	}
 
-	core := zapcore.NewCore(encoder, writeSyncer, zapLevel)
-	log = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	core := zapcore.NewCore(encoder, writeSyncer, level)
+	return &Logger{
+		zl:    zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)),
+		level: level,
+	}, nil
+}
+
+// parseLevel parses a level name, falling back to info
+func parseLevel(name string) zapcore.Level {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return zapcore.InfoLevel
+	}
+	return level
+}
+
+// Zap returns the underlying zap logger
+func (l *Logger) Zap() *zap.Logger {
+	if l == nil {
+		return Get()
+	}
+	return l.zl
+}
+
+// SetLevel changes the level at runtime; unknown names select info
+func (l *Logger) SetLevel(name string) {
+	if l == nil {
+		L().SetLevel(name)
+		return
+	}
+	l.level.SetLevel(parseLevel(name))
+}
+
+// Level returns the current level
+func (l *Logger) Level() string {
+	if l == nil {
+		return L().Level()
+	}
+	return l.level.Level().String()
+}
+
+// Debug logs a debug message
+func (l *Logger) Debug(msg string, fields ...zap.Field) {
+	l.Zap().Debug(msg, fields...)
+}
+
+// Info logs an info message
+func (l *Logger) Info(msg string, fields ...zap.Field) {
+	l.Zap().Info(msg, fields...)
+}
+
+// Warn logs a warning message
+func (l *Logger) Warn(msg string, fields ...zap.Field) {
+	l.Zap().Warn(msg, fields...)
+}
 
+// Error logs an error message
+func (l *Logger) Error(msg string, fields ...zap.Field) {
+	l.Zap().Error(msg, fields...)
+}
+
+// Fatal logs a fatal message and exits
+func (l *Logger) Fatal(msg string, fields ...zap.Field) {
+	l.Zap().Fatal(msg, fields...)
+}
+
+// With creates a child logger with additional fields; it shares the level
+func (l *Logger) With(fields ...zap.Field) *Logger {
+	if l == nil {
+		l = L()
+	}
+	return &Logger{zl: l.zl.With(fields...), level: l.level}
+}
+
+// Sync flushes any buffered log entries
+func (l *Logger) Sync() error {
+	return l.Zap().Sync()
+}
+
+// Init initializes the package-level logger
+func Init(level, format, output, filePath string) error {
+	return InitConfig(Config{Level: level, Format: format, Output: output, FilePath: filePath})
+}
+
+// InitConfig initializes the package-level logger from a Config. It may be
+// called again to reconfigure logging.
+func InitConfig(cfg Config) error {
+	l, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	SetDefault(l)
 	return nil
 }
 
-// Get returns the logger instance
-func Get() *zap.Logger {
+// SetDefault replaces the package-level logger
+func SetDefault(l *Logger) {
+	mu.Lock()
+	log = l
+	mu.Unlock()
+}
+
+// L returns the package-level Logger, creating a production logger on first
+// use if Init was never called
+func L() *Logger {
+	mu.RLock()
+	l := log
+	mu.RUnlock()
+	if l != nil {
+		return l
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
 	if log == nil {
-		log, _ = zap.NewProduction()
+		cfg := zap.NewProductionConfig()
+		zl, _ := cfg.Build()
+		log = &Logger{zl: zl, level: cfg.Level}
 	}
 	return log
 }
 
+// Get returns the logger instance
+func Get() *zap.Logger {
+	return L().zl
+}
+
 // Sugar returns a sugared logger
 func Sugar() *zap.SugaredLogger {
 	return Get().Sugar()
@@ -87,6 +227,11 @@ func With(fields ...zap.Field) *zap.Logger {
 	return Get().With(fields...)
 }
 
+// RequestID returns the field that tags a log entry with its request ID
+func RequestID(id string) zap.Field {
+	return zap.String("request_id", id)
+}
+
 // Sync flushes any buffered log entries
 func Sync() error {
 	return Get().Sync()
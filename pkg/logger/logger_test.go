@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewIndependentLevels(t *testing.T) {
+	dir := t.TempDir()
+	debugPath := filepath.Join(dir, "debug.log")
+	warnPath := filepath.Join(dir, "warn.log")
+
+	debugLog, err := New(Config{Level: "debug", Format: "json", Output: "file", FilePath: debugPath})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	warnLog, err := New(Config{Level: "warn", Format: "json", Output: "file", FilePath: warnPath})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	debugLog.Debug("debug-entry")
+	warnLog.Info("info-entry")
+	warnLog.SetLevel("info")
+	warnLog.Info("after-set-level")
+
+	read := func(path string) string {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		return string(b)
+	}
+
+	if got := read(debugPath); !strings.Contains(got, "debug-entry") {
+		t.Errorf("debug logger output = %q, want debug-entry", got)
+	}
+	got := read(warnPath)
+	if strings.Contains(got, "info-entry") {
+		t.Errorf("warn logger wrote info entry before SetLevel: %q", got)
+	}
+	if !strings.Contains(got, "after-set-level") {
+		t.Errorf("warn logger output = %q, want after-set-level", got)
+	}
+	if warnLog.Level() != "info" {
+		t.Errorf("Level() = %q, want info", warnLog.Level())
+	}
+}
+
+func TestNilLoggerUsesDefault(t *testing.T) {
+	var l *Logger
+	if l.Zap() != Get() {
+		t.Error("nil Logger does not log through the package-level logger")
+	}
+	l.Info("nil logger entry")
+}
+
+func TestInitConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := Init("info", "json", "stdout", ""); err != nil {
+				t.Errorf("Init() error = %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			Debug("concurrent entry")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CompactFields are the fields of a compact check result, enough for an
+// edge or WAF to act on
+var CompactFields = []string{"ip", "score", "risk_level", "proxy", "vpn", "tor"}
+
+// resultFields maps the JSON names of IPCheckResult to their field index
+var resultFields = func() map[string]int {
+	t := reflect.TypeOf(IPCheckResult{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// ParseResultFields parses a comma-separated list of IPCheckResult JSON
+// field names, e.g. the ?fields= of a check, dropping duplicates
+func ParseResultFields(s string) ([]string, error) {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := resultFields[name]; !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		seen[name] = true
+		fields = append(fields, name)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields given")
+	}
+	return fields, nil
+}
+
+// MarshalFields encodes only the named fields of r, in the given order. The
+// names must come from ParseResultFields or CompactFields. Fields are written
+// even when empty, so a requested field is always present.
+func (r *IPCheckResult) MarshalFields(fields []string) ([]byte, error) {
+	v := reflect.ValueOf(r).Elem()
+	buf := make([]byte, 0, 16*len(fields))
+	buf = append(buf, '{')
+	for i, name := range fields {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendQuote(buf, name)
+		buf = append(buf, ':')
+
+		// Scalars are appended directly; the rest go through encoding/json
+		f := v.Field(resultFields[name])
+		switch f.Kind() {
+		case reflect.Bool:
+			buf = strconv.AppendBool(buf, f.Bool())
+		case reflect.Int:
+			buf = strconv.AppendInt(buf, f.Int(), 10)
+		default:
+			b, err := json.Marshal(f.Interface())
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, b...)
+		}
+	}
+	return append(buf, '}'), nil
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// benchResult is a typical listed IP with geo, ASN and threat details
+var benchResult = IPCheckResult{
+	IP:           "185.220.101.7",
+	Score:        92,
+	RiskScore:    92,
+	RiskLevel:    "critical",
+	IsTor:        true,
+	IsDatacenter: true,
+	Threats: []Threat{
+		{ThreatType: "tor", Source: "tor_exit", Confidence: 0.99, LastSeen: time.Unix(1760000000, 0)},
+		{ThreatType: "attack", Source: "blocklist_de", Confidence: 0.7, LastSeen: time.Unix(1760000000, 0)},
+	},
+	ThreatTypes: []string{"tor", "attack"},
+	Tags:        []string{"exit", "ssh"},
+	Geo:         &GeoInfo{Country: "Germany", CountryCode: "DE", City: "Frankfurt"},
+	ASN:         &ASNInfo{ASN: 60729, Org: "Stiftung Erneuerbare Freiheit", ASNType: "hosting"},
+	QueryTime:   0.12,
+}
+
+func TestMarshalFields(t *testing.T) {
+	data, err := benchResult.MarshalFields(CompactFields)
+	if err != nil {
+		t.Fatalf("MarshalFields: %v", err)
+	}
+	want := `{"ip":"185.220.101.7","score":92,"risk_level":"critical","proxy":false,"vpn":false,"tor":true}`
+	if string(data) != want {
+		t.Errorf("MarshalFields(compact) = %s, want %s", data, want)
+	}
+
+	// Non-scalar fields encode as in the full result
+	data, err = benchResult.MarshalFields([]string{"asn", "threat_types", "hostname"})
+	if err != nil {
+		t.Fatalf("MarshalFields: %v", err)
+	}
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("MarshalFields produced invalid JSON %s: %v", data, err)
+	}
+	full, _ := json.Marshal(benchResult)
+	var fullFields map[string]json.RawMessage
+	json.Unmarshal(full, &fullFields)
+	for _, name := range []string{"asn", "threat_types"} {
+		if string(got[name]) != string(fullFields[name]) {
+			t.Errorf("%s = %s, want %s", name, got[name], fullFields[name])
+		}
+	}
+	if string(got["hostname"]) != `""` {
+		t.Errorf("hostname = %s, want an empty string rather than omitted", got["hostname"])
+	}
+}
+
+func TestParseResultFields(t *testing.T) {
+	got, err := ParseResultFields(" score, risk_level,score,,proxy ")
+	if err != nil {
+		t.Fatalf("ParseResultFields: %v", err)
+	}
+	if want := []string{"score", "risk_level", "proxy"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseResultFields = %v, want %v", got, want)
+	}
+
+	for _, in := range []string{"", " , ", "score,is_proxy", "Score"} {
+		if _, err := ParseResultFields(in); err == nil {
+			t.Errorf("ParseResultFields(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func BenchmarkCheckResultMarshalFull(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		json.Marshal(&benchResult)
+	}
+}
+
+func BenchmarkCheckResultMarshalCompact(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchResult.MarshalFields(CompactFields)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"net/netip"
 	"time"
 )
@@ -90,28 +91,78 @@ type IPCheckResult struct {
 	IsAttacker   bool     `json:"attacker"`
 	Threats      []Threat `json:"threats,omitempty"`
 	ThreatTypes  []string `json:"threat_types,omitempty"` // List of threat type strings
+	Tags         []string `json:"tags,omitempty"`         // Feed-provided tags
 	Geo          *GeoInfo `json:"geo,omitempty"`
 	ASN          *ASNInfo `json:"asn,omitempty"`
+	Hostname     string   `json:"hostname,omitempty"` // PTR record, when requested
 	QueryTime    float64  `json:"query_time_ms"`
 	Cached       bool     `json:"cached"`
+
+	Explanation *ScoreExplanation `json:"explanation,omitempty"` // When requested
 }
 
-// GetRiskLevel returns risk level based on score
-func GetRiskLevel(score int) string {
+// ScoreExplanation breaks down how a checked IP's score was formed
+type ScoreExplanation struct {
+	BaseScore     int      `json:"base_score"`     // Compiled reputation score
+	ASNAdjustment int      `json:"asn_adjustment"` // Change applied for the IP's ASN type
+	ASNType       string   `json:"asn_type,omitempty"`
+	Sources       []string `json:"sources,omitempty"` // Threat type and feeds that listed the IP
+}
+
+// RiskThresholds are the minimum scores of each risk level above clean
+type RiskThresholds struct {
+	Low      int `json:"low"`
+	Medium   int `json:"medium"`
+	High     int `json:"high"`
+	Critical int `json:"critical"`
+}
+
+// DefaultRiskThresholds are the standard 25/50/70/85 cutoffs
+var DefaultRiskThresholds = RiskThresholds{Low: 25, Medium: 50, High: 70, Critical: 85}
+
+// Validate checks that the thresholds are within 0-100 and strictly ascending
+func (t RiskThresholds) Validate() error {
+	if t.Low <= 0 || t.Low >= t.Medium || t.Medium >= t.High || t.High >= t.Critical || t.Critical > 100 {
+		return fmt.Errorf("thresholds must satisfy 0 < low < medium < high < critical <= 100, got %d/%d/%d/%d",
+			t.Low, t.Medium, t.High, t.Critical)
+	}
+	return nil
+}
+
+// Classify returns the risk level of a score: clean, low, medium, high or
+// critical. The zero value classifies with DefaultRiskThresholds.
+func (t RiskThresholds) Classify(score int) string {
+	if t == (RiskThresholds{}) {
+		t = DefaultRiskThresholds
+	}
 	switch {
-	case score >= 85:
+	case score >= t.Critical:
 		return "critical"
-	case score >= 70:
+	case score >= t.High:
 		return "high"
-	case score >= 50:
+	case score >= t.Medium:
 		return "medium"
-	case score >= 25:
+	case score >= t.Low:
 		return "low"
 	default:
-		return "safe"
+		return "clean"
 	}
 }
 
+// GetRiskLevel returns risk level based on score using the default thresholds
+func GetRiskLevel(score int) string {
+	return DefaultRiskThresholds.Classify(score)
+}
+
+// CheckRequest represents a single IP check request with enrichment options
+type CheckRequest struct {
+	IP         string `json:"ip"`
+	Explain    bool   `json:"explain"`     // Include a breakdown of the score
+	RDNS       bool   `json:"rdns"`        // Resolve the IP's PTR hostname
+	Scan       bool   `json:"scan"`        // Active scan; served by judge nodes only
+	IncludeGeo *bool  `json:"include_geo"` // Defaults to true
+}
+
 // BatchCheckRequest represents a batch IP check request
 type BatchCheckRequest struct {
 	IPs []string `json:"ips" validate:"required,min=1,max=100"`
@@ -134,6 +185,12 @@ type FeedEntry struct {
 	Confidence float64      `json:"confidence"`
 	Weight     int          `json:"weight"`
 	FetchedAt  time.Time    `json:"fetched_at"`
+	// FirstSeen is when the feed says it first observed the entry; zero when
+	// the feed does not say
+	FirstSeen time.Time `json:"first_seen,omitempty"`
+	// Tags and Description carry per-entry context from structured feeds
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
 }
 
 // IsPrefix returns true if the entry is a CIDR prefix
@@ -160,6 +217,36 @@ type APIStats struct {
 	AvgResponseTime float64 `json:"avg_response_time_ms"`
 	ErrorRate       float64 `json:"error_rate"`
 	Period          string  `json:"period"`
+	Source          string  `json:"source"` // clickhouse or postgres
+}
+
+// ErrorCode is a stable, machine-readable error identifier clients can switch on
+type ErrorCode string
+
+// Error codes of ErrorResponse
+const (
+	ErrCodeInvalidRequest     ErrorCode = "invalid_request"
+	ErrCodeInvalidIP          ErrorCode = "invalid_ip"
+	ErrCodeTooManyIPs         ErrorCode = "too_many_ips"
+	ErrCodeInvalidPeriod      ErrorCode = "invalid_period"
+	ErrCodeInvalidConfig      ErrorCode = "invalid_config"
+	ErrCodeMissingAPIKey      ErrorCode = "missing_api_key"
+	ErrCodeInvalidAPIKey      ErrorCode = "invalid_api_key"
+	ErrCodeInsufficientTier   ErrorCode = "insufficient_tier"
+	ErrCodeNotFound           ErrorCode = "not_found"
+	ErrCodeMethodNotAllowed   ErrorCode = "method_not_allowed"
+	ErrCodePayloadTooLarge    ErrorCode = "payload_too_large"
+	ErrCodeRateLimited        ErrorCode = "rate_limited"
+	ErrCodeFeatureDisabled    ErrorCode = "feature_disabled"
+	ErrCodeServiceUnavailable ErrorCode = "service_unavailable"
+	ErrCodeInternal           ErrorCode = "internal_error"
+)
+
+// ErrorResponse is the body of every error response of the API and judge nodes
+type ErrorResponse struct {
+	Code    ErrorCode   `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 // HealthStatus represents the health status of a service
@@ -170,3 +257,18 @@ type HealthStatus struct {
 	Timestamp time.Time         `json:"timestamp"`
 	Services  map[string]string `json:"services"`
 }
+
+// FeedStatus represents the health of a configured threat feed
+type FeedStatus struct {
+	Name        string     `json:"name"`
+	DisplayName string     `json:"display_name"`
+	Enabled     bool       `json:"enabled"`
+	ThreatType  string     `json:"threat_type"`
+	Schedule    string     `json:"schedule"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastStatus  string     `json:"last_status,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastEntries int        `json:"last_entries"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+}
@@ -94,9 +94,9 @@ func TestGetRiskLevel(t *testing.T) {
 		score int
 		want  string
 	}{
-		{0, "safe"},
-		{10, "safe"},
-		{24, "safe"},
+		{0, "clean"},
+		{10, "clean"},
+		{24, "clean"},
 		{25, "low"},
 		{49, "low"},
 		{50, "medium"},
@@ -115,6 +115,48 @@ func TestGetRiskLevel(t *testing.T) {
 	}
 }
 
+func TestRiskThresholdsClassify(t *testing.T) {
+	strict := RiskThresholds{Low: 10, Medium: 30, High: 50, Critical: 70}
+
+	tests := []struct {
+		name       string
+		thresholds RiskThresholds
+		score      int
+		want       string
+	}{
+		{"custom clean", strict, 9, "clean"},
+		{"custom low", strict, 10, "low"},
+		{"custom high", strict, 55, "high"},
+		{"custom critical", strict, 70, "critical"},
+		{"zero value uses defaults", RiskThresholds{}, 24, "clean"},
+		{"zero value critical", RiskThresholds{}, 85, "critical"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.thresholds.Classify(tt.score); got != tt.want {
+				t.Errorf("Classify(%d) = %v, want %v", tt.score, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRiskThresholdsValidate(t *testing.T) {
+	if err := DefaultRiskThresholds.Validate(); err != nil {
+		t.Errorf("DefaultRiskThresholds.Validate() = %v", err)
+	}
+	for _, bad := range []RiskThresholds{
+		{},
+		{Low: 50, Medium: 25, High: 70, Critical: 85},
+		{Low: 25, Medium: 50, High: 70, Critical: 101},
+		{Low: 25, Medium: 50, High: 50, Critical: 85},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", bad)
+		}
+	}
+}
+
 func TestFeedEntryIsPrefix(t *testing.T) {
 	tests := []struct {
 		name     string
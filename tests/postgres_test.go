@@ -0,0 +1,960 @@
+//go:build integration
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/lfrfrfr/beon-ipquality/internal/api/handlers"
+	"github.com/lfrfrfr/beon-ipquality/internal/api/middleware"
+	"github.com/lfrfrfr/beon-ipquality/internal/config"
+	"github.com/lfrfrfr/beon-ipquality/internal/database"
+	"github.com/lfrfrfr/beon-ipquality/internal/metrics"
+	"github.com/lfrfrfr/beon-ipquality/migrations"
+	"github.com/lfrfrfr/beon-ipquality/pkg/models"
+)
+
+// testDB connects to the database named by BEON_TEST_POSTGRES_DSN, skipping the test when unset
+func testDB(t testing.TB) *database.PostgresDB {
+	t.Helper()
+
+	dsn := os.Getenv("BEON_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("BEON_TEST_POSTGRES_DSN not set")
+	}
+
+	db, err := database.NewPostgresDB(dsn, 4, 1)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// cleanupSource removes all reputation rows written by a test source
+func cleanupSource(t testing.TB, db *database.PostgresDB, source string) {
+	t.Helper()
+	t.Cleanup(func() {
+		_, _ = db.Pool().Exec(context.Background(), "DELETE FROM ip_reputation WHERE source = $1", source)
+	})
+}
+
+func TestInsertReputationStoresIngestedBy(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	source := "integration_ingested_by"
+	cleanupSource(t, db, source)
+
+	instanceID := "ingestor-test-01"
+	now := time.Now()
+
+	single := &database.IPReputationEntry{
+		IPStart:    "198.51.100.1",
+		IPEnd:      "198.51.100.1",
+		Source:     source,
+		ThreatType: "attack",
+		Confidence: 0.9,
+		Weight:     80,
+		FirstSeen:  now,
+		LastSeen:   now,
+		IngestedBy: &instanceID,
+	}
+	if err := db.InsertReputation(ctx, single); err != nil {
+		t.Fatalf("InsertReputation() error = %v", err)
+	}
+
+	batch := []database.IPReputationEntry{{
+		IPStart:    "198.51.100.2",
+		IPEnd:      "198.51.100.2",
+		Source:     source,
+		ThreatType: "attack",
+		Confidence: 0.9,
+		Weight:     80,
+		FirstSeen:  now,
+		LastSeen:   now,
+		IngestedBy: &instanceID,
+	}}
+	if _, err := db.InsertReputationBatch(ctx, batch); err != nil {
+		t.Fatalf("InsertReputationBatch() error = %v", err)
+	}
+
+	bulk := []database.IPReputationEntry{{
+		IPStart:    "198.51.100.3",
+		IPEnd:      "198.51.100.3",
+		Source:     source,
+		ThreatType: "attack",
+		Confidence: 0.9,
+		Weight:     80,
+		FirstSeen:  now,
+		LastSeen:   now,
+		IngestedBy: &instanceID,
+	}}
+	if _, err := db.InsertReputationBulk(ctx, bulk); err != nil {
+		t.Fatalf("InsertReputationBulk() error = %v", err)
+	}
+
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		entries, err := db.LookupIP(ctx, ip, false)
+		if err != nil {
+			t.Fatalf("LookupIP(%s) error = %v", ip, err)
+		}
+
+		found := false
+		for _, e := range entries {
+			if e.Source != source {
+				continue
+			}
+			found = true
+			if e.IngestedBy == nil || *e.IngestedBy != instanceID {
+				t.Errorf("LookupIP(%s) ingested_by = %v, want %q", ip, e.IngestedBy, instanceID)
+			}
+		}
+		if !found {
+			t.Errorf("LookupIP(%s) returned no entry for source %s", ip, source)
+		}
+	}
+}
+
+func TestCleanupByRetention(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	source := "integration_retention"
+	cleanupSource(t, db, source)
+
+	lastSeen := time.Now().Add(-10 * 24 * time.Hour)
+	entries := []database.IPReputationEntry{
+		{IPStart: "203.0.113.10", IPEnd: "203.0.113.10", Source: source, ThreatType: "proxy", Confidence: 0.8, Weight: 40, FirstSeen: lastSeen, LastSeen: lastSeen},
+		{IPStart: "203.0.113.11", IPEnd: "203.0.113.11", Source: source, ThreatType: "botnet_c2", Confidence: 0.9, Weight: 90, FirstSeen: lastSeen, LastSeen: lastSeen},
+		{IPStart: "203.0.113.12", IPEnd: "203.0.113.12", Source: source, ThreatType: "Proxy", Confidence: 0.8, Weight: 40, FirstSeen: lastSeen, LastSeen: lastSeen},
+		{IPStart: "203.0.113.13", IPEnd: "203.0.113.13", Source: source, ThreatType: "BOTNET_C2", Confidence: 0.9, Weight: 90, FirstSeen: lastSeen, LastSeen: lastSeen},
+	}
+	if _, err := db.InsertReputationBatch(ctx, entries); err != nil {
+		t.Fatalf("InsertReputationBatch() error = %v", err)
+	}
+
+	retention := map[string]time.Duration{
+		"proxy":     72 * time.Hour,
+		"botnet_c2": 90 * 24 * time.Hour,
+	}
+	// The default would remove every entry whose type did not match
+	if _, err := db.CleanupByRetention(ctx, retention, 24*time.Hour); err != nil {
+		t.Fatalf("CleanupByRetention() error = %v", err)
+	}
+
+	for ip, want := range map[string]bool{
+		"203.0.113.10": false, // proxy, past its 72h
+		"203.0.113.11": true,  // botnet_c2, within its 90 days
+		"203.0.113.12": false, // Proxy matches proxy
+		"203.0.113.13": true,  // BOTNET_C2 matches botnet_c2
+	} {
+		if found := hasSource(t, db, ip, source); found != want {
+			t.Errorf("%s kept = %v, want %v", ip, found, want)
+		}
+	}
+}
+
+// hasSource reports whether ip has a live reputation entry from source
+func hasSource(t *testing.T, db *database.PostgresDB, ip, source string) bool {
+	t.Helper()
+
+	entries, err := db.LookupIP(context.Background(), ip, false)
+	if err != nil {
+		t.Fatalf("LookupIP(%s) error = %v", ip, err)
+	}
+	for _, e := range entries {
+		if e.Source == source {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReadReplicaServesLookups(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	if db.ReadPool() != db.Pool() {
+		t.Fatal("ReadPool() should fall back to the primary pool without a replica")
+	}
+
+	// A replica DSN may be given explicitly; otherwise the primary stands in for it
+	replicaDSN := os.Getenv("BEON_TEST_POSTGRES_REPLICA_DSN")
+	if replicaDSN == "" {
+		replicaDSN = os.Getenv("BEON_TEST_POSTGRES_DSN")
+	}
+	if err := db.AttachReadReplica(replicaDSN, 2, 0); err != nil {
+		t.Fatalf("AttachReadReplica: %v", err)
+	}
+	if db.ReadPool() == db.Pool() {
+		t.Fatal("ReadPool() should return the replica pool once attached")
+	}
+
+	source := "integration_read_replica"
+	cleanupSource(t, db, source)
+
+	now := time.Now()
+	entry := &database.IPReputationEntry{
+		IPStart:    "198.51.100.77",
+		IPEnd:      "198.51.100.77",
+		Source:     source,
+		ThreatType: "spam",
+		Confidence: 0.6,
+		Weight:     40,
+		FirstSeen:  now,
+		LastSeen:   now,
+	}
+	if err := db.InsertReputation(ctx, entry); err != nil {
+		t.Fatalf("InsertReputation: %v", err)
+	}
+
+	// Replication lag is possible against a real replica
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if hasSource(t, db, "198.51.100.77", source) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("LookupIP via replica did not return the %s entry", source)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// histogramCount returns the number of observations recorded for a query type
+func histogramCount(t *testing.T, queryType string) uint64 {
+	t.Helper()
+
+	var m dto.Metric
+	observer := metrics.PostgresQueryDuration.WithLabelValues(queryType)
+	if err := observer.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestQueriesRecordDuration(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		queryType string
+		run       func() error
+	}{
+		{"lookup", func() error {
+			_, err := db.LookupIP(ctx, "198.51.100.200", false)
+			return err
+		}},
+		{"cleanup", func() error {
+			_, err := db.CleanupExpired(ctx)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.queryType, func(t *testing.T) {
+			before := histogramCount(t, tt.queryType)
+			if err := tt.run(); err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if after := histogramCount(t, tt.queryType); after != before+1 {
+				t.Errorf("%s observations = %d, want %d", tt.queryType, after, before+1)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	ms, err := migrations.Postgres()
+	if err != nil {
+		t.Fatalf("Postgres() error = %v", err)
+	}
+	if _, err := db.Migrate(ctx, ms); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	// Everything is recorded, so a second run applies nothing
+	applied, err := db.Migrate(ctx, ms)
+	if err != nil {
+		t.Fatalf("second Migrate() error = %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second Migrate() applied %v, want nothing", applied)
+	}
+
+	// The upserts depend on the (ip_start, ip_end, source) unique index
+	var exists bool
+	err = db.Pool().QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_ip_reputation_unique')").Scan(&exists)
+	if err != nil || !exists {
+		t.Errorf("idx_ip_reputation_unique exists = %v (err %v), want true", exists, err)
+	}
+
+	missing, err := db.CheckIndexes(ctx)
+	if err != nil {
+		t.Fatalf("CheckIndexes() error = %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("CheckIndexes() missing %v after Migrate, want none", missing)
+	}
+
+	// Lookups now use the range index form
+	source := "integration_migrate"
+	cleanupSource(t, db, source)
+	now := time.Now()
+	entry := database.IPReputationEntry{IPStart: "198.51.100.140", IPEnd: "198.51.100.143", Source: source, ThreatType: "spam", Confidence: 1, Weight: 60, FirstSeen: now, LastSeen: now}
+	if _, err := db.InsertReputationBatch(ctx, []database.IPReputationEntry{entry}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	lookupSource(t, db, "198.51.100.142", source)
+}
+
+func TestUpsertPreservesFirstSeen(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	source := "integration_first_seen"
+	cleanupSource(t, db, source)
+
+	first := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	second := time.Now().Truncate(time.Second)
+
+	entry := func(seen time.Time) database.IPReputationEntry {
+		return database.IPReputationEntry{
+			IPStart:    "198.51.100.90",
+			IPEnd:      "198.51.100.90",
+			Source:     source,
+			ThreatType: "spam",
+			Confidence: 0.5,
+			Weight:     40,
+			FirstSeen:  seen,
+			LastSeen:   seen,
+		}
+	}
+
+	if _, err := db.InsertReputationBatch(ctx, []database.IPReputationEntry{entry(first)}); err != nil {
+		t.Fatalf("first insert: %v", err)
+	}
+	if _, err := db.InsertReputationBatch(ctx, []database.IPReputationEntry{entry(second)}); err != nil {
+		t.Fatalf("second insert: %v", err)
+	}
+	again := entry(second)
+	if err := db.InsertReputation(ctx, &again); err != nil {
+		t.Fatalf("single insert: %v", err)
+	}
+
+	got := lookupSource(t, db, "198.51.100.90", source)
+	if !got.FirstSeen.Equal(first) {
+		t.Errorf("FirstSeen = %v, want %v (preserved from first insert)", got.FirstSeen, first)
+	}
+	if !got.LastSeen.Equal(second) {
+		t.Errorf("LastSeen = %v, want %v", got.LastSeen, second)
+	}
+
+	// A later report carrying an older first observation moves first_seen back
+	earliest := first.Add(-30 * 24 * time.Hour)
+	backdated := entry(second)
+	backdated.FirstSeen = earliest
+	if _, err := db.InsertReputationBatch(ctx, []database.IPReputationEntry{backdated}); err != nil {
+		t.Fatalf("backdated insert: %v", err)
+	}
+	got = lookupSource(t, db, "198.51.100.90", source)
+	if !got.FirstSeen.Equal(earliest) {
+		t.Errorf("FirstSeen = %v, want %v (earliest observation)", got.FirstSeen, earliest)
+	}
+	if !got.LastSeen.Equal(second) {
+		t.Errorf("LastSeen = %v, want %v", got.LastSeen, second)
+	}
+}
+
+func TestInsertReputationRevivesExpiredRow(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	source := "integration_revive"
+	cleanupSource(t, db, source)
+
+	now := time.Now().Truncate(time.Second)
+	expired := now.Add(-time.Hour)
+	report := func(confidence float64, expiresAt time.Time) *database.IPReputationEntry {
+		return &database.IPReputationEntry{
+			IPStart:    "198.51.100.95",
+			IPEnd:      "198.51.100.95",
+			Source:     source,
+			ThreatType: "attack",
+			Confidence: confidence,
+			Weight:     60,
+			FirstSeen:  now,
+			LastSeen:   now,
+			ExpiresAt:  &expiresAt,
+		}
+	}
+
+	if err := db.InsertReputation(ctx, report(0.9, expired)); err != nil {
+		t.Fatalf("first report: %v", err)
+	}
+
+	renewed := now.Add(72 * time.Hour)
+	again := report(0.4, renewed)
+	if err := db.InsertReputation(ctx, again); err != nil {
+		t.Fatalf("second report: %v", err)
+	}
+
+	// The returned entry is the stored row: the new expiry, the merged confidence
+	if again.ExpiresAt == nil || !again.ExpiresAt.Equal(renewed) {
+		t.Errorf("returned ExpiresAt = %v, want %v", again.ExpiresAt, renewed)
+	}
+	if again.Confidence != 0.9 {
+		t.Errorf("returned Confidence = %v, want the stored 0.9", again.Confidence)
+	}
+
+	got := lookupSource(t, db, "198.51.100.95", source)
+	if got.ID != again.ID || got.ExpiresAt == nil || !got.ExpiresAt.Equal(renewed) {
+		t.Errorf("stored row = id %d expiring %v, want id %d expiring %v", got.ID, got.ExpiresAt, again.ID, renewed)
+	}
+}
+
+func TestBulkInsertMatchesBatch(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	source := "integration_bulk"
+	cleanupSource(t, db, source)
+
+	first := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	second := time.Now().Truncate(time.Second)
+	entry := func(seen time.Time) database.IPReputationEntry {
+		cidr := "198.51.100.96/32"
+		return database.IPReputationEntry{
+			IPStart:    "198.51.100.96",
+			IPEnd:      "198.51.100.96",
+			CIDR:       &cidr,
+			Source:     source,
+			ThreatType: "spam",
+			Confidence: 0.5,
+			Weight:     40,
+			FirstSeen:  seen,
+			LastSeen:   seen,
+		}
+	}
+
+	if _, err := db.InsertReputationBatch(ctx, []database.IPReputationEntry{entry(first)}); err != nil {
+		t.Fatalf("batch insert: %v", err)
+	}
+	// The same range twice in one COPY must not abort the upsert
+	if _, err := db.InsertReputationBulk(ctx, []database.IPReputationEntry{entry(second), entry(second)}); err != nil {
+		t.Fatalf("bulk insert: %v", err)
+	}
+
+	got := lookupSource(t, db, "198.51.100.96", source)
+	if !got.FirstSeen.Equal(first) {
+		t.Errorf("FirstSeen = %v, want %v (preserved from batch insert)", got.FirstSeen, first)
+	}
+	if !got.LastSeen.Equal(second) {
+		t.Errorf("LastSeen = %v, want %v", got.LastSeen, second)
+	}
+	if got.ExpiresAt != nil {
+		t.Errorf("ExpiresAt = %v, want none as with batch inserts", got.ExpiresAt)
+	}
+}
+
+func TestLookupIPsMatchesLookupIP(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	source := "integration_lookup_ips"
+	cleanupSource(t, db, source)
+
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+	entries := []database.IPReputationEntry{
+		{IPStart: "198.51.100.160", IPEnd: "198.51.100.175", Source: source, ThreatType: "proxy", Confidence: 0.6, Weight: 40, FirstSeen: now, LastSeen: now},
+		{IPStart: "198.51.100.161", IPEnd: "198.51.100.161", Source: source, ThreatType: "botnet_c2", Confidence: 0.9, Weight: 90, FirstSeen: now, LastSeen: now},
+		{IPStart: "198.51.100.170", IPEnd: "198.51.100.170", Source: source, ThreatType: "spam", Confidence: 0.5, Weight: 30, FirstSeen: now, LastSeen: now, ExpiresAt: &expired},
+		{IPStart: "2001:db8:100::", IPEnd: "2001:db8:100::ffff", Source: source, ThreatType: "vpn", Confidence: 0.7, Weight: 50, FirstSeen: now, LastSeen: now},
+	}
+	if _, err := db.InsertReputationBatch(ctx, entries); err != nil {
+		t.Fatalf("InsertReputationBatch() error = %v", err)
+	}
+
+	// Listed once or twice, expired, unlisted, IPv6 and a duplicate
+	ips := []string{"198.51.100.160", "198.51.100.161", "198.51.100.170", "198.51.100.200", "2001:db8:100::1", "198.51.100.161"}
+	got, err := db.LookupIPs(ctx, ips, false)
+	if err != nil {
+		t.Fatalf("LookupIPs() error = %v", err)
+	}
+
+	for _, ip := range ips {
+		want, err := db.LookupIP(ctx, ip, false)
+		if err != nil {
+			t.Fatalf("LookupIP(%s) error = %v", ip, err)
+		}
+		if _, ok := got[ip]; !ok && len(want) > 0 {
+			t.Errorf("LookupIPs() has no entries for %s, LookupIP has %d", ip, len(want))
+			continue
+		}
+		if !reflect.DeepEqual(entryIDs(got[ip]), entryIDs(want)) {
+			t.Errorf("LookupIPs()[%s] = ids %v, LookupIP = ids %v", ip, entryIDs(got[ip]), entryIDs(want))
+		}
+	}
+	if n := len(lookupIPsFrom(got["198.51.100.161"], source)); n != 2 {
+		t.Errorf("LookupIPs()[198.51.100.161] has %d %s entries, want 2", n, source)
+	}
+	if _, ok := got["198.51.100.200"]; ok {
+		t.Error("LookupIPs() has entries for unlisted 198.51.100.200")
+	}
+
+	if _, err := db.LookupIPs(ctx, []string{"198.51.100.160", "not-an-ip"}, false); err == nil {
+		t.Error("LookupIPs() with an invalid IP succeeded, want an error")
+	}
+}
+
+func TestLookupIPIncludeMetadata(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	sources := []string{"integration_meta_a", "integration_meta_b", "integration_meta_c"}
+	for _, source := range sources {
+		cleanupSource(t, db, source)
+	}
+
+	// Overlapping ranges from three sources, each with its own metadata
+	now := time.Now().Truncate(time.Second)
+	entries := []database.IPReputationEntry{
+		{IPStart: "198.51.100.176", IPEnd: "198.51.100.191", Source: sources[0], ThreatType: "proxy", Confidence: 0.6, Weight: 40,
+			FirstSeen: now, LastSeen: now, Metadata: map[string]interface{}{"feed_line": float64(12)}},
+		{IPStart: "198.51.100.180", IPEnd: "198.51.100.180", Source: sources[1], ThreatType: "spam", Confidence: 0.8, Weight: 60,
+			FirstSeen: now, LastSeen: now.Add(-time.Hour), Metadata: map[string]interface{}{"reports": float64(3)}},
+		{IPStart: "198.51.100.128", IPEnd: "198.51.100.255", Source: sources[2], ThreatType: "datacenter", Confidence: 0.5, Weight: 20,
+			FirstSeen: now, LastSeen: now.Add(-2 * time.Hour), Metadata: map[string]interface{}{"asn": float64(64500)}},
+	}
+	if _, err := db.InsertReputationBatch(ctx, entries); err != nil {
+		t.Fatalf("InsertReputationBatch() error = %v", err)
+	}
+
+	with, err := db.LookupIP(ctx, "198.51.100.180", true)
+	if err != nil {
+		t.Fatalf("LookupIP(include metadata) error = %v", err)
+	}
+	for i, want := range entries {
+		got := lookupIPsFrom(with, want.Source)
+		if len(got) != 1 {
+			t.Fatalf("LookupIP() has %d rows from %s, want 1", len(got), want.Source)
+		}
+		if got[0].Confidence != want.Confidence || !got[0].LastSeen.Equal(want.LastSeen) || !reflect.DeepEqual(got[0].Metadata, want.Metadata) {
+			t.Errorf("row %d = %.2f %v %v, want %.2f %v %v", i, got[0].Confidence, got[0].LastSeen, got[0].Metadata, want.Confidence, want.LastSeen, want.Metadata)
+		}
+	}
+
+	without, err := db.LookupIP(ctx, "198.51.100.180", false)
+	if err != nil {
+		t.Fatalf("LookupIP() error = %v", err)
+	}
+	for _, e := range without {
+		if e.Metadata != nil {
+			t.Errorf("LookupIP() without metadata returned %v for %s", e.Metadata, e.Source)
+		}
+	}
+	if len(without) != len(with) {
+		t.Errorf("LookupIP() returned %d rows without metadata, %d with", len(without), len(with))
+	}
+}
+
+// entryIDs returns the sorted IDs of entries; rows tied on weight and
+// confidence may come back in either order
+func entryIDs(entries []database.IPReputationEntry) []int64 {
+	ids := make([]int64, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// lookupIPsFrom returns the entries of one source
+func lookupIPsFrom(entries []database.IPReputationEntry, source string) []database.IPReputationEntry {
+	var out []database.IPReputationEntry
+	for _, e := range entries {
+		if e.Source == source {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// BenchmarkInsertReputation compares both insert paths by store size, to
+// place database.bulk_insert_threshold:
+//
+//	BEON_TEST_POSTGRES_DSN=... go test -tags integration -run '^$' -bench InsertReputation ./tests/
+func BenchmarkInsertReputation(b *testing.B) {
+	db := testDB(b)
+	ctx := context.Background()
+
+	source := "integration_bench"
+	cleanupSource(b, db, source)
+
+	for _, n := range []int{100, 1000, 5000, 20000, 50000} {
+		entries := make([]database.IPReputationEntry, n)
+		now := time.Now()
+		for i := range entries {
+			ip := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+			entries[i] = database.IPReputationEntry{
+				IPStart: ip, IPEnd: ip, Source: source, ThreatType: "spam",
+				Confidence: 0.5, Weight: 40, FirstSeen: now, LastSeen: now,
+			}
+		}
+
+		for _, path := range []struct {
+			name   string
+			insert func(context.Context, []database.IPReputationEntry) (int, error)
+		}{{"batch", db.InsertReputationBatch}, {"bulk", db.InsertReputationBulk}} {
+			b.Run(fmt.Sprintf("%s/%d", path.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := path.insert(ctx, entries); err != nil {
+						b.Fatalf("insert: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestUpsertStrategy(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		strategy       database.UpsertStrategy
+		wantConfidence float64
+		wantWeight     int
+	}{
+		{database.UpsertMax, 0.9, 80},
+		{database.UpsertLatest, 0.4, 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			source := "integration_upsert_" + string(tt.strategy)
+			cleanupSource(t, db, source)
+			db.SetUpsertStrategy(tt.strategy)
+			t.Cleanup(func() { db.SetUpsertStrategy(database.UpsertMax) })
+
+			now := time.Now()
+			reports := []database.IPReputationEntry{
+				{IPStart: "198.51.100.91", IPEnd: "198.51.100.91", Source: source, ThreatType: "attack", Confidence: 0.9, Weight: 80, FirstSeen: now, LastSeen: now},
+				{IPStart: "198.51.100.91", IPEnd: "198.51.100.91", Source: source, ThreatType: "attack", Confidence: 0.4, Weight: 30, FirstSeen: now, LastSeen: now},
+			}
+			for _, r := range reports {
+				if _, err := db.InsertReputationBatch(ctx, []database.IPReputationEntry{r}); err != nil {
+					t.Fatalf("insert: %v", err)
+				}
+			}
+
+			got := lookupSource(t, db, "198.51.100.91", source)
+			if got.Confidence != tt.wantConfidence || got.Weight != tt.wantWeight {
+				t.Errorf("confidence/weight = %v/%d, want %v/%d", got.Confidence, got.Weight, tt.wantConfidence, tt.wantWeight)
+			}
+		})
+	}
+}
+
+// lookupSource returns the entry for ip written by source, failing the test if absent
+func lookupSource(t *testing.T, db *database.PostgresDB, ip, source string) database.IPReputationEntry {
+	t.Helper()
+
+	entries, err := db.LookupIP(context.Background(), ip, false)
+	if err != nil {
+		t.Fatalf("LookupIP: %v", err)
+	}
+	for _, e := range entries {
+		if e.Source == source {
+			return e
+		}
+	}
+	t.Fatalf("no %s entry for %s", source, ip)
+	return database.IPReputationEntry{}
+}
+
+func TestStreamActiveReputationsByThreatType(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	source := "integration_export"
+	cleanupSource(t, db, source)
+
+	now := time.Now()
+	entries := []database.IPReputationEntry{
+		{IPStart: "198.51.100.120", IPEnd: "198.51.100.120", Source: source, ThreatType: "botnet_c2", Confidence: 1, Weight: 95, FirstSeen: now, LastSeen: now},
+		{IPStart: "198.51.100.121", IPEnd: "198.51.100.121", Source: source, ThreatType: "spam", Confidence: 1, Weight: 60, FirstSeen: now, LastSeen: now},
+	}
+	if _, err := db.InsertReputationBatch(ctx, entries); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	var got []string
+	err := db.StreamActiveReputations(ctx, "botnet_c2", func(e *database.IPReputationEntry) error {
+		if e.Source == source {
+			got = append(got, e.IPStart)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamActiveReputations: %v", err)
+	}
+	if len(got) != 1 || got[0] != "198.51.100.120" {
+		t.Errorf("streamed %v, want only 198.51.100.120", got)
+	}
+}
+
+func TestRequestStats(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	// Rows stamped in the future keep other log entries out of the window
+	future := time.Now().Add(time.Hour)
+	t.Cleanup(func() {
+		_, _ = db.Pool().Exec(context.Background(), "DELETE FROM api_request_log WHERE created_at >= $1", future)
+	})
+	for _, row := range []struct {
+		ip string
+		ms float64
+	}{{"198.51.100.130", 2}, {"198.51.100.130", 4}, {"198.51.100.131", 6}} {
+		_, err := db.Pool().Exec(ctx,
+			"INSERT INTO api_request_log (ip_queried, response_time_ms, created_at) VALUES ($1, $2, $3)",
+			row.ip, row.ms, future)
+		if err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	stats, err := db.RequestStats(ctx, future.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("RequestStats: %v", err)
+	}
+	if stats.TotalRequests != 3 || stats.TotalIPs != 2 || stats.AvgResponseTime != 4 {
+		t.Errorf("RequestStats = %+v, want 3 requests, 2 IPs, 4ms average", stats)
+	}
+}
+
+func TestUpsertASNInfo(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	// Private-use ASNs keep the test away from real data
+	t.Cleanup(func() {
+		_, _ = db.Pool().Exec(context.Background(), "DELETE FROM asn_info WHERE asn IN (64512, 64513)")
+	})
+
+	infos := []models.ASNInfo{
+		{ASN: 64512, Org: "Test Hosting", CountryCode: "US", ASNType: "hosting", RiskModifier: 15},
+		{ASN: 64513, Org: "Test ISP", ASNType: "isp"},
+	}
+	inserted, updated, err := db.UpsertASNInfo(ctx, infos)
+	if err != nil {
+		t.Fatalf("UpsertASNInfo: %v", err)
+	}
+	if inserted != 2 || updated != 0 {
+		t.Errorf("first import: inserted %d, updated %d; want 2, 0", inserted, updated)
+	}
+
+	infos[0].RiskModifier = 25
+	inserted, updated, err = db.UpsertASNInfo(ctx, infos[:1])
+	if err != nil {
+		t.Fatalf("UpsertASNInfo: %v", err)
+	}
+	if inserted != 0 || updated != 1 {
+		t.Errorf("second import: inserted %d, updated %d; want 0, 1", inserted, updated)
+	}
+
+	got, err := db.GetASNInfo(ctx, 64512)
+	if err != nil || got == nil {
+		t.Fatalf("GetASNInfo: %v, %v", got, err)
+	}
+	if got.ASNType != "hosting" || got.RiskModifier != 25 {
+		t.Errorf("GetASNInfo = %+v, want hosting with modifier 25", got)
+	}
+
+	// Nullable columns left empty must still scan
+	isp, err := db.GetASNInfo(ctx, 64513)
+	if err != nil || isp == nil || isp.CountryCode != "" {
+		t.Errorf("GetASNInfo(64513) = %+v, %v", isp, err)
+	}
+}
+
+// cleanupFeedRuns removes the run history of a test feed
+func cleanupFeedRuns(t testing.TB, db *database.PostgresDB, feed string) {
+	t.Helper()
+	t.Cleanup(func() {
+		_, _ = db.Pool().Exec(context.Background(), "DELETE FROM feed_fetch_history WHERE feed_name = $1", feed)
+	})
+}
+
+// recordFeedRuns records runs of feed in order, apart enough to order them by created_at
+func recordFeedRuns(t *testing.T, db *database.PostgresDB, feed string, runs ...database.FeedRun) {
+	t.Helper()
+	for _, run := range runs {
+		run.FeedName = feed
+		if err := db.RecordFeedRun(context.Background(), run); err != nil {
+			t.Fatalf("RecordFeedRun: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFeedStatuses(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	feed := "integration_feed_status"
+	cleanupFeedRuns(t, db, feed)
+
+	recordFeedRuns(t, db, feed,
+		database.FeedRun{Status: database.FeedRunSuccess, EntriesCount: 100, StoredCount: 100, Duration: time.Second},
+		database.FeedRun{Status: database.FeedRunPartial, EntriesCount: 40, StoredCount: 40, ErrorMessage: "b: timeout"},
+		database.FeedRun{Status: database.FeedRunError, ErrorMessage: "a: refused; b: refused"},
+	)
+
+	statuses, err := db.GetFeedStatuses(ctx)
+	if err != nil {
+		t.Fatalf("GetFeedStatuses: %v", err)
+	}
+	got, ok := statuses[feed]
+	if !ok {
+		t.Fatalf("no status for %s", feed)
+	}
+	if got.LastStatus != database.FeedRunError || got.LastError != "a: refused; b: refused" {
+		t.Errorf("last run = %q (%q), want the failed run", got.LastStatus, got.LastError)
+	}
+	// The partial run is newer but does not count as a success
+	if got.LastEntries != 100 || got.SuccessCount != 1 || got.ErrorCount != 1 {
+		t.Errorf("status = %+v, want 100 entries from 1 success and 1 error", got)
+	}
+	if got.LastSuccess == nil || got.LastRun == nil || !got.LastSuccess.Before(*got.LastRun) {
+		t.Errorf("last success %v, last run %v; want the success before the last run", got.LastSuccess, got.LastRun)
+	}
+
+	// A feed that only ever partly succeeded has no last success
+	partial := "integration_feed_partial"
+	cleanupFeedRuns(t, db, partial)
+	recordFeedRuns(t, db, partial, database.FeedRun{Status: database.FeedRunPartial, EntriesCount: 5, ErrorMessage: "b: timeout"})
+
+	statuses, err = db.GetFeedStatuses(ctx)
+	if err != nil {
+		t.Fatalf("GetFeedStatuses: %v", err)
+	}
+	if got := statuses[partial]; got == nil || got.LastSuccess != nil || got.LastEntries != 0 || got.LastStatus != database.FeedRunPartial {
+		t.Errorf("partial-only feed status = %+v, want no last success", got)
+	}
+}
+
+func TestGetFeeds(t *testing.T) {
+	db := testDB(t)
+
+	feed := "integration_feed_endpoint"
+	cleanupFeedRuns(t, db, feed)
+	recordFeedRuns(t, db, feed,
+		database.FeedRun{Status: database.FeedRunSuccess, EntriesCount: 7},
+		database.FeedRun{Status: database.FeedRunSkipped, ErrorMessage: "feed has no sources"},
+	)
+
+	handlers.SetDatabase(db)
+	handlers.SetFeedsConfig(&config.FeedsConfig{Feeds: map[string]config.FeedConfig{
+		feed:    {Name: "Endpoint Feed", ThreatType: "spam", Schedule: "0 * * * *", Enabled: true},
+		"never": {Name: "Never Run", Schedule: "0 * * * *"},
+	}})
+	t.Cleanup(func() {
+		handlers.SetDatabase(nil)
+		handlers.SetFeedsConfig(nil)
+	})
+
+	app := fiber.New()
+	app.Get("/feeds", handlers.GetFeeds())
+	resp, err := app.Test(httptest.NewRequest("GET", "/feeds", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	var body struct {
+		Feeds []models.FeedStatus `json:"feeds"`
+		Count int                 `json:"count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Count != 2 || len(body.Feeds) != 2 {
+		t.Fatalf("got %d feeds, want 2", body.Count)
+	}
+
+	got := body.Feeds[0]
+	if got.Name != feed {
+		got = body.Feeds[1]
+	}
+	if got.LastStatus != database.FeedRunSkipped || got.LastEntries != 7 || got.LastSuccess == nil || got.NextRun == nil {
+		t.Errorf("feed status = %+v, want skipped last run after a 7-entry success, and a next run", got)
+	}
+	for _, f := range body.Feeds {
+		if f.Name == "never" && (f.LastRun != nil || f.NextRun != nil) {
+			t.Errorf("disabled feed without runs = %+v, want no last or next run", f)
+		}
+	}
+}
+
+func TestReportIPAttributesAPIKey(t *testing.T) {
+	db := testDB(t)
+	cleanupSource(t, db, handlers.ManualReportSource)
+
+	// No RequireTier in front of the route: the key is resolved by the handler
+	handlers.SetDatabase(db)
+	middleware.SetKeyLookup(func(_ context.Context, hash string) (*models.APIKey, error) {
+		if hash == middleware.HashAPIKey("reporter_key") {
+			return &models.APIKey{ID: 42, Tier: "enterprise"}, nil
+		}
+		return nil, nil
+	})
+	t.Cleanup(func() {
+		handlers.SetDatabase(nil)
+		middleware.SetKeyLookup(nil)
+	})
+
+	app := fiber.New()
+	app.Post("/report", handlers.ReportIP())
+	req := httptest.NewRequest("POST", "/report", strings.NewReader(`{"ip":"45.155.205.77","threat_type":"proxy"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "reporter_key")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("status = %d, want 201", resp.StatusCode)
+	}
+
+	var entry database.IPReputationEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if entry.IngestedBy == nil || *entry.IngestedBy != "api-key:42" {
+		t.Errorf("ingested_by = %v, want api-key:42", entry.IngestedBy)
+	}
+}